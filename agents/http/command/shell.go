@@ -3,6 +3,7 @@ package command
 import (
 	"os/exec"
 	"runtime"
+	"time"
 )
 
 // CommandIDShell Shell 命令 ID
@@ -25,16 +26,41 @@ func (c *ShellCommand) Name() string {
 
 func (c *ShellCommand) Execute(task *Task) ([]byte, error) {
 	command := string(task.Arguments)
-	return executeShellCommand(command)
+	return executeShellCommand(task.TaskID, command)
 }
 
 // executeShellCommand 根据操作系统执行 shell 命令
-func executeShellCommand(command string) ([]byte, error) {
+// 长时间运行的命令会按 ProgressInterval 增量上报中间输出，最终仍返回完整输出
+func executeShellCommand(taskID string, command string) ([]byte, error) {
 	var cmd *exec.Cmd
 	if runtime.GOOS == "windows" {
 		cmd = exec.Command("cmd", "/C", command)
 	} else {
 		cmd = exec.Command("/bin/sh", "-c", command)
 	}
-	return cmd.CombinedOutput()
+
+	var output progressBuffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	ticker := time.NewTicker(ProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			return output.Bytes(), err
+		case <-ticker.C:
+			ReportProgress(taskID, output.Unreported())
+		}
+	}
 }
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"time"
+
+	"simplec2/pkg/constants"
 )
 
 // CommandIDSleep Sleep 命令 ID
@@ -55,13 +57,13 @@ func (c *SleepCommand) Execute(task *Task) ([]byte, error) {
 	}
 
 	// 验证 sleep 范围
-	if args.Sleep < 1 || args.Sleep > 3600 {
-		return nil, fmt.Errorf("sleep value must be between 1 and 3600 seconds, got %d", args.Sleep)
+	if args.Sleep < constants.MinSleep || args.Sleep > constants.MaxSleep {
+		return nil, fmt.Errorf("sleep value must be between %d and %d seconds, got %d", constants.MinSleep, constants.MaxSleep, args.Sleep)
 	}
 
 	// 验证 jitter 范围
-	if args.Jitter < 0 || args.Jitter > 99 {
-		return nil, fmt.Errorf("jitter value must be between 0 and 99 percent, got %d", args.Jitter)
+	if args.Jitter < 0 || args.Jitter > constants.MaxJitter {
+		return nil, fmt.Errorf("jitter value must be between 0 and %d percent, got %d", constants.MaxJitter, args.Jitter)
 	}
 
 	SleepInterval = time.Duration(args.Sleep) * time.Second
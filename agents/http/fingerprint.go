@@ -0,0 +1,19 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// hostFingerprint identifies the host and user the beacon runs as across restarts, so the
+// TeamServer can link a re-staged beacon to the one it replaces. Only a hash of the machine ID is
+// sent. Empty if the machine ID can't be read, as hostname and user alone aren't unique.
+func hostFingerprint(hostname, username string) string {
+	id := machineID()
+	if id == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(id) + "|" + strings.ToLower(hostname) + "|" + strings.ToLower(username)))
+	return hex.EncodeToString(sum[:])
+}
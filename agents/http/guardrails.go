@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// Execution guardrails injected by the payload builder via -ldflags -X.
+// When set, the beacon only runs on matching hosts and exits silently elsewhere.
+var (
+	guardHostnames string // Comma-separated list of allowed hostnames (case-insensitive)
+	guardNetworks  string // Comma-separated list of CIDRs, at least one local address must be inside
+)
+
+// guardrailsPass reports whether the current host satisfies all configured guardrails.
+func guardrailsPass() bool {
+	if guardHostnames != "" {
+		hostname, err := os.Hostname()
+		if err != nil || !hostnameAllowed(hostname) {
+			log.Printf("Guardrail: hostname %q not allowed", hostname)
+			return false
+		}
+	}
+	if guardNetworks != "" && !networkAllowed() {
+		log.Println("Guardrail: no local address inside the allowed networks")
+		return false
+	}
+	return true
+}
+
+func hostnameAllowed(hostname string) bool {
+	short := strings.SplitN(hostname, ".", 2)[0]
+	for _, allowed := range strings.Split(guardHostnames, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if strings.EqualFold(allowed, hostname) || strings.EqualFold(allowed, short) {
+			return true
+		}
+	}
+	return false
+}
+
+func networkAllowed() bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, cidr := range strings.Split(guardNetworks, ",") {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && network.Contains(ipNet.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
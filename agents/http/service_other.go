@@ -0,0 +1,8 @@
+//go:build !(windows && service)
+
+package main
+
+// runAsService is a no-op for builds without the service tag.
+func runAsService() bool {
+	return false
+}
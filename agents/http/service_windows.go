@@ -0,0 +1,47 @@
+//go:build windows && service
+
+package main
+
+import (
+	"log"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// serviceName is the SCM service name, set at build time via -ldflags.
+var serviceName string
+
+// beaconService implements svc.Handler so the beacon can run under the Service Control Manager.
+type beaconService struct{}
+
+func (s *beaconService) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+
+	changes <- svc.Status{State: svc.StartPending}
+	go runBeacon()
+	changes <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for req := range requests {
+		switch req.Cmd {
+		case svc.Interrogate:
+			changes <- req.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			changes <- svc.Status{State: svc.StopPending}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// runAsService runs the beacon under the SCM when started as a Windows service.
+// It returns false when the binary was started interactively.
+func runAsService() bool {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false
+	}
+	if err := svc.Run(serviceName, &beaconService{}); err != nil {
+		log.Printf("Service failed: %v", err)
+	}
+	return true
+}
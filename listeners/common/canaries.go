@@ -0,0 +1,104 @@
+package common
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"simplec2/pkg/bridge"
+	"simplec2/pkg/logger"
+)
+
+const (
+	// maxPendingCanaryHits bounds the canary hits kept for the next status report.
+	maxPendingCanaryHits = 1000
+	// maxCanaryHeaderSize bounds the length of a header value reported with a canary hit.
+	maxCanaryHeaderSize = 1024
+)
+
+// canaries holds the canary URIs the TeamServer registered on this listener.
+var canaries = &canaryURIs{uris: make(map[string]string)}
+
+type canaryURIs struct {
+	mu   sync.Mutex
+	uris map[string]string // Canary IDs by URI
+	hits []*bridge.CanaryHit
+}
+
+// handle applies a canary command and reports whether cmd was one.
+func (c *canaryURIs) handle(cmd *bridge.ListenerCommand) bool {
+	if cmd.Action != bridge.ListenerCommand_SYNC_CANARIES {
+		return false
+	}
+	uris := make(map[string]string, len(cmd.Canaries))
+	for _, canary := range cmd.Canaries {
+		uris[canary.Uri] = canary.Id
+	}
+	c.mu.Lock()
+	c.uris = uris
+	c.mu.Unlock()
+	logger.Infof("Watching %d canary URIs", len(uris))
+	return true
+}
+
+// take moves the hits since the last report into a status report.
+func (c *canaryURIs) take(report *bridge.ListenerStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report.CanaryHits = c.hits
+	c.hits = nil
+}
+
+// pending reports whether hits are waiting to be reported.
+func (c *canaryURIs) pending() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.hits) > 0
+}
+
+// hit records a request for a canary URI, or returns false if the request's path isn't one.
+func (c *canaryURIs) hit(r *http.Request) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.uris[r.URL.Path]
+	if !ok {
+		return false
+	}
+	logger.Warnf("Canary %s requested by %s", r.URL.Path, r.RemoteAddr)
+	if len(c.hits) >= maxPendingCanaryHits {
+		return true
+	}
+	headers := make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		value := strings.Join(values, ", ")
+		if len(value) > maxCanaryHeaderSize {
+			value = value[:maxCanaryHeaderSize]
+		}
+		headers[name] = value
+	}
+	c.hits = append(c.hits, &bridge.CanaryHit{
+		CanaryId:   id,
+		Time:       timestamppb.New(time.Now()),
+		RemoteAddr: r.RemoteAddr,
+		Method:     r.Method,
+		RequestUri: r.RequestURI,
+		UserAgent:  r.UserAgent(),
+		Headers:    headers,
+	})
+	return true
+}
+
+// ServeCanaries answers requests for the canary URIs the TeamServer registered on this listener
+// with a plain 404, so whoever requests them can't tell, and reports them on the control channel.
+// Every other request is passed to next.
+func ServeCanaries(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !canaries.hit(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
@@ -4,22 +4,29 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"time"
 
+	"github.com/google/uuid"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"simplec2/pkg/bridge"
 	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
 )
 
 var TSClient bridge.TeamServerBridgeServiceClient
 
+// requestIDMetadataKey carries the ID of a gRPC call, so the TeamServer logs it with the call.
+const requestIDMetadataKey = "x-request-id"
+
 // IsNotFound checks if an error is a gRPC status error with the code NotFound.
 func IsNotFound(err error) bool {
 	s, ok := status.FromError(err)
@@ -29,7 +36,13 @@ func IsNotFound(err error) bool {
 	return s.Code() == codes.NotFound
 }
 
-// ConnectToTeamServer establishes a secure mTLS connection to the TeamServer.
+// idempotentMethods only read from the TeamServer, so they are retried when it is unavailable.
+// Other calls are only retried by gRPC when they never reached the TeamServer.
+var idempotentMethods = []string{"GetListenerSharedSecret", "GetBeaconSessionKey", "GetBeaconConfig", "GetTaskedFileChunk", "StreamTaskedFile"}
+
+// ConnectToTeamServer establishes a secure mTLS connection to the TeamServer. The connection is
+// kept alive with pings, so a half-open connection is detected and replaced rather than failing
+// every beacon request until the OS gives up on it.
 func ConnectToTeamServer(cfg *config.ListenerConfig) (*grpc.ClientConn, error) {
 	// Load client's certificate and private key
 	clientCert, err := tls.LoadX509KeyPair(cfg.Certs.ClientCert, cfg.Certs.ClientKey)
@@ -56,91 +69,205 @@ func ConnectToTeamServer(cfg *config.ListenerConfig) (*grpc.ClientConn, error) {
 	creds := credentials.NewTLS(tlsConfig)
 	teamserverAddr := fmt.Sprintf("%s%s", cfg.TeamServer.Host, cfg.TeamServer.Port)
 	conn, err := grpc.NewClient(teamserverAddr, grpc.WithTransportCredentials(creds),
-		grpc.WithBlock(),
-		grpc.WithDefaultCallOptions(
-			grpc.MaxCallSendMsgSize(100*1024*1024), // 100 MB
-			grpc.MaxCallRecvMsgSize(100*1024*1024), // 100 MB
-		),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.GRPC.GetKeepaliveTime(),
+			Timeout:             cfg.GRPC.GetKeepaliveTimeout(),
+			PermitWithoutStream: true,
+		}),
+		grpc.WithDefaultServiceConfig(retryServiceConfig(cfg.GRPC.GetMaxRetries())),
+		grpc.WithUnaryInterceptor(deadlineInterceptor(cfg.GRPC.GetCallTimeout())),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("did not connect to teamserver: %w", err)
 	}
+	// Connect now rather than on the first call
+	conn.Connect()
+	go watchConnection(conn)
 
 	TSClient = bridge.NewTeamServerBridgeServiceClient(conn)
-	log.Printf("Successfully connected to TeamServer gRPC with mTLS at %s", teamserverAddr)
+	logger.Infof("Connecting to TeamServer gRPC with mTLS at %s", teamserverAddr)
 	return conn, nil
 }
 
+// retryServiceConfig returns the service config retrying idempotent calls failing with UNAVAILABLE.
+func retryServiceConfig(maxRetries int) string {
+	if maxRetries == 0 {
+		return "{}"
+	}
+	names := make([]map[string]string, 0, len(idempotentMethods))
+	for _, method := range idempotentMethods {
+		names = append(names, map[string]string{"service": bridge.TeamServerBridgeService_ServiceDesc.ServiceName, "method": method})
+	}
+	serviceConfig, _ := json.Marshal(map[string]interface{}{
+		"methodConfig": []map[string]interface{}{{
+			"name": names,
+			"retryPolicy": map[string]interface{}{
+				"maxAttempts":          maxRetries + 1,
+				"initialBackoff":       "0.1s",
+				"maxBackoff":           "1s",
+				"backoffMultiplier":    2,
+				"retryableStatusCodes": []string{"UNAVAILABLE"},
+			},
+		}},
+	})
+	return string(serviceConfig)
+}
+
+// deadlineInterceptor gives unary calls made without a deadline the configured one, so a call can't
+// hang on an unresponsive TeamServer.
+func deadlineInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
 // StartControlChannel starts the bi-directional control stream with the TeamServer.
 // commandHandler is a function that will be called when a command is received from the TeamServer.
-func StartControlChannel(cfg *config.ListenerConfig, listenerType string, configJSON string, commandHandler func(*bridge.ListenerCommand)) {
+// While the stream is up, the listener's status is reported on it periodically; statusCheck, if
+// not nil, tells whether the listener is serving beacons.
+func StartControlChannel(cfg *config.ListenerConfig, listenerType string, configJSON string, commandHandler func(*bridge.ListenerCommand), statusCheck func() error) {
 	go func() {
 		for {
 			// Create a context without timeout for the long-lived stream
-			ctx := context.Background()
+			ctx, cancel := context.WithCancel(context.Background())
 			
 			// Add auth headers
 			apiKey, err := cfg.GetAPIKey()
 			if err != nil {
-				log.Printf("Warning: Failed to get API key for control channel: %v", err)
+				logger.Warnf("Failed to get API key for control channel: %v", err)
 				apiKey = cfg.Auth.APIKey
 			}
-			md := metadata.New(map[string]string{"authorization": "Bearer " + apiKey})
+			md := metadata.New(map[string]string{"authorization": "Bearer " + apiKey, requestIDMetadataKey: uuid.NewString()})
 			ctx = metadata.NewOutgoingContext(ctx, md)
 
 			stream, err := TSClient.ListenerControl(ctx)
 			if err != nil {
-				log.Printf("Failed to connect to control channel: %v. Retrying in 5s...", err)
+				logger.Warnf("Failed to connect to control channel: %v. Retrying in 5s...", err)
+				cancel()
 				time.Sleep(5 * time.Second)
 				continue
 			}
 
 			// Send initial status
-			err = stream.Send(&bridge.ListenerStatus{
-				ListenerName: cfg.Listener.Name,
-				Active:       true, // Assuming active upon connection
-				Type:         listenerType,
-				ConfigJson:   configJSON,
-			})
+			initial := listenerStatus(cfg, listenerType, nil)
+			initial.Active = true // Assuming active upon connection
+			initial.ConfigJson = configJSON
+			shipper.take(initial)
+			hosting.take(initial)
+			canaries.take(initial)
+			err = stream.Send(initial)
 			if err != nil {
-				log.Printf("Failed to send initial status: %v", err)
+				logger.Warnf("Failed to send initial status: %v", err)
 				stream.CloseSend()
+				cancel()
 				time.Sleep(5 * time.Second)
 				continue
 			}
 
-			log.Println("Control channel established.")
+			logger.Info("Control channel established.")
+			controlChannelUp.Store(true)
+
+			// Status heartbeat, until the stream breaks. Waiting log entries, hosted file downloads and
+			// canary hits are sent with it, or sooner with a status report of their own
+			go func() {
+				ticker := time.NewTicker(cfg.GRPC.GetStatusInterval())
+				defer ticker.Stop()
+				flush := time.NewTicker(logFlushInterval)
+				defer flush.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-flush.C:
+						if !shipper.pending() && !hosting.pending() && !canaries.pending() {
+							continue
+						}
+					case <-ticker.C:
+					}
+					report := listenerStatus(cfg, listenerType, statusCheck)
+					shipper.take(report)
+					hosting.take(report)
+					canaries.take(report)
+					if err := stream.Send(report); err != nil {
+						return
+					}
+				}
+			}()
 
 			// Receive loop
 			for {
 				cmd, err := stream.Recv()
 				if err != nil {
-					log.Printf("Control channel disconnected: %v", err)
+					logger.Warnf("Control channel disconnected: %v", err)
+					controlChannelUp.Store(false)
 					break // Break inner loop to reconnect
 				}
 
+				// Hosted files and canaries are handled here, in order, for every listener type
+				if hosting.handle(cmd) || canaries.handle(cmd) {
+					continue
+				}
 				// Call the handler
 				if commandHandler != nil {
 					go commandHandler(cmd)
 				}
 			}
+			cancel()
 
 			time.Sleep(5 * time.Second) // Wait before reconnecting
 		}
 	}()
 }
 
+// listenerStatus returns the status reported on the control channel: whether the listener serves
+// beacons, and the state of its connection to the TeamServer.
+func listenerStatus(cfg *config.ListenerConfig, listenerType string, statusCheck func() error) *bridge.ListenerStatus {
+	report := &bridge.ListenerStatus{
+		ListenerName: cfg.Listener.Name,
+		Active:       true,
+		Type:         listenerType,
+	}
+	if statusCheck != nil {
+		if err := statusCheck(); err != nil {
+			report.Active = false
+			report.ErrorMessage = err.Error()
+		}
+	}
+	state, reconnects, lastDisconnect := connStats.snapshot()
+	report.Connectivity = state.String()
+	report.Reconnects = reconnects
+	if !lastDisconnect.IsZero() {
+		report.LastDisconnect = timestamppb.New(lastDisconnect)
+	}
+	return report
+}
+
 // CreateAuthenticatedContext creates a new context with the API key attached for gRPC calls.
 func CreateAuthenticatedContext(cfg *config.ListenerConfig) (context.Context, context.CancelFunc) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.GRPC.GetCallTimeout())
 	// 获取 API Key（优先使用加密版本）
 	apiKey, err := cfg.GetAPIKey()
 	if err != nil {
-		log.Printf("Warning: Failed to get API key: %v", err)
+		logger.Warnf("Failed to get API key: %v", err)
 		// 使用明文版本作为回退
 		apiKey = cfg.Auth.APIKey
 	}
-	md := metadata.New(map[string]string{"authorization": "Bearer " + apiKey})
+	md := metadata.New(map[string]string{"authorization": "Bearer " + apiKey, requestIDMetadataKey: uuid.NewString()})
 	ctx = metadata.NewOutgoingContext(ctx, md)
 	return ctx, cancel
 }
+
+// RequestID returns the request ID of a context created by CreateAuthenticatedContext, so that
+// failures can be matched with the TeamServer's logs.
+func RequestID(ctx context.Context) string {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if ids := md.Get(requestIDMetadataKey); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"simplec2/pkg/logger"
+)
+
+// controlChannelUp is set while the control channel with the TeamServer is established.
+var controlChannelUp atomic.Bool
+
+// connStats tracks the connection to the TeamServer, for the status heartbeat.
+var connStats connectionStats
+
+type connectionStats struct {
+	mu             sync.Mutex
+	state          connectivity.State
+	reconnects     int32
+	lastDisconnect time.Time
+}
+
+func (c *connectionStats) snapshot() (connectivity.State, int32, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state, c.reconnects, c.lastDisconnect
+}
+
+// watchConnection records the state changes of the connection to the TeamServer until it is closed.
+func watchConnection(conn *grpc.ClientConn) {
+	state := conn.GetState()
+	for {
+		connStats.mu.Lock()
+		if connStats.state == connectivity.Ready && state != connectivity.Ready {
+			connStats.reconnects++
+			connStats.lastDisconnect = time.Now()
+			logger.Warnf("Connection to TeamServer lost (%s), reconnecting...", state)
+		} else if state == connectivity.Ready && connStats.reconnects > 0 {
+			logger.Info("Connection to TeamServer restored.")
+		}
+		connStats.state = state
+		connStats.mu.Unlock()
+
+		if state == connectivity.Shutdown || !conn.WaitForStateChange(context.Background(), state) {
+			return
+		}
+		state = conn.GetState()
+	}
+}
+
+// HealthCheck is a condition the listener needs to serve beacons.
+type HealthCheck struct {
+	Name  string
+	Check func() error
+}
+
+// healthResult is the outcome of one check, as reported by the health endpoint.
+type healthResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ControlChannelCheck checks that the control channel with the TeamServer is established.
+func ControlChannelCheck() error {
+	if !controlChannelUp.Load() {
+		return fmt.Errorf("control channel is not connected")
+	}
+	return nil
+}
+
+// ConnectionCheck returns a check of the gRPC connection to the TeamServer.
+func ConnectionCheck(conn *grpc.ClientConn) func() error {
+	return func() error {
+		if state := conn.GetState(); state == connectivity.TransientFailure || state == connectivity.Shutdown {
+			return fmt.Errorf("connection to TeamServer is %s", state)
+		}
+		return nil
+	}
+}
+
+// StartHealthServer serves GET /healthz on addr for load balancers and monitoring. It answers 200 if
+// every check passes and 503 otherwise, with the result of each check.
+// addr should not be the port beacons talk to, so the endpoint isn't exposed to targets.
+func StartHealthServer(addr string, checks []HealthCheck) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		status, code := "ok", http.StatusOK
+		results := make([]healthResult, 0, len(checks))
+		for _, check := range checks {
+			result := healthResult{Name: check.Name, Status: "ok"}
+			if err := check.Check(); err != nil {
+				result.Status, result.Error = "fail", err.Error()
+				status, code = "fail", http.StatusServiceUnavailable
+			}
+			results = append(results, result)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     status,
+			"checked_at": time.Now(),
+			"checks":     results,
+		})
+	})
+
+	go func() {
+		logger.Infof("Health endpoint listening on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.Errorf("Health endpoint failed: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,198 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"simplec2/pkg/bridge"
+	"simplec2/pkg/logger"
+)
+
+// maxPendingDownloads bounds the downloads kept for the next status report.
+const maxPendingDownloads = 1000
+
+// hosting holds the files the TeamServer hosts on this listener.
+var hosting = &hostedFiles{
+	files:   make(map[string]*hostedFile),
+	partial: make(map[string]*hostedFile),
+}
+
+// hostedFile is a file served at a URI, or one still being received.
+type hostedFile struct {
+	id          string
+	uri         string
+	contentType string
+	sha256      string
+	content     []byte
+	received    int64
+	limited     bool  // Whether the downloads are limited
+	left        int64 // Downloads left if limited
+}
+
+type hostedFiles struct {
+	mu        sync.Mutex
+	files     map[string]*hostedFile // Complete files by URI
+	partial   map[string]*hostedFile // Files being received by ID
+	downloads []*bridge.HostedFileDownload
+}
+
+// handle applies a hosted file command and reports whether cmd was one. Commands are handled in the
+// order they are received, so the parts of a file arrive before the next command.
+func (h *hostedFiles) handle(cmd *bridge.ListenerCommand) bool {
+	switch cmd.Action {
+	case bridge.ListenerCommand_HOST_FILE:
+		if cmd.HostedFile != nil {
+			h.receive(cmd.HostedFile)
+		}
+	case bridge.ListenerCommand_UNHOST_FILE:
+		if cmd.HostedFile != nil {
+			h.remove(func(f *hostedFile) bool { return f.id == cmd.HostedFile.Id })
+		}
+	case bridge.ListenerCommand_SYNC_HOSTED_FILES:
+		keep := make(map[string]bool, len(cmd.HostedFileIds))
+		for _, id := range cmd.HostedFileIds {
+			keep[id] = true
+		}
+		h.remove(func(f *hostedFile) bool { return !keep[f.id] })
+	default:
+		return false
+	}
+	return true
+}
+
+// receive stores a part of a file and starts serving the file once it is complete.
+func (h *hostedFiles) receive(part *bridge.HostedFile) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	file, ok := h.partial[part.Id]
+	if part.Offset == 0 {
+		if part.Size < 0 {
+			return
+		}
+		file = &hostedFile{
+			id:          part.Id,
+			uri:         part.Uri,
+			contentType: part.ContentType,
+			sha256:      part.Sha256,
+			content:     make([]byte, part.Size),
+			limited:     part.DownloadsLeft > 0,
+			left:        part.DownloadsLeft,
+		}
+		h.partial[part.Id] = file
+	} else if !ok {
+		logger.Warnf("Ignoring part of hosted file %s received out of order", part.Id)
+		return
+	}
+	if part.Offset != file.received || file.received+int64(len(part.Data)) > int64(len(file.content)) {
+		logger.Warnf("Dropping hosted file %s: part at offset %d doesn't fit", part.Id, part.Offset)
+		delete(h.partial, part.Id)
+		return
+	}
+	copy(file.content[part.Offset:], part.Data)
+	file.received += int64(len(part.Data))
+	if file.received < int64(len(file.content)) {
+		return
+	}
+
+	delete(h.partial, part.Id)
+	sum := sha256.Sum256(file.content)
+	if hex.EncodeToString(sum[:]) != file.sha256 {
+		logger.Errorf("Dropping hosted file %s: SHA256 mismatch", part.Id)
+		return
+	}
+	for uri, existing := range h.files {
+		if existing.id == file.id {
+			delete(h.files, uri)
+		}
+	}
+	h.files[file.uri] = file
+	logger.Infof("Hosting %s (%d bytes)", file.uri, len(file.content))
+}
+
+// remove stops serving the files matching drop.
+func (h *hostedFiles) remove(drop func(*hostedFile) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for uri, file := range h.files {
+		if drop(file) {
+			delete(h.files, uri)
+			logger.Infof("Stopped hosting %s", uri)
+		}
+	}
+	for id, file := range h.partial {
+		if drop(file) {
+			delete(h.partial, id)
+		}
+	}
+}
+
+// take moves the downloads since the last report into a status report.
+func (h *hostedFiles) take(report *bridge.ListenerStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	report.HostedFileDownloads = h.downloads
+	h.downloads = nil
+}
+
+// pending reports whether downloads are waiting to be reported.
+func (h *hostedFiles) pending() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.downloads) > 0
+}
+
+// serve returns the file hosted at the request's path and records the download, or false if no
+// file is hosted there.
+func (h *hostedFiles) serve(r *http.Request) (*hostedFile, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	file, ok := h.files[r.URL.Path]
+	if !ok {
+		return nil, false
+	}
+	if file.limited {
+		file.left--
+		if file.left <= 0 {
+			delete(h.files, r.URL.Path)
+			logger.Infof("Stopped hosting %s: download limit reached", r.URL.Path)
+		}
+	}
+	if len(h.downloads) < maxPendingDownloads {
+		h.downloads = append(h.downloads, &bridge.HostedFileDownload{
+			FileId:     file.id,
+			Time:       timestamppb.New(time.Now()),
+			RemoteAddr: r.RemoteAddr,
+			UserAgent:  r.UserAgent(),
+		})
+	}
+	return file, true
+}
+
+// ServeHostedFiles serves GET requests for the files the TeamServer hosts on this listener and
+// passes every other request to next.
+func ServeHostedFiles(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		file, ok := hosting.serve(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		contentType := file.contentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(file.content)))
+		w.Write(file.content)
+	})
+}
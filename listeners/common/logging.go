@@ -0,0 +1,143 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"simplec2/pkg/bridge"
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+)
+
+// logFlushInterval is how often log entries waiting to be sent to the TeamServer are sent.
+const logFlushInterval = time.Second
+
+// shipper buffers the log entries sent to the TeamServer; nil unless logging.remote is set.
+var shipper *logShipper
+
+// ConfigureLogging applies the configured log level and outputs. Entries logged before the
+// control channel is up are kept, within the buffer size, and sent once it is.
+func ConfigureLogging(cfg *config.ListenerLoggingConfig) error {
+	opts := logger.Options{Level: cfg.Level}
+	if cfg.File != nil {
+		opts.File = &logger.FileOptions{
+			Path:           cfg.File.Path,
+			MaxSizeMB:      cfg.File.GetMaxSizeMB(),
+			MaxBackups:     cfg.File.MaxBackups,
+			MaxAgeDays:     cfg.File.MaxAgeDays,
+			Compress:       cfg.File.Compress,
+			RotateInterval: cfg.File.GetRotateInterval(),
+		}
+		opts.FileOnly = cfg.File.FileOnly
+	}
+	shipper = nil
+	if cfg.Remote != nil {
+		remoteLevel := cfg.Remote.Level
+		if remoteLevel == "" {
+			remoteLevel = cfg.Level
+		}
+		level, err := logger.ParseLevel(remoteLevel)
+		if err != nil {
+			return fmt.Errorf("invalid remote log level: %w", err)
+		}
+		shipper = &logShipper{level: level, size: cfg.Remote.GetBufferSize()}
+		opts.Outputs = []zapcore.Core{&shipperCore{shipper: shipper}}
+	}
+	return logger.Configure(opts)
+}
+
+// logShipper keeps the log entries to send to the TeamServer, dropping the oldest beyond size.
+type logShipper struct {
+	level zapcore.Level
+	size  int
+
+	mu      sync.Mutex
+	entries []*bridge.ListenerLogEntry
+	dropped int32
+}
+
+func (s *logShipper) add(entry *bridge.ListenerLogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) >= s.size {
+		s.entries = s.entries[1:]
+		s.dropped++
+	}
+	s.entries = append(s.entries, entry)
+}
+
+// take attaches the waiting entries to a status report and forgets them.
+func (s *logShipper) take(report *bridge.ListenerStatus) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report.Logs, report.DroppedLogs = s.entries, s.dropped
+	s.entries, s.dropped = nil, 0
+}
+
+// pending reports whether entries are waiting to be sent.
+func (s *logShipper) pending() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries) > 0 || s.dropped > 0
+}
+
+// shipperCore is the log output handing entries to a logShipper.
+type shipperCore struct {
+	shipper *logShipper
+	fields  []zapcore.Field
+}
+
+func (c *shipperCore) Enabled(level zapcore.Level) bool {
+	return level >= c.shipper.level
+}
+
+func (c *shipperCore) With(fields []zapcore.Field) zapcore.Core {
+	return &shipperCore{shipper: c.shipper, fields: append(c.fields[:len(c.fields):len(c.fields)], fields...)}
+}
+
+func (c *shipperCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *shipperCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	// Written to through the logger's tee, which doesn't check the level of each output
+	if !c.Enabled(entry.Level) {
+		return nil
+	}
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range append(c.fields[:len(c.fields):len(c.fields)], fields...) {
+		field.AddTo(encoder)
+	}
+	shipped := &bridge.ListenerLogEntry{
+		Time:    timestamppb.New(entry.Time),
+		Level:   entry.Level.CapitalString(),
+		Message: entry.Message,
+	}
+	if entry.Caller.Defined {
+		shipped.Caller = entry.Caller.TrimmedPath()
+	}
+	if len(encoder.Fields) > 0 {
+		shipped.Fields = make(map[string]string, len(encoder.Fields))
+		for key, value := range encoder.Fields {
+			shipped.Fields[key] = fmt.Sprint(value)
+		}
+	}
+	c.shipper.add(shipped)
+	return nil
+}
+
+func (c *shipperCore) Sync() error {
+	return nil
+}
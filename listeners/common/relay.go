@@ -0,0 +1,239 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"simplec2/pkg/bridge"
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+)
+
+// errRelayDown means a request was not sent because the relay stream is not connected.
+var errRelayDown = errors.New("beacon relay is not connected")
+
+// relay multiplexes the beacon requests of the listener over one BeaconRelay stream, so they don't
+// each need a new call. Requests are sent unary while the stream is down, e.g. when the TeamServer
+// doesn't support it.
+var relay = &beaconRelay{
+	pending: make(map[uint64]chan *bridge.RelayResponse),
+	waiters: make(map[string][]chan struct{}),
+}
+
+type beaconRelay struct {
+	mu      sync.Mutex
+	stream  bridge.TeamServerBridgeService_BeaconRelayClient
+	nextID  uint64
+	pending map[uint64]chan *bridge.RelayResponse // Sent requests by ID, waiting for their response
+	sendMu  sync.Mutex
+
+	waitersMu sync.Mutex
+	waiters   map[string][]chan struct{} // Check-ins waiting for tasks, by beacon ID
+}
+
+// StartBeaconRelay keeps the BeaconRelay stream to the TeamServer connected in the background.
+func StartBeaconRelay(cfg *config.ListenerConfig) {
+	go func() {
+		for {
+			apiKey, err := cfg.GetAPIKey()
+			if err != nil {
+				logger.Warnf("Failed to get API key for beacon relay: %v", err)
+				apiKey = cfg.Auth.APIKey
+			}
+			md := metadata.New(map[string]string{"authorization": "Bearer " + apiKey, requestIDMetadataKey: uuid.NewString()})
+			ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(context.Background(), md))
+
+			stream, err := TSClient.BeaconRelay(ctx)
+			if err == nil {
+				// The TeamServer registers the stream when the first message names the listener
+				err = stream.Send(&bridge.RelayRequest{ListenerName: cfg.Listener.Name})
+			}
+			if err != nil {
+				logger.Warnf("Failed to open beacon relay: %v. Retrying in 5s...", err)
+				cancel()
+				time.Sleep(5 * time.Second)
+				continue
+			}
+
+			relay.mu.Lock()
+			relay.stream = stream
+			relay.mu.Unlock()
+
+			err = relay.receive(stream)
+			relay.disconnect()
+			cancel()
+			if status.Code(err) == codes.Unimplemented {
+				logger.Info("TeamServer doesn't support the beacon relay, using unary calls.")
+				return
+			}
+			logger.Warnf("Beacon relay disconnected: %v. Reconnecting in 5s...", err)
+			time.Sleep(5 * time.Second)
+		}
+	}()
+}
+
+// receive hands the responses of a stream to the requests waiting for them, until it fails.
+func (r *beaconRelay) receive(stream bridge.TeamServerBridgeService_BeaconRelayClient) error {
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if notice := res.GetTaskNotice(); notice != nil {
+			r.notify(notice.BeaconId)
+			continue
+		}
+		r.mu.Lock()
+		ch, ok := r.pending[res.Id]
+		delete(r.pending, res.Id)
+		r.mu.Unlock()
+		if ok {
+			ch <- res
+		}
+	}
+}
+
+// disconnect fails the requests still waiting for a response.
+func (r *beaconRelay) disconnect() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stream = nil
+	for id, ch := range r.pending {
+		close(ch)
+		delete(r.pending, id)
+	}
+}
+
+// call sends a request on the stream and waits for its response. It returns errRelayDown without
+// sending anything if the stream is not connected.
+func (r *beaconRelay) call(ctx context.Context, req *bridge.RelayRequest) (*bridge.RelayResponse, error) {
+	r.mu.Lock()
+	stream := r.stream
+	if stream == nil {
+		r.mu.Unlock()
+		return nil, errRelayDown
+	}
+	r.nextID++
+	req.Id = r.nextID
+	ch := make(chan *bridge.RelayResponse, 1)
+	r.pending[req.Id] = ch
+	r.mu.Unlock()
+
+	req.RequestId = RequestID(ctx)
+	r.sendMu.Lock()
+	err := stream.Send(req)
+	r.sendMu.Unlock()
+	if err != nil {
+		r.forget(req.Id)
+		return nil, err
+	}
+
+	select {
+	case res, ok := <-ch:
+		if !ok {
+			return nil, status.Error(codes.Unavailable, "beacon relay disconnected")
+		}
+		if e := res.GetError(); e != nil {
+			return nil, status.Error(codes.Code(e.Code), e.Message)
+		}
+		return res, nil
+	case <-ctx.Done():
+		r.forget(req.Id)
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (r *beaconRelay) forget(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, id)
+}
+
+// notify wakes the check-ins of a beacon waiting for tasks.
+func (r *beaconRelay) notify(beaconID string) {
+	r.waitersMu.Lock()
+	defer r.waitersMu.Unlock()
+	for _, ch := range r.waiters[beaconID] {
+		close(ch)
+	}
+	delete(r.waiters, beaconID)
+}
+
+// StageBeacon stages a beacon over the relay, or with a unary call while it is down.
+func StageBeacon(ctx context.Context, req *bridge.StageBeaconRequest) (*bridge.StageBeaconResponse, error) {
+	res, err := relay.call(ctx, &bridge.RelayRequest{Payload: &bridge.RelayRequest_Stage{Stage: req}})
+	if err == errRelayDown {
+		return TSClient.StageBeacon(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res.GetStage(), nil
+}
+
+// CheckInBeacon checks a beacon in over the relay, or with a unary call while it is down.
+func CheckInBeacon(ctx context.Context, req *bridge.CheckInBeaconRequest) (*bridge.CheckInBeaconResponse, error) {
+	res, err := relay.call(ctx, &bridge.RelayRequest{Payload: &bridge.RelayRequest_CheckIn{CheckIn: req}})
+	if err == errRelayDown {
+		return TSClient.CheckInBeacon(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res.GetCheckIn(), nil
+}
+
+// pushBeaconOutput sends a task result over the relay, or with a unary call while it is down.
+func pushBeaconOutput(ctx context.Context, req *bridge.PushBeaconOutputRequest) error {
+	_, err := relay.call(ctx, &bridge.RelayRequest{Payload: &bridge.RelayRequest_Output{Output: req}})
+	if err == errRelayDown {
+		_, err = TSClient.PushBeaconOutput(ctx, req)
+	}
+	return err
+}
+
+// WaitForTasks blocks until the TeamServer announces new tasks for a beacon, the timeout passes or
+// ctx is done, and reports whether tasks were announced. It returns false at once if the relay is
+// not connected, since announcements only come over it.
+func WaitForTasks(ctx context.Context, beaconID string, timeout time.Duration) bool {
+	relay.mu.Lock()
+	connected := relay.stream != nil
+	relay.mu.Unlock()
+	if !connected {
+		return false
+	}
+
+	ch := make(chan struct{})
+	relay.waitersMu.Lock()
+	relay.waiters[beaconID] = append(relay.waiters[beaconID], ch)
+	relay.waitersMu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	relay.waitersMu.Lock()
+	defer relay.waitersMu.Unlock()
+	waiters := relay.waiters[beaconID]
+	for i, w := range waiters {
+		if w == ch {
+			relay.waiters[beaconID] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(relay.waiters[beaconID]) == 0 {
+		delete(relay.waiters, beaconID)
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"simplec2/pkg/bridge"
+)
+
+// outputStreamThreshold is the output size above which PushOutput streams a result instead of
+// sending it in one message, which would exceed gRPC's default 4MB message limit.
+const outputStreamThreshold = 1024 * 1024
+
+// outputStreamPartSize is the amount of output in each streamed message.
+const outputStreamPartSize = 256 * 1024
+
+// FetchFileRange reads length bytes at offset of the file of a download or upgrade task, streamed
+// from the TeamServer. It returns less at the end of the file. The TeamServer only serves the file
+// to the beacon the task belongs to.
+func FetchFileRange(ctx context.Context, taskID, beaconID string, offset, length int64) ([]byte, error) {
+	stream, err := TSClient.StreamTaskedFile(ctx, &bridge.StreamTaskedFileRequest{
+		TaskId:   taskID,
+		BeaconId: beaconID,
+		Offset:   offset,
+		Length:   length,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, length)
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk.GetData()...)
+	}
+}
+
+// PushOutput sends a task result to the TeamServer, streamed when the output is large.
+func PushOutput(ctx context.Context, req *bridge.PushBeaconOutputRequest) error {
+	if len(req.Output) <= outputStreamThreshold {
+		return pushBeaconOutput(ctx, req)
+	}
+
+	stream, err := TSClient.PushBeaconOutputStream(ctx)
+	if err != nil {
+		return err
+	}
+	output := req.Output
+	// The first message carries all fields, the following ones only more output
+	first := &bridge.PushBeaconOutputRequest{
+		BeaconId:     req.BeaconId,
+		ListenerName: req.ListenerName,
+		RemoteAddr:   req.RemoteAddr,
+		Timestamp:    req.Timestamp,
+		TaskId:       req.TaskId,
+		CommandId:    req.CommandId,
+		Status:       req.Status,
+		Output:       output[:outputStreamPartSize],
+		ErrorMessage: req.ErrorMessage,
+		Final:        req.Final,
+	}
+	err = stream.Send(first)
+	for offset := outputStreamPartSize; err == nil && offset < len(output); offset += outputStreamPartSize {
+		end := min(offset+outputStreamPartSize, len(output))
+		err = stream.Send(&bridge.PushBeaconOutputRequest{Output: output[offset:end]})
+	}
+	// io.EOF means the TeamServer ended the stream, CloseAndRecv returns why
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to send output: %w", err)
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// releaseKey is the context key of the function giving back a request's slot, see limitConcurrency.
+type releaseKey struct{}
+
+// limitConcurrency lets at most max requests be handled at the same time; a request that can't get
+// a slot within queueTimeout is answered with 503. max 0 is unlimited.
+func limitConcurrency(next http.Handler, max int, queueTimeout time.Duration) http.Handler {
+	if max <= 0 {
+		return next
+	}
+	slots := make(chan struct{}, max)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timer := time.NewTimer(queueTimeout)
+		select {
+		case slots <- struct{}{}:
+			timer.Stop()
+		case <-timer.C:
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "Server busy", http.StatusServiceUnavailable)
+			return
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		}
+
+		var once sync.Once
+		release := func() { once.Do(func() { <-slots }) }
+		defer release()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), releaseKey{}, release)))
+	})
+}
+
+// releaseSlot gives back the slot of a request before it waits idle, e.g. for tasks in a long poll,
+// so waiting requests don't keep others from being handled.
+func releaseSlot(r *http.Request) {
+	if release, ok := r.Context().Value(releaseKey{}).(func()); ok {
+		release()
+	}
+}
+
+// limitBody caps the size of the request bodies of a handler.
+func limitBody(next http.HandlerFunc, limit int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next(w, r)
+	}
+}
+
+// readBody reads the body of a request, answering 413 if it is over the limit set by limitBody
+// and 400 if it can't be read. It reports whether the body was read.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
@@ -13,7 +13,6 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -23,6 +22,8 @@ import (
 	"simplec2/listeners/common"
 	"simplec2/pkg/bridge"
 	"simplec2/pkg/config"
+	"simplec2/pkg/constants"
+	"simplec2/pkg/logger"
 	"simplec2/pkg/pki"
 
 	"github.com/google/uuid"
@@ -33,54 +34,98 @@ var (
 	cfg         config.ListenerConfig
 	privateKey  *rsa.PrivateKey
 	sessionKeys sync.Map // Thread-safe map: sessionID -> sessionKey
+	// sessionBeacons binds a session to the beacon that staged or first checked in over it:
+	// sessionID -> beaconID. File chunks are only fetched for the bound beacon.
+	sessionBeacons sync.Map
 
 	// HTTP Server state
 	httpServer *http.Server
 	serverMu   sync.Mutex
 )
 
+// maxCheckInWait caps how long a check-in asking to wait for tasks is held open.
+const maxCheckInWait = 30 * time.Second
+
 func main() {
 	configPath := flag.String("config", "listener.yaml", "Path to the Listener configuration file.")
+	encryptConfig := flag.Bool("encrypt-config", false, "Encrypt the configuration file in place with the master key from SIMC2_CONFIG_KEY or a prompt, then exit.")
+	decryptConfig := flag.Bool("decrypt-config", false, "Decrypt the configuration file in place, then exit.")
 	flag.Parse()
 
+	if err := logger.Init("info"); err != nil {
+		fmt.Printf("Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	if *encryptConfig {
+		if err := config.EncryptConfigFile(*configPath); err != nil {
+			logger.Fatalf("Failed to encrypt configuration: %v", err)
+		}
+		logger.Infof("Encrypted %s", *configPath)
+		return
+	}
+	if *decryptConfig {
+		if err := config.DecryptConfigFile(*configPath); err != nil {
+			logger.Fatalf("Failed to decrypt configuration: %v", err)
+		}
+		logger.Infof("Decrypted %s", *configPath)
+		return
+	}
+
 	if _, err := os.Stat(*configPath); os.IsNotExist(err) {
-		log.Printf("Configuration file not found. Generating a default one at '%s'", *configPath)
+		logger.Infof("Configuration file not found. Generating a default one at '%s'", *configPath)
 		if err := generateDefaultConfig(*configPath); err != nil {
-			log.Fatalf("Failed to generate default config: %v", err)
+			logger.Fatalf("Failed to generate default config: %v", err)
 		}
-		log.Println("Please review and edit the new configuration file, then restart the listener.")
+		logger.Info("Please review and edit the new configuration file, then restart the listener.")
 		return
 	}
 
 	if err := config.LoadConfig(*configPath, &cfg); err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		logger.Fatalf("Failed to load configuration: %v", err)
+	}
+	if err := common.ConfigureLogging(&cfg.Logging); err != nil {
+		logger.Fatalf("Invalid logging configuration: %v", err)
 	}
 
 	conn, err := common.ConnectToTeamServer(&cfg)
 	if err != nil {
-		log.Fatalf(err.Error())
+		logger.Fatalf("%v", err)
 	}
 	defer conn.Close()
 
 	loadPrivateKey()
 
 	// Construct config JSON for registration
+	// public_key 供 TeamServer 的 payload builder 注入到 beacon 中
 	configJSON, _ := json.Marshal(map[string]interface{}{
-		"port": cfg.Listener.Port,
+		"port":       cfg.Listener.Port,
+		"public_key": publicKeyPEM(),
 	})
 
 	// Start the control channel
-	common.StartControlChannel(&cfg, "HTTP", string(configJSON), handleTeamServerCommand)
+	common.StartControlChannel(&cfg, "HTTP", string(configJSON), handleTeamServerCommand, serverCheck)
+	// Beacon requests share one stream to the TeamServer
+	common.StartBeaconRelay(&cfg)
 
 	// Start the HTTP server initially
 	startServer()
 
+	if cfg.Health.Address != "" {
+		common.StartHealthServer(cfg.Health.Address, []common.HealthCheck{
+			{Name: "http_server", Check: serverCheck},
+			{Name: "teamserver", Check: common.ConnectionCheck(conn)},
+			{Name: "control_channel", Check: common.ControlChannelCheck},
+		})
+	}
+
 	// Block forever, allowing the control channel and server goroutine to run
 	select {}
 }
 
 func handleTeamServerCommand(cmd *bridge.ListenerCommand) {
-	log.Printf("Received command from TeamServer: Action=%s", cmd.Action)
+	logger.Infof("Received command from TeamServer: Action=%s", cmd.Action)
 
 	switch cmd.Action {
 	case bridge.ListenerCommand_START:
@@ -93,11 +138,21 @@ func handleTeamServerCommand(cmd *bridge.ListenerCommand) {
 		time.Sleep(1 * time.Second)
 		startServer()
 	case bridge.ListenerCommand_EXIT:
-		log.Println("Received EXIT command. Shutting down listener process...")
+		logger.Info("Received EXIT command. Shutting down listener process...")
 		stopServer()
 		os.Exit(0)
+	case bridge.ListenerCommand_WIPE_SESSIONS:
+		// Without their session keys, beacons can no longer talk to this listener
+		count := 0
+		sessionKeys.Range(func(key, _ interface{}) bool {
+			sessionKeys.Delete(key)
+			sessionBeacons.Delete(key)
+			count++
+			return true
+		})
+		logger.Infof("Wiped %d session keys.", count)
 	case bridge.ListenerCommand_UPDATE_CONFIG:
-		log.Println("Config update not fully implemented yet.")
+		logger.Warn("Config update not fully implemented yet.")
 	}
 }
 
@@ -106,26 +161,33 @@ func startServer() {
 	defer serverMu.Unlock()
 
 	if httpServer != nil {
-		log.Println("Server is already running.")
+		logger.Info("Server is already running.")
 		return
 	}
 
+	limits := &cfg.HTTP
+	maxBody := limits.GetMaxBodySize()
 	mux := http.NewServeMux()
-	mux.HandleFunc("/handshake", handshakeHandler)
-	mux.HandleFunc("/stage", stageHandler)
-	mux.HandleFunc("/checkin", checkinHandler)
-	mux.HandleFunc("/output", outputHandler)
-	mux.HandleFunc("/chunk", chunkHandler)
+	mux.HandleFunc("/handshake", limitBody(handshakeHandler, maxBody))
+	mux.HandleFunc("/stage", limitBody(stageHandler, maxBody))
+	mux.HandleFunc("/checkin", limitBody(checkinHandler, maxBody))
+	mux.HandleFunc("/output", limitBody(outputHandler, limits.GetMaxOutputSize()))
+	mux.HandleFunc("/chunk", limitBody(chunkHandler, maxBody))
 
 	httpServer = &http.Server{
-		Addr:    cfg.Listener.Port,
-		Handler: mux,
+		Addr:              cfg.Listener.Port,
+		Handler:           limitConcurrency(common.ServeCanaries(common.ServeHostedFiles(mux)), limits.GetMaxConcurrent(), limits.GetQueueTimeout()),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       limits.GetReadTimeout(),
+		WriteTimeout:      limits.GetWriteTimeout(),
+		IdleTimeout:       limits.GetIdleTimeout(),
+		MaxHeaderBytes:    64 * 1024,
 	}
 
 	go func() {
-		log.Printf("HTTP Listener starting on port %s", cfg.Listener.Port)
+		logger.Infof("HTTP Listener starting on port %s", cfg.Listener.Port)
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("HTTP Listener failed: %v", err)
+			logger.Errorf("HTTP Listener failed: %v", err)
 			// Ensure state is cleared if start fails
 			serverMu.Lock()
 			httpServer = nil
@@ -134,24 +196,34 @@ func startServer() {
 	}()
 }
 
+// serverCheck checks that the HTTP server beacons talk to is running.
+func serverCheck() error {
+	serverMu.Lock()
+	defer serverMu.Unlock()
+	if httpServer == nil {
+		return fmt.Errorf("HTTP listener is not running")
+	}
+	return nil
+}
+
 func stopServer() {
 	serverMu.Lock()
 	defer serverMu.Unlock()
 
 	if httpServer == nil {
-		log.Println("Server is not running.")
+		logger.Info("Server is not running.")
 		return
 	}
 
-	log.Println("Stopping HTTP Listener...")
+	logger.Info("Stopping HTTP Listener...")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := httpServer.Shutdown(ctx); err != nil {
-		log.Printf("Error shutting down server: %v", err)
+		logger.Errorf("Error shutting down server: %v", err)
 	}
 	httpServer = nil
-	log.Println("HTTP Listener stopped.")
+	logger.Info("HTTP Listener stopped.")
 }
 
 func generateDefaultConfig(path string) error {
@@ -203,38 +275,48 @@ func loadPrivateKey() {
 	rsaPublicKeyPath := filepath.Join(filepath.Dir(rsaPrivateKeyPath), "listener.pub")
 
 	if _, err := os.Stat(rsaPrivateKeyPath); os.IsNotExist(err) {
-		log.Println("RSA private key not found. Generating new RSA key pair for E2E encryption...")
+		logger.Info("RSA private key not found. Generating new RSA key pair for E2E encryption...")
 		privPEM, pubPEM, genErr := pki.GenerateRSAKeyPair()
 		if genErr != nil {
-			log.Fatalf("Failed to generate RSA key pair: %v", genErr)
+			logger.Fatalf("Failed to generate RSA key pair: %v", genErr)
 		}
 
 		if err := os.MkdirAll(filepath.Dir(rsaPrivateKeyPath), 0755); err != nil {
-			log.Fatalf("Failed to create certs directory: %v", err)
+			logger.Fatalf("Failed to create certs directory: %v", err)
 		}
 		if err := pki.SavePEMFile(rsaPrivateKeyPath, privPEM, 0600); err != nil {
-			log.Fatalf("Failed to save RSA private key: %v", err)
+			logger.Fatalf("Failed to save RSA private key: %v", err)
 		}
 		if err := pki.SavePEMFile(rsaPublicKeyPath, pubPEM, 0644); err != nil {
-			log.Fatalf("Failed to save RSA public key: %v", err)
+			logger.Fatalf("Failed to save RSA public key: %v", err)
 		}
-		log.Println("Generated and saved new RSA key pair.")
+		logger.Info("Generated and saved new RSA key pair.")
 	}
 
 	// Now load the private key (either newly generated or existing)
 	keyData, err := os.ReadFile(rsaPrivateKeyPath)
 	if err != nil {
-		log.Fatalf("Failed to read RSA private key file: %v", err)
+		logger.Fatalf("Failed to read RSA private key file: %v", err)
 	}
 	block, _ := pem.Decode(keyData)
 	if block == nil {
-		log.Fatal("Failed to decode PEM block containing RSA private key")
+		logger.Fatal("Failed to decode PEM block containing RSA private key")
 	}
 	privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
 	if err != nil {
-		log.Fatalf("Failed to parse RSA private key: %v", err)
+		logger.Fatalf("Failed to parse RSA private key: %v", err)
+	}
+	logger.Info("Successfully loaded RSA private key.")
+}
+
+// publicKeyPEM returns the PEM-encoded public key matching the loaded RSA private key.
+func publicKeyPEM() string {
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		logger.Errorf("Failed to marshal RSA public key: %v", err)
+		return ""
 	}
-	log.Println("Successfully loaded RSA private key.")
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
 }
 
 func handshakeHandler(w http.ResponseWriter, r *http.Request) {
@@ -243,16 +325,15 @@ func handshakeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	encryptedSessionKey, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("HANDSHAKE ERROR: Failed to read request body: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
+	encryptedSessionKey, ok := readBody(w, r)
+	if !ok {
+		logger.Warn("Handshake failed: failed to read request body")
 		return
 	}
 
 	sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encryptedSessionKey, nil)
 	if err != nil {
-		log.Printf("HANDSHAKE ERROR: Failed to decrypt session key: %v", err)
+		logger.Warnf("Handshake failed: failed to decrypt session key: %v", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -260,16 +341,15 @@ func handshakeHandler(w http.ResponseWriter, r *http.Request) {
 	sessionID := uuid.New().String()
 	sessionKeys.Store(sessionID, sessionKey)
 
-	log.Printf("Successful handshake. New SessionID: %s", sessionID)
+	logger.Infof("Successful handshake. New SessionID: %s", sessionID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"session_id": sessionID})
 }
 
 func stageHandler(w http.ResponseWriter, r *http.Request) {
-	encryptedBody, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read body", http.StatusBadRequest)
+	encryptedBody, ok := readBody(w, r)
+	if !ok {
 		return
 	}
 
@@ -280,17 +360,17 @@ func stageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// DEBUG LOGGING
-	log.Printf("DEBUG: Staging Decrypted Body: %s", string(decryptedBody))
+	logger.Debugf("Staging Decrypted Body: %s", string(decryptedBody))
 
 	var agentReq bridge.StageBeaconRequest
 	if err := json.Unmarshal(decryptedBody, &agentReq); err != nil {
-		log.Printf("DEBUG: JSON Unmarshal error: %v", err)
+		logger.Debugf("JSON Unmarshal error: %v", err)
 		http.Error(w, "Invalid staging request format", http.StatusBadRequest)
 		return
 	}
 	
 	// DEBUG LOGGING
-	log.Printf("DEBUG: Unmarshaled Metadata: %+v", agentReq.Metadata)
+	logger.Debugf("Unmarshaled Metadata: %+v", agentReq.Metadata)
 
 	ctx, cancel := common.CreateAuthenticatedContext(&cfg)
 	defer cancel()
@@ -304,12 +384,13 @@ func stageHandler(w http.ResponseWriter, r *http.Request) {
 		Timestamp: agentReq.Timestamp,
 	}
 	
-	grpcRes, err := common.TSClient.StageBeacon(ctx, grpcReq)
+	grpcRes, err := common.StageBeacon(ctx, grpcReq)
 	if err != nil {
-		log.Printf("gRPC StageBeacon failed: %v", err)
+		logger.Errorf("gRPC StageBeacon failed (request %s): %v", common.RequestID(ctx), err)
 		http.Error(w, "Failed to stage beacon with TeamServer", http.StatusInternalServerError)
 		return
 	}
+	sessionBeacons.Store(r.Header.Get("X-Session-ID"), grpcRes.GetAssignedBeaconId())
 
 	responseMap := map[string]string{
 		"assigned_beacon_id": grpcRes.GetAssignedBeaconId(),
@@ -319,9 +400,8 @@ func stageHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func checkinHandler(w http.ResponseWriter, r *http.Request) {
-	encryptedBody, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read body", http.StatusBadRequest)
+	encryptedBody, ok := readBody(w, r)
+	if !ok {
 		return
 	}
 
@@ -332,34 +412,55 @@ func checkinHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		BeaconID string `json:"beacon_id"`
+		BeaconID     string   `json:"beacon_id"`
+		AckedTaskIDs []string `json:"acked_task_ids"`
+		// Optional: seconds to hold the check-in open when there are no tasks, see maxCheckInWait
+		Wait int `json:"wait"`
 	}
 	if err := json.Unmarshal(decryptedBody, &req); err != nil {
 		http.Error(w, "Invalid checkin format", http.StatusBadRequest)
 		return
 	}
+	if !bindSession(r, req.BeaconID) {
+		http.Error(w, "Session belongs to another beacon", http.StatusForbidden)
+		return
+	}
 
 	ctx, cancel := common.CreateAuthenticatedContext(&cfg)
 	defer cancel()
 
-	grpcRes, err := common.TSClient.CheckInBeacon(ctx, &bridge.CheckInBeaconRequest{BeaconId: req.BeaconID, ListenerName: cfg.Listener.Name})
+	grpcRes, err := common.CheckInBeacon(ctx, &bridge.CheckInBeaconRequest{BeaconId: req.BeaconID, ListenerName: cfg.Listener.Name, AckedTaskIds: req.AckedTaskIDs})
 	if err != nil {
 		if common.IsNotFound(err) {
 			http.Error(w, "Beacon not found", http.StatusNotFound)
 		} else {
-			log.Printf("gRPC CheckInBeacon failed: %v", err)
+			logger.Errorf("gRPC CheckInBeacon failed (request %s): %v", common.RequestID(ctx), err)
 			http.Error(w, "Check-in failed", http.StatusInternalServerError)
 		}
 		return
 	}
 
+	// Long poll: a task queued while the check-in is held open is returned right away
+	if len(grpcRes.Tasks) == 0 && req.Wait > 0 {
+		wait := min(time.Duration(req.Wait)*time.Second, maxCheckInWait)
+		releaseSlot(r)
+		if common.WaitForTasks(r.Context(), req.BeaconID, wait) {
+			ctx, cancel := common.CreateAuthenticatedContext(&cfg)
+			defer cancel()
+			if res, err := common.CheckInBeacon(ctx, &bridge.CheckInBeaconRequest{BeaconId: req.BeaconID, ListenerName: cfg.Listener.Name}); err == nil {
+				grpcRes = res
+			} else {
+				logger.Errorf("gRPC CheckInBeacon failed (request %s): %v", common.RequestID(ctx), err)
+			}
+		}
+	}
+
 	encryptAndSend(w, r, grpcRes)
 }
 
 func outputHandler(w http.ResponseWriter, r *http.Request) {
-	encryptedBody, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read body", http.StatusBadRequest)
+	encryptedBody, ok := readBody(w, r)
+	if !ok {
 		return
 	}
 
@@ -374,13 +475,15 @@ func outputHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid output format", http.StatusBadRequest)
 		return
 	}
+	// Like for staging, the listener name is ours rather than the agent's
+	req.ListenerName = cfg.Listener.Name
 
 	ctx, cancel := common.CreateAuthenticatedContext(&cfg)
 	defer cancel()
 
-	_, err = common.TSClient.PushBeaconOutput(ctx, &req)
+	err = common.PushOutput(ctx, &req)
 	if err != nil {
-		log.Printf("gRPC PushBeaconOutput failed: %v", err)
+		logger.Errorf("gRPC PushBeaconOutput failed (request %s): %v", common.RequestID(ctx), err)
 		http.Error(w, "Failed to push output", http.StatusInternalServerError)
 		return
 	}
@@ -389,9 +492,8 @@ func outputHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func chunkHandler(w http.ResponseWriter, r *http.Request) {
-	encryptedBody, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read body", http.StatusBadRequest)
+	encryptedBody, ok := readBody(w, r)
+	if !ok {
 		return
 	}
 
@@ -410,25 +512,34 @@ func chunkHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	beaconID, ok := sessionBeacons.Load(r.Header.Get("X-Session-ID"))
+	if !ok {
+		http.Error(w, "Session is not bound to a beacon", http.StatusForbidden)
+		return
+	}
+
 	ctx, cancel := common.CreateAuthenticatedContext(&cfg)
 	defer cancel()
 
-	grpcReq := &bridge.GetTaskedFileChunkRequest{
-		TaskId:      req.TaskID,
-		ChunkNumber: req.ChunkNumber,
-	}
-
-	grpcRes, err := common.TSClient.GetTaskedFileChunk(ctx, grpcReq)
+	offset := int64(req.ChunkNumber) * constants.ChunkSize
+	chunkData, err := common.FetchFileRange(ctx, req.TaskID, beaconID.(string), offset, constants.ChunkSize)
 	if err != nil {
-		log.Printf("gRPC GetTaskedFileChunk failed: %v", err)
+		logger.Errorf("gRPC StreamTaskedFile failed (request %s): %v", common.RequestID(ctx), err)
 		http.Error(w, "Failed to get file chunk", http.StatusInternalServerError)
 		return
 	}
 
-	encryptAndSendRaw(w, r, grpcRes.GetChunkData())
+	encryptAndSendRaw(w, r, chunkData)
 }
 
 
+// bindSession binds the session of a request to a beacon, if it is not bound yet. It reports
+// false if the session is bound to another beacon.
+func bindSession(r *http.Request, beaconID string) bool {
+	bound, _ := sessionBeacons.LoadOrStore(r.Header.Get("X-Session-ID"), beaconID)
+	return bound.(string) == beaconID
+}
+
 func decryptRequest(r *http.Request, encryptedBody []byte) ([]byte, error) {
 	sessionID := r.Header.Get("X-Session-ID")
 	if sessionID == "" {
@@ -26,11 +26,16 @@ const (
 type ListenerCommand_Action int32
 
 const (
-	ListenerCommand_START         ListenerCommand_Action = 0
-	ListenerCommand_STOP          ListenerCommand_Action = 1
-	ListenerCommand_RESTART       ListenerCommand_Action = 2
-	ListenerCommand_UPDATE_CONFIG ListenerCommand_Action = 3 // 热更新配置
-	ListenerCommand_EXIT          ListenerCommand_Action = 4 // 进程退出
+	ListenerCommand_START             ListenerCommand_Action = 0
+	ListenerCommand_STOP              ListenerCommand_Action = 1
+	ListenerCommand_RESTART           ListenerCommand_Action = 2
+	ListenerCommand_UPDATE_CONFIG     ListenerCommand_Action = 3 // 热更新配置
+	ListenerCommand_EXIT              ListenerCommand_Action = 4 // 进程退出
+	ListenerCommand_WIPE_SESSIONS     ListenerCommand_Action = 5 // 清除所有 beacon 会话密钥
+	ListenerCommand_HOST_FILE         ListenerCommand_Action = 6 // 托管文件，内容分多条指令下发
+	ListenerCommand_UNHOST_FILE       ListenerCommand_Action = 7 // 停止托管 hosted_file.id
+	ListenerCommand_SYNC_HOSTED_FILES ListenerCommand_Action = 8 // 只保留 hosted_file_ids 中的托管文件，控制通道建立时发送
+	ListenerCommand_SYNC_CANARIES     ListenerCommand_Action = 9 // 用 canaries 替换 Listener 的全部 Canary 路径
 )
 
 // Enum value maps for ListenerCommand_Action.
@@ -41,13 +46,23 @@ var (
 		2: "RESTART",
 		3: "UPDATE_CONFIG",
 		4: "EXIT",
+		5: "WIPE_SESSIONS",
+		6: "HOST_FILE",
+		7: "UNHOST_FILE",
+		8: "SYNC_HOSTED_FILES",
+		9: "SYNC_CANARIES",
 	}
 	ListenerCommand_Action_value = map[string]int32{
-		"START":         0,
-		"STOP":          1,
-		"RESTART":       2,
-		"UPDATE_CONFIG": 3,
-		"EXIT":          4,
+		"START":             0,
+		"STOP":              1,
+		"RESTART":           2,
+		"UPDATE_CONFIG":     3,
+		"EXIT":              4,
+		"WIPE_SESSIONS":     5,
+		"HOST_FILE":         6,
+		"UNHOST_FILE":       7,
+		"SYNC_HOSTED_FILES": 8,
+		"SYNC_CANARIES":     9,
 	}
 )
 
@@ -75,20 +90,27 @@ func (x ListenerCommand_Action) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use ListenerCommand_Action.Descriptor instead.
 func (ListenerCommand_Action) EnumDescriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{1, 0}
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{2, 0}
 }
 
 // Listener 上报的状态
 type ListenerStatus struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	ListenerName  string                 `protobuf:"bytes,1,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"`
-	Active        bool                   `protobuf:"varint,2,opt,name=active,proto3" json:"active,omitempty"`                                    // 当前是否在监听
-	ErrorMessage  string                 `protobuf:"bytes,3,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`     // 如果出错，通过这里上报
-	ActiveBeacons int32                  `protobuf:"varint,4,opt,name=active_beacons,json=activeBeacons,proto3" json:"active_beacons,omitempty"` // 当前连接的 Beacon 数量（用于监控面板）
-	Type          string                 `protobuf:"bytes,5,opt,name=type,proto3" json:"type,omitempty"`                                         // Listener 类型 (e.g. "HTTP")
-	ConfigJson    string                 `protobuf:"bytes,6,opt,name=config_json,json=configJson,proto3" json:"config_json,omitempty"`           // 当前配置快照
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	ListenerName        string                 `protobuf:"bytes,1,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"`
+	Active              bool                   `protobuf:"varint,2,opt,name=active,proto3" json:"active,omitempty"`                                                        // 当前是否在监听
+	ErrorMessage        string                 `protobuf:"bytes,3,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`                         // 如果出错，通过这里上报
+	ActiveBeacons       int32                  `protobuf:"varint,4,opt,name=active_beacons,json=activeBeacons,proto3" json:"active_beacons,omitempty"`                     // 当前连接的 Beacon 数量（用于监控面板）
+	Type                string                 `protobuf:"bytes,5,opt,name=type,proto3" json:"type,omitempty"`                                                             // Listener 类型 (e.g. "HTTP")
+	ConfigJson          string                 `protobuf:"bytes,6,opt,name=config_json,json=configJson,proto3" json:"config_json,omitempty"`                               // 当前配置快照
+	Connectivity        string                 `protobuf:"bytes,7,opt,name=connectivity,proto3" json:"connectivity,omitempty"`                                             // Listener 到 TeamServer 的 gRPC 连接状态 (e.g. "READY")
+	Reconnects          int32                  `protobuf:"varint,8,opt,name=reconnects,proto3" json:"reconnects,omitempty"`                                                // 启动以来连接中断的次数
+	LastDisconnect      *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=last_disconnect,json=lastDisconnect,proto3" json:"last_disconnect,omitempty"`                   // 最近一次连接中断的时间
+	Logs                []*ListenerLogEntry    `protobuf:"bytes,10,rep,name=logs,proto3" json:"logs,omitempty"`                                                            // 自上次上报以来的 Listener 日志（启用 logging.remote 时）
+	DroppedLogs         int32                  `protobuf:"varint,11,opt,name=dropped_logs,json=droppedLogs,proto3" json:"dropped_logs,omitempty"`                          // 缓冲区已满而丢弃的日志条数
+	HostedFileDownloads []*HostedFileDownload  `protobuf:"bytes,12,rep,name=hosted_file_downloads,json=hostedFileDownloads,proto3" json:"hosted_file_downloads,omitempty"` // 自上次上报以来托管文件的下载记录
+	CanaryHits          []*CanaryHit           `protobuf:"bytes,13,rep,name=canary_hits,json=canaryHits,proto3" json:"canary_hits,omitempty"`                              // 自上次上报以来 Canary 路径的访问记录
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
 }
 
 func (x *ListenerStatus) Reset() {
@@ -163,30 +185,81 @@ func (x *ListenerStatus) GetConfigJson() string {
 	return ""
 }
 
-// TS 下发的指令
-type ListenerCommand struct {
+func (x *ListenerStatus) GetConnectivity() string {
+	if x != nil {
+		return x.Connectivity
+	}
+	return ""
+}
+
+func (x *ListenerStatus) GetReconnects() int32 {
+	if x != nil {
+		return x.Reconnects
+	}
+	return 0
+}
+
+func (x *ListenerStatus) GetLastDisconnect() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastDisconnect
+	}
+	return nil
+}
+
+func (x *ListenerStatus) GetLogs() []*ListenerLogEntry {
+	if x != nil {
+		return x.Logs
+	}
+	return nil
+}
+
+func (x *ListenerStatus) GetDroppedLogs() int32 {
+	if x != nil {
+		return x.DroppedLogs
+	}
+	return 0
+}
+
+func (x *ListenerStatus) GetHostedFileDownloads() []*HostedFileDownload {
+	if x != nil {
+		return x.HostedFileDownloads
+	}
+	return nil
+}
+
+func (x *ListenerStatus) GetCanaryHits() []*CanaryHit {
+	if x != nil {
+		return x.CanaryHits
+	}
+	return nil
+}
+
+// 通过控制通道转发给 TeamServer 的 Listener 日志
+type ListenerLogEntry struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
-	Action        ListenerCommand_Action `protobuf:"varint,2,opt,name=action,proto3,enum=bridge.ListenerCommand_Action" json:"action,omitempty"`
-	ConfigJson    string                 `protobuf:"bytes,3,opt,name=config_json,json=configJson,proto3" json:"config_json,omitempty"` // 如果是更新配置，携带新配置
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Level         string                 `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"` // "DEBUG", "INFO", "WARN", "ERROR"
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Caller        string                 `protobuf:"bytes,4,opt,name=caller,proto3" json:"caller,omitempty"`                                                                           // 记录日志的源文件和行号
+	Fields        map[string]string      `protobuf:"bytes,5,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // 结构化日志字段
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *ListenerCommand) Reset() {
-	*x = ListenerCommand{}
+func (x *ListenerLogEntry) Reset() {
+	*x = ListenerLogEntry{}
 	mi := &file_pkg_bridge_bridge_proto_msgTypes[1]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ListenerCommand) String() string {
+func (x *ListenerLogEntry) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ListenerCommand) ProtoMessage() {}
+func (*ListenerLogEntry) ProtoMessage() {}
 
-func (x *ListenerCommand) ProtoReflect() protoreflect.Message {
+func (x *ListenerLogEntry) ProtoReflect() protoreflect.Message {
 	mi := &file_pkg_bridge_bridge_proto_msgTypes[1]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -198,62 +271,73 @@ func (x *ListenerCommand) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ListenerCommand.ProtoReflect.Descriptor instead.
-func (*ListenerCommand) Descriptor() ([]byte, []int) {
+// Deprecated: Use ListenerLogEntry.ProtoReflect.Descriptor instead.
+func (*ListenerLogEntry) Descriptor() ([]byte, []int) {
 	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{1}
 }
 
-func (x *ListenerCommand) GetRequestId() string {
+func (x *ListenerLogEntry) GetTime() *timestamppb.Timestamp {
 	if x != nil {
-		return x.RequestId
+		return x.Time
+	}
+	return nil
+}
+
+func (x *ListenerLogEntry) GetLevel() string {
+	if x != nil {
+		return x.Level
 	}
 	return ""
 }
 
-func (x *ListenerCommand) GetAction() ListenerCommand_Action {
+func (x *ListenerLogEntry) GetMessage() string {
 	if x != nil {
-		return x.Action
+		return x.Message
 	}
-	return ListenerCommand_START
+	return ""
 }
 
-func (x *ListenerCommand) GetConfigJson() string {
+func (x *ListenerLogEntry) GetCaller() string {
 	if x != nil {
-		return x.ConfigJson
+		return x.Caller
 	}
 	return ""
 }
 
-// Beacon 的核心元数据
-type BeaconMetadata struct {
-	state           protoimpl.MessageState `protogen:"open.v1"`
-	BeaconId        string                 `protobuf:"bytes,1,opt,name=beacon_id,json=beaconId,proto3" json:"beacon_id,omitempty"`                         // Beacon 自身的 UUID 或唯一标识符
-	Pid             int32                  `protobuf:"varint,2,opt,name=pid,proto3" json:"pid,omitempty"`                                                  // 进程 ID
-	Os              string                 `protobuf:"bytes,3,opt,name=os,proto3" json:"os,omitempty"`                                                     // 操作系统类型 (e.g., "windows", "linux", "darwin")
-	Arch            string                 `protobuf:"bytes,4,opt,name=arch,proto3" json:"arch,omitempty"`                                                 // CPU 架构 (e.g., "amd64", "arm64", "x86")
-	Username        string                 `protobuf:"bytes,5,opt,name=username,proto3" json:"username,omitempty"`                                         // 当前用户名
-	Hostname        string                 `protobuf:"bytes,6,opt,name=hostname,proto3" json:"hostname,omitempty"`                                         // 主机名
-	InternalIp      string                 `protobuf:"bytes,7,opt,name=internal_ip,json=internalIp,proto3" json:"internal_ip,omitempty"`                   // 内部 IP 地址
-	ProcessName     string                 `protobuf:"bytes,8,opt,name=process_name,json=processName,proto3" json:"process_name,omitempty"`                // Beacon 进程名
-	IsHighIntegrity bool                   `protobuf:"varint,9,opt,name=is_high_integrity,json=isHighIntegrity,proto3" json:"is_high_integrity,omitempty"` // 是否在高权限下运行
-	unknownFields   protoimpl.UnknownFields
-	sizeCache       protoimpl.SizeCache
+func (x *ListenerLogEntry) GetFields() map[string]string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
 }
 
-func (x *BeaconMetadata) Reset() {
-	*x = BeaconMetadata{}
+// TS 下发的指令
+type ListenerCommand struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Action        ListenerCommand_Action `protobuf:"varint,2,opt,name=action,proto3,enum=bridge.ListenerCommand_Action" json:"action,omitempty"`
+	ConfigJson    string                 `protobuf:"bytes,3,opt,name=config_json,json=configJson,proto3" json:"config_json,omitempty"`            // 如果是更新配置，携带新配置
+	HostedFile    *HostedFile            `protobuf:"bytes,4,opt,name=hosted_file,json=hostedFile,proto3" json:"hosted_file,omitempty"`            // HOST_FILE、UNHOST_FILE 的文件
+	HostedFileIds []string               `protobuf:"bytes,5,rep,name=hosted_file_ids,json=hostedFileIds,proto3" json:"hosted_file_ids,omitempty"` // SYNC_HOSTED_FILES 时 TeamServer 上该 Listener 的全部托管文件
+	Canaries      []*Canary              `protobuf:"bytes,6,rep,name=canaries,proto3" json:"canaries,omitempty"`                                  // SYNC_CANARIES 时该 Listener 的全部 Canary
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListenerCommand) Reset() {
+	*x = ListenerCommand{}
 	mi := &file_pkg_bridge_bridge_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *BeaconMetadata) String() string {
+func (x *ListenerCommand) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*BeaconMetadata) ProtoMessage() {}
+func (*ListenerCommand) ProtoMessage() {}
 
-func (x *BeaconMetadata) ProtoReflect() protoreflect.Message {
+func (x *ListenerCommand) ProtoReflect() protoreflect.Message {
 	mi := &file_pkg_bridge_bridge_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -265,100 +349,82 @@ func (x *BeaconMetadata) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use BeaconMetadata.ProtoReflect.Descriptor instead.
-func (*BeaconMetadata) Descriptor() ([]byte, []int) {
+// Deprecated: Use ListenerCommand.ProtoReflect.Descriptor instead.
+func (*ListenerCommand) Descriptor() ([]byte, []int) {
 	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{2}
 }
 
-func (x *BeaconMetadata) GetBeaconId() string {
-	if x != nil {
-		return x.BeaconId
-	}
-	return ""
-}
-
-func (x *BeaconMetadata) GetPid() int32 {
-	if x != nil {
-		return x.Pid
-	}
-	return 0
-}
-
-func (x *BeaconMetadata) GetOs() string {
-	if x != nil {
-		return x.Os
-	}
-	return ""
-}
-
-func (x *BeaconMetadata) GetArch() string {
+func (x *ListenerCommand) GetRequestId() string {
 	if x != nil {
-		return x.Arch
+		return x.RequestId
 	}
 	return ""
 }
 
-func (x *BeaconMetadata) GetUsername() string {
+func (x *ListenerCommand) GetAction() ListenerCommand_Action {
 	if x != nil {
-		return x.Username
+		return x.Action
 	}
-	return ""
+	return ListenerCommand_START
 }
 
-func (x *BeaconMetadata) GetHostname() string {
+func (x *ListenerCommand) GetConfigJson() string {
 	if x != nil {
-		return x.Hostname
+		return x.ConfigJson
 	}
 	return ""
 }
 
-func (x *BeaconMetadata) GetInternalIp() string {
+func (x *ListenerCommand) GetHostedFile() *HostedFile {
 	if x != nil {
-		return x.InternalIp
+		return x.HostedFile
 	}
-	return ""
+	return nil
 }
 
-func (x *BeaconMetadata) GetProcessName() string {
+func (x *ListenerCommand) GetHostedFileIds() []string {
 	if x != nil {
-		return x.ProcessName
+		return x.HostedFileIds
 	}
-	return ""
+	return nil
 }
 
-func (x *BeaconMetadata) GetIsHighIntegrity() bool {
+func (x *ListenerCommand) GetCanaries() []*Canary {
 	if x != nil {
-		return x.IsHighIntegrity
+		return x.Canaries
 	}
-	return false
+	return nil
 }
 
-// Staging 请求
-type StageBeaconRequest struct {
+// Listener 托管的文件，HOST_FILE 指令每条携带内容的一部分
+type HostedFile struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	ListenerName  string                 `protobuf:"bytes,1,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"` // 处理此请求的 Listener 实例名
-	RemoteAddr    string                 `protobuf:"bytes,2,opt,name=remote_addr,json=remoteAddr,proto3" json:"remote_addr,omitempty"`       // Beacon 的来源网络地址
-	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                           // Listener 接收到请求的时间戳
-	Metadata      *BeaconMetadata        `protobuf:"bytes,4,opt,name=metadata,proto3" json:"metadata,omitempty"`                             // Listener 解析后的 Beacon 元数据
-	PublicKey     []byte                 `protobuf:"bytes,5,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`          // 可选: Beacon 的公钥，用于加密 SessionKey
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Uri           string                 `protobuf:"bytes,2,opt,name=uri,proto3" json:"uri,omitempty"` // 请求路径 (e.g. "/static/update.ps1")
+	ContentType   string                 `protobuf:"bytes,3,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Size          int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`                                        // 文件总大小
+	Sha256        string                 `protobuf:"bytes,5,opt,name=sha256,proto3" json:"sha256,omitempty"`                                     // 完整内容的 SHA256 (hex)，收齐后校验
+	Offset        int64                  `protobuf:"varint,6,opt,name=offset,proto3" json:"offset,omitempty"`                                    // data 在文件中的字节偏移
+	Data          []byte                 `protobuf:"bytes,7,opt,name=data,proto3" json:"data,omitempty"`                                         // 每条指令不超过 1 MB
+	DownloadsLeft int64                  `protobuf:"varint,8,opt,name=downloads_left,json=downloadsLeft,proto3" json:"downloads_left,omitempty"` // 剩余可下载次数，0 表示不限
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *StageBeaconRequest) Reset() {
-	*x = StageBeaconRequest{}
+func (x *HostedFile) Reset() {
+	*x = HostedFile{}
 	mi := &file_pkg_bridge_bridge_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *StageBeaconRequest) String() string {
+func (x *HostedFile) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*StageBeaconRequest) ProtoMessage() {}
+func (*HostedFile) ProtoMessage() {}
 
-func (x *StageBeaconRequest) ProtoReflect() protoreflect.Message {
+func (x *HostedFile) ProtoReflect() protoreflect.Message {
 	mi := &file_pkg_bridge_bridge_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -370,70 +436,92 @@ func (x *StageBeaconRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use StageBeaconRequest.ProtoReflect.Descriptor instead.
-func (*StageBeaconRequest) Descriptor() ([]byte, []int) {
+// Deprecated: Use HostedFile.ProtoReflect.Descriptor instead.
+func (*HostedFile) Descriptor() ([]byte, []int) {
 	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{3}
 }
 
-func (x *StageBeaconRequest) GetListenerName() string {
+func (x *HostedFile) GetId() string {
 	if x != nil {
-		return x.ListenerName
+		return x.Id
 	}
 	return ""
 }
 
-func (x *StageBeaconRequest) GetRemoteAddr() string {
+func (x *HostedFile) GetUri() string {
 	if x != nil {
-		return x.RemoteAddr
+		return x.Uri
 	}
 	return ""
 }
 
-func (x *StageBeaconRequest) GetTimestamp() *timestamppb.Timestamp {
+func (x *HostedFile) GetContentType() string {
 	if x != nil {
-		return x.Timestamp
+		return x.ContentType
 	}
-	return nil
+	return ""
 }
 
-func (x *StageBeaconRequest) GetMetadata() *BeaconMetadata {
+func (x *HostedFile) GetSize() int64 {
 	if x != nil {
-		return x.Metadata
+		return x.Size
 	}
-	return nil
+	return 0
 }
 
-func (x *StageBeaconRequest) GetPublicKey() []byte {
+func (x *HostedFile) GetSha256() string {
 	if x != nil {
-		return x.PublicKey
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *HostedFile) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *HostedFile) GetData() []byte {
+	if x != nil {
+		return x.Data
 	}
 	return nil
 }
 
-// Staging 响应
-type StageBeaconResponse struct {
-	state               protoimpl.MessageState `protogen:"open.v1"`
-	AssignedBeaconId    string                 `protobuf:"bytes,1,opt,name=assigned_beacon_id,json=assignedBeaconId,proto3" json:"assigned_beacon_id,omitempty"`           // TeamServer 确认或分配的 ID
-	SessionKey          []byte                 `protobuf:"bytes,2,opt,name=session_key,json=sessionKey,proto3" json:"session_key,omitempty"`                               // 分配的会话密钥 (可能是原始密钥或用 PublicKey 加密后的)
-	SessionKeyEncrypted bool                   `protobuf:"varint,3,opt,name=session_key_encrypted,json=sessionKeyEncrypted,proto3" json:"session_key_encrypted,omitempty"` // 指示 session_key 是否已被加密
-	unknownFields       protoimpl.UnknownFields
-	sizeCache           protoimpl.SizeCache
+func (x *HostedFile) GetDownloadsLeft() int64 {
+	if x != nil {
+		return x.DownloadsLeft
+	}
+	return 0
 }
 
-func (x *StageBeaconResponse) Reset() {
-	*x = StageBeaconResponse{}
+// 托管文件的一次下载
+type HostedFileDownload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FileId        string                 `protobuf:"bytes,1,opt,name=file_id,json=fileId,proto3" json:"file_id,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	RemoteAddr    string                 `protobuf:"bytes,3,opt,name=remote_addr,json=remoteAddr,proto3" json:"remote_addr,omitempty"`
+	UserAgent     string                 `protobuf:"bytes,4,opt,name=user_agent,json=userAgent,proto3" json:"user_agent,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HostedFileDownload) Reset() {
+	*x = HostedFileDownload{}
 	mi := &file_pkg_bridge_bridge_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *StageBeaconResponse) String() string {
+func (x *HostedFileDownload) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*StageBeaconResponse) ProtoMessage() {}
+func (*HostedFileDownload) ProtoMessage() {}
 
-func (x *StageBeaconResponse) ProtoReflect() protoreflect.Message {
+func (x *HostedFileDownload) ProtoReflect() protoreflect.Message {
 	mi := &file_pkg_bridge_bridge_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -445,57 +533,62 @@ func (x *StageBeaconResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use StageBeaconResponse.ProtoReflect.Descriptor instead.
-func (*StageBeaconResponse) Descriptor() ([]byte, []int) {
+// Deprecated: Use HostedFileDownload.ProtoReflect.Descriptor instead.
+func (*HostedFileDownload) Descriptor() ([]byte, []int) {
 	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{4}
 }
 
-func (x *StageBeaconResponse) GetAssignedBeaconId() string {
+func (x *HostedFileDownload) GetFileId() string {
 	if x != nil {
-		return x.AssignedBeaconId
+		return x.FileId
 	}
 	return ""
 }
 
-func (x *StageBeaconResponse) GetSessionKey() []byte {
+func (x *HostedFileDownload) GetTime() *timestamppb.Timestamp {
 	if x != nil {
-		return x.SessionKey
+		return x.Time
 	}
 	return nil
 }
 
-func (x *StageBeaconResponse) GetSessionKeyEncrypted() bool {
+func (x *HostedFileDownload) GetRemoteAddr() string {
 	if x != nil {
-		return x.SessionKeyEncrypted
+		return x.RemoteAddr
 	}
-	return false
+	return ""
 }
 
-// CheckIn 请求
-type CheckInBeaconRequest struct {
+func (x *HostedFileDownload) GetUserAgent() string {
+	if x != nil {
+		return x.UserAgent
+	}
+	return ""
+}
+
+// Canary 路径：真实 Payload 从不请求，任何访问都说明产物正在被分析
+type Canary struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	BeaconId      string                 `protobuf:"bytes,1,opt,name=beacon_id,json=beaconId,proto3" json:"beacon_id,omitempty"`             // 进行心跳的 Beacon ID
-	ListenerName  string                 `protobuf:"bytes,2,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"` // 处理此请求的 Listener 实例名
-	RemoteAddr    string                 `protobuf:"bytes,3,opt,name=remote_addr,json=remoteAddr,proto3" json:"remote_addr,omitempty"`       // Beacon 的来源网络地址
-	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                           // Listener 接收到请求的时间戳
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Uri           string                 `protobuf:"bytes,2,opt,name=uri,proto3" json:"uri,omitempty"` // 请求路径 (e.g. "/assets/a1b2c3d4.js")
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *CheckInBeaconRequest) Reset() {
-	*x = CheckInBeaconRequest{}
+func (x *Canary) Reset() {
+	*x = Canary{}
 	mi := &file_pkg_bridge_bridge_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *CheckInBeaconRequest) String() string {
+func (x *Canary) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*CheckInBeaconRequest) ProtoMessage() {}
+func (*Canary) ProtoMessage() {}
 
-func (x *CheckInBeaconRequest) ProtoReflect() protoreflect.Message {
+func (x *Canary) ProtoReflect() protoreflect.Message {
 	mi := &file_pkg_bridge_bridge_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -507,64 +600,728 @@ func (x *CheckInBeaconRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use CheckInBeaconRequest.ProtoReflect.Descriptor instead.
-func (*CheckInBeaconRequest) Descriptor() ([]byte, []int) {
+// Deprecated: Use Canary.ProtoReflect.Descriptor instead.
+func (*Canary) Descriptor() ([]byte, []int) {
 	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{5}
 }
 
-func (x *CheckInBeaconRequest) GetBeaconId() string {
+func (x *Canary) GetId() string {
 	if x != nil {
-		return x.BeaconId
+		return x.Id
 	}
 	return ""
 }
 
-func (x *CheckInBeaconRequest) GetListenerName() string {
+func (x *Canary) GetUri() string {
 	if x != nil {
-		return x.ListenerName
+		return x.Uri
 	}
 	return ""
 }
 
-func (x *CheckInBeaconRequest) GetRemoteAddr() string {
-	if x != nil {
-		return x.RemoteAddr
-	}
-	return ""
+// Canary 路径的一次访问
+type CanaryHit struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CanaryId      string                 `protobuf:"bytes,1,opt,name=canary_id,json=canaryId,proto3" json:"canary_id,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	RemoteAddr    string                 `protobuf:"bytes,3,opt,name=remote_addr,json=remoteAddr,proto3" json:"remote_addr,omitempty"`
+	Method        string                 `protobuf:"bytes,4,opt,name=method,proto3" json:"method,omitempty"`
+	RequestUri    string                 `protobuf:"bytes,5,opt,name=request_uri,json=requestUri,proto3" json:"request_uri,omitempty"` // 含查询参数的完整请求 URI
+	UserAgent     string                 `protobuf:"bytes,6,opt,name=user_agent,json=userAgent,proto3" json:"user_agent,omitempty"`
+	Headers       map[string]string      `protobuf:"bytes,7,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // 请求头，多个值以 ", " 连接
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-func (x *CheckInBeaconRequest) GetTimestamp() *timestamppb.Timestamp {
+func (x *CanaryHit) Reset() {
+	*x = CanaryHit{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CanaryHit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CanaryHit) ProtoMessage() {}
+
+func (x *CanaryHit) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CanaryHit.ProtoReflect.Descriptor instead.
+func (*CanaryHit) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CanaryHit) GetCanaryId() string {
+	if x != nil {
+		return x.CanaryId
+	}
+	return ""
+}
+
+func (x *CanaryHit) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *CanaryHit) GetRemoteAddr() string {
+	if x != nil {
+		return x.RemoteAddr
+	}
+	return ""
+}
+
+func (x *CanaryHit) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *CanaryHit) GetRequestUri() string {
+	if x != nil {
+		return x.RequestUri
+	}
+	return ""
+}
+
+func (x *CanaryHit) GetUserAgent() string {
+	if x != nil {
+		return x.UserAgent
+	}
+	return ""
+}
+
+func (x *CanaryHit) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+// Beacon 的核心元数据
+type BeaconMetadata struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	BeaconId        string                 `protobuf:"bytes,1,opt,name=beacon_id,json=beaconId,proto3" json:"beacon_id,omitempty"`                         // Beacon 自身的 UUID 或唯一标识符
+	Pid             int32                  `protobuf:"varint,2,opt,name=pid,proto3" json:"pid,omitempty"`                                                  // 进程 ID
+	Os              string                 `protobuf:"bytes,3,opt,name=os,proto3" json:"os,omitempty"`                                                     // 操作系统类型 (e.g., "windows", "linux", "darwin")
+	Arch            string                 `protobuf:"bytes,4,opt,name=arch,proto3" json:"arch,omitempty"`                                                 // CPU 架构 (e.g., "amd64", "arm64", "x86")
+	Username        string                 `protobuf:"bytes,5,opt,name=username,proto3" json:"username,omitempty"`                                         // 当前用户名
+	Hostname        string                 `protobuf:"bytes,6,opt,name=hostname,proto3" json:"hostname,omitempty"`                                         // 主机名
+	InternalIp      string                 `protobuf:"bytes,7,opt,name=internal_ip,json=internalIp,proto3" json:"internal_ip,omitempty"`                   // 内部 IP 地址
+	ProcessName     string                 `protobuf:"bytes,8,opt,name=process_name,json=processName,proto3" json:"process_name,omitempty"`                // Beacon 进程名
+	IsHighIntegrity bool                   `protobuf:"varint,9,opt,name=is_high_integrity,json=isHighIntegrity,proto3" json:"is_high_integrity,omitempty"` // 是否在高权限下运行
+	AgentVersion    string                 `protobuf:"bytes,10,opt,name=agent_version,json=agentVersion,proto3" json:"agent_version,omitempty"`            // Beacon 版本号
+	UpgradeTaskId   string                 `protobuf:"bytes,11,opt,name=upgrade_task_id,json=upgradeTaskId,proto3" json:"upgrade_task_id,omitempty"`       // 可选: 由 upgrade 任务启动的新进程携带，用于接管原 Beacon 身份
+	BuildToken      string                 `protobuf:"bytes,12,opt,name=build_token,json=buildToken,proto3" json:"build_token,omitempty"`                  // 可选: TeamServer 构建 payload 时注入的令牌，标识 Beacon 来自哪个 payload
+	HostFingerprint string                 `protobuf:"bytes,13,opt,name=host_fingerprint,json=hostFingerprint,proto3" json:"host_fingerprint,omitempty"`   // 主机指纹: 机器 GUID、主机名与用户名的 SHA-256，用于识别重新 staging 的主机
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *BeaconMetadata) Reset() {
+	*x = BeaconMetadata{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BeaconMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BeaconMetadata) ProtoMessage() {}
+
+func (x *BeaconMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BeaconMetadata.ProtoReflect.Descriptor instead.
+func (*BeaconMetadata) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *BeaconMetadata) GetBeaconId() string {
+	if x != nil {
+		return x.BeaconId
+	}
+	return ""
+}
+
+func (x *BeaconMetadata) GetPid() int32 {
+	if x != nil {
+		return x.Pid
+	}
+	return 0
+}
+
+func (x *BeaconMetadata) GetOs() string {
+	if x != nil {
+		return x.Os
+	}
+	return ""
+}
+
+func (x *BeaconMetadata) GetArch() string {
+	if x != nil {
+		return x.Arch
+	}
+	return ""
+}
+
+func (x *BeaconMetadata) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *BeaconMetadata) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *BeaconMetadata) GetInternalIp() string {
+	if x != nil {
+		return x.InternalIp
+	}
+	return ""
+}
+
+func (x *BeaconMetadata) GetProcessName() string {
+	if x != nil {
+		return x.ProcessName
+	}
+	return ""
+}
+
+func (x *BeaconMetadata) GetIsHighIntegrity() bool {
+	if x != nil {
+		return x.IsHighIntegrity
+	}
+	return false
+}
+
+func (x *BeaconMetadata) GetAgentVersion() string {
+	if x != nil {
+		return x.AgentVersion
+	}
+	return ""
+}
+
+func (x *BeaconMetadata) GetUpgradeTaskId() string {
+	if x != nil {
+		return x.UpgradeTaskId
+	}
+	return ""
+}
+
+func (x *BeaconMetadata) GetBuildToken() string {
+	if x != nil {
+		return x.BuildToken
+	}
+	return ""
+}
+
+func (x *BeaconMetadata) GetHostFingerprint() string {
+	if x != nil {
+		return x.HostFingerprint
+	}
+	return ""
+}
+
+// Staging 请求
+type StageBeaconRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ListenerName  string                 `protobuf:"bytes,1,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"` // 处理此请求的 Listener 实例名
+	RemoteAddr    string                 `protobuf:"bytes,2,opt,name=remote_addr,json=remoteAddr,proto3" json:"remote_addr,omitempty"`       // Beacon 的来源网络地址
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                           // Listener 接收到请求的时间戳
+	Metadata      *BeaconMetadata        `protobuf:"bytes,4,opt,name=metadata,proto3" json:"metadata,omitempty"`                             // Listener 解析后的 Beacon 元数据
+	PublicKey     []byte                 `protobuf:"bytes,5,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`          // 可选: Beacon 的公钥，用于加密 SessionKey
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StageBeaconRequest) Reset() {
+	*x = StageBeaconRequest{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StageBeaconRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StageBeaconRequest) ProtoMessage() {}
+
+func (x *StageBeaconRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StageBeaconRequest.ProtoReflect.Descriptor instead.
+func (*StageBeaconRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *StageBeaconRequest) GetListenerName() string {
+	if x != nil {
+		return x.ListenerName
+	}
+	return ""
+}
+
+func (x *StageBeaconRequest) GetRemoteAddr() string {
+	if x != nil {
+		return x.RemoteAddr
+	}
+	return ""
+}
+
+func (x *StageBeaconRequest) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *StageBeaconRequest) GetMetadata() *BeaconMetadata {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *StageBeaconRequest) GetPublicKey() []byte {
+	if x != nil {
+		return x.PublicKey
+	}
+	return nil
+}
+
+// Staging 响应
+type StageBeaconResponse struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	AssignedBeaconId    string                 `protobuf:"bytes,1,opt,name=assigned_beacon_id,json=assignedBeaconId,proto3" json:"assigned_beacon_id,omitempty"`           // TeamServer 确认或分配的 ID
+	SessionKey          []byte                 `protobuf:"bytes,2,opt,name=session_key,json=sessionKey,proto3" json:"session_key,omitempty"`                               // 分配的会话密钥 (可能是原始密钥或用 PublicKey 加密后的)
+	SessionKeyEncrypted bool                   `protobuf:"varint,3,opt,name=session_key_encrypted,json=sessionKeyEncrypted,proto3" json:"session_key_encrypted,omitempty"` // 指示 session_key 是否已被加密
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *StageBeaconResponse) Reset() {
+	*x = StageBeaconResponse{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StageBeaconResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StageBeaconResponse) ProtoMessage() {}
+
+func (x *StageBeaconResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StageBeaconResponse.ProtoReflect.Descriptor instead.
+func (*StageBeaconResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *StageBeaconResponse) GetAssignedBeaconId() string {
+	if x != nil {
+		return x.AssignedBeaconId
+	}
+	return ""
+}
+
+func (x *StageBeaconResponse) GetSessionKey() []byte {
+	if x != nil {
+		return x.SessionKey
+	}
+	return nil
+}
+
+func (x *StageBeaconResponse) GetSessionKeyEncrypted() bool {
+	if x != nil {
+		return x.SessionKeyEncrypted
+	}
+	return false
+}
+
+// CheckIn 请求
+type CheckInBeaconRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	BeaconId     string                 `protobuf:"bytes,1,opt,name=beacon_id,json=beaconId,proto3" json:"beacon_id,omitempty"`             // 进行心跳的 Beacon ID
+	ListenerName string                 `protobuf:"bytes,2,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"` // 处理此请求的 Listener 实例名
+	RemoteAddr   string                 `protobuf:"bytes,3,opt,name=remote_addr,json=remoteAddr,proto3" json:"remote_addr,omitempty"`       // Beacon 的来源网络地址
+	Timestamp    *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                           // Listener 接收到请求的时间戳
+	// map<string, google.protobuf.Value> update_metadata = 5; // 可选: 需要更新的元数据字段
+	AckedTaskIds  []string `protobuf:"bytes,6,rep,name=acked_task_ids,json=ackedTaskIds,proto3" json:"acked_task_ids,omitempty"` // Beacon 在上次心跳中收到的任务 ID（确认已接收）
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckInBeaconRequest) Reset() {
+	*x = CheckInBeaconRequest{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckInBeaconRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckInBeaconRequest) ProtoMessage() {}
+
+func (x *CheckInBeaconRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckInBeaconRequest.ProtoReflect.Descriptor instead.
+func (*CheckInBeaconRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CheckInBeaconRequest) GetBeaconId() string {
+	if x != nil {
+		return x.BeaconId
+	}
+	return ""
+}
+
+func (x *CheckInBeaconRequest) GetListenerName() string {
+	if x != nil {
+		return x.ListenerName
+	}
+	return ""
+}
+
+func (x *CheckInBeaconRequest) GetRemoteAddr() string {
+	if x != nil {
+		return x.RemoteAddr
+	}
+	return ""
+}
+
+func (x *CheckInBeaconRequest) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *CheckInBeaconRequest) GetAckedTaskIds() []string {
+	if x != nil {
+		return x.AckedTaskIds
+	}
+	return nil
+}
+
+// Task 结构定义
+type Task struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TaskId        string                 `protobuf:"bytes,1,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`           // TeamServer 分配的任务唯一 ID
+	CommandId     uint32                 `protobuf:"varint,2,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"` // 指令的操作码
+	Arguments     []byte                 `protobuf:"bytes,3,opt,name=arguments,proto3" json:"arguments,omitempty"`                   // 原始未加密参数 (TeamServer 内部格式)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Task) Reset() {
+	*x = Task{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Task) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Task) ProtoMessage() {}
+
+func (x *Task) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Task.ProtoReflect.Descriptor instead.
+func (*Task) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Task) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *Task) GetCommandId() uint32 {
+	if x != nil {
+		return x.CommandId
+	}
+	return 0
+}
+
+func (x *Task) GetArguments() []byte {
+	if x != nil {
+		return x.Arguments
+	}
+	return nil
+}
+
+// CheckIn 响应
+type CheckInBeaconResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tasks         []*Task                `protobuf:"bytes,1,rep,name=tasks,proto3" json:"tasks,omitempty"`                        // 原始未加密任务对象列表
+	NewSleep      int32                  `protobuf:"varint,2,opt,name=new_sleep,json=newSleep,proto3" json:"new_sleep,omitempty"` // 可选: 新的 sleep 时间 (秒)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckInBeaconResponse) Reset() {
+	*x = CheckInBeaconResponse{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckInBeaconResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckInBeaconResponse) ProtoMessage() {}
+
+func (x *CheckInBeaconResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckInBeaconResponse.ProtoReflect.Descriptor instead.
+func (*CheckInBeaconResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *CheckInBeaconResponse) GetTasks() []*Task {
+	if x != nil {
+		return x.Tasks
+	}
+	return nil
+}
+
+func (x *CheckInBeaconResponse) GetNewSleep() int32 {
+	if x != nil {
+		return x.NewSleep
+	}
+	return 0
+}
+
+// PushOutput 请求
+type PushBeaconOutputRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BeaconId      string                 `protobuf:"bytes,1,opt,name=beacon_id,json=beaconId,proto3" json:"beacon_id,omitempty"`             // 回传结果的 Beacon ID
+	ListenerName  string                 `protobuf:"bytes,2,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"` // 处理此请求的 Listener 实例名
+	RemoteAddr    string                 `protobuf:"bytes,3,opt,name=remote_addr,json=remoteAddr,proto3" json:"remote_addr,omitempty"`       // Beacon 的来源网络地址
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                           // Listener 接收到请求的时间戳
+	TaskId        string                 `protobuf:"bytes,5,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`                   // 此结果对应的任务 ID
+	CommandId     uint32                 `protobuf:"varint,6,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"`         // 执行的指令 ID
+	Status        int32                  `protobuf:"varint,7,opt,name=status,proto3" json:"status,omitempty"`                                // 任务执行状态码 (0 代表成功)
+	Output        []byte                 `protobuf:"bytes,8,opt,name=output,proto3" json:"output,omitempty"`                                 // **已由 Listener 解密** 的原始任务输出数据 (TeamServer 内部格式)
+	ErrorMessage  string                 `protobuf:"bytes,9,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"` // 如果 status != 0，对应的错误信息
+	Final         *bool                  `protobuf:"varint,10,opt,name=final,proto3,oneof" json:"final,omitempty"`                           // 为 false 时表示仍在运行任务的中间输出；未设置视为最终结果
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PushBeaconOutputRequest) Reset() {
+	*x = PushBeaconOutputRequest{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PushBeaconOutputRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushBeaconOutputRequest) ProtoMessage() {}
+
+func (x *PushBeaconOutputRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushBeaconOutputRequest.ProtoReflect.Descriptor instead.
+func (*PushBeaconOutputRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *PushBeaconOutputRequest) GetBeaconId() string {
+	if x != nil {
+		return x.BeaconId
+	}
+	return ""
+}
+
+func (x *PushBeaconOutputRequest) GetListenerName() string {
+	if x != nil {
+		return x.ListenerName
+	}
+	return ""
+}
+
+func (x *PushBeaconOutputRequest) GetRemoteAddr() string {
+	if x != nil {
+		return x.RemoteAddr
+	}
+	return ""
+}
+
+func (x *PushBeaconOutputRequest) GetTimestamp() *timestamppb.Timestamp {
 	if x != nil {
 		return x.Timestamp
 	}
 	return nil
 }
 
-// Task 结构定义
-type Task struct {
+func (x *PushBeaconOutputRequest) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *PushBeaconOutputRequest) GetCommandId() uint32 {
+	if x != nil {
+		return x.CommandId
+	}
+	return 0
+}
+
+func (x *PushBeaconOutputRequest) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *PushBeaconOutputRequest) GetOutput() []byte {
+	if x != nil {
+		return x.Output
+	}
+	return nil
+}
+
+func (x *PushBeaconOutputRequest) GetErrorMessage() string {
+	if x != nil {
+		return x.ErrorMessage
+	}
+	return ""
+}
+
+func (x *PushBeaconOutputRequest) GetFinal() bool {
+	if x != nil && x.Final != nil {
+		return *x.Final
+	}
+	return false
+}
+
+// PushOutput 响应
+type PushBeaconOutputResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	TaskId        string                 `protobuf:"bytes,1,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`           // TeamServer 分配的任务唯一 ID
-	CommandId     uint32                 `protobuf:"varint,2,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"` // 指令的操作码
-	Arguments     []byte                 `protobuf:"bytes,3,opt,name=arguments,proto3" json:"arguments,omitempty"`                   // 原始未加密参数 (TeamServer 内部格式)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Task) Reset() {
-	*x = Task{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[6]
+func (x *PushBeaconOutputResponse) Reset() {
+	*x = PushBeaconOutputResponse{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Task) String() string {
+func (x *PushBeaconOutputResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Task) ProtoMessage() {}
+func (*PushBeaconOutputResponse) ProtoMessage() {}
 
-func (x *Task) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[6]
+func (x *PushBeaconOutputResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -575,56 +1332,170 @@ func (x *Task) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Task.ProtoReflect.Descriptor instead.
-func (*Task) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{6}
+// Deprecated: Use PushBeaconOutputResponse.ProtoReflect.Descriptor instead.
+func (*PushBeaconOutputResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{14}
 }
 
-func (x *Task) GetTaskId() string {
+// 获取 Listener SharedSecret 请求
+type GetListenerSharedSecretRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ListenerName  string                 `protobuf:"bytes,1,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetListenerSharedSecretRequest) Reset() {
+	*x = GetListenerSharedSecretRequest{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetListenerSharedSecretRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetListenerSharedSecretRequest) ProtoMessage() {}
+
+func (x *GetListenerSharedSecretRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[15]
 	if x != nil {
-		return x.TaskId
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetListenerSharedSecretRequest.ProtoReflect.Descriptor instead.
+func (*GetListenerSharedSecretRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *GetListenerSharedSecretRequest) GetListenerName() string {
+	if x != nil {
+		return x.ListenerName
 	}
 	return ""
 }
 
-func (x *Task) GetCommandId() uint32 {
+// 获取 Listener SharedSecret 响应
+type GetListenerSharedSecretResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SharedSecret  []byte                 `protobuf:"bytes,1,opt,name=shared_secret,json=sharedSecret,proto3" json:"shared_secret,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetListenerSharedSecretResponse) Reset() {
+	*x = GetListenerSharedSecretResponse{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetListenerSharedSecretResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetListenerSharedSecretResponse) ProtoMessage() {}
+
+func (x *GetListenerSharedSecretResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[16]
 	if x != nil {
-		return x.CommandId
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
 	}
-	return 0
+	return mi.MessageOf(x)
 }
 
-func (x *Task) GetArguments() []byte {
+// Deprecated: Use GetListenerSharedSecretResponse.ProtoReflect.Descriptor instead.
+func (*GetListenerSharedSecretResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *GetListenerSharedSecretResponse) GetSharedSecret() []byte {
 	if x != nil {
-		return x.Arguments
+		return x.SharedSecret
 	}
 	return nil
 }
 
-// CheckIn 响应
-type CheckInBeaconResponse struct {
+// 获取 Beacon SessionKey 请求
+type GetBeaconSessionKeyRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Tasks         []*Task                `protobuf:"bytes,1,rep,name=tasks,proto3" json:"tasks,omitempty"`                        // 原始未加密任务对象列表
-	NewSleep      int32                  `protobuf:"varint,2,opt,name=new_sleep,json=newSleep,proto3" json:"new_sleep,omitempty"` // 可选: 新的 sleep 时间 (秒)
+	BeaconId      string                 `protobuf:"bytes,1,opt,name=beacon_id,json=beaconId,proto3" json:"beacon_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *CheckInBeaconResponse) Reset() {
-	*x = CheckInBeaconResponse{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[7]
+func (x *GetBeaconSessionKeyRequest) Reset() {
+	*x = GetBeaconSessionKeyRequest{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBeaconSessionKeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBeaconSessionKeyRequest) ProtoMessage() {}
+
+func (x *GetBeaconSessionKeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBeaconSessionKeyRequest.ProtoReflect.Descriptor instead.
+func (*GetBeaconSessionKeyRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *GetBeaconSessionKeyRequest) GetBeaconId() string {
+	if x != nil {
+		return x.BeaconId
+	}
+	return ""
+}
+
+// 获取 Beacon SessionKey 响应
+type GetBeaconSessionKeyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionKey    []byte                 `protobuf:"bytes,1,opt,name=session_key,json=sessionKey,proto3" json:"session_key,omitempty"`
+	Found         bool                   `protobuf:"varint,2,opt,name=found,proto3" json:"found,omitempty"` // Beacon 是否存在且活动
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBeaconSessionKeyResponse) Reset() {
+	*x = GetBeaconSessionKeyResponse{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[18]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *CheckInBeaconResponse) String() string {
+func (x *GetBeaconSessionKeyResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*CheckInBeaconResponse) ProtoMessage() {}
+func (*GetBeaconSessionKeyResponse) ProtoMessage() {}
 
-func (x *CheckInBeaconResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[7]
+func (x *GetBeaconSessionKeyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[18]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -635,56 +1506,51 @@ func (x *CheckInBeaconResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use CheckInBeaconResponse.ProtoReflect.Descriptor instead.
-func (*CheckInBeaconResponse) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{7}
+// Deprecated: Use GetBeaconSessionKeyResponse.ProtoReflect.Descriptor instead.
+func (*GetBeaconSessionKeyResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{18}
 }
 
-func (x *CheckInBeaconResponse) GetTasks() []*Task {
+func (x *GetBeaconSessionKeyResponse) GetSessionKey() []byte {
 	if x != nil {
-		return x.Tasks
+		return x.SessionKey
 	}
 	return nil
 }
 
-func (x *CheckInBeaconResponse) GetNewSleep() int32 {
+func (x *GetBeaconSessionKeyResponse) GetFound() bool {
 	if x != nil {
-		return x.NewSleep
+		return x.Found
 	}
-	return 0
+	return false
 }
 
-// PushOutput 请求
-type PushBeaconOutputRequest struct {
+// 记录 Listener 日志事件请求
+type LogListenerEventRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	BeaconId      string                 `protobuf:"bytes,1,opt,name=beacon_id,json=beaconId,proto3" json:"beacon_id,omitempty"`             // 回传结果的 Beacon ID
-	ListenerName  string                 `protobuf:"bytes,2,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"` // 处理此请求的 Listener 实例名
-	RemoteAddr    string                 `protobuf:"bytes,3,opt,name=remote_addr,json=remoteAddr,proto3" json:"remote_addr,omitempty"`       // Beacon 的来源网络地址
-	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                           // Listener 接收到请求的时间戳
-	TaskId        string                 `protobuf:"bytes,5,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`                   // 此结果对应的任务 ID
-	CommandId     uint32                 `protobuf:"varint,6,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"`         // 执行的指令 ID
-	Status        int32                  `protobuf:"varint,7,opt,name=status,proto3" json:"status,omitempty"`                                // 任务执行状态码 (0 代表成功)
-	Output        []byte                 `protobuf:"bytes,8,opt,name=output,proto3" json:"output,omitempty"`                                 // **已由 Listener 解密** 的原始任务输出数据 (TeamServer 内部格式)
-	ErrorMessage  string                 `protobuf:"bytes,9,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"` // 如果 status != 0，对应的错误信息
+	ListenerName  string                 `protobuf:"bytes,1,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"`
+	Level         string                 `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"`                                                                             // 日志级别 ("INFO", "WARN", "ERROR", "DEBUG")
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`                                                                         // 日志消息
+	Fields        map[string]string      `protobuf:"bytes,4,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // 结构化日志字段
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *PushBeaconOutputRequest) Reset() {
-	*x = PushBeaconOutputRequest{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[8]
+func (x *LogListenerEventRequest) Reset() {
+	*x = LogListenerEventRequest{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[19]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *PushBeaconOutputRequest) String() string {
+func (x *LogListenerEventRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*PushBeaconOutputRequest) ProtoMessage() {}
+func (*LogListenerEventRequest) ProtoMessage() {}
 
-func (x *PushBeaconOutputRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[8]
+func (x *LogListenerEventRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[19]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -695,96 +1561,144 @@ func (x *PushBeaconOutputRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use PushBeaconOutputRequest.ProtoReflect.Descriptor instead.
-func (*PushBeaconOutputRequest) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{8}
+// Deprecated: Use LogListenerEventRequest.ProtoReflect.Descriptor instead.
+func (*LogListenerEventRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{19}
 }
 
-func (x *PushBeaconOutputRequest) GetBeaconId() string {
+func (x *LogListenerEventRequest) GetListenerName() string {
 	if x != nil {
-		return x.BeaconId
+		return x.ListenerName
 	}
 	return ""
 }
 
-func (x *PushBeaconOutputRequest) GetListenerName() string {
+func (x *LogListenerEventRequest) GetLevel() string {
 	if x != nil {
-		return x.ListenerName
+		return x.Level
 	}
 	return ""
 }
 
-func (x *PushBeaconOutputRequest) GetRemoteAddr() string {
+func (x *LogListenerEventRequest) GetMessage() string {
 	if x != nil {
-		return x.RemoteAddr
+		return x.Message
 	}
 	return ""
 }
 
-func (x *PushBeaconOutputRequest) GetTimestamp() *timestamppb.Timestamp {
+func (x *LogListenerEventRequest) GetFields() map[string]string {
 	if x != nil {
-		return x.Timestamp
+		return x.Fields
 	}
 	return nil
 }
 
-func (x *PushBeaconOutputRequest) GetTaskId() string {
-	if x != nil {
-		return x.TaskId
-	}
-	return ""
+// 记录 Listener 日志事件响应
+type LogListenerEventResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-func (x *PushBeaconOutputRequest) GetCommandId() uint32 {
-	if x != nil {
-		return x.CommandId
-	}
-	return 0
+func (x *LogListenerEventResponse) Reset() {
+	*x = LogListenerEventResponse{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
-func (x *PushBeaconOutputRequest) GetStatus() int32 {
+func (x *LogListenerEventResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogListenerEventResponse) ProtoMessage() {}
+
+func (x *LogListenerEventResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[20]
 	if x != nil {
-		return x.Status
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
 	}
-	return 0
+	return mi.MessageOf(x)
 }
 
-func (x *PushBeaconOutputRequest) GetOutput() []byte {
+// Deprecated: Use LogListenerEventResponse.ProtoReflect.Descriptor instead.
+func (*LogListenerEventResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{20}
+}
+
+// 获取 Beacon 配置请求
+type GetBeaconConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ListenerName  string                 `protobuf:"bytes,1,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBeaconConfigRequest) Reset() {
+	*x = GetBeaconConfigRequest{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBeaconConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBeaconConfigRequest) ProtoMessage() {}
+
+func (x *GetBeaconConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[21]
 	if x != nil {
-		return x.Output
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
 	}
-	return nil
+	return mi.MessageOf(x)
 }
 
-func (x *PushBeaconOutputRequest) GetErrorMessage() string {
+// Deprecated: Use GetBeaconConfigRequest.ProtoReflect.Descriptor instead.
+func (*GetBeaconConfigRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *GetBeaconConfigRequest) GetListenerName() string {
 	if x != nil {
-		return x.ErrorMessage
+		return x.ListenerName
 	}
 	return ""
 }
 
-// PushOutput 响应
-type PushBeaconOutputResponse struct {
+// 获取 Beacon 配置响应
+type GetBeaconConfigResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
+	Config        map[string]string      `protobuf:"bytes,1,rep,name=config,proto3" json:"config,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // Key-Value 配置对 (例如回连地址, 端口等)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *PushBeaconOutputResponse) Reset() {
-	*x = PushBeaconOutputResponse{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[9]
+func (x *GetBeaconConfigResponse) Reset() {
+	*x = GetBeaconConfigResponse{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[22]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *PushBeaconOutputResponse) String() string {
+func (x *GetBeaconConfigResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*PushBeaconOutputResponse) ProtoMessage() {}
+func (*GetBeaconConfigResponse) ProtoMessage() {}
 
-func (x *PushBeaconOutputResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[9]
+func (x *GetBeaconConfigResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[22]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -795,34 +1709,43 @@ func (x *PushBeaconOutputResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use PushBeaconOutputResponse.ProtoReflect.Descriptor instead.
-func (*PushBeaconOutputResponse) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{9}
+// Deprecated: Use GetBeaconConfigResponse.ProtoReflect.Descriptor instead.
+func (*GetBeaconConfigResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{22}
 }
 
-// 获取 Listener SharedSecret 请求
-type GetListenerSharedSecretRequest struct {
+func (x *GetBeaconConfigResponse) GetConfig() map[string]string {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+// 获取文件分片请求
+type GetTaskedFileChunkRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	ListenerName  string                 `protobuf:"bytes,1,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"`
+	TaskId        string                 `protobuf:"bytes,1,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`                 // 'download' 任务的 ID
+	ChunkNumber   int32                  `protobuf:"varint,2,opt,name=chunk_number,json=chunkNumber,proto3" json:"chunk_number,omitempty"` // 请求的分片序号 (从 0 开始)
+	BeaconId      string                 `protobuf:"bytes,3,opt,name=beacon_id,json=beaconId,proto3" json:"beacon_id,omitempty"`           // 请求分片的 Beacon，必须是任务所属的 Beacon
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetListenerSharedSecretRequest) Reset() {
-	*x = GetListenerSharedSecretRequest{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[10]
+func (x *GetTaskedFileChunkRequest) Reset() {
+	*x = GetTaskedFileChunkRequest{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[23]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetListenerSharedSecretRequest) String() string {
+func (x *GetTaskedFileChunkRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetListenerSharedSecretRequest) ProtoMessage() {}
+func (*GetTaskedFileChunkRequest) ProtoMessage() {}
 
-func (x *GetListenerSharedSecretRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[10]
+func (x *GetTaskedFileChunkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[23]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -833,41 +1756,55 @@ func (x *GetListenerSharedSecretRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetListenerSharedSecretRequest.ProtoReflect.Descriptor instead.
-func (*GetListenerSharedSecretRequest) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{10}
+// Deprecated: Use GetTaskedFileChunkRequest.ProtoReflect.Descriptor instead.
+func (*GetTaskedFileChunkRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{23}
 }
 
-func (x *GetListenerSharedSecretRequest) GetListenerName() string {
+func (x *GetTaskedFileChunkRequest) GetTaskId() string {
 	if x != nil {
-		return x.ListenerName
+		return x.TaskId
 	}
 	return ""
 }
 
-// 获取 Listener SharedSecret 响应
-type GetListenerSharedSecretResponse struct {
+func (x *GetTaskedFileChunkRequest) GetChunkNumber() int32 {
+	if x != nil {
+		return x.ChunkNumber
+	}
+	return 0
+}
+
+func (x *GetTaskedFileChunkRequest) GetBeaconId() string {
+	if x != nil {
+		return x.BeaconId
+	}
+	return ""
+}
+
+// 获取文件分片响应
+type GetTaskedFileChunkResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	SharedSecret  []byte                 `protobuf:"bytes,1,opt,name=shared_secret,json=sharedSecret,proto3" json:"shared_secret,omitempty"`
+	ChunkData     []byte                 `protobuf:"bytes,1,opt,name=chunk_data,json=chunkData,proto3" json:"chunk_data,omitempty"` // 分片的二进制数据
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetListenerSharedSecretResponse) Reset() {
-	*x = GetListenerSharedSecretResponse{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[11]
+func (x *GetTaskedFileChunkResponse) Reset() {
+	*x = GetTaskedFileChunkResponse{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[24]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetListenerSharedSecretResponse) String() string {
+func (x *GetTaskedFileChunkResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetListenerSharedSecretResponse) ProtoMessage() {}
+func (*GetTaskedFileChunkResponse) ProtoMessage() {}
 
-func (x *GetListenerSharedSecretResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[11]
+func (x *GetTaskedFileChunkResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[24]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -878,41 +1815,44 @@ func (x *GetListenerSharedSecretResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetListenerSharedSecretResponse.ProtoReflect.Descriptor instead.
-func (*GetListenerSharedSecretResponse) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{11}
+// Deprecated: Use GetTaskedFileChunkResponse.ProtoReflect.Descriptor instead.
+func (*GetTaskedFileChunkResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{24}
 }
 
-func (x *GetListenerSharedSecretResponse) GetSharedSecret() []byte {
+func (x *GetTaskedFileChunkResponse) GetChunkData() []byte {
 	if x != nil {
-		return x.SharedSecret
+		return x.ChunkData
 	}
 	return nil
 }
-
-// 获取 Beacon SessionKey 请求
-type GetBeaconSessionKeyRequest struct {
+
+// 以流的形式获取文件内容的请求
+type StreamTaskedFileRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	BeaconId      string                 `protobuf:"bytes,1,opt,name=beacon_id,json=beaconId,proto3" json:"beacon_id,omitempty"`
+	TaskId        string                 `protobuf:"bytes,1,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`       // 'download' 或 'upgrade' 任务的 ID
+	Offset        int64                  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`                    // 起始字节偏移
+	Length        int64                  `protobuf:"varint,3,opt,name=length,proto3" json:"length,omitempty"`                    // 读取的字节数，0 表示读到文件末尾
+	BeaconId      string                 `protobuf:"bytes,4,opt,name=beacon_id,json=beaconId,proto3" json:"beacon_id,omitempty"` // 请求文件的 Beacon，必须是任务所属的 Beacon
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetBeaconSessionKeyRequest) Reset() {
-	*x = GetBeaconSessionKeyRequest{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[12]
+func (x *StreamTaskedFileRequest) Reset() {
+	*x = StreamTaskedFileRequest{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[25]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetBeaconSessionKeyRequest) String() string {
+func (x *StreamTaskedFileRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetBeaconSessionKeyRequest) ProtoMessage() {}
+func (*StreamTaskedFileRequest) ProtoMessage() {}
 
-func (x *GetBeaconSessionKeyRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[12]
+func (x *StreamTaskedFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[25]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -923,42 +1863,63 @@ func (x *GetBeaconSessionKeyRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetBeaconSessionKeyRequest.ProtoReflect.Descriptor instead.
-func (*GetBeaconSessionKeyRequest) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{12}
+// Deprecated: Use StreamTaskedFileRequest.ProtoReflect.Descriptor instead.
+func (*StreamTaskedFileRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{25}
 }
 
-func (x *GetBeaconSessionKeyRequest) GetBeaconId() string {
+func (x *StreamTaskedFileRequest) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *StreamTaskedFileRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *StreamTaskedFileRequest) GetLength() int64 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *StreamTaskedFileRequest) GetBeaconId() string {
 	if x != nil {
 		return x.BeaconId
 	}
 	return ""
 }
 
-// 获取 Beacon SessionKey 响应
-type GetBeaconSessionKeyResponse struct {
+// 文件内容的一部分
+type FileChunk struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	SessionKey    []byte                 `protobuf:"bytes,1,opt,name=session_key,json=sessionKey,proto3" json:"session_key,omitempty"`
-	Found         bool                   `protobuf:"varint,2,opt,name=found,proto3" json:"found,omitempty"` // Beacon 是否存在且活动
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	Offset        int64                  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"` // data 在文件中的字节偏移
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetBeaconSessionKeyResponse) Reset() {
-	*x = GetBeaconSessionKeyResponse{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[13]
+func (x *FileChunk) Reset() {
+	*x = FileChunk{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[26]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetBeaconSessionKeyResponse) String() string {
+func (x *FileChunk) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetBeaconSessionKeyResponse) ProtoMessage() {}
+func (*FileChunk) ProtoMessage() {}
 
-func (x *GetBeaconSessionKeyResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[13]
+func (x *FileChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[26]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -969,51 +1930,56 @@ func (x *GetBeaconSessionKeyResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetBeaconSessionKeyResponse.ProtoReflect.Descriptor instead.
-func (*GetBeaconSessionKeyResponse) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{13}
+// Deprecated: Use FileChunk.ProtoReflect.Descriptor instead.
+func (*FileChunk) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{26}
 }
 
-func (x *GetBeaconSessionKeyResponse) GetSessionKey() []byte {
+func (x *FileChunk) GetData() []byte {
 	if x != nil {
-		return x.SessionKey
+		return x.Data
 	}
 	return nil
 }
 
-func (x *GetBeaconSessionKeyResponse) GetFound() bool {
+func (x *FileChunk) GetOffset() int64 {
 	if x != nil {
-		return x.Found
+		return x.Offset
 	}
-	return false
+	return 0
 }
 
-// 记录 Listener 日志事件请求
-type LogListenerEventRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	ListenerName  string                 `protobuf:"bytes,1,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"`
-	Level         string                 `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"`                                                                             // 日志级别 ("INFO", "WARN", "ERROR", "DEBUG")
-	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`                                                                         // 日志消息
-	Fields        map[string]string      `protobuf:"bytes,4,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // 结构化日志字段
+// Listener 通过 BeaconRelay 发送的请求，等同于对应的一元调用
+type RelayRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Id           uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`                                        // Listener 分配的请求编号，响应中原样返回
+	ListenerName string                 `protobuf:"bytes,2,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"` // 发送此请求的 Listener 实例名，流的第一条消息必须设置（可以不带 payload）
+	RequestId    string                 `protobuf:"bytes,3,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`          // 可选: 用于关联日志的请求 ID
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*RelayRequest_Stage
+	//	*RelayRequest_CheckIn
+	//	*RelayRequest_Output
+	Payload       isRelayRequest_Payload `protobuf_oneof:"payload"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *LogListenerEventRequest) Reset() {
-	*x = LogListenerEventRequest{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[14]
+func (x *RelayRequest) Reset() {
+	*x = RelayRequest{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[27]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *LogListenerEventRequest) String() string {
+func (x *RelayRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*LogListenerEventRequest) ProtoMessage() {}
+func (*RelayRequest) ProtoMessage() {}
 
-func (x *LogListenerEventRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[14]
+func (x *RelayRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[27]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1024,99 +1990,119 @@ func (x *LogListenerEventRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use LogListenerEventRequest.ProtoReflect.Descriptor instead.
-func (*LogListenerEventRequest) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{14}
+// Deprecated: Use RelayRequest.ProtoReflect.Descriptor instead.
+func (*RelayRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{27}
 }
 
-func (x *LogListenerEventRequest) GetListenerName() string {
+func (x *RelayRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *RelayRequest) GetListenerName() string {
 	if x != nil {
 		return x.ListenerName
 	}
 	return ""
 }
 
-func (x *LogListenerEventRequest) GetLevel() string {
+func (x *RelayRequest) GetRequestId() string {
 	if x != nil {
-		return x.Level
+		return x.RequestId
 	}
 	return ""
 }
 
-func (x *LogListenerEventRequest) GetMessage() string {
+func (x *RelayRequest) GetPayload() isRelayRequest_Payload {
 	if x != nil {
-		return x.Message
+		return x.Payload
 	}
-	return ""
+	return nil
 }
 
-func (x *LogListenerEventRequest) GetFields() map[string]string {
+func (x *RelayRequest) GetStage() *StageBeaconRequest {
 	if x != nil {
-		return x.Fields
+		if x, ok := x.Payload.(*RelayRequest_Stage); ok {
+			return x.Stage
+		}
 	}
 	return nil
 }
 
-// 记录 Listener 日志事件响应
-type LogListenerEventResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+func (x *RelayRequest) GetCheckIn() *CheckInBeaconRequest {
+	if x != nil {
+		if x, ok := x.Payload.(*RelayRequest_CheckIn); ok {
+			return x.CheckIn
+		}
+	}
+	return nil
 }
 
-func (x *LogListenerEventResponse) Reset() {
-	*x = LogListenerEventResponse{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[15]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
+func (x *RelayRequest) GetOutput() *PushBeaconOutputRequest {
+	if x != nil {
+		if x, ok := x.Payload.(*RelayRequest_Output); ok {
+			return x.Output
+		}
+	}
+	return nil
 }
 
-func (x *LogListenerEventResponse) String() string {
-	return protoimpl.X.MessageStringOf(x)
+type isRelayRequest_Payload interface {
+	isRelayRequest_Payload()
 }
 
-func (*LogListenerEventResponse) ProtoMessage() {}
+type RelayRequest_Stage struct {
+	Stage *StageBeaconRequest `protobuf:"bytes,4,opt,name=stage,proto3,oneof"`
+}
 
-func (x *LogListenerEventResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[15]
-	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
-	}
-	return mi.MessageOf(x)
+type RelayRequest_CheckIn struct {
+	CheckIn *CheckInBeaconRequest `protobuf:"bytes,5,opt,name=check_in,json=checkIn,proto3,oneof"`
 }
 
-// Deprecated: Use LogListenerEventResponse.ProtoReflect.Descriptor instead.
-func (*LogListenerEventResponse) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{15}
+type RelayRequest_Output struct {
+	Output *PushBeaconOutputRequest `protobuf:"bytes,6,opt,name=output,proto3,oneof"`
 }
 
-// 获取 Beacon 配置请求
-type GetBeaconConfigRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	ListenerName  string                 `protobuf:"bytes,1,opt,name=listener_name,json=listenerName,proto3" json:"listener_name,omitempty"`
+func (*RelayRequest_Stage) isRelayRequest_Payload() {}
+
+func (*RelayRequest_CheckIn) isRelayRequest_Payload() {}
+
+func (*RelayRequest_Output) isRelayRequest_Payload() {}
+
+// TeamServer 通过 BeaconRelay 返回的响应或主动推送的消息
+type RelayResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"` // 对应请求的编号；主动推送的消息为 0
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*RelayResponse_Stage
+	//	*RelayResponse_CheckIn
+	//	*RelayResponse_Output
+	//	*RelayResponse_Error
+	//	*RelayResponse_TaskNotice
+	Payload       isRelayResponse_Payload `protobuf_oneof:"payload"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetBeaconConfigRequest) Reset() {
-	*x = GetBeaconConfigRequest{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[16]
+func (x *RelayResponse) Reset() {
+	*x = RelayResponse{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[28]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetBeaconConfigRequest) String() string {
+func (x *RelayResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetBeaconConfigRequest) ProtoMessage() {}
+func (*RelayResponse) ProtoMessage() {}
 
-func (x *GetBeaconConfigRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[16]
+func (x *RelayResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[28]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1127,87 +2113,128 @@ func (x *GetBeaconConfigRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetBeaconConfigRequest.ProtoReflect.Descriptor instead.
-func (*GetBeaconConfigRequest) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{16}
+// Deprecated: Use RelayResponse.ProtoReflect.Descriptor instead.
+func (*RelayResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{28}
 }
 
-func (x *GetBeaconConfigRequest) GetListenerName() string {
+func (x *RelayResponse) GetId() uint64 {
 	if x != nil {
-		return x.ListenerName
+		return x.Id
 	}
-	return ""
+	return 0
 }
 
-// 获取 Beacon 配置响应
-type GetBeaconConfigResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Config        map[string]string      `protobuf:"bytes,1,rep,name=config,proto3" json:"config,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // Key-Value 配置对 (例如回连地址, 端口等)
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+func (x *RelayResponse) GetPayload() isRelayResponse_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
 }
 
-func (x *GetBeaconConfigResponse) Reset() {
-	*x = GetBeaconConfigResponse{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[17]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
+func (x *RelayResponse) GetStage() *StageBeaconResponse {
+	if x != nil {
+		if x, ok := x.Payload.(*RelayResponse_Stage); ok {
+			return x.Stage
+		}
+	}
+	return nil
 }
 
-func (x *GetBeaconConfigResponse) String() string {
-	return protoimpl.X.MessageStringOf(x)
+func (x *RelayResponse) GetCheckIn() *CheckInBeaconResponse {
+	if x != nil {
+		if x, ok := x.Payload.(*RelayResponse_CheckIn); ok {
+			return x.CheckIn
+		}
+	}
+	return nil
 }
 
-func (*GetBeaconConfigResponse) ProtoMessage() {}
-
-func (x *GetBeaconConfigResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[17]
+func (x *RelayResponse) GetOutput() *PushBeaconOutputResponse {
 	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
+		if x, ok := x.Payload.(*RelayResponse_Output); ok {
+			return x.Output
 		}
-		return ms
 	}
-	return mi.MessageOf(x)
+	return nil
 }
 
-// Deprecated: Use GetBeaconConfigResponse.ProtoReflect.Descriptor instead.
-func (*GetBeaconConfigResponse) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{17}
+func (x *RelayResponse) GetError() *RelayError {
+	if x != nil {
+		if x, ok := x.Payload.(*RelayResponse_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
 }
 
-func (x *GetBeaconConfigResponse) GetConfig() map[string]string {
+func (x *RelayResponse) GetTaskNotice() *TaskNotice {
 	if x != nil {
-		return x.Config
+		if x, ok := x.Payload.(*RelayResponse_TaskNotice); ok {
+			return x.TaskNotice
+		}
 	}
 	return nil
 }
 
-// 获取文件分片请求
-type GetTaskedFileChunkRequest struct {
+type isRelayResponse_Payload interface {
+	isRelayResponse_Payload()
+}
+
+type RelayResponse_Stage struct {
+	Stage *StageBeaconResponse `protobuf:"bytes,2,opt,name=stage,proto3,oneof"`
+}
+
+type RelayResponse_CheckIn struct {
+	CheckIn *CheckInBeaconResponse `protobuf:"bytes,3,opt,name=check_in,json=checkIn,proto3,oneof"`
+}
+
+type RelayResponse_Output struct {
+	Output *PushBeaconOutputResponse `protobuf:"bytes,4,opt,name=output,proto3,oneof"`
+}
+
+type RelayResponse_Error struct {
+	Error *RelayError `protobuf:"bytes,5,opt,name=error,proto3,oneof"` // 请求失败
+}
+
+type RelayResponse_TaskNotice struct {
+	TaskNotice *TaskNotice `protobuf:"bytes,6,opt,name=task_notice,json=taskNotice,proto3,oneof"` // 主动推送: Beacon 有新任务排队
+}
+
+func (*RelayResponse_Stage) isRelayResponse_Payload() {}
+
+func (*RelayResponse_CheckIn) isRelayResponse_Payload() {}
+
+func (*RelayResponse_Output) isRelayResponse_Payload() {}
+
+func (*RelayResponse_Error) isRelayResponse_Payload() {}
+
+func (*RelayResponse_TaskNotice) isRelayResponse_Payload() {}
+
+// 中继请求的错误，等同于一元调用返回的 gRPC status
+type RelayError struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	TaskId        string                 `protobuf:"bytes,1,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`                 // 'download' 任务的 ID
-	ChunkNumber   int32                  `protobuf:"varint,2,opt,name=chunk_number,json=chunkNumber,proto3" json:"chunk_number,omitempty"` // 请求的分片序号 (从 0 开始)
+	Code          int32                  `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"` // gRPC 状态码
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetTaskedFileChunkRequest) Reset() {
-	*x = GetTaskedFileChunkRequest{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[18]
+func (x *RelayError) Reset() {
+	*x = RelayError{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[29]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetTaskedFileChunkRequest) String() string {
+func (x *RelayError) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetTaskedFileChunkRequest) ProtoMessage() {}
+func (*RelayError) ProtoMessage() {}
 
-func (x *GetTaskedFileChunkRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[18]
+func (x *RelayError) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[29]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1218,48 +2245,48 @@ func (x *GetTaskedFileChunkRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetTaskedFileChunkRequest.ProtoReflect.Descriptor instead.
-func (*GetTaskedFileChunkRequest) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{18}
+// Deprecated: Use RelayError.ProtoReflect.Descriptor instead.
+func (*RelayError) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{29}
 }
 
-func (x *GetTaskedFileChunkRequest) GetTaskId() string {
+func (x *RelayError) GetCode() int32 {
 	if x != nil {
-		return x.TaskId
+		return x.Code
 	}
-	return ""
+	return 0
 }
 
-func (x *GetTaskedFileChunkRequest) GetChunkNumber() int32 {
+func (x *RelayError) GetMessage() string {
 	if x != nil {
-		return x.ChunkNumber
+		return x.Message
 	}
-	return 0
+	return ""
 }
 
-// 获取文件分片响应
-type GetTaskedFileChunkResponse struct {
+// 通知 Listener 某个 Beacon 有新任务排队，Listener 可以让等待中的心跳立即返回
+type TaskNotice struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	ChunkData     []byte                 `protobuf:"bytes,1,opt,name=chunk_data,json=chunkData,proto3" json:"chunk_data,omitempty"` // 分片的二进制数据
+	BeaconId      string                 `protobuf:"bytes,1,opt,name=beacon_id,json=beaconId,proto3" json:"beacon_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetTaskedFileChunkResponse) Reset() {
-	*x = GetTaskedFileChunkResponse{}
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[19]
+func (x *TaskNotice) Reset() {
+	*x = TaskNotice{}
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[30]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetTaskedFileChunkResponse) String() string {
+func (x *TaskNotice) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetTaskedFileChunkResponse) ProtoMessage() {}
+func (*TaskNotice) ProtoMessage() {}
 
-func (x *GetTaskedFileChunkResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_bridge_bridge_proto_msgTypes[19]
+func (x *TaskNotice) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_bridge_bridge_proto_msgTypes[30]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1270,23 +2297,23 @@ func (x *GetTaskedFileChunkResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetTaskedFileChunkResponse.ProtoReflect.Descriptor instead.
-func (*GetTaskedFileChunkResponse) Descriptor() ([]byte, []int) {
-	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{19}
+// Deprecated: Use TaskNotice.ProtoReflect.Descriptor instead.
+func (*TaskNotice) Descriptor() ([]byte, []int) {
+	return file_pkg_bridge_bridge_proto_rawDescGZIP(), []int{30}
 }
 
-func (x *GetTaskedFileChunkResponse) GetChunkData() []byte {
+func (x *TaskNotice) GetBeaconId() string {
 	if x != nil {
-		return x.ChunkData
+		return x.BeaconId
 	}
-	return nil
+	return ""
 }
 
 var File_pkg_bridge_bridge_proto protoreflect.FileDescriptor
 
 const file_pkg_bridge_bridge_proto_rawDesc = "" +
 	"\n" +
-	"\x17pkg/bridge/bridge.proto\x12\x06bridge\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1cgoogle/protobuf/struct.proto\"\xce\x01\n" +
+	"\x17pkg/bridge/bridge.proto\x12\x06bridge\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1cgoogle/protobuf/struct.proto\"\xac\x04\n" +
 	"\x0eListenerStatus\x12#\n" +
 	"\rlistener_name\x18\x01 \x01(\tR\flistenerName\x12\x16\n" +
 	"\x06active\x18\x02 \x01(\bR\x06active\x12#\n" +
@@ -1294,19 +2321,82 @@ const file_pkg_bridge_bridge_proto_rawDesc = "" +
 	"\x0eactive_beacons\x18\x04 \x01(\x05R\ractiveBeacons\x12\x12\n" +
 	"\x04type\x18\x05 \x01(\tR\x04type\x12\x1f\n" +
 	"\vconfig_json\x18\x06 \x01(\tR\n" +
-	"configJson\"\xd2\x01\n" +
+	"configJson\x12\"\n" +
+	"\fconnectivity\x18\a \x01(\tR\fconnectivity\x12\x1e\n" +
+	"\n" +
+	"reconnects\x18\b \x01(\x05R\n" +
+	"reconnects\x12C\n" +
+	"\x0flast_disconnect\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\x0elastDisconnect\x12,\n" +
+	"\x04logs\x18\n" +
+	" \x03(\v2\x18.bridge.ListenerLogEntryR\x04logs\x12!\n" +
+	"\fdropped_logs\x18\v \x01(\x05R\vdroppedLogs\x12N\n" +
+	"\x15hosted_file_downloads\x18\f \x03(\v2\x1a.bridge.HostedFileDownloadR\x13hostedFileDownloads\x122\n" +
+	"\vcanary_hits\x18\r \x03(\v2\x11.bridge.CanaryHitR\n" +
+	"canaryHits\"\x83\x02\n" +
+	"\x10ListenerLogEntry\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x14\n" +
+	"\x05level\x18\x02 \x01(\tR\x05level\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x16\n" +
+	"\x06caller\x18\x04 \x01(\tR\x06caller\x12<\n" +
+	"\x06fields\x18\x05 \x03(\v2$.bridge.ListenerLogEntry.FieldsEntryR\x06fields\x1a9\n" +
+	"\vFieldsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xb9\x03\n" +
 	"\x0fListenerCommand\x12\x1d\n" +
 	"\n" +
 	"request_id\x18\x01 \x01(\tR\trequestId\x126\n" +
 	"\x06action\x18\x02 \x01(\x0e2\x1e.bridge.ListenerCommand.ActionR\x06action\x12\x1f\n" +
 	"\vconfig_json\x18\x03 \x01(\tR\n" +
-	"configJson\"G\n" +
+	"configJson\x123\n" +
+	"\vhosted_file\x18\x04 \x01(\v2\x12.bridge.HostedFileR\n" +
+	"hostedFile\x12&\n" +
+	"\x0fhosted_file_ids\x18\x05 \x03(\tR\rhostedFileIds\x12*\n" +
+	"\bcanaries\x18\x06 \x03(\v2\x0e.bridge.CanaryR\bcanaries\"\xa4\x01\n" +
 	"\x06Action\x12\t\n" +
 	"\x05START\x10\x00\x12\b\n" +
 	"\x04STOP\x10\x01\x12\v\n" +
 	"\aRESTART\x10\x02\x12\x11\n" +
 	"\rUPDATE_CONFIG\x10\x03\x12\b\n" +
-	"\x04EXIT\x10\x04\"\x8b\x02\n" +
+	"\x04EXIT\x10\x04\x12\x11\n" +
+	"\rWIPE_SESSIONS\x10\x05\x12\r\n" +
+	"\tHOST_FILE\x10\x06\x12\x0f\n" +
+	"\vUNHOST_FILE\x10\a\x12\x15\n" +
+	"\x11SYNC_HOSTED_FILES\x10\b\x12\x11\n" +
+	"\rSYNC_CANARIES\x10\t\"\xd0\x01\n" +
+	"\n" +
+	"HostedFile\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03uri\x18\x02 \x01(\tR\x03uri\x12!\n" +
+	"\fcontent_type\x18\x03 \x01(\tR\vcontentType\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\x12\x16\n" +
+	"\x06sha256\x18\x05 \x01(\tR\x06sha256\x12\x16\n" +
+	"\x06offset\x18\x06 \x01(\x03R\x06offset\x12\x12\n" +
+	"\x04data\x18\a \x01(\fR\x04data\x12%\n" +
+	"\x0edownloads_left\x18\b \x01(\x03R\rdownloadsLeft\"\x9d\x01\n" +
+	"\x12HostedFileDownload\x12\x17\n" +
+	"\afile_id\x18\x01 \x01(\tR\x06fileId\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x1f\n" +
+	"\vremote_addr\x18\x03 \x01(\tR\n" +
+	"remoteAddr\x12\x1d\n" +
+	"\n" +
+	"user_agent\x18\x04 \x01(\tR\tuserAgent\"*\n" +
+	"\x06Canary\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03uri\x18\x02 \x01(\tR\x03uri\"\xc7\x02\n" +
+	"\tCanaryHit\x12\x1b\n" +
+	"\tcanary_id\x18\x01 \x01(\tR\bcanaryId\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x1f\n" +
+	"\vremote_addr\x18\x03 \x01(\tR\n" +
+	"remoteAddr\x12\x16\n" +
+	"\x06method\x18\x04 \x01(\tR\x06method\x12\x1f\n" +
+	"\vrequest_uri\x18\x05 \x01(\tR\n" +
+	"requestUri\x12\x1d\n" +
+	"\n" +
+	"user_agent\x18\x06 \x01(\tR\tuserAgent\x128\n" +
+	"\aheaders\x18\a \x03(\v2\x1e.bridge.CanaryHit.HeadersEntryR\aheaders\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xa4\x03\n" +
 	"\x0eBeaconMetadata\x12\x1b\n" +
 	"\tbeacon_id\x18\x01 \x01(\tR\bbeaconId\x12\x10\n" +
 	"\x03pid\x18\x02 \x01(\x05R\x03pid\x12\x0e\n" +
@@ -1317,7 +2407,13 @@ const file_pkg_bridge_bridge_proto_rawDesc = "" +
 	"\vinternal_ip\x18\a \x01(\tR\n" +
 	"internalIp\x12!\n" +
 	"\fprocess_name\x18\b \x01(\tR\vprocessName\x12*\n" +
-	"\x11is_high_integrity\x18\t \x01(\bR\x0fisHighIntegrity\"\xe7\x01\n" +
+	"\x11is_high_integrity\x18\t \x01(\bR\x0fisHighIntegrity\x12#\n" +
+	"\ragent_version\x18\n" +
+	" \x01(\tR\fagentVersion\x12&\n" +
+	"\x0fupgrade_task_id\x18\v \x01(\tR\rupgradeTaskId\x12\x1f\n" +
+	"\vbuild_token\x18\f \x01(\tR\n" +
+	"buildToken\x12)\n" +
+	"\x10host_fingerprint\x18\r \x01(\tR\x0fhostFingerprint\"\xe7\x01\n" +
 	"\x12StageBeaconRequest\x12#\n" +
 	"\rlistener_name\x18\x01 \x01(\tR\flistenerName\x12\x1f\n" +
 	"\vremote_addr\x18\x02 \x01(\tR\n" +
@@ -1330,13 +2426,14 @@ const file_pkg_bridge_bridge_proto_rawDesc = "" +
 	"\x12assigned_beacon_id\x18\x01 \x01(\tR\x10assignedBeaconId\x12\x1f\n" +
 	"\vsession_key\x18\x02 \x01(\fR\n" +
 	"sessionKey\x122\n" +
-	"\x15session_key_encrypted\x18\x03 \x01(\bR\x13sessionKeyEncrypted\"\xb3\x01\n" +
+	"\x15session_key_encrypted\x18\x03 \x01(\bR\x13sessionKeyEncrypted\"\xd9\x01\n" +
 	"\x14CheckInBeaconRequest\x12\x1b\n" +
 	"\tbeacon_id\x18\x01 \x01(\tR\bbeaconId\x12#\n" +
 	"\rlistener_name\x18\x02 \x01(\tR\flistenerName\x12\x1f\n" +
 	"\vremote_addr\x18\x03 \x01(\tR\n" +
 	"remoteAddr\x128\n" +
-	"\ttimestamp\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\"\\\n" +
+	"\ttimestamp\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12$\n" +
+	"\x0eacked_task_ids\x18\x06 \x03(\tR\fackedTaskIds\"\\\n" +
 	"\x04Task\x12\x17\n" +
 	"\atask_id\x18\x01 \x01(\tR\x06taskId\x12\x1d\n" +
 	"\n" +
@@ -1344,7 +2441,7 @@ const file_pkg_bridge_bridge_proto_rawDesc = "" +
 	"\targuments\x18\x03 \x01(\fR\targuments\"X\n" +
 	"\x15CheckInBeaconResponse\x12\"\n" +
 	"\x05tasks\x18\x01 \x03(\v2\f.bridge.TaskR\x05tasks\x12\x1b\n" +
-	"\tnew_sleep\x18\x02 \x01(\x05R\bnewSleep\"\xc3\x02\n" +
+	"\tnew_sleep\x18\x02 \x01(\x05R\bnewSleep\"\xe8\x02\n" +
 	"\x17PushBeaconOutputRequest\x12\x1b\n" +
 	"\tbeacon_id\x18\x01 \x01(\tR\bbeaconId\x12#\n" +
 	"\rlistener_name\x18\x02 \x01(\tR\flistenerName\x12\x1f\n" +
@@ -1356,7 +2453,10 @@ const file_pkg_bridge_bridge_proto_rawDesc = "" +
 	"command_id\x18\x06 \x01(\rR\tcommandId\x12\x16\n" +
 	"\x06status\x18\a \x01(\x05R\x06status\x12\x16\n" +
 	"\x06output\x18\b \x01(\fR\x06output\x12#\n" +
-	"\rerror_message\x18\t \x01(\tR\ferrorMessage\"\x1a\n" +
+	"\rerror_message\x18\t \x01(\tR\ferrorMessage\x12\x19\n" +
+	"\x05final\x18\n" +
+	" \x01(\bH\x00R\x05final\x88\x01\x01B\b\n" +
+	"\x06_final\"\x1a\n" +
 	"\x18PushBeaconOutputResponse\"E\n" +
 	"\x1eGetListenerSharedSecretRequest\x12#\n" +
 	"\rlistener_name\x18\x01 \x01(\tR\flistenerName\"F\n" +
@@ -1383,13 +2483,47 @@ const file_pkg_bridge_bridge_proto_rawDesc = "" +
 	"\x06config\x18\x01 \x03(\v2+.bridge.GetBeaconConfigResponse.ConfigEntryR\x06config\x1a9\n" +
 	"\vConfigEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"W\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"t\n" +
 	"\x19GetTaskedFileChunkRequest\x12\x17\n" +
 	"\atask_id\x18\x01 \x01(\tR\x06taskId\x12!\n" +
-	"\fchunk_number\x18\x02 \x01(\x05R\vchunkNumber\";\n" +
+	"\fchunk_number\x18\x02 \x01(\x05R\vchunkNumber\x12\x1b\n" +
+	"\tbeacon_id\x18\x03 \x01(\tR\bbeaconId\";\n" +
 	"\x1aGetTaskedFileChunkResponse\x12\x1d\n" +
 	"\n" +
-	"chunk_data\x18\x01 \x01(\fR\tchunkData2\xa2\x06\n" +
+	"chunk_data\x18\x01 \x01(\fR\tchunkData\"\x7f\n" +
+	"\x17StreamTaskedFileRequest\x12\x17\n" +
+	"\atask_id\x18\x01 \x01(\tR\x06taskId\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\x12\x16\n" +
+	"\x06length\x18\x03 \x01(\x03R\x06length\x12\x1b\n" +
+	"\tbeacon_id\x18\x04 \x01(\tR\bbeaconId\"7\n" +
+	"\tFileChunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\"\x97\x02\n" +
+	"\fRelayRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12#\n" +
+	"\rlistener_name\x18\x02 \x01(\tR\flistenerName\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x03 \x01(\tR\trequestId\x122\n" +
+	"\x05stage\x18\x04 \x01(\v2\x1a.bridge.StageBeaconRequestH\x00R\x05stage\x129\n" +
+	"\bcheck_in\x18\x05 \x01(\v2\x1c.bridge.CheckInBeaconRequestH\x00R\acheckIn\x129\n" +
+	"\x06output\x18\x06 \x01(\v2\x1f.bridge.PushBeaconOutputRequestH\x00R\x06outputB\t\n" +
+	"\apayload\"\xba\x02\n" +
+	"\rRelayResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x123\n" +
+	"\x05stage\x18\x02 \x01(\v2\x1b.bridge.StageBeaconResponseH\x00R\x05stage\x12:\n" +
+	"\bcheck_in\x18\x03 \x01(\v2\x1d.bridge.CheckInBeaconResponseH\x00R\acheckIn\x12:\n" +
+	"\x06output\x18\x04 \x01(\v2 .bridge.PushBeaconOutputResponseH\x00R\x06output\x12*\n" +
+	"\x05error\x18\x05 \x01(\v2\x12.bridge.RelayErrorH\x00R\x05error\x125\n" +
+	"\vtask_notice\x18\x06 \x01(\v2\x12.bridge.TaskNoticeH\x00R\n" +
+	"taskNoticeB\t\n" +
+	"\apayload\":\n" +
+	"\n" +
+	"RelayError\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\x05R\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\")\n" +
+	"\n" +
+	"TaskNotice\x12\x1b\n" +
+	"\tbeacon_id\x18\x01 \x01(\tR\bbeaconId2\x8b\b\n" +
 	"\x17TeamServerBridgeService\x12F\n" +
 	"\vStageBeacon\x12\x1a.bridge.StageBeaconRequest\x1a\x1b.bridge.StageBeaconResponse\x12L\n" +
 	"\rCheckInBeacon\x12\x1c.bridge.CheckInBeaconRequest\x1a\x1d.bridge.CheckInBeaconResponse\x12U\n" +
@@ -1398,8 +2532,11 @@ const file_pkg_bridge_bridge_proto_rawDesc = "" +
 	"\x13GetBeaconSessionKey\x12\".bridge.GetBeaconSessionKeyRequest\x1a#.bridge.GetBeaconSessionKeyResponse\x12U\n" +
 	"\x10LogListenerEvent\x12\x1f.bridge.LogListenerEventRequest\x1a .bridge.LogListenerEventResponse\x12R\n" +
 	"\x0fGetBeaconConfig\x12\x1e.bridge.GetBeaconConfigRequest\x1a\x1f.bridge.GetBeaconConfigResponse\x12[\n" +
-	"\x12GetTaskedFileChunk\x12!.bridge.GetTaskedFileChunkRequest\x1a\".bridge.GetTaskedFileChunkResponse\x12F\n" +
-	"\x0fListenerControl\x12\x16.bridge.ListenerStatus\x1a\x17.bridge.ListenerCommand(\x010\x01B\x15Z\x13simplec2/pkg/bridgeb\x06proto3"
+	"\x12GetTaskedFileChunk\x12!.bridge.GetTaskedFileChunkRequest\x1a\".bridge.GetTaskedFileChunkResponse\x12H\n" +
+	"\x10StreamTaskedFile\x12\x1f.bridge.StreamTaskedFileRequest\x1a\x11.bridge.FileChunk0\x01\x12]\n" +
+	"\x16PushBeaconOutputStream\x12\x1f.bridge.PushBeaconOutputRequest\x1a .bridge.PushBeaconOutputResponse(\x01\x12F\n" +
+	"\x0fListenerControl\x12\x16.bridge.ListenerStatus\x1a\x17.bridge.ListenerCommand(\x010\x01\x12>\n" +
+	"\vBeaconRelay\x12\x14.bridge.RelayRequest\x1a\x15.bridge.RelayResponse(\x010\x01B\x15Z\x13simplec2/pkg/bridgeb\x06proto3"
 
 var (
 	file_pkg_bridge_bridge_proto_rawDescOnce sync.Once
@@ -1414,65 +2551,103 @@ func file_pkg_bridge_bridge_proto_rawDescGZIP() []byte {
 }
 
 var file_pkg_bridge_bridge_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_pkg_bridge_bridge_proto_msgTypes = make([]protoimpl.MessageInfo, 22)
+var file_pkg_bridge_bridge_proto_msgTypes = make([]protoimpl.MessageInfo, 35)
 var file_pkg_bridge_bridge_proto_goTypes = []any{
 	(ListenerCommand_Action)(0),             // 0: bridge.ListenerCommand.Action
 	(*ListenerStatus)(nil),                  // 1: bridge.ListenerStatus
-	(*ListenerCommand)(nil),                 // 2: bridge.ListenerCommand
-	(*BeaconMetadata)(nil),                  // 3: bridge.BeaconMetadata
-	(*StageBeaconRequest)(nil),              // 4: bridge.StageBeaconRequest
-	(*StageBeaconResponse)(nil),             // 5: bridge.StageBeaconResponse
-	(*CheckInBeaconRequest)(nil),            // 6: bridge.CheckInBeaconRequest
-	(*Task)(nil),                            // 7: bridge.Task
-	(*CheckInBeaconResponse)(nil),           // 8: bridge.CheckInBeaconResponse
-	(*PushBeaconOutputRequest)(nil),         // 9: bridge.PushBeaconOutputRequest
-	(*PushBeaconOutputResponse)(nil),        // 10: bridge.PushBeaconOutputResponse
-	(*GetListenerSharedSecretRequest)(nil),  // 11: bridge.GetListenerSharedSecretRequest
-	(*GetListenerSharedSecretResponse)(nil), // 12: bridge.GetListenerSharedSecretResponse
-	(*GetBeaconSessionKeyRequest)(nil),      // 13: bridge.GetBeaconSessionKeyRequest
-	(*GetBeaconSessionKeyResponse)(nil),     // 14: bridge.GetBeaconSessionKeyResponse
-	(*LogListenerEventRequest)(nil),         // 15: bridge.LogListenerEventRequest
-	(*LogListenerEventResponse)(nil),        // 16: bridge.LogListenerEventResponse
-	(*GetBeaconConfigRequest)(nil),          // 17: bridge.GetBeaconConfigRequest
-	(*GetBeaconConfigResponse)(nil),         // 18: bridge.GetBeaconConfigResponse
-	(*GetTaskedFileChunkRequest)(nil),       // 19: bridge.GetTaskedFileChunkRequest
-	(*GetTaskedFileChunkResponse)(nil),      // 20: bridge.GetTaskedFileChunkResponse
-	nil,                                     // 21: bridge.LogListenerEventRequest.FieldsEntry
-	nil,                                     // 22: bridge.GetBeaconConfigResponse.ConfigEntry
-	(*timestamppb.Timestamp)(nil),           // 23: google.protobuf.Timestamp
+	(*ListenerLogEntry)(nil),                // 2: bridge.ListenerLogEntry
+	(*ListenerCommand)(nil),                 // 3: bridge.ListenerCommand
+	(*HostedFile)(nil),                      // 4: bridge.HostedFile
+	(*HostedFileDownload)(nil),              // 5: bridge.HostedFileDownload
+	(*Canary)(nil),                          // 6: bridge.Canary
+	(*CanaryHit)(nil),                       // 7: bridge.CanaryHit
+	(*BeaconMetadata)(nil),                  // 8: bridge.BeaconMetadata
+	(*StageBeaconRequest)(nil),              // 9: bridge.StageBeaconRequest
+	(*StageBeaconResponse)(nil),             // 10: bridge.StageBeaconResponse
+	(*CheckInBeaconRequest)(nil),            // 11: bridge.CheckInBeaconRequest
+	(*Task)(nil),                            // 12: bridge.Task
+	(*CheckInBeaconResponse)(nil),           // 13: bridge.CheckInBeaconResponse
+	(*PushBeaconOutputRequest)(nil),         // 14: bridge.PushBeaconOutputRequest
+	(*PushBeaconOutputResponse)(nil),        // 15: bridge.PushBeaconOutputResponse
+	(*GetListenerSharedSecretRequest)(nil),  // 16: bridge.GetListenerSharedSecretRequest
+	(*GetListenerSharedSecretResponse)(nil), // 17: bridge.GetListenerSharedSecretResponse
+	(*GetBeaconSessionKeyRequest)(nil),      // 18: bridge.GetBeaconSessionKeyRequest
+	(*GetBeaconSessionKeyResponse)(nil),     // 19: bridge.GetBeaconSessionKeyResponse
+	(*LogListenerEventRequest)(nil),         // 20: bridge.LogListenerEventRequest
+	(*LogListenerEventResponse)(nil),        // 21: bridge.LogListenerEventResponse
+	(*GetBeaconConfigRequest)(nil),          // 22: bridge.GetBeaconConfigRequest
+	(*GetBeaconConfigResponse)(nil),         // 23: bridge.GetBeaconConfigResponse
+	(*GetTaskedFileChunkRequest)(nil),       // 24: bridge.GetTaskedFileChunkRequest
+	(*GetTaskedFileChunkResponse)(nil),      // 25: bridge.GetTaskedFileChunkResponse
+	(*StreamTaskedFileRequest)(nil),         // 26: bridge.StreamTaskedFileRequest
+	(*FileChunk)(nil),                       // 27: bridge.FileChunk
+	(*RelayRequest)(nil),                    // 28: bridge.RelayRequest
+	(*RelayResponse)(nil),                   // 29: bridge.RelayResponse
+	(*RelayError)(nil),                      // 30: bridge.RelayError
+	(*TaskNotice)(nil),                      // 31: bridge.TaskNotice
+	nil,                                     // 32: bridge.ListenerLogEntry.FieldsEntry
+	nil,                                     // 33: bridge.CanaryHit.HeadersEntry
+	nil,                                     // 34: bridge.LogListenerEventRequest.FieldsEntry
+	nil,                                     // 35: bridge.GetBeaconConfigResponse.ConfigEntry
+	(*timestamppb.Timestamp)(nil),           // 36: google.protobuf.Timestamp
 }
 var file_pkg_bridge_bridge_proto_depIdxs = []int32{
-	0,  // 0: bridge.ListenerCommand.action:type_name -> bridge.ListenerCommand.Action
-	23, // 1: bridge.StageBeaconRequest.timestamp:type_name -> google.protobuf.Timestamp
-	3,  // 2: bridge.StageBeaconRequest.metadata:type_name -> bridge.BeaconMetadata
-	23, // 3: bridge.CheckInBeaconRequest.timestamp:type_name -> google.protobuf.Timestamp
-	7,  // 4: bridge.CheckInBeaconResponse.tasks:type_name -> bridge.Task
-	23, // 5: bridge.PushBeaconOutputRequest.timestamp:type_name -> google.protobuf.Timestamp
-	21, // 6: bridge.LogListenerEventRequest.fields:type_name -> bridge.LogListenerEventRequest.FieldsEntry
-	22, // 7: bridge.GetBeaconConfigResponse.config:type_name -> bridge.GetBeaconConfigResponse.ConfigEntry
-	4,  // 8: bridge.TeamServerBridgeService.StageBeacon:input_type -> bridge.StageBeaconRequest
-	6,  // 9: bridge.TeamServerBridgeService.CheckInBeacon:input_type -> bridge.CheckInBeaconRequest
-	9,  // 10: bridge.TeamServerBridgeService.PushBeaconOutput:input_type -> bridge.PushBeaconOutputRequest
-	11, // 11: bridge.TeamServerBridgeService.GetListenerSharedSecret:input_type -> bridge.GetListenerSharedSecretRequest
-	13, // 12: bridge.TeamServerBridgeService.GetBeaconSessionKey:input_type -> bridge.GetBeaconSessionKeyRequest
-	15, // 13: bridge.TeamServerBridgeService.LogListenerEvent:input_type -> bridge.LogListenerEventRequest
-	17, // 14: bridge.TeamServerBridgeService.GetBeaconConfig:input_type -> bridge.GetBeaconConfigRequest
-	19, // 15: bridge.TeamServerBridgeService.GetTaskedFileChunk:input_type -> bridge.GetTaskedFileChunkRequest
-	1,  // 16: bridge.TeamServerBridgeService.ListenerControl:input_type -> bridge.ListenerStatus
-	5,  // 17: bridge.TeamServerBridgeService.StageBeacon:output_type -> bridge.StageBeaconResponse
-	8,  // 18: bridge.TeamServerBridgeService.CheckInBeacon:output_type -> bridge.CheckInBeaconResponse
-	10, // 19: bridge.TeamServerBridgeService.PushBeaconOutput:output_type -> bridge.PushBeaconOutputResponse
-	12, // 20: bridge.TeamServerBridgeService.GetListenerSharedSecret:output_type -> bridge.GetListenerSharedSecretResponse
-	14, // 21: bridge.TeamServerBridgeService.GetBeaconSessionKey:output_type -> bridge.GetBeaconSessionKeyResponse
-	16, // 22: bridge.TeamServerBridgeService.LogListenerEvent:output_type -> bridge.LogListenerEventResponse
-	18, // 23: bridge.TeamServerBridgeService.GetBeaconConfig:output_type -> bridge.GetBeaconConfigResponse
-	20, // 24: bridge.TeamServerBridgeService.GetTaskedFileChunk:output_type -> bridge.GetTaskedFileChunkResponse
-	2,  // 25: bridge.TeamServerBridgeService.ListenerControl:output_type -> bridge.ListenerCommand
-	17, // [17:26] is the sub-list for method output_type
-	8,  // [8:17] is the sub-list for method input_type
-	8,  // [8:8] is the sub-list for extension type_name
-	8,  // [8:8] is the sub-list for extension extendee
-	0,  // [0:8] is the sub-list for field type_name
+	36, // 0: bridge.ListenerStatus.last_disconnect:type_name -> google.protobuf.Timestamp
+	2,  // 1: bridge.ListenerStatus.logs:type_name -> bridge.ListenerLogEntry
+	5,  // 2: bridge.ListenerStatus.hosted_file_downloads:type_name -> bridge.HostedFileDownload
+	7,  // 3: bridge.ListenerStatus.canary_hits:type_name -> bridge.CanaryHit
+	36, // 4: bridge.ListenerLogEntry.time:type_name -> google.protobuf.Timestamp
+	32, // 5: bridge.ListenerLogEntry.fields:type_name -> bridge.ListenerLogEntry.FieldsEntry
+	0,  // 6: bridge.ListenerCommand.action:type_name -> bridge.ListenerCommand.Action
+	4,  // 7: bridge.ListenerCommand.hosted_file:type_name -> bridge.HostedFile
+	6,  // 8: bridge.ListenerCommand.canaries:type_name -> bridge.Canary
+	36, // 9: bridge.HostedFileDownload.time:type_name -> google.protobuf.Timestamp
+	36, // 10: bridge.CanaryHit.time:type_name -> google.protobuf.Timestamp
+	33, // 11: bridge.CanaryHit.headers:type_name -> bridge.CanaryHit.HeadersEntry
+	36, // 12: bridge.StageBeaconRequest.timestamp:type_name -> google.protobuf.Timestamp
+	8,  // 13: bridge.StageBeaconRequest.metadata:type_name -> bridge.BeaconMetadata
+	36, // 14: bridge.CheckInBeaconRequest.timestamp:type_name -> google.protobuf.Timestamp
+	12, // 15: bridge.CheckInBeaconResponse.tasks:type_name -> bridge.Task
+	36, // 16: bridge.PushBeaconOutputRequest.timestamp:type_name -> google.protobuf.Timestamp
+	34, // 17: bridge.LogListenerEventRequest.fields:type_name -> bridge.LogListenerEventRequest.FieldsEntry
+	35, // 18: bridge.GetBeaconConfigResponse.config:type_name -> bridge.GetBeaconConfigResponse.ConfigEntry
+	9,  // 19: bridge.RelayRequest.stage:type_name -> bridge.StageBeaconRequest
+	11, // 20: bridge.RelayRequest.check_in:type_name -> bridge.CheckInBeaconRequest
+	14, // 21: bridge.RelayRequest.output:type_name -> bridge.PushBeaconOutputRequest
+	10, // 22: bridge.RelayResponse.stage:type_name -> bridge.StageBeaconResponse
+	13, // 23: bridge.RelayResponse.check_in:type_name -> bridge.CheckInBeaconResponse
+	15, // 24: bridge.RelayResponse.output:type_name -> bridge.PushBeaconOutputResponse
+	30, // 25: bridge.RelayResponse.error:type_name -> bridge.RelayError
+	31, // 26: bridge.RelayResponse.task_notice:type_name -> bridge.TaskNotice
+	9,  // 27: bridge.TeamServerBridgeService.StageBeacon:input_type -> bridge.StageBeaconRequest
+	11, // 28: bridge.TeamServerBridgeService.CheckInBeacon:input_type -> bridge.CheckInBeaconRequest
+	14, // 29: bridge.TeamServerBridgeService.PushBeaconOutput:input_type -> bridge.PushBeaconOutputRequest
+	16, // 30: bridge.TeamServerBridgeService.GetListenerSharedSecret:input_type -> bridge.GetListenerSharedSecretRequest
+	18, // 31: bridge.TeamServerBridgeService.GetBeaconSessionKey:input_type -> bridge.GetBeaconSessionKeyRequest
+	20, // 32: bridge.TeamServerBridgeService.LogListenerEvent:input_type -> bridge.LogListenerEventRequest
+	22, // 33: bridge.TeamServerBridgeService.GetBeaconConfig:input_type -> bridge.GetBeaconConfigRequest
+	24, // 34: bridge.TeamServerBridgeService.GetTaskedFileChunk:input_type -> bridge.GetTaskedFileChunkRequest
+	26, // 35: bridge.TeamServerBridgeService.StreamTaskedFile:input_type -> bridge.StreamTaskedFileRequest
+	14, // 36: bridge.TeamServerBridgeService.PushBeaconOutputStream:input_type -> bridge.PushBeaconOutputRequest
+	1,  // 37: bridge.TeamServerBridgeService.ListenerControl:input_type -> bridge.ListenerStatus
+	28, // 38: bridge.TeamServerBridgeService.BeaconRelay:input_type -> bridge.RelayRequest
+	10, // 39: bridge.TeamServerBridgeService.StageBeacon:output_type -> bridge.StageBeaconResponse
+	13, // 40: bridge.TeamServerBridgeService.CheckInBeacon:output_type -> bridge.CheckInBeaconResponse
+	15, // 41: bridge.TeamServerBridgeService.PushBeaconOutput:output_type -> bridge.PushBeaconOutputResponse
+	17, // 42: bridge.TeamServerBridgeService.GetListenerSharedSecret:output_type -> bridge.GetListenerSharedSecretResponse
+	19, // 43: bridge.TeamServerBridgeService.GetBeaconSessionKey:output_type -> bridge.GetBeaconSessionKeyResponse
+	21, // 44: bridge.TeamServerBridgeService.LogListenerEvent:output_type -> bridge.LogListenerEventResponse
+	23, // 45: bridge.TeamServerBridgeService.GetBeaconConfig:output_type -> bridge.GetBeaconConfigResponse
+	25, // 46: bridge.TeamServerBridgeService.GetTaskedFileChunk:output_type -> bridge.GetTaskedFileChunkResponse
+	27, // 47: bridge.TeamServerBridgeService.StreamTaskedFile:output_type -> bridge.FileChunk
+	15, // 48: bridge.TeamServerBridgeService.PushBeaconOutputStream:output_type -> bridge.PushBeaconOutputResponse
+	3,  // 49: bridge.TeamServerBridgeService.ListenerControl:output_type -> bridge.ListenerCommand
+	29, // 50: bridge.TeamServerBridgeService.BeaconRelay:output_type -> bridge.RelayResponse
+	39, // [39:51] is the sub-list for method output_type
+	27, // [27:39] is the sub-list for method input_type
+	27, // [27:27] is the sub-list for extension type_name
+	27, // [27:27] is the sub-list for extension extendee
+	0,  // [0:27] is the sub-list for field type_name
 }
 
 func init() { file_pkg_bridge_bridge_proto_init() }
@@ -1480,13 +2655,26 @@ func file_pkg_bridge_bridge_proto_init() {
 	if File_pkg_bridge_bridge_proto != nil {
 		return
 	}
+	file_pkg_bridge_bridge_proto_msgTypes[13].OneofWrappers = []any{}
+	file_pkg_bridge_bridge_proto_msgTypes[27].OneofWrappers = []any{
+		(*RelayRequest_Stage)(nil),
+		(*RelayRequest_CheckIn)(nil),
+		(*RelayRequest_Output)(nil),
+	}
+	file_pkg_bridge_bridge_proto_msgTypes[28].OneofWrappers = []any{
+		(*RelayResponse_Stage)(nil),
+		(*RelayResponse_CheckIn)(nil),
+		(*RelayResponse_Output)(nil),
+		(*RelayResponse_Error)(nil),
+		(*RelayResponse_TaskNotice)(nil),
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pkg_bridge_bridge_proto_rawDesc), len(file_pkg_bridge_bridge_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   22,
+			NumMessages:   35,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
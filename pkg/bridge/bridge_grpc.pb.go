@@ -27,7 +27,10 @@ const (
 	TeamServerBridgeService_LogListenerEvent_FullMethodName        = "/bridge.TeamServerBridgeService/LogListenerEvent"
 	TeamServerBridgeService_GetBeaconConfig_FullMethodName         = "/bridge.TeamServerBridgeService/GetBeaconConfig"
 	TeamServerBridgeService_GetTaskedFileChunk_FullMethodName      = "/bridge.TeamServerBridgeService/GetTaskedFileChunk"
+	TeamServerBridgeService_StreamTaskedFile_FullMethodName        = "/bridge.TeamServerBridgeService/StreamTaskedFile"
+	TeamServerBridgeService_PushBeaconOutputStream_FullMethodName  = "/bridge.TeamServerBridgeService/PushBeaconOutputStream"
 	TeamServerBridgeService_ListenerControl_FullMethodName         = "/bridge.TeamServerBridgeService/ListenerControl"
+	TeamServerBridgeService_BeaconRelay_FullMethodName             = "/bridge.TeamServerBridgeService/BeaconRelay"
 )
 
 // TeamServerBridgeServiceClient is the client API for TeamServerBridgeService service.
@@ -50,10 +53,16 @@ type TeamServerBridgeServiceClient interface {
 	LogListenerEvent(ctx context.Context, in *LogListenerEventRequest, opts ...grpc.CallOption) (*LogListenerEventResponse, error)
 	// 获取用于生成 Beacon 的配置
 	GetBeaconConfig(ctx context.Context, in *GetBeaconConfigRequest, opts ...grpc.CallOption) (*GetBeaconConfigResponse, error)
-	// 获取已分配任务的文件分片
+	// 获取已分配任务的文件分片（保留以兼容旧版 Listener，新版使用 StreamTaskedFile）
 	GetTaskedFileChunk(ctx context.Context, in *GetTaskedFileChunkRequest, opts ...grpc.CallOption) (*GetTaskedFileChunkResponse, error)
+	// 以流的形式获取已分配任务的文件内容，每条消息不超过 64 KB
+	StreamTaskedFile(ctx context.Context, in *StreamTaskedFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileChunk], error)
+	// 以流的形式提交较大的任务结果：第一条消息携带全部字段，后续消息只携带 output 的后续部分
+	PushBeaconOutputStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[PushBeaconOutputRequest, PushBeaconOutputResponse], error)
 	// 新增：监听器控制流
 	ListenerControl(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ListenerStatus, ListenerCommand], error)
+	// 每个 Listener 一条长连接，复用 Beacon 的 stage/check-in/output 请求，TeamServer 也通过它推送新任务通知
+	BeaconRelay(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[RelayRequest, RelayResponse], error)
 }
 
 type teamServerBridgeServiceClient struct {
@@ -144,9 +153,41 @@ func (c *teamServerBridgeServiceClient) GetTaskedFileChunk(ctx context.Context,
 	return out, nil
 }
 
+func (c *teamServerBridgeServiceClient) StreamTaskedFile(ctx context.Context, in *StreamTaskedFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TeamServerBridgeService_ServiceDesc.Streams[0], TeamServerBridgeService_StreamTaskedFile_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamTaskedFileRequest, FileChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TeamServerBridgeService_StreamTaskedFileClient = grpc.ServerStreamingClient[FileChunk]
+
+func (c *teamServerBridgeServiceClient) PushBeaconOutputStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[PushBeaconOutputRequest, PushBeaconOutputResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TeamServerBridgeService_ServiceDesc.Streams[1], TeamServerBridgeService_PushBeaconOutputStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PushBeaconOutputRequest, PushBeaconOutputResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TeamServerBridgeService_PushBeaconOutputStreamClient = grpc.ClientStreamingClient[PushBeaconOutputRequest, PushBeaconOutputResponse]
+
 func (c *teamServerBridgeServiceClient) ListenerControl(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ListenerStatus, ListenerCommand], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &TeamServerBridgeService_ServiceDesc.Streams[0], TeamServerBridgeService_ListenerControl_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &TeamServerBridgeService_ServiceDesc.Streams[2], TeamServerBridgeService_ListenerControl_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -157,6 +198,19 @@ func (c *teamServerBridgeServiceClient) ListenerControl(ctx context.Context, opt
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type TeamServerBridgeService_ListenerControlClient = grpc.BidiStreamingClient[ListenerStatus, ListenerCommand]
 
+func (c *teamServerBridgeServiceClient) BeaconRelay(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[RelayRequest, RelayResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TeamServerBridgeService_ServiceDesc.Streams[3], TeamServerBridgeService_BeaconRelay_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RelayRequest, RelayResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TeamServerBridgeService_BeaconRelayClient = grpc.BidiStreamingClient[RelayRequest, RelayResponse]
+
 // TeamServerBridgeServiceServer is the server API for TeamServerBridgeService service.
 // All implementations must embed UnimplementedTeamServerBridgeServiceServer
 // for forward compatibility.
@@ -177,10 +231,16 @@ type TeamServerBridgeServiceServer interface {
 	LogListenerEvent(context.Context, *LogListenerEventRequest) (*LogListenerEventResponse, error)
 	// 获取用于生成 Beacon 的配置
 	GetBeaconConfig(context.Context, *GetBeaconConfigRequest) (*GetBeaconConfigResponse, error)
-	// 获取已分配任务的文件分片
+	// 获取已分配任务的文件分片（保留以兼容旧版 Listener，新版使用 StreamTaskedFile）
 	GetTaskedFileChunk(context.Context, *GetTaskedFileChunkRequest) (*GetTaskedFileChunkResponse, error)
+	// 以流的形式获取已分配任务的文件内容，每条消息不超过 64 KB
+	StreamTaskedFile(*StreamTaskedFileRequest, grpc.ServerStreamingServer[FileChunk]) error
+	// 以流的形式提交较大的任务结果：第一条消息携带全部字段，后续消息只携带 output 的后续部分
+	PushBeaconOutputStream(grpc.ClientStreamingServer[PushBeaconOutputRequest, PushBeaconOutputResponse]) error
 	// 新增：监听器控制流
 	ListenerControl(grpc.BidiStreamingServer[ListenerStatus, ListenerCommand]) error
+	// 每个 Listener 一条长连接，复用 Beacon 的 stage/check-in/output 请求，TeamServer 也通过它推送新任务通知
+	BeaconRelay(grpc.BidiStreamingServer[RelayRequest, RelayResponse]) error
 	mustEmbedUnimplementedTeamServerBridgeServiceServer()
 }
 
@@ -215,9 +275,18 @@ func (UnimplementedTeamServerBridgeServiceServer) GetBeaconConfig(context.Contex
 func (UnimplementedTeamServerBridgeServiceServer) GetTaskedFileChunk(context.Context, *GetTaskedFileChunkRequest) (*GetTaskedFileChunkResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method GetTaskedFileChunk not implemented")
 }
+func (UnimplementedTeamServerBridgeServiceServer) StreamTaskedFile(*StreamTaskedFileRequest, grpc.ServerStreamingServer[FileChunk]) error {
+	return status.Error(codes.Unimplemented, "method StreamTaskedFile not implemented")
+}
+func (UnimplementedTeamServerBridgeServiceServer) PushBeaconOutputStream(grpc.ClientStreamingServer[PushBeaconOutputRequest, PushBeaconOutputResponse]) error {
+	return status.Error(codes.Unimplemented, "method PushBeaconOutputStream not implemented")
+}
 func (UnimplementedTeamServerBridgeServiceServer) ListenerControl(grpc.BidiStreamingServer[ListenerStatus, ListenerCommand]) error {
 	return status.Error(codes.Unimplemented, "method ListenerControl not implemented")
 }
+func (UnimplementedTeamServerBridgeServiceServer) BeaconRelay(grpc.BidiStreamingServer[RelayRequest, RelayResponse]) error {
+	return status.Error(codes.Unimplemented, "method BeaconRelay not implemented")
+}
 func (UnimplementedTeamServerBridgeServiceServer) mustEmbedUnimplementedTeamServerBridgeServiceServer() {
 }
 func (UnimplementedTeamServerBridgeServiceServer) testEmbeddedByValue() {}
@@ -384,6 +453,24 @@ func _TeamServerBridgeService_GetTaskedFileChunk_Handler(srv interface{}, ctx co
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TeamServerBridgeService_StreamTaskedFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamTaskedFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TeamServerBridgeServiceServer).StreamTaskedFile(m, &grpc.GenericServerStream[StreamTaskedFileRequest, FileChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TeamServerBridgeService_StreamTaskedFileServer = grpc.ServerStreamingServer[FileChunk]
+
+func _TeamServerBridgeService_PushBeaconOutputStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TeamServerBridgeServiceServer).PushBeaconOutputStream(&grpc.GenericServerStream[PushBeaconOutputRequest, PushBeaconOutputResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TeamServerBridgeService_PushBeaconOutputStreamServer = grpc.ClientStreamingServer[PushBeaconOutputRequest, PushBeaconOutputResponse]
+
 func _TeamServerBridgeService_ListenerControl_Handler(srv interface{}, stream grpc.ServerStream) error {
 	return srv.(TeamServerBridgeServiceServer).ListenerControl(&grpc.GenericServerStream[ListenerStatus, ListenerCommand]{ServerStream: stream})
 }
@@ -391,6 +478,13 @@ func _TeamServerBridgeService_ListenerControl_Handler(srv interface{}, stream gr
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type TeamServerBridgeService_ListenerControlServer = grpc.BidiStreamingServer[ListenerStatus, ListenerCommand]
 
+func _TeamServerBridgeService_BeaconRelay_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TeamServerBridgeServiceServer).BeaconRelay(&grpc.GenericServerStream[RelayRequest, RelayResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TeamServerBridgeService_BeaconRelayServer = grpc.BidiStreamingServer[RelayRequest, RelayResponse]
+
 // TeamServerBridgeService_ServiceDesc is the grpc.ServiceDesc for TeamServerBridgeService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -432,12 +526,28 @@ var TeamServerBridgeService_ServiceDesc = grpc.ServiceDesc{
 		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamTaskedFile",
+			Handler:       _TeamServerBridgeService_StreamTaskedFile_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "PushBeaconOutputStream",
+			Handler:       _TeamServerBridgeService_PushBeaconOutputStream_Handler,
+			ClientStreams: true,
+		},
 		{
 			StreamName:    "ListenerControl",
 			Handler:       _TeamServerBridgeService_ListenerControl_Handler,
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "BeaconRelay",
+			Handler:       _TeamServerBridgeService_BeaconRelay_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "pkg/bridge/bridge.proto",
 }
@@ -8,7 +8,11 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -21,14 +25,49 @@ type EncryptedAPIKey struct {
 	Nonce string `yaml:"nonce"`
 }
 
+// Names of the secrets a SecretSource can provide.
+const (
+	SecretEncryptionKey = "encryption_key"
+	SecretJWTSecret     = "jwt_secret"
+	SecretAPIKey        = "api_key"
+	SecretSMTPPassword  = "smtp_password"
+)
+
+// SecretSource returns the current value of a secret held outside the configuration, e.g. in
+// Vault, and whether it holds that secret.
+type SecretSource func(name string) (string, bool)
+
+var secretSource SecretSource
+
+// SetSecretSource makes the secrets of source take precedence over environment variables and the
+// configuration file.
+func SetSecretSource(source SecretSource) {
+	secretSource = source
+}
+
+// lookupSecret returns a secret of the secret source, if any.
+func lookupSecret(name string) (string, bool) {
+	if secretSource == nil {
+		return "", false
+	}
+	return secretSource(name)
+}
+
+// getEncryptionKey 获取 API Key 的加密密钥，优先从密钥源读取，其次读取环境变量 SIMC2_ENCRYPTION_KEY
+func getEncryptionKey() string {
+	if key, ok := lookupSecret(SecretEncryptionKey); ok {
+		return key
+	}
+	if key := os.Getenv("SIMC2_ENCRYPTION_KEY"); key != "" {
+		return key
+	}
+	// 如果都没有，使用临时密钥（生产环境应该避免）
+	return "dev-encryption-key-change-me"
+}
+
 // EncryptAPIKey 使用 AES-256-GCM 加密 API Key
 func EncryptAPIKey(apiKey string) (*EncryptedAPIKey, error) {
-	// 从环境变量获取加密密钥
-	encryptionKey := os.Getenv("SIMC2_ENCRYPTION_KEY")
-	if encryptionKey == "" {
-		// 如果没有环境变量，生成一个临时的（生产环境应该避免）
-		encryptionKey = "dev-encryption-key-change-me"
-	}
+	encryptionKey := getEncryptionKey()
 
 	// 将密钥转换为 32 字节 (AES-256)
 	key := sha256.Sum256([]byte(encryptionKey))
@@ -65,11 +104,7 @@ func (e *EncryptedAPIKey) DecryptAPIKey() (string, error) {
 		return "", fmt.Errorf("encrypted API key is nil")
 	}
 
-	// 从环境变量获取解密密钥
-	encryptionKey := os.Getenv("SIMC2_ENCRYPTION_KEY")
-	if encryptionKey == "" {
-		encryptionKey = "dev-encryption-key-change-me"
-	}
+	encryptionKey := getEncryptionKey()
 
 	// 将密钥转换为 32 字节
 	key := sha256.Sum256([]byte(encryptionKey))
@@ -114,9 +149,12 @@ func (e *EncryptedAPIKey) String() string {
 	return fmt.Sprintf("EncryptedAPIKey{Nonce: %s, Encrypted: %s}", e.Nonce[:16], e.Encrypted[:16])
 }
 
-// getJWTSecret 获取 JWT 签名密钥，优先从环境变量读取
+// GetJWTSecret 获取 JWT 签名密钥，优先从密钥源读取，其次读取环境变量
 func GetJWTSecret(configSecret string) string {
-	// 1. 优先从环境变量读取
+	// 1. 优先从密钥源（如 Vault）和环境变量读取
+	if secret, ok := lookupSecret(SecretJWTSecret); ok {
+		return secret
+	}
 	if secret := os.Getenv("SIMC2_JWT_SECRET"); secret != "" {
 		return secret
 	}
@@ -136,22 +174,576 @@ type TeamServerConfig struct {
 			ServerCert string `yaml:"server_cert"`
 			ServerKey  string `yaml:"server_key"`
 			CACert     string `yaml:"ca_cert"`
+			// Optional: CRL issued by the TeamServer and checked in TLS handshakes; defaults to crl.pem next to ca_cert
+			CRL string `yaml:"crl,omitempty"`
+			// Optional: where the CA private key is held; defaults to the file ca.key next to ca_cert
+			CAKey *CAKeyConfig `yaml:"ca_key,omitempty"`
 		} `yaml:"certs"`
 	} `yaml:"grpc"`
 	API struct {
-		Port string `yaml:"port"`
+		Port string        `yaml:"port"`
+		TLS  *APITLSConfig `yaml:"tls,omitempty"`
 	} `yaml:"api"`
 	Database DatabaseConfig `yaml:"database"`
 	Auth     AuthConfig     `yaml:"auth"`
 	LootDir  string         `yaml:"loot_dir"`
 	UploadsDir string       `yaml:"uploads_dir"`
+	Builder  BuilderConfig  `yaml:"builder"`
+	RBAC     RBACConfig     `yaml:"rbac"`
+	Audit    AuditConfig    `yaml:"audit"`
+	Tasks    TaskConfig     `yaml:"tasks"`
+	Beacons  BeaconConfig   `yaml:"beacons"`
+	// Storage quotas of the loot directory
+	Loot LootConfig `yaml:"loot"`
+	// Request rate and bandwidth quotas of each listener on the gRPC bridge
+	ListenerQuotas ListenerQuotaConfig `yaml:"listener_quotas"`
+	// External health probes of the listeners' public endpoints
+	ListenerProbes ListenerProbeConfig `yaml:"listener_probes"`
+	// Keepalive and slow-client handling of WebSocket clients
+	WebSocket WebSocketConfig `yaml:"websocket"`
+	// Encryption at rest of the loot and uploads directories
+	FileEncryption FileEncryptionConfig `yaml:"file_encryption"`
+	// Optional: forward audit entries and security alerts to a SIEM
+	SIEM *SIEMConfig `yaml:"siem,omitempty"`
+	// Optional: export an oplog of the executed tasks to Ghostwriter or a JSONL file
+	Oplog *OplogConfig `yaml:"oplog,omitempty"`
+	// Optional: answer the DNS queries for payloads' canary subdomains, recording the payloads' detonations
+	DNSCanary *DNSCanaryConfig `yaml:"dns_canary,omitempty"`
+	// Delivery of notification rule actions
+	Notifications NotificationConfig `yaml:"notifications"`
+	// Templates and PDF conversion of engagement reports
+	Reports ReportConfig `yaml:"reports"`
+	// Thresholds of the /readyz dependency checks
+	Health HealthConfig `yaml:"health"`
+	// Database backups and their schedule
+	Backup BackupConfig `yaml:"backup"`
+	// Pruning of old task outputs, events and deleted beacons
+	Retention RetentionConfig `yaml:"retention"`
+	// Optional: share WebSocket events with the other TeamServer replicas
+	EventBus *EventBusConfig `yaml:"event_bus,omitempty"`
+	// Optional: fetch secrets from Vault or a cloud secret manager instead of this file
+	Secrets *SecretsConfig `yaml:"secrets,omitempty"`
+	// Cloud accounts redirectors are provisioned in, and how listeners are deployed on them
+	Infrastructure InfrastructureConfig `yaml:"infrastructure"`
+	// Log levels and the log file
+	Logging LoggingConfig `yaml:"logging"`
+	// Optional: serve Prometheus metrics, e.g. of the listener bridge
+	Metrics *MetricsConfig `yaml:"metrics,omitempty"`
+	// Optional: export OpenTelemetry traces of API requests, bridge calls and database queries
+	Tracing *TracingConfig `yaml:"tracing,omitempty"`
+}
+
+// MetricsConfig holds where the Prometheus metrics are served.
+type MetricsConfig struct {
+	// e.g. "127.0.0.1:9100"; the endpoint has no authentication, keep it off public interfaces
+	Address string `yaml:"address"`
+}
+
+// Types of secret providers.
+const (
+	SecretsVault = "vault"
+	SecretsAWS   = "awssm"
+	SecretsGCP   = "gcpsm"
+)
+
+// SecretsConfig selects a secret manager the TeamServer fetches its secrets from at startup.
+// Values are cached and fetched again periodically, so a secret rotated in the manager is
+// picked up without a restart. A secret without a reference keeps its usual source.
+type SecretsConfig struct {
+	Provider string `yaml:"provider"` // "vault", "awssm" (AWS Secrets Manager) or "gcpsm" (GCP Secret Manager)
+	// How often secrets are fetched again; defaults to 5m
+	RefreshInterval time.Duration `yaml:"refresh_interval,omitempty"`
+	Vault           *VaultConfig  `yaml:"vault,omitempty"`
+	Region          string        `yaml:"region,omitempty"`   // awssm: defaults to the region of the AWS configuration
+	Endpoint        string        `yaml:"endpoint,omitempty"` // awssm, gcpsm: e.g. a VPC or private service endpoint
+
+	// References of the secrets, "<name>#<field>" where the field selects a key of a JSON or KV
+	// secret. Vault: KV path, e.g. "secret/data/simplec2#jwt_secret"; awssm: secret name or ARN;
+	// gcpsm: secret version, e.g. "projects/p/secrets/simplec2-jwt/versions/latest"
+	EncryptionKey string `yaml:"encryption_key,omitempty"` // Replaces SIMC2_ENCRYPTION_KEY
+	JWTSecret     string `yaml:"jwt_secret,omitempty"`     // Replaces auth.jwt_secret and SIMC2_JWT_SECRET
+	APIKey        string `yaml:"api_key,omitempty"`        // Listener API key, replaces auth.api_key
+	SMTPPassword  string `yaml:"smtp_password,omitempty"`  // Replaces notifications.smtp.password and SIMC2_SMTP_PASSWORD
+}
+
+// VaultConfig holds the address of a HashiCorp Vault server and how the TeamServer logs in.
+type VaultConfig struct {
+	Address   string `yaml:"address"` // e.g. https://vault.example.com:8200
+	Namespace string `yaml:"namespace,omitempty"`
+	// "token" (default), "approle" or "kubernetes"; tokens are renewed while they are renewable
+	AuthMethod string `yaml:"auth_method,omitempty"`
+	Token      string `yaml:"token,omitempty"` // token: the VAULT_TOKEN environment variable takes precedence
+	// approle: the role and its secret ID; the SIMC2_VAULT_SECRET_ID environment variable takes precedence
+	RoleID   string `yaml:"role_id,omitempty"`
+	SecretID string `yaml:"secret_id,omitempty"`
+	// kubernetes: the Vault role; the service account token is read from the pod
+	Role string `yaml:"role,omitempty"`
+	// Mount path of the auth method; defaults to its name
+	AuthMount string `yaml:"auth_mount,omitempty"`
+	CACert    string `yaml:"ca_cert,omitempty"` // CA of the Vault server's certificate
+}
+
+// RetentionConfig holds the data retention policies, applied by a background worker.
+// A policy with 0 days is disabled. Audit logs have their own policy, see AuditConfig.
+type RetentionConfig struct {
+	// Clear the output of finished tasks last updated this many days ago
+	TaskOutputDays int `yaml:"task_output_days,omitempty"`
+	// Delete beacon check-in events (the check-in history) older than this
+	CheckInDays int `yaml:"check_in_days,omitempty"`
+	// Delete all other events (the WebSocket replay log) older than this
+	EventDays int `yaml:"event_days,omitempty"`
+	// Permanently delete beacons deleted this many days ago, with their tasks
+	DeletedBeaconDays int `yaml:"deleted_beacon_days,omitempty"`
+	// Hours between runs; defaults to 24
+	IntervalHours int `yaml:"interval_hours,omitempty"`
+	// Only log what the policies would delete
+	DryRun bool `yaml:"dry_run,omitempty"`
+}
+
+// ListenerProbeConfig holds the settings of the external health probes, which request each listener's
+// probe URL (set per listener through the API) to check that beacons can still reach it.
+type ListenerProbeConfig struct {
+	Interval int `yaml:"interval,omitempty"` // Seconds between probes of a listener; defaults to 60
+	Timeout  int `yaml:"timeout,omitempty"`  // Seconds a probe may take; defaults to 10
+	// Days probe results are kept; defaults to 7
+	HistoryDays int `yaml:"history_days,omitempty"`
+	// Optional: send HTTP probes through this proxy, e.g. "socks5://vps.example.com:1080", so they
+	// reach the listener from outside the TeamServer's network
+	Proxy string `yaml:"proxy,omitempty"`
+}
+
+// BackupConfig holds the settings of database backups. A backup holds a dump of every table and
+// manifests (size and SHA256) of the loot and uploads directories, not the files themselves.
+type BackupConfig struct {
+	Dir string `yaml:"dir,omitempty"` // Directory backups are kept in; defaults to "backups"
+	// Hours between scheduled backups; 0 disables the schedule
+	IntervalHours int `yaml:"interval_hours,omitempty"`
+	// Scheduled backups to keep, older ones are deleted; defaults to 7. Manual backups are never deleted
+	Keep int `yaml:"keep,omitempty"`
+	// Shared secret signing beacon export archives. Beacons can only be exported and imported when
+	// it is set, and only archives signed with the same key are imported
+	TransferKey string `yaml:"transfer_key,omitempty"`
+}
+
+// HealthConfig holds the settings of the readiness checks.
+type HealthConfig struct {
+	// Free space required on the loot and uploads directories' file systems, in MB; defaults to 500
+	MinFreeDiskMB int `yaml:"min_free_disk_mb,omitempty"`
+	// Seconds a single check may take before it counts as failed; defaults to 5
+	CheckTimeout int `yaml:"check_timeout,omitempty"`
+}
+
+// ReportConfig holds the settings of engagement report generation.
+type ReportConfig struct {
+	// Optional: directory with engagement.md.tmpl and/or engagement.html.tmpl replacing the built-in templates
+	TemplateDir string `yaml:"template_dir,omitempty"`
+	// Optional: command converting HTML on stdin to PDF on stdout, e.g. ["wkhtmltopdf", "-q", "-", "-"].
+	// PDF reports are unavailable if empty
+	PDFCommand []string `yaml:"pdf_command,omitempty"`
+	// Characters of each task's output included in a report; defaults to 4000, negative includes everything
+	MaxOutputLength int `yaml:"max_output_length,omitempty"`
+}
+
+// NotificationConfig holds the settings of the notification rules worker.
+type NotificationConfig struct {
+	QueueSize      int `yaml:"queue_size,omitempty"`      // Events waiting to be evaluated; defaults to 1000
+	WebhookTimeout int `yaml:"webhook_timeout,omitempty"` // Seconds; defaults to 10
+	// Optional: mail server used by "email" actions
+	SMTP *SMTPConfig `yaml:"smtp,omitempty"`
+}
+
+// LoggingConfig holds the log levels and outputs of the TeamServer. Levels can also be changed at
+// runtime through the API.
+type LoggingConfig struct {
+	Level string `yaml:"level,omitempty"` // "debug", "info" (default), "warn" or "error"
+	// Levels of components overriding Level: "api", "grpc", "hub", "services" or "listeners"
+	Components map[string]string `yaml:"components,omitempty"`
+	// Optional: also write the log to a rotated file
+	File *LogFileConfig `yaml:"file,omitempty"`
+}
+
+// LogFileConfig holds the log file and when it is rotated.
+type LogFileConfig struct {
+	Path        string `yaml:"path"`
+	MaxSizeMB   int    `yaml:"max_size_mb,omitempty"`  // Rotate at this size; defaults to 100
+	RotateHours int    `yaml:"rotate_hours,omitempty"` // Also rotate every this many hours, e.g. 24; 0 only rotates by size
+	MaxBackups  int    `yaml:"max_backups,omitempty"`  // Rotated files kept; 0 keeps all
+	MaxAgeDays  int    `yaml:"max_age_days,omitempty"` // Rotated files older than this are deleted; 0 keeps them
+	Compress    bool   `yaml:"compress,omitempty"`     // Gzip rotated files
+	FileOnly    bool   `yaml:"file_only,omitempty"`    // Don't also write to stdout
+}
+
+// Protocols of the OTLP trace exporter.
+const (
+	OTLPGRPC = "grpc"
+	OTLPHTTP = "http"
+)
+
+// TracingConfig holds the OTLP collector traces are exported to, e.g. Jaeger or Tempo.
+type TracingConfig struct {
+	// host:port of the collector, e.g. "localhost:4317" for gRPC or "localhost:4318" for HTTP
+	Endpoint string `yaml:"endpoint"`
+	Protocol string `yaml:"protocol,omitempty"` // "grpc" (default) or "http"
+	Insecure bool   `yaml:"insecure,omitempty"` // Plaintext connection to the collector
+	// Extra headers sent to the collector, e.g. for authentication
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Share of traces recorded, up to 1 (default). Traces continued from a caller follow its decision
+	SampleRatio float64 `yaml:"sample_ratio,omitempty"`
+	ServiceName string  `yaml:"service_name,omitempty"` // Defaults to "simplec2-teamserver"
+}
+
+// TLS modes of the SMTP connection.
+const (
+	SMTPTLSAuto     = "auto"     // STARTTLS if the server offers it
+	SMTPTLSStartTLS = "starttls" // STARTTLS, refuse servers without it
+	SMTPTLSImplicit = "tls"      // TLS from the start (SMTPS)
+	SMTPTLSNone     = "none"     // Plaintext
+)
+
+// SMTP authentication mechanisms.
+const (
+	SMTPAuthPlain   = "plain"
+	SMTPAuthLogin   = "login"
+	SMTPAuthCRAMMD5 = "cram-md5"
+	SMTPAuthNone    = "none"
+)
+
+// SMTPConfig holds the mail server notifications are sent through.
+type SMTPConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port,omitempty"` // Defaults to 465 for "tls", 587 for "starttls", 25 otherwise
+	// "auto" (default), "starttls", "tls" or "none"
+	TLS                string `yaml:"tls,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+	// "plain" (default with a username), "login", "cram-md5" or "none"; credentials are only sent over TLS
+	Auth     string `yaml:"auth,omitempty"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"` // The secret manager and SIMC2_SMTP_PASSWORD take precedence
+	From     string `yaml:"from"`
+	Timeout  int    `yaml:"timeout,omitempty"` // Seconds for the delivery of one message; defaults to 30
+}
+
+// SIEMConfig holds the settings of the SIEM forwarder.
+type SIEMConfig struct {
+	Type string `yaml:"type"` // "syslog" (JSON payload), "cef" (CEF over syslog) or "splunk_hec"
+	// syslog / cef
+	Network string `yaml:"network,omitempty"` // "udp" (default), "tcp" or "tls"
+	Address string `yaml:"address,omitempty"` // host:port
+	// splunk_hec
+	URL        string `yaml:"url,omitempty"` // e.g. https://splunk.example.com:8088/services/collector/event
+	Token      string `yaml:"token,omitempty"`
+	Sourcetype string `yaml:"sourcetype,omitempty"` // Defaults to "simplec2"
+
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+	// Only audit entries at or above this severity (0-10) are forwarded; security alerts always are
+	MinSeverity int `yaml:"min_severity,omitempty"`
+	QueueSize   int `yaml:"queue_size,omitempty"` // Defaults to 10000
+}
+
+// OplogConfig holds the settings of the oplog exporter. Every finished task is exported as an oplog
+// entry to each configured destination.
+type OplogConfig struct {
+	// Appends the entries as JSON lines to this file
+	JSONLPath   string             `yaml:"jsonl_path,omitempty"`
+	Ghostwriter *GhostwriterConfig `yaml:"ghostwriter,omitempty"`
+	// Bytes of the task output kept in an entry
+	OutputLimit int `yaml:"output_limit,omitempty"`
+	QueueSize   int `yaml:"queue_size,omitempty"` // Defaults to 10000
+}
+
+// DNSCanaryConfig holds the settings of DNS canaries. A payload built with a DNS canary resolves a
+// fresh name under its own subdomain of Domain every time it runs; Domain must be delegated (NS
+// record) to the TeamServer, which answers the queries and records them as detonations of the payload.
+type DNSCanaryConfig struct {
+	Domain string `yaml:"domain"`           // e.g. "cdn-metrics.example.com"
+	Listen string `yaml:"listen,omitempty"` // UDP address of the DNS server; defaults to ":53"
+	// Optional: IPv4 address answered to A queries; other queries get an empty answer
+	AnswerIP string `yaml:"answer_ip,omitempty"`
+}
+
+// GhostwriterConfig holds the Ghostwriter instance oplog entries are sent to.
+type GhostwriterConfig struct {
+	URL   string `yaml:"url"`   // e.g. https://ghostwriter.example.com
+	Token string `yaml:"token"` // API token
+	// Oplog the entries of an engagement are added to; engagements without one use OplogID, or are not exported if it is 0
+	OplogID            int            `yaml:"oplog_id,omitempty"`
+	EngagementOplogs   map[string]int `yaml:"engagement_oplogs,omitempty"`
+	InsecureSkipVerify bool           `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// EventBusConfig holds the settings of the event bus shared by TeamServer replicas. Every replica
+// broadcasts the events of the others to its WebSocket clients; they must use the same database.
+type EventBusConfig struct {
+	Type     string `yaml:"type"`    // "redis"
+	Address  string `yaml:"address"` // host:port
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	DB       int    `yaml:"db,omitempty"`
+	TLS      bool   `yaml:"tls,omitempty"`
+	// Pub/sub channel of the events; replicas of different deployments sharing a Redis need different ones
+	Channel   string `yaml:"channel,omitempty"`
+	QueueSize int    `yaml:"queue_size,omitempty"` // Events waiting to be published
+}
+
+// Types of CA key stores.
+const (
+	CAKeyFile   = "file"
+	CAKeyAWSKMS = "awskms"
+	CAKeyGCPKMS = "gcpkms"
+	CAKeyPKCS11 = "pkcs11"
+)
+
+// CAKeyConfig selects where the CA private key is held. A key in a cloud KMS or an HSM never
+// leaves it; the TeamServer calls it for every certificate and CRL it signs.
+type CAKeyConfig struct {
+	Type string `yaml:"type"`           // "file" (default), "awskms", "gcpkms" or "pkcs11"
+	Path string `yaml:"path,omitempty"` // file: defaults to ca.key next to ca_cert
+	// awskms: key ID, ARN or alias; gcpkms: key version, projects/.../cryptoKeys/<key>/cryptoKeyVersions/<n>
+	KeyID    string `yaml:"key_id,omitempty"`
+	Region   string `yaml:"region,omitempty"`   // awskms: defaults to the region of the AWS configuration
+	Endpoint string `yaml:"endpoint,omitempty"` // awskms, gcpkms: e.g. a VPC or private service endpoint
+	// pkcs11: path of the PKCS#11 module, the token and the label of the key pair
+	Module     string `yaml:"module,omitempty"`
+	TokenLabel string `yaml:"token_label,omitempty"`
+	KeyLabel   string `yaml:"key_label,omitempty"`
+	PIN        string `yaml:"pin,omitempty"` // pkcs11: user PIN; SIMC2_CA_KEY_PIN takes precedence
+}
+
+// AuditConfig controls the audit log of operator API requests.
+type AuditConfig struct {
+	// Also record read-only (GET) requests; by default only changes and denied requests are recorded
+	IncludeReads bool `yaml:"include_reads,omitempty"`
+	// Entries are written asynchronously; when the queue is full the oldest entries are dropped
+	QueueSize int `yaml:"queue_size,omitempty"` // Defaults to 10000
+	BatchSize int `yaml:"batch_size,omitempty"` // Defaults to 100
+	// Entries older than this many days are purged; 0 keeps them forever
+	RetentionDays int `yaml:"retention_days,omitempty"`
+	// If set, purged entries are first written to a gzipped JSONL file in this directory
+	ArchiveDir string `yaml:"archive_dir,omitempty"`
+}
+
+// TaskConfig holds task delivery settings.
+type TaskConfig struct {
+	// Seconds a dispatched task may stay unacknowledged before it is queued again
+	DispatchTimeout int `yaml:"dispatch_timeout,omitempty"`
+	// Deliveries before an unacknowledged task is marked failed
+	MaxDispatchAttempts int `yaml:"max_dispatch_attempts,omitempty"`
+	// Seconds a dispatched task may go without output before it is marked "timed_out"; negative disables
+	Timeout int `yaml:"timeout,omitempty"`
+	// Per-command overrides of Timeout, e.g. "download": 3600
+	CommandTimeouts map[string]int `yaml:"command_timeouts,omitempty"`
+	// Outputs larger than this many KB are stored as loot, with a preview in the database; negative disables
+	MaxOutputKB int `yaml:"max_output_kb,omitempty"`
+	// Size in KB of the preview kept for outputs stored as loot
+	OutputPreviewKB int `yaml:"output_preview_kb,omitempty"`
+}
+
+// BeaconConfig holds the missed check-in alerting settings. A window is the beacon's sleep
+// interval plus its maximum jitter.
+type BeaconConfig struct {
+	LateWindows int `yaml:"late_windows,omitempty"` // Missed windows before BEACON_LATE
+	LostWindows int `yaml:"lost_windows,omitempty"` // Missed windows before BEACON_LOST
+	// Seconds between batched writes of check-in times; negative writes on every check-in
+	LastSeenFlush int `yaml:"last_seen_flush,omitempty"`
+	// Seconds between updates of the persisted beacon statuses (active / inactive / hibernating)
+	StatusInterval int `yaml:"status_interval,omitempty"`
+	// Archive the beacon a re-staged agent replaces, i.e. the last one with the same host fingerprint
+	ArchiveRestaged bool `yaml:"archive_restaged,omitempty"`
+}
+
+// Slow-client policies: what the hub does when a client's send queue is full
+const (
+	SlowClientDisconnect = "disconnect"  // Drop the client; it reconnects and replays what it missed
+	SlowClientDropOldest = "drop_oldest" // Discard the oldest queued event to make room
+)
+
+// WebSocketConfig holds the keepalive and slow-client settings of WebSocket clients.
+type WebSocketConfig struct {
+	PingInterval int    `yaml:"ping_interval,omitempty"` // Seconds between pings
+	PongTimeout  int    `yaml:"pong_timeout,omitempty"`  // Seconds without a pong before the client is disconnected
+	WriteTimeout int    `yaml:"write_timeout,omitempty"` // Seconds a write to a client may take before it is disconnected
+	SendBuffer   int    `yaml:"send_buffer,omitempty"`   // Events queued per client
+	SlowClient   string `yaml:"slow_client,omitempty"`   // SlowClientDisconnect or SlowClientDropOldest
+}
+
+// LootConfig holds the storage quotas of loot. Quotas count the unique content of an
+// engagement's loot, so identical files collected again are free.
+type LootConfig struct {
+	QuotaMB int64 `yaml:"quota_mb,omitempty"` // Default per-engagement quota in MB; 0 is unlimited
+	// Per-engagement overrides in MB, e.g. "acme": 20480; negative is unlimited
+	EngagementQuotasMB map[string]int64 `yaml:"engagement_quotas_mb,omitempty"`
+	// Optional: copy collected loot to an S3 or MinIO bucket
+	Mirror *LootMirrorConfig `yaml:"mirror,omitempty"`
+}
+
+// LootMirrorConfig holds the bucket loot is mirrored to. Objects are encrypted with the mirror key
+// before they are uploaded, the storage provider only sees ciphertext.
+type LootMirrorConfig struct {
+	Bucket string `yaml:"bucket"`
+	Prefix string `yaml:"prefix,omitempty"` // Prepended to the object keys, e.g. "acme/"
+	// Credentials and region default to the usual AWS configuration (environment, ~/.aws, instance role)
+	Region          string `yaml:"region,omitempty"`
+	AccessKeyID     string `yaml:"access_key_id,omitempty"`
+	SecretAccessKey string `yaml:"secret_access_key,omitempty"`
+	// MinIO and other S3-compatible stores, e.g. https://minio.example.com:9000
+	Endpoint           string `yaml:"endpoint,omitempty"`
+	PathStyle          bool   `yaml:"path_style,omitempty"` // Required by MinIO
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"` // File holding the mirror key; SIMC2_LOOT_MIRROR_KEY takes precedence
+	// Lifecycle rule of the prefix: days until objects move to TransitionStorageClass, and until they expire; 0 is never
+	TransitionDays         int32  `yaml:"transition_days,omitempty"`
+	TransitionStorageClass string `yaml:"transition_storage_class,omitempty"` // e.g. "GLACIER", defaults to "STANDARD_IA"
+	ExpirationDays         int32  `yaml:"expiration_days,omitempty"`
+}
+
+// ListenerQuotaConfig limits the requests and data each listener sends over the gRPC bridge.
+// Listeners are told apart by their certificate, see the README. Zero values use the defaults,
+// negative ones are unlimited.
+type ListenerQuotaConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second,omitempty"` // Sustained rate of calls and relayed requests
+	RequestBurst      int     `yaml:"request_burst,omitempty"`       // Requests allowed at once above the rate
+	BandwidthKBps     int64   `yaml:"bandwidth_kbps,omitempty"`      // Sustained data rate in KB per second, both directions
+	BandwidthBurstKB  int64   `yaml:"bandwidth_burst_kb,omitempty"`  // Data allowed at once above the rate
+	// Per-listener overrides, e.g. "http-main": {requests_per_second: 2000}; unset fields use the values above
+	Listeners map[string]ListenerQuota `yaml:"listeners,omitempty"`
+}
+
+// ListenerQuota is the quota of one listener. Zero values are unlimited once resolved by GetQuota.
+type ListenerQuota struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second,omitempty"`
+	RequestBurst      int     `yaml:"request_burst,omitempty"`
+	BandwidthKBps     int64   `yaml:"bandwidth_kbps,omitempty"`
+	BandwidthBurstKB  int64   `yaml:"bandwidth_burst_kb,omitempty"`
+}
+
+// GetQuota 获取某个 Listener 的配额：默认每秒 500 个请求、突发 1000 个，带宽 64 MB/s、突发为一秒的带宽；返回值中 0 表示不限制
+func (l *ListenerQuotaConfig) GetQuota(listener string) ListenerQuota {
+	quota := ListenerQuota{
+		RequestsPerSecond: l.RequestsPerSecond,
+		RequestBurst:      l.RequestBurst,
+		BandwidthKBps:     l.BandwidthKBps,
+		BandwidthBurstKB:  l.BandwidthBurstKB,
+	}
+	if override, ok := l.Listeners[listener]; ok {
+		if override.RequestsPerSecond != 0 {
+			quota.RequestsPerSecond = override.RequestsPerSecond
+		}
+		if override.RequestBurst != 0 {
+			quota.RequestBurst = override.RequestBurst
+		}
+		if override.BandwidthKBps != 0 {
+			quota.BandwidthKBps = override.BandwidthKBps
+		}
+		if override.BandwidthBurstKB != 0 {
+			quota.BandwidthBurstKB = override.BandwidthBurstKB
+		}
+	}
+
+	switch {
+	case quota.RequestsPerSecond < 0:
+		quota.RequestsPerSecond, quota.RequestBurst = 0, 0
+	case quota.RequestsPerSecond == 0:
+		quota.RequestsPerSecond = 500
+	}
+	if quota.RequestsPerSecond > 0 && quota.RequestBurst <= 0 {
+		quota.RequestBurst = max(int(2*quota.RequestsPerSecond), 1)
+	}
+	switch {
+	case quota.BandwidthKBps < 0:
+		quota.BandwidthKBps, quota.BandwidthBurstKB = 0, 0
+	case quota.BandwidthKBps == 0:
+		quota.BandwidthKBps = 64 * 1024
+	}
+	if quota.BandwidthKBps > 0 && quota.BandwidthBurstKB <= 0 {
+		quota.BandwidthBurstKB = quota.BandwidthKBps
+	}
+	return quota
+}
+
+// Cloud providers servers can be provisioned with.
+const (
+	ProviderDigitalOcean = "digitalocean"
+	ProviderAWS          = "aws"
+	ProviderHetzner      = "hetzner"
+)
+
+// InfrastructureConfig holds the cloud accounts redirectors are provisioned in and what is needed to
+// deploy a listener on them. A provider without a section is unavailable.
+type InfrastructureConfig struct {
+	// Private key the TeamServer logs in to its servers with over SSH; generated on first use.
+	// Defaults to "infra_ssh_key"
+	SSHKey string `yaml:"ssh_key,omitempty"`
+	// Listener executable copied to the servers, built for them, e.g. GOOS=linux GOARCH=amd64
+	ListenerBinary string `yaml:"listener_binary,omitempty"`
+	// Address the deployed listeners reach the gRPC bridge at, e.g. the TeamServer's public IP
+	TeamServerHost string `yaml:"teamserver_host,omitempty"`
+	// Seconds a new server may take to boot and accept SSH; defaults to 300
+	ProvisionTimeout int `yaml:"provision_timeout,omitempty"`
+
+	DigitalOcean *CloudProviderConfig `yaml:"digitalocean,omitempty"`
+	AWS          *CloudProviderConfig `yaml:"aws,omitempty"`
+	Hetzner      *CloudProviderConfig `yaml:"hetzner,omitempty"`
+}
+
+// CloudProviderConfig holds the account and server defaults of one cloud provider. Requests may
+// override the region, size and image.
+type CloudProviderConfig struct {
+	// API token of DigitalOcean and Hetzner; the DIGITALOCEAN_TOKEN and HCLOUD_TOKEN environment
+	// variables take precedence. AWS uses its usual configuration: environment, shared config files
+	// or the instance role
+	Token  string `yaml:"token,omitempty"`
+	Region string `yaml:"region,omitempty"` // Region, or Hetzner location
+	Size   string `yaml:"size,omitempty"`   // Droplet size, instance type or Hetzner server type
+	Image  string `yaml:"image,omitempty"`  // Image slug or name; an AMI ID or "resolve:ssm:" parameter on AWS
+	// User the image accepts the SSH key for; defaults to "root", "ubuntu" on AWS
+	SSHUser string `yaml:"ssh_user,omitempty"`
+	// AWS: subnet and security groups of the instances; the account's defaults if empty. The
+	// security groups must allow SSH from the TeamServer and the listener's port
+	SubnetID         string   `yaml:"subnet_id,omitempty"`
+	SecurityGroupIDs []string `yaml:"security_group_ids,omitempty"`
+}
+
+// FileEncryptionConfig holds the master key loot and uploaded files are encrypted with.
+// The key is 32 bytes, base64 or hex encoded; without one, files are stored in plaintext.
+type FileEncryptionConfig struct {
+	KeyFile string `yaml:"key_file,omitempty"` // File holding the key; the SIMC2_FILE_KEY environment variable takes precedence
+	// Refuse to start without a key
+	Required bool `yaml:"required,omitempty"`
+}
+
+// RBACConfig holds role-based access control settings.
+type RBACConfig struct {
+	// Minimum role required to task each command, e.g. "shellcode": "admin".
+	// Commands not listed require the "operator" role.
+	CommandRoles map[string]string `yaml:"command_roles,omitempty"`
+}
+
+// BuilderConfig holds settings for the payload builder.
+type BuilderConfig struct {
+	SourceDir   string `yaml:"source_dir"`             // Root of the SimpleC2 source tree used to build agents
+	OutputDir   string `yaml:"output_dir"`             // Where built payloads are stored
+	GoBinary     string `yaml:"go_binary,omitempty"`     // Optional: Go toolchain to use, defaults to "go"
+	GarbleBinary string `yaml:"garble_binary,omitempty"` // Optional: garble used for obfuscated builds, defaults to "garble"
+	DonutBinary  string `yaml:"donut_binary,omitempty"`  // Optional: donut used to convert EXEs to shellcode, defaults to "donut"
+	DockerImage  string `yaml:"docker_image,omitempty"`  // Optional: Image used for sandboxed builds (must provide garble for obfuscated builds)
+	// Optional: C compilers for cgo formats (e.g. DLL), keyed by "os/arch", e.g. "windows/amd64": "x86_64-w64-mingw32-gcc"
+	CrossCompilers map[string]string `yaml:"cross_compilers,omitempty"`
 }
 
 // DatabaseConfig holds database-specific configuration.
 type DatabaseConfig struct {
-	Type string `yaml:"type"`           // "postgres" or "sqlite"
-	DSN  string `yaml:"dsn,omitempty"`  // Optional: For Postgres
+	Type string `yaml:"type"`           // "sqlite", "postgres" or "mysql" (also for MariaDB)
+	DSN  string `yaml:"dsn,omitempty"`  // Optional: For Postgres and MySQL, see GetDSN
 	Path string `yaml:"path,omitempty"` // Optional: For SQLite
+	// Optional: connection pool; unset values use the defaults of the backend, see the getters
+	MaxOpenConns    int           `yaml:"max_open_conns,omitempty"`
+	MaxIdleConns    int           `yaml:"max_idle_conns,omitempty"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime,omitempty"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time,omitempty"`
+	// Optional: don't apply schema migrations on startup; the TeamServer refuses to start until they are applied with -migrate
+	ManualMigrations bool `yaml:"manual_migrations,omitempty"`
+	// Optional: how long beacons, their pending tasks and issued certificate records are cached for the gRPC hot path; negative disables the cache
+	CacheTTL time.Duration `yaml:"cache_ttl,omitempty"`
 }
 
 // AuthConfig holds authentication-related configuration.
@@ -160,14 +752,702 @@ type AuthConfig struct {
 	APIKey string `yaml:"api_key,omitempty"`
 	// 加密的 API Key - 推荐在生产环境中使用
 	EncryptedAPIKey *EncryptedAPIKey `yaml:"encrypted_api_key,omitempty"`
+	// 首次启动时若数据库中没有任何操作员，将使用以下凭据创建初始管理员账户
+	OperatorUsername string `yaml:"operator_username,omitempty"` // 默认为 "admin"
 	OperatorPassword string `yaml:"operator_password"`
 	// JWT 签名密钥 - 应该从环境变量或独立的密钥文件读取
 	JWTSecret string `yaml:"jwt_secret,omitempty"`
+	// 访问令牌与刷新令牌的有效期，例如 "15m"、"168h"
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl,omitempty"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl,omitempty"`
+	// 本地账户的密码策略
+	PasswordPolicy PasswordPolicyConfig `yaml:"password_policy,omitempty"`
+	// 本地账户密码的哈希算法及参数
+	PasswordHashing PasswordHashingConfig `yaml:"password_hashing,omitempty"`
+	// 可选: 单点登录，与本地密码登录并存
+	OIDC *OIDCConfig `yaml:"oidc,omitempty"`
+	LDAP *LDAPConfig `yaml:"ldap,omitempty"`
+}
+
+// Client certificate modes of the operator API.
+const (
+	ClientCertsOff      = "off"
+	ClientCertsOptional = "optional" // Certificates are accepted alongside passwords and tokens
+	ClientCertsRequired = "required" // Certificates are the only way to log in
+)
+
+// APITLSConfig enables HTTPS for the operator API, optionally with client certificate login.
+type APITLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// "off" (default), "optional" or "required"; the certificate CN is the operator username
+	ClientCerts string `yaml:"client_certs,omitempty"`
+	// CA that operator certificates are checked against; defaults to grpc.certs.ca_cert
+	ClientCA string `yaml:"client_ca,omitempty"`
+}
+
+// ClientCertMode returns the client certificate mode, treating a missing TLS section as "off".
+func (t *APITLSConfig) ClientCertMode() string {
+	if t == nil || t.ClientCerts == "" {
+		return ClientCertsOff
+	}
+	return t.ClientCerts
+}
+
+// PasswordPolicyConfig holds the password rules for local operator accounts.
+type PasswordPolicyConfig struct {
+	MinLength     int  `yaml:"min_length,omitempty"` // Defaults to 12
+	RequireUpper  bool `yaml:"require_upper,omitempty"`
+	RequireLower  bool `yaml:"require_lower,omitempty"`
+	RequireDigit  bool `yaml:"require_digit,omitempty"`
+	RequireSymbol bool `yaml:"require_symbol,omitempty"`
+	// Number of previous passwords that may not be reused; defaults to 5, negative disables the check
+	HistorySize int `yaml:"history_size,omitempty"`
+}
+
+// Password hashing algorithms.
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+)
+
+// PasswordHashingConfig selects how passwords of local accounts are hashed. Hashes made with
+// another algorithm or weaker parameters are upgraded when their operator next logs in.
+type PasswordHashingConfig struct {
+	Algorithm  string `yaml:"algorithm,omitempty"`   // "bcrypt" (default) or "argon2id"
+	BcryptCost int    `yaml:"bcrypt_cost,omitempty"` // Defaults to 10
+	// Argon2id iterations, memory in KiB and parallelism; default to 3, 65536 (64 MiB) and 4
+	Argon2Time     uint32 `yaml:"argon2_time,omitempty"`
+	Argon2MemoryKB uint32 `yaml:"argon2_memory_kb,omitempty"`
+	Argon2Threads  uint8  `yaml:"argon2_threads,omitempty"`
+}
+
+// OIDCConfig holds OpenID Connect single sign-on settings.
+type OIDCConfig struct {
+	IssuerURL     string   `yaml:"issuer_url"`
+	ClientID      string   `yaml:"client_id"`
+	ClientSecret  string   `yaml:"client_secret"`
+	RedirectURL   string   `yaml:"redirect_url"`             // e.g. https://c2.example.com/api/auth/oidc/callback
+	Scopes        []string `yaml:"scopes,omitempty"`         // Defaults to openid, profile, email, groups
+	UsernameClaim string   `yaml:"username_claim,omitempty"` // Defaults to "preferred_username"
+	GroupsClaim   string   `yaml:"groups_claim,omitempty"`   // Defaults to "groups"
+	// Optional: Web UI URL the browser is sent to after login; the token is appended as #token=...
+	UIRedirectURL string `yaml:"ui_redirect_url,omitempty"`
+	// IdP group -> role ("admin", "operator", "read-only"); the highest matching role wins
+	RoleMapping map[string]string `yaml:"role_mapping"`
+	// Role for users without a matching group; empty denies login
+	DefaultRole string `yaml:"default_role,omitempty"`
+}
+
+// LDAPConfig holds LDAP bind authentication settings.
+type LDAPConfig struct {
+	URL                string `yaml:"url"` // e.g. ldaps://dc.example.com:636
+	StartTLS           bool   `yaml:"start_tls,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+	// Service account used to look up users; empty uses an anonymous bind
+	BindDN         string `yaml:"bind_dn,omitempty"`
+	BindPassword   string `yaml:"bind_password,omitempty"`
+	BaseDN         string `yaml:"base_dn"`
+	UserFilter     string `yaml:"user_filter,omitempty"`     // Defaults to "(uid=%s)"; use "(sAMAccountName=%s)" for AD
+	GroupAttribute string `yaml:"group_attribute,omitempty"` // Defaults to "memberOf"
+	// Group DN or CN -> role; the highest matching role wins
+	RoleMapping map[string]string `yaml:"role_mapping"`
+	// Role for users without a matching group; empty denies login
+	DefaultRole string `yaml:"default_role,omitempty"`
+}
+
+// GetAccessTokenTTL 获取访问令牌有效期，默认 15 分钟
+func (a *AuthConfig) GetAccessTokenTTL() time.Duration {
+	if a.AccessTokenTTL > 0 {
+		return a.AccessTokenTTL
+	}
+	return 15 * time.Minute
+}
+
+// GetRefreshTokenTTL 获取刷新令牌有效期，默认 7 天
+func (a *AuthConfig) GetRefreshTokenTTL() time.Duration {
+	if a.RefreshTokenTTL > 0 {
+		return a.RefreshTokenTTL
+	}
+	return 7 * 24 * time.Hour
+}
+
+// GetDispatchTimeout 获取已下发任务等待确认的时间，默认 2 分钟
+func (t *TaskConfig) GetDispatchTimeout() time.Duration {
+	if t.DispatchTimeout > 0 {
+		return time.Duration(t.DispatchTimeout) * time.Second
+	}
+	return 2 * time.Minute
+}
+
+// GetMaxDispatchAttempts 获取未确认任务的最大下发次数，默认 3 次
+func (t *TaskConfig) GetMaxDispatchAttempts() int {
+	if t.MaxDispatchAttempts > 0 {
+		return t.MaxDispatchAttempts
+	}
+	return 3
+}
+
+// GetTimeout 获取命令的执行超时，默认 10 分钟；返回 0 表示不超时
+func (t *TaskConfig) GetTimeout(command string) time.Duration {
+	timeout, ok := t.CommandTimeouts[command]
+	if !ok || timeout == 0 {
+		timeout = t.Timeout
+	}
+	switch {
+	case timeout < 0:
+		return 0
+	case timeout == 0:
+		return 10 * time.Minute
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// GetMaxOutputSize 获取存入数据库的任务输出的最大字节数，默认 256 KB；返回 0 表示不限制
+func (t *TaskConfig) GetMaxOutputSize() int {
+	switch {
+	case t.MaxOutputKB < 0:
+		return 0
+	case t.MaxOutputKB == 0:
+		return 256 * 1024
+	}
+	return t.MaxOutputKB * 1024
+}
+
+// GetOutputPreviewSize 获取存为战利品的任务输出在数据库中保留的预览字节数，默认 4 KB
+func (t *TaskConfig) GetOutputPreviewSize() int {
+	if t.OutputPreviewKB > 0 {
+		return t.OutputPreviewKB * 1024
+	}
+	return 4 * 1024
+}
+
+// GetLateWindows 获取判定 Beacon 迟到的错过心跳窗口数，默认 3
+func (b *BeaconConfig) GetLateWindows() int {
+	if b.LateWindows > 0 {
+		return b.LateWindows
+	}
+	return 3
+}
+
+// GetLostWindows 获取判定 Beacon 丢失的错过心跳窗口数，默认 10
+func (b *BeaconConfig) GetLostWindows() int {
+	if b.LostWindows > 0 {
+		return b.LostWindows
+	}
+	return 10
+}
+
+// GetLastSeenFlush 获取批量写入 Beacon 心跳时间的间隔，默认 5 秒；返回 0 表示每次心跳立即写入
+func (b *BeaconConfig) GetLastSeenFlush() time.Duration {
+	switch {
+	case b.LastSeenFlush < 0:
+		return 0
+	case b.LastSeenFlush == 0:
+		return 5 * time.Second
+	}
+	return time.Duration(b.LastSeenFlush) * time.Second
+}
+
+// GetStatusInterval 获取后台更新 Beacon 状态的间隔，默认 10 秒
+func (b *BeaconConfig) GetStatusInterval() time.Duration {
+	if b.StatusInterval > 0 {
+		return time.Duration(b.StatusInterval) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// GetPongTimeout 获取等待 WebSocket pong 的超时时间，默认 60 秒
+func (w *WebSocketConfig) GetPongTimeout() time.Duration {
+	if w.PongTimeout > 0 {
+		return time.Duration(w.PongTimeout) * time.Second
+	}
+	return 60 * time.Second
+}
+
+// GetPingInterval 获取 WebSocket ping 间隔，默认 30 秒，且始终小于 pong 超时
+func (w *WebSocketConfig) GetPingInterval() time.Duration {
+	interval := 30 * time.Second
+	if w.PingInterval > 0 {
+		interval = time.Duration(w.PingInterval) * time.Second
+	}
+	if pongTimeout := w.GetPongTimeout(); interval >= pongTimeout {
+		interval = pongTimeout * 9 / 10
+	}
+	return interval
+}
+
+// GetWriteTimeout 获取向 WebSocket 客户端写入的超时时间，默认 10 秒
+func (w *WebSocketConfig) GetWriteTimeout() time.Duration {
+	if w.WriteTimeout > 0 {
+		return time.Duration(w.WriteTimeout) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// GetSendBuffer 获取每个 WebSocket 客户端的发送队列长度，默认 256
+func (w *WebSocketConfig) GetSendBuffer() int {
+	if w.SendBuffer > 0 {
+		return w.SendBuffer
+	}
+	return 256
+}
+
+// GetSlowClient 获取发送队列已满时的处理策略，默认断开连接
+func (w *WebSocketConfig) GetSlowClient() string {
+	if w.SlowClient == SlowClientDropOldest {
+		return SlowClientDropOldest
+	}
+	return SlowClientDisconnect
+}
+
+// GetQueueSize 获取等待规则匹配的事件队列长度，默认 1000
+func (n *NotificationConfig) GetQueueSize() int {
+	if n.QueueSize > 0 {
+		return n.QueueSize
+	}
+	return 1000
+}
+
+// GetWebhookTimeout 获取通知 webhook 请求的超时时间，默认 10 秒
+func (n *NotificationConfig) GetWebhookTimeout() time.Duration {
+	if n.WebhookTimeout > 0 {
+		return time.Duration(n.WebhookTimeout) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// GetAddress 获取 SMTP 服务器地址（host:port），端口默认 25，tls 模式为 465，starttls 模式为 587
+func (s *SMTPConfig) GetAddress() string {
+	port := s.Port
+	if port == 0 {
+		switch s.GetTLS() {
+		case SMTPTLSImplicit:
+			port = 465
+		case SMTPTLSStartTLS:
+			port = 587
+		default:
+			port = 25
+		}
+	}
+	return net.JoinHostPort(s.Host, strconv.Itoa(port))
+}
+
+// GetMaxSizeMB 获取日志文件轮转的大小（MB），默认 100
+func (l *LogFileConfig) GetMaxSizeMB() int {
+	if l.MaxSizeMB > 0 {
+		return l.MaxSizeMB
+	}
+	return 100
+}
+
+// GetRotateInterval 获取日志文件按时间轮转的间隔，0 表示只按大小轮转
+func (l *LogFileConfig) GetRotateInterval() time.Duration {
+	if l.RotateHours > 0 {
+		return time.Duration(l.RotateHours) * time.Hour
+	}
+	return 0
+}
+
+// GetProtocol 获取 OTLP 导出协议，默认 grpc
+func (t *TracingConfig) GetProtocol() string {
+	if t.Protocol != "" {
+		return strings.ToLower(t.Protocol)
+	}
+	return OTLPGRPC
+}
+
+// GetSampleRatio 获取采样比例，默认 1（记录所有 trace）
+func (t *TracingConfig) GetSampleRatio() float64 {
+	if t.SampleRatio > 0 && t.SampleRatio < 1 {
+		return t.SampleRatio
+	}
+	return 1
+}
+
+// GetServiceName 获取上报的服务名，默认 simplec2-teamserver
+func (t *TracingConfig) GetServiceName() string {
+	if t.ServiceName != "" {
+		return t.ServiceName
+	}
+	return "simplec2-teamserver"
+}
+
+// GetTLS 获取 SMTP 连接的 TLS 模式，默认 auto（服务器支持时使用 STARTTLS）
+func (s *SMTPConfig) GetTLS() string {
+	if s.TLS != "" {
+		return strings.ToLower(s.TLS)
+	}
+	return SMTPTLSAuto
+}
+
+// GetAuth 获取 SMTP 认证方式，配置了用户名时默认 plain，否则不认证
+func (s *SMTPConfig) GetAuth() string {
+	if s.Auth != "" {
+		return strings.ToLower(s.Auth)
+	}
+	if s.Username != "" {
+		return SMTPAuthPlain
+	}
+	return SMTPAuthNone
+}
+
+// GetPassword 获取 SMTP 密码，优先从密钥源读取，其次读取环境变量 SIMC2_SMTP_PASSWORD
+func (s *SMTPConfig) GetPassword() string {
+	if password, ok := lookupSecret(SecretSMTPPassword); ok {
+		return password
+	}
+	if password := os.Getenv("SIMC2_SMTP_PASSWORD"); password != "" {
+		return password
+	}
+	return s.Password
+}
+
+// GetTimeout 获取发送一封邮件的超时时间，默认 30 秒
+func (s *SMTPConfig) GetTimeout() time.Duration {
+	if s.Timeout > 0 {
+		return time.Duration(s.Timeout) * time.Second
+	}
+	return 30 * time.Second
+}
+
+// GetMaxOutputLength 获取报告中每个任务输出保留的字符数，默认 4000，负数表示不截断
+func (r *ReportConfig) GetMaxOutputLength() int {
+	if r.MaxOutputLength != 0 {
+		return r.MaxOutputLength
+	}
+	return 4000
+}
+
+// GetDSN 获取数据库连接字符串，优先从环境变量 SIMC2_DATABASE_DSN 读取，避免在配置文件中保存数据库密码
+func (d *DatabaseConfig) GetDSN() string {
+	if dsn := os.Getenv("SIMC2_DATABASE_DSN"); dsn != "" {
+		return dsn
+	}
+	return d.DSN
+}
+
+// GetMaxOpenConns 获取最大打开连接数，Postgres / MySQL 默认 25，SQLite 默认不限制
+func (d *DatabaseConfig) GetMaxOpenConns() int {
+	if d.MaxOpenConns > 0 {
+		return d.MaxOpenConns
+	}
+	if d.Type == "sqlite" {
+		return 0
+	}
+	return 25
+}
+
+// GetMaxIdleConns 获取最大空闲连接数，Postgres / MySQL 默认 10，SQLite 默认 2
+func (d *DatabaseConfig) GetMaxIdleConns() int {
+	if d.MaxIdleConns > 0 {
+		return d.MaxIdleConns
+	}
+	if d.Type == "sqlite" {
+		return 2
+	}
+	return 10
+}
+
+// GetConnMaxLifetime 获取连接的最长存活时间，MySQL 默认 3 分钟（早于服务端和代理关闭空闲连接），Postgres 默认 30 分钟，SQLite 默认不限制
+func (d *DatabaseConfig) GetConnMaxLifetime() time.Duration {
+	if d.ConnMaxLifetime > 0 {
+		return d.ConnMaxLifetime
+	}
+	switch d.Type {
+	case "mysql":
+		return 3 * time.Minute
+	case "postgres":
+		return 30 * time.Minute
+	}
+	return 0
+}
+
+// GetCacheTTL 获取 Beacon、待下发任务与证书签发记录缓存的有效期，默认 10 秒；返回 0 表示不缓存
+func (d *DatabaseConfig) GetCacheTTL() time.Duration {
+	switch {
+	case d.CacheTTL < 0:
+		return 0
+	case d.CacheTTL == 0:
+		return 10 * time.Second
+	}
+	return d.CacheTTL
+}
+
+// GetDir 获取备份目录，默认为 "backups"
+func (b *BackupConfig) GetDir() string {
+	if b.Dir != "" {
+		return b.Dir
+	}
+	return "backups"
+}
+
+// GetKeep 获取保留的定时备份数量，默认 7 个
+func (b *BackupConfig) GetKeep() int {
+	if b.Keep > 0 {
+		return b.Keep
+	}
+	return 7
+}
+
+// GetListen 获取 DNS Canary 服务器的 UDP 监听地址，默认 ":53"
+func (d *DNSCanaryConfig) GetListen() string {
+	if d.Listen != "" {
+		return d.Listen
+	}
+	return ":53"
+}
+
+// GetInterval 获取 Listener 外部探测的间隔，默认 60 秒
+func (l *ListenerProbeConfig) GetInterval() time.Duration {
+	if l.Interval > 0 {
+		return time.Duration(l.Interval) * time.Second
+	}
+	return 60 * time.Second
+}
+
+// GetTimeout 获取单次 Listener 探测的超时时间，默认 10 秒
+func (l *ListenerProbeConfig) GetTimeout() time.Duration {
+	if l.Timeout > 0 {
+		return time.Duration(l.Timeout) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// GetHistoryDays 获取 Listener 探测结果的保留天数，默认 7 天
+func (l *ListenerProbeConfig) GetHistoryDays() int {
+	if l.HistoryDays > 0 {
+		return l.HistoryDays
+	}
+	return 7
+}
+
+// GetInterval 获取数据保留策略的执行间隔，默认 24 小时
+func (r *RetentionConfig) GetInterval() time.Duration {
+	if r.IntervalHours > 0 {
+		return time.Duration(r.IntervalHours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// GetOutputLimit 获取 oplog 条目中保留的任务输出字节数，默认 4096
+func (o *OplogConfig) GetOutputLimit() int {
+	if o.OutputLimit > 0 {
+		return o.OutputLimit
+	}
+	return 4096
+}
+
+// GetQueueSize 获取等待导出的 oplog 条目队列长度，默认 10000
+func (o *OplogConfig) GetQueueSize() int {
+	if o.QueueSize > 0 {
+		return o.QueueSize
+	}
+	return 10000
+}
+
+// GetOplogID 获取项目对应的 Ghostwriter oplog ID，0 表示不导出
+func (g *GhostwriterConfig) GetOplogID(engagement string) int {
+	if id, ok := g.EngagementOplogs[engagement]; ok {
+		return id
+	}
+	return g.OplogID
+}
+
+// GetChannel 获取事件总线的 pub/sub 频道，默认 simplec2:events
+func (e *EventBusConfig) GetChannel() string {
+	if e.Channel != "" {
+		return e.Channel
+	}
+	return "simplec2:events"
+}
+
+// GetQueueSize 获取等待发布的事件队列长度，默认 10000
+func (e *EventBusConfig) GetQueueSize() int {
+	if e.QueueSize > 0 {
+		return e.QueueSize
+	}
+	return 10000
+}
+
+// GetType 获取 CA 私钥的存放方式，默认 file
+func (k *CAKeyConfig) GetType() string {
+	if k != nil && k.Type != "" {
+		return k.Type
+	}
+	return CAKeyFile
+}
+
+// GetPIN 获取 PKCS#11 令牌的用户 PIN，优先从环境变量 SIMC2_CA_KEY_PIN 读取
+func (k *CAKeyConfig) GetPIN() string {
+	if pin := os.Getenv("SIMC2_CA_KEY_PIN"); pin != "" {
+		return pin
+	}
+	return k.PIN
+}
+
+// GetRefreshInterval 获取密钥的重新读取间隔，默认 5 分钟
+func (s *SecretsConfig) GetRefreshInterval() time.Duration {
+	if s.RefreshInterval > 0 {
+		return s.RefreshInterval
+	}
+	return 5 * time.Minute
+}
+
+// GetAuthMethod 获取 Vault 的登录方式，默认 token
+func (v *VaultConfig) GetAuthMethod() string {
+	if v.AuthMethod != "" {
+		return v.AuthMethod
+	}
+	return "token"
+}
+
+// GetAuthMount 获取 Vault 登录方式的挂载路径，默认与登录方式同名
+func (v *VaultConfig) GetAuthMount() string {
+	if v.AuthMount != "" {
+		return v.AuthMount
+	}
+	return v.GetAuthMethod()
+}
+
+// GetToken 获取 Vault 令牌，优先从环境变量 VAULT_TOKEN 读取
+func (v *VaultConfig) GetToken() string {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token
+	}
+	return v.Token
+}
+
+// GetSecretID 获取 AppRole 的 secret_id，优先从环境变量 SIMC2_VAULT_SECRET_ID 读取
+func (v *VaultConfig) GetSecretID() string {
+	if secretID := os.Getenv("SIMC2_VAULT_SECRET_ID"); secretID != "" {
+		return secretID
+	}
+	return v.SecretID
+}
+
+// GetMinFreeDisk 获取 loot 和上传目录所在磁盘所需的最小剩余空间（字节），默认 500 MB
+func (h *HealthConfig) GetMinFreeDisk() uint64 {
+	if h.MinFreeDiskMB > 0 {
+		return uint64(h.MinFreeDiskMB) << 20
+	}
+	return 500 << 20
+}
+
+// GetCheckTimeout 获取单项就绪检查的超时时间，默认 5 秒
+func (h *HealthConfig) GetCheckTimeout() time.Duration {
+	if h.CheckTimeout > 0 {
+		return time.Duration(h.CheckTimeout) * time.Second
+	}
+	return 5 * time.Second
+}
+
+// GetQuota 获取 engagement 的 loot 存储配额（字节），0 表示不限制
+func (l *LootConfig) GetQuota(engagement string) int64 {
+	quota, ok := l.EngagementQuotasMB[engagement]
+	if !ok {
+		quota = l.QuotaMB
+	}
+	if quota <= 0 {
+		return 0
+	}
+	return quota * 1024 * 1024
+}
+
+// GetSSHKey 获取 TeamServer 登录服务器所用 SSH 私钥的路径，默认 infra_ssh_key
+func (i *InfrastructureConfig) GetSSHKey() string {
+	if i.SSHKey != "" {
+		return i.SSHKey
+	}
+	return "infra_ssh_key"
+}
+
+// GetProvisionTimeout 获取新服务器启动并接受 SSH 连接的最长等待时间，默认 5 分钟
+func (i *InfrastructureConfig) GetProvisionTimeout() time.Duration {
+	if i.ProvisionTimeout > 0 {
+		return time.Duration(i.ProvisionTimeout) * time.Second
+	}
+	return 5 * time.Minute
+}
+
+// GetProvider 获取某个云服务商的配置，未配置时返回 nil
+func (i *InfrastructureConfig) GetProvider(name string) *CloudProviderConfig {
+	switch name {
+	case ProviderDigitalOcean:
+		return i.DigitalOcean
+	case ProviderAWS:
+		return i.AWS
+	case ProviderHetzner:
+		return i.Hetzner
+	}
+	return nil
+}
+
+// GetToken 获取云服务商的 API 令牌，优先从环境变量 DIGITALOCEAN_TOKEN 或 HCLOUD_TOKEN 读取
+func (c *CloudProviderConfig) GetToken(provider string) string {
+	variable := map[string]string{ProviderDigitalOcean: "DIGITALOCEAN_TOKEN", ProviderHetzner: "HCLOUD_TOKEN"}[provider]
+	if token := os.Getenv(variable); variable != "" && token != "" {
+		return token
+	}
+	return c.Token
+}
+
+// GetSSHUser 获取镜像接受 SSH 密钥的用户，默认 root，AWS 默认 ubuntu
+func (c *CloudProviderConfig) GetSSHUser(provider string) string {
+	if c.SSHUser != "" {
+		return c.SSHUser
+	}
+	if provider == ProviderAWS {
+		return "ubuntu"
+	}
+	return "root"
+}
+
+// GetMasterKey 获取文件加密主密钥，优先从环境变量 SIMC2_FILE_KEY 读取，其次读取 key_file；都未配置时返回空字符串
+func (f *FileEncryptionConfig) GetMasterKey() (string, error) {
+	if key := os.Getenv("SIMC2_FILE_KEY"); key != "" {
+		return key, nil
+	}
+	if f.KeyFile == "" {
+		return "", nil
+	}
+	key, err := os.ReadFile(f.KeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file encryption key: %w", err)
+	}
+	return strings.TrimSpace(string(key)), nil
+}
+
+// GetKey 获取 loot 镜像的加密密钥，优先从环境变量 SIMC2_LOOT_MIRROR_KEY 读取，其次读取 key_file
+func (m *LootMirrorConfig) GetKey() (string, error) {
+	if key := os.Getenv("SIMC2_LOOT_MIRROR_KEY"); key != "" {
+		return key, nil
+	}
+	if m.KeyFile == "" {
+		return "", fmt.Errorf("no loot mirror key configured (set SIMC2_LOOT_MIRROR_KEY or loot.mirror.key_file)")
+	}
+	key, err := os.ReadFile(m.KeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read loot mirror key: %w", err)
+	}
+	return strings.TrimSpace(string(key)), nil
+}
+
+// GetTransitionStorageClass 获取生命周期规则转换到的存储类别，默认 STANDARD_IA
+func (m *LootMirrorConfig) GetTransitionStorageClass() string {
+	if m.TransitionStorageClass != "" {
+		return m.TransitionStorageClass
+	}
+	return "STANDARD_IA"
 }
 
 // GetAPIKey 获取解密后的 API Key，优先使用加密版本
 func (a *AuthConfig) GetAPIKey() (string, error) {
-	// 优先使用加密的 API Key
+	// 密钥源（如 Vault）中的 API Key 优先
+	if apiKey, ok := lookupSecret(SecretAPIKey); ok {
+		return apiKey, nil
+	}
+	// 其次使用加密的 API Key
 	if a.EncryptedAPIKey != nil {
 		return a.EncryptedAPIKey.DecryptAPIKey()
 	}
@@ -225,13 +1505,182 @@ type ListenerConfig struct {
 		CACert     string `yaml:"ca_cert"`
 		PrivateKey string `yaml:"private_key"`
 	} `yaml:"certs"`
+	// Optional: health endpoint (GET /healthz) for load balancers and monitoring
+	Health struct {
+		// e.g. "127.0.0.1:9090"; keep it off the beacon-facing port. Disabled if empty
+		Address string `yaml:"address,omitempty"`
+	} `yaml:"health,omitempty"`
+	// Optional: keepalive, deadlines and retries of the connection to the TeamServer, see the getters
+	GRPC ListenerGRPCConfig `yaml:"grpc,omitempty"`
+	// Optional: limits of the beacon-facing HTTP server, see the getters
+	HTTP ListenerHTTPConfig `yaml:"http,omitempty"`
+	// Optional: log level and outputs; logs to stdout at info by default
+	Logging ListenerLoggingConfig `yaml:"logging,omitempty"`
+}
+
+// ListenerLoggingConfig holds the log level and outputs of a listener.
+type ListenerLoggingConfig struct {
+	Level string `yaml:"level,omitempty"` // "debug", "info" (default), "warn" or "error"
+	// Optional: also write the log to a rotated file
+	File *LogFileConfig `yaml:"file,omitempty"`
+	// Optional: also send the log to the TeamServer over the control channel
+	Remote *ListenerRemoteLogConfig `yaml:"remote,omitempty"`
+}
+
+// ListenerRemoteLogConfig holds which log entries of a listener are sent to the TeamServer.
+type ListenerRemoteLogConfig struct {
+	// Lowest level sent; defaults to the listener's level. Entries below Level aren't logged at all
+	Level string `yaml:"level,omitempty"`
+	// Entries kept while the control channel is down; the oldest are dropped beyond it
+	BufferSize int `yaml:"buffer_size,omitempty"`
+}
+
+// ListenerHTTPConfig bounds the work and memory beacon requests can take on an HTTP listener.
+type ListenerHTTPConfig struct {
+	MaxConcurrent int           `yaml:"max_concurrent,omitempty"` // Requests handled at the same time; negative is unlimited
+	QueueTimeout  time.Duration `yaml:"queue_timeout,omitempty"`  // How long a request waits for its turn before it gets a 503
+	MaxBodyKB     int64         `yaml:"max_body_kb,omitempty"`    // Largest request body, except task outputs
+	MaxOutputMB   int64         `yaml:"max_output_mb,omitempty"`  // Largest task output body
+	ReadTimeout   time.Duration `yaml:"read_timeout,omitempty"`   // Time to read a whole request
+	WriteTimeout  time.Duration `yaml:"write_timeout,omitempty"`  // Time from the end of the request headers to the end of the response
+	IdleTimeout   time.Duration `yaml:"idle_timeout,omitempty"`   // Time a keep-alive connection may sit idle
+}
+
+// GetMaxConcurrent 获取同时处理的请求数上限，默认 256；返回 0 表示不限制
+func (h *ListenerHTTPConfig) GetMaxConcurrent() int {
+	switch {
+	case h.MaxConcurrent < 0:
+		return 0
+	case h.MaxConcurrent == 0:
+		return 256
+	}
+	return h.MaxConcurrent
+}
+
+// GetQueueTimeout 获取请求排队等待处理的最长时间，默认 5 秒
+func (h *ListenerHTTPConfig) GetQueueTimeout() time.Duration {
+	if h.QueueTimeout <= 0 {
+		return 5 * time.Second
+	}
+	return h.QueueTimeout
+}
+
+// GetMaxBodySize 获取请求体大小上限（字节，不含任务输出），默认 1 MB
+func (h *ListenerHTTPConfig) GetMaxBodySize() int64 {
+	if h.MaxBodyKB <= 0 {
+		return 1024 * 1024
+	}
+	return h.MaxBodyKB * 1024
+}
+
+// GetMaxOutputSize 获取任务输出请求体大小上限（字节），默认 64 MB
+func (h *ListenerHTTPConfig) GetMaxOutputSize() int64 {
+	if h.MaxOutputMB <= 0 {
+		return 64 * 1024 * 1024
+	}
+	return h.MaxOutputMB * 1024 * 1024
+}
+
+// GetReadTimeout 获取读取整个请求的超时时间，默认 30 秒
+func (h *ListenerHTTPConfig) GetReadTimeout() time.Duration {
+	if h.ReadTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return h.ReadTimeout
+}
+
+// GetWriteTimeout 获取写完响应的超时时间，默认 60 秒（需长于心跳长轮询的 30 秒）
+func (h *ListenerHTTPConfig) GetWriteTimeout() time.Duration {
+	if h.WriteTimeout <= 0 {
+		return 60 * time.Second
+	}
+	return h.WriteTimeout
+}
+
+// GetIdleTimeout 获取 keep-alive 连接的空闲超时时间，默认 120 秒
+func (h *ListenerHTTPConfig) GetIdleTimeout() time.Duration {
+	if h.IdleTimeout <= 0 {
+		return 120 * time.Second
+	}
+	return h.IdleTimeout
+}
+
+// ListenerGRPCConfig holds the keepalive, deadline and retry settings of a listener's connection
+// to the TeamServer.
+type ListenerGRPCConfig struct {
+	KeepaliveTime    time.Duration `yaml:"keepalive_time,omitempty"`    // Idle time before the listener pings the TeamServer
+	KeepaliveTimeout time.Duration `yaml:"keepalive_timeout,omitempty"` // Time to wait for the ping's answer before the connection is dropped
+	CallTimeout      time.Duration `yaml:"call_timeout,omitempty"`      // Deadline of a call on behalf of a beacon
+	MaxRetries       int           `yaml:"max_retries,omitempty"`       // Retries of idempotent calls failing with UNAVAILABLE; negative disables
+	StatusInterval   time.Duration `yaml:"status_interval,omitempty"`   // Interval of the status heartbeat on the control channel
+}
+
+// GetKeepaliveTime 获取连接空闲多久后发送 keepalive ping，默认 30 秒，最小 10 秒
+func (g *ListenerGRPCConfig) GetKeepaliveTime() time.Duration {
+	if g.KeepaliveTime == 0 {
+		return 30 * time.Second
+	}
+	return max(g.KeepaliveTime, 10*time.Second)
+}
+
+// GetKeepaliveTimeout 获取等待 keepalive ping 响应的超时时间，默认 10 秒，超时后断开连接并重连
+func (g *ListenerGRPCConfig) GetKeepaliveTimeout() time.Duration {
+	if g.KeepaliveTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return g.KeepaliveTimeout
+}
+
+// GetCallTimeout 获取代 Beacon 发起的 gRPC 调用的超时时间，默认 5 秒
+func (g *ListenerGRPCConfig) GetCallTimeout() time.Duration {
+	if g.CallTimeout <= 0 {
+		return 5 * time.Second
+	}
+	return g.CallTimeout
+}
+
+// GetMaxRetries 获取幂等调用因 UNAVAILABLE 失败时的重试次数，默认 3 次，最多 4 次；返回 0 表示不重试
+func (g *ListenerGRPCConfig) GetMaxRetries() int {
+	switch {
+	case g.MaxRetries < 0:
+		return 0
+	case g.MaxRetries == 0:
+		return 3
+	}
+	return min(g.MaxRetries, 4)
+}
+
+// GetStatusInterval 获取通过控制通道上报状态的间隔，默认 30 秒
+func (g *ListenerGRPCConfig) GetStatusInterval() time.Duration {
+	if g.StatusInterval <= 0 {
+		return 30 * time.Second
+	}
+	return g.StatusInterval
+}
+
+// GetBufferSize 获取控制通道断开时缓存的待发送日志条数，默认 1000
+func (r *ListenerRemoteLogConfig) GetBufferSize() int {
+	if r.BufferSize <= 0 {
+		return 1000
+	}
+	return r.BufferSize
 }
 
 // LoadConfig reads a YAML file from the given path and unmarshals it into the provided config struct.
+// An encrypted file is decrypted with the master key from SIMC2_CONFIG_KEY or the terminal.
 func LoadConfig(path string, config interface{}) error {
 	file, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
+	if IsEncryptedConfig(file) {
+		key, err := GetConfigKey(false)
+		if err != nil {
+			return err
+		}
+		if file, err = DecryptConfig(file, key); err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", path, err)
+		}
+	}
 	return yaml.Unmarshal(file, config)
 }
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigKeyEnv is the environment variable holding the master key of encrypted configuration
+// files. When it is not set the key is prompted for on the terminal.
+const ConfigKeyEnv = "SIMC2_CONFIG_KEY"
+
+// Argon2id parameters of newly encrypted configuration files.
+const (
+	configKDFTime    = 3
+	configKDFMemory  = 64 * 1024 // KiB
+	configKDFThreads = 4
+)
+
+// ErrWrongConfigKey is returned when an encrypted configuration file cannot be decrypted.
+var ErrWrongConfigKey = errors.New("wrong master key or corrupted configuration file")
+
+// EncryptedConfig is a configuration file encrypted as a whole. The master key is stretched with
+// Argon2id and the YAML document is sealed with AES-256-GCM, so the file reveals nothing but its
+// size.
+type EncryptedConfig struct {
+	Version    int    `yaml:"version"`
+	KDF        string `yaml:"kdf"` // "argon2id"
+	Time       uint32 `yaml:"time"`
+	Memory     uint32 `yaml:"memory"` // KiB
+	Threads    uint8  `yaml:"threads"`
+	Salt       string `yaml:"salt"`
+	Nonce      string `yaml:"nonce"`
+	Ciphertext string `yaml:"ciphertext"`
+}
+
+// encryptedConfigFile is the layout of an encrypted configuration file.
+type encryptedConfigFile struct {
+	Encrypted *EncryptedConfig `yaml:"simplec2_encrypted_config"`
+}
+
+// promptedKey is the master key entered on the terminal, see ConfigKeyEnviron.
+var promptedKey string
+
+// IsEncryptedConfig reports whether a configuration file is encrypted.
+func IsEncryptedConfig(data []byte) bool {
+	var file encryptedConfigFile
+	return yaml.Unmarshal(data, &file) == nil && file.Encrypted != nil
+}
+
+// EncryptConfig encrypts a YAML configuration with a master key.
+func EncryptConfig(plaintext []byte, masterKey string) ([]byte, error) {
+	if masterKey == "" {
+		return nil, fmt.Errorf("master key is empty")
+	}
+	if IsEncryptedConfig(plaintext) {
+		return nil, fmt.Errorf("configuration is already encrypted")
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(plaintext, &doc); err != nil {
+		return nil, fmt.Errorf("configuration is not valid YAML: %w", err)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	enc := &EncryptedConfig{
+		Version: 1,
+		KDF:     "argon2id",
+		Time:    configKDFTime,
+		Memory:  configKDFMemory,
+		Threads: configKDFThreads,
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+	}
+	gcm, err := enc.cipher(masterKey, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	enc.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	enc.Ciphertext = base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, nil))
+
+	data, err := yaml.Marshal(&encryptedConfigFile{Encrypted: enc})
+	if err != nil {
+		return nil, err
+	}
+	header := []byte("# Encrypted SimpleC2 configuration, decrypt it with -decrypt-config\n")
+	return append(header, data...), nil
+}
+
+// DecryptConfig decrypts a configuration encrypted with EncryptConfig.
+func DecryptConfig(data []byte, masterKey string) ([]byte, error) {
+	var file encryptedConfigFile
+	if err := yaml.Unmarshal(data, &file); err != nil || file.Encrypted == nil {
+		return nil, fmt.Errorf("configuration is not encrypted")
+	}
+	enc := file.Encrypted
+	if enc.Version != 1 || enc.KDF != "argon2id" {
+		return nil, fmt.Errorf("unsupported encrypted configuration (version %d, kdf '%s')", enc.Version, enc.KDF)
+	}
+	salt, err := base64.StdEncoding.DecodeString(enc.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(enc.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(enc.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	gcm, err := enc.cipher(masterKey, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(nonce))
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongConfigKey
+	}
+	return plaintext, nil
+}
+
+// cipher derives the AES-256-GCM cipher of a master key.
+func (e *EncryptedConfig) cipher(masterKey string, salt []byte) (cipher.AEAD, error) {
+	// Bound the parameters so that a tampered file cannot make the loader allocate without limit
+	if e.Time == 0 || e.Time > 100 || e.Threads == 0 || e.Memory < 8*uint32(e.Threads) || e.Memory > 4*1024*1024 {
+		return nil, fmt.Errorf("invalid argon2id parameters")
+	}
+	if len(salt) < 8 {
+		return nil, fmt.Errorf("invalid salt size %d", len(salt))
+	}
+	key := argon2.IDKey([]byte(masterKey), salt, e.Time, e.Memory, e.Threads, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// GetConfigKey 获取配置文件的主密钥，优先从环境变量 SIMC2_CONFIG_KEY 读取，否则在终端提示输入；confirm 为 true 时要求输入两次
+func GetConfigKey(confirm bool) (string, error) {
+	if key := os.Getenv(ConfigKeyEnv); key != "" {
+		return key, nil
+	}
+	if promptedKey != "" {
+		return promptedKey, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("configuration master key required: set %s", ConfigKeyEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Configuration master key: ")
+	key, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read master key: %w", err)
+	}
+	if len(key) == 0 {
+		return "", fmt.Errorf("master key is empty")
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat master key: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read master key: %w", err)
+		}
+		if !bytes.Equal(key, again) {
+			return "", fmt.Errorf("master keys do not match")
+		}
+	}
+	promptedKey = string(key)
+	return promptedKey, nil
+}
+
+// ConfigKeyEnviron returns the environment a restarted process needs to decrypt the configuration
+// without prompting again: the master key, if it was entered on the terminal.
+func ConfigKeyEnviron() []string {
+	if promptedKey == "" || os.Getenv(ConfigKeyEnv) != "" {
+		return nil
+	}
+	return []string{ConfigKeyEnv + "=" + promptedKey}
+}
+
+// EncryptConfigFile encrypts a configuration file in place.
+func EncryptConfigFile(path string) error {
+	plaintext, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if IsEncryptedConfig(plaintext) {
+		return fmt.Errorf("%s is already encrypted", path)
+	}
+	key, err := GetConfigKey(true)
+	if err != nil {
+		return err
+	}
+	data, err := EncryptConfig(plaintext, key)
+	if err != nil {
+		return err
+	}
+	return replaceFile(path, data)
+}
+
+// DecryptConfigFile decrypts a configuration file in place.
+func DecryptConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !IsEncryptedConfig(data) {
+		return fmt.Errorf("%s is not encrypted", path)
+	}
+	key, err := GetConfigKey(false)
+	if err != nil {
+		return err
+	}
+	plaintext, err := DecryptConfig(data, key)
+	if err != nil {
+		return err
+	}
+	return replaceFile(path, plaintext)
+}
+
+// replaceFile atomically replaces the content of a file, readable by its owner only.
+func replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testConfig = "server:\n  port: 8080\ndatabase:\n  type: sqlite\n  path: data/simplec2.db\n"
+
+// encryptTestConfig encrypts testConfig with the passphrase.
+func encryptTestConfig(t *testing.T, passphrase string) []byte {
+	t.Helper()
+	data, err := EncryptConfig([]byte(testConfig), passphrase)
+	if err != nil {
+		t.Fatalf("EncryptConfig: %v", err)
+	}
+	return data
+}
+
+// editHeader rewrites the header fields of an encrypted configuration.
+func editHeader(t *testing.T, data []byte, edit func(*EncryptedConfig)) []byte {
+	t.Helper()
+	var file encryptedConfigFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		t.Fatalf("failed to parse encrypted configuration: %v", err)
+	}
+	edit(file.Encrypted)
+	edited, err := yaml.Marshal(&file)
+	if err != nil {
+		t.Fatalf("failed to write encrypted configuration: %v", err)
+	}
+	return edited
+}
+
+// TestConfigEncryptionRoundTrip tests that an encrypted configuration decrypts to the original
+// document and reveals none of it.
+func TestConfigEncryptionRoundTrip(t *testing.T) {
+	data := encryptTestConfig(t, "correct horse")
+	if !IsEncryptedConfig(data) || IsEncryptedConfig([]byte(testConfig)) {
+		t.Fatalf("IsEncryptedConfig does not tell the encrypted configuration apart")
+	}
+	if strings.Contains(string(data), "sqlite") || strings.Contains(string(data), "8080") {
+		t.Fatalf("encrypted configuration contains plaintext:\n%s", data)
+	}
+
+	plaintext, err := DecryptConfig(data, "correct horse")
+	if err != nil {
+		t.Fatalf("DecryptConfig: %v", err)
+	}
+	if string(plaintext) != testConfig {
+		t.Fatalf("decrypted configuration differs:\n%s", plaintext)
+	}
+
+	if _, err := EncryptConfig(data, "correct horse"); err == nil {
+		t.Fatalf("an encrypted configuration was encrypted again")
+	}
+	if _, err := EncryptConfig([]byte(testConfig), ""); err == nil {
+		t.Fatalf("configuration encrypted with an empty key")
+	}
+	if _, err := DecryptConfig([]byte(testConfig), "correct horse"); err == nil {
+		t.Fatalf("plaintext configuration decrypted")
+	}
+}
+
+// TestConfigEncryptionWrongKey tests that a wrong passphrase or a changed ciphertext is reported as
+// ErrWrongConfigKey.
+func TestConfigEncryptionWrongKey(t *testing.T) {
+	data := encryptTestConfig(t, "correct horse")
+	if _, err := DecryptConfig(data, "correct h0rse"); !errors.Is(err, ErrWrongConfigKey) {
+		t.Fatalf("expected ErrWrongConfigKey for a wrong passphrase, got %v", err)
+	}
+
+	// Another salt derives another key
+	resalted := editHeader(t, data, func(enc *EncryptedConfig) {
+		enc.Salt = "AAAAAAAAAAAAAAAAAAAAAA=="
+	})
+	if _, err := DecryptConfig(resalted, "correct horse"); !errors.Is(err, ErrWrongConfigKey) {
+		t.Fatalf("expected ErrWrongConfigKey for a changed salt, got %v", err)
+	}
+	tampered := editHeader(t, data, func(enc *EncryptedConfig) {
+		ciphertext, err := base64.StdEncoding.DecodeString(enc.Ciphertext)
+		if err != nil {
+			t.Fatalf("invalid ciphertext: %v", err)
+		}
+		ciphertext[0] ^= 0x01
+		enc.Ciphertext = base64.StdEncoding.EncodeToString(ciphertext)
+	})
+	if _, err := DecryptConfig(tampered, "correct horse"); !errors.Is(err, ErrWrongConfigKey) {
+		t.Fatalf("expected ErrWrongConfigKey for a changed ciphertext, got %v", err)
+	}
+}
+
+// TestConfigEncryptionHeaderBounds tests that KDF parameters out of range in the header are rejected
+// before a key is derived with them, so a tampered file can't make the loader spin or allocate
+// without limit.
+func TestConfigEncryptionHeaderBounds(t *testing.T) {
+	data := encryptTestConfig(t, "correct horse")
+
+	headers := map[string]func(*EncryptedConfig){
+		"zero iterations":     func(enc *EncryptedConfig) { enc.Time = 0 },
+		"too many iterations": func(enc *EncryptedConfig) { enc.Time = 1 << 30 },
+		"zero memory":         func(enc *EncryptedConfig) { enc.Memory = 0 },
+		"memory below 8 KiB per thread": func(enc *EncryptedConfig) {
+			enc.Memory, enc.Threads = 16, 4
+		},
+		"too much memory":     func(enc *EncryptedConfig) { enc.Memory = 1 << 31 },
+		"zero threads":        func(enc *EncryptedConfig) { enc.Threads = 0 },
+		"short salt":          func(enc *EncryptedConfig) { enc.Salt = "AAAA" },
+		"invalid salt":        func(enc *EncryptedConfig) { enc.Salt = "!!!" },
+		"short nonce":         func(enc *EncryptedConfig) { enc.Nonce = "AAAA" },
+		"unsupported version": func(enc *EncryptedConfig) { enc.Version = 2 },
+		"unsupported kdf":     func(enc *EncryptedConfig) { enc.KDF = "scrypt" },
+	}
+	for name, edit := range headers {
+		_, err := DecryptConfig(editHeader(t, data, edit), "correct horse")
+		if err == nil || errors.Is(err, ErrWrongConfigKey) {
+			t.Fatalf("%s: expected the header to be rejected, got %v", name, err)
+		}
+	}
+
+	// Threads don't fit the header field beyond 255
+	if _, err := DecryptConfig([]byte(strings.Replace(string(data), "threads: 4", "threads: 256", 1)), "correct horse"); err == nil {
+		t.Fatalf("threads out of range accepted")
+	}
+}
+
+// TestConfigFileEncryption tests encrypting and decrypting a configuration file in place with the
+// key from the environment.
+func TestConfigFileEncryption(t *testing.T) {
+	t.Setenv(ConfigKeyEnv, "correct horse")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0644); err != nil {
+		t.Fatalf("failed to write configuration: %v", err)
+	}
+
+	if err := EncryptConfigFile(path); err != nil {
+		t.Fatalf("EncryptConfigFile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read configuration: %v", err)
+	}
+	if !IsEncryptedConfig(data) {
+		t.Fatalf("configuration file not encrypted")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("encrypted configuration is not readable by its owner only: %v", err)
+	}
+	if err := EncryptConfigFile(path); err == nil {
+		t.Fatalf("configuration file encrypted twice")
+	}
+
+	if err := DecryptConfigFile(path); err != nil {
+		t.Fatalf("DecryptConfigFile: %v", err)
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read configuration: %v", err)
+	}
+	if string(data) != testConfig {
+		t.Fatalf("decrypted configuration file differs:\n%s", data)
+	}
+}
@@ -13,6 +13,13 @@ const (
 	ChunkSize = 1024 * 1024 // 1MB
 )
 
+// Range of the sleep command arguments, checked by the TeamServer before tasking and by the agent
+const (
+	MinSleep  = 1    // Seconds
+	MaxSleep  = 3600 // Seconds
+	MaxJitter = 99   // Percentage
+)
+
 var ValidCommands = map[string]struct{}{
 	CmdShell:    {},
 	CmdSleep:    {},
@@ -0,0 +1,167 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Components whose level can be set apart from the global level.
+const (
+	ComponentAPI       = "api"       // HTTP API and WebSocket handlers
+	ComponentGRPC      = "grpc"      // Listener bridge
+	ComponentHub       = "hub"       // WebSocket hub
+	ComponentServices  = "services"  // Business logic
+	ComponentListeners = "listeners" // Log entries sent by the listeners
+)
+
+// Components lists the known components.
+var Components = []string{ComponentAPI, ComponentGRPC, ComponentHub, ComponentServices, ComponentListeners}
+
+// IsComponent reports whether name is a known component.
+func IsComponent(name string) bool {
+	for _, component := range Components {
+		if component == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error". An empty level is "info".
+func ParseLevel(level string) (zapcore.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return zapcore.DebugLevel, nil
+	case "", "info":
+		return zapcore.InfoLevel, nil
+	case "warn", "warning":
+		return zapcore.WarnLevel, nil
+	case "error":
+		return zapcore.ErrorLevel, nil
+	}
+	return zapcore.InfoLevel, fmt.Errorf("invalid log level '%s' (must be 'debug', 'info', 'warn' or 'error')", level)
+}
+
+// levelTable holds the global level and the component overrides; they change at runtime.
+type levelTable struct {
+	mu         sync.RWMutex
+	global     zapcore.Level
+	components map[string]zapcore.Level
+	// Lowest of all levels: entries below it are dropped before the caller is looked up
+	min zapcore.Level
+}
+
+var levels = &levelTable{components: map[string]zapcore.Level{}}
+
+func (t *levelTable) set(global zapcore.Level, components map[string]zapcore.Level) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.global = global
+	t.components = components
+	t.updateMin()
+}
+
+func (t *levelTable) updateMin() {
+	t.min = t.global
+	for _, level := range t.components {
+		if level < t.min {
+			t.min = level
+		}
+	}
+}
+
+func (t *levelTable) enabled(level zapcore.Level) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return level >= t.min
+}
+
+func (t *levelTable) of(component string) zapcore.Level {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if level, ok := t.components[component]; ok {
+		return level
+	}
+	return t.global
+}
+
+// Levels returns the global level and the component overrides.
+func Levels() (string, map[string]string) {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+	components := make(map[string]string, len(levels.components))
+	for component, level := range levels.components {
+		components[component] = level.String()
+	}
+	return levels.global.String(), components
+}
+
+// SetLevel changes the level of a component, or the global level if component is "". An empty
+// level removes the override of a component, which then follows the global level again.
+func SetLevel(component, level string) error {
+	if component != "" && !IsComponent(component) {
+		return fmt.Errorf("unknown log component '%s' (must be one of %s)", component, strings.Join(Components, ", "))
+	}
+	if component == "" && level == "" {
+		return fmt.Errorf("log level is required")
+	}
+	var parsed zapcore.Level
+	if level != "" {
+		var err error
+		if parsed, err = ParseLevel(level); err != nil {
+			return err
+		}
+	}
+
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	switch {
+	case component == "":
+		levels.global = parsed
+	case level == "":
+		delete(levels.components, component)
+	default:
+		levels.components[component] = parsed
+	}
+	levels.updateMin()
+	return nil
+}
+
+// componentCore filters entries by the level of the component they were logged from, which is
+// only known once the caller is, and names the logger after it.
+type componentCore struct {
+	zapcore.Core
+	componentOf func(file string) string
+}
+
+func (c *componentCore) Enabled(level zapcore.Level) bool {
+	return levels.enabled(level)
+}
+
+func (c *componentCore) With(fields []zapcore.Field) zapcore.Core {
+	return &componentCore{Core: c.Core.With(fields), componentOf: c.componentOf}
+}
+
+func (c *componentCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *componentCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	var component string
+	if entry.Caller.Defined {
+		component = c.componentOf(entry.Caller.File)
+	}
+	if entry.Level < levels.of(component) {
+		return nil
+	}
+	if entry.LoggerName == "" {
+		entry.LoggerName = component
+	}
+	return c.Core.Write(entry, fields)
+}
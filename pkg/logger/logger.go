@@ -1,6 +1,13 @@
 package logger
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -10,23 +17,62 @@ var (
 	globalLogger *zap.Logger
 	// sugarLogger is the sugared version of the global logger for convenience
 	sugarLogger *zap.SugaredLogger
+	// callerLogger and callerSugar skip the wrappers of this package when recording the caller,
+	// which is what the component of an entry is told by
+	callerLogger *zap.Logger
+	callerSugar  *zap.SugaredLogger
+	// fileRotator is the log file being written, if any
+	fileRotator *rotator
 )
 
-// Init initializes the global logger with the specified log level
+// Options configures the level and outputs of the global logger.
+type Options struct {
+	Level string
+	// Levels of components overriding Level, e.g. "api" -> "debug"
+	Components map[string]string
+	// Optional: also write to a rotated file
+	File *FileOptions
+	// Don't write to stdout; only applies when File is set
+	FileOnly bool
+	// Optional: more outputs, e.g. sending entries elsewhere. They get the entries passing the
+	// levels and can drop more
+	Outputs []zapcore.Core
+	// ComponentOf returns the component of the source file an entry was logged from, or "" if it
+	// doesn't belong to one
+	ComponentOf func(file string) string
+}
+
+// FileOptions configures the log file and when it is rotated.
+type FileOptions struct {
+	Path       string
+	MaxSizeMB  int  // Rotate when the file reaches this size
+	MaxBackups int  // Rotated files kept; 0 keeps all
+	MaxAgeDays int  // Rotated files older than this are deleted; 0 keeps them
+	Compress   bool // Gzip rotated files
+	// Also rotate at this interval, e.g. daily; 0 only rotates by size
+	RotateInterval time.Duration
+}
+
+// Init initializes the global logger with the specified log level, writing to stdout
 func Init(level string) error {
-	// Parse log level
-	var zapLevel zapcore.Level
-	switch level {
-	case "debug":
-		zapLevel = zapcore.DebugLevel
-	case "info":
-		zapLevel = zapcore.InfoLevel
-	case "warn":
-		zapLevel = zapcore.WarnLevel
-	case "error":
-		zapLevel = zapcore.ErrorLevel
-	default:
-		zapLevel = zapcore.InfoLevel
+	return Configure(Options{Level: level})
+}
+
+// Configure replaces the global logger with one writing to the configured outputs at the
+// configured levels. Levels can be changed later with SetLevel.
+func Configure(opts Options) error {
+	defaultLevel, err := ParseLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+	components := make(map[string]zapcore.Level, len(opts.Components))
+	for component, level := range opts.Components {
+		if !IsComponent(component) {
+			return fmt.Errorf("unknown log component '%s' (must be one of %s)", component, strings.Join(Components, ", "))
+		}
+		if components[component], err = ParseLevel(level); err != nil {
+			return err
+		}
 	}
 
 	// Create encoder config
@@ -44,29 +90,39 @@ func Init(level string) error {
 		EncodeDuration: zapcore.SecondsDurationEncoder,
 		EncodeCaller:   zapcore.ShortCallerEncoder,
 	}
+	encoder := zapcore.NewJSONEncoder(encoderConfig)
 
-	// Create config
-	config := zap.Config{
-		Level:             zap.NewAtomicLevelAt(zapLevel),
-		Development:       false,
-		DisableCaller:     false,
-		DisableStacktrace: true,
-		Sampling:          nil,
-		Encoding:          "json",
-		EncoderConfig:     encoderConfig,
-		OutputPaths:       []string{"stdout"},
-		ErrorOutputPaths:  []string{"stderr"},
-		InitialFields:     nil,
+	// Levels are checked by componentCore, the outputs write whatever reaches them
+	var outputs []zapcore.Core
+	if opts.File == nil || !opts.FileOnly {
+		outputs = append(outputs, zapcore.NewCore(encoder, zapcore.Lock(os.Stdout), zapcore.DebugLevel))
 	}
+	var file *rotator
+	if opts.File != nil {
+		if file, err = newRotator(opts.File); err != nil {
+			return err
+		}
+		outputs = append(outputs, zapcore.NewCore(encoder.Clone(), zapcore.AddSync(file), zapcore.DebugLevel))
+	}
+	outputs = append(outputs, opts.Outputs...)
 
-	// Build logger
-	logger, err := config.Build()
-	if err != nil {
-		return err
+	componentOf := opts.ComponentOf
+	if componentOf == nil {
+		componentOf = func(string) string { return "" }
 	}
+	levels.set(defaultLevel, components)
+	core := &componentCore{Core: zapcore.NewTee(outputs...), componentOf: componentOf}
+	logger := zap.New(core, zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr)))
 
+	previous := fileRotator
 	globalLogger = logger
 	sugarLogger = globalLogger.Sugar()
+	callerLogger = globalLogger.WithOptions(zap.AddCallerSkip(1))
+	callerSugar = callerLogger.Sugar()
+	fileRotator = file
+	if previous != nil {
+		previous.Close()
+	}
 	return nil
 }
 
@@ -80,71 +136,71 @@ func Sync() error {
 
 // Debug logs a debug message with the given key-value pairs
 func Debug(msg string, fields ...zap.Field) {
-	if globalLogger != nil {
-		globalLogger.Debug(msg, fields...)
+	if callerLogger != nil {
+		callerLogger.Debug(msg, fields...)
 	}
 }
 
 // Debugf logs a formatted debug message
 func Debugf(template string, args ...interface{}) {
-	if sugarLogger != nil {
-		sugarLogger.Debugf(template, args...)
+	if callerSugar != nil {
+		callerSugar.Debugf(template, args...)
 	}
 }
 
 // Info logs an info message with the given key-value pairs
 func Info(msg string, fields ...zap.Field) {
-	if globalLogger != nil {
-		globalLogger.Info(msg, fields...)
+	if callerLogger != nil {
+		callerLogger.Info(msg, fields...)
 	}
 }
 
 // Infof logs a formatted info message
 func Infof(template string, args ...interface{}) {
-	if sugarLogger != nil {
-		sugarLogger.Infof(template, args...)
+	if callerSugar != nil {
+		callerSugar.Infof(template, args...)
 	}
 }
 
 // Warn logs a warning message with the given key-value pairs
 func Warn(msg string, fields ...zap.Field) {
-	if globalLogger != nil {
-		globalLogger.Warn(msg, fields...)
+	if callerLogger != nil {
+		callerLogger.Warn(msg, fields...)
 	}
 }
 
 // Warnf logs a formatted warning message
 func Warnf(template string, args ...interface{}) {
-	if sugarLogger != nil {
-		sugarLogger.Warnf(template, args...)
+	if callerSugar != nil {
+		callerSugar.Warnf(template, args...)
 	}
 }
 
 // Error logs an error message with the given key-value pairs
 func Error(msg string, fields ...zap.Field) {
-	if globalLogger != nil {
-		globalLogger.Error(msg, fields...)
+	if callerLogger != nil {
+		callerLogger.Error(msg, fields...)
 	}
 }
 
 // Errorf logs a formatted error message
 func Errorf(template string, args ...interface{}) {
-	if sugarLogger != nil {
-		sugarLogger.Errorf(template, args...)
+	if callerSugar != nil {
+		callerSugar.Errorf(template, args...)
 	}
 }
 
 // Fatal logs a fatal message and then calls os.Exit(1)
 func Fatal(msg string, fields ...zap.Field) {
-	if globalLogger != nil {
-		globalLogger.Fatal(msg, fields...)
+	if callerLogger != nil {
+		callerLogger.Fatal(msg, fields...)
 	}
 }
 
 // Fatalf logs a formatted fatal message and then calls os.Exit(1)
 func Fatalf(template string, args ...interface{}) {
-	if sugarLogger != nil {
-		sugarLogger.Fatalf(template, args...)
+	if callerSugar != nil {
+		callerSugar.Fatalf(template, args...)
 	}
 }
 
@@ -165,3 +221,33 @@ func GetLogger() *zap.Logger {
 func GetSugar() *zap.SugaredLogger {
 	return sugarLogger
 }
+
+// requestIDKey is the context key of the request ID.
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a context carrying the ID of the API or gRPC request it serves.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by a context, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Ctx returns the sugared logger tagged with the request ID and the trace ID carried by the
+// context, if any.
+func Ctx(ctx context.Context) *zap.SugaredLogger {
+	if sugarLogger == nil {
+		return zap.NewNop().Sugar()
+	}
+	l := sugarLogger
+	if id := RequestID(ctx); id != "" {
+		l = l.With(zap.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		l = l.With(zap.String("trace_id", span.TraceID().String()))
+	}
+	return l
+}
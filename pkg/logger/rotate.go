@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// rotator writes the log file, rotating it by size and, if configured, by age.
+type rotator struct {
+	*lumberjack.Logger
+	stop chan struct{}
+	once sync.Once
+}
+
+func newRotator(opts *FileOptions) (*rotator, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("log file path is required")
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	r := &rotator{
+		Logger: &lumberjack.Logger{
+			Filename:   opts.Path,
+			MaxSize:    opts.MaxSizeMB,
+			MaxBackups: opts.MaxBackups,
+			MaxAge:     opts.MaxAgeDays,
+			Compress:   opts.Compress,
+		},
+		stop: make(chan struct{}),
+	}
+	if opts.RotateInterval > 0 {
+		go r.rotateEvery(opts.RotateInterval)
+	}
+	return r, nil
+}
+
+// rotateEvery rotates the file at a fixed interval, e.g. to keep one file per day.
+func (r *rotator) rotateEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Rotate(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to rotate log file: %v\n", err)
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Close stops the rotation and closes the file.
+func (r *rotator) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	return r.Logger.Close()
+}
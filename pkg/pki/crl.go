@@ -0,0 +1,134 @@
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// CreateCRL creates a certificate revocation list of the given entries, signed by the CA, and
+// returns it PEM encoded. number must grow with every CRL the CA issues.
+func CreateCRL(caCertPEM []byte, caKey crypto.Signer, entries []x509.RevocationListEntry, number *big.Int, nextUpdate time.Time) ([]byte, error) {
+	caCert, err := ParseCertificate(caCertPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA cert: %w", err)
+	}
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    number,
+		ThisUpdate:                time.Now(),
+		NextUpdate:                nextUpdate,
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, crlIssuer(caCert), caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CRL: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), nil
+}
+
+// ParseCRL decodes a PEM or DER encoded CRL and checks that it was signed by the CA.
+func ParseCRL(crlData, caCertPEM []byte) (*x509.RevocationList, error) {
+	caCert, err := ParseCertificate(caCertPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA cert: %w", err)
+	}
+	if block, _ := pem.Decode(crlData); block != nil {
+		crlData = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(crlData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CRL: %w", err)
+	}
+	if err := crl.CheckSignatureFrom(crlIssuer(caCert)); err != nil {
+		return nil, fmt.Errorf("CRL is not signed by the CA: %w", err)
+	}
+	return crl, nil
+}
+
+// crlIssuer returns the CA certificate allowed to sign CRLs. CAs generated before CRL support
+// lack the cRLSign key usage; their key is trusted for CRLs all the same.
+func crlIssuer(caCert *x509.Certificate) *x509.Certificate {
+	if caCert.KeyUsage == 0 || caCert.KeyUsage&x509.KeyUsageCRLSign != 0 {
+		return caCert
+	}
+	issuer := *caCert
+	issuer.KeyUsage |= x509.KeyUsageCRLSign
+	return &issuer
+}
+
+// CRLChecker tells whether certificates are listed in a CRL file, which is read again whenever it
+// changes. A missing file revokes nothing; a file that can't be read or verified keeps the last
+// good list.
+type CRLChecker struct {
+	path   string
+	caCert func() []byte
+
+	mu      sync.Mutex
+	ca      []byte // CA the list was verified with
+	modTime time.Time
+	size    int64
+	revoked map[string]bool // Serial numbers (decimal)
+	err     error           // Why the file was last rejected, if it was
+}
+
+// NewCRLChecker creates a checker for the CRL at path, signed by the CA caCert returns. The CA
+// may change, e.g. when it is rotated; the file is verified again with the new one.
+func NewCRLChecker(path string, caCert func() []byte) *CRLChecker {
+	return &CRLChecker{path: path, caCert: caCert, revoked: make(map[string]bool)}
+}
+
+// IsRevoked reports whether the CRL lists a certificate.
+func (c *CRLChecker) IsRevoked(serialNumber *big.Int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reload()
+	return c.revoked[serialNumber.String()]
+}
+
+// Err returns why the CRL file was last rejected, or nil if the list in use is current.
+func (c *CRLChecker) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reload()
+	return c.err
+}
+
+// reload reads the CRL file if it changed since it was last read. Called with mu held.
+func (c *CRLChecker) reload() {
+	info, err := os.Stat(c.path)
+	if os.IsNotExist(err) {
+		c.revoked, c.modTime, c.size, c.err = make(map[string]bool), time.Time{}, 0, nil
+		return
+	}
+	if err != nil {
+		c.err = fmt.Errorf("failed to read CRL: %w", err)
+		return
+	}
+	caCertPEM := c.caCert()
+	if info.ModTime().Equal(c.modTime) && info.Size() == c.size && bytes.Equal(caCertPEM, c.ca) {
+		return
+	}
+
+	crlData, err := os.ReadFile(c.path)
+	if err != nil {
+		c.err = fmt.Errorf("failed to read CRL: %w", err)
+		return
+	}
+	crl, err := ParseCRL(crlData, caCertPEM)
+	if err != nil {
+		c.err = err
+		return
+	}
+	revoked := make(map[string]bool, len(crl.RevokedCertificateEntries))
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked[entry.SerialNumber.String()] = true
+	}
+	c.revoked, c.ca, c.modTime, c.size, c.err = revoked, caCertPEM, info.ModTime(), info.Size(), nil
+}
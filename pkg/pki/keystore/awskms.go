@@ -0,0 +1,104 @@
+package keystore
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"io"
+
+	"simplec2/pkg/config"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// awsSigningAlgorithms maps keyAlgorithm results to AWS KMS signing algorithms.
+var awsSigningAlgorithms = map[string]map[crypto.Hash]types.SigningAlgorithmSpec{
+	"ECDSA": {
+		crypto.SHA256: types.SigningAlgorithmSpecEcdsaSha256,
+		crypto.SHA384: types.SigningAlgorithmSpecEcdsaSha384,
+		crypto.SHA512: types.SigningAlgorithmSpecEcdsaSha512,
+	},
+	"RSA": {
+		crypto.SHA256: types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+		crypto.SHA384: types.SigningAlgorithmSpecRsassaPkcs1V15Sha384,
+		crypto.SHA512: types.SigningAlgorithmSpecRsassaPkcs1V15Sha512,
+	},
+	"RSA-PSS": {
+		crypto.SHA256: types.SigningAlgorithmSpecRsassaPssSha256,
+		crypto.SHA384: types.SigningAlgorithmSpecRsassaPssSha384,
+		crypto.SHA512: types.SigningAlgorithmSpecRsassaPssSha512,
+	},
+}
+
+// awsSigner signs with an asymmetric AWS KMS key. Credentials come from the usual AWS
+// configuration: environment, shared config files, or the instance or task role.
+type awsSigner struct {
+	client *kms.Client
+	keyID  string
+	public crypto.PublicKey
+}
+
+func openAWSKMS(cfg *config.CAKeyConfig) (*awsSigner, error) {
+	if cfg.KeyID == "" {
+		return nil, fmt.Errorf("awskms CA key needs a key_id")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+
+	var options []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		options = append(options, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	client := kms.NewFromConfig(awsCfg, func(o *kms.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = &cfg.Endpoint
+		}
+	})
+
+	out, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: &cfg.KeyID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key of AWS KMS key '%s': %w", cfg.KeyID, err)
+	}
+	public, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key of AWS KMS key '%s': %w", cfg.KeyID, err)
+	}
+	return &awsSigner{client: client, keyID: cfg.KeyID, public: public}, nil
+}
+
+// Public returns the public key of the KMS key.
+func (s *awsSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs a digest with the KMS key.
+func (s *awsSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	algorithm, hash, err := keyAlgorithm(s.public, opts)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+	out, err := s.client.Sign(ctx, &kms.SignInput{
+		KeyId:            &s.keyID,
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: awsSigningAlgorithms[algorithm][hash],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with AWS KMS key '%s': %w", s.keyID, err)
+	}
+	return out.Signature, nil
+}
+
+// Close does nothing, the client holds no connection of its own.
+func (s *awsSigner) Close() error {
+	return nil
+}
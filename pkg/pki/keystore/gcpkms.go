@@ -0,0 +1,98 @@
+package keystore
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+
+	"simplec2/pkg/config"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/api/option"
+)
+
+// gcpSigner signs with an asymmetric signing key version in Google Cloud KMS. Credentials are the
+// application default credentials. The key version fixes the algorithm; x509 asks for the hash it uses.
+type gcpSigner struct {
+	client  *kms.KeyManagementClient
+	version string
+	public  crypto.PublicKey
+}
+
+func openGCPKMS(cfg *config.CAKeyConfig) (*gcpSigner, error) {
+	if cfg.KeyID == "" {
+		return nil, fmt.Errorf("gcpkms CA key needs a key_id (the key version resource name)")
+	}
+	var options []option.ClientOption
+	if cfg.Endpoint != "" {
+		options = append(options, option.WithEndpoint(cfg.Endpoint))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+	client, err := kms.NewKeyManagementClient(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Cloud KMS client: %w", err)
+	}
+	signer, err := newGCPSigner(ctx, client, cfg.KeyID)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return signer, nil
+}
+
+// newGCPSigner looks up the public key of a key version.
+func newGCPSigner(ctx context.Context, client *kms.KeyManagementClient, version string) (*gcpSigner, error) {
+	out, err := client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: version})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key of Google Cloud KMS key '%s': %w", version, err)
+	}
+	block, _ := pem.Decode([]byte(out.Pem))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode public key of Google Cloud KMS key '%s'", version)
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key of Google Cloud KMS key '%s': %w", version, err)
+	}
+	return &gcpSigner{client: client, version: version, public: public}, nil
+}
+
+// Public returns the public key of the key version.
+func (s *gcpSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs a digest with the key version.
+func (s *gcpSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	_, hash, err := keyAlgorithm(s.public, opts)
+	if err != nil {
+		return nil, err
+	}
+	request := &kmspb.AsymmetricSignRequest{Name: s.version, Digest: &kmspb.Digest{}}
+	switch hash {
+	case crypto.SHA256:
+		request.Digest.Digest = &kmspb.Digest_Sha256{Sha256: digest}
+	case crypto.SHA384:
+		request.Digest.Digest = &kmspb.Digest_Sha384{Sha384: digest}
+	case crypto.SHA512:
+		request.Digest.Digest = &kmspb.Digest_Sha512{Sha512: digest}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+	out, err := s.client.AsymmetricSign(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with Google Cloud KMS key '%s': %w", s.version, err)
+	}
+	return out.Signature, nil
+}
+
+// Close closes the connection to Cloud KMS.
+func (s *gcpSigner) Close() error {
+	return s.client.Close()
+}
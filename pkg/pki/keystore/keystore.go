@@ -0,0 +1,79 @@
+// Package keystore opens the CA private key, from a file, a cloud KMS (AWS, GCP) or a PKCS#11 HSM.
+// It is separate from pkg/pki so that only the TeamServer links the KMS and HSM clients.
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/pki"
+)
+
+// signTimeout bounds a signing call to a KMS or HSM
+const signTimeout = 30 * time.Second
+
+// Open opens the CA key cfg selects (the file ca.key next to the CA certificate if cfg is nil).
+// If the CA certificate exists, the key must belong to it.
+func Open(cfg *config.CAKeyConfig, caCertPath string) (pki.Signer, error) {
+	var signer pki.Signer
+	var err error
+	switch cfg.GetType() {
+	case config.CAKeyFile:
+		path := filepath.Join(filepath.Dir(caCertPath), "ca.key")
+		if cfg != nil && cfg.Path != "" {
+			path = cfg.Path
+		}
+		signer, err = pki.LoadFileSigner(path)
+	case config.CAKeyAWSKMS:
+		signer, err = openAWSKMS(cfg)
+	case config.CAKeyGCPKMS:
+		signer, err = openGCPKMS(cfg)
+	case config.CAKeyPKCS11:
+		signer, err = openPKCS11(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported CA key type '%s'", cfg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	caCertPEM, err := os.ReadFile(caCertPath)
+	if os.IsNotExist(err) {
+		return signer, nil
+	}
+	if err == nil {
+		err = pki.CheckSigner(caCertPEM, signer)
+	}
+	if err != nil {
+		signer.Close()
+		return nil, fmt.Errorf("failed to verify CA key against %s: %w", caCertPath, err)
+	}
+	return signer, nil
+}
+
+// keyAlgorithm names the signature algorithm x509 asks a key for: "ECDSA", "RSA" or "RSA-PSS",
+// and the hash of the digest.
+func keyAlgorithm(public crypto.PublicKey, opts crypto.SignerOpts) (string, crypto.Hash, error) {
+	hash := opts.HashFunc()
+	switch hash {
+	case crypto.SHA256, crypto.SHA384, crypto.SHA512:
+	default:
+		return "", 0, fmt.Errorf("unsupported hash %v", hash)
+	}
+	switch public.(type) {
+	case *ecdsa.PublicKey:
+		return "ECDSA", hash, nil
+	case *rsa.PublicKey:
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			return "RSA-PSS", hash, nil
+		}
+		return "RSA", hash, nil
+	}
+	return "", 0, fmt.Errorf("unsupported key type %T", public)
+}
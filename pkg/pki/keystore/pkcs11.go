@@ -0,0 +1,45 @@
+//go:build cgo
+
+package keystore
+
+import (
+	"fmt"
+
+	"simplec2/pkg/config"
+
+	"github.com/ThalesGroup/crypto11"
+)
+
+// pkcs11Signer signs with a key pair on a PKCS#11 token, e.g. an HSM or SoftHSM.
+type pkcs11Signer struct {
+	crypto11.Signer
+	ctx *crypto11.Context
+}
+
+func openPKCS11(cfg *config.CAKeyConfig) (*pkcs11Signer, error) {
+	if cfg.Module == "" || cfg.TokenLabel == "" || cfg.KeyLabel == "" {
+		return nil, fmt.Errorf("pkcs11 CA key needs a module, token_label and key_label")
+	}
+	ctx, err := crypto11.Configure(&crypto11.Config{
+		Path:       cfg.Module,
+		TokenLabel: cfg.TokenLabel,
+		Pin:        cfg.GetPIN(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PKCS#11 token '%s': %w", cfg.TokenLabel, err)
+	}
+	signer, err := ctx.FindKeyPair(nil, []byte(cfg.KeyLabel))
+	if err == nil && signer == nil {
+		err = fmt.Errorf("no key pair with this label")
+	}
+	if err != nil {
+		ctx.Close()
+		return nil, fmt.Errorf("failed to find key '%s' on PKCS#11 token '%s': %w", cfg.KeyLabel, cfg.TokenLabel, err)
+	}
+	return &pkcs11Signer{Signer: signer, ctx: ctx}, nil
+}
+
+// Close logs out of the token.
+func (s *pkcs11Signer) Close() error {
+	return s.ctx.Close()
+}
@@ -0,0 +1,15 @@
+//go:build !cgo
+
+package keystore
+
+import (
+	"fmt"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/pki"
+)
+
+// openPKCS11 is not supported without cgo, which PKCS#11 modules are loaded with.
+func openPKCS11(cfg *config.CAKeyConfig) (pki.Signer, error) {
+	return nil, fmt.Errorf("pkcs11 CA keys need a TeamServer built with cgo")
+}
@@ -1,12 +1,15 @@
 package pki
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 	"math/big"
@@ -15,6 +18,15 @@ import (
 	"time"
 )
 
+// Key types of generated certificates
+const (
+	KeyTypeECDSA = "ecdsa"
+	KeyTypeRSA   = "rsa"
+)
+
+// DefaultValidity is how long generated certificates are valid unless CertConfig says otherwise
+const DefaultValidity = 365 * 24 * time.Hour
+
 // CertConfig holds the configuration for a certificate
 type CertConfig struct {
 	CommonName string
@@ -23,6 +35,61 @@ type CertConfig struct {
 	IsClient   bool
 	DNSNames   []string
 	IPs        []net.IP
+	Emails     []string
+
+	// Subject fields besides the common name; Organization is "SimpleC2" if not set
+	Organization       []string
+	OrganizationalUnit []string
+	Country            []string
+	Province           []string
+	Locality           []string
+
+	KeyType  string        // KeyTypeECDSA (default) or KeyTypeRSA
+	Curve    string        // ECDSA curve: "P-256" (default), "P-384" or "P-521"
+	RSABits  int           // RSA key size: 2048 (default), 3072 or 4096
+	Validity time.Duration // DefaultValidity if 0; never beyond the expiry of the signing CA
+}
+
+// Validate checks the key parameters and validity period.
+func (cfg CertConfig) Validate() error {
+	_, err := cfg.keyGenerator()
+	if err != nil {
+		return err
+	}
+	if cfg.Validity < 0 {
+		return fmt.Errorf("validity must not be negative")
+	}
+	return nil
+}
+
+// keyGenerator returns a function generating a private key of the configured type.
+func (cfg CertConfig) keyGenerator() (func() (crypto.Signer, error), error) {
+	switch cfg.KeyType {
+	case "", KeyTypeECDSA:
+		var curve elliptic.Curve
+		switch cfg.Curve {
+		case "", "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported ECDSA curve '%s' (P-256, P-384 or P-521)", cfg.Curve)
+		}
+		return func() (crypto.Signer, error) { return ecdsa.GenerateKey(curve, rand.Reader) }, nil
+	case KeyTypeRSA:
+		bits := cfg.RSABits
+		switch bits {
+		case 0:
+			bits = 2048
+		case 2048, 3072, 4096:
+		default:
+			return nil, fmt.Errorf("unsupported RSA key size %d (2048, 3072 or 4096)", cfg.RSABits)
+		}
+		return func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, bits) }, nil
+	}
+	return nil, fmt.Errorf("unsupported key type '%s' (%s or %s)", cfg.KeyType, KeyTypeECDSA, KeyTypeRSA)
 }
 
 // GenerateRSAKeyPair generates an RSA 2048-bit key pair.
@@ -49,30 +116,108 @@ func GenerateRSAKeyPair() ([]byte, []byte, error) {
 // GenerateCert generates a certificate signed by a parent CA (or self-signed if parent is nil).
 // Returns private key PEM and certificate PEM.
 func GenerateCert(cfg CertConfig, parentCertPEM, parentKeyPEM []byte) ([]byte, []byte, error) {
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if parentCertPEM == nil || parentKeyPEM == nil {
+		return IssueCert(cfg, nil, nil)
+	}
+	parentKey, err := ParsePrivateKey(parentKeyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse parent private key: %w", err)
+	}
+	return IssueCert(cfg, parentCertPEM, parentKey)
+}
+
+// IssueCert generates a certificate signed by a parent CA whose key is a Signer, e.g. one held in
+// a KMS or HSM, or self-signed if parentKey is nil. Returns private key PEM and certificate PEM.
+func IssueCert(cfg CertConfig, parentCertPEM []byte, parentKey crypto.Signer) ([]byte, []byte, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	generateKey, _ := cfg.keyGenerator()
+	privateKey, err := generateKey()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to generate private key: %w", err)
 	}
 
+	template, err := cfg.template()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var parentCert *x509.Certificate
+
+	if parentCertPEM != nil && parentKey != nil {
+		parentCert, err = ParseCertificate(parentCertPEM)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse parent cert: %w", err)
+		}
+		// Verifiers reject a certificate that outlives its CA
+		if template.NotAfter.After(parentCert.NotAfter) {
+			template.NotAfter = parentCert.NotAfter
+		}
+	} else {
+		// Self-signed
+		parentCert = template
+		parentKey = privateKey
+	}
+
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, parentCert, privateKey.Public(), parentKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	var privPEM []byte
+	switch key := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		privBytes, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to marshal ECDSA private key: %v", err)
+		}
+		privPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privBytes})
+	case *rsa.PrivateKey:
+		privPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+
+	return privPEM, certPEM, nil
+}
+
+// template builds the certificate template for cfg, with a random serial number.
+func (cfg CertConfig) template() (*x509.Certificate, error) {
 	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
 	}
 
-	template := x509.Certificate{
-		SerialNumber:          serialNumber,
-		Subject:               pkix.Name{Organization: []string{"SimpleC2"}, CommonName: cfg.CommonName},
+	organization := cfg.Organization
+	if len(organization) == 0 {
+		organization = []string{"SimpleC2"}
+	}
+	validity := cfg.Validity
+	if validity == 0 {
+		validity = DefaultValidity
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization:       organization,
+			OrganizationalUnit: cfg.OrganizationalUnit,
+			Country:            cfg.Country,
+			Province:           cfg.Province,
+			Locality:           cfg.Locality,
+			CommonName:         cfg.CommonName,
+		},
 		NotBefore:             time.Now(),
-		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		NotAfter:              time.Now().Add(validity),
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		BasicConstraintsValid: true,
 		DNSNames:              cfg.DNSNames,
 		IPAddresses:           cfg.IPs,
+		EmailAddresses:        cfg.Emails,
 	}
 
 	if cfg.IsCA {
 		template.IsCA = true
-		template.KeyUsage |= x509.KeyUsageCertSign
+		template.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
 	} else {
 		if cfg.IsServer {
 			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
@@ -81,48 +226,104 @@ func GenerateCert(cfg CertConfig, parentCertPEM, parentKeyPEM []byte) ([]byte, [
 			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
 		}
 	}
+	return template, nil
+}
 
-	var parentCert *x509.Certificate
-	var parentKey interface{}
-
-	if parentCertPEM != nil && parentKeyPEM != nil {
-		block, _ := pem.Decode(parentCertPEM)
-		if block == nil {
-			return nil, nil, fmt.Errorf("failed to decode parent cert PEM")
-		}
-		parentCert, err = x509.ParseCertificate(block.Bytes)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to parse parent cert: %w", err)
-		}
+// CreateCA issues a self-signed CA certificate for an existing key, e.g. one held in a KMS or HSM.
+// The key type settings of cfg are ignored. Returns the certificate PEM.
+func CreateCA(cfg CertConfig, key crypto.Signer) ([]byte, error) {
+	cfg.IsCA = true
+	template, err := cfg.template()
+	if err != nil {
+		return nil, err
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes}), nil
+}
 
-		blockKey, _ := pem.Decode(parentKeyPEM)
-		if blockKey == nil {
-			return nil, nil, fmt.Errorf("failed to decode parent key PEM")
-		}
-		// Assuming ECDSA key for now as per our standard
-		parentKey, err = x509.ParseECPrivateKey(blockKey.Bytes)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to parse parent private key: %w", err)
-		}
-	} else {
-		// Self-signed
-		parentCert = &template
-		parentKey = privateKey
+// CrossSign issues a copy of a CA certificate (same subject, key and key identifier) signed by
+// another CA, so certificates of the new CA also verify for clients that only trust the old one.
+// The copy expires with the issuing CA at the latest.
+func CrossSign(issuerCertPEM []byte, issuerKey crypto.Signer, subjectCertPEM []byte) ([]byte, error) {
+	issuerCert, err := ParseCertificate(issuerCertPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse parent cert: %w", err)
+	}
+	subject, err := ParseCertificate(subjectCertPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA cert: %w", err)
+	}
+	if !subject.IsCA {
+		return nil, fmt.Errorf("certificate '%s' is not a CA", subject.Subject.CommonName)
 	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, parentCert, &privateKey.PublicKey, parentKey)
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	notAfter := subject.NotAfter
+	if issuerCert.NotAfter.Before(notAfter) {
+		notAfter = issuerCert.NotAfter
 	}
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject.Subject,
+		NotBefore:             time.Now(),
+		NotAfter:              notAfter,
+		KeyUsage:              subject.KeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          subject.SubjectKeyId,
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, issuerCert, subject.PublicKey, issuerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cross-signed certificate: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes}), nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a certificate, hex encoded.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
 
-	privBytes, err := x509.MarshalECPrivateKey(privateKey)
+// ParsePrivateKey decodes a PEM private key: EC, PKCS#1 RSA or PKCS#8.
+func ParsePrivateKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode key PEM")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	}
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to marshal ECDSA private key: %v", err)
+		return nil, err
 	}
-	privPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privBytes})
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
 
-	return privPEM, certPEM, nil
+// ParseCertificate decodes the first certificate of a PEM file.
+func ParseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode cert PEM")
+	}
+	return x509.ParseCertificate(block.Bytes)
 }
 
 // SavePEMFile saves PEM encoded data to a file.
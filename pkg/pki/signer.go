@@ -0,0 +1,53 @@
+package pki
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+)
+
+// Signer is a CA private key. A key held in a KMS or HSM never leaves it: certificates and CRLs
+// are signed by calling out to the key store.
+type Signer interface {
+	crypto.Signer
+
+	// Close releases the connection to the key store, if any.
+	Close() error
+}
+
+// FileSigner is a CA private key read from a PEM file, such as ca.key.
+type FileSigner struct {
+	crypto.Signer
+	Path string
+}
+
+// LoadFileSigner reads the private key in a PEM file.
+func LoadFileSigner(path string) (*FileSigner, error) {
+	keyPEM, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA private key: %w", err)
+	}
+	key, err := ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA private key: %w", err)
+	}
+	return &FileSigner{Signer: key, Path: path}, nil
+}
+
+// Close does nothing, the key is kept in memory.
+func (s *FileSigner) Close() error {
+	return nil
+}
+
+// CheckSigner verifies that a signer holds the private key of a certificate.
+func CheckSigner(certPEM []byte, signer crypto.Signer) error {
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		return fmt.Errorf("failed to parse cert: %w", err)
+	}
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !public.Equal(cert.PublicKey) {
+		return fmt.Errorf("the key does not match certificate '%s'", cert.Subject.CommonName)
+	}
+	return nil
+}
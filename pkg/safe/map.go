@@ -5,28 +5,28 @@ import "sync"
 // Map is a thread-safe map implementation using RWMutex
 // It supports any comparable type as key
 
-type Map struct {
+type Map[K comparable, V any] struct {
 	mu sync.RWMutex
-	m  map[interface{}]interface{}
+	m  map[K]V
 }
 
 // NewMap creates a new thread-safe map
-func NewMap() *Map {
-	return &Map{
-		m: make(map[interface{}]interface{}),
+func NewMap[K comparable, V any]() *Map[K, V] {
+	return &Map[K, V]{
+		m: make(map[K]V),
 	}
 }
 
 // Store sets the value for a key
-func (m *Map) Store(key, value interface{}) {
+func (m *Map[K, V]) Store(key K, value V) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.m[key] = value
 }
 
-// Load returns the value stored in the map for a key, or nil if no value is present.
+// Load returns the value stored in the map for a key, or the zero value if no value is present.
 // The ok result indicates whether value was found in the map
-func (m *Map) Load(key interface{}) (interface{}, bool) {
+func (m *Map[K, V]) Load(key K) (V, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	val, ok := m.m[key]
@@ -36,7 +36,7 @@ func (m *Map) Load(key interface{}) (interface{}, bool) {
 // LoadOrStore returns the existing value for the key if present.
 // Otherwise, it stores and returns the given value.
 // The loaded result is true if the value was loaded, false if stored.
-func (m *Map) LoadOrStore(key, value interface{}) (actual interface{}, loaded bool) {
+func (m *Map[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	actual, loaded = m.m[key]
@@ -48,34 +48,68 @@ func (m *Map) LoadOrStore(key, value interface{}) (actual interface{}, loaded bo
 }
 
 // Delete deletes the value for a key
-func (m *Map) Delete(key interface{}) {
+func (m *Map[K, V]) Delete(key K) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	delete(m.m, key)
 }
 
+// LoadAndDelete deletes the value for a key and returns it.
+// The loaded result reports whether the key was present
+func (m *Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, loaded = m.m[key]
+	delete(m.m, key)
+	return value, loaded
+}
+
 // Range calls f sequentially for each key and value present in the map.
 // If f returns false, range stops the iteration.
-func (m *Map) Range(f func(key, value interface{}) bool) {
+// It iterates over a snapshot, so f may modify the map; changes are not seen by the iteration
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	entries := make([]entry[K, V], 0, len(m.m))
 	for k, v := range m.m {
-		if !f(k, v) {
+		entries = append(entries, entry[K, V]{k, v})
+	}
+	m.mu.RUnlock()
+
+	for _, e := range entries {
+		if !f(e.key, e.value) {
 			break
 		}
 	}
 }
 
+// entry is a key and value of a Range snapshot
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// Snapshot returns a copy of the map
+// Note: This is a snapshot and may be out of date immediately after returning
+func (m *Map[K, V]) Snapshot() map[K]V {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make(map[K]V, len(m.m))
+	for k, v := range m.m {
+		result[k] = v
+	}
+	return result
+}
+
 // Len returns the number of items in the map
-func (m *Map) Len() int {
+func (m *Map[K, V]) Len() int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	return len(m.m)
 }
 
 // Clear removes all entries from the map
-func (m *Map) Clear() {
+func (m *Map[K, V]) Clear() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.m = make(map[interface{}]interface{})
+	m.m = make(map[K]V)
 }
@@ -1,39 +1,43 @@
 package safe
 
-import "sync"
+import (
+	"slices"
+	"sync"
+)
 
 // Slice is a thread-safe slice implementation
-type Slice struct {
+type Slice[T any] struct {
 	mu   sync.RWMutex
-data []interface{}
+	data []T
 }
 
 // NewSlice creates a new thread-safe slice
-func NewSlice() *Slice {
-	return &Slice{
-		data: make([]interface{}, 0),
+func NewSlice[T any]() *Slice[T] {
+	return &Slice[T]{
+		data: make([]T, 0),
 	}
 }
 
 // Append adds an element to the end of the slice
-func (s *Slice) Append(value interface{}) {
+func (s *Slice[T]) Append(value T) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.data = append(s.data, value)
 }
 
 // Get returns the element at the given index
-func (s *Slice) Get(index int) (interface{}, bool) {
+func (s *Slice[T]) Get(index int) (T, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if index < 0 || index >= len(s.data) {
-		return nil, false
+		var zero T
+		return zero, false
 	}
 	return s.data[index], true
 }
 
 // Set sets the element at the given index
-func (s *Slice) Set(index int, value interface{}) bool {
+func (s *Slice[T]) Set(index int, value T) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if index < 0 || index >= len(s.data) {
@@ -44,7 +48,7 @@ func (s *Slice) Set(index int, value interface{}) bool {
 }
 
 // Len returns the number of elements in the slice
-func (s *Slice) Len() int {
+func (s *Slice[T]) Len() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return len(s.data)
@@ -52,10 +56,9 @@ func (s *Slice) Len() int {
 
 // Range calls f sequentially for each element in the slice.
 // If f returns false, range stops the iteration.
-func (s *Slice) Range(f func(index int, value interface{}) bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	for i, v := range s.data {
+// It iterates over a snapshot, so f may modify the slice; changes are not seen by the iteration
+func (s *Slice[T]) Range(f func(index int, value T) bool) {
+	for i, v := range s.ToSlice() {
 		if !f(i, v) {
 			break
 		}
@@ -63,29 +66,32 @@ func (s *Slice) Range(f func(index int, value interface{}) bool) {
 }
 
 // Clear removes all elements from the slice
-func (s *Slice) Clear() {
+func (s *Slice[T]) Clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data = make([]interface{}, 0)
+	s.data = make([]T, 0)
 }
 
-// Remove removes the element at the given index
-func (s *Slice) Remove(index int) bool {
+// Remove removes the element at the given index and returns it
+func (s *Slice[T]) Remove(index int) (T, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if index < 0 || index >= len(s.data) {
-		return false
+		var zero T
+		return zero, false
 	}
-	s.data = append(s.data[:index], s.data[index+1:]...)
-	return true
+	value := s.data[index]
+	// slices.Delete zeroes the vacated element, so the backing array doesn't keep it alive
+	s.data = slices.Delete(s.data, index, index+1)
+	return value, true
 }
 
 // ToSlice returns a copy of the underlying slice
 // Note: This is a snapshot and may be out of date immediately after returning
-func (s *Slice) ToSlice() []interface{} {
+func (s *Slice[T]) ToSlice() []T {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	result := make([]interface{}, len(s.data))
+	result := make([]T, len(s.data))
 	copy(result, s.data)
 	return result
 }
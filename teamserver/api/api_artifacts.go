@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetArtifacts handles the API request to list tracked artifacts.
+func (a *API) GetArtifacts(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+
+	artifacts, total, err := a.ArtifactService.ListArtifacts(c.Request.Context(), page, limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve artifacts", err.Error()))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(artifacts, meta))
+}
+
+// ExportArtifacts handles the API request to export the IOC manifest.
+// Supports ?format=json (default) or ?format=csv.
+func (a *API) ExportArtifacts(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'format' parameter", "must be 'json' or 'csv'"))
+		return
+	}
+
+	artifacts, err := a.ArtifactService.ExportArtifacts(c.Request.Context())
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to export artifacts", err.Error()))
+		return
+	}
+
+	fileName := fmt.Sprintf("artifacts-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+
+	if format == "json" {
+		c.JSON(http.StatusOK, artifacts)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"created_at", "type", "payload_id", "beacon_id", "task_id", "hostname", "file_name", "path", "size", "md5", "sha256"})
+	for _, artifact := range artifacts {
+		w.Write([]string{
+			artifact.CreatedAt.UTC().Format(time.RFC3339),
+			artifact.Type,
+			artifact.PayloadID,
+			artifact.BeaconID,
+			artifact.TaskID,
+			artifact.Hostname,
+			artifact.FileName,
+			artifact.Path,
+			strconv.FormatInt(artifact.Size, 10),
+			artifact.MD5,
+			artifact.SHA256,
+		})
+	}
+	w.Flush()
+}
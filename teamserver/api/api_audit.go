@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditMiddleware records operator API requests in the audit log.
+// Changes and denied requests are always recorded; reads only if audit.include_reads is set.
+// Must run before AuthMiddlewareWithSession so that rejected requests are recorded too.
+func (a *API) AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if a.AuditService == nil || !strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			return
+		}
+		status := c.Writer.Status()
+		if !a.shouldAudit(c.Request.Method, status) {
+			return
+		}
+
+		a.AuditService.Record(&data.AuditLog{
+			CreatedAt:  start,
+			Username:   c.GetString("username"),
+			Role:       c.GetString("role"),
+			AuthMethod: c.GetString("authMethod"),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			Route:      routePattern(c),
+			Query:      c.Request.URL.RawQuery,
+			Status:     status,
+			ClientIP:   c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+			DurationMs: time.Since(start).Milliseconds(),
+			RequestID:  c.GetString(requestIDKey),
+		})
+	}
+}
+
+func (a *API) shouldAudit(method string, status int) bool {
+	switch method {
+	case http.MethodOptions:
+		return false
+	case http.MethodGet, http.MethodHead:
+		return a.Config.Audit.IncludeReads || status == http.StatusUnauthorized || status == http.StatusForbidden
+	default:
+		return true
+	}
+}
+
+// alert reports a security alert through the audit service, if one is configured.
+func (a *API) alert(alert *service.SecurityAlert) {
+	if a.AuditService != nil {
+		a.AuditService.Alert(alert)
+	}
+}
+
+// GetAuditLogs handles the API request to list audit log entries.
+// Supports 'username', 'method', 'path' (prefix), 'status', 'request_id', 'since' and 'until' (RFC3339) filters.
+func (a *API) GetAuditLogs(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+
+	query, err := parseAuditLogQuery(c)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid audit log filter", err.Error()))
+		return
+	}
+	cursor, ok := parseCursor(c)
+	if !ok {
+		return
+	}
+	query.Page = page
+	query.Limit = limit
+	query.Cursor = cursor
+
+	logs, total, err := a.AuditService.ListAuditLogs(c.Request.Context(), query)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve audit logs", err.Error()))
+		return
+	}
+
+	next := cursorToken(data.NextCursor(logs, limit, func(l *data.AuditLog) (time.Time, uint) { return l.CreatedAt, l.ID }))
+	if cursor != nil {
+		Respond(c, http.StatusOK, NewSuccessResponse(logs, gin.H{"limit": limit, "next_cursor": next}))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+		"next_cursor": next,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(logs, meta))
+}
+
+// parseAuditLogQuery reads the audit log filters from the query string.
+func parseAuditLogQuery(c *gin.Context) (*data.AuditLogQuery, error) {
+	query := &data.AuditLogQuery{
+		Username:  c.Query("username"),
+		Method:    strings.ToUpper(c.Query("method")),
+		Path:      c.Query("path"),
+		RequestID: c.Query("request_id"),
+	}
+	if s := c.Query("status"); s != "" {
+		status, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, err
+		}
+		query.Status = status
+	}
+	if s := c.Query("since"); s != "" {
+		since, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, err
+		}
+		query.Since = &since
+	}
+	if s := c.Query("until"); s != "" {
+		until, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, err
+		}
+		query.Until = &until
+	}
+	return query, nil
+}
+
+// ExportAuditLogs handles the API request to download the audit log as CSV or JSONL.
+// Accepts the same filters as GetAuditLogs. Entries are streamed oldest first.
+func (a *API) ExportAuditLogs(c *gin.Context) {
+	format := c.DefaultQuery("format", "jsonl")
+	if format != "jsonl" && format != "csv" {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'format' parameter", "must be 'jsonl' or 'csv'"))
+		return
+	}
+	query, err := parseAuditLogQuery(c)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid audit log filter", err.Error()))
+		return
+	}
+
+	fileName := fmt.Sprintf("audit-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+
+	var write func(batch []data.AuditLog) error
+	if format == "jsonl" {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		enc := json.NewEncoder(c.Writer)
+		write = func(batch []data.AuditLog) error {
+			for i := range batch {
+				if err := enc.Encode(&batch[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"id", "created_at", "username", "role", "auth_method", "method", "path", "route", "query", "status", "client_ip", "user_agent", "duration_ms", "request_id"})
+		write = func(batch []data.AuditLog) error {
+			for _, entry := range batch {
+				w.Write([]string{
+					strconv.FormatUint(uint64(entry.ID), 10),
+					entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+					entry.Username,
+					entry.Role,
+					entry.AuthMethod,
+					entry.Method,
+					entry.Path,
+					entry.Route,
+					entry.Query,
+					strconv.Itoa(entry.Status),
+					entry.ClientIP,
+					entry.UserAgent,
+					strconv.FormatInt(entry.DurationMs, 10),
+					entry.RequestID,
+				})
+			}
+			w.Flush()
+			return w.Error()
+		}
+	}
+
+	// The status line is already sent, so a failure can only cut the download short
+	if err := a.AuditService.ExportAuditLogs(c.Request.Context(), query, write); err != nil {
+		logger.Ctx(c.Request.Context()).Errorf("Audit log export failed: %v", err)
+	}
+}
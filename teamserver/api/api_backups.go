@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RestoreBackupRequest confirms a restore, which replaces everything in the database.
+type RestoreBackupRequest struct {
+	Confirm string `json:"confirm" binding:"required"` // Must repeat the backup name
+}
+
+// GetBackups handles the API request to list the database backups.
+func (a *API) GetBackups(c *gin.Context) {
+	backups, err := a.BackupService.ListBackups()
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to list backups", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(backups, nil))
+}
+
+// CreateBackup handles the API request to take a database backup now.
+func (a *API) CreateBackup(c *gin.Context) {
+	backup, err := a.BackupService.CreateBackup(c.Request.Context(), c.GetString("username"))
+	if err != nil {
+		respondBackupError(c, "Failed to create backup", err)
+		return
+	}
+	Respond(c, http.StatusCreated, NewSuccessResponse(backup, nil))
+}
+
+// DownloadBackup handles the API request to download a backup archive.
+func (a *API) DownloadBackup(c *gin.Context) {
+	backup, file, err := a.BackupService.OpenBackup(c.Param("name"))
+	if err != nil {
+		respondBackupError(c, "Failed to open backup", err)
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", backup.Name))
+	c.Header("Content-Type", "application/gzip")
+	// Backups are decrypted as they are streamed
+	http.ServeContent(c.Writer, c.Request, backup.Name, backup.CreatedAt, file)
+}
+
+// DeleteBackup handles the API request to delete a backup archive.
+func (a *API) DeleteBackup(c *gin.Context) {
+	if err := a.BackupService.DeleteBackup(c.Param("name")); err != nil {
+		respondBackupError(c, "Failed to delete backup", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{"deleted": c.Param("name")}, nil))
+}
+
+// ImportBackup handles the API request to upload a backup archive (the request body) for restoring,
+// e.g. one downloaded from another TeamServer.
+func (a *API) ImportBackup(c *gin.Context) {
+	backup, err := a.BackupService.ImportBackup(c.Request.Body)
+	if err != nil {
+		respondBackupError(c, "Failed to import backup", err)
+		return
+	}
+	Respond(c, http.StatusCreated, NewSuccessResponse(backup, nil))
+}
+
+// RestoreBackup handles the API request to replace the database content with a backup.
+// The TeamServer must be restarted afterwards.
+func (a *API) RestoreBackup(c *gin.Context) {
+	name := c.Param("name")
+	var req RestoreBackupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	if req.Confirm != name {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Restore not confirmed", "'confirm' must be the name of the backup"))
+		return
+	}
+
+	report, err := a.BackupService.RestoreBackup(c.Request.Context(), name)
+	if err != nil {
+		respondBackupError(c, "Failed to restore backup", err)
+		return
+	}
+	report.RestartRequired = true
+
+	a.alert(&service.SecurityAlert{
+		Name:     "database_restored",
+		Severity: 8,
+		Username: c.GetString("username"),
+		SourceIP: c.ClientIP(),
+		Message:  "database restored from backup " + name,
+		Fields: map[string]string{
+			"backup":        name,
+			"missing_files": strconv.Itoa(len(report.MissingFiles)),
+			"changed_files": strconv.Itoa(len(report.ChangedFiles)),
+		},
+	})
+	Respond(c, http.StatusOK, NewSuccessResponse(report, nil))
+}
+
+// respondBackupError maps backup service errors to status codes.
+func respondBackupError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrBackupNotFound):
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, message, err.Error()))
+	case errors.Is(err, service.ErrBackupBusy):
+		Respond(c, http.StatusConflict, NewErrorResponse(http.StatusConflict, message, err.Error()))
+	case errors.Is(err, service.ErrInvalidBackup), errors.Is(err, data.ErrSchemaMismatch):
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, message, err.Error()))
+	default:
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, message, err.Error()))
+	}
+}
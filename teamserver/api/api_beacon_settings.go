@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UpdateBeaconSettingsRequest defines the settings to change on a beacon; omitted fields are kept.
+type UpdateBeaconSettingsRequest struct {
+	Sleep  *int `json:"sleep"`  // Seconds, 1-3600
+	Jitter *int `json:"jitter"` // Percentage, 0-99
+	// ScopeOverride is the justification for tasking a beacon outside the engagement's target scope.
+	ScopeOverride string `json:"scope_override"`
+}
+
+// GetBeaconSettings handles the API request to get the settings a beacon confirmed and the ones last
+// requested for it.
+func (a *API) GetBeaconSettings(c *gin.Context) {
+	state, err := a.TaskService.GetBeaconSettings(c.Request.Context(), c.Param("beacon_id"))
+	if err != nil {
+		respondBeaconSettingsError(c, "Failed to get beacon settings", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(state, nil))
+}
+
+// UpdateBeaconSettings handles the API request to change the sleep and jitter of a beacon. It queues
+// the sleep task applying them; the settings are pending until the beacon runs it.
+func (a *API) UpdateBeaconSettings(c *gin.Context) {
+	beaconID := c.Param("beacon_id")
+
+	var req UpdateBeaconSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	if !a.allowCommand(c, beaconID, "sleep") || !a.allowTarget(c, beaconID, "sleep", req.ScopeOverride) {
+		return
+	}
+
+	update := service.BeaconSettingsUpdate{Sleep: req.Sleep, Jitter: req.Jitter}
+	state, task, err := a.TaskService.UpdateBeaconSettings(c.Request.Context(), beaconID, update, c.GetString("username"))
+	if err != nil {
+		respondBeaconSettingsError(c, "Failed to update beacon settings", err)
+		return
+	}
+
+	for _, event := range []struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}{
+		{Type: "TASK_QUEUED", Payload: task},
+		{Type: "BEACON_SETTINGS_UPDATED", Payload: state},
+	} {
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			logger.Ctx(c.Request.Context()).Errorf("Error marshalling %s event: %v", event.Type, err)
+			continue
+		}
+		if a.Hub != nil {
+			a.Hub.BroadcastTo(task.Engagement, eventBytes)
+		}
+	}
+
+	Respond(c, http.StatusAccepted, NewSuccessResponse(gin.H{"settings": state, "task": task}, nil))
+}
+
+// broadcastBeaconSettings sends BEACON_SETTINGS_UPDATED to the WebSocket clients of the engagement.
+func (a *API) broadcastBeaconSettings(c *gin.Context, state *service.BeaconSettingsState) {
+	event := struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}{
+		Type:    "BEACON_SETTINGS_UPDATED",
+		Payload: state,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Errorf("Error marshalling BEACON_SETTINGS_UPDATED event: %v", err)
+	} else if a.Hub != nil {
+		a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+	}
+}
+
+// respondBeaconSettingsError maps beacon settings errors to status codes.
+func respondBeaconSettingsError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, message, err.Error()))
+	case errors.Is(err, service.ErrInvalidSettings):
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, message, err.Error()))
+	case errors.Is(err, service.ErrBeaconClaimed):
+		Respond(c, http.StatusConflict, NewErrorResponse(http.StatusConflict, "Beacon is claimed by another operator", err.Error()))
+	default:
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, message, err.Error()))
+	}
+}
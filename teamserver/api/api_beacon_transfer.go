@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ExportBeaconsRequest selects the beacons to export.
+type ExportBeaconsRequest struct {
+	BeaconIDs []string `json:"beacon_ids" binding:"required,min=1"`
+}
+
+// ExportBeacons handles the API request to download a signed archive of beacons with their session keys,
+// tasks, notes and loot records, for importing on another TeamServer.
+func (a *API) ExportBeacons(c *gin.Context) {
+	var req ExportBeaconsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	// Buffered, so an error can still be reported as JSON
+	var archive bytes.Buffer
+	if err := a.BackupService.ExportBeacons(c.Request.Context(), req.BeaconIDs, c.GetString("username"), &archive); err != nil {
+		respondBeaconTransferError(c, "Failed to export beacons", err)
+		return
+	}
+
+	// The archive holds the beacons' session keys
+	a.alert(&service.SecurityAlert{
+		Name:     "beacons_exported",
+		Severity: 6,
+		Username: c.GetString("username"),
+		SourceIP: c.ClientIP(),
+		Message:  fmt.Sprintf("%d beacons exported", len(req.BeaconIDs)),
+		Fields:   map[string]string{"beacons": strings.Join(req.BeaconIDs, ",")},
+	})
+	name := fmt.Sprintf("simplec2-beacons-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", name))
+	c.Data(http.StatusOK, "application/gzip", archive.Bytes())
+}
+
+// ImportBeacons handles the API request to import the beacons of an archive (the request body) exported by
+// another TeamServer into the current engagement. 'listener' replaces the listener of the imported beacons.
+func (a *API) ImportBeacons(c *gin.Context) {
+	options := service.BeaconImportOptions{Listener: c.Query("listener")}
+	report, err := a.BackupService.ImportBeacons(c.Request.Context(), c.Request.Body, options)
+	if err != nil {
+		respondBeaconTransferError(c, "Failed to import beacons", err)
+		return
+	}
+
+	for i := range report.Imported {
+		a.broadcastBeacon(c, "BEACON_NEW", &report.Imported[i])
+	}
+	a.alert(&service.SecurityAlert{
+		Name:     "beacons_imported",
+		Severity: 6,
+		Username: c.GetString("username"),
+		SourceIP: c.ClientIP(),
+		Message:  fmt.Sprintf("%d beacons imported from an archive exported by %s", len(report.Imported), report.ExportedBy),
+		Fields: map[string]string{
+			"imported": strconv.Itoa(len(report.Imported)),
+			"skipped":  strconv.Itoa(len(report.Skipped)),
+		},
+	})
+	Respond(c, http.StatusOK, NewSuccessResponse(report, nil))
+}
+
+// respondBeaconTransferError maps beacon export and import errors to status codes.
+func respondBeaconTransferError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, message, err.Error()))
+	case errors.Is(err, service.ErrTransferDisabled):
+		Respond(c, http.StatusServiceUnavailable, NewErrorResponse(http.StatusServiceUnavailable, message, err.Error()))
+	case errors.Is(err, service.ErrInvalidBeaconArchive):
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, message, err.Error()))
+	default:
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, message, err.Error()))
+	}
+}
@@ -2,14 +2,18 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"math"
 	"net/http"
 
 	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
 	"simplec2/teamserver/service"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // GetBeacons handles the API request to list all beacons.
@@ -27,12 +31,23 @@ func (a *API) GetBeacons(c *gin.Context) {
 	}
 	search := c.Query("search")
 	status := c.Query("status")
+	archived := c.Query("archived")
+	if archived != "" && archived != "true" && archived != "all" {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'archived' parameter", "must be 'true' or 'all'"))
+		return
+	}
+	cursor, ok := parseCursor(c)
+	if !ok {
+		return
+	}
 
 	query := &service.ListQuery{
-		Page:   page,
-		Limit:  limit,
-		Search: search,
-		Status: status,
+		Page:     page,
+		Limit:    limit,
+		Search:   search,
+		Status:   status,
+		Archived: archived,
+		Cursor:   cursor,
 	}
 
 	beacons, total, err := a.BeaconService.ListBeacons(c.Request.Context(), query)
@@ -41,6 +56,12 @@ func (a *API) GetBeacons(c *gin.Context) {
 		return
 	}
 
+	next := cursorToken(data.NextCursor(beacons, limit, func(b *data.Beacon) (time.Time, uint) { return b.CreatedAt, b.ID }))
+	if cursor != nil {
+		Respond(c, http.StatusOK, NewSuccessResponse(beacons, gin.H{"limit": limit, "next_cursor": next}))
+		return
+	}
+
 	totalPages := int(math.Ceil(float64(total) / float64(limit)))
 
 	meta := gin.H{
@@ -48,6 +69,7 @@ func (a *API) GetBeacons(c *gin.Context) {
 		"limit":       limit,
 		"total":       total,
 		"total_pages": totalPages,
+		"next_cursor": next,
 	}
 	Respond(c, http.StatusOK, NewSuccessResponse(beacons, meta))
 }
@@ -90,20 +112,72 @@ func (a *API) DeleteBeacon(c *gin.Context) {
 	}
 	eventBytes, err := json.Marshal(event)
 	if err != nil {
-		logger.Errorf("Error marshalling BEACON_DELETED event: %v", err)
+		logger.Ctx(c.Request.Context()).Errorf("Error marshalling BEACON_DELETED event: %v", err)
 	} else {
 		if a.Hub != nil {
-			a.Hub.Broadcast(eventBytes)
-			logger.Debugf("Broadcasted BEACON_DELETED event for %s", beaconID)
+			a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+			logger.Ctx(c.Request.Context()).Debugf("Broadcasted BEACON_DELETED event for %s", beaconID)
 		}
 	}
 
 	c.Status(http.StatusNoContent)
 }
 
+// ArchiveBeacon handles the API request to archive a beacon. Unlike DeleteBeacon it doesn't task
+// the beacon to exit; the beacon and its history stay available for reporting.
+func (a *API) ArchiveBeacon(c *gin.Context) {
+	beacon, err := a.BeaconService.ArchiveBeacon(c.Request.Context(), c.Param("beacon_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Beacon not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to archive beacon", err.Error()))
+		return
+	}
+
+	a.broadcastBeacon(c, "BEACON_ARCHIVED", beacon)
+	Respond(c, http.StatusOK, NewSuccessResponse(beacon, nil))
+}
+
+// RestoreBeacon handles the API request to bring an archived beacon back into the beacon list.
+func (a *API) RestoreBeacon(c *gin.Context) {
+	beacon, err := a.BeaconService.RestoreBeacon(c.Request.Context(), c.Param("beacon_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Beacon not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to restore beacon", err.Error()))
+		return
+	}
+
+	a.broadcastBeacon(c, "BEACON_RESTORED", beacon)
+	Respond(c, http.StatusOK, NewSuccessResponse(beacon, nil))
+}
+
+// broadcastBeacon sends a beacon event via WebSocket.
+func (a *API) broadcastBeacon(c *gin.Context, eventType string, beacon *data.Beacon) {
+	event := struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}{
+		Type:    eventType,
+		Payload: beacon,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Errorf("Error marshalling %s event: %v", eventType, err)
+	} else if a.Hub != nil {
+		a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+	}
+}
+
 // UpdateBeaconRequest defines the request body for updating a beacon.
 type UpdateBeaconRequest struct {
-	Note string `json:"note"`
+	// Note adds a note by the operator; see AddBeaconNote
+	Note      *string `json:"note"`
+	HighValue *bool   `json:"high_value"`
 }
 
 // UpdateBeacon handles the API request to update a beacon's metadata.
@@ -115,8 +189,18 @@ func (a *API) UpdateBeacon(c *gin.Context) {
 		return
 	}
 
-	updates := map[string]interface{}{
-		"note": req.Note,
+	if req.Note != nil {
+		note, err := a.BeaconService.AddNote(c.Request.Context(), beaconID, "", c.GetString("username"), *req.Note)
+		if err != nil {
+			respondNoteError(c, "Failed to add note", err)
+			return
+		}
+		a.broadcastNote(c, "NOTE_CREATED", note)
+	}
+
+	updates := map[string]interface{}{}
+	if req.HighValue != nil {
+		updates["high_value"] = *req.HighValue
 	}
 
 	err := a.BeaconService.UpdateBeaconMetadata(c.Request.Context(), beaconID, updates)
@@ -136,7 +220,7 @@ func (a *API) UpdateBeacon(c *gin.Context) {
 			Payload: beacon,
 		}
 		if eventBytes, err := json.Marshal(event); err == nil && a.Hub != nil {
-			a.Hub.Broadcast(eventBytes)
+			a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
 		}
 	}
 
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"simplec2/teamserver/data"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BuildProfileRequest defines the structure for the build profile create/update API request body.
+type BuildProfileRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Listener    string `json:"listener"`
+	Transport   string `json:"transport"`
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	Format      string `json:"format"`
+	CallbackURL string `json:"callback_url"`
+	Sleep       int    `json:"sleep"`
+	Jitter      int    `json:"jitter"`
+	KillDate    string `json:"kill_date"` // RFC3339, optional
+	Obfuscate   bool   `json:"obfuscate"`
+	UseDocker   bool   `json:"use_docker"`
+	ExportName  string `json:"export_name"`
+	ServiceName string `json:"service_name"`
+
+	GuardHostnames []string `json:"guard_hostnames"`
+	GuardNetworks  []string `json:"guard_networks"`
+}
+
+// toModel converts the request into a BuildProfile.
+func (r *BuildProfileRequest) toModel() (*data.BuildProfile, error) {
+	profile := &data.BuildProfile{
+		Name:        r.Name,
+		Description: r.Description,
+		Listener:    r.Listener,
+		Transport:   r.Transport,
+		OS:          r.OS,
+		Arch:        r.Arch,
+		Format:      r.Format,
+		CallbackURL: r.CallbackURL,
+		Sleep:       r.Sleep,
+		Jitter:      r.Jitter,
+		Obfuscate:   r.Obfuscate,
+		UseDocker:   r.UseDocker,
+		ExportName:  r.ExportName,
+		ServiceName: r.ServiceName,
+		GuardHosts:  strings.Join(r.GuardHostnames, ","),
+		GuardNets:   strings.Join(r.GuardNetworks, ","),
+	}
+	if r.KillDate != "" {
+		t, err := time.Parse(time.RFC3339, r.KillDate)
+		if err != nil {
+			return nil, err
+		}
+		profile.KillDate = &t
+	}
+	return profile, nil
+}
+
+// GetBuildProfiles handles the API request to list build profiles.
+func (a *API) GetBuildProfiles(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+
+	profiles, total, err := a.PayloadService.ListProfiles(c.Request.Context(), page, limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve build profiles", err.Error()))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(profiles, meta))
+}
+
+// GetBuildProfile handles the API request to retrieve a single build profile.
+func (a *API) GetBuildProfile(c *gin.Context) {
+	profile, err := a.PayloadService.GetProfile(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Build profile not found", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(profile, nil))
+}
+
+// CreateBuildProfile handles the API request to create a build profile.
+func (a *API) CreateBuildProfile(c *gin.Context) {
+	var req BuildProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	profile, err := req.toModel()
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'kill_date'", "must be an RFC3339 timestamp"))
+		return
+	}
+
+	if err := a.PayloadService.CreateProfile(c.Request.Context(), profile); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to create build profile", err.Error()))
+		return
+	}
+	Respond(c, http.StatusCreated, NewSuccessResponse(profile, nil))
+}
+
+// UpdateBuildProfile handles the API request to replace the options of a build profile.
+func (a *API) UpdateBuildProfile(c *gin.Context) {
+	var req BuildProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	profile, err := req.toModel()
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'kill_date'", "must be an RFC3339 timestamp"))
+		return
+	}
+
+	updated, err := a.PayloadService.UpdateProfile(c.Request.Context(), c.Param("name"), profile)
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Failed to update build profile", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(updated, nil))
+}
+
+// DeleteBuildProfile handles the API request to delete a build profile.
+func (a *API) DeleteBuildProfile(c *gin.Context) {
+	if err := a.PayloadService.DeleteProfile(c.Request.Context(), c.Param("name")); err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Failed to delete build profile", err.Error()))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrepareBurnRequest defines the structure for the burn preparation API request body.
+type PrepareBurnRequest struct {
+	Engagement      string `json:"engagement"` // Empty burns every engagement
+	WipeSessionKeys bool   `json:"wipe_session_keys"`
+	GracePeriod     *int   `json:"grace_period"` // Seconds, defaults to service.DefaultBurnGracePeriod
+}
+
+// ExecuteBurnRequest defines the structure for the burn execution API request body.
+type ExecuteBurnRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// PrepareBurn handles the API request to prepare a burn. The returned token must be sent to ExecuteBurn to carry it out.
+func (a *API) PrepareBurn(c *gin.Context) {
+	var req PrepareBurnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	options := service.BurnOptions{
+		Engagement:      req.Engagement,
+		WipeSessionKeys: req.WipeSessionKeys,
+		GracePeriod:     service.DefaultBurnGracePeriod,
+	}
+	if req.GracePeriod != nil {
+		options.GracePeriod = *req.GracePeriod
+	}
+
+	plan, err := a.BurnService.PrepareBurn(c.Request.Context(), c.GetString("username"), options)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to prepare burn", err.Error()))
+		return
+	}
+
+	a.alert(&service.SecurityAlert{
+		Name:     "burn_prepared",
+		Severity: 7,
+		Username: c.GetString("username"),
+		SourceIP: c.ClientIP(),
+		Message:  "burn prepared for " + burnTarget(options.Engagement) + " (" + strconv.FormatInt(plan.Beacons, 10) + " beacons, " + strconv.FormatInt(plan.Listeners, 10) + " listeners)",
+		Fields:   map[string]string{"engagement": options.Engagement, "wipe_session_keys": strconv.FormatBool(options.WipeSessionKeys)},
+	})
+	Respond(c, http.StatusOK, NewSuccessResponse(plan, nil))
+}
+
+// ExecuteBurn handles the API request to carry out a prepared burn.
+func (a *API) ExecuteBurn(c *gin.Context) {
+	var req ExecuteBurnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	report, err := a.BurnService.ExecuteBurn(c.Request.Context(), c.GetString("username"), req.Token)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to execute burn", err.Error()))
+		return
+	}
+
+	a.alert(&service.SecurityAlert{
+		Name:     "burn_executed",
+		Severity: 10,
+		Username: c.GetString("username"),
+		SourceIP: c.ClientIP(),
+		Message:  "burn executed for " + burnTarget(report.Options.Engagement) + ": exit queued for " + strconv.Itoa(len(report.ExitTasks)) + " beacons, " + strconv.Itoa(len(report.Listeners)) + " listeners to shut down",
+		Fields: map[string]string{
+			"engagement":        report.Options.Engagement,
+			"wipe_session_keys": strconv.FormatBool(report.Options.WipeSessionKeys),
+			"listeners":         strings.Join(report.Listeners, ","),
+			"errors":            strconv.Itoa(len(report.Errors)),
+		},
+	})
+
+	// Broadcast BURN_EXECUTED event via WebSocket
+	event := struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}{
+		Type:    "BURN_EXECUTED",
+		Payload: report,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Errorf("Error marshalling BURN_EXECUTED event: %v", err)
+	} else if a.Hub != nil {
+		if report.Options.Engagement == "" {
+			a.Hub.Broadcast(eventBytes)
+		} else {
+			a.Hub.BroadcastTo(report.Options.Engagement, eventBytes)
+		}
+	}
+
+	Respond(c, http.StatusOK, NewSuccessResponse(report, nil))
+}
+
+func burnTarget(engagement string) string {
+	if engagement == "" {
+		return "all engagements"
+	}
+	return "engagement '" + engagement + "'"
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateCanaryRequest defines the structure for registering a canary on a listener.
+type CreateCanaryRequest struct {
+	URI   string `json:"uri"`   // e.g. "/assets/logo.png"; a random path if empty
+	Label string `json:"label"` // Where the canary is planted
+}
+
+// GetCanaries handles the API request to list the canaries of a listener with their hit counters.
+func (a *API) GetCanaries(c *gin.Context) {
+	canaries, err := a.CanaryService.ListCanaries(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		respondCanaryError(c, "Failed to get canaries", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(canaries, nil))
+}
+
+// CreateCanary handles the API request to register a canary URI on a listener.
+func (a *API) CreateCanary(c *gin.Context) {
+	var req CreateCanaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	opts := service.CanaryOptions{URI: req.URI, Label: req.Label}
+	canary, err := a.CanaryService.CreateCanary(c.Request.Context(), c.Param("name"), opts, c.GetString("username"))
+	if err != nil {
+		respondCanaryError(c, "Failed to create canary", err)
+		return
+	}
+	Respond(c, http.StatusCreated, NewSuccessResponse(canary, nil))
+}
+
+// GetCanaryHits handles the API request to get the requests made for a canary, with their source.
+// 'hours' (default 168) is the period covered and 'limit' the number of hits returned.
+func (a *API) GetCanaryHits(c *gin.Context) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "168"))
+	if err != nil || hours < 1 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid hours parameter", "hours must be a positive integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil || limit < 0 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid limit parameter", "limit must be a positive integer"))
+		return
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	hits, err := a.CanaryService.GetHits(c.Request.Context(), c.Param("name"), c.Param("canary_id"), since, limit)
+	if err != nil {
+		respondCanaryError(c, "Failed to get canary hits", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(hits, nil))
+}
+
+// DeleteCanary handles the API request to remove a canary from a listener.
+func (a *API) DeleteCanary(c *gin.Context) {
+	if err := a.CanaryService.DeleteCanary(c.Request.Context(), c.Param("name"), c.Param("canary_id")); err != nil {
+		respondCanaryError(c, "Failed to delete canary", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{"message": "Canary deleted"}, nil))
+}
+
+// respondCanaryError maps canary errors to status codes.
+func respondCanaryError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, message, err.Error()))
+	case errors.Is(err, service.ErrInvalidCanary):
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, message, err.Error()))
+	case errors.Is(err, service.ErrCanaryExists):
+		Respond(c, http.StatusConflict, NewErrorResponse(http.StatusConflict, message, err.Error()))
+	default:
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, message, err.Error()))
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"simplec2/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChatMessageRequest defines the structure for the chat message API request body.
+type ChatMessageRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// GetChatMessages handles the API request to list the latest messages of the engagement's chat.
+// 'before' pages back through the history, 'limit' defaults to 50.
+func (a *API) GetChatMessages(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer between 1 and 200"))
+		return
+	}
+	var before uint64
+	if value := c.Query("before"); value != "" {
+		if before, err = strconv.ParseUint(value, 10, 32); err != nil {
+			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'before' parameter", "must be a message ID"))
+			return
+		}
+	}
+
+	messages, err := a.ChatService.ListMessages(c.Request.Context(), uint(before), limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve chat messages", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(messages, nil))
+}
+
+// SendChatMessage handles the API request to post a message to the engagement's chat.
+// The message is delivered to the team as a CHAT_MESSAGE event.
+func (a *API) SendChatMessage(c *gin.Context) {
+	var req ChatMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	message, err := a.ChatService.SendMessage(c.Request.Context(), c.GetString("username"), req.Body)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to send chat message", err.Error()))
+		return
+	}
+
+	event := struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}{
+		Type:    "CHAT_MESSAGE",
+		Payload: message,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Errorf("Error marshalling CHAT_MESSAGE event: %v", err)
+	} else if a.Hub != nil {
+		a.Hub.BroadcastTo(message.Engagement, eventBytes)
+	}
+
+	Respond(c, http.StatusCreated, NewSuccessResponse(message, nil))
+}
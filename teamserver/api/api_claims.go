@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ClaimBeaconRequest defines the request body for claiming a beacon.
+type ClaimBeaconRequest struct {
+	Note string `json:"note"`
+	// Force takes over a claim held by another operator; admins only
+	Force bool `json:"force"`
+}
+
+// ClaimBeacon handles the API request to claim a beacon, so other operators can't task it until it is released.
+func (a *API) ClaimBeacon(c *gin.Context) {
+	var req ClaimBeaconRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	if req.Force && c.GetString("role") != service.RoleAdmin {
+		Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "Only admins can take over a claim", ""))
+		return
+	}
+
+	claim, err := a.BeaconService.ClaimBeacon(c.Request.Context(), c.Param("beacon_id"), c.GetString("username"), req.Note, req.Force)
+	if err != nil {
+		respondClaimError(c, "Failed to claim beacon", err)
+		return
+	}
+
+	a.broadcastClaim(c, "BEACON_CLAIMED", claim)
+	Respond(c, http.StatusOK, NewSuccessResponse(claim, nil))
+}
+
+// ReleaseBeacon handles the API request to release a beacon claim. Admins can release
+// another operator's claim with 'force=true'.
+func (a *API) ReleaseBeacon(c *gin.Context) {
+	force := c.Query("force") == "true"
+	if force && c.GetString("role") != service.RoleAdmin {
+		Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "Only admins can release another operator's claim", ""))
+		return
+	}
+
+	claim, err := a.BeaconService.ReleaseBeacon(c.Request.Context(), c.Param("beacon_id"), c.GetString("username"), force)
+	if err != nil {
+		respondClaimError(c, "Failed to release beacon", err)
+		return
+	}
+
+	a.broadcastClaim(c, "BEACON_RELEASED", claim)
+	c.Status(http.StatusNoContent)
+}
+
+// GetClaims handles the API request to list the beacon claims in the engagement.
+func (a *API) GetClaims(c *gin.Context) {
+	claims, err := a.BeaconService.ListClaims(c.Request.Context())
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve claims", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(claims, nil))
+}
+
+// respondClaimError maps beacon claim errors to HTTP status codes.
+func respondClaimError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, message, err.Error()))
+	case errors.Is(err, service.ErrBeaconClaimed):
+		Respond(c, http.StatusConflict, NewErrorResponse(http.StatusConflict, message, err.Error()))
+	default:
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, message, err.Error()))
+	}
+}
+
+// broadcastClaim sends a beacon claim event via WebSocket.
+func (a *API) broadcastClaim(c *gin.Context, eventType string, claim *data.BeaconClaim) {
+	event := struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}{
+		Type:    eventType,
+		Payload: claim,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Errorf("Error marshalling %s event: %v", eventType, err)
+	} else if a.Hub != nil {
+		a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+	}
+}
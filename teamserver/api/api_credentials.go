@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"simplec2/teamserver/data"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CredentialRequest defines the structure for the credential create API request body.
+type CredentialRequest struct {
+	Username    string `json:"username" binding:"required"`
+	Domain      string `json:"domain"`
+	Secret      string `json:"secret"`
+	Type        string `json:"type"` // "password" (default), "ntlm", "ticket", "ssh_key", ...
+	Source      string `json:"source"`
+	BeaconID    string `json:"beacon_id"`    // Beacon the credential was harvested through
+	HostID      *uint  `json:"host_id"`      // Host the credential is valid on
+	HostAddress string `json:"host_address"` // Alternative to host_id, the host is added if unknown
+	Note        string `json:"note"`
+}
+
+// GetCredentials handles the API request to list credentials, optionally filtered by 'host_id'.
+func (a *API) GetCredentials(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+	var hostID *uint
+	if value := c.Query("host_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'host_id' parameter", "must be an integer"))
+			return
+		}
+		hostID = new(uint)
+		*hostID = uint(id)
+	}
+
+	credentials, total, err := a.CredentialService.ListCredentials(c.Request.Context(), hostID, page, limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve credentials", err.Error()))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(credentials, meta))
+}
+
+// CreateCredential handles the API request to record a credential.
+func (a *API) CreateCredential(c *gin.Context) {
+	var req CredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	source := req.Source
+	if source == "" {
+		source = "manual"
+	}
+	credential, err := a.CredentialService.CreateCredential(c.Request.Context(), &data.Credential{
+		Username:  req.Username,
+		Domain:    req.Domain,
+		Secret:    req.Secret,
+		Type:      req.Type,
+		Source:    source,
+		BeaconID:  req.BeaconID,
+		HostID:    req.HostID,
+		Note:      req.Note,
+		CreatedBy: c.GetString("username"),
+	}, req.HostAddress)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Beacon or host not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to create credential", err.Error()))
+		return
+	}
+
+	if credential.HostID != nil {
+		a.broadcastHostsUpdated(c)
+	}
+	Respond(c, http.StatusCreated, NewSuccessResponse(credential, nil))
+}
+
+// DeleteCredential handles the API request to delete a credential.
+func (a *API) DeleteCredential(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("credential_id"), 10, 32)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid credential ID", "must be an integer"))
+		return
+	}
+
+	if err := a.CredentialService.DeleteCredential(c.Request.Context(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Credential not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to delete credential", err.Error()))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
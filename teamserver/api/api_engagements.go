@@ -0,0 +1,223 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateEngagementRequest defines the structure for the engagement creation API request body.
+type CreateEngagementRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Members     []string `json:"members"` // Operators to add right away
+	// Target scope: CIDRs or IPs, and hostnames or "*.domain" wildcards. Empty means unrestricted.
+	ScopeNetworks []string `json:"scope_networks"`
+	ScopeHosts    []string `json:"scope_hosts"`
+}
+
+// UpdateEngagementRequest defines the structure for the engagement update API request body.
+// Omitted fields are left unchanged.
+type UpdateEngagementRequest struct {
+	Description   *string   `json:"description"`
+	ScopeNetworks *[]string `json:"scope_networks"`
+	ScopeHosts    *[]string `json:"scope_hosts"`
+}
+
+// AddEngagementMemberRequest defines the structure for the engagement member API request body.
+type AddEngagementMemberRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// EngagementMiddleware selects the engagement a request works in and scopes the request context to it.
+// The engagement comes from the X-Engagement header (or the engagement query parameter, for the WebSocket),
+// falling back to the operator's active engagement and then to the default engagement.
+// Service API keys are bound to the engagement they were created in.
+func (a *API) EngagementMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.GetHeader("X-Engagement")
+		if name == "" {
+			name = c.Query("engagement")
+		}
+
+		if v, ok := c.Get("apiKey"); ok {
+			key := v.(*data.ServiceAPIKey)
+			if name != "" && name != key.Engagement {
+				Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "No access to engagement", "this API key is bound to engagement '"+key.Engagement+"'"))
+				c.Abort()
+				return
+			}
+			name = key.Engagement
+		} else {
+			if name == "" {
+				if operator := currentOperator(c); operator != nil {
+					name = operator.ActiveEngagement
+				}
+			}
+			if name == "" {
+				name = service.DefaultEngagement
+			}
+			if err := a.EngagementService.CanAccess(c.Request.Context(), name, c.GetString("username"), c.GetString("role")); err != nil {
+				Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "No access to engagement", err.Error()))
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("engagement", name)
+		c.Request = c.Request.WithContext(service.WithEngagement(c.Request.Context(), name))
+		c.Next()
+	}
+}
+
+// GetEngagements handles the API request to list the engagements the operator can access.
+// The meta "active" field is the operator's active engagement.
+func (a *API) GetEngagements(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+
+	engagements, total, err := a.EngagementService.ListEngagements(c.Request.Context(), c.GetString("username"), c.GetString("role"), page, limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve engagements", err.Error()))
+		return
+	}
+
+	active := service.DefaultEngagement
+	if operator := currentOperator(c); operator != nil && operator.ActiveEngagement != "" {
+		active = operator.ActiveEngagement
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+		"active":      active,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(engagements, meta))
+}
+
+// GetEngagement handles the API request to retrieve an engagement and its members.
+func (a *API) GetEngagement(c *gin.Context) {
+	name := c.Param("name")
+	if err := a.EngagementService.CanAccess(c.Request.Context(), name, c.GetString("username"), c.GetString("role")); err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Engagement not found", err.Error()))
+		return
+	}
+
+	engagement, err := a.EngagementService.GetEngagement(c.Request.Context(), name)
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Engagement not found", err.Error()))
+		return
+	}
+	members, err := a.EngagementService.ListMembers(c.Request.Context(), name)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve engagement members", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{
+		"engagement": engagement,
+		"members":    members,
+	}, nil))
+}
+
+// CreateEngagement handles the API request to create an engagement.
+func (a *API) CreateEngagement(c *gin.Context) {
+	var req CreateEngagementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	engagement, err := a.EngagementService.CreateEngagement(c.Request.Context(), req.Name, req.Description, c.GetString("username"), req.ScopeNetworks, req.ScopeHosts)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to create engagement", err.Error()))
+		return
+	}
+	for _, username := range req.Members {
+		if err := a.EngagementService.AddMember(c.Request.Context(), engagement.Name, username); err != nil {
+			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Engagement created, but adding a member failed", err.Error()))
+			return
+		}
+	}
+	Respond(c, http.StatusCreated, NewSuccessResponse(engagement, nil))
+}
+
+// UpdateEngagement handles the API request to update an engagement.
+func (a *API) UpdateEngagement(c *gin.Context) {
+	var req UpdateEngagementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	engagement, err := a.EngagementService.UpdateEngagement(c.Request.Context(), c.Param("name"), &service.EngagementUpdate{
+		Description:   req.Description,
+		ScopeNetworks: req.ScopeNetworks,
+		ScopeHosts:    req.ScopeHosts,
+	})
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		Respond(c, status, NewErrorResponse(status, "Failed to update engagement", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(engagement, nil))
+}
+
+// AddEngagementMember handles the API request to grant an operator access to an engagement.
+func (a *API) AddEngagementMember(c *gin.Context) {
+	var req AddEngagementMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	if err := a.EngagementService.AddMember(c.Request.Context(), c.Param("name"), req.Username); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to add engagement member", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{"message": "Member added"}, nil))
+}
+
+// RemoveEngagementMember handles the API request to revoke an operator's access to an engagement.
+func (a *API) RemoveEngagementMember(c *gin.Context) {
+	if err := a.EngagementService.RemoveMember(c.Request.Context(), c.Param("name"), c.Param("username")); err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to remove engagement member", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{"message": "Member removed"}, nil))
+}
+
+// ActivateEngagement handles the API request to select the operator's active engagement.
+func (a *API) ActivateEngagement(c *gin.Context) {
+	name := c.Param("name")
+	if err := a.EngagementService.SetActiveEngagement(c.Request.Context(), c.GetString("username"), c.GetString("role"), name); err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, service.ErrNoEngagementAccess) {
+			status = http.StatusForbidden
+		}
+		Respond(c, status, NewErrorResponse(status, "Failed to activate engagement", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{"active": name}, nil))
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExternalRegisterRequest defines the structure for the external C2 beacon registration request body.
+type ExternalRegisterRequest struct {
+	Listener   string                         `json:"listener" binding:"required"` // Listener of type "external"
+	RemoteAddr string                         `json:"remote_addr"`                 // Where the implant connects from, the caller's address if empty
+	Metadata   service.ExternalBeaconMetadata `json:"metadata"`
+}
+
+// ExternalCheckInRequest defines the structure for the external C2 check-in request body.
+type ExternalCheckInRequest struct {
+	Listener     string   `json:"listener" binding:"required"`
+	RemoteAddr   string   `json:"remote_addr"`
+	AckedTaskIDs []string `json:"acked_task_ids"` // Tasks received on the previous check-in
+}
+
+// ExternalOutputRequest defines the structure for the external C2 task output request body.
+type ExternalOutputRequest struct {
+	Listener   string `json:"listener" binding:"required"`
+	RemoteAddr string `json:"remote_addr"`
+	service.ExternalOutput
+}
+
+// respondExternalC2Error responds with the status matching an external C2 API error.
+func respondExternalC2Error(c *gin.Context, message string, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrExternalListener):
+		code = http.StatusForbidden
+	case errors.Is(err, service.ErrExternalNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, service.ErrExternalInvalid):
+		code = http.StatusBadRequest
+	}
+	Respond(c, code, NewErrorResponse(code, message, err.Error()))
+}
+
+// externalRemoteAddr returns the implant's address from a request, defaulting to the caller's.
+func externalRemoteAddr(c *gin.Context, reported string) string {
+	if reported != "" {
+		return reported
+	}
+	return c.ClientIP()
+}
+
+// RegisterExternalBeacon handles the external C2 API request to register a third-party implant
+// as a beacon.
+func (a *API) RegisterExternalBeacon(c *gin.Context) {
+	var req ExternalRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	beaconID, err := a.ExternalC2.RegisterBeacon(c.Request.Context(), req.Listener, externalRemoteAddr(c, req.RemoteAddr), &req.Metadata)
+	if err != nil {
+		respondExternalC2Error(c, "Failed to register beacon", err)
+		return
+	}
+	Respond(c, http.StatusCreated, NewSuccessResponse(gin.H{"beacon_id": beaconID}, nil))
+}
+
+// ExternalCheckIn handles the external C2 API request to check a beacon in and fetch its tasks.
+func (a *API) ExternalCheckIn(c *gin.Context) {
+	var req ExternalCheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	tasks, err := a.ExternalC2.CheckIn(c.Request.Context(), req.Listener, c.Param("beacon_id"), externalRemoteAddr(c, req.RemoteAddr), req.AckedTaskIDs)
+	if err != nil {
+		respondExternalC2Error(c, "Failed to check in", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{"tasks": tasks}, nil))
+}
+
+// PushExternalOutput handles the external C2 API request to send the output of a task.
+func (a *API) PushExternalOutput(c *gin.Context) {
+	var req ExternalOutputRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	if req.TaskID == "" {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", "task_id is required"))
+		return
+	}
+
+	if err := a.ExternalC2.PushOutput(c.Request.Context(), req.Listener, c.Param("beacon_id"), externalRemoteAddr(c, req.RemoteAddr), &req.ExternalOutput); err != nil {
+		respondExternalC2Error(c, "Failed to save output", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetExternalTaskFile handles the external C2 API request for a chunk of the file a download or
+// upgrade task sends to the beacon. Chunks are 1 MB; a short or empty chunk ends the file.
+func (a *API) GetExternalTaskFile(c *gin.Context) {
+	chunk, err := strconv.ParseInt(c.DefaultQuery("chunk", "0"), 10, 32)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'chunk' parameter", "must be an integer"))
+		return
+	}
+
+	data, err := a.ExternalC2.GetTaskFileChunk(c.Request.Context(), c.Query("listener"), c.Param("beacon_id"), c.Param("task_id"), int32(chunk))
+	if err != nil {
+		respondExternalC2Error(c, "Failed to read task file", err)
+		return
+	}
+	c.Data(http.StatusOK, "application/octet-stream", data)
+}
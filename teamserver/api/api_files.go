@@ -1,16 +1,19 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 
+	"simplec2/teamserver/filecrypt"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -63,14 +66,19 @@ func (a *API) UploadChunk(c *gin.Context) {
 	}
 
 	chunkPath := filepath.Join(tmpDir, "chunk_"+chunkNumberStr)
-	file, err := os.Create(chunkPath)
+	file, err := filecrypt.Create(chunkPath, 0644)
 	if err != nil {
 		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to create chunk file", err.Error()))
 		return
 	}
-	defer file.Close()
 
 	if _, err := io.Copy(file, c.Request.Body); err != nil {
+		file.Close()
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to write chunk data", err.Error()))
+		return
+	}
+	// Encrypted files are only complete once closed
+	if err := file.Close(); err != nil {
 		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to write chunk data", err.Error()))
 		return
 	}
@@ -106,108 +114,57 @@ func (a *API) UploadComplete(c *gin.Context) {
 		return numA < numB
 	})
 
-	// Create final destination file
-	finalFileName := fmt.Sprintf("%s_%s", uuid.New().String(), filepath.Base(req.FileName))
-	finalPath := filepath.Join(a.Config.UploadsDir, finalFileName)
-
-	destFile, err := os.Create(finalPath)
+	// Merge into a temporary file first; the final name depends on the content hash
+	partPath := filepath.Join(a.Config.UploadsDir, fmt.Sprintf("%s.part", req.UploadID))
+	destFile, err := filecrypt.Create(partPath, 0644)
 	if err != nil {
 		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to create final file", err.Error()))
 		return
 	}
-	defer destFile.Close()
+	hash := sha256.New()
+	dest := io.MultiWriter(destFile, hash)
 
 	// Merge chunks
 	for _, entry := range entries {
 		chunkPath := filepath.Join(tmpDir, entry.Name())
-		chunkFile, err := os.Open(chunkPath)
+		chunkFile, err := filecrypt.Open(chunkPath)
 		if err != nil {
+			destFile.Close()
+			os.Remove(partPath)
 			Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to open chunk file", err.Error()))
 			return
 		}
-		if _, err := io.Copy(destFile, chunkFile); err != nil {
+		if _, err := io.Copy(dest, chunkFile); err != nil {
 			chunkFile.Close()
+			destFile.Close()
+			os.Remove(partPath)
 			Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to merge chunk file", err.Error()))
 			return
 		}
 		chunkFile.Close()
 	}
-
-	// Clean up temporary directory
-	if err := os.RemoveAll(tmpDir); err != nil {
-		// Log this error but don't fail the request, as the file has been successfully created.
-		fmt.Printf("Warning: failed to remove temporary upload directory %s: %v\n", tmpDir, err)
-	}
-
-	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{"filepath": finalPath}, nil))
-}
-
-// DownloadLootFile godoc
-// @Summary Download a loot file
-// @Description Downloads a file that was collected from a beacon and stored in the loot directory.
-// @Tags files
-// @Produce  octet-stream
-// @Param filename path string true "The name of the file to download"
-// @Success 200 {file} binary "File content"
-// @Failure 400 {object} gin.H{"error": string} "Bad request (e.g., invalid filename)"
-// @Failure 403 {object} gin.H{"error": string} "Access denied (e.g., path traversal attempt, trying to download a directory)"
-// @Failure 404 {object} gin.H{"error": string} "File not found"
-// @Failure 500 {object} gin.H{"error": string} "Internal server error"
-// @Router /files/loot/{filename} [get]
-// DownloadLootFile handles the API request to download a loot file.
-func (a *API) DownloadLootFile(c *gin.Context) {
-	// 1. Get and clean the filepath (supports task_id/filename format)
-	requestPath := c.Param("filepath")
-	// Remove leading slash from wildcard match
-	requestPath = strings.TrimPrefix(requestPath, "/")
-
-	// Security: check for path traversal
-	if strings.Contains(requestPath, "..") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filepath"})
-		return
-	}
-
-	// 2. Construct the full, cleaned path.
-	filePath := filepath.Clean(filepath.Join(a.Config.LootDir, requestPath))
-
-	// 3. Security Check: Ensure the final path is within the intended loot directory.
-	absLootDir, err := filepath.Abs(a.Config.LootDir)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error: could not resolve loot directory"})
-		return
-	}
-	absFilePath, err := filepath.Abs(filePath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error: could not resolve file path"})
+	if err := destFile.Close(); err != nil {
+		os.Remove(partPath)
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to write final file", err.Error()))
 		return
 	}
 
-	if !strings.HasPrefix(absFilePath, absLootDir) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: file is outside of the loot directory"})
+	// Identical uploads share one file: keep the existing copy if the content is already stored
+	sum := hex.EncodeToString(hash.Sum(nil))
+	finalPath := filepath.Join(a.Config.UploadsDir, fmt.Sprintf("%s_%s", sum, filepath.Base(req.FileName)))
+	if _, err := os.Stat(finalPath); err == nil {
+		os.Remove(partPath)
+	} else if err := os.Rename(partPath, finalPath); err != nil {
+		os.Remove(partPath)
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to write final file", err.Error()))
 		return
 	}
 
-	// 4. Check if the file exists and is not a directory.
-	fileInfo, err := os.Stat(absFilePath)
-	if os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
-		return
-	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error: could not stat file"})
-		return
-	}
-	if fileInfo.IsDir() {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: cannot download a directory"})
-		return
+	// Clean up temporary directory
+	if err := os.RemoveAll(tmpDir); err != nil {
+		// Log this error but don't fail the request, as the file has been successfully created.
+		fmt.Printf("Warning: failed to remove temporary upload directory %s: %v\n", tmpDir, err)
 	}
 
-	// 5. Serve the file with secure headers.
-	// Use RFC 5987 encoding for non-ASCII filenames (e.g., Chinese characters)
-	// Only use the actual filename (not the task_id directory) for download
-	downloadFilename := filepath.Base(requestPath)
-	encodedFilename := url.PathEscape(downloadFilename)
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", encodedFilename))
-	c.Header("X-Content-Type-Options", "nosniff")
-	c.File(absFilePath)
+	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{"filepath": finalPath, "sha256": sum}, nil))
 }
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Healthz handles the liveness probe. It only reports that the API is serving requests.
+// Like Readyz, it answers with a plain status object rather than the response envelope, for probes.
+func (a *API) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": service.HealthOK})
+}
+
+// Readyz handles the readiness probe: the database, the WebSocket hub, the gRPC bridge and free disk
+// space for loot and uploads. Returns 503 with the failed checks if any dependency is unavailable.
+func (a *API) Readyz(c *gin.Context) {
+	report := a.HealthService.Ready(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != service.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
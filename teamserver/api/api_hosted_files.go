@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HostFileRequest defines the structure for hosting a file on a listener.
+type HostFileRequest struct {
+	URI          string `json:"uri" binding:"required"` // e.g. "/static/update.ps1"
+	FilePath     string `json:"filepath"`               // Returned by /upload/complete
+	PayloadID    string `json:"payload_id"`             // Or a completed payload
+	ContentType  string `json:"content_type"`
+	MaxDownloads int64  `json:"max_downloads"` // 0 for no limit
+}
+
+// GetHostedFiles handles the API request to list the files hosted on a listener with their download counters.
+func (a *API) GetHostedFiles(c *gin.Context) {
+	files, err := a.HostedFileService.ListHostedFiles(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		respondHostedFileError(c, "Failed to get hosted files", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(files, nil))
+}
+
+// HostFile handles the API request to serve a file on a listener at a URI.
+func (a *API) HostFile(c *gin.Context) {
+	var req HostFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	opts := service.HostFileOptions{
+		URI:          req.URI,
+		FilePath:     req.FilePath,
+		PayloadID:    req.PayloadID,
+		ContentType:  req.ContentType,
+		MaxDownloads: req.MaxDownloads,
+	}
+	file, err := a.HostedFileService.HostFile(c.Request.Context(), c.Param("name"), opts, c.GetString("username"))
+	if err != nil {
+		respondHostedFileError(c, "Failed to host file", err)
+		return
+	}
+	Respond(c, http.StatusCreated, NewSuccessResponse(file, nil))
+}
+
+// UnhostFile handles the API request to stop serving a hosted file.
+func (a *API) UnhostFile(c *gin.Context) {
+	if err := a.HostedFileService.UnhostFile(c.Request.Context(), c.Param("name"), c.Param("file_id")); err != nil {
+		respondHostedFileError(c, "Failed to delete hosted file", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{"message": "Hosted file deleted"}, nil))
+}
+
+// respondHostedFileError maps hosted file errors to status codes.
+func respondHostedFileError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, message, err.Error()))
+	case errors.Is(err, service.ErrInvalidHostedFile):
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, message, err.Error()))
+	case errors.Is(err, service.ErrHostedFileExists):
+		Respond(c, http.StatusConflict, NewErrorResponse(http.StatusConflict, message, err.Error()))
+	default:
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, message, err.Error()))
+	}
+}
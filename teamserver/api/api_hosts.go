@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HostRequest defines the structure for the host import API request body.
+type HostRequest struct {
+	Address  string `json:"address" binding:"required"`
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	MAC      string `json:"mac"`
+	Ports    []int  `json:"ports"`
+	Note     string `json:"note"`
+}
+
+// GetHosts handles the API request to list the host inventory, optionally filtered by 'search'.
+func (a *API) GetHosts(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+
+	hosts, total, err := a.HostService.ListHosts(c.Request.Context(), c.Query("search"), page, limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve hosts", err.Error()))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(hosts, meta))
+}
+
+// GetHost handles the API request to retrieve a single host.
+func (a *API) GetHost(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("host_id"), 10, 32)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid host ID", "must be an integer"))
+		return
+	}
+
+	host, err := a.HostService.GetHost(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Host not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve host", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(host, nil))
+}
+
+// CreateHost handles the API request to add a host to the inventory, e.g. from an external scan.
+// A host with the same address is updated instead.
+func (a *API) CreateHost(c *gin.Context) {
+	var req HostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	host, err := a.HostService.SaveHost(c.Request.Context(), &data.Host{
+		Address:  req.Address,
+		Hostname: req.Hostname,
+		OS:       req.OS,
+		MAC:      req.MAC,
+		Ports:    req.Ports,
+		Note:     req.Note,
+		Source:   "import",
+	})
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to save host", err.Error()))
+		return
+	}
+
+	a.broadcastHostsUpdated(c, host.Address)
+	Respond(c, http.StatusCreated, NewSuccessResponse(host, nil))
+}
+
+// DeleteHost handles the API request to remove a host from the inventory.
+// Credentials tied to the host are kept, without the host.
+func (a *API) DeleteHost(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("host_id"), 10, 32)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid host ID", "must be an integer"))
+		return
+	}
+
+	if err := a.HostService.DeleteHost(c.Request.Context(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Host not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to delete host", err.Error()))
+		return
+	}
+
+	a.broadcastHostsUpdated(c)
+	c.Status(http.StatusNoContent)
+}
+
+// GetNetworkMap handles the API request for the network map: hosts grouped by network,
+// the beacons running on or discovering them and the credentials valid on them, as nodes and edges.
+func (a *API) GetNetworkMap(c *gin.Context) {
+	graph, err := a.HostService.NetworkMap(c.Request.Context())
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to build network map", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(graph, nil))
+}
+
+// broadcastHostsUpdated tells the engagement's clients to refresh the host inventory and network map.
+func (a *API) broadcastHostsUpdated(c *gin.Context, addresses ...string) {
+	if a.Hub == nil {
+		return
+	}
+	if addresses == nil {
+		addresses = []string{}
+	}
+	event := struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}{
+		Type:    "HOSTS_UPDATED",
+		Payload: gin.H{"addresses": addresses},
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Errorf("Error marshalling HOSTS_UPDATED event: %v", err)
+		return
+	}
+	a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+}
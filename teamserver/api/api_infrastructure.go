@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ProvisionRequest defines the structure for the redirector provisioning API request body.
+type ProvisionRequest struct {
+	Provider string                    `json:"provider" binding:"required"` // "digitalocean", "aws" or "hetzner"
+	Name     string                    `json:"name" binding:"required"`
+	Region   string                    `json:"region"` // Provider defaults if empty
+	Size     string                    `json:"size"`
+	Image    string                    `json:"image"`
+	Listener *ProvisionListenerRequest `json:"listener"` // Optional, deployed once the server is up
+}
+
+// ProvisionListenerRequest is the listener deployed on a provisioned server. It is registered in
+// the engagement unless it already exists.
+type ProvisionListenerRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Type   string `json:"type"` // "http" if empty
+	Config string `json:"config"`
+}
+
+// GetInfraProviders handles the API request to list the configured cloud providers and the SSH
+// key the TeamServer logs in to its servers with.
+func (a *API) GetInfraProviders(c *gin.Context) {
+	publicKey, err := a.InfraService.PublicKey()
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to load SSH key", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{
+		"providers":      a.InfraService.Providers(),
+		"ssh_public_key": publicKey,
+	}, nil))
+}
+
+// GetInfraAssets handles the API request to list the infrastructure assets of the engagement.
+func (a *API) GetInfraAssets(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+
+	assets, total, err := a.InfraService.ListAssets(c.Request.Context(), page, limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve assets", err.Error()))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(assets, meta))
+}
+
+// GetInfraAsset handles the API request to retrieve a single infrastructure asset.
+func (a *API) GetInfraAsset(c *gin.Context) {
+	asset, err := a.InfraService.GetAsset(c.Request.Context(), c.Param("asset_id"))
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Asset not found", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(asset, nil))
+}
+
+// ProvisionInfraAsset handles the API request to provision a redirector. The server is created in
+// the background; poll the asset or watch for INFRA_ASSET_UPDATED events until it is "ready".
+func (a *API) ProvisionInfraAsset(c *gin.Context) {
+	var req ProvisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	provision := &service.ProvisionRequest{
+		Provider: req.Provider,
+		Name:     req.Name,
+		Region:   req.Region,
+		Size:     req.Size,
+		Image:    req.Image,
+	}
+	if req.Listener != nil {
+		provision.Listener = &service.ProvisionListener{Name: req.Listener.Name, Type: req.Listener.Type, Config: req.Listener.Config}
+	}
+
+	asset, err := a.InfraService.Provision(c.Request.Context(), provision, c.GetString("username"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to provision server", err.Error()))
+		return
+	}
+	Respond(c, http.StatusAccepted, NewSuccessResponse(asset, nil))
+}
+
+// DestroyInfraAsset handles the API request to destroy the server of an asset. The server is
+// deleted in the background; the asset is kept as "destroyed".
+func (a *API) DestroyInfraAsset(c *gin.Context) {
+	asset, err := a.InfraService.Destroy(c.Request.Context(), c.Param("asset_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Asset not found", err.Error()))
+		case errors.Is(err, service.ErrAssetBusy):
+			Respond(c, http.StatusConflict, NewErrorResponse(http.StatusConflict, "Asset is busy", err.Error()))
+		default:
+			Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to destroy server", err.Error()))
+		}
+		return
+	}
+	Respond(c, http.StatusAccepted, NewSuccessResponse(asset, nil))
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SetListenerProbeRequest defines the structure for configuring a listener's external probe.
+type SetListenerProbeRequest struct {
+	URL          string `json:"url"`           // Public URL, e.g. "https://cdn.example.com/healthz" or "tcp://203.0.113.10:53"; empty disables probing
+	ExpectStatus int    `json:"expect_status"` // HTTP status expected; 0 accepts any status below 500
+}
+
+// SetListenerProbe handles the API request to set the URL a listener is probed at from the TeamServer.
+func (a *API) SetListenerProbe(c *gin.Context) {
+	var req SetListenerProbeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	listener, err := a.ListenerProbeService.SetProbe(c.Request.Context(), c.Param("name"), req.URL, req.ExpectStatus)
+	if err != nil {
+		respondListenerProbeError(c, "Failed to set listener probe", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(listener, nil))
+}
+
+// ProbeListener handles the API request to probe a listener now.
+func (a *API) ProbeListener(c *gin.Context) {
+	result, err := a.ListenerProbeService.Probe(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		respondListenerProbeError(c, "Failed to probe listener", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(result, nil))
+}
+
+// GetListenerProbes handles the API request to get the reachability history of a listener.
+// 'hours' (default 24) is the period covered and 'limit' the number of results returned.
+func (a *API) GetListenerProbes(c *gin.Context) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours < 1 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid hours parameter", "hours must be a positive integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil || limit < 0 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid limit parameter", "limit must be a positive integer"))
+		return
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	history, err := a.ListenerProbeService.History(c.Request.Context(), c.Param("name"), since, limit)
+	if err != nil {
+		respondListenerProbeError(c, "Failed to get listener probes", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(history, nil))
+}
+
+// respondListenerProbeError maps listener probe errors to status codes.
+func respondListenerProbeError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, message, err.Error()))
+	case errors.Is(err, service.ErrInvalidProbe):
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, message, err.Error()))
+	default:
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, message, err.Error()))
+	}
+}
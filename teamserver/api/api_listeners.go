@@ -1,31 +1,83 @@
 package api
 
 import (
-	"archive/zip"
-	"bytes"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
+	"errors"
 	"fmt"
 	"math"
+	"net"
 	"net/http"
-	"os"
-	"path/filepath"
-	"simplec2/pkg/config"
 	"simplec2/pkg/logger"
 	"simplec2/pkg/pki"
+	"simplec2/teamserver/service"
 	"strconv"
-	"strings" // Import strings
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
 )
 
 // CreateListenerRequest defines the structure for the listener creation API request body.
 type CreateListenerRequest struct {
-	Name   string `json:"name" binding:"required"`
-	Type   string `json:"type" binding:"required"`
-	Config string `json:"config"`
+	Name        string                      `json:"name" binding:"required"`
+	Type        string                      `json:"type" binding:"required"`
+	Config      string                      `json:"config"`
+	Certificate *ListenerCertificateRequest `json:"certificate"` // Optional, defaults otherwise
+}
+
+// DeployListenerRequest defines the structure for the listener deployment API request body.
+type DeployListenerRequest struct {
+	Host           string                      `json:"host" binding:"required"`     // Host name or IP, optionally with ":port"
+	User           string                      `json:"user"`                        // "root" if empty; other users need passwordless sudo
+	HostKey        string                      `json:"host_key" binding:"required"` // e.g. the content of /etc/ssh/ssh_host_ed25519_key.pub
+	Password       string                      `json:"password"`                    // Uses the TeamServer's SSH key if empty
+	TeamServerHost string                      `json:"teamserver_host"`             // infrastructure.teamserver_host if empty
+	Certificate    *ListenerCertificateRequest `json:"certificate"`                 // Optional, defaults otherwise
+}
+
+// ListenerCertificateRequest customizes the mTLS client certificate of a listener, e.g. to issue
+// short-lived certificates or follow the naming conventions of a corporate PKI.
+type ListenerCertificateRequest struct {
+	CommonName         string   `json:"common_name"`    // "SimpleC2 Listener - <name>" if empty
+	KeyType            string   `json:"key_type"`       // "ecdsa" (default) or "rsa"
+	Curve              string   `json:"curve"`          // "P-256" (default), "P-384" or "P-521"
+	RSABits            int      `json:"rsa_bits"`       // 2048 (default), 3072 or 4096
+	ValidityHours      int      `json:"validity_hours"` // 365 days if 0
+	DNSNames           []string `json:"dns_names"`
+	IPAddresses        []string `json:"ip_addresses"`
+	EmailAddresses     []string `json:"email_addresses"`
+	Organization       []string `json:"organization"` // "SimpleC2" if empty
+	OrganizationalUnit []string `json:"organizational_unit"`
+	Country            []string `json:"country"`
+	Province           []string `json:"province"`
+	Locality           []string `json:"locality"`
+}
+
+// certConfig builds the certificate configuration for a listener. r may be nil.
+func (r *ListenerCertificateRequest) certConfig(listenerName string) (pki.CertConfig, error) {
+	cfg := service.ListenerCertConfig(listenerName)
+	if r == nil {
+		return cfg, nil
+	}
+	if r.CommonName != "" {
+		cfg.CommonName = r.CommonName
+	}
+	if r.ValidityHours < 0 {
+		return cfg, fmt.Errorf("validity_hours must not be negative")
+	}
+	for _, address := range r.IPAddresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return cfg, fmt.Errorf("invalid IP address '%s'", address)
+		}
+		cfg.IPs = append(cfg.IPs, ip)
+	}
+	cfg.KeyType, cfg.Curve, cfg.RSABits = r.KeyType, r.Curve, r.RSABits
+	cfg.Validity = time.Duration(r.ValidityHours) * time.Hour
+	cfg.DNSNames, cfg.Emails = r.DNSNames, r.EmailAddresses
+	cfg.Organization, cfg.OrganizationalUnit = r.Organization, r.OrganizationalUnit
+	cfg.Country, cfg.Province, cfg.Locality = r.Country, r.Province, r.Locality
+	return cfg, cfg.Validate()
 }
 
 // CreateListener godoc
@@ -36,8 +88,9 @@ type CreateListenerRequest struct {
 // @Produce  application/zip
 // @Param listener body CreateListenerRequest true "Listener details"
 // @Success 200 {file} binary
-// @Failure 400 {object} gin.H{"error": string} "Invalid request body"
-// @Failure 500 {object} gin.H{"error": string} "Internal server error"
+// @Success 201 {object} StandardResponse{data=data.Listener} "Listeners of type \"external\" get no bundle"
+// @Failure 400 {object} StandardResponse "Invalid request body"
+// @Failure 500 {object} StandardResponse "Internal server error"
 // @Router /listeners [post]
 func (a *API) CreateListener(c *gin.Context) {
 	var req CreateListenerRequest
@@ -45,168 +98,179 @@ func (a *API) CreateListener(c *gin.Context) {
 		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
 		return
 	}
+	certConfig, err := req.Certificate.certConfig(req.Name)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid certificate parameters", err.Error()))
+		return
+	}
 
-	// 1. Load CA
-	caCertPath := a.Config.GRPC.Certs.CACert
-	// Assuming ca.key is in the same directory as ca.crt
-	caKeyPath := filepath.Join(filepath.Dir(caCertPath), "ca.key")
+	// The listener belongs to the selected engagement; it is registered now so that it
+	// lands there when it first connects (a name taken in another engagement is rejected)
+	listener, err := a.ListenerService.GetListener(c.Request.Context(), req.Name)
+	if err != nil {
+		listener, err = a.ListenerService.CreateListener(c.Request.Context(), req.Name, req.Type, req.Config)
+		if err != nil {
+			Respond(c, http.StatusConflict, NewErrorResponse(http.StatusConflict, "Failed to register listener", err.Error()))
+			return
+		}
 
-	caCertPEM, err := os.ReadFile(caCertPath)
+		// Broadcast LISTENER_CREATED event via WebSocket
+		event := struct {
+			Type    string      `json:"type"`
+			Payload interface{} `json:"payload"`
+		}{
+			Type:    "LISTENER_CREATED",
+			Payload: listener,
+		}
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			logger.Ctx(c.Request.Context()).Errorf("Error marshalling LISTENER_CREATED event: %v", err)
+		} else if a.Hub != nil {
+			a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+		}
+	}
+
+	// External listeners are reached through the external C2 API and need no certificate
+	if listener.Type == service.ExternalListenerType {
+		Respond(c, http.StatusCreated, NewSuccessResponse(listener, nil))
+		return
+	}
+
+	bundle, err := service.NewListenerBundle(c.Request.Context(), a.Config, a.PKIService, a.ListenerService, req.Name, req.Config, certConfig, "")
 	if err != nil {
-		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to read CA certificate", err.Error()))
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to generate listener bundle", err.Error()))
 		return
 	}
-	caKeyPEM, err := os.ReadFile(caKeyPath)
+	zipData, err := bundle.Zip()
 	if err != nil {
-		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to read CA private key", err.Error()))
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to create zip", err.Error()))
 		return
 	}
 
-	// 2. Generate Keys & Certs
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"listener_%s.zip\"", req.Name))
+	c.Data(http.StatusOK, "application/zip", zipData)
+}
 
+// RebundleListenerRequest defines the structure for the listener rebundle API request body, which is optional.
+type RebundleListenerRequest struct {
+	TeamServerHost string                      `json:"teamserver_host"` // "localhost" if empty
+	Certificate    *ListenerCertificateRequest `json:"certificate"`     // Optional, defaults otherwise
+}
 
-	// mTLS Client Cert
-	clientPriv, clientCert, err := pki.GenerateCert(pki.CertConfig{
-		CommonName: "SimpleC2 Listener - " + req.Name,
-		IsClient:   true,
-	}, caCertPEM, caKeyPEM)
+// RebundleListener godoc
+// @Summary Rotate a listener's credentials
+// @Description Revokes the listener's client certificates, issues a new one, rotates its API key and returns a fresh configuration ZIP. The listener keeps its name, beacons and history; the running instance can no longer call the TeamServer until it is replaced with the new bundle.
+// @Tags listeners
+// @Accept  json
+// @Produce  application/zip
+// @Param name path string true "Listener name"
+// @Param options body RebundleListenerRequest false "Host and certificate parameters"
+// @Success 200 {file} binary
+// @Failure 400 {object} StandardResponse "Invalid request body"
+// @Failure 404 {object} StandardResponse "Listener not found"
+// @Failure 500 {object} StandardResponse "Internal server error"
+// @Router /listeners/{name}/rebundle [post]
+func (a *API) RebundleListener(c *gin.Context) {
+	var req RebundleListenerRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+			return
+		}
+	}
+	name := c.Param("name")
+	certConfig, err := req.Certificate.certConfig(name)
 	if err != nil {
-		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to generate client certificate", err.Error()))
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid certificate parameters", err.Error()))
 		return
 	}
 
-	// Parse generated certificate to extract Serial Number
-	block, _ := pem.Decode(clientCert)
-	if block == nil {
-		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to decode generated certificate", "PEM decode failed"))
-		return
-	}
-	parsedCert, err := x509.ParseCertificate(block.Bytes)
+	listener, err := a.ListenerService.GetListener(c.Request.Context(), name)
 	if err != nil {
-		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to parse generated certificate", err.Error()))
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Listener not found", err.Error()))
 		return
 	}
-	
-	// Record issued certificate
-	if err := a.ListenerService.RecordIssuedCertificate(c.Request.Context(), parsedCert.SerialNumber.String(), parsedCert.Subject.CommonName, req.Name); err != nil {
-		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to record issued certificate", err.Error()))
+	if listener.Type == service.ExternalListenerType {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to rebundle listener", "listeners of type \"external\" have no bundle"))
 		return
 	}
 
-	// 3. Generate listener.yaml
-	// Parse the raw JSON config from request to get port
-	var configMap map[string]interface{}
-	if err := json.Unmarshal([]byte(req.Config), &configMap); err != nil {
-		configMap = make(map[string]interface{})
-	}
-	portStr := ":8888" // Default listener port
-	if p, ok := configMap["port"]; ok {
-		switch v := p.(type) {
-		case float64: // JSON numbers are float64 by default
-			if v == 0 {
-				portStr = ":8888" // Explicitly use default if 0 is provided
-			} else {
-				portStr = fmt.Sprintf(":%d", int(v))
-			}
-		case string: // Could be ":8080" or "8080"
-			trimmed := strings.TrimSpace(v)
-			if trimmed == "0" || trimmed == ":0" || trimmed == "" {
-				portStr = ":8888"
-			} else if !strings.HasPrefix(trimmed, ":") {
-				portStr = ":" + trimmed
-			} else {
-				portStr = trimmed
-			}
-		default:
-			// Invalid port type, stick with default
-			portStr = ":8888"
-		}
+	// Revoked first, the new certificate is recorded for the same listener
+	if err := a.ListenerService.RevokeCertificateForListener(c.Request.Context(), name); err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to revoke listener certificates", err.Error()))
+		return
 	}
-	// Ensure portStr is never empty or just ":" after processing
-	if portStr == "" || portStr == ":" {
-		portStr = ":8888"
+	bundle, err := service.NewListenerBundle(c.Request.Context(), a.Config, a.PKIService, a.ListenerService, name, listener.Config, certConfig, req.TeamServerHost)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to generate listener bundle", err.Error()))
+		return
 	}
-
-	// We need to fetch the API Key. In a real scenario, we might generate a new specific API Key for this listener.
-	// For now, let's use the TeamServer's configured API Key (or the one from config).
-	// NOTE: Ideally, we should generate a unique API Key for each listener for better security/revocation.
-	apiKey, _ := a.Config.Auth.GetAPIKey()
-	
-	listenerCfg := config.ListenerConfig{
-		TeamServer: struct {
-			Host string `yaml:"host"`
-			Port string `yaml:"port"`
-		}{
-			Host: "localhost", // Users should probably update this manually or we detect TS public IP
-			Port: a.Config.GRPC.Port,
-		},
-		Listener: struct {
-			Name string `yaml:"name"`
-			Port string `yaml:"port"`
-		}{
-			Name: req.Name,
-			Port: portStr,
-		},
-		Auth: struct {
-			APIKey           string `yaml:"api_key,omitempty"`
-			EncryptedAPIKey  *config.EncryptedAPIKey `yaml:"encrypted_api_key,omitempty"`
-		}{
-			APIKey: apiKey, // In production, encrypt this!
-		},
-		Certs: struct {
-			ClientCert string `yaml:"client_cert"`
-			ClientKey  string `yaml:"client_key"`
-			CACert     string `yaml:"ca_cert"`
-			PrivateKey string `yaml:"private_key"`
-		}{
-			ClientCert: "./certs/client.crt",
-			ClientKey:  "./certs/client.key",
-			CACert:     "./certs/ca.crt",
-			PrivateKey: "./certs/listener_rsa.key",
-		},
-	}
-	
-	yamlData, err := yaml.Marshal(&listenerCfg)
+	zipData, err := bundle.Zip()
 	if err != nil {
-		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to marshal listener config", err.Error()))
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to create zip", err.Error()))
 		return
 	}
 
+	a.alert(&service.SecurityAlert{
+		Name:     "listener_credentials_rotated",
+		Severity: 5,
+		Username: c.GetString("username"),
+		SourceIP: c.ClientIP(),
+		Message:  "credentials of listener " + name + " rotated",
+		Fields:   map[string]string{"listener": name, "serial": bundle.CertificateSerial},
+	})
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"listener_%s.zip\"", name))
+	c.Data(http.StatusOK, "application/zip", zipData)
+}
 
-	// 4. Create ZIP
-	buf := new(bytes.Buffer)
-	zipWriter := zip.NewWriter(buf)
-
-	files := map[string][]byte{
-		"listener.yaml":        yamlData,
-		"certs/client.crt":     clientCert,
-		"certs/client.key":     clientPriv,
-		"certs/ca.crt":         caCertPEM,
-		//"certs/listener_rsa.key": rsaPriv, // Removed
-		//"listener.pub":         rsaPub, // Removed
+// DeployListener godoc
+// @Summary Deploy a listener over SSH
+// @Description Issues a new certificate bundle for a listener, installs it with the listener binary on a remote host as a systemd service, and waits until the listener's control channel comes up.
+// @Tags listeners
+// @Accept  json
+// @Produce  json
+// @Param name path string true "Listener name"
+// @Param target body DeployListenerRequest true "Host to deploy to"
+// @Success 200 {object} StandardResponse{data=service.ListenerDeployment}
+// @Failure 400 {object} StandardResponse "Invalid request body"
+// @Failure 404 {object} StandardResponse "Listener not found"
+// @Failure 502 {object} StandardResponse "Logging in to the host or installing the listener failed"
+// @Failure 504 {object} StandardResponse "The listener did not connect, with its recent logs"
+// @Router /listeners/{name}/deploy [post]
+func (a *API) DeployListener(c *gin.Context) {
+	var req DeployListenerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
 	}
-
-	for name, content := range files {
-		f, err := zipWriter.Create(name)
-		if err != nil {
-			Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to create zip entry", err.Error()))
-			return
-		}
-		_, err = f.Write(content)
-		if err != nil {
-			Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to write zip entry", err.Error()))
-			return
-		}
+	name := c.Param("name")
+	certConfig, err := req.Certificate.certConfig(name)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid certificate parameters", err.Error()))
+		return
 	}
 
-	if err := zipWriter.Close(); err != nil {
-		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to close zip", err.Error()))
+	deployment, err := a.InfraService.DeployListener(c.Request.Context(), name, &service.DeployTarget{
+		Address:        req.Host,
+		User:           req.User,
+		HostKey:        req.HostKey,
+		Password:       req.Password,
+		TeamServerHost: req.TeamServerHost,
+	}, certConfig)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Listener not found", err.Error()))
+		case errors.Is(err, service.ErrListenerNotConnected):
+			Respond(c, http.StatusGatewayTimeout, NewErrorResponse(http.StatusGatewayTimeout, "Listener did not connect", err.Error()))
+		case errors.Is(err, service.ErrDeployFailed):
+			Respond(c, http.StatusBadGateway, NewErrorResponse(http.StatusBadGateway, "Failed to deploy listener", err.Error()))
+		default:
+			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to deploy listener", err.Error()))
+		}
 		return
 	}
-
-	// 5. Return response
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"listener_%s.zip\"", req.Name))
-	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+	Respond(c, http.StatusOK, NewSuccessResponse(deployment, nil))
 }
 
 // GetListeners godoc
@@ -272,21 +336,21 @@ func (a *API) DeleteListener(c *gin.Context) {
 		return
 	}
 
-	// Broadcast LISTENER_STOPPED event via WebSocket
+	// Broadcast LISTENER_DELETED event via WebSocket
 	event := struct {
 		Type    string      `json:"type"`
 		Payload interface{} `json:"payload"`
 	}{
-		Type:    "LISTENER_STOPPED",
+		Type:    "LISTENER_DELETED",
 		Payload: listener,
 	}
 	eventBytes, err := json.Marshal(event)
 	if err != nil {
-		logger.Errorf("Error marshalling LISTENER_STOPPED event: %v", err)
+		logger.Ctx(c.Request.Context()).Errorf("Error marshalling LISTENER_DELETED event: %v", err)
 	} else {
 		if a.Hub != nil {
-			a.Hub.Broadcast(eventBytes)
-			logger.Debugf("Broadcasted LISTENER_STOPPED event for %s", listenerName)
+			a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+			logger.Ctx(c.Request.Context()).Debugf("Broadcasted LISTENER_DELETED event for %s", listenerName)
 		}
 	}
 
@@ -304,7 +368,7 @@ func (a *API) StartListener(c *gin.Context) {
 	// Get updated listener info for broadcasting
 	listener, err := a.ListenerService.GetListener(c.Request.Context(), name)
 	if err != nil {
-		logger.Errorf("Failed to get listener %s after start for broadcasting: %v", name, err)
+		logger.Ctx(c.Request.Context()).Errorf("Failed to get listener %s after start for broadcasting: %v", name, err)
 	} else {
 		// Broadcast LISTENER_STARTED event
 		event := struct {
@@ -317,8 +381,8 @@ func (a *API) StartListener(c *gin.Context) {
 		eventBytes, err := json.Marshal(event)
 		if err == nil {
 			if a.Hub != nil {
-				a.Hub.Broadcast(eventBytes)
-				logger.Debugf("Broadcasted LISTENER_STARTED event for %s", name)
+				a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+				logger.Ctx(c.Request.Context()).Debugf("Broadcasted LISTENER_STARTED event for %s", name)
 			}
 		}
 	}
@@ -337,7 +401,7 @@ func (a *API) StopListener(c *gin.Context) {
 	// Get updated listener info for broadcasting
 	listener, err := a.ListenerService.GetListener(c.Request.Context(), name)
 	if err != nil {
-		logger.Errorf("Failed to get listener %s after stop for broadcasting: %v", name, err)
+		logger.Ctx(c.Request.Context()).Errorf("Failed to get listener %s after stop for broadcasting: %v", name, err)
 	} else {
 		// Broadcast LISTENER_STOPPED event
 		event := struct {
@@ -350,8 +414,8 @@ func (a *API) StopListener(c *gin.Context) {
 		eventBytes, err := json.Marshal(event)
 		if err == nil {
 			if a.Hub != nil {
-				a.Hub.Broadcast(eventBytes)
-				logger.Debugf("Broadcasted LISTENER_STOPPED event for %s", name)
+				a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+				logger.Ctx(c.Request.Context()).Debugf("Broadcasted LISTENER_STOPPED event for %s", name)
 			}
 		}
 	}
@@ -370,7 +434,7 @@ func (a *API) RestartListener(c *gin.Context) {
 	// Get updated listener info for broadcasting
 	listener, err := a.ListenerService.GetListener(c.Request.Context(), name)
 	if err != nil {
-		logger.Errorf("Failed to get listener %s after restart for broadcasting: %v", name, err)
+		logger.Ctx(c.Request.Context()).Errorf("Failed to get listener %s after restart for broadcasting: %v", name, err)
 	} else {
 		// Broadcast LISTENER_STARTED event
 		event := struct {
@@ -383,8 +447,8 @@ func (a *API) RestartListener(c *gin.Context) {
 		eventBytes, err := json.Marshal(event)
 		if err == nil {
 			if a.Hub != nil {
-				a.Hub.Broadcast(eventBytes)
-				logger.Debugf("Broadcasted LISTENER_STARTED event for %s", name)
+				a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+				logger.Ctx(c.Request.Context()).Debugf("Broadcasted LISTENER_STARTED event for %s", name)
 			}
 		}
 	}
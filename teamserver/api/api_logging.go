@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"simplec2/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LogLevelsRequest defines the structure for the log level change API request body.
+type LogLevelsRequest struct {
+	Level string `json:"level"` // Global level; unchanged if empty
+	// Component levels; an empty level removes the override, so the component follows the global level
+	Components map[string]string `json:"components"`
+}
+
+// LogLevels is the global log level and the component overrides.
+type LogLevels struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+	Known      []string          `json:"known_components"`
+}
+
+func currentLogLevels() LogLevels {
+	level, components := logger.Levels()
+	return LogLevels{Level: level, Components: components, Known: logger.Components}
+}
+
+// GetLogLevels handles the API request for the current log levels.
+func (a *API) GetLogLevels(c *gin.Context) {
+	Respond(c, http.StatusOK, NewSuccessResponse(currentLogLevels(), nil))
+}
+
+// SetLogLevels handles the API request to change log levels until the next restart. Nothing is
+// changed if any level or component is invalid.
+func (a *API) SetLogLevels(c *gin.Context) {
+	var req LogLevelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	if req.Level != "" {
+		if _, err := logger.ParseLevel(req.Level); err != nil {
+			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid log level", err.Error()))
+			return
+		}
+	}
+	for component, level := range req.Components {
+		if !logger.IsComponent(component) {
+			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid log component", "known components are "+strings.Join(logger.Components, ", ")))
+			return
+		}
+		if level == "" {
+			continue
+		}
+		if _, err := logger.ParseLevel(level); err != nil {
+			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid log level", err.Error()))
+			return
+		}
+	}
+
+	if req.Level != "" {
+		logger.SetLevel("", req.Level)
+	}
+	for component, level := range req.Components {
+		logger.SetLevel(component, level)
+	}
+	levels := currentLogLevels()
+	logger.Ctx(c.Request.Context()).Infof("Log levels changed by %s: %s %v", c.GetString("username"), levels.Level, levels.Components)
+	Respond(c, http.StatusOK, NewSuccessResponse(levels, nil))
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UpdateLootRequest defines the structure for the loot update API request body.
+// Omitted fields are left unchanged; "tags" replaces the whole tag list.
+type UpdateLootRequest struct {
+	Tags  []string `json:"tags"`
+	Notes *string  `json:"notes"`
+}
+
+// CleanupLootRequest defines the structure for the loot cleanup API request body.
+// At least one filter is required, so a cleanup never wipes all loot by accident.
+type CleanupLootRequest struct {
+	Engagement    string `json:"engagement"`
+	Type          string `json:"type"`
+	Tag           string `json:"tag"`
+	BeaconID      string `json:"beacon_id"`
+	OlderThanDays int    `json:"older_than_days"`
+	DryRun        bool   `json:"dry_run"`
+}
+
+// GetLoot handles the API request to list loot, filtered by 'search', 'tag', 'type', 'beacon_id' and 'task_id'.
+func (a *API) GetLoot(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+
+	query := &data.LootQuery{
+		Page:     page,
+		Limit:    limit,
+		Search:   c.Query("search"),
+		Tag:      c.Query("tag"),
+		Type:     c.Query("type"),
+		BeaconID: c.Query("beacon_id"),
+		TaskID:   c.Query("task_id"),
+	}
+	items, total, err := a.LootService.ListLoot(c.Request.Context(), query)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve loot", err.Error()))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(items, meta))
+}
+
+// GetBeaconScreenshots handles the API request to list a beacon's screenshots, newest first,
+// with thumbnails so a gallery can be shown without downloading the full images.
+func (a *API) GetBeaconScreenshots(c *gin.Context) {
+	beaconID := c.Param("beacon_id")
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+	if limit < 1 || limit > 100 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be between 1 and 100"))
+		return
+	}
+
+	if _, err := a.BeaconService.GetBeacon(c.Request.Context(), beaconID); err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Beacon not found", err.Error()))
+		return
+	}
+	screenshots, total, err := a.LootService.ListScreenshots(c.Request.Context(), beaconID, page, limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve screenshots", err.Error()))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(screenshots, meta))
+}
+
+// GetLootItem handles the API request to retrieve the metadata of a single loot item.
+func (a *API) GetLootItem(c *gin.Context) {
+	item, err := a.LootService.GetLoot(c.Request.Context(), c.Param("loot_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Loot not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve loot", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(item, nil))
+}
+
+// DownloadLootFile handles the API request to download the file of a loot item.
+func (a *API) DownloadLootFile(c *gin.Context) {
+	item, file, err := a.LootService.OpenLoot(c.Request.Context(), c.Param("loot_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Loot not found", err.Error()))
+		case errors.Is(err, os.ErrNotExist):
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Loot file not found", err.Error()))
+		default:
+			Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve loot", err.Error()))
+		}
+		return
+	}
+	defer file.Close()
+
+	// Use RFC 5987 encoding for non-ASCII filenames (e.g., Chinese characters)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(item.FileName)))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("X-Content-Type-Options", "nosniff")
+	// Files are decrypted as they are streamed, range requests included
+	http.ServeContent(c.Writer, c.Request, item.FileName, item.UpdatedAt, file)
+}
+
+// UpdateLootItem handles the API request to change the tags and notes of a loot item.
+func (a *API) UpdateLootItem(c *gin.Context) {
+	var req UpdateLootRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	item, err := a.LootService.UpdateLoot(c.Request.Context(), c.Param("loot_id"), req.Tags, req.Notes)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Loot not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to update loot", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(item, nil))
+}
+
+// DeleteLootItem handles the API request to delete a loot item and its file.
+func (a *API) DeleteLootItem(c *gin.Context) {
+	if err := a.LootService.DeleteLoot(c.Request.Context(), c.Param("loot_id")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Loot not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to delete loot", err.Error()))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetLootUsage handles the API request to show the loot storage used per engagement and its quota.
+// Restricted to one engagement by the 'engagement' query parameter.
+func (a *API) GetLootUsage(c *gin.Context) {
+	ctx := c.Request.Context()
+	if engagement := c.Query("engagement"); engagement != "" {
+		ctx = service.WithEngagement(ctx, engagement)
+	}
+	usage, err := a.LootService.Usage(ctx)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve loot usage", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(usage, nil))
+}
+
+// CleanupLoot handles the API request to delete loot in bulk, e.g. everything older than 30 days.
+func (a *API) CleanupLoot(c *gin.Context) {
+	var req CleanupLootRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	if req.OlderThanDays < 0 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'older_than_days'", "must not be negative"))
+		return
+	}
+	if req.Engagement == "" && req.Type == "" && req.Tag == "" && req.BeaconID == "" && req.OlderThanDays == 0 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "No cleanup filter", "set at least one of engagement, type, tag, beacon_id or older_than_days"))
+		return
+	}
+
+	query := &data.LootQuery{
+		Engagement: req.Engagement,
+		Type:       req.Type,
+		Tag:        req.Tag,
+		BeaconID:   req.BeaconID,
+	}
+	if req.OlderThanDays > 0 {
+		before := time.Now().AddDate(0, 0, -req.OlderThanDays)
+		query.CreatedBefore = &before
+	}
+	deleted, freed, err := a.LootService.Cleanup(c.Request.Context(), query, req.DryRun)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to clean up loot", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{"deleted": deleted, "freed_bytes": freed, "dry_run": req.DryRun}, nil))
+}
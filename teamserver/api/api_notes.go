@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// NoteRequest defines the request body for adding or editing a note.
+type NoteRequest struct {
+	Body string `json:"body" binding:"required"`
+	// TaskID attaches a new note on a beacon to one of its tasks
+	TaskID string `json:"task_id"`
+}
+
+// GetBeaconNotes handles the API request to list the notes on a beacon, oldest first.
+// 'task_id' lists the notes on one of the beacon's tasks instead.
+func (a *API) GetBeaconNotes(c *gin.Context) {
+	notes, err := a.BeaconService.ListNotes(c.Request.Context(), c.Param("beacon_id"), c.Query("task_id"))
+	if err != nil {
+		respondNoteError(c, "Failed to retrieve notes", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(notes, nil))
+}
+
+// GetTaskNotes handles the API request to list the notes on a task, oldest first.
+func (a *API) GetTaskNotes(c *gin.Context) {
+	notes, err := a.BeaconService.ListNotes(c.Request.Context(), "", c.Param("task_id"))
+	if err != nil {
+		respondNoteError(c, "Failed to retrieve notes", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(notes, nil))
+}
+
+// AddBeaconNote handles the API request to add a note to a beacon, or to one of its tasks with 'task_id'.
+func (a *API) AddBeaconNote(c *gin.Context) {
+	var req NoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	a.addNote(c, c.Param("beacon_id"), req.TaskID, req.Body)
+}
+
+// AddTaskNote handles the API request to add a note to a task.
+func (a *API) AddTaskNote(c *gin.Context) {
+	var req NoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	a.addNote(c, "", c.Param("task_id"), req.Body)
+}
+
+func (a *API) addNote(c *gin.Context, beaconID string, taskID string, body string) {
+	note, err := a.BeaconService.AddNote(c.Request.Context(), beaconID, taskID, c.GetString("username"), body)
+	if err != nil {
+		respondNoteError(c, "Failed to add note", err)
+		return
+	}
+
+	a.broadcastNote(c, "NOTE_CREATED", note)
+	Respond(c, http.StatusCreated, NewSuccessResponse(note, nil))
+}
+
+// UpdateNote handles the API request to edit a note. Admins can edit another operator's note with 'force=true'.
+func (a *API) UpdateNote(c *gin.Context) {
+	id, ok := parseNoteID(c)
+	if !ok {
+		return
+	}
+	force, ok := noteForce(c)
+	if !ok {
+		return
+	}
+	var req NoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	note, err := a.BeaconService.UpdateNote(c.Request.Context(), id, c.GetString("username"), req.Body, force)
+	if err != nil {
+		respondNoteError(c, "Failed to update note", err)
+		return
+	}
+
+	a.broadcastNote(c, "NOTE_UPDATED", note)
+	Respond(c, http.StatusOK, NewSuccessResponse(note, nil))
+}
+
+// DeleteNote handles the API request to delete a note. Admins can delete another operator's note with 'force=true'.
+func (a *API) DeleteNote(c *gin.Context) {
+	id, ok := parseNoteID(c)
+	if !ok {
+		return
+	}
+	force, ok := noteForce(c)
+	if !ok {
+		return
+	}
+
+	note, err := a.BeaconService.DeleteNote(c.Request.Context(), id, c.GetString("username"), force)
+	if err != nil {
+		respondNoteError(c, "Failed to delete note", err)
+		return
+	}
+
+	a.broadcastNote(c, "NOTE_DELETED", note)
+	c.Status(http.StatusNoContent)
+}
+
+// parseNoteID reads the note ID from the path, responding with an error if it is invalid.
+func parseNoteID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("note_id"), 10, 32)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid note ID", err.Error()))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// noteForce reads the 'force' query parameter, which only admins may set.
+func noteForce(c *gin.Context) (bool, bool) {
+	force := c.Query("force") == "true"
+	if force && c.GetString("role") != service.RoleAdmin {
+		Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "Only admins can change another operator's note", ""))
+		return false, false
+	}
+	return force, true
+}
+
+// broadcastNote sends a note event to the engagement.
+func (a *API) broadcastNote(c *gin.Context, eventType string, note *data.Note) {
+	event := struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}{
+		Type:    eventType,
+		Payload: note,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Errorf("Error marshalling %s event: %v", eventType, err)
+	} else if a.Hub != nil {
+		a.Hub.BroadcastTo(note.Engagement, eventBytes)
+	}
+}
+
+// respondNoteError maps note errors to HTTP status codes.
+func respondNoteError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, message, err.Error()))
+	case errors.Is(err, service.ErrNoteNotAuthor):
+		Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, message, err.Error()))
+	case errors.Is(err, service.ErrNoteInvalid):
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, message, err.Error()))
+	default:
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, message, err.Error()))
+	}
+}
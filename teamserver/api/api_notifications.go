@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"simplec2/teamserver/data"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// NotificationRuleRequest defines the structure for the notification rule create/update API request body.
+type NotificationRuleRequest struct {
+	Name       string               `json:"name"`
+	Disabled   bool                 `json:"disabled"`
+	EventType  string               `json:"event_type"` // e.g. "BEACON_NEW"; "*" matches every event
+	Conditions []data.RuleCondition `json:"conditions"`
+	Actions    []data.RuleAction    `json:"actions"`
+}
+
+// rule converts the request to a notification rule.
+func (r *NotificationRuleRequest) rule() *data.NotificationRule {
+	return &data.NotificationRule{
+		Name:       r.Name,
+		Disabled:   r.Disabled,
+		EventType:  r.EventType,
+		Conditions: r.Conditions,
+		Actions:    r.Actions,
+	}
+}
+
+// GetNotificationRules handles the API request to list the notification rules of the engagement.
+func (a *API) GetNotificationRules(c *gin.Context) {
+	rules, err := a.NotificationService.ListRules(c.Request.Context())
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve notification rules", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(rules, nil))
+}
+
+// GetNotificationRule handles the API request to retrieve a notification rule.
+func (a *API) GetNotificationRule(c *gin.Context) {
+	id, ok := notificationRuleID(c)
+	if !ok {
+		return
+	}
+	rule, err := a.NotificationService.GetRule(c.Request.Context(), id)
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Notification rule not found", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(rule, nil))
+}
+
+// CreateNotificationRule handles the API request to create a notification rule.
+func (a *API) CreateNotificationRule(c *gin.Context) {
+	var req NotificationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	rule := req.rule()
+	rule.CreatedBy = c.GetString("username")
+	rule, err := a.NotificationService.CreateRule(c.Request.Context(), rule)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to create notification rule", err.Error()))
+		return
+	}
+	Respond(c, http.StatusCreated, NewSuccessResponse(rule, nil))
+}
+
+// UpdateNotificationRule handles the API request to replace the definition of a notification rule.
+func (a *API) UpdateNotificationRule(c *gin.Context) {
+	id, ok := notificationRuleID(c)
+	if !ok {
+		return
+	}
+	var req NotificationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	rule, err := a.NotificationService.UpdateRule(c.Request.Context(), id, req.rule())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Notification rule not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to update notification rule", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(rule, nil))
+}
+
+// DeleteNotificationRule handles the API request to delete a notification rule.
+func (a *API) DeleteNotificationRule(c *gin.Context) {
+	id, ok := notificationRuleID(c)
+	if !ok {
+		return
+	}
+	if err := a.NotificationService.DeleteRule(c.Request.Context(), id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Notification rule not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to delete notification rule", err.Error()))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// notificationRuleID parses the rule ID of the request path, responding with an error if it is invalid.
+func notificationRuleID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("rule_id"), 10, 32)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid rule ID", "must be an integer"))
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"simplec2/pkg/pki"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateOperatorRequest defines the structure for the operator creation API request body.
+type CreateOperatorRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role"` // "admin" or "operator" (default)
+}
+
+// UpdateOperatorRequest defines the structure for the operator update API request body.
+// Omitted fields are left unchanged.
+type UpdateOperatorRequest struct {
+	Password *string `json:"password"`
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
+
+// currentOperator returns the authenticated operator set by the auth middleware.
+func currentOperator(c *gin.Context) *data.Operator {
+	if v, ok := c.Get("operator"); ok {
+		if operator, ok := v.(*data.Operator); ok {
+			return operator
+		}
+	}
+	return nil
+}
+
+// GetOperators handles the API request to list operator accounts.
+func (a *API) GetOperators(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+
+	operators, total, err := a.OperatorService.ListOperators(c.Request.Context(), page, limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve operators", err.Error()))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(operators, meta))
+}
+
+// GetOperator handles the API request to retrieve a single operator account.
+func (a *API) GetOperator(c *gin.Context) {
+	operator, err := a.OperatorService.GetOperator(c.Request.Context(), c.Param("username"))
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Operator not found", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(operator, nil))
+}
+
+// CreateOperator handles the API request to create an operator account.
+func (a *API) CreateOperator(c *gin.Context) {
+	var req CreateOperatorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	operator, err := a.OperatorService.CreateOperator(c.Request.Context(), req.Username, req.Password, req.Role)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to create operator", err.Error()))
+		return
+	}
+	Respond(c, http.StatusCreated, NewSuccessResponse(operator, nil))
+}
+
+// UpdateOperator handles the API request to change an operator's password, role or status.
+func (a *API) UpdateOperator(c *gin.Context) {
+	var req UpdateOperatorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	operator, err := a.OperatorService.UpdateOperator(c.Request.Context(), c.Param("username"), &service.OperatorUpdate{
+		Password: req.Password,
+		Role:     req.Role,
+		Disabled: req.Disabled,
+	})
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to update operator", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(operator, nil))
+}
+
+// DeleteOperator handles the API request to delete an operator account.
+func (a *API) DeleteOperator(c *gin.Context) {
+	username := c.Param("username")
+	if self := currentOperator(c); self != nil && self.Username == username {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to delete operator", "cannot delete your own account"))
+		return
+	}
+
+	if err := a.OperatorService.DeleteOperator(c.Request.Context(), username); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to delete operator", err.Error()))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// IssueOperatorCertificate handles the API request to issue a client certificate for API login.
+// The certificate is signed by the TeamServer CA and its CN is the operator username.
+// The private key is returned once and not stored.
+func (a *API) IssueOperatorCertificate(c *gin.Context) {
+	operator, err := a.OperatorService.GetOperator(c.Request.Context(), c.Param("username"))
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Operator not found", err.Error()))
+		return
+	}
+
+	// Issued by the new CA while the CA is being rotated, as for listener certificates
+	issued, err := a.PKIService.IssueClientCertificate(pki.CertConfig{CommonName: operator.Username})
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to generate client certificate", err.Error()))
+		return
+	}
+	cert := issued.Certificate
+
+	if err := a.OperatorService.RecordCertificate(c.Request.Context(), operator.Username, cert.SerialNumber.String(), cert.Subject.CommonName); err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to record issued certificate", err.Error()))
+		return
+	}
+
+	Respond(c, http.StatusCreated, NewSuccessResponse(gin.H{
+		"serial_number":  cert.SerialNumber.String(),
+		"expires_at":     cert.NotAfter,
+		"certificate":    string(issued.CertPEM),
+		"private_key":    string(issued.KeyPEM),
+		"ca_certificate": string(issued.TrustedCAs),
+	}, nil))
+}
+
+// RevokeOperatorCertificates handles the API request to revoke all client certificates of an operator.
+func (a *API) RevokeOperatorCertificates(c *gin.Context) {
+	if err := a.OperatorService.RevokeCertificates(c.Request.Context(), c.Param("username")); err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to revoke certificates", err.Error()))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
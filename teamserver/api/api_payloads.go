@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreatePayloadRequest defines the structure for the payload build API request body.
+// When a profile is given, omitted fields are taken from it.
+type CreatePayloadRequest struct {
+	Profile     string `json:"profile"` // Optional build profile name
+	Listener    string `json:"listener"`
+	Transport   string `json:"transport"` // Defaults to "http"
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	Format      string `json:"format"`       // "exe" (default), "service", "dll", "shellcode", "so" or "dylib"
+	CallbackURL string `json:"callback_url"` // Defaults to the listener's configured callback_url
+	Sleep       int    `json:"sleep"`        // Initial sleep in seconds
+	Jitter      int    `json:"jitter"`       // Initial jitter percentage (0-99)
+	KillDate    string `json:"kill_date"`    // RFC3339, optional
+	UseDocker   bool   `json:"use_docker"`   // Build inside a Docker sandbox
+	Obfuscate   bool   `json:"obfuscate"`    // Build through garble
+	Verbose     bool   `json:"verbose"`      // Log to stderr, for diagnosing the agent
+	ExportName  string `json:"export_name"`  // DLL entry point, defaults to "Start"
+	ServiceName string `json:"service_name"` // Windows service name for the "service" format
+
+	GuardHostnames []string `json:"guard_hostnames"` // Only run on these hosts
+	GuardNetworks  []string `json:"guard_networks"`  // Only run inside these CIDRs
+
+	DNSCanary bool `json:"dns_canary"` // Resolve a canary subdomain on start, reporting detonations
+	StageOnce bool `json:"stage_once"` // Only one beacon may stage from the payload, a second staging burns it
+}
+
+// BurnPayloadRequest defines the structure for marking a payload as burned.
+type BurnPayloadRequest struct {
+	Reason string `json:"reason"` // e.g. "uploaded to VirusTotal"
+}
+
+// withDownloadURL fills in the download link for a completed payload.
+func withDownloadURL(payload *data.Payload) *data.Payload {
+	if payload.Status == "completed" {
+		payload.DownloadURL = fmt.Sprintf("/api/%s/payloads/%s/download", APIVersion, payload.PayloadID)
+	}
+	return payload
+}
+
+// CreatePayload handles the API request to build a new agent payload.
+// The build runs in the background; PAYLOAD_BUILT or PAYLOAD_FAILED is broadcast when it finishes.
+func (a *API) CreatePayload(c *gin.Context) {
+	var req CreatePayloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	var killDate *time.Time
+	if req.KillDate != "" {
+		t, err := time.Parse(time.RFC3339, req.KillDate)
+		if err != nil {
+			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'kill_date'", "must be an RFC3339 timestamp"))
+			return
+		}
+		killDate = &t
+	}
+
+	payloadReq := &service.PayloadRequest{
+		Profile:     req.Profile,
+		Listener:    req.Listener,
+		Transport:   req.Transport,
+		OS:          req.OS,
+		Arch:        req.Arch,
+		Format:      req.Format,
+		CallbackURL: req.CallbackURL,
+		Sleep:       req.Sleep,
+		Jitter:      req.Jitter,
+		KillDate:    killDate,
+		UseDocker:   req.UseDocker,
+		Obfuscate:   req.Obfuscate,
+		Verbose:     req.Verbose,
+		ExportName:  req.ExportName,
+		ServiceName: req.ServiceName,
+
+		GuardHostnames: req.GuardHostnames,
+		GuardNetworks:  req.GuardNetworks,
+
+		DNSCanary: req.DNSCanary,
+		StageOnce: req.StageOnce,
+	}
+	payload, err := a.PayloadService.CreatePayload(c.Request.Context(), payloadReq)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to create payload", err.Error()))
+		return
+	}
+
+	// UseDocker may come from the profile
+	go a.buildPayload(payload.PayloadID, payloadReq.UseDocker)
+
+	Respond(c, http.StatusAccepted, NewSuccessResponse(payload, nil))
+}
+
+// buildPayload runs a payload build and broadcasts its outcome via WebSocket.
+func (a *API) buildPayload(payloadID string, useDocker bool) {
+	eventType := "PAYLOAD_BUILT"
+	payload, err := a.PayloadService.BuildPayload(context.Background(), payloadID, useDocker)
+	if err != nil {
+		logger.Errorf("Payload build %s failed: %v", payloadID, err)
+		eventType = "PAYLOAD_FAILED"
+	}
+	if payload == nil {
+		return
+	}
+
+	event := struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}{
+		Type:    eventType,
+		Payload: withDownloadURL(payload),
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		logger.Errorf("Error marshalling %s event: %v", eventType, err)
+	} else {
+		if a.Hub != nil {
+			a.Hub.BroadcastTo(payload.Engagement, eventBytes)
+			logger.Debugf("Broadcasted %s event for %s", eventType, payloadID)
+		}
+	}
+}
+
+// GetPayloads handles the API request to list built payloads.
+func (a *API) GetPayloads(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+
+	payloads, total, err := a.PayloadService.ListPayloads(c.Request.Context(), page, limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve payloads", err.Error()))
+		return
+	}
+	for i := range payloads {
+		withDownloadURL(&payloads[i])
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(payloads, meta))
+}
+
+// GetPayload handles the API request to retrieve a single payload by its ID.
+func (a *API) GetPayload(c *gin.Context) {
+	payload, err := a.PayloadService.GetPayload(c.Request.Context(), c.Param("payload_id"))
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Payload not found", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(withDownloadURL(payload), nil))
+}
+
+// DownloadPayload serves the artifact of a completed payload build.
+func (a *API) DownloadPayload(c *gin.Context) {
+	payload, err := a.PayloadService.GetPayload(c.Request.Context(), c.Param("payload_id"))
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Payload not found", err.Error()))
+		return
+	}
+	if payload.Status != "completed" {
+		Respond(c, http.StatusConflict, NewErrorResponse(http.StatusConflict, "Payload is not ready", "status: "+payload.Status))
+		return
+	}
+	if _, err := os.Stat(payload.FilePath); err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Payload artifact not found", err.Error()))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(payload.FileName)))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.File(payload.FilePath)
+}
+
+// GetPayloadDetonations handles the API request to get the detonations of a payload built with a DNS
+// canary. 'hours' (default 720) is the period covered and 'limit' the number of detonations returned.
+func (a *API) GetPayloadDetonations(c *gin.Context) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "720"))
+	if err != nil || hours < 1 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid hours parameter", "hours must be a positive integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil || limit < 0 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid limit parameter", "limit must be a positive integer"))
+		return
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	detonations, err := a.DetonationService.ListDetonations(c.Request.Context(), c.Param("payload_id"), since, limit)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Payload not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to get payload detonations", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(detonations, nil))
+}
+
+// GetBurnedPayloads handles the API request to list the burned payloads: stage-once payloads staged
+// again and payloads burned by operators, with their staging counters.
+func (a *API) GetBurnedPayloads(c *gin.Context) {
+	payloads, err := a.PayloadService.ListBurnedPayloads(c.Request.Context())
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve burned payloads", err.Error()))
+		return
+	}
+	for i := range payloads {
+		withDownloadURL(&payloads[i])
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(payloads, nil))
+}
+
+// BurnPayload handles the API request to mark a payload as burned, so beacons built as it can't stage anymore.
+func (a *API) BurnPayload(c *gin.Context) {
+	var req BurnPayloadRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+			return
+		}
+	}
+	payload, err := a.PayloadService.BurnPayload(c.Request.Context(), c.Param("payload_id"), req.Reason)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Payload not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to burn payload", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(withDownloadURL(payload), nil))
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCRL handles the request for the certificate revocation list of the CA, for TLS endpoints and
+// proxies that verify listener or operator certificates themselves. Like a CRL distribution point,
+// it needs no authentication. The CRL is DER encoded unless ?format=pem is given.
+func (a *API) GetCRL(c *gin.Context) {
+	crlPEM, err := a.CRLService.Current(c.Request.Context())
+	if err != nil {
+		Respond(c, http.StatusServiceUnavailable, NewErrorResponse(http.StatusServiceUnavailable, "Failed to issue CRL", err.Error()))
+		return
+	}
+	c.Header("Cache-Control", "max-age=60")
+	if c.Query("format") == "pem" {
+		c.Data(http.StatusOK, "application/x-pem-file", crlPEM)
+		return
+	}
+	block, _ := pem.Decode(crlPEM)
+	c.Header("Content-Disposition", "attachment; filename=ca.crl")
+	c.Data(http.StatusOK, "application/pkix-crl", block.Bytes)
+}
+
+// RotateCARequest starts a CA rotation.
+type RotateCARequest struct {
+	GraceHours int `json:"grace_hours"` // How long both CAs are trusted, 7 days if 0
+}
+
+// RetireCARequest finishes a CA rotation.
+type RetireCARequest struct {
+	Force bool `json:"force"` // Retire even though certificates of the old CA were not reissued
+}
+
+// GetCAStatus handles the API request for the CA, a rotation in progress and the certificates that
+// still need to be reissued before the old CA can be retired.
+func (a *API) GetCAStatus(c *gin.Context) {
+	status, err := a.PKIService.Status(c.Request.Context())
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to get CA status", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(status, nil))
+}
+
+// RotateCA handles the API request to start a CA rotation. A new CA is generated and issues all
+// certificates from now on; until it is retired, the old CA stays trusted as well.
+func (a *API) RotateCA(c *gin.Context) {
+	var req RotateCARequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	if req.GraceHours < 0 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid grace period", "'grace_hours' must not be negative"))
+		return
+	}
+	grace := service.DefaultRotationGrace
+	if req.GraceHours > 0 {
+		grace = time.Duration(req.GraceHours) * time.Hour
+	}
+
+	status, err := a.PKIService.StartRotation(c.Request.Context(), grace)
+	if err != nil {
+		respondPKIError(c, "Failed to start CA rotation", err)
+		return
+	}
+	a.alert(&service.SecurityAlert{
+		Name:     "ca_rotation_started",
+		Severity: 5,
+		Username: c.GetString("username"),
+		SourceIP: c.ClientIP(),
+		Message:  "CA rotation started",
+		Fields:   map[string]string{"next_ca": status.NextCA.Fingerprint, "grace_until": status.Rotation.GraceUntil.Format(time.RFC3339)},
+	})
+	Respond(c, http.StatusCreated, NewSuccessResponse(status, nil))
+}
+
+// ReissueServerCertificate handles the API request to issue a new TeamServer certificate from the
+// issuing CA. New connections use it right away.
+func (a *API) ReissueServerCertificate(c *gin.Context) {
+	cert, err := a.PKIService.ReissueServerCertificate(c.Request.Context())
+	if err != nil {
+		respondPKIError(c, "Failed to reissue server certificate", err)
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(cert, nil))
+}
+
+// RetireCA handles the API request to finish a CA rotation: only the new CA is trusted afterwards,
+// and the certificates of the old one are revoked.
+func (a *API) RetireCA(c *gin.Context) {
+	var req RetireCARequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	status, err := a.PKIService.RetireCA(c.Request.Context(), req.Force)
+	if err != nil {
+		respondPKIError(c, "Failed to retire CA", err)
+		return
+	}
+	// Reissue the CRL right away, signed by the new CA
+	if _, err := a.CRLService.Generate(c.Request.Context()); err != nil {
+		logger.Ctx(c.Request.Context()).Errorf("Failed to reissue CRL after retiring the CA: %v", err)
+	}
+	a.alert(&service.SecurityAlert{
+		Name:     "ca_retired",
+		Severity: 6,
+		Username: c.GetString("username"),
+		SourceIP: c.ClientIP(),
+		Message:  "old CA retired",
+		Fields:   map[string]string{"ca": status.CA.Fingerprint, "force": strconv.FormatBool(req.Force)},
+	})
+	Respond(c, http.StatusOK, NewSuccessResponse(status, nil))
+}
+
+// respondPKIError maps PKI service errors to status codes.
+func respondPKIError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrRotationInProgress), errors.Is(err, service.ErrCertificatesPending):
+		Respond(c, http.StatusConflict, NewErrorResponse(http.StatusConflict, message, err.Error()))
+	case errors.Is(err, service.ErrNoRotation), errors.Is(err, service.ErrCAKeyNotFile):
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, message, err.Error()))
+	default:
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, message, err.Error()))
+	}
+}
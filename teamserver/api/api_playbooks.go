@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlaybookRequest defines the structure for the playbook create/update API request body.
+type PlaybookRequest struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Steps       []data.PlaybookStep `json:"steps"`
+}
+
+// StartPlaybookRequest defines the structure for the playbook run API request body.
+type StartPlaybookRequest struct {
+	Playbook      string            `json:"playbook" binding:"required"`
+	Vars          map[string]string `json:"vars"`
+	ScopeOverride string            `json:"scope_override"` // Justification for running against an out-of-scope beacon
+}
+
+// GetPlaybooks handles the API request to list playbooks.
+func (a *API) GetPlaybooks(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+
+	playbooks, total, err := a.PlaybookService.ListPlaybooks(c.Request.Context(), page, limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve playbooks", err.Error()))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(playbooks, meta))
+}
+
+// GetPlaybook handles the API request to retrieve a single playbook.
+func (a *API) GetPlaybook(c *gin.Context) {
+	playbook, err := a.PlaybookService.GetPlaybook(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Playbook not found", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(playbook, nil))
+}
+
+// CreatePlaybook handles the API request to create a playbook.
+func (a *API) CreatePlaybook(c *gin.Context) {
+	var req PlaybookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	playbook := &data.Playbook{
+		Name:        req.Name,
+		Description: req.Description,
+		Steps:       req.Steps,
+		CreatedBy:   c.GetString("username"),
+	}
+	if err := a.PlaybookService.CreatePlaybook(c.Request.Context(), playbook); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to create playbook", err.Error()))
+		return
+	}
+	Respond(c, http.StatusCreated, NewSuccessResponse(playbook, nil))
+}
+
+// UpdatePlaybook handles the API request to replace the description and steps of a playbook.
+func (a *API) UpdatePlaybook(c *gin.Context) {
+	var req PlaybookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	playbook, err := a.PlaybookService.UpdatePlaybook(c.Request.Context(), c.Param("name"), req.Description, req.Steps)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to update playbook", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(playbook, nil))
+}
+
+// DeletePlaybook handles the API request to delete a playbook.
+func (a *API) DeletePlaybook(c *gin.Context) {
+	if err := a.PlaybookService.DeletePlaybook(c.Request.Context(), c.Param("name")); err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Failed to delete playbook", err.Error()))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// StartPlaybook handles the API request to run a playbook against a beacon.
+// Every step is checked against the CommandPolicy up front, as if it were tasked by hand.
+func (a *API) StartPlaybook(c *gin.Context) {
+	beaconID := c.Param("beacon_id")
+
+	var req StartPlaybookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	playbook, err := a.PlaybookService.GetPlaybook(c.Request.Context(), req.Playbook)
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Playbook not found", err.Error()))
+		return
+	}
+	for _, step := range playbook.Steps {
+		if !a.allowCommand(c, beaconID, step.Command) {
+			return
+		}
+	}
+	if !a.allowTarget(c, beaconID, "playbook:"+playbook.Name, req.ScopeOverride) {
+		return
+	}
+
+	run, task, err := a.PlaybookService.StartRun(c.Request.Context(), playbook.Name, beaconID, req.Vars, c.GetString("username"))
+	if errors.Is(err, service.ErrBeaconClaimed) {
+		Respond(c, http.StatusConflict, NewErrorResponse(http.StatusConflict, "Beacon is claimed by another operator", err.Error()))
+		return
+	}
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to start playbook", err.Error()))
+		return
+	}
+
+	a.broadcastPlaybookRun(c, run, task)
+	Respond(c, http.StatusCreated, NewSuccessResponse(run, nil))
+}
+
+// GetPlaybookRuns handles the API request to list playbook runs, optionally filtered by 'beacon_id'.
+func (a *API) GetPlaybookRuns(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+
+	runs, total, err := a.PlaybookService.ListRuns(c.Request.Context(), c.Query("beacon_id"), page, limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve playbook runs", err.Error()))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(runs, meta))
+}
+
+// GetPlaybookRun handles the API request to retrieve a single playbook run.
+func (a *API) GetPlaybookRun(c *gin.Context) {
+	run, err := a.PlaybookService.GetRun(c.Request.Context(), c.Param("run_id"))
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Playbook run not found", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(run, nil))
+}
+
+// CancelPlaybookRun handles the API request to stop a running playbook.
+func (a *API) CancelPlaybookRun(c *gin.Context) {
+	run, err := a.PlaybookService.CancelRun(c.Request.Context(), c.Param("run_id"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to cancel playbook run", err.Error()))
+		return
+	}
+
+	a.broadcastPlaybookRun(c, run, nil)
+	Respond(c, http.StatusOK, NewSuccessResponse(run, nil))
+}
+
+// broadcastPlaybookRun sends TASK_QUEUED for a newly queued step, if any, and PLAYBOOK_UPDATED for the run.
+func (a *API) broadcastPlaybookRun(c *gin.Context, run *data.PlaybookRun, task *data.Task) {
+	if a.Hub == nil {
+		return
+	}
+	type event struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}
+	var events []event
+	if task != nil {
+		events = append(events, event{Type: "TASK_QUEUED", Payload: task})
+	}
+	events = append(events, event{Type: "PLAYBOOK_UPDATED", Payload: run})
+	for _, e := range events {
+		eventBytes, err := json.Marshal(e)
+		if err != nil {
+			logger.Ctx(c.Request.Context()).Errorf("Error marshalling %s event: %v", e.Type, err)
+			continue
+		}
+		a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+	}
+}
@@ -0,0 +1,13 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPresence handles the API request to list the operators connected to the engagement,
+// with the beacon each one has focused.
+func (a *API) GetPresence(c *gin.Context) {
+	Respond(c, http.StatusOK, NewSuccessResponse(a.Hub.Presence(c.GetString("engagement")), nil))
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportExtensions are the file extensions of the report formats.
+var reportExtensions = map[string]string{
+	service.ReportMarkdown: "md",
+	service.ReportHTML:     "html",
+	service.ReportPDF:      "pdf",
+}
+
+// GetEngagementReport handles the API request to generate a report of the engagement.
+// Supports ?format=markdown (default), html or pdf, and ?include_secrets=true to include credential secrets.
+func (a *API) GetEngagementReport(c *gin.Context) {
+	format := c.DefaultQuery("format", service.ReportMarkdown)
+	if format == "md" {
+		format = service.ReportMarkdown
+	}
+	extension, ok := reportExtensions[format]
+	if !ok {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'format' parameter", "must be 'markdown', 'html' or 'pdf'"))
+		return
+	}
+
+	report, err := a.ReportService.BuildEngagementReport(c.Request.Context(), c.GetString("username"), c.Query("include_secrets") == "true")
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to generate report", err.Error()))
+		return
+	}
+	content, contentType, err := a.ReportService.RenderEngagementReport(report, format)
+	if err != nil {
+		if errors.Is(err, service.ErrPDFUnavailable) {
+			Respond(c, http.StatusNotImplemented, NewErrorResponse(http.StatusNotImplemented, "PDF reports are not available", err.Error()))
+			return
+		}
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to render report", err.Error()))
+		return
+	}
+
+	fileName := fmt.Sprintf("report-%s-%s.%s", report.Engagement.Name, time.Now().Format("20060102-150405"), extension)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+	c.Data(http.StatusOK, contentType, content)
+}
+
+// GetDeconflictionLog handles the API request to export every action taken in the engagement, per host,
+// for deconfliction with the client's blue team. Supports ?format=csv (default) or ?format=json.
+func (a *API) GetDeconflictionLog(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "json" && format != "csv" {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'format' parameter", "must be 'csv' or 'json'"))
+		return
+	}
+
+	entries, err := a.ReportService.DeconflictionLog(c.Request.Context())
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to export deconfliction log", err.Error()))
+		return
+	}
+
+	engagement := service.EngagementFromContext(c.Request.Context())
+	fileName := fmt.Sprintf("deconfliction-%s-%s.%s", engagement, time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+
+	if format == "json" {
+		c.JSON(http.StatusOK, entries)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"timestamp_utc", "hostname", "internal_ip", "beacon_id", "action", "details", "task_id", "operator", "source_ip", "listener", "c2_endpoint"})
+	for _, entry := range entries {
+		w.Write([]string{
+			entry.Time.UTC().Format(time.RFC3339),
+			entry.Hostname,
+			entry.InternalIP,
+			entry.BeaconID,
+			entry.Action,
+			entry.Details,
+			entry.TaskID,
+			entry.Operator,
+			entry.SourceIP,
+			entry.Listener,
+			entry.C2Endpoint,
+		})
+	}
+	w.Flush()
+}
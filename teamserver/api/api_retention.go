@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRetentionReport handles the API request for a dry run of the retention policies:
+// what they would delete if they ran now.
+func (a *API) GetRetentionReport(c *gin.Context) {
+	report, err := a.RetentionService.Apply(c.Request.Context(), true)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to evaluate retention policies", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(report, nil))
+}
+
+// ApplyRetention handles the API request to apply the retention policies now.
+func (a *API) ApplyRetention(c *gin.Context) {
+	report, err := a.RetentionService.Apply(c.Request.Context(), false)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to apply retention policies", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(report, nil))
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateServiceAPIKeyRequest defines the structure for the API key creation request body.
+type CreateServiceAPIKeyRequest struct {
+	Name      string   `json:"name" binding:"required"`
+	Scopes    []string `json:"scopes" binding:"required"` // "read-beacons", "create-tasks", "manage-listeners", "external-c2"
+	ExpiresAt string   `json:"expires_at"`                // RFC3339, optional
+}
+
+// GetServiceAPIKeys handles the API request to list service API keys.
+func (a *API) GetServiceAPIKeys(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'page' parameter", "must be an integer"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer"))
+		return
+	}
+
+	keys, total, err := a.APIKeyService.ListAPIKeys(c.Request.Context(), page, limit)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve API keys", err.Error()))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	meta := gin.H{
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(keys, meta))
+}
+
+// CreateServiceAPIKey handles the API request to create a service API key.
+// The key is only returned in this response.
+func (a *API) CreateServiceAPIKey(c *gin.Context) {
+	var req CreateServiceAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'expires_at'", "must be an RFC3339 timestamp"))
+			return
+		}
+		expiresAt = &t
+	}
+
+	key, plaintext, err := a.APIKeyService.CreateAPIKey(c.Request.Context(), req.Name, req.Scopes, c.GetString("username"), expiresAt)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to create API key", err.Error()))
+		return
+	}
+	Respond(c, http.StatusCreated, NewSuccessResponse(gin.H{
+		"api_key": key,
+		"key":     plaintext,
+	}, nil))
+}
+
+// RevokeServiceAPIKey handles the API request to revoke a service API key.
+func (a *API) RevokeServiceAPIKey(c *gin.Context) {
+	if err := a.APIKeyService.RevokeAPIKey(c.Request.Context(), c.Param("key_id")); err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Failed to revoke API key", err.Error()))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"simplec2/teamserver/data"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OperatorSession is an active operator session as returned by the session management API.
+type OperatorSession struct {
+	*data.Session
+	Current bool `json:"Current"` // Whether this is the session making the request
+}
+
+// GetSessions handles the API request to list active operator sessions.
+// Supports an optional 'user' query parameter to filter by operator.
+func (a *API) GetSessions(c *gin.Context) {
+	sessions, err := a.SessionService.GetActiveSessions()
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve sessions", err.Error()))
+		return
+	}
+
+	var currentID uint
+	if v, ok := c.Get("session"); ok {
+		if current, ok := v.(*data.Session); ok {
+			currentID = current.ID
+		}
+	}
+
+	user := c.Query("user")
+	result := make([]OperatorSession, 0, len(sessions))
+	for _, session := range sessions {
+		if user != "" && session.UserID != user {
+			continue
+		}
+		result = append(result, OperatorSession{Session: session, Current: session.ID == currentID})
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(result, gin.H{"total": len(result)}))
+}
+
+// RevokeSession handles the API request to forcibly end an operator session.
+func (a *API) RevokeSession(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid session ID", "must be an integer"))
+		return
+	}
+
+	session, err := a.SessionService.RevokeSession(uint(id))
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Failed to revoke session", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(session, nil))
+}
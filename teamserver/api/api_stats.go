@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"simplec2/teamserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxStatsWindow is the longest period the check-in and operator statistics can cover, in minutes.
+const maxStatsWindow = 24 * 60
+
+// GetStats handles the API request for the admin dashboard statistics.
+// 'minutes' sets the period of the check-in and operator figures (default 60, at most one day);
+// 'engagement' limits the statistics to one engagement.
+func (a *API) GetStats(c *gin.Context) {
+	minutes, err := strconv.Atoi(c.DefaultQuery("minutes", "60"))
+	if err != nil || minutes < 1 || minutes > maxStatsWindow {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'minutes' parameter", "must be an integer from 1 to 1440"))
+		return
+	}
+	ctx := c.Request.Context()
+	if engagement := c.Query("engagement"); engagement != "" {
+		ctx = service.WithEngagement(ctx, engagement)
+	}
+
+	stats, err := a.StatsService.Stats(ctx, time.Duration(minutes)*time.Minute)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve statistics", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(stats, nil))
+}
@@ -2,11 +2,19 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"simplec2/pkg/logger"
+	"simplec2/teamserver/commands"
+	"simplec2/teamserver/data"
 	"simplec2/teamserver/service"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // GetTask handles the API request to retrieve a single task by its ID.
@@ -22,11 +30,47 @@ func (a *API) GetTask(c *gin.Context) {
 	Respond(c, http.StatusOK, NewSuccessResponse(task, nil))
 }
 
+// GetTaskOutput handles the API request to retrieve the full output of a task as plain text.
+// Outputs stored as loot are streamed from the loot store, range requests included.
+func (a *API) GetTaskOutput(c *gin.Context) {
+	task, err := a.TaskService.GetTask(c.Request.Context(), c.Param("task_id"))
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Task not found", err.Error()))
+		return
+	}
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	if task.OutputLootID == "" {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(task.Output))
+		return
+	}
+
+	item, file, err := a.LootService.OpenLoot(c.Request.Context(), task.OutputLootID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, os.ErrNotExist) {
+			Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Task output not found", err.Error()))
+			return
+		}
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to retrieve task output", err.Error()))
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(c.Writer, c.Request, item.FileName, item.UpdatedAt, file)
+}
+
 // GetTasksForBeacon handles the API request to retrieve all tasks for a specific beacon.
+// With 'limit' or 'cursor', the tasks are returned a page at a time, oldest first.
 func (a *API) GetTasksForBeacon(c *gin.Context) {
 	beaconID := c.Param("beacon_id")
 	status := c.Query("status")
 
+	if c.Query("limit") != "" || c.Query("cursor") != "" {
+		a.getTaskPage(c, beaconID, status)
+		return
+	}
+
 	tasks, err := a.TaskService.GetTasksByBeaconID(c.Request.Context(), beaconID, status)
 	if err != nil {
 		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Tasks not found for beacon", err.Error()))
@@ -35,11 +79,37 @@ func (a *API) GetTasksForBeacon(c *gin.Context) {
 	Respond(c, http.StatusOK, NewSuccessResponse(tasks, nil))
 }
 
+// getTaskPage responds with a page of the tasks of a beacon, paged by cursor.
+func (a *API) getTaskPage(c *gin.Context, beaconID, status string) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'limit' parameter", "must be an integer between 1 and 500"))
+		return
+	}
+	cursor, ok := parseCursor(c)
+	if !ok {
+		return
+	}
+
+	tasks, err := a.TaskService.ListTasks(c.Request.Context(), &data.TaskQuery{BeaconID: beaconID, Status: status, Limit: limit, Cursor: cursor})
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Tasks not found for beacon", err.Error()))
+		return
+	}
+	next := cursorToken(data.NextCursor(tasks, limit, func(t *data.Task) (time.Time, uint) { return t.CreatedAt, t.ID }))
+	Respond(c, http.StatusOK, NewSuccessResponse(tasks, gin.H{"limit": limit, "next_cursor": next}))
+}
+
 // CreateTaskRequest defines the structure for the task creation API request body.
 type CreateTaskRequest struct {
 	Command   string `json:"command" binding:"required"`
 	Arguments string `json:"arguments"`
 	Source    string `json:"source"`
+	// ScopeOverride is the justification for tasking a beacon outside the engagement's target scope.
+	ScopeOverride string `json:"scope_override"`
+	// Timeout in seconds without output before the task is marked "timed_out"; 0 uses the configured default, negative disables
+	Timeout          int  `json:"timeout"`
+	RequeueOnTimeout bool `json:"requeue_on_timeout"`
 }
 
 // CreateTaskForBeacon handles the API request to create a new task for a beacon.
@@ -52,7 +122,16 @@ func (a *API) CreateTaskForBeacon(c *gin.Context) {
 		return
 	}
 
-	task, err := a.TaskService.CreateTask(c.Request.Context(), beaconID, req.Command, req.Arguments, req.Source)
+	if !a.allowCommand(c, beaconID, req.Command) || !a.allowTarget(c, beaconID, req.Command, req.ScopeOverride) {
+		return
+	}
+
+	options := &service.TaskOptions{Timeout: req.Timeout, RequeueOnTimeout: req.RequeueOnTimeout}
+	task, err := a.TaskService.CreateTask(c.Request.Context(), beaconID, req.Command, req.Arguments, req.Source, c.GetString("username"), options)
+	if errors.Is(err, service.ErrBeaconClaimed) {
+		Respond(c, http.StatusConflict, NewErrorResponse(http.StatusConflict, "Beacon is claimed by another operator", err.Error()))
+		return
+	}
 	if err != nil {
 		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Failed to create task", err.Error()))
 		return
@@ -68,11 +147,11 @@ func (a *API) CreateTaskForBeacon(c *gin.Context) {
 	}
 	eventBytes, err := json.Marshal(event)
 	if err != nil {
-		logger.Errorf("Error marshalling TASK_QUEUED event: %v", err)
+		logger.Ctx(c.Request.Context()).Errorf("Error marshalling TASK_QUEUED event: %v", err)
 	} else {
 		if a.Hub != nil {
-			a.Hub.Broadcast(eventBytes)
-			logger.Debugf("Broadcasted TASK_QUEUED event for %s", task.TaskID)
+			a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+			logger.Ctx(c.Request.Context()).Debugf("Broadcasted TASK_QUEUED event for %s", task.TaskID)
 		}
 	}
 
@@ -113,13 +192,130 @@ func (a *API) CancelTask(c *gin.Context) {
 	}
 	eventBytes, err := json.Marshal(event)
 	if err != nil {
-		logger.Errorf("Error marshalling TASK_CANCELED event: %v", err)
+		logger.Ctx(c.Request.Context()).Errorf("Error marshalling TASK_CANCELED event: %v", err)
 	} else {
 		if a.Hub != nil {
-			a.Hub.Broadcast(eventBytes)
-			logger.Debugf("Broadcasted TASK_CANCELED event for %s", taskID)
+			a.Hub.BroadcastTo(c.GetString("engagement"), eventBytes)
+			logger.Ctx(c.Request.Context()).Debugf("Broadcasted TASK_CANCELED event for %s", taskID)
 		}
 	}
 
+	// Settings the task was to apply are failed
+	if state, err := a.TaskService.ResolveBeaconSettings(c.Request.Context(), task); err != nil {
+		logger.Ctx(c.Request.Context()).Errorf("Error resolving beacon settings of task %s: %v", taskID, err)
+	} else if state != nil {
+		a.broadcastBeaconSettings(c, state)
+	}
+
+	// A canceled step ends the playbook run it belongs to
+	if run, _, err := a.PlaybookService.TaskFinished(task); err != nil {
+		logger.Ctx(c.Request.Context()).Errorf("Error ending playbook run for task %s: %v", taskID, err)
+	} else if run != nil {
+		a.broadcastPlaybookRun(c, run, nil)
+	}
+
 	c.Status(http.StatusNoContent)
 }
+
+// allowCommand checks the operator's role against the CommandPolicy.
+// If the command is not allowed it responds with 403 and returns false.
+func (a *API) allowCommand(c *gin.Context, beaconID, command string) bool {
+	if a.CommandPolicy == nil || a.CommandPolicy.Allowed(command, c.GetString("role")) {
+		return true
+	}
+	a.alert(&service.SecurityAlert{
+		Name:     "command_denied",
+		Severity: 5,
+		Username: c.GetString("username"),
+		SourceIP: c.ClientIP(),
+		Message:  "command '" + command + "' denied for role " + c.GetString("role"),
+		Fields:   map[string]string{"beacon_id": beaconID, "command": command},
+	})
+	Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "Insufficient privileges", "command '"+command+"' requires role: "+a.CommandPolicy.RequiredRole(command)))
+	return false
+}
+
+// allowTarget checks the beacon against its engagement's target scope. An out-of-scope beacon can only be
+// tasked with a justification, which raises a security alert; exit is always allowed so strays can be removed.
+// If the beacon can't be tasked it responds with an error and returns false.
+func (a *API) allowTarget(c *gin.Context, beaconID, command, override string) bool {
+	if command == "exit" {
+		return true
+	}
+	beacon, err := a.BeaconService.GetBeacon(c.Request.Context(), beaconID)
+	if err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Beacon not found", err.Error()))
+		return false
+	}
+	inScope, err := a.EngagementService.BeaconInScope(c.Request.Context(), beacon)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to check target scope", err.Error()))
+		return false
+	}
+	if inScope {
+		return true
+	}
+	if override == "" {
+		Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "Beacon is out of scope", "set scope_override to a justification to task it anyway"))
+		return false
+	}
+	a.alert(&service.SecurityAlert{
+		Name:     "scope_override",
+		Severity: 6,
+		Username: c.GetString("username"),
+		SourceIP: c.ClientIP(),
+		Message:  "out-of-scope beacon " + beaconID + " tasked with '" + command + "': " + override,
+		Fields:   map[string]string{"beacon_id": beaconID, "command": command, "engagement": beacon.Engagement, "reason": override},
+	})
+	return true
+}
+
+// CommandCatalogEntry is a command of the catalog with the role needed to task it.
+type CommandCatalogEntry struct {
+	commands.CommandInfo
+	RequiredRole string `json:"required_role"`
+	Allowed      bool   `json:"allowed"` // Whether the caller's role may task it
+}
+
+// GetCommands handles the API request to list the commands beacons can be tasked with, with
+// their argument schemas, required roles and OPSEC notes, so clients can build forms from it.
+func (a *API) GetCommands(c *gin.Context) {
+	role := c.GetString("role")
+	catalog := commands.Catalog()
+	entries := make([]CommandCatalogEntry, 0, len(catalog))
+	for _, info := range catalog {
+		entry := CommandCatalogEntry{CommandInfo: info, RequiredRole: service.RoleOperator, Allowed: true}
+		if a.CommandPolicy != nil {
+			entry.RequiredRole = a.CommandPolicy.RequiredRole(info.Name)
+			entry.Allowed = a.CommandPolicy.Allowed(info.Name, role)
+		}
+		entries = append(entries, entry)
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(entries, nil))
+}
+
+// GetAttackCoverage handles the API request to export the ATT&CK technique coverage of the engagement's tasks.
+// Supports ?format=json (default, grouped by tactic) or ?format=navigator (an ATT&CK Navigator layer).
+func (a *API) GetAttackCoverage(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "navigator" {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'format' parameter", "must be 'json' or 'navigator'"))
+		return
+	}
+
+	matrix, err := a.TaskService.TechniqueCoverage(c.Request.Context())
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to export ATT&CK coverage", err.Error()))
+		return
+	}
+
+	if format == "json" {
+		Respond(c, http.StatusOK, NewSuccessResponse(matrix, nil))
+		return
+	}
+
+	engagement := service.EngagementFromContext(c.Request.Context())
+	fileName := fmt.Sprintf("attack-layer-%s-%s.json", engagement, time.Now().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+	c.JSON(http.StatusOK, service.NewNavigatorLayer(engagement, matrix))
+}
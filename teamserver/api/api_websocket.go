@@ -15,8 +15,9 @@ import (
 // @Tags websocket
 // @Produce  json
 // @Param token query string true "JWT token for authentication"
+// @Param engagement query string false "Engagement to receive events of (defaults to the active engagement)"
 // @Success 101 "Switching Protocols"
-// @Failure 401 {object} gin.H{"error": string} "Unauthorized"
+// @Failure 401 {object} StandardResponse "Unauthorized"
 // @Router /ws [get]
 // serveWs handles websocket requests from the peer.
 // It acts as an adapter between the Gin context and the standard http.ResponseWriter and http.Request
@@ -40,13 +41,13 @@ func (a *API) serveWs(c *gin.Context) {
 	}
 	eventBytes, err := json.Marshal(event)
 	if err != nil {
-		logger.Errorf("Error marshalling CLIENT_CONNECTED event: %v", err)
+		logger.Ctx(c.Request.Context()).Errorf("Error marshalling CLIENT_CONNECTED event: %v", err)
 	} else {
 		if a.Hub != nil {
 			a.Hub.Broadcast(eventBytes)
-			logger.Debugf("Broadcasted CLIENT_CONNECTED event for user %v", username)
+			logger.Ctx(c.Request.Context()).Debugf("Broadcasted CLIENT_CONNECTED event for user %v", username)
 		}
 	}
 
-	websocket.ServeWs(a.Hub, c.Writer, c.Request)
+	websocket.ServeWs(a.Hub, c.Writer, c.Request, c.GetString("engagement"), c.GetString("username"))
 }
@@ -1,33 +1,29 @@
 package api
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
 	"simplec2/pkg/config"
 	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
 )
 
-// HashPassword 使用 bcrypt 哈希密码
-func HashPassword(password string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hashed), err
-}
-
-// verifyPassword 验证密码和哈希
-func verifyPassword(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-}
-
 // AuthRequest defines the structure for the login request body.
 type AuthRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	Provider string `json:"provider"` // "local" (default) or "ldap"
 }
 
 // Login handles operator authentication and JWT issuance
@@ -38,76 +34,240 @@ func (a *API) Login() gin.HandlerFunc {
 			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
 			return
 		}
-
-		storedPassword := a.Config.Auth.OperatorPassword
-		isHashed := strings.HasPrefix(storedPassword, "$2a$") || strings.HasPrefix(storedPassword, "$2b$") || strings.HasPrefix(storedPassword, "$2y$")
+		// Recorded in the audit log, also for failed attempts
+		c.Set("username", req.Username)
 
 		// 密码验证
-		if isHashed {
-			// 存储的是哈希，使用 bcrypt 比较
-			if err := verifyPassword(req.Password, storedPassword); err != nil {
-				Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "Invalid credentials", ""))
+		var operator *data.Operator
+		var err error
+		switch req.Provider {
+		case "", "local":
+			operator, err = a.OperatorService.Authenticate(c.Request.Context(), req.Username, req.Password, c.ClientIP())
+		case "ldap":
+			if a.LDAP == nil {
+				Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "LDAP login is not enabled", ""))
 				return
 			}
-		} else {
-			// 存储的是明文，直接比较（不安全）
-			logger.Warn("The operator password is in plaintext. Please use the -hash-password flag to generate a hash and update your config file for better security.")
-			if req.Password != storedPassword {
-				Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "Invalid credentials", ""))
-				return
+			operator, err = a.ldapLogin(c, req.Username, req.Password)
+		default:
+			Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'provider'", "must be 'local' or 'ldap'"))
+			return
+		}
+		if err != nil {
+			if err != service.ErrInvalidCredentials {
+				logger.Errorf("Login for user %s failed: %v", req.Username, err)
 			}
+			Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "Invalid credentials", ""))
+			return
 		}
 
-		// 获取独立的 JWT 签名密钥
-		jwtSecret := config.GetJWTSecret(a.Config.Auth.JWTSecret)
-
-		// 创建 JWT token
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"sub": req.Username,
-			"iat": time.Now().Unix(),
-			"exp": time.Now().Add(time.Hour * 24).Unix(), // Token expires in 24 hours
-		})
-
-		// 使用独立的 JWT 密钥签名
-		tokenString, err := token.SignedString([]byte(jwtSecret))
+		tokens, err := a.issueTokens(c, operator, nil)
 		if err != nil {
 			Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to create token", err.Error()))
 			return
 		}
 
-		// Create session record
-		if a.SessionService != nil {
-			_, err := a.SessionService.CreateSession(req.Username, tokenString, c.ClientIP(), c.Request.UserAgent(), 24*time.Hour)
-			if err != nil {
-				logger.Warnf("Failed to create session for user %s: %v", req.Username, err)
-				// Continue anyway, session creation failure shouldn't block login
-			}
+		Respond(c, http.StatusOK, NewSuccessResponse(tokens.response(operator), nil))
+	}
+}
+
+// tokenPair is a short-lived access token together with the refresh token of its session.
+type tokenPair struct {
+	AccessToken      string
+	ExpiresAt        int64
+	RefreshToken     string
+	RefreshExpiresAt int64
+}
+
+func (t *tokenPair) response(operator *data.Operator) gin.H {
+	return gin.H{
+		"token":              t.AccessToken,
+		"expires_at":         t.ExpiresAt,
+		"refresh_token":      t.RefreshToken,
+		"refresh_expires_at": t.RefreshExpiresAt,
+		"operator":           operator,
+	}
+}
+
+// signAccessToken signs a short-lived JWT for the operator.
+func (a *API) signAccessToken(operator *data.Operator) (string, int64, error) {
+	// 获取独立的 JWT 签名密钥
+	jwtSecret := config.GetJWTSecret(a.Config.Auth.JWTSecret)
+	expiresAt := time.Now().Add(a.Config.Auth.GetAccessTokenTTL()).Unix()
+
+	// 创建 JWT token，jti 保证同一秒内签发的令牌也互不相同
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"jti": uuid.New().String(),
+		"sub": operator.Username,
+		"iat": time.Now().Unix(),
+		"exp": expiresAt,
+	})
+
+	// 使用独立的 JWT 密钥签名
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		return "", 0, err
+	}
+	return tokenString, expiresAt, nil
+}
+
+// issueTokens signs an access token and records its session.
+// previous is the session retired by a refresh, or nil for a fresh login.
+func (a *API) issueTokens(c *gin.Context, operator *data.Operator, previous *data.Session) (*tokenPair, error) {
+	accessToken, expiresAt, err := a.signAccessToken(operator)
+	if err != nil {
+		return nil, err
+	}
+	tokens := &tokenPair{AccessToken: accessToken, ExpiresAt: expiresAt}
+	if a.SessionService == nil {
+		return tokens, nil
+	}
+
+	refreshTTL := a.Config.Auth.GetRefreshTokenTTL()
+	var session *data.Session
+	if previous == nil {
+		session, tokens.RefreshToken, err = a.SessionService.StartSession(operator.Username, accessToken, c.ClientIP(), c.Request.UserAgent(), refreshTTL)
+	} else {
+		session, tokens.RefreshToken, err = a.SessionService.ContinueSession(previous, accessToken, c.ClientIP(), c.Request.UserAgent(), refreshTTL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	tokens.RefreshExpiresAt = session.ExpiresAt.Unix()
+	return tokens, nil
+}
+
+// RefreshRequest defines the structure for the refresh and revoke request body.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new refresh token.
+// Each refresh token can be used once; reusing one revokes all sessions derived from the same login.
+func (a *API) RefreshToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	previous, err := a.SessionService.ConsumeRefreshToken(req.RefreshToken)
+	if err != nil {
+		a.respondRefreshError(c, err)
+		return
+	}
+
+	c.Set("username", previous.UserID)
+	operator, err := a.OperatorService.GetOperator(c.Request.Context(), previous.UserID)
+	if err != nil || operator.Disabled {
+		Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "Operator account not found or disabled", ""))
+		return
+	}
+
+	tokens, err := a.issueTokens(c, operator, previous)
+	if errors.Is(err, service.ErrRefreshTokenReused) {
+		// The token was replayed while this refresh was in flight
+		a.respondRefreshError(c, err)
+		return
+	}
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to create token", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(tokens.response(operator), nil))
+}
+
+// respondRefreshError rejects a refresh, raising an alert when the refresh token was reused.
+func (a *API) respondRefreshError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrRefreshTokenReused) {
+		a.alert(&service.SecurityAlert{
+			Name:     "refresh_token_reuse",
+			Severity: 8,
+			SourceIP: c.ClientIP(),
+			Message:  "refresh token reuse detected, session family revoked",
+		})
+	}
+	Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "Invalid refresh token", err.Error()))
+}
+
+// RevokeToken revokes the session a refresh token belongs to, together with its access token.
+func (a *API) RevokeToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+
+	if err := a.SessionService.RevokeRefreshToken(req.RefreshToken); err != nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Failed to revoke token", err.Error()))
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(gin.H{"message": "Token revoked"}, nil))
+}
+
+// ChangePasswordRequest defines the structure for the password change request body.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword lets the authenticated operator set a new password.
+// All existing sessions of the operator are revoked and a new token pair is returned.
+func (a *API) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid request body", err.Error()))
+		return
+	}
+	self := currentOperator(c)
+	if self == nil {
+		Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "Only operator accounts can change passwords", ""))
+		return
+	}
+
+	operator, err := a.OperatorService.ChangePassword(c.Request.Context(), self.Username, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		if err == service.ErrInvalidCredentials {
+			Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "Current password is incorrect", ""))
+			return
 		}
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Failed to change password", err.Error()))
+		return
+	}
+	logger.Ctx(c.Request.Context()).Infof("Operator %s changed their password", operator.Username)
 
-		Respond(c, http.StatusOK, NewSuccessResponse(gin.H{
-			"token":      tokenString,
-			"expires_at": time.Now().Add(time.Hour * 24).Unix(),
-		}, nil))
+	tokens, err := a.issueTokens(c, operator, nil)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to create token", err.Error()))
+		return
 	}
+	Respond(c, http.StatusOK, NewSuccessResponse(tokens.response(operator), nil))
 }
 
 // AuthMiddlewareWithSession creates a middleware handler for JWT and session validation.
-func (a *API) AuthMiddlewareWithSession(jwtSecret string) gin.HandlerFunc {
+// The JWT secret is looked up for every request, as it may be rotated in a secret manager.
+func (a *API) AuthMiddlewareWithSession() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Record request start time for duration calculation in audit log
-		c.Set("requestStartTime", time.Now())
+		// Client certificate login, used when the request carries no token or API key
+		certMode := a.Config.API.TLS.ClientCertMode()
+		if cert := clientCertificate(c); cert != nil && certMode != config.ClientCertsOff && !hasCredential(c) {
+			a.authenticateCertificate(c, cert)
+			return
+		}
 
 		var tokenString string
 
 		// For WebSockets, the token is passed as a query parameter
 		// because headers are not easily sent.
-		if c.Request.URL.Path == "/api/ws" {
+		if isWebSocketPath(c.Request.URL.Path) {
 			tokenString = c.Query("token")
 			if tokenString == "" {
 				Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "WebSocket token is missing", ""))
 				c.Abort()
 				return
 			}
+		} else if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			tokenString = apiKey
 		} else {
 			// For standard HTTP requests, get the token from the header.
 			authHeader := c.GetHeader("Authorization")
@@ -125,11 +285,22 @@ func (a *API) AuthMiddlewareWithSession(jwtSecret string) gin.HandlerFunc {
 			tokenString = parts[1]
 		}
 
+		// Service API keys are checked against the scope of the route instead of a role
+		if a.APIKeyService != nil && service.IsServiceAPIKey(tokenString) {
+			a.authenticateAPIKey(c, tokenString)
+			return
+		}
+		if certMode == config.ClientCertsRequired {
+			Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "Client certificate authentication is required", ""))
+			c.Abort()
+			return
+		}
+
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, http.ErrAbortHandler
 			}
-			return []byte(jwtSecret), nil
+			return []byte(config.GetJWTSecret(a.Config.Auth.JWTSecret)), nil
 		})
 
 		if err != nil || !token.Valid {
@@ -140,18 +311,36 @@ func (a *API) AuthMiddlewareWithSession(jwtSecret string) gin.HandlerFunc {
 
 		// Validate session
 		if a.SessionService != nil {
-			_, valid := a.SessionService.ValidateSession(tokenString)
+			session, valid := a.SessionService.ValidateSession(tokenString)
 			if !valid {
 				Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "Session expired or invalid", ""))
 				c.Abort()
 				return
 			}
+			c.Set("session", session)
 		}
 
 		// Store the token claims in the context for other middleware
 		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			// The subject must still be an enabled operator account
+			username, _ := claims["sub"].(string)
+			operator, err := a.OperatorService.GetOperator(c.Request.Context(), username)
+			if err != nil || operator.Disabled {
+				Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "Operator account not found or disabled", ""))
+				c.Abort()
+				return
+			}
+			// Until the initial password is replaced, only the password change endpoint is usable
+			if operator.MustChangePassword && routePattern(c) != "/api/auth/change-password" {
+				Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "Password change required", "use /api/auth/change-password to set a new password"))
+				c.Abort()
+				return
+			}
+			c.Set("operator", operator)
+			c.Set("role", operator.Role)
 			c.Set("userClaims", claims)
-			c.Set("username", claims["sub"])
+			c.Set("username", username)
+			c.Set("authMethod", "token")
 			c.Set("token", tokenString)
 
 			// Broadcast CLIENT_AUTHENTICATED event via WebSocket
@@ -181,6 +370,100 @@ func (a *API) AuthMiddlewareWithSession(jwtSecret string) gin.HandlerFunc {
 	}
 }
 
+// clientCertificate returns the verified client certificate of a TLS request, if any.
+func clientCertificate(c *gin.Context) *x509.Certificate {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// hasCredential reports whether a request carries a token or API key.
+func hasCredential(c *gin.Context) bool {
+	return c.GetHeader("Authorization") != "" || c.GetHeader("X-API-Key") != "" ||
+		(isWebSocketPath(c.Request.URL.Path) && c.Query("token") != "")
+}
+
+// authenticateCertificate authenticates a request made with an operator client certificate.
+// The certificate CN is the operator username; revocation is checked on every request.
+func (a *API) authenticateCertificate(c *gin.Context, cert *x509.Certificate) {
+	operator, err := a.OperatorService.AuthenticateCertificate(c.Request.Context(), cert.SerialNumber.String(), cert.Subject.CommonName)
+	if err != nil {
+		a.alert(&service.SecurityAlert{
+			Name:     "client_certificate_rejected",
+			Severity: 7,
+			Username: cert.Subject.CommonName,
+			SourceIP: c.ClientIP(),
+			Message:  "operator API client certificate rejected: " + err.Error(),
+			Fields:   map[string]string{"serial": cert.SerialNumber.String()},
+		})
+		Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "Invalid client certificate", "certificate is unknown, revoked or not issued to an enabled operator"))
+		c.Abort()
+		return
+	}
+	// As with tokens, only the password change endpoint is usable until the initial password is replaced
+	if operator.MustChangePassword && routePattern(c) != "/api/auth/change-password" {
+		Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "Password change required", "use /api/auth/change-password to set a new password"))
+		c.Abort()
+		return
+	}
+
+	c.Set("operator", operator)
+	c.Set("role", operator.Role)
+	c.Set("username", operator.Username)
+	c.Set("clientCertificate", cert.SerialNumber.String())
+	c.Set("authMethod", "certificate")
+	c.Next()
+}
+
+// authenticateAPIKey authenticates a request made with a service API key.
+// Keys may only reach routes listed in APIKeyScopes, and only with the matching scope.
+func (a *API) authenticateAPIKey(c *gin.Context, plaintext string) {
+	key, scopes, err := a.APIKeyService.ValidateAPIKey(c.Request.Context(), plaintext)
+	if err != nil {
+		Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "Invalid API key", err.Error()))
+		c.Abort()
+		return
+	}
+
+	required, ok := a.APIKeyScopes[c.Request.Method+" "+routePattern(c)]
+	if !ok {
+		Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "Route not available to API keys", ""))
+		c.Abort()
+		return
+	}
+	if !slices.Contains(scopes, required) {
+		Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "Insufficient scope", "requires scope: "+required))
+		c.Abort()
+		return
+	}
+
+	c.Set("apiKey", key)
+	c.Set("username", "apikey:"+key.Name)
+	c.Set("authMethod", "api_key")
+	// Commands are still subject to the command policy at operator level
+	c.Set("role", service.RoleOperator)
+	c.Next()
+}
+
+// RequireRole creates a middleware that only lets operators with at least the given role through.
+// Must run after AuthMiddlewareWithSession. API key requests have already been checked by scope.
+func (a *API) RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isAPIKey := c.Get("apiKey"); isAPIKey {
+			c.Next()
+			return
+		}
+		if !service.RoleAtLeast(c.GetString("role"), role) {
+			Respond(c, http.StatusForbidden, NewErrorResponse(http.StatusForbidden, "Insufficient privileges", "requires role: "+role))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // Logout handles user logout and session invalidation.
 func (a *API) Logout() gin.HandlerFunc {
 	return func(c *gin.Context) {
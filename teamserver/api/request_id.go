@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"simplec2/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID of an API request, in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the gin context key of the request ID.
+const requestIDKey = "requestID"
+
+// maxRequestIDLength bounds request IDs taken over from clients or proxies.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware assigns every request an ID and returns it in the X-Request-ID header.
+// An ID set by the client or a reverse proxy is kept so requests can be followed across systems.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !ValidRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		// Services log with logger.Ctx, which tags entries with the ID
+		c.Request = c.Request.WithContext(logger.ContextWithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// accessLogFormat is gin's access log format with the request ID appended.
+func accessLogFormat(param gin.LogFormatterParams) string {
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v | %v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		param.Path,
+		param.Keys[requestIDKey],
+		param.ErrorMessage,
+	)
+}
+
+// ValidRequestID reports whether a request ID is short and printable ASCII, so it can safely be
+// echoed in headers and written to logs.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RecoveryMiddleware turns a panicking handler into a 500 error response.
+func RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		logger.Ctx(c.Request.Context()).Errorf("Panic serving %s %s: %v", c.Request.Method, c.Request.URL.Path, recovered)
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Internal server error", "the request could not be completed"))
+		c.Abort()
+	})
+}
+
+// NoRoute handles requests for paths without a route.
+func NoRoute(c *gin.Context) {
+	Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "Not found", "no route for "+c.Request.URL.Path))
+}
+
+// NoMethod handles requests with a method the path has no route for.
+func NoMethod(c *gin.Context) {
+	Respond(c, http.StatusMethodNotAllowed, NewErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", c.Request.Method+" is not supported for "+c.Request.URL.Path))
+}
@@ -1,6 +1,12 @@
 package api
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+
+	"simplec2/teamserver/data"
+
+	"github.com/gin-gonic/gin"
+)
 
 // StandardResponse defines the structure for a standardized API response.
 type StandardResponse struct {
@@ -12,9 +18,10 @@ type StandardResponse struct {
 
 // ErrorResponse defines the structure for a detailed error message.
 type ErrorResponse struct {
-	Code    int    `json:"code,omitempty"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
+	Code      int    `json:"code,omitempty"`
+	Message   string `json:"message"`
+	Details   string `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"` // Same as the X-Request-ID response header
 }
 
 // NewSuccessResponse creates a standardized success response.
@@ -38,7 +45,33 @@ func NewErrorResponse(code int, message string, details string) StandardResponse
 	}
 }
 
-// Respond sends a JSON response with a status code.
+// Respond sends a JSON response with a status code. Errors are tagged with the request ID.
 func Respond(c *gin.Context, statusCode int, response StandardResponse) {
+	if response.Error != nil && response.Error.RequestID == "" {
+		response.Error.RequestID = c.GetString(requestIDKey)
+	}
 	c.JSON(statusCode, response)
 }
+
+// parseCursor reads the 'cursor' query parameter of a list: with one, the list is paged by keyset
+// and 'page' is ignored. Responds with 400 and returns false if the cursor is invalid.
+func parseCursor(c *gin.Context) (*data.PageCursor, bool) {
+	token := c.Query("cursor")
+	if token == "" {
+		return nil, true
+	}
+	cursor, err := data.ParsePageCursor(token)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, NewErrorResponse(http.StatusBadRequest, "Invalid 'cursor' parameter", "must be a next_cursor returned by a previous page"))
+		return nil, false
+	}
+	return cursor, true
+}
+
+// cursorToken returns the token of a cursor for the 'next_cursor' meta field, empty on the last page.
+func cursorToken(cursor *data.PageCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	return cursor.String()
+}
@@ -1,8 +1,13 @@
 package api
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"simplec2/pkg/config"
 	"simplec2/teamserver/service"
+	"simplec2/teamserver/sso"
 	"simplec2/teamserver/websocket"
 
 	"github.com/gin-contrib/cors"
@@ -11,76 +16,418 @@ import (
 
 // API holds the configuration and dependencies for the API handlers.
 type API struct {
-	Config          *config.TeamServerConfig
-	BeaconService   service.BeaconService
-	TaskService     service.TaskService
-	ListenerService service.ListenerService
-	SessionService  *service.SessionService
-	Hub             *websocket.Hub
+	Config               *config.TeamServerConfig
+	BeaconService        service.BeaconService
+	TaskService          service.TaskService
+	ListenerService      service.ListenerService
+	ListenerProbeService service.ListenerProbeService
+	HostedFileService    service.HostedFileService
+	CanaryService        service.CanaryService
+	SessionService       *service.SessionService
+	OperatorService      service.OperatorService
+	PayloadService       service.PayloadService
+	DetonationService    service.DetonationService
+	ArtifactService      service.ArtifactService
+	CommandPolicy        *service.CommandPolicy
+	APIKeyService        service.APIKeyService
+	AuditService         service.AuditService
+	EngagementService    service.EngagementService
+	BurnService          service.BurnService
+	PlaybookService      service.PlaybookService
+	HostService          service.HostService
+	CredentialService    service.CredentialService
+	LootService          service.LootService
+	ChatService          service.ChatService
+	NotificationService  service.NotificationService
+	ReportService        service.ReportService
+	HealthService        service.HealthService
+	StatsService         service.StatsService
+	BackupService        service.BackupService
+	RetentionService     service.RetentionService
+	CRLService           service.CRLService
+	PKIService           service.PKIService
+	InfraService         service.InfraService
+	ExternalC2           service.ExternalC2
+	APIKeyScopes         map[string]string      // "METHOD /path" -> scope, for routes open to API keys
+	OIDC                 *sso.OIDCProvider      // nil if OIDC login is disabled
+	LDAP                 *sso.LDAPAuthenticator // nil if LDAP login is disabled
+	Hub                  *websocket.Hub
+}
+
+// apiKeyRouteScopes lists the routes service API keys may call and the scope each one requires.
+// Every other route is closed to API keys. Routes are listed without the version, see routePattern.
+var apiKeyRouteScopes = map[string]string{
+	"GET /api/beacons":                                            service.ScopeReadBeacons,
+	"GET /api/beacons/:beacon_id":                                 service.ScopeReadBeacons,
+	"GET /api/beacons/:beacon_id/tasks":                           service.ScopeReadBeacons,
+	"GET /api/tasks/:task_id":                                     service.ScopeReadBeacons,
+	"GET /api/tasks/:task_id/output":                              service.ScopeReadBeacons,
+	"POST /api/beacons/:beacon_id/tasks":                          service.ScopeCreateTasks,
+	"GET /api/beacons/:beacon_id/settings":                        service.ScopeReadBeacons,
+	"PATCH /api/beacons/:beacon_id/settings":                      service.ScopeCreateTasks,
+	"DELETE /api/tasks/:task_id":                                  service.ScopeCreateTasks,
+	"GET /api/commands":                                           service.ScopeCreateTasks,
+	"GET /api/listeners":                                          service.ScopeManageListeners,
+	"POST /api/listeners":                                         service.ScopeManageListeners,
+	"DELETE /api/listeners/:name":                                 service.ScopeManageListeners,
+	"POST /api/listeners/:name/start":                             service.ScopeManageListeners,
+	"POST /api/listeners/:name/stop":                              service.ScopeManageListeners,
+	"POST /api/listeners/:name/restart":                           service.ScopeManageListeners,
+	"POST /api/listeners/:name/deploy":                            service.ScopeManageListeners,
+	"POST /api/listeners/:name/rebundle":                          service.ScopeManageListeners,
+	"GET /api/listeners/:name/probes":                             service.ScopeManageListeners,
+	"GET /api/infrastructure/assets":                              service.ScopeManageListeners,
+	"GET /api/infrastructure/assets/:asset_id":                    service.ScopeManageListeners,
+	"POST /api/infrastructure/assets":                             service.ScopeManageListeners,
+	"DELETE /api/infrastructure/assets/:asset_id":                 service.ScopeManageListeners,
+	"POST /api/external-c2/beacons":                               service.ScopeExternalC2,
+	"POST /api/external-c2/beacons/:beacon_id/checkin":            service.ScopeExternalC2,
+	"POST /api/external-c2/beacons/:beacon_id/output":             service.ScopeExternalC2,
+	"GET /api/external-c2/beacons/:beacon_id/tasks/:task_id/file": service.ScopeExternalC2,
+}
+
+// APIVersion is the current version of the REST API, served under /api/v1. The unversioned /api
+// routes are deprecated aliases of the current version.
+const APIVersion = "v1"
+
+// legacyAPIDeprecatedAt is when the unversioned /api routes were deprecated.
+var legacyAPIDeprecatedAt = time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)
+
+// DeprecatedAPI marks responses of the unversioned /api routes as deprecated (RFC 9745) and links
+// to the versioned route replacing them.
+func DeprecatedAPI() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", fmt.Sprintf("@%d", legacyAPIDeprecatedAt.Unix()))
+		c.Header("Link", fmt.Sprintf("</api/%s%s>; rel=\"successor-version\"", APIVersion, strings.TrimPrefix(c.Request.URL.Path, "/api")))
+		c.Next()
+	}
+}
+
+// routePattern returns the route pattern of a request without the API version, e.g.
+// "/api/beacons/:beacon_id" for both /api/v1/beacons/:beacon_id and the legacy route.
+func routePattern(c *gin.Context) string {
+	route := c.FullPath()
+	if rest, ok := strings.CutPrefix(route, "/api/"+APIVersion+"/"); ok {
+		return "/api/" + rest
+	}
+	return route
+}
+
+// isWebSocketPath reports whether a request is for the WebSocket endpoint, which takes its token
+// as a query parameter.
+func isWebSocketPath(path string) bool {
+	return path == "/api/ws" || path == "/api/"+APIVersion+"/ws"
 }
 
 // NewRouter sets up the API routes and returns the Gin engine.
-func NewRouter(cfg *config.TeamServerConfig, beaconService service.BeaconService, taskService service.TaskService, listenerService service.ListenerService, sessionService *service.SessionService, hub *websocket.Hub) *gin.Engine {
-	router := gin.Default()
+func NewRouter(cfg *config.TeamServerConfig, beaconService service.BeaconService, taskService service.TaskService, listenerService service.ListenerService, listenerProbeService service.ListenerProbeService, hostedFileService service.HostedFileService, canaryService service.CanaryService, sessionService *service.SessionService, operatorService service.OperatorService, payloadService service.PayloadService, detonationService service.DetonationService, artifactService service.ArtifactService, commandPolicy *service.CommandPolicy, apiKeyService service.APIKeyService, auditService service.AuditService, engagementService service.EngagementService, burnService service.BurnService, playbookService service.PlaybookService, hostService service.HostService, credentialService service.CredentialService, lootService service.LootService, chatService service.ChatService, notificationService service.NotificationService, reportService service.ReportService, healthService service.HealthService, statsService service.StatsService, backupService service.BackupService, retentionService service.RetentionService, crlService service.CRLService, pkiService service.PKIService, infraService service.InfraService, externalC2 service.ExternalC2, oidcProvider *sso.OIDCProvider, ldapAuth *sso.LDAPAuthenticator, hub *websocket.Hub) *gin.Engine {
+	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.Use(RequestIDMiddleware(), gin.LoggerWithFormatter(accessLogFormat), RecoveryMiddleware())
+	if cfg.Tracing != nil {
+		router.Use(TracingMiddleware(cfg.Tracing.GetServiceName())...)
+	}
+	router.NoRoute(NoRoute)
+	router.NoMethod(NoMethod)
 
 	// Add CORS middleware
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowAllOrigins = true // For development; in production, lock this down.
-	corsConfig.AllowHeaders = append(corsConfig.AllowHeaders, "Authorization", "X-Upload-ID", "X-Chunk-Number")
+	corsConfig.AllowHeaders = append(corsConfig.AllowHeaders, "Authorization", "X-API-Key", "X-Engagement", "X-Upload-ID", "X-Chunk-Number", RequestIDHeader, "traceparent", "tracestate")
+	corsConfig.ExposeHeaders = append(corsConfig.ExposeHeaders, RequestIDHeader, "Deprecation", "Link")
 	router.Use(cors.New(corsConfig))
 
 	api := &API{
-		Config:          cfg,
-		BeaconService:   beaconService,
-		TaskService:     taskService,
-		ListenerService: listenerService,
-		SessionService:  sessionService,
-		Hub:             hub,
+		Config:               cfg,
+		BeaconService:        beaconService,
+		TaskService:          taskService,
+		ListenerService:      listenerService,
+		ListenerProbeService: listenerProbeService,
+		HostedFileService:    hostedFileService,
+		CanaryService:        canaryService,
+		SessionService:       sessionService,
+		OperatorService:      operatorService,
+		PayloadService:       payloadService,
+		DetonationService:    detonationService,
+		ArtifactService:      artifactService,
+		CommandPolicy:        commandPolicy,
+		APIKeyService:        apiKeyService,
+		AuditService:         auditService,
+		EngagementService:    engagementService,
+		BurnService:          burnService,
+		PlaybookService:      playbookService,
+		HostService:          hostService,
+		CredentialService:    credentialService,
+		LootService:          lootService,
+		ChatService:          chatService,
+		NotificationService:  notificationService,
+		ReportService:        reportService,
+		HealthService:        healthService,
+		StatsService:         statsService,
+		BackupService:        backupService,
+		RetentionService:     retentionService,
+		CRLService:           crlService,
+		PKIService:           pkiService,
+		InfraService:         infraService,
+		ExternalC2:           externalC2,
+		APIKeyScopes:         apiKeyRouteScopes,
+		OIDC:                 oidcProvider,
+		LDAP:                 ldapAuth,
+		Hub:                  hub,
 	}
 
-	// 获取 JWT 签名密钥
-	jwtSecret := config.GetJWTSecret(cfg.Auth.JWTSecret)
+	// Audit every API request, including logins and requests rejected by authentication
+	router.Use(api.AuditMiddleware())
+
+	// Probes for load balancers and monitoring, outside the versioned API and without authentication
+	router.GET("/healthz", api.Healthz)
+	router.GET("/readyz", api.Readyz)
+	// CRL distribution point of the CA, also unversioned and without authentication
+	router.GET("/pki/crl", api.GetCRL)
+
+	// The same routes are served under /api/v1 and, for tooling written before versioning, under /api
+	api.registerRoutes(router.Group("/api/" + APIVersion))
+	api.registerRoutes(router.Group("/api", DeprecatedAPI()))
+
+	return router
+}
+
+// registerRoutes registers every API route below base.
+func (a *API) registerRoutes(base *gin.RouterGroup) {
+	cfg := a.Config
 
 	// Public group for authentication
-	auth := router.Group("/api/auth")
+	// When client certificates are required, no passwords or tokens are issued at all
+	auth := base.Group("/auth")
 	{
-		auth.POST("/login", api.Login())
-		auth.POST("/logout", api.Logout())
+		auth.POST("/logout", a.Logout())
+		auth.POST("/revoke", a.RevokeToken)
+		auth.GET("/providers", a.GetAuthProviders)
+		if cfg.API.TLS.ClientCertMode() != config.ClientCertsRequired {
+			auth.POST("/login", a.Login())
+			auth.POST("/refresh", a.RefreshToken)
+			auth.GET("/oidc/login", a.OIDCLogin)
+			auth.GET("/oidc/callback", a.OIDCCallback)
+		}
 	}
 
 	// Protected group for C2 operations
-	protected := router.Group("/api")
-	protected.Use(api.AuthMiddlewareWithSession(jwtSecret))
+	// Reads are open to every role; changes need "operator", infrastructure changes need "admin".
+	// Which commands an operator may task is decided per command by the CommandPolicy.
+	protected := base.Group("")
+	protected.Use(a.AuthMiddlewareWithSession())
+	operator := a.RequireRole(service.RoleOperator)
+	admin := a.RequireRole(service.RoleAdmin)
+
+	// Engagement data: only visible within the engagement selected by EngagementMiddleware
+	scoped := protected.Group("", a.EngagementMiddleware())
 	{
+		// Password change is the only endpoint open to operators who must change their password
+		protected.POST("/auth/change-password", a.ChangePassword)
+
 		// WebSocket endpoint
-		protected.GET("/ws", api.serveWs)
+		scoped.GET("/ws", a.serveWs)
+		scoped.GET("/presence", a.GetPresence)
+
+		// Engagements
+		protected.GET("/engagements", a.GetEngagements)
+		protected.GET("/engagements/:name", a.GetEngagement)
+		protected.POST("/engagements/:name/activate", a.ActivateEngagement)
+		protected.POST("/engagements", admin, a.CreateEngagement)
+		protected.PUT("/engagements/:name", admin, a.UpdateEngagement)
+		protected.POST("/engagements/:name/members", admin, a.AddEngagementMember)
+		protected.DELETE("/engagements/:name/members/:username", admin, a.RemoveEngagementMember)
 
 		// Beacon management
-		protected.GET("/beacons", api.GetBeacons)
-		protected.GET("/beacons/:beacon_id", api.GetBeacon)
-		protected.PUT("/beacons/:beacon_id", api.UpdateBeacon)
-		protected.DELETE("/beacons/:beacon_id", api.DeleteBeacon)
+		scoped.GET("/beacons", a.GetBeacons)
+		scoped.GET("/beacons/:beacon_id", a.GetBeacon)
+		scoped.PUT("/beacons/:beacon_id", operator, a.UpdateBeacon)
+		scoped.DELETE("/beacons/:beacon_id", admin, a.DeleteBeacon)
+		scoped.POST("/beacons/:beacon_id/archive", operator, a.ArchiveBeacon)
+		scoped.POST("/beacons/:beacon_id/restore", operator, a.RestoreBeacon)
+		scoped.POST("/beacons/:beacon_id/claim", operator, a.ClaimBeacon)
+		scoped.DELETE("/beacons/:beacon_id/claim", operator, a.ReleaseBeacon)
+		scoped.GET("/claims", a.GetClaims)
+
+		// Moving beacons between TeamServers (admin only); archives hold session keys
+		scoped.POST("/beacons/export", admin, a.ExportBeacons)
+		scoped.POST("/beacons/import", admin, a.ImportBeacons)
+
+		// Beacon and task notes
+		scoped.GET("/beacons/:beacon_id/notes", a.GetBeaconNotes)
+		scoped.POST("/beacons/:beacon_id/notes", operator, a.AddBeaconNote)
+		scoped.GET("/tasks/:task_id/notes", a.GetTaskNotes)
+		scoped.POST("/tasks/:task_id/notes", operator, a.AddTaskNote)
+		scoped.PUT("/notes/:note_id", operator, a.UpdateNote)
+		scoped.DELETE("/notes/:note_id", operator, a.DeleteNote)
+
+		// Team chat
+		scoped.GET("/chat", a.GetChatMessages)
+		scoped.POST("/chat", a.SendChatMessage)
+
+		// Notification rules
+		scoped.GET("/notification-rules", a.GetNotificationRules)
+		scoped.POST("/notification-rules", operator, a.CreateNotificationRule)
+		scoped.GET("/notification-rules/:rule_id", a.GetNotificationRule)
+		scoped.PUT("/notification-rules/:rule_id", operator, a.UpdateNotificationRule)
+		scoped.DELETE("/notification-rules/:rule_id", operator, a.DeleteNotificationRule)
 
 		// Task management
-		protected.POST("/beacons/:beacon_id/tasks", api.CreateTaskForBeacon)
-		protected.GET("/beacons/:beacon_id/tasks", api.GetTasksForBeacon)
-		protected.GET("/tasks/:task_id", api.GetTask)
-		protected.DELETE("/tasks/:task_id", api.CancelTask)
+		scoped.POST("/beacons/:beacon_id/tasks", a.CreateTaskForBeacon)
+		scoped.GET("/beacons/:beacon_id/tasks", a.GetTasksForBeacon)
+		scoped.GET("/beacons/:beacon_id/settings", a.GetBeaconSettings)
+		scoped.PATCH("/beacons/:beacon_id/settings", a.UpdateBeaconSettings)
+		scoped.GET("/tasks/:task_id", a.GetTask)
+		scoped.GET("/tasks/:task_id/output", a.GetTaskOutput)
+		scoped.DELETE("/tasks/:task_id", operator, a.CancelTask)
+		scoped.GET("/attack-coverage", a.GetAttackCoverage)
+		protected.GET("/commands", a.GetCommands)
+
+		// Reports
+		scoped.GET("/reports/engagement", a.GetEngagementReport)
+		scoped.GET("/reports/deconfliction", a.GetDeconflictionLog)
+
+		// Playbooks: templates are shared, runs belong to the beacon's engagement
+		protected.GET("/playbooks", a.GetPlaybooks)
+		protected.GET("/playbooks/:name", a.GetPlaybook)
+		protected.POST("/playbooks", operator, a.CreatePlaybook)
+		protected.PUT("/playbooks/:name", operator, a.UpdatePlaybook)
+		protected.DELETE("/playbooks/:name", operator, a.DeletePlaybook)
+		scoped.POST("/beacons/:beacon_id/playbooks", a.StartPlaybook)
+		scoped.GET("/playbook-runs", a.GetPlaybookRuns)
+		scoped.GET("/playbook-runs/:run_id", a.GetPlaybookRun)
+		scoped.DELETE("/playbook-runs/:run_id", operator, a.CancelPlaybookRun)
+
+		// Host inventory, harvested credentials and the network map built from them
+		scoped.GET("/hosts", a.GetHosts)
+		scoped.GET("/hosts/:host_id", a.GetHost)
+		scoped.POST("/hosts", operator, a.CreateHost)
+		scoped.DELETE("/hosts/:host_id", operator, a.DeleteHost)
+		scoped.GET("/credentials", a.GetCredentials)
+		scoped.POST("/credentials", operator, a.CreateCredential)
+		scoped.DELETE("/credentials/:credential_id", operator, a.DeleteCredential)
+		scoped.GET("/network-map", a.GetNetworkMap)
 
 		// Listener management
-		protected.GET("/listeners", api.GetListeners)
-		protected.POST("/listeners", api.CreateListener)
-		protected.DELETE("/listeners/:name", api.DeleteListener)
-		protected.POST("/listeners/:name/start", api.StartListener)
-		protected.POST("/listeners/:name/stop", api.StopListener)
-		protected.POST("/listeners/:name/restart", api.RestartListener)
+		scoped.GET("/listeners", a.GetListeners)
+		scoped.POST("/listeners", admin, a.CreateListener)
+		scoped.DELETE("/listeners/:name", admin, a.DeleteListener)
+		scoped.POST("/listeners/:name/start", admin, a.StartListener)
+		scoped.POST("/listeners/:name/stop", admin, a.StopListener)
+		scoped.POST("/listeners/:name/restart", admin, a.RestartListener)
+		scoped.POST("/listeners/:name/deploy", admin, a.DeployListener)
+		scoped.POST("/listeners/:name/rebundle", admin, a.RebundleListener)
+		scoped.PUT("/listeners/:name/probe", admin, a.SetListenerProbe)
+		scoped.POST("/listeners/:name/probe", admin, a.ProbeListener)
+		scoped.GET("/listeners/:name/probes", a.GetListenerProbes)
+		scoped.GET("/listeners/:name/hosted-files", a.GetHostedFiles)
+		scoped.POST("/listeners/:name/hosted-files", operator, a.HostFile)
+		scoped.DELETE("/listeners/:name/hosted-files/:file_id", operator, a.UnhostFile)
+		scoped.GET("/listeners/:name/canaries", a.GetCanaries)
+		scoped.POST("/listeners/:name/canaries", operator, a.CreateCanary)
+		scoped.GET("/listeners/:name/canaries/:canary_id/hits", a.GetCanaryHits)
+		scoped.DELETE("/listeners/:name/canaries/:canary_id", operator, a.DeleteCanary)
+
+		// Redirector infrastructure (admin only): servers are provisioned and destroyed in the background
+		protected.GET("/infrastructure/providers", admin, a.GetInfraProviders)
+		scoped.GET("/infrastructure/assets", admin, a.GetInfraAssets)
+		scoped.POST("/infrastructure/assets", admin, a.ProvisionInfraAsset)
+		scoped.GET("/infrastructure/assets/:asset_id", admin, a.GetInfraAsset)
+		scoped.DELETE("/infrastructure/assets/:asset_id", admin, a.DestroyInfraAsset)
+
+		// External C2 (admin or "external-c2" API keys): third-party implants bridged in through
+		// listeners of type "external", independent of the listener gRPC bridge
+		scoped.POST("/external-c2/beacons", admin, a.RegisterExternalBeacon)
+		scoped.POST("/external-c2/beacons/:beacon_id/checkin", admin, a.ExternalCheckIn)
+		scoped.POST("/external-c2/beacons/:beacon_id/output", admin, a.PushExternalOutput)
+		scoped.GET("/external-c2/beacons/:beacon_id/tasks/:task_id/file", admin, a.GetExternalTaskFile)
+
+		// Payload builder
+		scoped.POST("/payloads", operator, a.CreatePayload)
+		scoped.GET("/payloads", a.GetPayloads)
+		scoped.GET("/payloads/burned", a.GetBurnedPayloads)
+		scoped.GET("/payloads/:payload_id", a.GetPayload)
+		scoped.GET("/payloads/:payload_id/download", a.DownloadPayload)
+		scoped.GET("/payloads/:payload_id/detonations", a.GetPayloadDetonations)
+		scoped.POST("/payloads/:payload_id/burn", operator, a.BurnPayload)
+		protected.GET("/build-profiles", a.GetBuildProfiles)
+		protected.POST("/build-profiles", operator, a.CreateBuildProfile)
+		protected.GET("/build-profiles/:name", a.GetBuildProfile)
+		protected.PUT("/build-profiles/:name", operator, a.UpdateBuildProfile)
+		protected.DELETE("/build-profiles/:name", operator, a.DeleteBuildProfile)
+
+		// Operator management (admin only)
+		operators := protected.Group("/operators")
+		operators.Use(admin)
+		{
+			operators.GET("", a.GetOperators)
+			operators.POST("", a.CreateOperator)
+			operators.GET("/:username", a.GetOperator)
+			operators.PUT("/:username", a.UpdateOperator)
+			operators.DELETE("/:username", a.DeleteOperator)
+			operators.POST("/:username/certificate", a.IssueOperatorCertificate)
+			operators.DELETE("/:username/certificate", a.RevokeOperatorCertificates)
+		}
+
+		// Operator sessions (admin only)
+		protected.GET("/sessions", admin, a.GetSessions)
+		protected.DELETE("/sessions/:id", admin, a.RevokeSession)
+
+		// Service API keys (admin only); a new key is bound to the selected engagement
+		protected.GET("/api-keys", admin, a.GetServiceAPIKeys)
+		scoped.POST("/api-keys", admin, a.CreateServiceAPIKey)
+		protected.DELETE("/api-keys/:key_id", admin, a.RevokeServiceAPIKey)
+
+		// Audit log (admin only)
+		protected.GET("/audit", admin, a.GetAuditLogs)
+		protected.GET("/audit/export", admin, a.ExportAuditLogs)
+
+		// Dashboard statistics (admin only), of all engagements unless ?engagement= is set
+		protected.GET("/stats", admin, a.GetStats)
+
+		// Database backups (admin only); restoring replaces everything and needs a restart
+		protected.GET("/backups", admin, a.GetBackups)
+		protected.POST("/backups", admin, a.CreateBackup)
+		protected.POST("/backups/import", admin, a.ImportBackup)
+		protected.GET("/backups/:name", admin, a.DownloadBackup)
+		protected.DELETE("/backups/:name", admin, a.DeleteBackup)
+		protected.POST("/backups/:name/restore", admin, a.RestoreBackup)
+
+		// Data retention (admin only): GET is a dry run of the policies, POST applies them now
+		protected.GET("/retention", admin, a.GetRetentionReport)
+		protected.POST("/retention/run", admin, a.ApplyRetention)
+
+		// CA rotation (admin only): rotate, reissue certificates (listeners via POST /listeners), then retire
+		protected.GET("/pki/ca", admin, a.GetCAStatus)
+		protected.POST("/pki/ca/rotate", admin, a.RotateCA)
+		protected.POST("/pki/ca/retire", admin, a.RetireCA)
+		protected.POST("/pki/server-certificate", admin, a.ReissueServerCertificate)
+
+		// Log levels (admin only); changes last until the next restart
+		protected.GET("/logging/levels", admin, a.GetLogLevels)
+		protected.PUT("/logging/levels", admin, a.SetLogLevels)
+
+		// Kill-switch (admin only): prepare returns the confirmation token needed to execute
+		protected.POST("/burn/prepare", admin, a.PrepareBurn)
+		protected.POST("/burn", admin, a.ExecuteBurn)
+
+		// Artifact tracking
+		scoped.GET("/artifacts", a.GetArtifacts)
+		scoped.GET("/artifacts/export", a.ExportArtifacts)
 
 		// File operations
-		protected.POST("/upload/init", api.UploadInit)
-		protected.POST("/upload/chunk", api.UploadChunk)
-		protected.POST("/upload/complete", api.UploadComplete)
-		protected.GET("/loot/*filepath", api.DownloadLootFile)
-	}
+		protected.POST("/upload/init", operator, a.UploadInit)
+		protected.POST("/upload/chunk", operator, a.UploadChunk)
+		protected.POST("/upload/complete", operator, a.UploadComplete)
 
-	return router
+		// Loot collected from beacons
+		scoped.GET("/loot", a.GetLoot)
+		scoped.GET("/loot/:loot_id", a.GetLootItem)
+		scoped.GET("/loot/:loot_id/download", a.DownloadLootFile)
+		scoped.GET("/beacons/:beacon_id/screenshots", a.GetBeaconScreenshots)
+		scoped.PUT("/loot/:loot_id", operator, a.UpdateLootItem)
+		scoped.DELETE("/loot/:loot_id", operator, a.DeleteLootItem)
+		protected.GET("/loot-usage", admin, a.GetLootUsage)
+		protected.POST("/loot-cleanup", admin, a.CleanupLoot)
+	}
 }
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+	"simplec2/teamserver/sso"
+
+	"github.com/gin-gonic/gin"
+)
+
+// externalLogin maps an external identity to a role and provisions the operator account.
+func (a *API) externalLogin(c *gin.Context, identity *sso.Identity, mapping map[string]string, defaultRole string) (*data.Operator, error) {
+	role := service.HighestRole(sso.MatchGroups(mapping, identity.Groups))
+	if role == "" {
+		role = defaultRole
+	}
+	if role == "" {
+		logger.Ctx(c.Request.Context()).Warnf("%s user %s has no group mapped to a role (groups: %v)", identity.Provider, identity.Username, identity.Groups)
+		return nil, service.ErrInvalidCredentials
+	}
+	return a.OperatorService.ProvisionExternal(c.Request.Context(), identity.Username, identity.Provider, role, c.ClientIP())
+}
+
+// ldapLogin verifies credentials against the directory and provisions the operator account.
+func (a *API) ldapLogin(c *gin.Context, username, password string) (*data.Operator, error) {
+	identity, err := a.LDAP.Authenticate(username, password)
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Warnf("LDAP login for user %s failed: %v", username, err)
+		return nil, service.ErrInvalidCredentials
+	}
+	mapping, defaultRole := a.LDAP.RoleMapping()
+	return a.externalLogin(c, identity, mapping, defaultRole)
+}
+
+// GetAuthProviders reports which login methods are enabled, for the login page.
+// If the request carries a client certificate of an operator, that operator is returned as
+// certificate_user so the Web UI can offer certificate login.
+func (a *API) GetAuthProviders(c *gin.Context) {
+	certMode := a.Config.API.TLS.ClientCertMode()
+	passwordLogin := certMode != config.ClientCertsRequired
+	providers := gin.H{
+		"local":               passwordLogin,
+		"oidc":                passwordLogin && a.OIDC != nil,
+		"ldap":                passwordLogin && a.LDAP != nil,
+		"client_certificates": certMode,
+	}
+	if cert := clientCertificate(c); cert != nil && certMode != config.ClientCertsOff {
+		if operator, err := a.OperatorService.AuthenticateCertificate(c.Request.Context(), cert.SerialNumber.String(), cert.Subject.CommonName); err == nil {
+			providers["certificate_user"] = operator.Username
+		}
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(providers, nil))
+}
+
+// OIDCLogin redirects the browser to the identity provider.
+func (a *API) OIDCLogin(c *gin.Context) {
+	if a.OIDC == nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "OIDC login is not enabled", ""))
+		return
+	}
+	authURL, err := a.OIDC.AuthCodeURL()
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to start OIDC login", err.Error()))
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback completes the OIDC login and issues a TeamServer token.
+// If a UI redirect URL is configured the browser is sent there with the token in the URL fragment.
+func (a *API) OIDCCallback(c *gin.Context) {
+	if a.OIDC == nil {
+		Respond(c, http.StatusNotFound, NewErrorResponse(http.StatusNotFound, "OIDC login is not enabled", ""))
+		return
+	}
+	if errCode := c.Query("error"); errCode != "" {
+		Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "OIDC login failed", errCode+": "+c.Query("error_description")))
+		return
+	}
+
+	identity, err := a.OIDC.Exchange(c.Request.Context(), c.Query("state"), c.Query("code"))
+	if err != nil {
+		logger.Ctx(c.Request.Context()).Warnf("OIDC login failed: %v", err)
+		Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "OIDC login failed", err.Error()))
+		return
+	}
+	mapping, defaultRole := a.OIDC.RoleMapping()
+	c.Set("username", identity.Username)
+	operator, err := a.externalLogin(c, identity, mapping, defaultRole)
+	if err != nil {
+		if err != service.ErrInvalidCredentials {
+			logger.Ctx(c.Request.Context()).Errorf("OIDC login for user %s failed: %v", identity.Username, err)
+		}
+		Respond(c, http.StatusUnauthorized, NewErrorResponse(http.StatusUnauthorized, "Invalid credentials", ""))
+		return
+	}
+
+	tokens, err := a.issueTokens(c, operator, nil)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, NewErrorResponse(http.StatusInternalServerError, "Failed to create token", err.Error()))
+		return
+	}
+
+	if uiURL := a.OIDC.UIRedirectURL(); uiURL != "" {
+		fragment := url.Values{"token": {tokens.AccessToken}, "refresh_token": {tokens.RefreshToken}, "user": {operator.Username}}
+		c.Redirect(http.StatusFound, uiURL+"#"+fragment.Encode())
+		return
+	}
+	Respond(c, http.StatusOK, NewSuccessResponse(tokens.response(operator), nil))
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingMiddleware records a span for every API request, named after its route and continuing
+// a trace the client started (W3C traceparent header). Probes aren't traced. Handlers pass the
+// span on to the services through the request context.
+func TracingMiddleware(serviceName string) []gin.HandlerFunc {
+	notProbe := func(c *gin.Context) bool {
+		return c.Request.URL.Path != "/healthz" && c.Request.URL.Path != "/readyz"
+	}
+	return []gin.HandlerFunc{
+		otelgin.Middleware(serviceName, otelgin.WithGinFilter(notProbe)),
+		func(c *gin.Context) {
+			span := trace.SpanFromContext(c.Request.Context())
+			span.SetAttributes(attribute.String("simplec2.request_id", c.GetString(requestIDKey)))
+			c.Next()
+			if username := c.GetString("username"); username != "" {
+				span.SetAttributes(attribute.String("enduser.id", username))
+			}
+		},
+	}
+}
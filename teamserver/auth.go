@@ -4,36 +4,66 @@ import (
 	"context"
 	"strings"
 
+	"simplec2/teamserver/service"
+
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
-// NewAuthInterceptor returns a gRPC unary server interceptor that validates an API key.
-func NewAuthInterceptor(expectedAPIKey string) grpc.UnaryServerInterceptor {
+// NewAuthInterceptor returns a gRPC unary server interceptor that validates an API key: the calling
+// listener's own key if it has one, the shared key otherwise. expectedAPIKey returns the current
+// shared key, which may be rotated in a secret manager. It must run after NewListenerIdentityInterceptor.
+func NewAuthInterceptor(expectedAPIKey func() string, listeners service.ListenerService) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			return nil, status.Error(codes.Unauthenticated, "missing metadata")
+		if err := checkAPIKey(ctx, expectedAPIKey(), listeners); err != nil {
+			return nil, err
 		}
 
-		authHeader, ok := md["authorization"]
-		if !ok || len(authHeader) == 0 {
-			return nil, status.Error(codes.Unauthenticated, "missing authorization header")
-		}
+		// If the API key is valid, proceed with the original handler.
+		return handler(ctx, req)
+	}
+}
 
-		parts := strings.Split(authHeader[0], " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			return nil, status.Error(codes.Unauthenticated, "invalid authorization header format")
+// NewAuthStreamInterceptor is the stream counterpart of NewAuthInterceptor.
+func NewAuthStreamInterceptor(expectedAPIKey func() string, listeners service.ListenerService) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkAPIKey(ss.Context(), expectedAPIKey(), listeners); err != nil {
+			return err
 		}
+		return handler(srv, ss)
+	}
+}
 
-		if parts[1] != expectedAPIKey {
-			return nil, status.Error(codes.Unauthenticated, "invalid API key")
-		}
+// checkAPIKey validates the API key in the authorization metadata of a call. Listeners with a key
+// of their own (see ListenerService.RotateAPIKey) can't use the shared key.
+func checkAPIKey(ctx context.Context, expectedAPIKey string, listeners service.ListenerService) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing metadata")
+	}
 
-		// If the API key is valid, proceed with the original handler.
-		return handler(ctx, req)
+	authHeader, ok := md["authorization"]
+	if !ok || len(authHeader) == 0 {
+		return status.Error(codes.Unauthenticated, "missing authorization header")
+	}
+
+	parts := strings.Split(authHeader[0], " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return status.Error(codes.Unauthenticated, "invalid authorization header format")
 	}
-}
 
+	if identity, ok := listenerIdentityFrom(ctx); ok && identity.ListenerName != "" {
+		if valid, hasOwnKey := listeners.CheckAPIKey(identity.ListenerName, parts[1]); hasOwnKey {
+			if !valid {
+				return status.Error(codes.Unauthenticated, "invalid API key")
+			}
+			return nil
+		}
+	}
+	if expectedAPIKey == "" || parts[1] != expectedAPIKey {
+		return status.Error(codes.Unauthenticated, "invalid API key")
+	}
+	return nil
+}
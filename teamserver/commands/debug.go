@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"simplec2/teamserver/data"
+)
+
+// CommandIDDebug Debug 命令 ID (与 agent 保持一致)
+const CommandIDDebug uint32 = 18
+
+// defaultDebugMinutes 和 maxDebugMinutes 限制 debug on 的记录时长
+const (
+	defaultDebugMinutes = 10
+	maxDebugMinutes     = 1440
+)
+
+// DebugArgs 定义 debug 命令的参数结构，与 agent 保持一致
+type DebugArgs struct {
+	Action  string `json:"action"`  // "on", "off" 或 "dump"
+	Minutes int    `json:"minutes"` // on: 记录多长时间
+}
+
+// DebugCommand 实现 debug 命令的转换器
+type DebugCommand struct{}
+
+func init() {
+	Register(&DebugCommand{})
+}
+
+func (c *DebugCommand) Name() string {
+	return "debug"
+}
+
+func (c *DebugCommand) CommandID() uint32 {
+	return CommandIDDebug
+}
+
+func (c *DebugCommand) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Record the beacon's log in memory for a while; dump or off returns it as output",
+		ArgumentFormat: ArgumentFormatText,
+		Arguments: Schema{
+			"type":        "string",
+			"pattern":     `^\s*(on(\s+\d+)?|off|dump)\s*$`,
+			"description": "on [minutes] (default 10, at most 1440), dump (return the log so far) or off (stop and return the log)",
+		},
+		OPSEC: "The log holds the beacon's recent activity in its memory until it is dumped; keep the window short.",
+	}
+}
+
+func (c *DebugCommand) Convert(task *data.Task) ([]byte, error) {
+	parts := strings.Fields(task.Arguments)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("debug command requires arguments: on [minutes] | off | dump")
+	}
+
+	args := DebugArgs{Action: parts[0]}
+	switch args.Action {
+	case "on":
+		args.Minutes = defaultDebugMinutes
+		if len(parts) > 1 {
+			minutes, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid debug minutes: %v", err)
+			}
+			args.Minutes = minutes
+		}
+		if args.Minutes < 1 || args.Minutes > maxDebugMinutes {
+			return nil, fmt.Errorf("debug minutes must be between 1 and %d, got %d", maxDebugMinutes, args.Minutes)
+		}
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("debug on takes at most one argument")
+		}
+	case "off", "dump":
+		if len(parts) > 1 {
+			return nil, fmt.Errorf("debug %s takes no arguments", args.Action)
+		}
+	default:
+		return nil, fmt.Errorf("unknown debug action '%s': expected on, off or dump", args.Action)
+	}
+
+	jsonArgs, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal debug arguments: %v", err)
+	}
+	return jsonArgs, nil
+}
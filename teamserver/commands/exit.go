@@ -22,6 +22,14 @@ func (c *ExitConverter) CommandID() uint32 {
 	return CommandIDExit
 }
 
+func (c *ExitConverter) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Terminate the beacon process",
+		ArgumentFormat: ArgumentFormatNone,
+		OPSEC:          "The access is lost unless another beacon or persistence exists on the host.",
+	}
+}
+
 func (c *ExitConverter) Convert(task *data.Task) ([]byte, error) {
 	// Exit 命令不需要参数
 	return nil, nil
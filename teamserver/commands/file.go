@@ -3,10 +3,10 @@ package commands
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 
 	"simplec2/pkg/logger"
 	"simplec2/teamserver/data"
+	"simplec2/teamserver/filecrypt"
 )
 
 // CommandIDFile 统一文件操作命令 ID
@@ -41,6 +41,28 @@ func (c *downloadConverter) CommandID() uint32 {
 	return CommandIDFile
 }
 
+func (c *downloadConverter) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Write a file from the TeamServer to the target",
+		ArgumentFormat: ArgumentFormatJSON,
+		Arguments: Schema{
+			"type": "object",
+			"properties": Schema{
+				"source":      Schema{"type": "string", "minLength": 1, "description": "File in the uploads directory of the TeamServer"},
+				"destination": Schema{"type": "string", "minLength": 1, "description": "Path of the file on the target"},
+			},
+			"required":             []string{"source", "destination"},
+			"additionalProperties": false,
+		},
+		OPSEC: "Leaves the file on disk, where AV may scan it; it is recorded as an artifact for cleanup.",
+	}
+}
+
+// download 将 TeamServer 上的文件写入目标主机
+func (c *downloadConverter) Techniques(task *data.Task) []string {
+	return []string{"T1105"}
+}
+
 func (c *downloadConverter) Convert(task *data.Task) ([]byte, error) {
 	if task.Arguments == "" {
 		logger.Warnf("Download task %s has no arguments", task.TaskID)
@@ -55,7 +77,8 @@ func (c *downloadConverter) Convert(task *data.Task) ([]byte, error) {
 		return nil, fmt.Errorf("failed to parse download arguments: %v", err)
 	}
 
-	fileInfo, err := os.Stat(downloadArgs.Source)
+	// Uploaded files may be encrypted at rest, the beacon receives the plaintext
+	fileSize, err := filecrypt.Size(downloadArgs.Source)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get file info for %s: %v", downloadArgs.Source, err)
 	}
@@ -65,7 +88,7 @@ func (c *downloadConverter) Convert(task *data.Task) ([]byte, error) {
 		"action":      "download",
 		"source":      downloadArgs.Source,
 		"destination": downloadArgs.Destination,
-		"file_size":   fileInfo.Size(),
+		"file_size":   fileSize,
 		"chunk_size":  ChunkSize,
 	}
 
@@ -83,6 +106,20 @@ func (c *uploadConverter) CommandID() uint32 {
 	return CommandIDFile
 }
 
+func (c *uploadConverter) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Read a file on the target and save it as loot",
+		ArgumentFormat: ArgumentFormatText,
+		Arguments:      Schema{"type": "string", "minLength": 1, "description": "Path of the file on the target"},
+		OPSEC:          "The whole file is read into memory and sent over the C2 channel; large files mean a visible burst of outbound traffic.",
+	}
+}
+
+// upload 从目标主机读取文件并经 C2 通道回传
+func (c *uploadConverter) Techniques(task *data.Task) []string {
+	return []string{"T1005", "T1041"}
+}
+
 func (c *uploadConverter) Convert(task *data.Task) ([]byte, error) {
 	fileOpArgs := map[string]string{
 		"action": "upload",
@@ -91,6 +128,10 @@ func (c *uploadConverter) Convert(task *data.Task) ([]byte, error) {
 	return json.Marshal(fileOpArgs)
 }
 
+func (c *browseConverter) OutputType(output string) string {
+	return jsonOutputType(output, OutputTypeFileListing)
+}
+
 // browseConverter 处理 browse 命令
 type browseConverter struct{}
 
@@ -102,6 +143,19 @@ func (c *browseConverter) CommandID() uint32 {
 	return CommandIDFile
 }
 
+func (c *browseConverter) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "List a directory on the target",
+		ArgumentFormat: ArgumentFormatText,
+		Arguments:      Schema{"type": "string", "description": "Directory, relative to the beacon's working directory; empty for the working directory"},
+		OPSEC:          "Reads the directory through native APIs without spawning a child process.",
+	}
+}
+
+func (c *browseConverter) Techniques(task *data.Task) []string {
+	return []string{"T1083"}
+}
+
 func (c *browseConverter) Convert(task *data.Task) ([]byte, error) {
 	fileOpArgs := map[string]string{
 		"action": "list",
@@ -121,6 +175,19 @@ func (c *rmConverter) CommandID() uint32 {
 	return CommandIDFile
 }
 
+func (c *rmConverter) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Delete a file or directory on the target",
+		ArgumentFormat: ArgumentFormatText,
+		Arguments:      Schema{"type": "string", "minLength": 1, "description": "Path of the file or directory on the target"},
+		OPSEC:          "Directories are deleted recursively and nothing goes to the recycle bin; double-check the path.",
+	}
+}
+
+func (c *rmConverter) Techniques(task *data.Task) []string {
+	return []string{"T1070.004"}
+}
+
 func (c *rmConverter) Convert(task *data.Task) ([]byte, error) {
 	fileOpArgs := map[string]string{
 		"action": "rm",
@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"simplec2/teamserver/data"
+)
+
+// CommandIDHibernate Hibernate 命令 ID (与 agent 保持一致)
+const CommandIDHibernate uint32 = 16
+
+// HibernateArgs 定义 hibernate 命令的参数结构，与 agent 保持一致
+type HibernateArgs struct {
+	Until int64 `json:"until"` // Unix 时间戳（秒）
+}
+
+// HibernateCommand 实现 hibernate 命令的转换器
+type HibernateCommand struct{}
+
+func init() {
+	Register(&HibernateCommand{})
+}
+
+func (c *HibernateCommand) Name() string {
+	return "hibernate"
+}
+
+func (c *HibernateCommand) CommandID() uint32 {
+	return CommandIDHibernate
+}
+
+func (c *HibernateCommand) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Stop checking in until the given time",
+		ArgumentFormat: ArgumentFormatText,
+		Arguments: Schema{
+			"type":        "string",
+			"pattern":     `^\s*(\d+|\d{4}-\d{2}-\d{2}T\S+)\s*$`,
+			"description": "Future time as RFC3339, e.g. \"2026-10-20T08:00:00Z\", or unix seconds",
+		},
+		OPSEC: "The beacon cannot be tasked before it wakes up; a host rebooted meanwhile loses it unless it is persisted.",
+	}
+}
+
+func (c *HibernateCommand) Convert(task *data.Task) ([]byte, error) {
+	until, err := ParseHibernateUntil(task.Arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonArgs, err := json.Marshal(HibernateArgs{Until: until.Unix()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal hibernate arguments: %v", err)
+	}
+
+	return jsonArgs, nil
+}
+
+// ParseHibernateUntil 解析 hibernate 参数，支持 RFC3339 时间或 Unix 时间戳（秒）
+func ParseHibernateUntil(arguments string) (time.Time, error) {
+	arg := strings.TrimSpace(arguments)
+	if arg == "" {
+		return time.Time{}, fmt.Errorf("hibernate command requires arguments: <RFC3339 timestamp | unix seconds>")
+	}
+
+	var until time.Time
+	if unix, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		until = time.Unix(unix, 0)
+	} else {
+		parsed, err := time.Parse(time.RFC3339, arg)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid hibernate timestamp '%s': expected RFC3339 or unix seconds", arg)
+		}
+		until = parsed
+	}
+
+	if !until.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("hibernate timestamp must be in the future, got %s", until.Format(time.RFC3339))
+	}
+
+	return until, nil
+}
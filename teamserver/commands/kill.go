@@ -24,6 +24,15 @@ func (c *KillCommand) CommandID() uint32 {
 	return CommandIDKill
 }
 
+func (c *KillCommand) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Kill a process by PID",
+		ArgumentFormat: ArgumentFormatText,
+		Arguments:      Schema{"type": "string", "pattern": `^\d+$`, "description": "PID of the process"},
+		OPSEC:          "Killing security tooling or user processes is noticeable and may trigger tamper protection alerts.",
+	}
+}
+
 func (c *KillCommand) Convert(task *data.Task) ([]byte, error) {
 	// The task.Arguments from the TeamServer will be the PID as a string.
 	// We just pass it through to the agent.
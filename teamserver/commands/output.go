@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// 任务输出类型，客户端据此选择渲染方式（Task.OutputType）
+const (
+	OutputTypeText        = "text"         // 纯文本
+	OutputTypeJSONTable   = "json-table"   // JSON 对象或对象数组，按键值/表格渲染
+	OutputTypeFileListing = "file-listing" // browse 返回的 JSON 文件列表
+	OutputTypeProcessList = "process-list" // ps 返回的 JSON 进程列表
+	OutputTypeScreenshot  = "screenshot"   // 截图的 loot ID
+	OutputTypePortscan    = "portscan"     // 端口扫描结果文本（如 nmap）
+)
+
+// OutputTyper 可选接口：命令转换器根据最终输出声明其输出类型
+// 未实现此接口的命令输出均为 OutputTypeText
+type OutputTyper interface {
+	OutputType(output string) string
+}
+
+// OutputTypeOf 返回命令最终输出的类型
+func OutputTypeOf(command, output string) string {
+	if converter, ok := Get(command); ok {
+		if typer, ok := converter.(OutputTyper); ok {
+			return typer.OutputType(output)
+		}
+	}
+	return OutputTypeText
+}
+
+// jsonOutputType 输出为合法 JSON 时返回 outputType，否则（如 beacon 返回的错误信息）返回 OutputTypeText
+func jsonOutputType(output, outputType string) string {
+	if json.Valid([]byte(output)) {
+		return outputType
+	}
+	return OutputTypeText
+}
+
+// isLootID 判断输出是否为 loot ID
+func isLootID(output string) bool {
+	_, err := uuid.Parse(strings.TrimSpace(output))
+	return err == nil
+}
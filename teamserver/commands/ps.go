@@ -22,8 +22,24 @@ func (c *PsCommand) CommandID() uint32 {
 	return CommandIDPs
 }
 
+func (c *PsCommand) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "List the running processes",
+		ArgumentFormat: ArgumentFormatNone,
+		OPSEC:          "Runs tasklist on Windows or ps elsewhere as a child of the beacon process, which process creation logging records.",
+	}
+}
+
 func (c *PsCommand) Convert(task *data.Task) ([]byte, error) {
 	// Ps command does not require any specific arguments,
 	// so we return nil.
 	return nil, nil
 }
+
+func (c *PsCommand) Techniques(task *data.Task) []string {
+	return []string{"T1057"}
+}
+
+func (c *PsCommand) OutputType(output string) string {
+	return jsonOutputType(output, OutputTypeProcessList)
+}
@@ -31,6 +31,16 @@ func Get(name string) (CommandConverter, bool) {
 	return c, ok
 }
 
+// GetByID 根据命令 ID 获取转换器
+func GetByID(id uint32) (CommandConverter, bool) {
+	for _, c := range registry {
+		if c.CommandID() == id {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
 // GetAll 返回所有已注册的命令
 func GetAll() map[string]CommandConverter {
 	return registry
@@ -22,7 +22,27 @@ func (c *ScreenshotConverter) CommandID() uint32 {
 	return CommandIDScreenshot
 }
 
+func (c *ScreenshotConverter) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Capture the primary display; the image is saved as loot",
+		ArgumentFormat: ArgumentFormatNone,
+		OPSEC:          "Needs an interactive desktop session; screen capture APIs called by an unusual process may be flagged.",
+	}
+}
+
 func (c *ScreenshotConverter) Convert(task *data.Task) ([]byte, error) {
 	// 截图命令不需要参数
 	return nil, nil
 }
+
+func (c *ScreenshotConverter) Techniques(task *data.Task) []string {
+	return []string{"T1113"}
+}
+
+func (c *ScreenshotConverter) OutputType(output string) string {
+	// 保存失败时输出为错误信息
+	if isLootID(output) {
+		return OutputTypeScreenshot
+	}
+	return OutputTypeText
+}
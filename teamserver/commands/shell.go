@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"strings"
+
 	"simplec2/teamserver/data"
 )
 
@@ -22,7 +24,28 @@ func (c *ShellConverter) CommandID() uint32 {
 	return CommandIDShell
 }
 
+func (c *ShellConverter) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Run a command line with cmd /C on Windows or /bin/sh -c elsewhere",
+		ArgumentFormat: ArgumentFormatText,
+		Arguments:      Schema{"type": "string", "minLength": 1, "description": "Command line, e.g. \"whoami /all\""},
+		OPSEC:          "Spawns cmd.exe or /bin/sh as a child of the beacon process; process creation and command-line logging (Sysmon event 1, EDR) record it.",
+	}
+}
+
 func (c *ShellConverter) Convert(task *data.Task) ([]byte, error) {
 	// Shell 命令直接使用参数文本
 	return []byte(task.Arguments), nil
 }
+
+func (c *ShellConverter) Techniques(task *data.Task) []string {
+	return append([]string{"T1059"}, shellCommandTechniques(task.Arguments)...)
+}
+
+func (c *ShellConverter) OutputType(output string) string {
+	// 识别通过 shell 运行的 nmap 扫描结果
+	if strings.Contains(output, "Nmap scan report for") {
+		return OutputTypePortscan
+	}
+	return OutputTypeText
+}
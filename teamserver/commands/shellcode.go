@@ -25,6 +25,16 @@ func (c *ShellcodeCommand) CommandID() uint32 {
 	return CommandIDShellcode
 }
 
+func (c *ShellcodeCommand) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Run shellcode in a new thread of the beacon process",
+		ArgumentFormat: ArgumentFormatText,
+		Arguments:      Schema{"type": "string", "contentEncoding": "base64", "minLength": 1, "description": "Base64 encoded shellcode"},
+		Platforms:      []string{"windows"},
+		OPSEC:          "Allocates RWX memory with VirtualAlloc and starts a thread on it, a pattern memory scanners and EDR look for; a crashing payload takes the beacon down.",
+	}
+}
+
 func (c *ShellcodeCommand) Convert(task *data.Task) ([]byte, error) {
 	// The task.Arguments from the TeamServer is expected to be a Base64 encoded string.
 	if task.Arguments == "" {
@@ -39,3 +49,8 @@ func (c *ShellcodeCommand) Convert(task *data.Task) ([]byte, error) {
 
 	return decoded, nil
 }
+
+// Shellcode 在 beacon 自身进程中通过 VirtualAlloc 等 Win32 API 加载执行
+func (c *ShellcodeCommand) Techniques(task *data.Task) []string {
+	return []string{"T1106", "T1620"}
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"simplec2/pkg/constants"
 	"simplec2/teamserver/data"
 )
 
@@ -33,6 +34,30 @@ func (c *SleepCommand) CommandID() uint32 {
 	return CommandIDSleep
 }
 
+func (c *SleepCommand) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Change the check-in interval and jitter of the beacon",
+		ArgumentFormat: ArgumentFormatText,
+		Arguments: Schema{
+			"type":        "string",
+			"pattern":     `^\s*\d+(\s+\d+)?\s*$`,
+			"description": fmt.Sprintf("<seconds> [jitter_percent]: seconds from %d to %d, jitter from 0 to %d", constants.MinSleep, constants.MaxSleep, constants.MaxJitter),
+		},
+		OPSEC: "Short intervals make the C2 traffic regular and frequent enough for beaconing detection; keep some jitter.",
+	}
+}
+
+// ValidateSleep checks sleep seconds and a jitter percentage against the range the agent accepts.
+func ValidateSleep(sleep, jitter int) error {
+	if sleep < constants.MinSleep || sleep > constants.MaxSleep {
+		return fmt.Errorf("sleep value must be between %d and %d seconds, got %d", constants.MinSleep, constants.MaxSleep, sleep)
+	}
+	if jitter < 0 || jitter > constants.MaxJitter {
+		return fmt.Errorf("jitter value must be between 0 and %d percent, got %d", constants.MaxJitter, jitter)
+	}
+	return nil
+}
+
 func (c *SleepCommand) Convert(task *data.Task) ([]byte, error) {
 	var sleep int32 = 0
 	var jitter int32 = 0 // Default jitter
@@ -59,11 +84,8 @@ func (c *SleepCommand) Convert(task *data.Task) ([]byte, error) {
 	}
 
 	// Validate sleep and jitter before sending
-	if sleep < 1 || sleep > 3600 {
-		return nil, fmt.Errorf("sleep value must be between 1 and 3600 seconds, got %d", sleep)
-	}
-	if jitter < 0 || jitter > 99 {
-		return nil, fmt.Errorf("jitter value must be between 0 and 99 percent, got %d", jitter)
+	if err := ValidateSleep(int(sleep), int(jitter)); err != nil {
+		return nil, err
 	}
 
 	args := SleepArgs{
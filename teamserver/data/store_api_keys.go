@@ -0,0 +1,38 @@
+package data
+
+// --- Service API Key Methods ---
+
+func (s *GormStore) GetServiceAPIKeys(page int, limit int) ([]ServiceAPIKey, int64, error) {
+	var keys []ServiceAPIKey
+	var total int64
+	db := s.DB.Model(&ServiceAPIKey{})
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	err = db.Order("created_at desc").Limit(limit).Offset(offset).Find(&keys).Error
+	return keys, total, err
+}
+
+func (s *GormStore) GetServiceAPIKey(keyID string) (*ServiceAPIKey, error) {
+	var key ServiceAPIKey
+	err := s.DB.Where("key_id = ?", keyID).First(&key).Error
+	return &key, err
+}
+
+func (s *GormStore) GetServiceAPIKeyByHash(keyHash string) (*ServiceAPIKey, error) {
+	var key ServiceAPIKey
+	err := s.DB.Where("key_hash = ?", keyHash).First(&key).Error
+	return &key, err
+}
+
+func (s *GormStore) CreateServiceAPIKey(key *ServiceAPIKey) error {
+	return s.DB.Create(key).Error
+}
+
+func (s *GormStore) UpdateServiceAPIKey(key *ServiceAPIKey) error {
+	return s.DB.Save(key).Error
+}
@@ -0,0 +1,35 @@
+package data
+
+// --- Artifact Methods ---
+
+func (s *GormStore) GetArtifacts(engagement string, page int, limit int) ([]Artifact, int64, error) {
+	var artifacts []Artifact
+	var total int64
+	db := s.DB.Model(&Artifact{})
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	err = db.Order("created_at desc").Limit(limit).Offset(offset).Find(&artifacts).Error
+	return artifacts, total, err
+}
+
+func (s *GormStore) GetAllArtifacts(engagement string) ([]Artifact, error) {
+	var artifacts []Artifact
+	db := s.DB.Order("created_at")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Find(&artifacts).Error
+	return artifacts, err
+}
+
+func (s *GormStore) CreateArtifact(artifact *Artifact) error {
+	return s.DB.Create(artifact).Error
+}
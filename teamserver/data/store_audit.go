@@ -0,0 +1,79 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- Audit Log Methods ---
+
+// auditInsertBatch bounds the number of rows per INSERT statement.
+const auditInsertBatch = 500
+
+func (s *GormStore) CreateAuditLogs(entries []AuditLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.DB.CreateInBatches(entries, auditInsertBatch).Error
+}
+
+func (s *GormStore) GetAuditLogs(query *AuditLogQuery) ([]AuditLog, int64, error) {
+	var logs []AuditLog
+	var total int64
+	db := filterAuditLogs(s.DB.Model(&AuditLog{}), query)
+
+	if query.Cursor != nil {
+		err := keysetPage(db, query.Cursor, true).Limit(query.Limit).Find(&logs).Error
+		return logs, 0, err
+	}
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (query.Page - 1) * query.Limit
+	err = keysetPage(db, nil, true).Limit(query.Limit).Offset(offset).Find(&logs).Error
+	return logs, total, err
+}
+
+// IterateAuditLogs calls fn with every matching entry in batches, oldest first.
+// The page and limit of the query are ignored.
+func (s *GormStore) IterateAuditLogs(query *AuditLogQuery, batchSize int, fn func(batch []AuditLog) error) error {
+	var batch []AuditLog
+	return filterAuditLogs(s.DB.Model(&AuditLog{}), query).FindInBatches(&batch, batchSize, func(tx *gorm.DB, n int) error {
+		return fn(batch)
+	}).Error
+}
+
+func (s *GormStore) DeleteAuditLogsBefore(cutoff time.Time) (int64, error) {
+	result := s.DB.Where("created_at < ?", cutoff).Delete(&AuditLog{})
+	return result.RowsAffected, result.Error
+}
+
+// filterAuditLogs applies the filters of an audit log query.
+func filterAuditLogs(db *gorm.DB, query *AuditLogQuery) *gorm.DB {
+	if query.Username != "" {
+		db = db.Where("username = ?", query.Username)
+	}
+	if query.Method != "" {
+		db = db.Where("method = ?", query.Method)
+	}
+	if query.Path != "" {
+		db = db.Where("path LIKE ?", query.Path+"%")
+	}
+	if query.RequestID != "" {
+		db = db.Where("request_id = ?", query.RequestID)
+	}
+	if query.Status != 0 {
+		db = db.Where("status = ?", query.Status)
+	}
+	if query.Since != nil {
+		db = db.Where("created_at >= ?", *query.Since)
+	}
+	if query.Until != nil {
+		db = db.Where("created_at < ?", *query.Until)
+	}
+	return db
+}
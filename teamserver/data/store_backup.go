@@ -0,0 +1,254 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrSchemaMismatch is returned when a dump was taken at a different schema version than the database has.
+var ErrSchemaMismatch = errors.New("the backup was taken at a different schema version")
+
+// dumpBatchSize is the number of rows read or written at a time.
+const dumpBatchSize = 500
+
+// DatabaseDump describes a dump of every table, one gob stream of rows per "<table>.gob" file.
+// Dumps don't depend on the database backend, so they can also be restored into another one.
+type DatabaseDump struct {
+	Dialect    string           `json:"dialect"`
+	Migrations []string         `json:"migrations"` // Applied schema migrations
+	Tables     map[string]int64 `json:"tables"`     // Rows per table
+}
+
+// DumpDatabase writes a consistent dump of every table to dir. Soft-deleted rows are included.
+// SQLite is first copied with VACUUM INTO so writers aren't blocked while the dump runs;
+// Postgres and MySQL are read in a single read-only REPEATABLE READ transaction.
+func (s *GormStore) DumpDatabase(ctx context.Context, dir string) (*DatabaseDump, error) {
+	db := s.DB.WithContext(ctx)
+	if db.Dialector.Name() == "sqlite" {
+		snapshot := filepath.Join(dir, "snapshot.db")
+		if err := db.Exec("VACUUM INTO ?", snapshot).Error; err != nil {
+			return nil, fmt.Errorf("failed to snapshot sqlite database: %w", err)
+		}
+		defer os.Remove(snapshot)
+		snapshotDB, err := gorm.Open(sqlite.Open(snapshot), &gorm.Config{Logger: db.Logger})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open sqlite snapshot: %w", err)
+		}
+		defer closeDatabase(snapshotDB)
+		return dumpTables(snapshotDB.WithContext(ctx), dir, db.Dialector.Name())
+	}
+
+	var dump *DatabaseDump
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		dump, err = dumpTables(tx, dir, db.Dialector.Name())
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	return dump, err
+}
+
+// dumpTables writes every table of the schema to dir.
+func dumpTables(tx *gorm.DB, dir, dialect string) (*DatabaseDump, error) {
+	status, err := migrationStatus(tx)
+	if err != nil {
+		return nil, err
+	}
+	dump := &DatabaseDump{Dialect: dialect, Migrations: status.applied(), Tables: make(map[string]int64)}
+
+	for _, model := range schemaModels() {
+		table, err := tableOf(tx, model)
+		if err != nil {
+			return nil, err
+		}
+		count, err := dumpTable(tx, model, filepath.Join(dir, table.Table+".gob"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to dump table %s: %w", table.Table, err)
+		}
+		dump.Tables[table.Table] = count
+	}
+	return dump, nil
+}
+
+// dumpTable writes the rows of a model's table to a file.
+func dumpTable(tx *gorm.DB, model interface{}, path string) (int64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	enc := gob.NewEncoder(file)
+	batch := reflect.New(reflect.SliceOf(reflect.TypeOf(model).Elem()))
+	var count int64
+	result := tx.Unscoped().Model(model).FindInBatches(batch.Interface(), dumpBatchSize, func(_ *gorm.DB, _ int) error {
+		rows := batch.Elem()
+		for i := 0; i < rows.Len(); i++ {
+			if err := enc.Encode(rows.Index(i).Addr().Interface()); err != nil {
+				return err
+			}
+		}
+		count += int64(rows.Len())
+		return nil
+	})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, file.Close()
+}
+
+// RestoreDatabase replaces the content of every table with a dump written by DumpDatabase.
+// The database must be at the same schema version the dump was taken at. Everything is
+// restored in one transaction, so a failed restore leaves the database as it was.
+func (s *GormStore) RestoreDatabase(ctx context.Context, dir string, dump *DatabaseDump) error {
+	db := s.DB.WithContext(ctx)
+	status, err := migrationStatus(db)
+	if err != nil {
+		return err
+	}
+	if current := status.applied(); strings.Join(current, ",") != strings.Join(dump.Migrations, ",") {
+		return fmt.Errorf("%w: backup has [%s], database has [%s]", ErrSchemaMismatch, strings.Join(dump.Migrations, ", "), strings.Join(current, ", "))
+	}
+
+	models := schemaModels()
+	defer s.clearCache()
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := len(models) - 1; i >= 0; i-- {
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(models[i]).Error; err != nil {
+				return fmt.Errorf("failed to clear table: %w", err)
+			}
+		}
+		for _, model := range models {
+			table, err := tableOf(tx, model)
+			if err != nil {
+				return err
+			}
+			if _, ok := dump.Tables[table.Table]; !ok {
+				continue // Empty in the backup
+			}
+			if err := restoreTable(tx, model, filepath.Join(dir, table.Table+".gob")); err != nil {
+				return fmt.Errorf("failed to restore table %s: %w", table.Table, err)
+			}
+			if err := resetSequence(tx, table); err != nil {
+				return fmt.Errorf("failed to reset sequence of table %s: %w", table.Table, err)
+			}
+		}
+		return nil
+	})
+}
+
+// restoreTable inserts the rows of a dump file into a model's table.
+func restoreTable(tx *gorm.DB, model interface{}, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	table, err := tableOf(tx, model)
+	if err != nil {
+		return err
+	}
+	dec := gob.NewDecoder(file)
+	rowType := reflect.TypeOf(model).Elem()
+	insert := tx.Session(&gorm.Session{SkipHooks: true})
+	for done := false; !done; {
+		batch := reflect.MakeSlice(reflect.SliceOf(rowType), 0, dumpBatchSize)
+		for batch.Len() < dumpBatchSize {
+			row := reflect.New(rowType)
+			if err := dec.Decode(row.Interface()); err != nil {
+				if err == io.EOF {
+					done = true
+					break
+				}
+				return err
+			}
+			batch = reflect.Append(batch, row.Elem())
+		}
+		if batch.Len() == 0 {
+			break
+		}
+		// Collected before inserting, as GORM also sets the defaults in the rows
+		zeroDefaults := zeroDefaultColumns(tx, table, batch)
+		rows := reflect.New(batch.Type())
+		rows.Elem().Set(batch)
+		if err := insert.Create(rows.Interface()).Error; err != nil {
+			return err
+		}
+		for column, ids := range zeroDefaults {
+			zero := reflect.Zero(table.LookUpField(column).FieldType).Interface()
+			if err := tx.Table(table.Table).Where(clause.IN{Column: clause.Column{Name: table.PrioritizedPrimaryField.DBName}, Values: ids}).UpdateColumn(column, zero).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// zeroDefaultColumns returns, per column with a default, the primary keys of the rows holding the
+// column's zero value, e.g. a false Session.IsActive. GORM inserts the default instead, so these are
+// written back after inserting.
+func zeroDefaultColumns(tx *gorm.DB, table *schema.Schema, rows reflect.Value) map[string][]interface{} {
+	pk := table.PrioritizedPrimaryField
+	if pk == nil {
+		return nil
+	}
+	columns := make(map[string][]interface{})
+	for _, field := range table.Fields {
+		if !field.HasDefaultValue || field.DefaultValueInterface == nil || field.PrimaryKey || field.DBName == "" {
+			continue
+		}
+		for i := 0; i < rows.Len(); i++ {
+			if _, zero := field.ValueOf(tx.Statement.Context, rows.Index(i)); zero {
+				id, _ := pk.ValueOf(tx.Statement.Context, rows.Index(i))
+				columns[field.DBName] = append(columns[field.DBName], id)
+			}
+		}
+	}
+	return columns
+}
+
+// resetSequence moves a Postgres serial past the restored IDs. MySQL and SQLite do this on insert.
+func resetSequence(tx *gorm.DB, table *schema.Schema) error {
+	pk := table.PrioritizedPrimaryField
+	if tx.Dialector.Name() != "postgres" || pk == nil || !pk.AutoIncrement {
+		return nil
+	}
+	return tx.Exec(fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX(%s), 1), MAX(%s) IS NOT NULL) FROM %s",
+		table.Table, pk.DBName, pk.DBName, pk.DBName, table.Table)).Error
+}
+
+// tableOf returns the parsed schema of a model.
+func tableOf(tx *gorm.DB, model interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return nil, fmt.Errorf("failed to parse model: %w", err)
+	}
+	return stmt.Schema, nil
+}
+
+// applied returns the IDs of the applied migrations, sorted.
+func (s *SchemaStatus) applied() []string {
+	var ids []string
+	for _, m := range s.Migrations {
+		if m.Applied {
+			ids = append(ids, m.ID)
+		}
+	}
+	ids = append(ids, s.Unknown...)
+	sort.Strings(ids)
+	return ids
+}
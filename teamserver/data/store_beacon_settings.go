@@ -0,0 +1,39 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- Beacon Settings Methods ---
+
+func (s *GormStore) GetBeaconSettings(beaconID string) (*BeaconSettings, error) {
+	var settings BeaconSettings
+	err := s.DB.Where("beacon_id = ?", beaconID).First(&settings).Error
+	return &settings, err
+}
+
+// ReplaceBeaconSettings removes the intended settings of the beacon and creates the new ones in a
+// single transaction.
+func (s *GormStore) ReplaceBeaconSettings(settings *BeaconSettings) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("beacon_id = ?", settings.BeaconID).Delete(&BeaconSettings{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(settings).Error
+	})
+}
+
+// ResolveBeaconSettings moves the pending settings of a beacon applied by a task to status, and reports
+// whether they were still pending; settings requested since are left alone.
+func (s *GormStore) ResolveBeaconSettings(beaconID, taskID, status string, at time.Time) (bool, error) {
+	updates := map[string]interface{}{"status": status}
+	if status == SettingsConfirmed {
+		updates["confirmed_at"] = at
+	}
+	result := s.DB.Model(&BeaconSettings{}).
+		Where("beacon_id = ? AND task_id = ? AND status = ?", beaconID, taskID, SettingsPending).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
@@ -2,6 +2,8 @@ package data
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // --- Beacon Methods ---
@@ -11,46 +13,133 @@ func (s *GormStore) GetBeacons(query *BeaconQuery) ([]Beacon, int64, error) {
 	var total int64
 	db := s.DB.Model(&Beacon{})
 
+	if query.Engagement != "" {
+		db = db.Where("engagement = ?", query.Engagement)
+	}
+	switch query.Archived {
+	case "":
+		db = db.Where("archived_at IS NULL")
+	case "true":
+		db = db.Where("archived_at IS NOT NULL")
+	}
 	if query.Search != "" {
 		db = db.Where("hostname LIKE ? OR username LIKE ? OR internal_ip LIKE ?", "%"+query.Search+"%", "%"+query.Search+"%", "%"+query.Search+"%")
 	}
-	if query.Status == "active" {
-		// Active means seen in the last 30 seconds
-		cutoff := time.Now().Add(-30 * time.Second)
-		db = db.Where("last_seen >= ?", cutoff)
-	} else if query.Status == "inactive" {
-		// Inactive means not seen in the last 30 seconds
-		cutoff := time.Now().Add(-30 * time.Second)
-		db = db.Where("last_seen < ?", cutoff)
-	} else if query.Status != "" {
-		// Fallback for other statuses if any
+	if query.Status != "" {
+		// The status is kept up to date by the TeamServer's status calculator
 		db = db.Where("status = ?", query.Status)
 	}
 
+	if query.Cursor != nil {
+		err := keysetPage(db, query.Cursor, false).Limit(query.Limit).Find(&beacons).Error
+		return beacons, 0, err
+	}
+
 	err := db.Count(&total).Error
 	if err != nil {
 		return nil, 0, err
 	}
 
 	offset := (query.Page - 1) * query.Limit
-	err = db.Limit(query.Limit).Offset(offset).Find(&beacons).Error
+	err = keysetPage(db, nil, false).Limit(query.Limit).Offset(offset).Find(&beacons).Error
 	return beacons, total, err
 }
 
 func (s *GormStore) GetBeacon(beaconID string) (*Beacon, error) {
+	var generation uint64
+	if s.cache != nil {
+		cached, gen, ok := s.cache.beacon(beaconID)
+		if ok {
+			return cached, nil
+		}
+		generation = gen
+	}
+
 	var beacon Beacon
 	err := s.DB.Where("beacon_id = ?", beaconID).First(&beacon).Error
+	if err == nil && s.cache != nil {
+		s.cache.putBeacon(&beacon, generation)
+	}
 	return &beacon, err
 }
 
+// GetAllBeacons returns every beacon of an engagement, including archived ones, in the order they staged.
+func (s *GormStore) GetAllBeacons(engagement string) ([]Beacon, error) {
+	var beacons []Beacon
+	db := s.DB.Order("first_seen")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Find(&beacons).Error
+	return beacons, err
+}
+
 func (s *GormStore) CreateBeacon(beacon *Beacon) error {
+	defer s.evictBeacon(beacon.BeaconID)
 	return s.DB.Create(beacon).Error
 }
 
 func (s *GormStore) UpdateBeacon(beacon *Beacon) error {
+	defer s.evictBeacon(beacon.BeaconID)
 	return s.DB.Save(beacon).Error
 }
 
+// UpdateBeaconsLastSeen writes the check-in times of beacons in one transaction, touching only the
+// last_seen column. A time older than the stored one is ignored, so a late batch can't move it back.
+func (s *GormStore) UpdateBeaconsLastSeen(lastSeen map[string]time.Time) error {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		for beaconID, seen := range lastSeen {
+			if err := tx.Model(&Beacon{}).Where("beacon_id = ? AND last_seen < ?", beaconID, seen).UpdateColumn("last_seen", seen).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && s.cache != nil {
+		// Updated in place: every flush touches most beacons, evicting them would defeat the cache
+		for beaconID, seen := range lastSeen {
+			s.cache.setLastSeen(beaconID, seen)
+		}
+	}
+	return err
+}
+
+// SetBeaconOutOfScope updates only the scope flag, so it doesn't race with check-ins.
+func (s *GormStore) SetBeaconOutOfScope(beaconID string, outOfScope bool) error {
+	defer s.evictBeacon(beaconID)
+	return s.DB.Model(&Beacon{}).Where("beacon_id = ?", beaconID).Update("out_of_scope", outOfScope).Error
+}
+
+// SetBeaconArchived archives (non-nil archivedAt) or restores a beacon.
+func (s *GormStore) SetBeaconArchived(beaconID string, archivedAt *time.Time) error {
+	defer s.evictBeacon(beaconID)
+	return s.DB.Model(&Beacon{}).Where("beacon_id = ?", beaconID).Update("archived_at", archivedAt).Error
+}
+
+// SetBeaconStatus changes the status of a beacon if it is still from, and reports whether it did.
+func (s *GormStore) SetBeaconStatus(beaconID, from, to string) (bool, error) {
+	defer s.evictBeacon(beaconID)
+	result := s.DB.Model(&Beacon{}).Where("beacon_id = ? AND status = ?", beaconID, from).Update("status", to)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetLatestBeaconByFingerprint returns the last beacon staged with a host fingerprint in an engagement.
+func (s *GormStore) GetLatestBeaconByFingerprint(engagement, fingerprint string) (*Beacon, error) {
+	var beacon Beacon
+	err := s.DB.Where("engagement = ? AND host_fingerprint = ?", engagement, fingerprint).
+		Order("created_at desc").Order("id desc").First(&beacon).Error
+	if err != nil {
+		return nil, err
+	}
+	return &beacon, nil
+}
+
+func (s *GormStore) SetBeaconHighValue(beaconID string, highValue bool) error {
+	defer s.evictBeacon(beaconID)
+	return s.DB.Model(&Beacon{}).Where("beacon_id = ?", beaconID).Update("high_value", highValue).Error
+}
+
 func (s *GormStore) DeleteBeacon(beaconID string) error {
+	defer s.InvalidateBeacon(beaconID)
 	return s.DB.Where("beacon_id = ?", beaconID).Delete(&Beacon{}).Error
 }
@@ -0,0 +1,250 @@
+package data
+
+import (
+	"sync"
+	"time"
+)
+
+// cachedTaskStatuses are the task states whose lists are cached: the ones a beacon check-in reads.
+var cachedTaskStatuses = map[string]bool{"queued": true, "dispatched": true}
+
+// maxCachedBeacons bounds the cache; expired entries are dropped once it holds more beacons.
+const maxCachedBeacons = 10000
+
+// storeCache is a read-through cache of beacons by ID and of their queued and dispatched tasks,
+// so a beacon poll doesn't read the same rows from the database every time, and of issued
+// certificates by serial number, which every listener gRPC call looks up. The store's own writes
+// evict what they change; entries also expire after the TTL, which bounds how stale they get when
+// another TeamServer or a direct transaction writes to the same rows.
+type storeCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	beacons map[string]cachedBeacon
+	tasks   map[string]map[string]cachedTasks // By beacon ID, then status
+	certs   map[string]cachedCertificate      // By serial number
+	// Incremented by every eviction, so a read that raced with a write doesn't cache what it read
+	generation uint64
+}
+
+type cachedBeacon struct {
+	beacon  Beacon
+	expires time.Time
+}
+
+type cachedTasks struct {
+	tasks   []Task
+	expires time.Time
+}
+
+type cachedCertificate struct {
+	cert    *IssuedCertificate // Nil when the serial number has no record
+	expires time.Time
+}
+
+// newStoreCache returns a cache with the given TTL, or nil if ttl is 0.
+func newStoreCache(ttl time.Duration) *storeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &storeCache{
+		ttl:     ttl,
+		beacons: make(map[string]cachedBeacon),
+		tasks:   make(map[string]map[string]cachedTasks),
+		certs:   make(map[string]cachedCertificate),
+	}
+}
+
+// beacon returns a copy of a cached beacon. On a miss, it returns the generation to pass to putBeacon.
+func (c *storeCache) beacon(beaconID string) (*Beacon, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.beacons[beaconID]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, c.generation, false
+	}
+	beacon := entry.beacon
+	return &beacon, c.generation, true
+}
+
+// putBeacon caches a copy of a beacon read from the database, unless something was evicted since
+// the read started.
+func (c *storeCache) putBeacon(beacon *Beacon, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if len(c.beacons) >= maxCachedBeacons {
+		c.sweep()
+	}
+	c.beacons[beacon.BeaconID] = cachedBeacon{beacon: *beacon, expires: time.Now().Add(c.ttl)}
+}
+
+// setLastSeen updates the LastSeen of a cached beacon if it is newer.
+func (c *storeCache) setLastSeen(beaconID string, seen time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.beacons[beaconID]; ok && seen.After(entry.beacon.LastSeen) {
+		entry.beacon.LastSeen = seen
+		c.beacons[beaconID] = entry
+	}
+}
+
+// tasksOf returns a copy of the cached tasks of a beacon in a state. On a miss, it returns the
+// generation to pass to putTasks.
+func (c *storeCache) tasksOf(beaconID, status string) ([]Task, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.tasks[beaconID][status]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, c.generation, false
+	}
+	return append([]Task(nil), entry.tasks...), c.generation, true
+}
+
+// putTasks caches a copy of the tasks of a beacon in a state read from the database, unless
+// something was evicted since the read started.
+func (c *storeCache) putTasks(beaconID, status string, tasks []Task, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if c.tasks[beaconID] == nil {
+		c.tasks[beaconID] = make(map[string]cachedTasks)
+	}
+	c.tasks[beaconID][status] = cachedTasks{tasks: append([]Task(nil), tasks...), expires: time.Now().Add(c.ttl)}
+}
+
+// certificate returns a copy of a cached certificate record, nil if the serial number is cached as
+// having none. On a miss, it returns the generation to pass to putCertificate.
+func (c *storeCache) certificate(serialNumber string) (*IssuedCertificate, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.certs[serialNumber]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, c.generation, false
+	}
+	if entry.cert == nil {
+		return nil, c.generation, true
+	}
+	cert := *entry.cert
+	return &cert, c.generation, true
+}
+
+// putCertificate caches a copy of a certificate record read from the database, or that the serial
+// number has none if cert is nil, unless something was evicted since the read started.
+func (c *storeCache) putCertificate(serialNumber string, cert *IssuedCertificate, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if len(c.certs) >= maxCachedBeacons {
+		c.sweep()
+	}
+	entry := cachedCertificate{expires: time.Now().Add(c.ttl)}
+	if cert != nil {
+		copied := *cert
+		entry.cert = &copied
+	}
+	c.certs[serialNumber] = entry
+}
+
+// evictCertificates drops the cached certificate records. Revocations update many rows at once, so
+// every record is dropped rather than the ones changed.
+func (c *storeCache) evictCertificates() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.certs = make(map[string]cachedCertificate)
+}
+
+// evictBeacon drops a cached beacon.
+func (c *storeCache) evictBeacon(beaconID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	delete(c.beacons, beaconID)
+}
+
+// evictTasks drops the cached tasks of a beacon.
+func (c *storeCache) evictTasks(beaconID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	delete(c.tasks, beaconID)
+}
+
+// clear drops everything, after writes that change rows of many beacons.
+func (c *storeCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.beacons = make(map[string]cachedBeacon)
+	c.tasks = make(map[string]map[string]cachedTasks)
+	c.certs = make(map[string]cachedCertificate)
+}
+
+// sweep drops expired entries. The caller holds the lock.
+func (c *storeCache) sweep() {
+	now := time.Now()
+	for id, entry := range c.beacons {
+		if now.After(entry.expires) {
+			delete(c.beacons, id)
+		}
+	}
+	for id, byStatus := range c.tasks {
+		for status, entry := range byStatus {
+			if now.After(entry.expires) {
+				delete(byStatus, status)
+			}
+		}
+		if len(byStatus) == 0 {
+			delete(c.tasks, id)
+		}
+	}
+	for serialNumber, entry := range c.certs {
+		if now.After(entry.expires) {
+			delete(c.certs, serialNumber)
+		}
+	}
+}
+
+// InvalidateBeacon drops the cached beacon and tasks of a beacon. Callers that write beacon or task
+// rows in their own transaction, rather than through the store, call it after committing.
+func (s *GormStore) InvalidateBeacon(beaconID string) {
+	if s.cache == nil {
+		return
+	}
+	s.cache.evictBeacon(beaconID)
+	s.cache.evictTasks(beaconID)
+}
+
+// evictBeacon drops a cached beacon after it was written.
+func (s *GormStore) evictBeacon(beaconID string) {
+	if s.cache != nil {
+		s.cache.evictBeacon(beaconID)
+	}
+}
+
+// evictTasks drops the cached tasks of a beacon after one of them was written.
+func (s *GormStore) evictTasks(beaconID string) {
+	if s.cache != nil {
+		s.cache.evictTasks(beaconID)
+	}
+}
+
+// evictCertificates drops the cached certificate records after one of them was written.
+func (s *GormStore) evictCertificates() {
+	if s.cache != nil {
+		s.cache.evictCertificates()
+	}
+}
+
+// clearCache drops everything cached.
+func (s *GormStore) clearCache() {
+	if s.cache != nil {
+		s.cache.clear()
+	}
+}
@@ -0,0 +1,63 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- Canary Methods ---
+
+func (s *GormStore) CreateCanary(canary *Canary) error {
+	return s.DB.Create(canary).Error
+}
+
+func (s *GormStore) GetCanary(canaryID string) (*Canary, error) {
+	var canary Canary
+	if err := s.DB.Where("canary_id = ?", canaryID).First(&canary).Error; err != nil {
+		return nil, err
+	}
+	return &canary, nil
+}
+
+// GetCanaries returns the canaries of a listener, ordered by URI.
+func (s *GormStore) GetCanaries(listener string) ([]Canary, error) {
+	var canaries []Canary
+	err := s.DB.Where("listener = ?", listener).Order("uri").Find(&canaries).Error
+	return canaries, err
+}
+
+// DeleteCanary deletes a canary and its hits.
+func (s *GormStore) DeleteCanary(canaryID string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("canary_id = ?", canaryID).Delete(&CanaryHit{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("canary_id = ?", canaryID).Delete(&Canary{}).Error
+	})
+}
+
+// RecordCanaryHits stores hits of a canary and adds them to its counter.
+func (s *GormStore) RecordCanaryHits(canaryID string, hits []CanaryHit) error {
+	if len(hits) == 0 {
+		return nil
+	}
+	last := hits[len(hits)-1]
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&hits).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Canary{}).Where("canary_id = ?", canaryID).Updates(map[string]interface{}{
+			"hits":          gorm.Expr("hits + ?", len(hits)),
+			"last_hit_at":   last.Time,
+			"last_hit_from": last.RemoteAddr,
+		}).Error
+	})
+}
+
+// GetCanaryHits returns the latest hits of a canary, newest first.
+func (s *GormStore) GetCanaryHits(canaryID string, since time.Time, limit int) ([]CanaryHit, error) {
+	var hits []CanaryHit
+	err := s.DB.Where("canary_id = ? AND time >= ?", canaryID, since).Order("time desc").Limit(limit).Find(&hits).Error
+	return hits, err
+}
@@ -0,0 +1,19 @@
+package data
+
+// --- Chat Methods ---
+
+func (s *GormStore) CreateChatMessage(message *ChatMessage) error {
+	return s.DB.Create(message).Error
+}
+
+// GetChatMessages returns up to limit of the latest messages of an engagement, newest first.
+// With beforeID set, only messages older than that message are returned.
+func (s *GormStore) GetChatMessages(engagement string, beforeID uint, limit int) ([]ChatMessage, error) {
+	var messages []ChatMessage
+	db := s.DB.Where("engagement = ?", engagement)
+	if beforeID > 0 {
+		db = db.Where("id < ?", beforeID)
+	}
+	err := db.Order("id DESC").Limit(limit).Find(&messages).Error
+	return messages, err
+}
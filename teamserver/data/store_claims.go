@@ -0,0 +1,40 @@
+package data
+
+import "gorm.io/gorm"
+
+// --- Beacon Claim Methods ---
+
+func (s *GormStore) GetBeaconClaims(engagement string) ([]BeaconClaim, error) {
+	var claims []BeaconClaim
+	db := s.DB.Order("created_at")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Find(&claims).Error
+	return claims, err
+}
+
+func (s *GormStore) GetBeaconClaim(beaconID string) (*BeaconClaim, error) {
+	var claim BeaconClaim
+	err := s.DB.Where("beacon_id = ?", beaconID).First(&claim).Error
+	return &claim, err
+}
+
+// CreateBeaconClaim fails if the beacon is already claimed, as beacon IDs are unique.
+func (s *GormStore) CreateBeaconClaim(claim *BeaconClaim) error {
+	return s.DB.Create(claim).Error
+}
+
+// ReplaceBeaconClaim removes any claim on the beacon and creates the new one in a single transaction.
+func (s *GormStore) ReplaceBeaconClaim(claim *BeaconClaim) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("beacon_id = ?", claim.BeaconID).Delete(&BeaconClaim{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(claim).Error
+	})
+}
+
+func (s *GormStore) DeleteBeaconClaim(beaconID string) error {
+	return s.DB.Where("beacon_id = ?", beaconID).Delete(&BeaconClaim{}).Error
+}
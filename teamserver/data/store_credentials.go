@@ -0,0 +1,48 @@
+package data
+
+// --- Credential Methods ---
+
+func (s *GormStore) GetCredentials(engagement string, hostID *uint, page int, limit int) ([]Credential, int64, error) {
+	var credentials []Credential
+	var total int64
+	db := s.DB.Model(&Credential{})
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	if hostID != nil {
+		db = db.Where("host_id = ?", *hostID)
+	}
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	err = db.Order("created_at desc").Limit(limit).Offset(offset).Find(&credentials).Error
+	return credentials, total, err
+}
+
+func (s *GormStore) GetAllCredentials(engagement string) ([]Credential, error) {
+	var credentials []Credential
+	db := s.DB.Order("created_at")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Find(&credentials).Error
+	return credentials, err
+}
+
+func (s *GormStore) GetCredential(id uint) (*Credential, error) {
+	var credential Credential
+	err := s.DB.First(&credential, id).Error
+	return &credential, err
+}
+
+func (s *GormStore) CreateCredential(credential *Credential) error {
+	return s.DB.Create(credential).Error
+}
+
+func (s *GormStore) DeleteCredential(id uint) error {
+	return s.DB.Delete(&Credential{}, id).Error
+}
@@ -0,0 +1,73 @@
+package data
+
+// --- Engagement Methods ---
+
+// GetEngagements lists engagements. If username is set, only engagements the operator is a member of are returned.
+func (s *GormStore) GetEngagements(username string, page int, limit int) ([]Engagement, int64, error) {
+	var engagements []Engagement
+	var total int64
+	db := s.DB.Model(&Engagement{})
+	if username != "" {
+		db = db.Where("name IN (?)", s.DB.Model(&EngagementMember{}).Select("engagement").Where("username = ?", username))
+	}
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	err = db.Order("name").Limit(limit).Offset(offset).Find(&engagements).Error
+	return engagements, total, err
+}
+
+func (s *GormStore) GetEngagement(name string) (*Engagement, error) {
+	var engagement Engagement
+	err := s.DB.Where("name = ?", name).First(&engagement).Error
+	return &engagement, err
+}
+
+func (s *GormStore) CountEngagements() (int64, error) {
+	var count int64
+	err := s.DB.Model(&Engagement{}).Count(&count).Error
+	return count, err
+}
+
+func (s *GormStore) CreateEngagement(engagement *Engagement) error {
+	return s.DB.Create(engagement).Error
+}
+
+func (s *GormStore) UpdateEngagement(engagement *Engagement) error {
+	return s.DB.Save(engagement).Error
+}
+
+func (s *GormStore) GetEngagementMembers(name string) ([]EngagementMember, error) {
+	var members []EngagementMember
+	err := s.DB.Where("engagement = ?", name).Order("username").Find(&members).Error
+	return members, err
+}
+
+func (s *GormStore) IsEngagementMember(name string, username string) (bool, error) {
+	var count int64
+	err := s.DB.Model(&EngagementMember{}).Where("engagement = ? AND username = ?", name, username).Count(&count).Error
+	return count > 0, err
+}
+
+func (s *GormStore) AddEngagementMember(member *EngagementMember) error {
+	return s.DB.Create(member).Error
+}
+
+func (s *GormStore) RemoveEngagementMember(name string, username string) error {
+	return s.DB.Where("engagement = ? AND username = ?", name, username).Delete(&EngagementMember{}).Error
+}
+
+// AssignUnscopedRecords moves every record created before engagements existed into the given engagement.
+func (s *GormStore) AssignUnscopedRecords(name string) error {
+	defer s.clearCache()
+	for _, model := range []interface{}{&Beacon{}, &Task{}, &Listener{}, &Payload{}, &Artifact{}, &ServiceAPIKey{}} {
+		if err := s.DB.Unscoped().Model(model).Where("engagement = ? OR engagement IS NULL", "").Update("engagement", name).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package data
+
+// --- Event Methods ---
+
+func (s *GormStore) CreateEvent(event *Event) error {
+	return s.DB.Create(event).Error
+}
+
+// GetEventsAfter returns up to limit events with a sequence number above seq, oldest first.
+// With an engagement set, only global events and the events of that engagement are returned.
+func (s *GormStore) GetEventsAfter(seq uint64, engagement string, limit int) ([]Event, error) {
+	var events []Event
+	db := s.DB.Where("seq > ?", seq)
+	if engagement != "" {
+		db = db.Where("engagement = ? OR engagement = ?", "", engagement)
+	}
+	err := db.Order("seq").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// OldestEventSeq returns the sequence number of the oldest event retention kept, 0 if there are none.
+func (s *GormStore) OldestEventSeq() (uint64, error) {
+	var seq uint64
+	err := s.DB.Model(&Event{}).Select("COALESCE(MIN(seq), 0)").Scan(&seq).Error
+	return seq, err
+}
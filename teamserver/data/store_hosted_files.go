@@ -0,0 +1,41 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- Hosted File Methods ---
+
+func (s *GormStore) CreateHostedFile(file *HostedFile) error {
+	return s.DB.Create(file).Error
+}
+
+func (s *GormStore) GetHostedFile(fileID string) (*HostedFile, error) {
+	var file HostedFile
+	if err := s.DB.Where("file_id = ?", fileID).First(&file).Error; err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetHostedFiles returns the files hosted on a listener, ordered by URI.
+func (s *GormStore) GetHostedFiles(listener string) ([]HostedFile, error) {
+	var files []HostedFile
+	err := s.DB.Where("listener = ?", listener).Order("uri").Find(&files).Error
+	return files, err
+}
+
+func (s *GormStore) DeleteHostedFile(fileID string) error {
+	return s.DB.Where("file_id = ?", fileID).Delete(&HostedFile{}).Error
+}
+
+// AddHostedFileDownloads adds downloads reported by a listener to a hosted file's counter.
+func (s *GormStore) AddHostedFileDownloads(fileID string, count int64, last time.Time, from string) error {
+	return s.DB.Model(&HostedFile{}).Where("file_id = ?", fileID).Updates(map[string]interface{}{
+		"downloads":          gorm.Expr("downloads + ?", count),
+		"last_download_at":   last,
+		"last_download_from": from,
+	}).Error
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"gorm.io/gorm"
+)
+
+// --- Host Methods ---
+
+func (s *GormStore) GetHosts(engagement string, search string, page int, limit int) ([]Host, int64, error) {
+	var hosts []Host
+	var total int64
+	db := s.DB.Model(&Host{})
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	if search != "" {
+		db = db.Where("address LIKE ? OR hostname LIKE ? OR os LIKE ?", "%"+search+"%", "%"+search+"%", "%"+search+"%")
+	}
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	err = db.Order("address").Limit(limit).Offset(offset).Find(&hosts).Error
+	return hosts, total, err
+}
+
+func (s *GormStore) GetAllHosts(engagement string) ([]Host, error) {
+	var hosts []Host
+	db := s.DB.Order("address")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Find(&hosts).Error
+	return hosts, err
+}
+
+func (s *GormStore) GetHost(id uint) (*Host, error) {
+	var host Host
+	err := s.DB.First(&host, id).Error
+	return &host, err
+}
+
+func (s *GormStore) GetHostByAddress(engagement string, address string) (*Host, error) {
+	var host Host
+	err := s.DB.Where("engagement = ? AND address = ?", engagement, address).First(&host).Error
+	return &host, err
+}
+
+func (s *GormStore) CreateHost(host *Host) error {
+	return s.DB.Create(host).Error
+}
+
+func (s *GormStore) UpdateHost(host *Host) error {
+	return s.DB.Save(host).Error
+}
+
+// DeleteHost removes a host permanently, so the address can be recorded again later.
+// Credentials tied to the host are kept but no longer linked to it.
+func (s *GormStore) DeleteHost(id uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Credential{}).Where("host_id = ?", id).Update("host_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&Host{}, id).Error
+	})
+}
@@ -0,0 +1,42 @@
+package data
+
+// --- Infrastructure Asset Methods ---
+
+func (s *GormStore) GetInfraAssets(engagement string, page int, limit int) ([]InfraAsset, int64, error) {
+	var assets []InfraAsset
+	var total int64
+	db := s.DB.Model(&InfraAsset{})
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	err = db.Order("created_at desc").Limit(limit).Offset(offset).Find(&assets).Error
+	return assets, total, err
+}
+
+func (s *GormStore) GetInfraAsset(assetID string) (*InfraAsset, error) {
+	var asset InfraAsset
+	err := s.DB.Where("asset_id = ?", assetID).First(&asset).Error
+	return &asset, err
+}
+
+// GetInfraAssetsByStatus returns the assets in any of the given statuses, of all engagements.
+func (s *GormStore) GetInfraAssetsByStatus(statuses ...string) ([]InfraAsset, error) {
+	var assets []InfraAsset
+	err := s.DB.Where("status IN ?", statuses).Order("id").Find(&assets).Error
+	return assets, err
+}
+
+func (s *GormStore) CreateInfraAsset(asset *InfraAsset) error {
+	return s.DB.Create(asset).Error
+}
+
+func (s *GormStore) UpdateInfraAsset(asset *InfraAsset) error {
+	return s.DB.Save(asset).Error
+}
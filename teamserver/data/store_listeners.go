@@ -1,15 +1,21 @@
 package data
 
 import (
+	"errors"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // --- Listener Methods ---
 
-func (s *GormStore) GetListeners(page int, limit int) ([]Listener, int64, error) {
+func (s *GormStore) GetListeners(engagement string, page int, limit int) ([]Listener, int64, error) {
 	var listeners []Listener
 	var total int64
 	db := s.DB.Model(&Listener{})
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
 
 	err := db.Count(&total).Error
 	if err != nil {
@@ -31,6 +37,15 @@ func (s *GormStore) CreateListener(listener *Listener) error {
 	return s.DB.Create(listener).Error
 }
 
+func (s *GormStore) UpdateListener(listener *Listener) error {
+	return s.DB.Save(listener).Error
+}
+
+// SetListenerAPIKeyHash replaces the hash of a listener's API key, touching only that column.
+func (s *GormStore) SetListenerAPIKeyHash(name string, hash string) error {
+	return s.DB.Model(&Listener{}).Where("name = ?", name).Update("api_key_hash", hash).Error
+}
+
 func (s *GormStore) DeleteListener(name string) error {
 	return s.DB.Where("name = ?", name).Delete(&Listener{}).Error
 }
@@ -38,16 +53,81 @@ func (s *GormStore) DeleteListener(name string) error {
 // --- Certificate Methods ---
 
 func (s *GormStore) CreateIssuedCertificate(cert *IssuedCertificate) error {
+	// The serial number may be cached as having no record
+	defer s.evictCertificates()
 	return s.DB.Create(cert).Error
 }
 
 func (s *GormStore) RevokeCertificatesByListener(listenerName string) error {
+	defer s.evictCertificates()
 	now := time.Now()
 	result := s.DB.Model(&IssuedCertificate{}).Where("listener_name = ?", listenerName).
 		Updates(map[string]interface{}{"revoked": true, "revoked_at": &now})
 	return result.Error
 }
 
+// GetIssuedCertificate retrieves a certificate record by serial number. Records, and serial numbers
+// without one, are cached: the listener bridge looks the caller's certificate up on every call.
+func (s *GormStore) GetIssuedCertificate(serialNumber string) (*IssuedCertificate, error) {
+	var generation uint64
+	if s.cache != nil {
+		cached, gen, ok := s.cache.certificate(serialNumber)
+		if ok && cached == nil {
+			return nil, gorm.ErrRecordNotFound
+		} else if ok {
+			return cached, nil
+		}
+		generation = gen
+	}
+
+	var cert IssuedCertificate
+	err := s.DB.Where("serial_number = ?", serialNumber).First(&cert).Error
+	if s.cache != nil {
+		if err == nil {
+			s.cache.putCertificate(serialNumber, &cert, generation)
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.cache.putCertificate(serialNumber, nil, generation)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// RevokeCertificatesByOperator revokes all client certificates of an operator.
+func (s *GormStore) RevokeCertificatesByOperator(username string) error {
+	defer s.evictCertificates()
+	now := time.Now()
+	result := s.DB.Model(&IssuedCertificate{}).Where("operator = ?", username).
+		Updates(map[string]interface{}{"revoked": true, "revoked_at": &now})
+	return result.Error
+}
+
+// GetRevokedCertificates returns all revoked certificates, in the order they were revoked.
+func (s *GormStore) GetRevokedCertificates() ([]IssuedCertificate, error) {
+	var certs []IssuedCertificate
+	err := s.DB.Where("revoked = ?", true).Order("revoked_at, id").Find(&certs).Error
+	return certs, err
+}
+
+// GetActiveCertificates returns all certificates that are not revoked, oldest first.
+func (s *GormStore) GetActiveCertificates() ([]IssuedCertificate, error) {
+	var certs []IssuedCertificate
+	err := s.DB.Where("revoked = ?", false).Order("id").Find(&certs).Error
+	return certs, err
+}
+
+// RevokeCertificatesIssuedBefore revokes all certificates issued before a point in time and returns
+// how many were revoked.
+func (s *GormStore) RevokeCertificatesIssuedBefore(before time.Time) (int64, error) {
+	defer s.evictCertificates()
+	now := time.Now()
+	result := s.DB.Model(&IssuedCertificate{}).Where("revoked = ? AND created_at < ?", false, before).
+		Updates(map[string]interface{}{"revoked": true, "revoked_at": &now})
+	return result.RowsAffected, result.Error
+}
+
 func (s *GormStore) IsCertificateRevoked(serialNumber string) (bool, error) {
 	var cert IssuedCertificate
 	err := s.DB.Where("serial_number = ?", serialNumber).First(&cert).Error
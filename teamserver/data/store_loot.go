@@ -0,0 +1,141 @@
+package data
+
+import (
+	"time"
+)
+
+// --- Loot Methods ---
+
+func (s *GormStore) GetLootItems(query *LootQuery) ([]LootItem, int64, error) {
+	var items []LootItem
+	var total int64
+	db := s.DB.Model(&LootItem{})
+
+	if query.Engagement != "" {
+		db = db.Where("engagement = ?", query.Engagement)
+	}
+	if query.BeaconID != "" {
+		db = db.Where("beacon_id = ?", query.BeaconID)
+	}
+	if query.TaskID != "" {
+		db = db.Where("task_id = ?", query.TaskID)
+	}
+	if query.SHA256 != "" {
+		db = db.Where("sha256 = ?", query.SHA256)
+	}
+	if query.Type != "" {
+		db = db.Where("type = ?", query.Type)
+	}
+	if query.Tag != "" {
+		// Tags are stored as a JSON array
+		db = db.Where("tags LIKE ?", `%"`+query.Tag+`"%`)
+	}
+	if query.CreatedBefore != nil {
+		db = db.Where("created_at < ?", *query.CreatedBefore)
+	}
+	if query.Search != "" {
+		search := "%" + query.Search + "%"
+		db = db.Where("file_name LIKE ? OR original_path LIKE ? OR hostname LIKE ? OR notes LIKE ?", search, search, search, search)
+	}
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (query.Page - 1) * query.Limit
+	err = db.Order("created_at desc").Limit(query.Limit).Offset(offset).Find(&items).Error
+	return items, total, err
+}
+
+// GetAllLootItems returns every loot item of an engagement in the order they were collected.
+func (s *GormStore) GetAllLootItems(engagement string) ([]LootItem, error) {
+	var items []LootItem
+	db := s.DB.Order("created_at")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Find(&items).Error
+	return items, err
+}
+
+func (s *GormStore) GetLootItem(lootID string) (*LootItem, error) {
+	var item LootItem
+	err := s.DB.Where("loot_id = ?", lootID).First(&item).Error
+	return &item, err
+}
+
+func (s *GormStore) GetLootItemByPath(path string) (*LootItem, error) {
+	var item LootItem
+	err := s.DB.Where("path = ?", path).First(&item).Error
+	return &item, err
+}
+
+func (s *GormStore) GetLootItemBySHA256(sha256 string) (*LootItem, error) {
+	var item LootItem
+	err := s.DB.Where("sha256 = ?", sha256).First(&item).Error
+	return &item, err
+}
+
+// CountLootItemsByPath returns the number of loot items sharing a file, i.e. its reference count.
+func (s *GormStore) CountLootItemsByPath(path string) (int64, error) {
+	var count int64
+	err := s.DB.Model(&LootItem{}).Where("path = ?", path).Count(&count).Error
+	return count, err
+}
+
+// GetLootUsage returns the loot storage used per engagement, or by one engagement if set.
+func (s *GormStore) GetLootUsage(engagement string) ([]LootUsage, error) {
+	var usage []LootUsage
+	db := s.DB.Model(&LootItem{}).Select("engagement, COUNT(*) AS items, SUM(size) AS bytes").Group("engagement").Order("engagement")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	if err := db.Scan(&usage).Error; err != nil {
+		return nil, err
+	}
+
+	// Identical content is counted once per engagement
+	var unique []LootUsage
+	contents := s.DB.Model(&LootItem{}).Select("engagement, sha256, MAX(size) AS size").Group("engagement, sha256")
+	if engagement != "" {
+		contents = contents.Where("engagement = ?", engagement)
+	}
+	err := s.DB.Table("(?) AS contents", contents).Select("engagement, SUM(size) AS unique_bytes").Group("engagement").Scan(&unique).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range usage {
+		for _, u := range unique {
+			if u.Engagement == usage[i].Engagement {
+				usage[i].UniqueBytes = u.UniqueBytes
+			}
+		}
+	}
+	return usage, nil
+}
+
+func (s *GormStore) CreateLootItem(item *LootItem) error {
+	return s.DB.Create(item).Error
+}
+
+func (s *GormStore) UpdateLootItem(item *LootItem) error {
+	return s.DB.Save(item).Error
+}
+
+func (s *GormStore) DeleteLootItem(lootID string) error {
+	return s.DB.Unscoped().Where("loot_id = ?", lootID).Delete(&LootItem{}).Error
+}
+
+// GetUnmirroredLootItems returns loot items not yet copied to the loot mirror with an ID above
+// afterID, in ID order.
+func (s *GormStore) GetUnmirroredLootItems(afterID uint, limit int) ([]LootItem, error) {
+	var items []LootItem
+	err := s.DB.Where("mirrored_at IS NULL AND id > ?", afterID).Order("id").Limit(limit).Find(&items).Error
+	return items, err
+}
+
+// SetLootMirrored records that a file was copied to the loot mirror, for every loot item sharing it.
+func (s *GormStore) SetLootMirrored(path string, mirroredAt time.Time) error {
+	return s.DB.Model(&LootItem{}).Where("path = ?", path).Update("mirrored_at", mirroredAt).Error
+}
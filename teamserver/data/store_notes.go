@@ -0,0 +1,29 @@
+package data
+
+// --- Note Methods ---
+
+// GetNotes returns the notes on a beacon, oldest first. An empty taskID returns the notes on the
+// beacon itself, otherwise the notes on that task.
+func (s *GormStore) GetNotes(beaconID string, taskID string) ([]Note, error) {
+	var notes []Note
+	err := s.DB.Where("beacon_id = ? AND task_id = ?", beaconID, taskID).Order("id").Find(&notes).Error
+	return notes, err
+}
+
+func (s *GormStore) GetNote(id uint) (*Note, error) {
+	var note Note
+	err := s.DB.First(&note, id).Error
+	return &note, err
+}
+
+func (s *GormStore) CreateNote(note *Note) error {
+	return s.DB.Create(note).Error
+}
+
+func (s *GormStore) UpdateNote(note *Note) error {
+	return s.DB.Model(note).Select("Body", "UpdatedAt").Updates(note).Error
+}
+
+func (s *GormStore) DeleteNote(id uint) error {
+	return s.DB.Delete(&Note{}, id).Error
+}
@@ -0,0 +1,45 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- Notification Rule Methods ---
+
+func (s *GormStore) GetNotificationRules(engagement string) ([]NotificationRule, error) {
+	var rules []NotificationRule
+	db := s.DB.Order("id")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Find(&rules).Error
+	return rules, err
+}
+
+func (s *GormStore) GetNotificationRule(id uint) (*NotificationRule, error) {
+	var rule NotificationRule
+	err := s.DB.First(&rule, id).Error
+	return &rule, err
+}
+
+func (s *GormStore) CreateNotificationRule(rule *NotificationRule) error {
+	return s.DB.Create(rule).Error
+}
+
+func (s *GormStore) UpdateNotificationRule(rule *NotificationRule) error {
+	return s.DB.Save(rule).Error
+}
+
+func (s *GormStore) DeleteNotificationRule(id uint) error {
+	return s.DB.Delete(&NotificationRule{}, id).Error
+}
+
+// RecordNotificationRuleFired counts a rule firing without overwriting concurrent edits of the rule.
+func (s *GormStore) RecordNotificationRuleFired(id uint, firedAt time.Time) error {
+	return s.DB.Model(&NotificationRule{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"fire_count":    gorm.Expr("fire_count + 1"),
+		"last_fired_at": firedAt,
+	}).Error
+}
@@ -0,0 +1,78 @@
+package data
+
+// --- Operator Methods ---
+
+func (s *GormStore) GetOperators(page int, limit int) ([]Operator, int64, error) {
+	var operators []Operator
+	var total int64
+	db := s.DB.Model(&Operator{})
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	err = db.Order("username").Limit(limit).Offset(offset).Find(&operators).Error
+	return operators, total, err
+}
+
+func (s *GormStore) GetOperator(username string) (*Operator, error) {
+	var operator Operator
+	err := s.DB.Where("username = ?", username).First(&operator).Error
+	return &operator, err
+}
+
+// CountOperators counts enabled operators, optionally restricted to a role.
+func (s *GormStore) CountOperators(role string) (int64, error) {
+	var count int64
+	db := s.DB.Model(&Operator{}).Where("disabled = ?", false)
+	if role != "" {
+		db = db.Where("role = ?", role)
+	}
+	err := db.Count(&count).Error
+	return count, err
+}
+
+func (s *GormStore) CreateOperator(operator *Operator) error {
+	return s.DB.Create(operator).Error
+}
+
+func (s *GormStore) UpdateOperator(operator *Operator) error {
+	return s.DB.Save(operator).Error
+}
+
+func (s *GormStore) DeleteOperator(username string) error {
+	// Hard delete so the username can be reused
+	if err := s.DB.Unscoped().Where("username = ?", username).Delete(&Operator{}).Error; err != nil {
+		return err
+	}
+	if err := s.DB.Where("username = ?", username).Delete(&PasswordHistory{}).Error; err != nil {
+		return err
+	}
+	return s.DB.Where("username = ?", username).Delete(&EngagementMember{}).Error
+}
+
+// GetPasswordHistory retrieves the most recent previous password hashes of an operator.
+func (s *GormStore) GetPasswordHistory(username string, limit int) ([]PasswordHistory, error) {
+	var history []PasswordHistory
+	if err := s.DB.Where("username = ?", username).Order("id desc").Limit(limit).Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// AddPasswordHistory records a previous password hash and keeps only the newest entries.
+func (s *GormStore) AddPasswordHistory(entry *PasswordHistory, keep int) error {
+	if err := s.DB.Create(entry).Error; err != nil {
+		return err
+	}
+	var ids []uint
+	if err := s.DB.Model(&PasswordHistory{}).Where("username = ?", entry.Username).Order("id desc").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) <= keep {
+		return nil
+	}
+	return s.DB.Delete(&PasswordHistory{}, ids[keep:]).Error
+}
@@ -0,0 +1,157 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- Payload Methods ---
+
+func (s *GormStore) GetPayloads(engagement string, page int, limit int) ([]Payload, int64, error) {
+	var payloads []Payload
+	var total int64
+	db := s.DB.Model(&Payload{})
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	err = db.Order("created_at desc").Limit(limit).Offset(offset).Find(&payloads).Error
+	return payloads, total, err
+}
+
+func (s *GormStore) GetPayload(payloadID string) (*Payload, error) {
+	var payload Payload
+	err := s.DB.Where("payload_id = ?", payloadID).First(&payload).Error
+	return &payload, err
+}
+
+func (s *GormStore) CreatePayload(payload *Payload) error {
+	return s.DB.Create(payload).Error
+}
+
+func (s *GormStore) UpdatePayload(payload *Payload) error {
+	return s.DB.Save(payload).Error
+}
+
+// GetPayloadByCanaryDomain retrieves the payload built with a DNS canary subdomain.
+func (s *GormStore) GetPayloadByCanaryDomain(domain string) (*Payload, error) {
+	var payload Payload
+	err := s.DB.Where("canary_domain = ?", domain).First(&payload).Error
+	return &payload, err
+}
+
+// GetPayloadByBuildToken retrieves the payload built with a build token.
+func (s *GormStore) GetPayloadByBuildToken(token string) (*Payload, error) {
+	var payload Payload
+	err := s.DB.Where("build_token = ?", token).First(&payload).Error
+	return &payload, err
+}
+
+// ClaimPayloadStage counts a staging of a payload and reports whether it was allowed: burned payloads
+// can't stage, and stage-once payloads only once. The check and the count are a single update, so
+// concurrent stagings of a stage-once payload can't both succeed.
+func (s *GormStore) ClaimPayloadStage(payloadID string, at time.Time) (bool, error) {
+	result := s.DB.Model(&Payload{}).
+		Where("payload_id = ? AND burned_at IS NULL AND (stage_once = ? OR stages = 0)", payloadID, false).
+		Updates(map[string]interface{}{
+			"stages":         gorm.Expr("stages + 1"),
+			"last_staged_at": at,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// RejectPayloadStage counts a refused staging of a payload, and burns the payload with reason if it
+// isn't burned yet.
+func (s *GormStore) RejectPayloadStage(payloadID string, reason string, at time.Time) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Payload{}).Where("payload_id = ?", payloadID).
+			Update("rejected_stages", gorm.Expr("rejected_stages + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Payload{}).Where("payload_id = ? AND burned_at IS NULL", payloadID).
+			Updates(map[string]interface{}{"burned_at": at, "burn_reason": reason}).Error
+	})
+}
+
+// BurnPayload marks a payload as burned, so it can't stage anymore. A burned payload keeps its
+// original reason.
+func (s *GormStore) BurnPayload(payloadID string, reason string, at time.Time) error {
+	return s.DB.Model(&Payload{}).Where("payload_id = ? AND burned_at IS NULL", payloadID).
+		Updates(map[string]interface{}{"burned_at": at, "burn_reason": reason}).Error
+}
+
+// GetBurnedPayloads returns the burned payloads of an engagement (all if empty), most recently burned first.
+func (s *GormStore) GetBurnedPayloads(engagement string) ([]Payload, error) {
+	var payloads []Payload
+	db := s.DB.Where("burned_at IS NOT NULL")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Order("burned_at desc").Find(&payloads).Error
+	return payloads, err
+}
+
+// RecordPayloadDetonation stores a detonation of a payload and adds it to the payload's counter.
+func (s *GormStore) RecordPayloadDetonation(detonation *PayloadDetonation) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(detonation).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Payload{}).Where("payload_id = ?", detonation.PayloadID).Updates(map[string]interface{}{
+			"detonations":        gorm.Expr("detonations + 1"),
+			"last_detonation_at": detonation.CreatedAt,
+		}).Error
+	})
+}
+
+// GetPayloadDetonations returns the latest detonations of a payload since a point in time, newest first.
+func (s *GormStore) GetPayloadDetonations(payloadID string, since time.Time, limit int) ([]PayloadDetonation, error) {
+	var detonations []PayloadDetonation
+	err := s.DB.Where("payload_id = ? AND created_at >= ?", payloadID, since).
+		Order("created_at desc, id desc").Limit(limit).Find(&detonations).Error
+	return detonations, err
+}
+
+// --- Build Profile Methods ---
+
+func (s *GormStore) GetBuildProfiles(page int, limit int) ([]BuildProfile, int64, error) {
+	var profiles []BuildProfile
+	var total int64
+	db := s.DB.Model(&BuildProfile{})
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	err = db.Order("name").Limit(limit).Offset(offset).Find(&profiles).Error
+	return profiles, total, err
+}
+
+func (s *GormStore) GetBuildProfile(name string) (*BuildProfile, error) {
+	var profile BuildProfile
+	err := s.DB.Where("name = ?", name).First(&profile).Error
+	return &profile, err
+}
+
+func (s *GormStore) CreateBuildProfile(profile *BuildProfile) error {
+	return s.DB.Create(profile).Error
+}
+
+func (s *GormStore) UpdateBuildProfile(profile *BuildProfile) error {
+	return s.DB.Save(profile).Error
+}
+
+// DeleteBuildProfile hard-deletes the profile so its name can be reused.
+// Payloads keep a full copy of the options they were built with.
+func (s *GormStore) DeleteBuildProfile(name string) error {
+	return s.DB.Unscoped().Where("name = ?", name).Delete(&BuildProfile{}).Error
+}
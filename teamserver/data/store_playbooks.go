@@ -0,0 +1,82 @@
+package data
+
+// --- Playbook Methods ---
+
+func (s *GormStore) GetPlaybooks(page int, limit int) ([]Playbook, int64, error) {
+	var playbooks []Playbook
+	var total int64
+	db := s.DB.Model(&Playbook{})
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	err = db.Order("name").Limit(limit).Offset(offset).Find(&playbooks).Error
+	return playbooks, total, err
+}
+
+func (s *GormStore) GetPlaybook(name string) (*Playbook, error) {
+	var playbook Playbook
+	err := s.DB.Where("name = ?", name).First(&playbook).Error
+	return &playbook, err
+}
+
+func (s *GormStore) CreatePlaybook(playbook *Playbook) error {
+	return s.DB.Create(playbook).Error
+}
+
+func (s *GormStore) UpdatePlaybook(playbook *Playbook) error {
+	return s.DB.Save(playbook).Error
+}
+
+// DeletePlaybook hard-deletes the playbook so its name can be reused.
+// Runs keep a copy of the steps they were started with.
+func (s *GormStore) DeletePlaybook(name string) error {
+	return s.DB.Unscoped().Where("name = ?", name).Delete(&Playbook{}).Error
+}
+
+// --- Playbook Run Methods ---
+
+func (s *GormStore) GetPlaybookRuns(engagement string, beaconID string, page int, limit int) ([]PlaybookRun, int64, error) {
+	var runs []PlaybookRun
+	var total int64
+	db := s.DB.Model(&PlaybookRun{})
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	if beaconID != "" {
+		db = db.Where("beacon_id = ?", beaconID)
+	}
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	err = db.Order("created_at desc").Limit(limit).Offset(offset).Find(&runs).Error
+	return runs, total, err
+}
+
+func (s *GormStore) GetPlaybookRun(runID string) (*PlaybookRun, error) {
+	var run PlaybookRun
+	err := s.DB.Where("run_id = ?", runID).First(&run).Error
+	return &run, err
+}
+
+// GetPlaybookRunByTask retrieves the run whose current step is the given task.
+func (s *GormStore) GetPlaybookRunByTask(taskID string) (*PlaybookRun, error) {
+	var run PlaybookRun
+	err := s.DB.Where("current_task_id = ?", taskID).First(&run).Error
+	return &run, err
+}
+
+func (s *GormStore) CreatePlaybookRun(run *PlaybookRun) error {
+	return s.DB.Create(run).Error
+}
+
+func (s *GormStore) UpdatePlaybookRun(run *PlaybookRun) error {
+	return s.DB.Save(run).Error
+}
@@ -0,0 +1,36 @@
+package data
+
+import "time"
+
+// --- Listener Probe Methods ---
+
+// GetProbedListeners returns the listeners with an external health probe.
+func (s *GormStore) GetProbedListeners() ([]Listener, error) {
+	var listeners []Listener
+	err := s.DB.Where("probe_url <> ''").Order("name").Find(&listeners).Error
+	return listeners, err
+}
+
+// SetListenerProbe replaces the probe settings of a listener, touching only those columns.
+func (s *GormStore) SetListenerProbe(name string, url string, expectStatus int) error {
+	return s.DB.Model(&Listener{}).Where("name = ?", name).
+		Updates(map[string]interface{}{"probe_url": url, "probe_expect_status": expectStatus}).Error
+}
+
+func (s *GormStore) CreateListenerProbeResult(result *ListenerProbeResult) error {
+	return s.DB.Create(result).Error
+}
+
+// GetListenerProbeResults returns the probe results of a listener since a point in time, newest first.
+func (s *GormStore) GetListenerProbeResults(listener string, since time.Time, limit int) ([]ListenerProbeResult, error) {
+	var results []ListenerProbeResult
+	err := s.DB.Where("listener = ? AND created_at >= ?", listener, since).
+		Order("created_at desc, id desc").Limit(limit).Find(&results).Error
+	return results, err
+}
+
+// DeleteListenerProbeResultsBefore deletes the probe results older than cutoff and returns how many were deleted.
+func (s *GormStore) DeleteListenerProbeResultsBefore(cutoff time.Time) (int64, error) {
+	result := s.DB.Where("created_at < ?", cutoff).Delete(&ListenerProbeResult{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,77 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// finishedTaskStatuses are the statuses of tasks that won't produce more output.
+var finishedTaskStatuses = []string{"completed", "failed", "timed_out", "canceled"}
+
+// PruneTaskOutputs clears the output of finished tasks last updated before cutoff and returns how many
+// tasks it applies to. With dryRun set, nothing is changed.
+func (s *GormStore) PruneTaskOutputs(cutoff time.Time, dryRun bool) (int64, error) {
+	db := s.DB.Model(&Task{}).Where("status IN ? AND updated_at < ? AND output <> ''", finishedTaskStatuses, cutoff)
+	if dryRun {
+		var count int64
+		err := db.Count(&count).Error
+		return count, err
+	}
+	// UpdateColumns keeps updated_at, which the cutoff is measured from
+	result := db.UpdateColumns(map[string]interface{}{"output": "", "output_pruned_at": time.Now()})
+	return result.RowsAffected, result.Error
+}
+
+// PruneEvents deletes events created before cutoff: the BEACON_CHECKIN events if checkIns is set,
+// otherwise all other events. With dryRun set, they are only counted.
+func (s *GormStore) PruneEvents(cutoff time.Time, checkIns bool, dryRun bool) (int64, error) {
+	db := s.DB.Model(&Event{}).Where("created_at < ?", cutoff)
+	if checkIns {
+		db = db.Where("type = ?", "BEACON_CHECKIN")
+	} else {
+		db = db.Where("type <> ?", "BEACON_CHECKIN")
+	}
+	if dryRun {
+		var count int64
+		err := db.Count(&count).Error
+		return count, err
+	}
+	result := db.Delete(&Event{})
+	return result.RowsAffected, result.Error
+}
+
+// PurgeDeletedBeacons permanently deletes beacons soft-deleted before cutoff, together with their
+// tasks and claims, and returns the number of beacons and tasks. With dryRun set, they are only counted.
+// Loot, credentials and artifacts of the beacons are kept as engagement evidence.
+func (s *GormStore) PurgeDeletedBeacons(cutoff time.Time, dryRun bool) (int64, int64, error) {
+	var beacons, tasks int64
+	if !dryRun {
+		defer s.clearCache()
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		deleted := tx.Unscoped().Model(&Beacon{}).Select("beacon_id").Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff)
+		if dryRun {
+			if err := tx.Unscoped().Model(&Beacon{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Count(&beacons).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Model(&Task{}).Where("beacon_id IN (?)", deleted).Count(&tasks).Error
+		}
+
+		result := tx.Unscoped().Where("beacon_id IN (?)", deleted).Delete(&Task{})
+		if result.Error != nil {
+			return result.Error
+		}
+		tasks = result.RowsAffected
+		if err := tx.Where("beacon_id IN (?)", deleted).Delete(&BeaconClaim{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("beacon_id IN (?)", deleted).Delete(&Note{}).Error; err != nil {
+			return err
+		}
+		result = tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Delete(&Beacon{})
+		beacons = result.RowsAffected
+		return result.Error
+	})
+	return beacons, tasks, err
+}
@@ -18,6 +18,15 @@ func (s *GormStore) GetSession(tokenHash string) (*Session, error) {
 	return &session, nil
 }
 
+// GetSessionByID retrieves a session by its ID, including inactive ones.
+func (s *GormStore) GetSessionByID(id uint) (*Session, error) {
+	var session Session
+	if err := s.DB.First(&session, id).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
 // UpdateSession updates a session in the database.
 func (s *GormStore) UpdateSession(session *Session) error {
 	return s.DB.Save(session).Error
@@ -28,6 +37,34 @@ func (s *GormStore) DeleteSession(tokenHash string) error {
 	return s.DB.Model(&Session{}).Where("token_hash = ?", tokenHash).Update("is_active", false).Error
 }
 
+// DeleteSessionsByUser marks all sessions of a user as inactive.
+func (s *GormStore) DeleteSessionsByUser(userID string) error {
+	return s.DB.Model(&Session{}).Where("user_id = ?", userID).Update("is_active", false).Error
+}
+
+// GetSessionByRefreshToken retrieves a session by refresh token hash, including inactive ones
+// so that reuse of a rotated refresh token can be detected.
+func (s *GormStore) GetSessionByRefreshToken(refreshTokenHash string) (*Session, error) {
+	var session Session
+	if err := s.DB.Where("refresh_token_hash = ?", refreshTokenHash).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RetireSessionByRefreshToken marks the session of a refresh token inactive if it still is, and reports
+// whether it did. Of concurrent refreshes with the same token only one retires the session.
+func (s *GormStore) RetireSessionByRefreshToken(refreshTokenHash string) (bool, error) {
+	result := s.DB.Model(&Session{}).Where("refresh_token_hash = ? AND is_active = ?", refreshTokenHash, true).Update("is_active", false)
+	return result.RowsAffected == 1, result.Error
+}
+
+// DeleteSessionsByFamily marks all sessions of a refresh token family as inactive and revoked.
+func (s *GormStore) DeleteSessionsByFamily(familyID string) error {
+	return s.DB.Model(&Session{}).Where("family_id = ?", familyID).
+		Updates(map[string]interface{}{"is_active": false, "revoked_at": time.Now()}).Error
+}
+
 // GetActiveSessions retrieves all active sessions.
 func (s *GormStore) GetActiveSessions() ([]Session, error) {
 	var sessions []Session
@@ -38,8 +75,9 @@ func (s *GormStore) GetActiveSessions() ([]Session, error) {
 }
 
 // DeleteExpiredSessions removes all expired sessions from the database.
+// Inactive sessions are kept until they expire so that refresh token reuse can still be detected.
 func (s *GormStore) DeleteExpiredSessions() (int64, error) {
-	result := s.DB.Where("expires_at < ? OR is_active = ?", time.Now(), false).Delete(&Session{})
+	result := s.DB.Where("expires_at < ?", time.Now()).Delete(&Session{})
 	return result.RowsAffected, result.Error
 }
 
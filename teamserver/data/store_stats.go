@@ -0,0 +1,105 @@
+package data
+
+import "time"
+
+// unixTime returns the SQL expression converting a timestamp column to Unix seconds.
+func (s *GormStore) unixTime(column string) string {
+	switch s.DB.Dialector.Name() {
+	case "postgres":
+		return "CAST(EXTRACT(EPOCH FROM " + column + ") AS BIGINT)"
+	case "mysql":
+		return "CAST(UNIX_TIMESTAMP(" + column + ") AS SIGNED)"
+	}
+	return "CAST(strftime('%s', " + column + ") AS INTEGER)"
+}
+
+// unixMinute returns the SQL expression truncating a timestamp column to the minute, in Unix seconds.
+func (s *GormStore) unixMinute(column string) string {
+	if s.DB.Dialector.Name() == "mysql" {
+		// "/" is decimal division in MySQL
+		return "(" + s.unixTime(column) + " DIV 60 * 60)"
+	}
+	return "(" + s.unixTime(column) + " / 60 * 60)"
+}
+
+// CountBeaconStates counts the beacons per state: "archived" or their persisted status, e.g.
+// "hibernating", "active" or "inactive".
+func (s *GormStore) CountBeaconStates(engagement string) ([]GroupCount, error) {
+	var counts []GroupCount
+	db := s.DB.Model(&Beacon{}).Select("CASE WHEN archived_at IS NOT NULL THEN 'archived' ELSE status END AS name, COUNT(*) AS count")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Group("name").Scan(&counts).Error
+	return counts, err
+}
+
+// CountTasksByStatus counts the tasks per status.
+func (s *GormStore) CountTasksByStatus(engagement string) ([]GroupCount, error) {
+	var counts []GroupCount
+	db := s.DB.Model(&Task{}).Select("status AS name, COUNT(*) AS count")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Group("status").Order("status").Scan(&counts).Error
+	return counts, err
+}
+
+// CountCheckIns counts the beacon check-ins per minute since a point in time, from the event log.
+// Minutes without check-ins are left out.
+func (s *GormStore) CountCheckIns(engagement string, since time.Time) ([]CheckInCount, error) {
+	var counts []CheckInCount
+	db := s.DB.Model(&Event{}).Select(s.unixMinute("created_at")+" AS minute, COUNT(*) AS count").
+		Where("type = ? AND created_at >= ?", "BEACON_CHECKIN", since)
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Group("minute").Order("minute").Scan(&counts).Error
+	return counts, err
+}
+
+// GetLootTypeUsage returns the number and size of loot items per type.
+func (s *GormStore) GetLootTypeUsage(engagement string) ([]LootTypeUsage, error) {
+	var usage []LootTypeUsage
+	db := s.DB.Model(&LootItem{}).Select("type, COUNT(*) AS items, COALESCE(SUM(size), 0) AS bytes")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Group("type").Order("type").Scan(&usage).Error
+	return usage, err
+}
+
+// GetListenerBeacons returns the number of beacons per listener and their latest check-in.
+// Archived beacons are not counted.
+func (s *GormStore) GetListenerBeacons(engagement string) ([]ListenerBeacons, error) {
+	var beacons []ListenerBeacons
+	db := s.DB.Model(&Beacon{}).Select("listener, COUNT(*) AS beacons, MAX(" + s.unixTime("last_seen") + ") AS last_seen").
+		Where("archived_at IS NULL")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Group("listener").Order("listener").Scan(&beacons).Error
+	return beacons, err
+}
+
+// GetOperatorTaskActivity returns the number of tasks each operator created since a point in time.
+func (s *GormStore) GetOperatorTaskActivity(engagement string, since time.Time) ([]OperatorActivity, error) {
+	var activity []OperatorActivity
+	db := s.DB.Model(&Task{}).Select("operator AS username, COUNT(*) AS count, MAX("+s.unixTime("created_at")+") AS last_active").
+		Where("operator <> '' AND created_at >= ?", since)
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Group("operator").Order("operator").Scan(&activity).Error
+	return activity, err
+}
+
+// GetOperatorRequestActivity returns the number of authenticated, audited API requests of each operator
+// since a point in time.
+func (s *GormStore) GetOperatorRequestActivity(since time.Time) ([]OperatorActivity, error) {
+	var activity []OperatorActivity
+	err := s.DB.Model(&AuditLog{}).Select("username, COUNT(*) AS count, MAX("+s.unixTime("created_at")+") AS last_active").
+		Where("username <> '' AND auth_method <> '' AND created_at >= ?", since).
+		Group("username").Order("username").Scan(&activity).Error
+	return activity, err
+}
@@ -9,19 +9,76 @@ func (s *GormStore) GetTask(taskID string) (*Task, error) {
 }
 
 func (s *GormStore) GetTasksByBeaconID(beaconID string, status string) ([]Task, error) {
+	var generation uint64
+	cached := s.cache != nil && cachedTaskStatuses[status]
+	if cached {
+		tasks, gen, ok := s.cache.tasksOf(beaconID, status)
+		if ok {
+			return tasks, nil
+		}
+		generation = gen
+	}
+
 	var tasks []Task
 	db := s.DB.Where("beacon_id = ?", beaconID)
 	if status != "" {
 		db = db.Where("status = ?", status)
 	}
 	err := db.Find(&tasks).Error
+	if err == nil && cached {
+		s.cache.putTasks(beaconID, status, tasks, generation)
+	}
+	return tasks, err
+}
+
+// GetTaskPage returns a page of the tasks of a beacon, oldest first.
+func (s *GormStore) GetTaskPage(query *TaskQuery) ([]Task, error) {
+	var tasks []Task
+	db := s.DB.Where("beacon_id = ?", query.BeaconID)
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+	err := keysetPage(db, query.Cursor, false).Limit(query.Limit).Find(&tasks).Error
+	return tasks, err
+}
+
+// GetTasksByStatus returns the tasks of all beacons in any of the given states.
+func (s *GormStore) GetTasksByStatus(statuses ...string) ([]Task, error) {
+	var tasks []Task
+	err := s.DB.Where("status IN ?", statuses).Find(&tasks).Error
+	return tasks, err
+}
+
+// GetAllTasks returns every task of an engagement in the order they were created.
+func (s *GormStore) GetAllTasks(engagement string) ([]Task, error) {
+	var tasks []Task
+	db := s.DB.Order("created_at")
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Find(&tasks).Error
 	return tasks, err
 }
 
 func (s *GormStore) CreateTask(task *Task) error {
+	defer s.evictTasks(task.BeaconID)
 	return s.DB.Create(task).Error
 }
 
 func (s *GormStore) UpdateTask(task *Task) error {
+	defer s.evictTasks(task.BeaconID)
 	return s.DB.Save(task).Error
 }
+
+// GetTasksWithTechniques returns the dispatched tasks of an engagement that are mapped to ATT&CK techniques,
+// or of all engagements if empty.
+func (s *GormStore) GetTasksWithTechniques(engagement string) ([]Task, error) {
+	var tasks []Task
+	db := s.DB.Select("task_id", "beacon_id", "command", "status", "operator", "engagement", "dispatched_at", "techniques").
+		Where("dispatched_at IS NOT NULL AND techniques IS NOT NULL AND techniques NOT IN ?", []string{"", "null", "[]"})
+	if engagement != "" {
+		db = db.Where("engagement = ?", engagement)
+	}
+	err := db.Order("dispatched_at").Find(&tasks).Error
+	return tasks, err
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrBeaconExists is returned when importing a beacon whose ID is already in the database,
+// including a deleted one.
+var ErrBeaconExists = errors.New("beacon already exists")
+
+// BeaconRecords is a beacon with everything recorded about it, as moved between TeamServers.
+type BeaconRecords struct {
+	Beacon     Beacon     `json:"beacon"`
+	SessionKey []byte     `json:"session_key"` // Not part of Beacon's JSON
+	Tasks      []Task     `json:"tasks"`
+	Notes      []Note     `json:"notes"` // On the beacon and on its tasks
+	Loot       []LootItem `json:"loot"`
+	// Loot ID -> path relative to the loot directory, not part of LootItem's JSON.
+	// Only the records are moved, the files must be copied separately
+	LootPaths map[string]string `json:"loot_paths"`
+}
+
+// GetBeaconRecords returns a beacon (not deleted) with its tasks, notes and loot items, oldest first.
+func (s *GormStore) GetBeaconRecords(beaconID string) (*BeaconRecords, error) {
+	records := &BeaconRecords{LootPaths: make(map[string]string)}
+	if err := s.DB.Where("beacon_id = ?", beaconID).First(&records.Beacon).Error; err != nil {
+		return nil, err
+	}
+	records.SessionKey = records.Beacon.SessionKey
+	if err := s.DB.Where("beacon_id = ?", beaconID).Order("id").Find(&records.Tasks).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Where("beacon_id = ?", beaconID).Order("id").Find(&records.Notes).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Where("beacon_id = ?", beaconID).Order("id").Find(&records.Loot).Error; err != nil {
+		return nil, err
+	}
+	for _, item := range records.Loot {
+		records.LootPaths[item.LootID] = item.Path
+	}
+	return records, nil
+}
+
+// ImportBeaconRecords creates a beacon with its tasks, notes and loot items in one transaction.
+// Their database IDs are assigned anew; beacon, task and loot IDs are kept.
+func (s *GormStore) ImportBeaconRecords(records *BeaconRecords) error {
+	beaconID := records.Beacon.BeaconID
+	defer s.InvalidateBeacon(beaconID)
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Unscoped().Model(&Beacon{}).Where("beacon_id = ?", beaconID).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrBeaconExists
+		}
+
+		beacon := records.Beacon
+		beacon.ID = 0
+		beacon.SessionKey = records.SessionKey
+		if err := tx.Create(&beacon).Error; err != nil {
+			return err
+		}
+		for _, task := range records.Tasks {
+			task.ID = 0
+			task.BeaconID = beaconID
+			task.Engagement = beacon.Engagement
+			if err := tx.Create(&task).Error; err != nil {
+				return err
+			}
+		}
+		for _, note := range records.Notes {
+			note.ID = 0
+			note.BeaconID = beaconID
+			note.Engagement = beacon.Engagement
+			if err := tx.Create(&note).Error; err != nil {
+				return err
+			}
+		}
+		for _, item := range records.Loot {
+			item.ID = 0
+			item.BeaconID = beaconID
+			item.Engagement = beacon.Engagement
+			item.Path = records.LootPaths[item.LootID]
+			item.MirroredAt = nil // Not in this TeamServer's mirror
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
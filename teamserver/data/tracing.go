@@ -0,0 +1,76 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// tracer creates the spans of database queries.
+var tracer = otel.Tracer("simplec2/teamserver/data")
+
+// spanInstanceKey keeps the span of a query between its before and after callbacks.
+const spanInstanceKey = "simplec2:span"
+
+// registerTracing records a span for each query made with a context carrying a recording span
+// (see DataStore.WithContext). Queries outside a trace, such as those of the background
+// routines, aren't recorded, so they don't show up as traces of their own.
+func registerTracing(db *gorm.DB) error {
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register("simplec2:trace_before_create", startQuerySpan("create")),
+		callbacks.Create().After("gorm:create").Register("simplec2:trace_after_create", endQuerySpan),
+		callbacks.Query().Before("gorm:query").Register("simplec2:trace_before_query", startQuerySpan("query")),
+		callbacks.Query().After("gorm:query").Register("simplec2:trace_after_query", endQuerySpan),
+		callbacks.Update().Before("gorm:update").Register("simplec2:trace_before_update", startQuerySpan("update")),
+		callbacks.Update().After("gorm:update").Register("simplec2:trace_after_update", endQuerySpan),
+		callbacks.Delete().Before("gorm:delete").Register("simplec2:trace_before_delete", startQuerySpan("delete")),
+		callbacks.Delete().After("gorm:delete").Register("simplec2:trace_after_delete", endQuerySpan),
+		callbacks.Row().Before("gorm:row").Register("simplec2:trace_before_row", startQuerySpan("row")),
+		callbacks.Row().After("gorm:row").Register("simplec2:trace_after_row", endQuerySpan),
+		callbacks.Raw().Before("gorm:raw").Register("simplec2:trace_before_raw", startQuerySpan("raw")),
+		callbacks.Raw().After("gorm:raw").Register("simplec2:trace_after_raw", endQuerySpan),
+	} {
+		if err != nil {
+			return fmt.Errorf("failed to register tracing callbacks: %w", err)
+		}
+	}
+	return nil
+}
+
+// startQuerySpan starts the span of a query if its context is traced.
+func startQuerySpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil || !trace.SpanFromContext(ctx).IsRecording() {
+			return
+		}
+		_, span := tracer.Start(ctx, "db."+operation, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system.name", db.Dialector.Name()), attribute.String("db.operation.name", operation)))
+		db.InstanceSet(spanInstanceKey, span)
+	}
+}
+
+// endQuerySpan ends the span startQuerySpan started, if any.
+func endQuerySpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(spanInstanceKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	span.SetAttributes(
+		attribute.String("db.collection.name", db.Statement.Table),
+		attribute.String("db.query.text", db.Statement.SQL.String()),
+		attribute.Int64("db.response.returned_rows", db.Statement.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,176 @@
+// Package dnscanary answers the DNS queries for the canary subdomains built into payloads. The
+// canary domain is delegated to the TeamServer, and every query under it is reported, so the
+// detonation of a payload is known before its beacon checks in, or even if it never does.
+package dnscanary
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Query is a DNS query for a name under the canary domain.
+type Query struct {
+	Name      string // Queried name, in lower case without the trailing dot
+	Type      string // e.g. "A", "AAAA"
+	Subdomain string // Canary subdomain the name is under, e.g. "k3j2h4m5.cdn-metrics.example.com"
+	Resolver  string // Address the query came from, usually the victim's recursive resolver
+}
+
+// Server is an authoritative DNS server for the canary domain.
+type Server struct {
+	domain   string
+	answerIP *[4]byte
+	listen   string
+	report   func(Query)
+
+	mu   sync.Mutex
+	conn *net.UDPConn
+}
+
+// New creates a DNS server for the configured canary domain. report is called with every query for
+// a name under a canary subdomain.
+func New(cfg *config.DNSCanaryConfig, report func(Query)) (*Server, error) {
+	domain := strings.ToLower(strings.Trim(cfg.Domain, "."))
+	if domain == "" || !strings.Contains(domain, ".") {
+		return nil, fmt.Errorf("dns canary domain is required, e.g. cdn-metrics.example.com")
+	}
+	s := &Server{domain: domain, listen: cfg.GetListen(), report: report}
+	if cfg.AnswerIP != "" {
+		ip := net.ParseIP(cfg.AnswerIP).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid dns canary answer_ip: %q must be an IPv4 address", cfg.AnswerIP)
+		}
+		s.answerIP = &[4]byte{ip[0], ip[1], ip[2], ip[3]}
+	}
+	return s, nil
+}
+
+// Domain returns the canary domain, in lower case.
+func (s *Server) Domain() string {
+	return s.domain
+}
+
+// Start listens on the configured UDP address and answers queries in the background.
+func (s *Server) Start() error {
+	addr, err := net.ResolveUDPAddr("udp", s.listen)
+	if err != nil {
+		return fmt.Errorf("invalid dns canary listen address: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.listen, err)
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	go s.serve(conn)
+	return nil
+}
+
+// Close stops answering queries.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *Server) serve(conn *net.UDPConn) {
+	buf := make([]byte, 512)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Errorf("DNS canary server stopped: %v", err)
+			}
+			return
+		}
+		response, query := s.answer(buf[:n], from.String())
+		if response == nil {
+			continue
+		}
+		if _, err := conn.WriteToUDP(response, from); err != nil {
+			logger.Debugf("Failed to answer DNS query from %s: %v", from, err)
+		}
+		if query != nil && s.report != nil {
+			s.report(*query)
+		}
+	}
+}
+
+// answer builds the response to a DNS message and returns the query it holds if the name is under a
+// canary subdomain. Messages that can't be parsed are dropped.
+func (s *Server) answer(packet []byte, resolver string) ([]byte, *Query) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(packet)
+	if err != nil || header.Response {
+		return nil, nil
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil, nil
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(question.Name.String(), "."))
+	responseHeader := dnsmessage.Header{
+		ID:               header.ID,
+		Response:         true,
+		OpCode:           header.OpCode,
+		Authoritative:    true,
+		RecursionDesired: header.RecursionDesired,
+		RCode:            dnsmessage.RCodeSuccess,
+	}
+	var query *Query
+	switch {
+	case header.OpCode != 0:
+		responseHeader.RCode = dnsmessage.RCodeNotImplemented
+	case name == s.domain:
+	case strings.HasSuffix(name, "."+s.domain):
+		labels := strings.Split(strings.TrimSuffix(name, "."+s.domain), ".")
+		query = &Query{
+			Name:      name,
+			Type:      strings.TrimPrefix(question.Type.String(), "Type"),
+			Subdomain: labels[len(labels)-1] + "." + s.domain,
+			Resolver:  resolver,
+		}
+	default:
+		responseHeader.Authoritative = false
+		responseHeader.RCode = dnsmessage.RCodeRefused
+	}
+
+	builder := dnsmessage.NewBuilder(nil, responseHeader)
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, nil
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, nil
+	}
+	if responseHeader.RCode == dnsmessage.RCodeSuccess && question.Type == dnsmessage.TypeA && s.answerIP != nil {
+		if err := builder.StartAnswers(); err != nil {
+			return nil, nil
+		}
+		// A TTL of 0 keeps resolvers from caching the answer
+		resource := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 0}
+		if err := builder.AResource(resource, dnsmessage.AResource{A: *s.answerIP}); err != nil {
+			return nil, nil
+		}
+	}
+	response, err := builder.Finish()
+	if err != nil {
+		return nil, nil
+	}
+	return response, query
+}
@@ -0,0 +1,180 @@
+// Package eventbus shares the events of the WebSocket hub between TeamServer replicas over Redis
+// pub/sub, so operators see the same events whichever replica their WebSocket is connected to.
+package eventbus
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+)
+
+const (
+	connectTimeout = 5 * time.Second
+	publishTimeout = 5 * time.Second
+	reportInterval = 10 * time.Second
+)
+
+// envelope is an event as published on the channel.
+type envelope struct {
+	Origin     string `json:"origin"` // Replica that broadcast the event
+	Engagement string `json:"engagement,omitempty"`
+	Event      string `json:"event"`
+}
+
+// Bus publishes the events of this replica and delivers the events of the others.
+// Events are published in the background without blocking; when Redis is slow or unreachable
+// the oldest are dropped.
+type Bus struct {
+	client  *redis.Client
+	channel string
+	origin  string
+	queue   chan []byte
+	dropped atomic.Int64
+	failed  atomic.Int64
+
+	pubsub    *redis.PubSub
+	closeOnce sync.Once
+	done      chan struct{}
+	finished  chan struct{}
+}
+
+// New connects to the configured Redis and starts publishing.
+func New(cfg *config.EventBusConfig) (*Bus, error) {
+	if cfg.Type != "redis" {
+		return nil, fmt.Errorf("invalid event_bus type '%s' (must be 'redis')", cfg.Type)
+	}
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("event_bus address is required")
+	}
+	opts := &redis.Options{
+		Addr:     cfg.Address,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	}
+	if cfg.TLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis at %s: %w", cfg.Address, err)
+	}
+
+	b := &Bus{
+		client:   client,
+		channel:  cfg.GetChannel(),
+		origin:   uuid.NewString(),
+		queue:    make(chan []byte, cfg.GetQueueSize()),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go b.run()
+	return b, nil
+}
+
+// Publish queues an event for the other replicas. It never blocks the caller.
+func (b *Bus) Publish(engagement string, event []byte) {
+	payload, err := json.Marshal(envelope{Origin: b.origin, Engagement: engagement, Event: string(event)})
+	if err != nil {
+		return
+	}
+	for {
+		select {
+		case b.queue <- payload:
+			return
+		default:
+		}
+		select {
+		case <-b.queue:
+			b.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// Subscribe calls deliver with the events published by the other replicas, in the background.
+// Redis doesn't keep events for a replica while it is disconnected; those events are missed.
+func (b *Bus) Subscribe(deliver func(engagement string, event []byte)) {
+	b.pubsub = b.client.Subscribe(context.Background(), b.channel)
+	go func() {
+		for msg := range b.pubsub.Channel() {
+			var env envelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				logger.Warnf("Ignoring malformed event on bus channel %s: %v", b.channel, err)
+				continue
+			}
+			if env.Origin == b.origin || env.Event == "" {
+				continue
+			}
+			deliver(env.Engagement, []byte(env.Event))
+		}
+	}()
+}
+
+func (b *Bus) run() {
+	defer close(b.finished)
+	ticker := time.NewTicker(reportInterval)
+	defer ticker.Stop()
+
+	publish := func(payload []byte) {
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		defer cancel()
+		if err := b.client.Publish(ctx, b.channel, payload).Err(); err != nil {
+			if b.failed.Add(1) == 1 {
+				logger.Errorf("Failed to publish event to Redis: %v", err)
+			}
+		}
+	}
+
+	for {
+		select {
+		case payload := <-b.queue:
+			publish(payload)
+		case <-ticker.C:
+			if n := b.dropped.Swap(0); n > 0 {
+				logger.Warnf("Event bus queue full, dropped %d oldest events", n)
+			}
+			if n := b.failed.Swap(0); n > 0 {
+				logger.Warnf("Event bus could not publish %d events", n)
+			}
+		case <-b.done:
+			// Publish whatever is still queued before stopping
+			for {
+				select {
+				case payload := <-b.queue:
+					publish(payload)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Ping checks that Redis is reachable.
+func (b *Bus) Ping(ctx context.Context) error {
+	return b.client.Ping(ctx).Err()
+}
+
+// Close publishes the queued events and disconnects from Redis.
+func (b *Bus) Close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+	<-b.finished
+	if b.pubsub != nil {
+		b.pubsub.Close()
+	}
+	return b.client.Close()
+}
@@ -19,6 +19,7 @@ const (
 	// Task events
 	TaskQueued     EventType = "TASK_QUEUED"
 	TaskDispatched EventType = "TASK_DISPATCHED"
+	TaskProgress   EventType = "TASK_PROGRESS"
 	TaskCompleted  EventType = "TASK_COMPLETED"
 	TaskFailed     EventType = "TASK_FAILED"
 	TaskCanceled   EventType = "TASK_CANCELED"
@@ -32,6 +33,10 @@ const (
 	ListenerStarted EventType = "LISTENER_STARTED"
 	ListenerStopped EventType = "LISTENER_STOPPED"
 
+	// Payload events
+	PayloadBuilt  EventType = "PAYLOAD_BUILT"
+	PayloadFailed EventType = "PAYLOAD_FAILED"
+
 	// Client events
 	ClientConnected     EventType = "CLIENT_CONNECTED"
 	ClientAuthenticated EventType = "CLIENT_AUTHENTICATED"
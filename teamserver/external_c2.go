@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"simplec2/pkg/bridge"
+	"simplec2/teamserver/commands"
+	"simplec2/teamserver/service"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// externalC2 implements service.ExternalC2 by running each call through the handler of its
+// listener bridge counterpart, as the external listener the call names.
+type externalC2 struct {
+	server *server
+}
+
+// newExternalC2 creates the external C2 bridge of a server.
+func newExternalC2(s *server) service.ExternalC2 {
+	return &externalC2{server: s}
+}
+
+// remoteAddr is the address of an implant as reported to the external C2 API.
+type remoteAddr string
+
+func (a remoteAddr) Network() string { return "tcp" }
+func (a remoteAddr) String() string  { return string(a) }
+
+// asListener checks that the listener is an external listener of the caller's engagement and
+// returns a context in which the handlers take the call for one from that listener.
+func (e *externalC2) asListener(ctx context.Context, listener, addr string) (context.Context, error) {
+	record, err := e.server.ListenerService.GetListener(ctx, listener)
+	if err != nil || record.Type != service.ExternalListenerType {
+		return nil, fmt.Errorf("%w: '%s'", service.ErrExternalListener, listener)
+	}
+	ctx = context.WithValue(ctx, listenerIdentityKey{}, &listenerIdentity{CommonName: "external C2 API", ListenerName: listener})
+	return peer.NewContext(ctx, &peer.Peer{Addr: remoteAddr(addr)}), nil
+}
+
+// checkBeacon checks that a beacon talks through the listener.
+func (e *externalC2) checkBeacon(listener, beaconID string) error {
+	beacon, err := e.server.Store.GetBeacon(beaconID)
+	if err != nil || beacon.Listener != listener {
+		return fmt.Errorf("%w: beacon %s", service.ErrExternalNotFound, beaconID)
+	}
+	return nil
+}
+
+// externalError translates the gRPC status errors of the handlers into external C2 API errors.
+func externalError(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound, codes.PermissionDenied:
+		return fmt.Errorf("%w: %s", service.ErrExternalNotFound, status.Convert(err).Message())
+	case codes.InvalidArgument:
+		return fmt.Errorf("%w: %s", service.ErrExternalInvalid, status.Convert(err).Message())
+	}
+	return err
+}
+
+// RegisterBeacon stages a beacon through the external listener.
+func (e *externalC2) RegisterBeacon(ctx context.Context, listener, addr string, metadata *service.ExternalBeaconMetadata) (string, error) {
+	ctx, err := e.asListener(ctx, listener, addr)
+	if err != nil {
+		return "", err
+	}
+	res, err := e.server.StageBeacon(ctx, &bridge.StageBeaconRequest{
+		ListenerName: listener,
+		RemoteAddr:   addr,
+		Metadata: &bridge.BeaconMetadata{
+			Pid:             metadata.PID,
+			Os:              metadata.OS,
+			Arch:            metadata.Arch,
+			Username:        metadata.Username,
+			Hostname:        metadata.Hostname,
+			InternalIp:      metadata.InternalIP,
+			ProcessName:     metadata.ProcessName,
+			IsHighIntegrity: metadata.HighIntegrity,
+			AgentVersion:    metadata.AgentVersion,
+		},
+	})
+	if err != nil {
+		return "", externalError(err)
+	}
+	return res.AssignedBeaconId, nil
+}
+
+// CheckIn checks a beacon of the external listener in and hands out its tasks.
+func (e *externalC2) CheckIn(ctx context.Context, listener, beaconID, addr string, ackedTaskIDs []string) ([]service.ExternalTask, error) {
+	ctx, err := e.asListener(ctx, listener, addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkBeacon(listener, beaconID); err != nil {
+		return nil, err
+	}
+	res, err := e.server.CheckInBeacon(ctx, &bridge.CheckInBeaconRequest{
+		BeaconId:     beaconID,
+		ListenerName: listener,
+		RemoteAddr:   addr,
+		AckedTaskIds: ackedTaskIDs,
+	})
+	if err != nil {
+		return nil, externalError(err)
+	}
+
+	tasks := make([]service.ExternalTask, 0, len(res.Tasks))
+	for _, task := range res.Tasks {
+		external := service.ExternalTask{TaskID: task.TaskId, CommandID: task.CommandId, Arguments: task.Arguments}
+		if converter, ok := commands.GetByID(task.CommandId); ok {
+			external.Command = converter.Name()
+		}
+		tasks = append(tasks, external)
+	}
+	return tasks, nil
+}
+
+// PushOutput records the output of a task of a beacon of the external listener.
+func (e *externalC2) PushOutput(ctx context.Context, listener, beaconID, addr string, output *service.ExternalOutput) error {
+	ctx, err := e.asListener(ctx, listener, addr)
+	if err != nil {
+		return err
+	}
+	if err := e.checkBeacon(listener, beaconID); err != nil {
+		return err
+	}
+	task, err := e.server.Store.GetTask(output.TaskID)
+	if err != nil || task.BeaconID != beaconID {
+		return fmt.Errorf("%w: task %s", service.ErrExternalNotFound, output.TaskID)
+	}
+	converter, ok := commands.Get(task.Command)
+	if !ok {
+		return fmt.Errorf("%w: unknown command %s", service.ErrExternalInvalid, task.Command)
+	}
+
+	_, err = e.server.PushBeaconOutput(ctx, &bridge.PushBeaconOutputRequest{
+		BeaconId:     beaconID,
+		ListenerName: listener,
+		RemoteAddr:   addr,
+		TaskId:       task.TaskID,
+		CommandId:    converter.CommandID(),
+		Status:       output.Status,
+		Output:       output.Output,
+		ErrorMessage: output.Error,
+		Final:        output.Final,
+	})
+	return externalError(err)
+}
+
+// GetTaskFileChunk serves a ChunkSize chunk of a tasked file to a beacon of the external listener.
+func (e *externalC2) GetTaskFileChunk(ctx context.Context, listener, beaconID, taskID string, chunk int32) ([]byte, error) {
+	if chunk < 0 {
+		return nil, fmt.Errorf("%w: negative chunk number", service.ErrExternalInvalid)
+	}
+	ctx, err := e.asListener(ctx, listener, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkBeacon(listener, beaconID); err != nil {
+		return nil, err
+	}
+	res, err := e.server.GetTaskedFileChunk(ctx, &bridge.GetTaskedFileChunkRequest{TaskId: taskID, ChunkNumber: chunk, BeaconId: beaconID})
+	if err != nil {
+		return nil, externalError(err)
+	}
+	return res.ChunkData, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/filecrypt"
+)
+
+// initFileEncryption loads the file encryption master key and encrypts loot and uploaded files
+// that are still stored in plaintext, e.g. from before encryption was enabled.
+func initFileEncryption(cfg *config.TeamServerConfig) {
+	encoded, err := cfg.FileEncryption.GetMasterKey()
+	if err != nil {
+		logger.Fatalf("Failed to load file encryption key: %v", err)
+	}
+	if encoded == "" {
+		if cfg.FileEncryption.Required {
+			logger.Fatal("File encryption is required but no key is configured (set SIMC2_FILE_KEY or file_encryption.key_file)")
+		}
+		logger.Warn("No file encryption key configured, loot and uploaded files are stored in plaintext")
+		return
+	}
+
+	key, err := filecrypt.ParseKey(encoded)
+	if err != nil {
+		logger.Fatalf("Invalid file encryption key: %v", err)
+	}
+	if err := filecrypt.Init(key); err != nil {
+		logger.Fatalf("Failed to initialize file encryption: %v", err)
+	}
+	logger.Info("Loot and uploaded files are encrypted at rest")
+
+	for _, dir := range []string{cfg.LootDir, cfg.UploadsDir} {
+		encrypted, err := filecrypt.EncryptDir(dir)
+		if err != nil {
+			logger.Fatalf("Failed to encrypt existing files in %s: %v", dir, err)
+		}
+		if encrypted > 0 {
+			logger.Infof("Encrypted %d existing files in %s", encrypted, dir)
+		}
+	}
+}
+
+// decryptMirroredObject writes the plaintext of an object downloaded from the loot mirror to output.
+// The mirror key is read as the TeamServer reads it, so SIMC2_LOOT_MIRROR_KEY works without a
+// mirror section in the configuration.
+func decryptMirroredObject(cfg *config.LootMirrorConfig, path, output string) error {
+	if cfg == nil {
+		cfg = &config.LootMirrorConfig{}
+	}
+	encoded, err := cfg.GetKey()
+	if err != nil {
+		return err
+	}
+	key, err := filecrypt.ParseKey(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid loot mirror key: %w", err)
+	}
+	file, err := filecrypt.OpenWithKey(path, key)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	out, err := os.OpenFile(output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, file); err != nil {
+		out.Close()
+		os.Remove(output)
+		return err
+	}
+	return out.Close()
+}
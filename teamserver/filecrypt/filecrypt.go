@@ -0,0 +1,499 @@
+// Package filecrypt encrypts loot and uploaded files at rest.
+//
+// Every file gets its own random data key, wrapped by the TeamServer master key and stored in the
+// file header. The content is sealed with AES-256-GCM in 64 KiB segments, so files can be streamed
+// and read at arbitrary offsets (as chunked file serving does) without decrypting them whole.
+//
+// Without a master key, files are written in plaintext. Files are recognized by their header when
+// opened, so plaintext files written before encryption was enabled keep working.
+package filecrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// magic starts every encrypted file, the last byte is the format version.
+	magic = "SC2ENC\x00\x01"
+	// keyIDSize is the length of the master key fingerprint in the header.
+	keyIDSize = 8
+	// wrappedKeySize is the nonce, data key and GCM tag of the wrapped data key.
+	wrappedKeySize = 12 + 32 + 16
+	headerSize     = len(magic) + keyIDSize + wrappedKeySize
+
+	// segmentSize is the plaintext size of a sealed segment.
+	segmentSize = 64 * 1024
+	// sealedSegmentSize is the size of a full segment on disk.
+	sealedSegmentSize = segmentSize + 16
+)
+
+var (
+	// ErrNoKey is returned when opening an encrypted file without a master key.
+	ErrNoKey = errors.New("file is encrypted but no master key is configured")
+	// ErrWrongKey is returned when a file was encrypted with a different key.
+	ErrWrongKey = errors.New("file was encrypted with a different key")
+	// ErrCorrupt is returned when an encrypted file fails authentication.
+	ErrCorrupt = errors.New("encrypted file is corrupt or was tampered with")
+)
+
+var (
+	mu     sync.RWMutex
+	master cipher.AEAD
+	keyID  []byte
+)
+
+// Init sets the master key files are encrypted with. An empty key disables encryption.
+func Init(key []byte) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(key) == 0 {
+		master, keyID = nil, nil
+		return nil
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(key)
+	master, keyID = aead, sum[:keyIDSize]
+	return nil
+}
+
+// Enabled reports whether new files are encrypted.
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return master != nil
+}
+
+// ParseKey decodes a base64 or hex encoded 32-byte master key.
+func ParseKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if key, err := hex.DecodeString(encoded); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("master key must be 32 bytes, base64 or hex encoded")
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// segmentNonce derives the nonce of a segment. Data keys are never reused, so a counter is safe;
+// the final flag stops a truncated file from passing as complete.
+func segmentNonce(index int64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], uint64(index))
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// Create creates (or truncates) a file and returns a writer that encrypts what is written to it.
+// The file is only complete once the writer is closed.
+func Create(path string, perm os.FileMode) (io.WriteCloser, error) {
+	mu.RLock()
+	aead, id := master, keyID
+	mu.RUnlock()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return nil, err
+	}
+	if aead == nil {
+		return f, nil
+	}
+	w, err := newWriter(f, aead, id)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.closer = f
+	return w, nil
+}
+
+// Seal returns a writer that encrypts what is written to it into dst, in the format of encrypted
+// files but with key instead of the master key. The output is only complete once the writer is
+// closed; closing it doesn't close dst.
+func Seal(dst io.Writer, key []byte) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return newWriter(dst, aead, sum[:keyIDSize])
+}
+
+// newWriter writes the header of a new encrypted file with a random data key wrapped by aead.
+func newWriter(dst io.Writer, aead cipher.AEAD, id []byte) (*writer, error) {
+	dataKey := make([]byte, 32)
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header := append([]byte(magic), id...)
+	header = append(header, aead.Seal(nonce, nonce, dataKey, header)...)
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+
+	fileAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{w: dst, aead: fileAEAD}, nil
+}
+
+// writer seals data in segments as it is written.
+type writer struct {
+	w       io.Writer
+	closer  io.Closer // Closed with the writer, nil for Seal
+	aead    cipher.AEAD
+	buf     []byte
+	segment int64
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	// The last segment stays buffered until Close, it has to be sealed as final
+	for len(w.buf) > segmentSize {
+		if err := w.seal(w.buf[:segmentSize], false); err != nil {
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[segmentSize:]...)
+	}
+	return len(p), nil
+}
+
+func (w *writer) seal(plaintext []byte, final bool) error {
+	_, err := w.w.Write(w.aead.Seal(nil, segmentNonce(w.segment, final), plaintext, nil))
+	w.segment++
+	return err
+}
+
+func (w *writer) Close() error {
+	err := w.seal(w.buf, true)
+	if w.closer != nil {
+		if closeErr := w.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// WriteFile writes data to a file, encrypted if a master key is set.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	w, err := Create(path, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// File is an open file, decrypted transparently. It implements io.ReadSeeker and io.ReaderAt.
+type File struct {
+	f      *os.File
+	aead   cipher.AEAD // nil for plaintext files
+	size   int64       // Plaintext size
+	offset int64
+
+	// The last decrypted segment, so sequential reads decrypt each segment once
+	cached      int64
+	cachedPlain []byte
+}
+
+// Open opens a file for reading, decrypting it if it is encrypted.
+func Open(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	mu.RLock()
+	aead, id := master, keyID
+	mu.RUnlock()
+	file, err := newFile(f, aead, id)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// OpenWithKey opens a file written by Seal with key for reading. Plaintext files are read as is.
+func OpenWithKey(path string, key []byte) (*File, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := newFile(f, aead, sum[:keyIDSize])
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// newFile reads the header of a file; aead and id are the key that wrapped its data key.
+func newFile(f *os.File, aead cipher.AEAD, id []byte) (*File, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	n, err := f.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if n < len(magic) || string(header[:len(magic)]) != magic {
+		return &File{f: f, size: info.Size(), cached: -1}, nil
+	}
+	if n < headerSize {
+		return nil, ErrCorrupt
+	}
+
+	if aead == nil {
+		return nil, ErrNoKey
+	}
+	prefix := header[:len(magic)+keyIDSize]
+	if !bytes.Equal(prefix[len(magic):], id) {
+		return nil, ErrWrongKey
+	}
+	wrapped := header[len(prefix):]
+	dataKey, err := aead.Open(nil, wrapped[:12], wrapped[12:], prefix)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	fileAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := info.Size() - int64(headerSize)
+	segments := (sealed + sealedSegmentSize - 1) / sealedSegmentSize
+	// Every segment, including a possibly short or empty last one, carries a 16-byte tag
+	if sealed < 16 || sealed-(segments-1)*sealedSegmentSize < 16 {
+		return nil, ErrCorrupt
+	}
+	file := &File{f: f, aead: fileAEAD, size: sealed - segments*16, cached: -1}
+	// Reads of an empty file never reach its only segment, check it here so a file cut down to one
+	// tag doesn't pass as empty
+	if file.size == 0 {
+		if _, err := file.segment(0); err != nil {
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+// Size returns the plaintext size of the file.
+func (f *File) Size() int64 {
+	return f.size
+}
+
+// Encrypted reports whether the file is encrypted on disk.
+func (f *File) Encrypted() bool {
+	return f.aead != nil
+}
+
+// ReadAt reads plaintext at the given offset.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if f.aead == nil {
+		return f.f.ReadAt(p, off)
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+
+	n := 0
+	for n < len(p) {
+		if off >= f.size {
+			return n, io.EOF
+		}
+		plain, err := f.segment(off / segmentSize)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], plain[off%segmentSize:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+// segment returns the decrypted segment with the given index.
+func (f *File) segment(index int64) ([]byte, error) {
+	if index == f.cached {
+		return f.cachedPlain, nil
+	}
+	segments := (f.size + segmentSize - 1) / segmentSize
+	if segments == 0 {
+		segments = 1
+	}
+	sealed := make([]byte, sealedSegmentSize)
+	n, err := f.f.ReadAt(sealed, int64(headerSize)+index*sealedSegmentSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	plain, err := f.aead.Open(nil, segmentNonce(index, index == segments-1), sealed[:n], nil)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	f.cached, f.cachedPlain = index, plain
+	return plain, nil
+}
+
+// Read reads plaintext from the current offset.
+func (f *File) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if remaining := f.size - f.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next Read.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, fmt.Errorf("invalid whence")
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+// ReadFile reads and decrypts a whole file.
+func ReadFile(path string) ([]byte, error) {
+	f, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Size returns the plaintext size of a file.
+func Size(path string) (int64, error) {
+	f, err := Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.Size(), nil
+}
+
+// EncryptDir encrypts the plaintext files under dir in place. Returns the number of files encrypted.
+// It does nothing without a master key.
+func EncryptDir(dir string) (int, error) {
+	if !Enabled() {
+		return 0, nil
+	}
+	encrypted := 0
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == dir {
+			return filepath.SkipDir
+		}
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		done, err := encryptFile(path)
+		if done {
+			encrypted++
+		}
+		return err
+	})
+	return encrypted, err
+}
+
+// encryptFile encrypts a plaintext file in place, reporting whether it did.
+func encryptFile(path string) (bool, error) {
+	in, err := Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+	if in.Encrypted() {
+		return false, nil
+	}
+	info, err := in.f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	tmpPath := path + ".encrypting"
+	out, err := Create(tmpPath, info.Mode().Perm())
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return false, err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+	return true, nil
+}
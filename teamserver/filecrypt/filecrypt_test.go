@@ -0,0 +1,299 @@
+package filecrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testKey returns a random master key.
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
+
+// withMasterKey sets a random master key for the duration of the test.
+func withMasterKey(t *testing.T) []byte {
+	t.Helper()
+	key := testKey(t)
+	if err := Init(key); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { Init(nil) })
+	return key
+}
+
+// writeEncrypted writes size random bytes to an encrypted file and returns its path and the plaintext.
+func writeEncrypted(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+	plain := make([]byte, size)
+	if _, err := rand.Read(plain); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	if err := WriteFile(path, plain, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path, plain
+}
+
+// rewrite replaces the content of a file with what edit returns.
+func rewrite(t *testing.T, path string, edit func([]byte) []byte) {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if err := os.WriteFile(path, edit(raw), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+}
+
+// TestRoundTrip tests that files around the segment size decrypt to what was written.
+func TestRoundTrip(t *testing.T) {
+	withMasterKey(t)
+
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 7} {
+		path, plain := writeEncrypted(t, size)
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read file: %v", err)
+		}
+		if !bytes.HasPrefix(raw, []byte(magic)) {
+			t.Fatalf("size %d: file not encrypted", size)
+		}
+		if size >= 16 && bytes.Contains(raw, plain) {
+			t.Fatalf("size %d: plaintext found on disk", size)
+		}
+
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("size %d: Open: %v", size, err)
+		}
+		if !f.Encrypted() || f.Size() != int64(size) {
+			t.Fatalf("size %d: got encrypted=%v size=%d", size, f.Encrypted(), f.Size())
+		}
+		got, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("size %d: read: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("size %d: decrypted content differs", size)
+		}
+	}
+}
+
+// TestReadAtSegmentBoundary tests reads at offsets spanning two segments.
+func TestReadAtSegmentBoundary(t *testing.T) {
+	withMasterKey(t)
+	path, plain := writeEncrypted(t, segmentSize+1)
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 10)
+	n, err := f.ReadAt(buf, segmentSize-5)
+	if err != io.EOF || n != 6 {
+		t.Fatalf("expected 6 bytes and EOF, got %d and %v", n, err)
+	}
+	if !bytes.Equal(buf[:n], plain[segmentSize-5:]) {
+		t.Fatalf("read across the segment boundary returned the wrong bytes")
+	}
+	if _, err := f.Seek(-1, io.SeekEnd); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	if last, err := io.ReadAll(f); err != nil || !bytes.Equal(last, plain[segmentSize:]) {
+		t.Fatalf("read of the last byte failed: %v", err)
+	}
+}
+
+// TestTruncatedFile tests that dropping or cutting the final segment is detected, even when what is
+// left ends on a segment boundary and would otherwise look like a complete file.
+func TestTruncatedFile(t *testing.T) {
+	withMasterKey(t)
+
+	cuts := map[string]struct {
+		size int
+		keep func(raw []byte) int
+	}{
+		"final segment dropped": {segmentSize + 1, func(raw []byte) int { return headerSize + sealedSegmentSize }},
+		"final segment cut":     {segmentSize + 100, func(raw []byte) int { return len(raw) - 50 }},
+		"last byte missing":     {segmentSize, func(raw []byte) int { return len(raw) - 1 }},
+		"empty file tag cut":    {0, func(raw []byte) int { return headerSize + 8 }},
+		"cut to an empty file":  {segmentSize + 1, func(raw []byte) int { return headerSize + 16 }},
+	}
+	for name, cut := range cuts {
+		path, _ := writeEncrypted(t, cut.size)
+		rewrite(t, path, func(raw []byte) []byte { return raw[:cut.keep(raw)] })
+
+		if _, err := ReadFile(path); !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("%s: expected ErrCorrupt, got %v", name, err)
+		}
+	}
+}
+
+// TestReorderedSegments tests that swapping two segments of a file is detected.
+func TestReorderedSegments(t *testing.T) {
+	withMasterKey(t)
+	path, _ := writeEncrypted(t, 3*segmentSize)
+
+	rewrite(t, path, func(raw []byte) []byte {
+		first := headerSize
+		second := headerSize + sealedSegmentSize
+		swapped := append([]byte(nil), raw...)
+		copy(swapped[first:second], raw[second:second+sealedSegmentSize])
+		copy(swapped[second:second+sealedSegmentSize], raw[first:second])
+		return swapped
+	})
+	if _, err := ReadFile(path); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
+
+// TestWrongMasterKey tests that files can't be opened with another master key, or without one.
+func TestWrongMasterKey(t *testing.T) {
+	withMasterKey(t)
+	path, _ := writeEncrypted(t, 100)
+
+	withMasterKey(t)
+	if _, err := Open(path); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey, got %v", err)
+	}
+	if err := Init(nil); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if _, err := Open(path); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("expected ErrNoKey, got %v", err)
+	}
+}
+
+// TestTamperedHeader tests that changes to the wrapped data key or to the header it is bound to are
+// detected when the file is opened.
+func TestTamperedHeader(t *testing.T) {
+	withMasterKey(t)
+
+	offsets := map[string]int{
+		"wrapping nonce":   len(magic) + keyIDSize,
+		"wrapped data key": len(magic) + keyIDSize + 12,
+		"wrapping tag":     headerSize - 1,
+	}
+	for name, offset := range offsets {
+		path, _ := writeEncrypted(t, 100)
+		rewrite(t, path, func(raw []byte) []byte {
+			raw[offset] ^= 0x01
+			return raw
+		})
+		if _, err := Open(path); !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("%s: expected ErrCorrupt, got %v", name, err)
+		}
+	}
+
+	// The key ID is authenticated too; changing it makes the file unreadable with the right key
+	path, _ := writeEncrypted(t, 100)
+	rewrite(t, path, func(raw []byte) []byte {
+		raw[len(magic)] ^= 0x01
+		return raw
+	})
+	if _, err := Open(path); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey for a changed key ID, got %v", err)
+	}
+}
+
+// TestTamperedSegment tests that a flipped bit in the content fails authentication.
+func TestTamperedSegment(t *testing.T) {
+	withMasterKey(t)
+	path, _ := writeEncrypted(t, 2*segmentSize)
+	rewrite(t, path, func(raw []byte) []byte {
+		raw[headerSize+sealedSegmentSize+10] ^= 0x01
+		return raw
+	})
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	// The first segment is intact and still readable on its own
+	if _, err := f.ReadAt(make([]byte, segmentSize), 0); err != nil {
+		t.Fatalf("reading the intact segment: %v", err)
+	}
+	if _, err := f.ReadAt(make([]byte, 1), segmentSize); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
+
+// TestPlaintextFiles tests that plaintext files keep working and are encrypted in place by EncryptDir.
+func TestPlaintextFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	if err := WriteFile(path, []byte("plaintext"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	withMasterKey(t)
+	if got, err := ReadFile(path); err != nil || string(got) != "plaintext" {
+		t.Fatalf("plaintext file not readable with a master key: %q, %v", got, err)
+	}
+	if n, err := EncryptDir(dir); err != nil || n != 1 {
+		t.Fatalf("EncryptDir: %d, %v", n, err)
+	}
+	if n, err := EncryptDir(dir); err != nil || n != 0 {
+		t.Fatalf("EncryptDir encrypted a file twice: %d, %v", n, err)
+	}
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	if got, err := io.ReadAll(f); !f.Encrypted() || err != nil || string(got) != "plaintext" {
+		t.Fatalf("encrypted file: encrypted=%v %q, %v", f.Encrypted(), got, err)
+	}
+}
+
+// TestSealWithKey tests that Seal output can only be opened with its own key.
+func TestSealWithKey(t *testing.T) {
+	key := testKey(t)
+	path := filepath.Join(t.TempDir(), "sealed")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	w, err := Seal(out, key)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	plain := bytes.Repeat([]byte("x"), segmentSize+1)
+	if _, err := w.Write(plain); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	out.Close()
+
+	f, err := OpenWithKey(path, key)
+	if err != nil {
+		t.Fatalf("OpenWithKey: %v", err)
+	}
+	got, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("sealed content differs: %v", err)
+	}
+	if _, err := OpenWithKey(path, testKey(t)); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey, got %v", err)
+	}
+}
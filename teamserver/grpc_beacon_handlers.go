@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"simplec2/pkg/bridge"
 	"simplec2/pkg/logger"
 	"simplec2/teamserver/commands"
 	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
 
 	"github.com/google/uuid"
 	"google.golang.org/grpc/codes"
@@ -17,7 +20,9 @@ import (
 )
 
 func (s *server) StageBeacon(ctx context.Context, in *bridge.StageBeaconRequest) (*bridge.StageBeaconResponse, error) {
-	logger.Infof("Received StageBeacon from listener: %s", in.ListenerName)
+	if err := s.verifyListenerName(ctx, in.ListenerName); err != nil {
+		return nil, err
+	}
 
 	// Extract remote address from gRPC context
 	var remoteAddr string
@@ -26,6 +31,24 @@ func (s *server) StageBeacon(ctx context.Context, in *bridge.StageBeaconRequest)
 		remoteAddr = p.Addr.String()
 	}
 
+	// An upgraded agent takes over the identity of the beacon that launched it
+	if in.Metadata.UpgradeTaskId != "" {
+		if beacon := s.handoffBeacon(ctx, in, remoteAddr); beacon != nil {
+			return &bridge.StageBeaconResponse{
+				AssignedBeaconId: beacon.BeaconID,
+			}, nil
+		}
+	}
+
+	// Beacons built by the payload builder present their build token; burned payloads can't stage
+	payload, err := s.PayloadService.StagePayload(ctx, in.Metadata.BuildToken)
+	if errors.Is(err, service.ErrPayloadBurned) {
+		s.rejectBurnedPayload(ctx, payload, in)
+		return nil, status.Error(codes.PermissionDenied, "payload is burned")
+	} else if err != nil {
+		logger.Ctx(ctx).Errorf("Error recording the payload of a staging beacon: %v", err)
+	}
+
 	beacon := data.Beacon{
 		BeaconID:        uuid.New().String(),
 		Listener:        in.ListenerName,
@@ -43,14 +66,48 @@ func (s *server) StageBeacon(ctx context.Context, in *bridge.StageBeaconRequest)
 		ProcessName:     in.Metadata.ProcessName,
 		PID:             in.Metadata.Pid,
 		IsHighIntegrity: in.Metadata.IsHighIntegrity,
+		AgentVersion:    in.Metadata.AgentVersion,
+		HostFingerprint: in.Metadata.HostFingerprint,
+		Engagement:      service.DefaultEngagement,
+	}
+	if payload != nil {
+		beacon.PayloadID = payload.PayloadID
+	}
+	// The beacon belongs to the engagement of the listener it staged through
+	if listener, err := s.store(ctx).GetListener(in.ListenerName); err == nil && listener.Engagement != "" {
+		beacon.Engagement = listener.Engagement
+	}
+	// An agent restarted on a host it already ran on replaces the last beacon staged from there
+	var predecessor *data.Beacon
+	if beacon.HostFingerprint != "" {
+		if previous, err := s.store(ctx).GetLatestBeaconByFingerprint(beacon.Engagement, beacon.HostFingerprint); err == nil {
+			predecessor = previous
+			beacon.PredecessorID = previous.BeaconID
+		}
+	}
+	// Flag beacons on hosts the engagement isn't authorized for, they can only be tasked with an override
+	if inScope, err := s.EngagementService.BeaconInScope(ctx, &beacon); err != nil {
+		logger.Ctx(ctx).Errorf("Error checking target scope for beacon on %s: %v", beacon.Hostname, err)
+	} else if !inScope {
+		beacon.OutOfScope = true
 	}
 
-	if err := s.Store.CreateBeacon(&beacon); err != nil {
-		logger.Errorf("Error saving beacon to database: %v", err)
+	if err := s.store(ctx).CreateBeacon(&beacon); err != nil {
+		logger.Ctx(ctx).Errorf("Error saving beacon to database: %v", err)
 		return nil, err
 	}
 
-	logger.Infof("New beacon with ID %s saved to database", beacon.BeaconID)
+	logger.Ctx(ctx).Infof("New beacon with ID %s saved to database", beacon.BeaconID)
+	s.recordBeaconHost(&beacon)
+	if beacon.OutOfScope {
+		logger.Ctx(ctx).Warnf("!!! OUT OF SCOPE: beacon %s (%s@%s, %s) registered in engagement '%s' outside its target scope", beacon.BeaconID, beacon.Username, beacon.Hostname, beacon.InternalIP, beacon.Engagement)
+		s.AuditService.Alert(&service.SecurityAlert{
+			Name:     "beacon_out_of_scope",
+			Severity: 8,
+			Message:  "beacon " + beacon.BeaconID + " on " + beacon.Hostname + " (" + beacon.InternalIP + ") registered outside the target scope of engagement '" + beacon.Engagement + "'",
+			Fields:   map[string]string{"beacon_id": beacon.BeaconID, "hostname": beacon.Hostname, "internal_ip": beacon.InternalIP, "remote_addr": beacon.RemoteAddr, "engagement": beacon.Engagement, "listener": beacon.Listener},
+		})
+	}
 
 	// Broadcast the new beacon event via WebSocket
 	event := struct {
@@ -62,10 +119,24 @@ func (s *server) StageBeacon(ctx context.Context, in *bridge.StageBeaconRequest)
 	}
 	eventBytes, err := json.Marshal(event)
 	if err != nil {
-		logger.Errorf("Error marshalling new beacon event: %v", err)
+		logger.Ctx(ctx).Errorf("Error marshalling new beacon event: %v", err)
 	} else {
-		s.Hub.Broadcast(eventBytes)
-		logger.Infof("Broadcasted BEACON_NEW event for %s", beacon.BeaconID)
+		s.Hub.BroadcastTo(beacon.Engagement, eventBytes)
+		logger.Ctx(ctx).Infof("Broadcasted BEACON_NEW event for %s", beacon.BeaconID)
+	}
+
+	// A dedicated event so clients can raise a prominent warning
+	if beacon.OutOfScope {
+		event.Type = "BEACON_OUT_OF_SCOPE"
+		if eventBytes, err := json.Marshal(event); err != nil {
+			logger.Ctx(ctx).Errorf("Error marshalling out-of-scope beacon event: %v", err)
+		} else {
+			s.Hub.BroadcastTo(beacon.Engagement, eventBytes)
+		}
+	}
+
+	if predecessor != nil {
+		s.replaceBeacon(ctx, &beacon, predecessor)
 	}
 
 	return &bridge.StageBeaconResponse{
@@ -73,34 +144,191 @@ func (s *server) StageBeacon(ctx context.Context, in *bridge.StageBeaconRequest)
 	}, nil
 }
 
+// replaceBeacon links a re-staged beacon to the beacon it replaces, archiving the old one if configured,
+// and broadcasts BEACON_RESTAGED. An archived beacon that checks in again is restored as usual.
+func (s *server) replaceBeacon(ctx context.Context, beacon *data.Beacon, predecessor *data.Beacon) {
+	logger.Ctx(ctx).Infof("Beacon %s re-staged on %s@%s, replacing beacon %s", beacon.BeaconID, beacon.Username, beacon.Hostname, predecessor.BeaconID)
+	if s.Config.Beacons.ArchiveRestaged && predecessor.ArchivedAt == nil {
+		now := time.Now()
+		if err := s.store(ctx).SetBeaconArchived(predecessor.BeaconID, &now); err != nil {
+			logger.Ctx(ctx).Errorf("Error archiving beacon %s replaced by %s: %v", predecessor.BeaconID, beacon.BeaconID, err)
+		} else {
+			predecessor.ArchivedAt = &now
+		}
+	}
+
+	event, err := json.Marshal(map[string]interface{}{
+		"type": "BEACON_RESTAGED",
+		"payload": map[string]interface{}{
+			"beacon":      beacon,
+			"predecessor": predecessor,
+		},
+	})
+	if err != nil {
+		logger.Ctx(ctx).Errorf("Error marshalling BEACON_RESTAGED event: %v", err)
+		return
+	}
+	s.Hub.BroadcastTo(beacon.Engagement, event)
+}
+
+// rejectBurnedPayload raises an alert for a burned payload trying to stage: it was reused or leaked,
+// and someone, possibly a defender, is running it.
+func (s *server) rejectBurnedPayload(ctx context.Context, payload *data.Payload, in *bridge.StageBeaconRequest) {
+	logger.Ctx(ctx).Warnf("!!! Refused staging of burned payload %s (%s) by %s@%s from %s", payload.PayloadID, payload.BurnReason, in.Metadata.Username, in.Metadata.Hostname, in.RemoteAddr)
+	s.AuditService.Alert(&service.SecurityAlert{
+		Name:     "burned_payload_staged",
+		Severity: 7,
+		SourceIP: in.RemoteAddr,
+		Message:  "burned payload " + payload.PayloadID + " (" + payload.BurnReason + ") tried to stage from " + in.Metadata.Hostname,
+		Fields:   map[string]string{"payload_id": payload.PayloadID, "burn_reason": payload.BurnReason, "hostname": in.Metadata.Hostname, "username": in.Metadata.Username, "internal_ip": in.Metadata.InternalIp, "remote_addr": in.RemoteAddr, "listener": in.ListenerName, "engagement": payload.Engagement},
+	})
+
+	event, err := json.Marshal(map[string]interface{}{
+		"type": "PAYLOAD_STAGE_REJECTED",
+		"payload": map[string]interface{}{
+			"payload":     payload,
+			"hostname":    in.Metadata.Hostname,
+			"username":    in.Metadata.Username,
+			"internal_ip": in.Metadata.InternalIp,
+			"remote_addr": in.RemoteAddr,
+			"listener":    in.ListenerName,
+		},
+	})
+	if err != nil {
+		logger.Ctx(ctx).Errorf("Error marshalling PAYLOAD_STAGE_REJECTED event: %v", err)
+		return
+	}
+	s.Hub.BroadcastTo(payload.Engagement, event)
+}
+
+// handoffBeacon re-attaches an upgraded agent to its existing beacon record.
+// The upgrade task ID acts as a one-time token: it must belong to the claimed beacon
+// and still be awaiting the handoff. Returns nil if the handoff is not valid.
+func (s *server) handoffBeacon(ctx context.Context, in *bridge.StageBeaconRequest, remoteAddr string) *data.Beacon {
+	task, err := s.store(ctx).GetTask(in.Metadata.UpgradeTaskId)
+	if err != nil || task.Command != "upgrade" || task.BeaconID != in.Metadata.BeaconId ||
+		(task.Status != "dispatched" && task.Status != "running") {
+		logger.Ctx(ctx).Warnf("Rejected upgrade handoff for beacon %s (task %s)", in.Metadata.BeaconId, in.Metadata.UpgradeTaskId)
+		return nil
+	}
+
+	beacon, err := s.store(ctx).GetBeacon(task.BeaconID)
+	if err != nil {
+		logger.Ctx(ctx).Errorf("Error getting beacon %s for upgrade handoff: %v", task.BeaconID, err)
+		return nil
+	}
+
+	beacon.Listener = in.ListenerName
+	beacon.RemoteAddr = remoteAddr
+	beacon.Status = "active"
+	beacon.LastSeen = time.Now()
+	beacon.PID = in.Metadata.Pid
+	beacon.ProcessName = in.Metadata.ProcessName
+	beacon.IsHighIntegrity = in.Metadata.IsHighIntegrity
+	beacon.AgentVersion = in.Metadata.AgentVersion
+	if in.Metadata.HostFingerprint != "" {
+		beacon.HostFingerprint = in.Metadata.HostFingerprint
+	}
+	if err := s.store(ctx).UpdateBeacon(beacon); err != nil {
+		logger.Ctx(ctx).Errorf("Error updating beacon %s after upgrade: %v", beacon.BeaconID, err)
+		return nil
+	}
+
+	task.Status = "completed"
+	task.Output = fmt.Sprintf("Upgraded to agent version %s (PID %d, process %s)", beacon.AgentVersion, beacon.PID, beacon.ProcessName)
+	if err := s.store(ctx).UpdateTask(task); err != nil {
+		logger.Ctx(ctx).Errorf("Error completing upgrade task %s: %v", task.TaskID, err)
+	}
+
+	// The new binary stays on disk where it was launched from
+	if source, err := commands.ResolveUpgradeSource(task.Arguments); err == nil {
+		s.recordDroppedFile(ctx, task, "upgrade", source, beacon.ProcessName)
+	}
+
+	logger.Ctx(ctx).Infof("Beacon %s handed off to upgraded agent (version %s)", beacon.BeaconID, beacon.AgentVersion)
+	s.recordBeaconHost(beacon)
+
+	for _, event := range []struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}{
+		{Type: "BEACON_METADATA_UPDATED", Payload: beacon},
+		{Type: "TASK_OUTPUT", Payload: task},
+	} {
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			logger.Ctx(ctx).Errorf("Error marshalling %s event: %v", event.Type, err)
+			continue
+		}
+		s.Hub.BroadcastTo(beacon.Engagement, eventBytes)
+		logger.Ctx(ctx).Debugf("Broadcasted %s event for %s", event.Type, beacon.BeaconID)
+	}
+
+	return beacon
+}
+
 func (s *server) CheckInBeacon(ctx context.Context, in *bridge.CheckInBeaconRequest) (*bridge.CheckInBeaconResponse, error) {
-	logger.Infof("Received CheckInBeacon from beacon: %s", in.BeaconId)
+	if err := s.verifyListenerName(ctx, in.ListenerName); err != nil {
+		return nil, err
+	}
 
-	beacon, err := s.Store.GetBeacon(in.BeaconId)
+	beacon, err := s.store(ctx).GetBeacon(in.BeaconId)
 	if err != nil {
-		logger.Warnf("Beacon %s not found during check-in: %v. Assuming exited.", in.BeaconId, err)
+		logger.Ctx(ctx).Warnf("Beacon %s not found during check-in: %v. Assuming exited.", in.BeaconId, err)
 		return nil, status.Errorf(codes.NotFound, "beacon not found")
 	}
 
 	// Update beacon's last seen time
 	beacon.LastSeen = time.Now()
+	// Only LastSeen changes on most check-ins; it is written in batches rather than saving the row
+	changed := false
+
+	// A beacon that was archived as dead but is still alive goes back into the list
+	if beacon.ArchivedAt != nil {
+		logger.Ctx(ctx).Infof("Archived beacon %s checked in, restoring it.", in.BeaconId)
+		beacon.ArchivedAt = nil
+		changed = true
+		defer s.broadcastEvent(beacon.Engagement, "BEACON_RESTORED", beacon)
+	}
+
+	// A check-in means the beacon is no longer hibernating
+	if beacon.HibernateUntil != nil {
+		logger.Ctx(ctx).Infof("Beacon %s woke up from hibernation.", in.BeaconId)
+		beacon.HibernateUntil = nil
+		changed = true
+	}
+	// The status calculator only notices beacons going silent; a returning beacon is active at once
+	if beacon.Status == "inactive" || beacon.Status == "hibernating" {
+		if beacon.Status == "inactive" {
+			defer s.reportStatusChange(beacon, beacon.Status, "active")
+		}
+		beacon.Status = "active"
+		changed = true
+	}
+
+	// Tasks delivered on an earlier check-in are confirmed here
+	s.ackTasks(ctx, in.BeaconId, in.AckedTaskIds)
 
 	// If beacon is in 'exiting' state, send it an exit task.
 	if beacon.Status == "exiting" {
-		logger.Infof("Beacon %s is in 'exiting' state. Sending final exit task.", in.BeaconId)
+		logger.Ctx(ctx).Infof("Beacon %s is in 'exiting' state. Sending final exit task.", in.BeaconId)
 		var grpcTasks []*bridge.Task
 		grpcTasks = append(grpcTasks, &bridge.Task{
 			TaskId:    uuid.New().String(),
 			CommandId: 4, // CommandID for exit
 			Arguments: nil,
 		})
-		s.Store.UpdateBeacon(beacon) // Save updated LastSeen
+		s.store(ctx).UpdateBeacon(beacon) // Save updated LastSeen
 		return &bridge.CheckInBeaconResponse{
 			Tasks: grpcTasks,
 		}, nil
 	}
 
-	s.Store.UpdateBeacon(beacon)
+	if changed {
+		s.store(ctx).UpdateBeacon(beacon)
+	} else {
+		s.recordLastSeen(beacon.BeaconID, beacon.LastSeen)
+	}
 
 	// Broadcast the check-in event via WebSocket
 	checkinEvent := struct {
@@ -121,17 +349,20 @@ func (s *server) CheckInBeacon(ctx context.Context, in *bridge.CheckInBeaconRequ
 	}
 	eventBytes, err := json.Marshal(checkinEvent)
 	if err != nil {
-		logger.Errorf("Error marshalling check-in event: %v", err)
+		logger.Ctx(ctx).Errorf("Error marshalling check-in event: %v", err)
 	} else {
-		s.Hub.Broadcast(eventBytes)
+		s.Hub.BroadcastTo(beacon.Engagement, eventBytes)
 	}
 
+	// Tasks the beacon never confirmed are delivered again (or given up on)
+	s.requeueUnackedTasks(ctx, in.BeaconId)
+
 	// Find queued tasks for this beacon
 	var grpcTasks []*bridge.Task
 
-	allTasks, err := s.Store.GetTasksByBeaconID(in.BeaconId, "queued")
+	allTasks, err := s.store(ctx).GetTasksByBeaconID(in.BeaconId, "queued")
 	if err != nil {
-		logger.Errorf("Error getting tasks for beacon %s: %v", in.BeaconId, err)
+		logger.Ctx(ctx).Errorf("Error getting tasks for beacon %s: %v", in.BeaconId, err)
 		return nil, err
 	}
 
@@ -143,14 +374,14 @@ func (s *server) CheckInBeacon(ctx context.Context, in *bridge.CheckInBeaconRequ
 		// 使用命令注册表获取转换器
 		converter, ok := commands.Get(dbTask.Command)
 		if !ok {
-			logger.Warnf("Unknown command type for task %s: %s", dbTask.TaskID, dbTask.Command)
+			logger.Ctx(ctx).Warnf("Unknown command type for task %s: %s", dbTask.TaskID, dbTask.Command)
 			continue
 		}
 
 		// 转换任务参数
 		taskArgs, err := converter.Convert(&dbTask)
 		if err != nil {
-			logger.Errorf("Failed to convert task %s: %v", dbTask.TaskID, err)
+			logger.Ctx(ctx).Errorf("Failed to convert task %s: %v", dbTask.TaskID, err)
 			continue
 		}
 
@@ -176,8 +407,8 @@ func (s *server) CheckInBeacon(ctx context.Context, in *bridge.CheckInBeaconRequ
 					},
 				}
 				if startEventBytes, err := json.Marshal(startEvent); err == nil {
-					s.Hub.Broadcast(startEventBytes)
-					logger.Debugf("Broadcasted FILE_DOWNLOAD_STARTED event for %s", downloadArgs.Source)
+					s.Hub.BroadcastTo(dbTask.Engagement, startEventBytes)
+					logger.Ctx(ctx).Debugf("Broadcasted FILE_DOWNLOAD_STARTED event for %s", downloadArgs.Source)
 				}
 			}
 		}
@@ -189,8 +420,12 @@ func (s *server) CheckInBeacon(ctx context.Context, in *bridge.CheckInBeaconRequ
 		})
 
 		// Update task status to dispatched
+		dispatchedAt := time.Now()
 		dbTask.Status = "dispatched"
-		s.Store.UpdateTask(&dbTask)
+		dbTask.DispatchedAt = &dispatchedAt
+		dbTask.DispatchAttempts++
+		dbTask.Techniques = commands.TechniquesOf(&dbTask)
+		s.store(ctx).UpdateTask(&dbTask)
 
 		// Broadcast TASK_DISPATCHED event
 		dispatchedEvent := struct {
@@ -202,10 +437,10 @@ func (s *server) CheckInBeacon(ctx context.Context, in *bridge.CheckInBeaconRequ
 		}
 		dispatchedEventBytes, err := json.Marshal(dispatchedEvent)
 		if err != nil {
-			logger.Errorf("Error marshalling TASK_DISPATCHED event: %v", err)
+			logger.Ctx(ctx).Errorf("Error marshalling TASK_DISPATCHED event: %v", err)
 		} else {
-			s.Hub.Broadcast(dispatchedEventBytes)
-			logger.Debugf("Broadcasted TASK_DISPATCHED event for %s", dbTask.TaskID)
+			s.Hub.BroadcastTo(dbTask.Engagement, dispatchedEventBytes)
+			logger.Ctx(ctx).Debugf("Broadcasted TASK_DISPATCHED event for %s", dbTask.TaskID)
 		}
 	}
 
@@ -214,3 +449,75 @@ func (s *server) CheckInBeacon(ctx context.Context, in *bridge.CheckInBeaconRequ
 		// NewSleep 字段不再使用，sleep间隔现在通过任务系统控制
 	}, nil
 }
+
+// ackTasks marks dispatched tasks the beacon confirmed receiving as running.
+func (s *server) ackTasks(ctx context.Context, beaconID string, taskIDs []string) {
+	if len(taskIDs) == 0 {
+		return
+	}
+	acked := make(map[string]bool, len(taskIDs))
+	for _, taskID := range taskIDs {
+		acked[taskID] = true
+	}
+
+	tasks, err := s.store(ctx).GetTasksByBeaconID(beaconID, "dispatched")
+	if err != nil {
+		logger.Ctx(ctx).Errorf("Error getting dispatched tasks for beacon %s: %v", beaconID, err)
+		return
+	}
+	now := time.Now()
+	for i := range tasks {
+		task := &tasks[i]
+		if !acked[task.TaskID] {
+			continue
+		}
+		task.Status = "running"
+		task.AckedAt = &now
+		if err := s.store(ctx).UpdateTask(task); err != nil {
+			logger.Ctx(ctx).Errorf("Error acknowledging task %s: %v", task.TaskID, err)
+			continue
+		}
+		logger.Ctx(ctx).Debugf("Beacon %s acknowledged task %s", beaconID, task.TaskID)
+	}
+}
+
+// requeueUnackedTasks puts dispatched tasks that were not acknowledged within the dispatch timeout
+// back in the queue. A task that has used up its delivery attempts is marked failed instead.
+func (s *server) requeueUnackedTasks(ctx context.Context, beaconID string) {
+	tasks, err := s.store(ctx).GetTasksByBeaconID(beaconID, "dispatched")
+	if err != nil {
+		logger.Ctx(ctx).Errorf("Error getting dispatched tasks for beacon %s: %v", beaconID, err)
+		return
+	}
+
+	timeout := s.Config.Tasks.GetDispatchTimeout()
+	maxAttempts := s.Config.Tasks.GetMaxDispatchAttempts()
+	for i := range tasks {
+		task := &tasks[i]
+		// Tasks dispatched before delivery tracking existed have no timestamp and are left alone
+		if task.AckedAt != nil || task.DispatchedAt == nil || time.Since(*task.DispatchedAt) < timeout {
+			continue
+		}
+
+		eventType := "TASK_REQUEUED"
+		if task.DispatchAttempts >= maxAttempts {
+			task.Status = "failed"
+			task.Output = fmt.Sprintf("Task was not acknowledged by the beacon after %d deliveries", task.DispatchAttempts)
+			eventType = "TASK_OUTPUT"
+			logger.Ctx(ctx).Warnf("Task %s for beacon %s was never acknowledged, giving up after %d deliveries", task.TaskID, beaconID, task.DispatchAttempts)
+		} else {
+			task.Status = "queued"
+			logger.Ctx(ctx).Warnf("Task %s for beacon %s was not acknowledged within %s, requeueing (delivery %d of %d)", task.TaskID, beaconID, timeout, task.DispatchAttempts+1, maxAttempts)
+		}
+		if err := s.store(ctx).UpdateTask(task); err != nil {
+			logger.Ctx(ctx).Errorf("Error requeueing task %s: %v", task.TaskID, err)
+			continue
+		}
+
+		s.broadcastEvent(task.Engagement, eventType, task)
+		if task.Status == "failed" {
+			s.resolveBeaconSettings(ctx, task)
+			s.advancePlaybook(task)
+		}
+	}
+}
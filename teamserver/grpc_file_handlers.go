@@ -3,68 +3,184 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
-	"os"
 	"path/filepath"
 	"strings"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"simplec2/pkg/bridge"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/commands"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/filecrypt"
+	"simplec2/teamserver/service"
 )
 
+// GetTaskedFileChunk serves one ChunkSize chunk of the file of a download or upgrade task.
+// Kept for listeners from before StreamTaskedFile.
 func (s *server) GetTaskedFileChunk(ctx context.Context, in *bridge.GetTaskedFileChunkRequest) (*bridge.GetTaskedFileChunkResponse, error) {
-	// For now, we don't have beacon identity in the gRPC context.
-	// This is a security risk that needs to be addressed later by passing the beacon ID
-	// from the listener's mTLS certificate subject.
-	// TODO: Add beacon identity to gRPC context and verify task ownership.
-
-	task, err := s.Store.GetTask(in.TaskId)
+	file, err := s.openTaskedFile(ctx, in.TaskId, in.BeaconId)
 	if err != nil {
-		return nil, status.Errorf(codes.NotFound, "task not found: %v", err)
+		return nil, err
 	}
+	defer file.Close()
 
-	if task.Command != "download" {
-		return nil, status.Errorf(codes.PermissionDenied, "task is not a download task")
+	chunkBuffer := make([]byte, ChunkSize)
+	offset := int64(in.ChunkNumber) * ChunkSize
+
+	bytesRead, err := file.ReadAt(chunkBuffer, offset)
+	if err != nil && err != io.EOF {
+		return nil, status.Errorf(codes.Internal, "failed to read chunk: %v", err)
+	}
+
+	return &bridge.GetTaskedFileChunkResponse{
+		ChunkData: chunkBuffer[:bytesRead],
+	}, nil
+}
+
+// StreamTaskedFile streams a range of the file of a download or upgrade task in messages of at
+// most streamChunkSize, so no message needs a raised size limit and gRPC flow control applies.
+func (s *server) StreamTaskedFile(in *bridge.StreamTaskedFileRequest, stream bridge.TeamServerBridgeService_StreamTaskedFileServer) error {
+	if in.Offset < 0 || in.Length < 0 {
+		return status.Errorf(codes.InvalidArgument, "offset and length must not be negative")
+	}
+	file, err := s.openTaskedFile(stream.Context(), in.TaskId, in.BeaconId)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	var downloadArgs struct {
-		Source      string `json:"source"`
-		Destination string `json:"destination"`
+	length := file.Size() - in.Offset
+	if in.Length > 0 && in.Length < length {
+		length = in.Length
 	}
-	if err := json.Unmarshal([]byte(task.Arguments), &downloadArgs); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to parse download arguments for task %s: %v", task.TaskID, err)
+	reader := io.NewSectionReader(file, in.Offset, max(length, 0))
+	buffer := make([]byte, streamChunkSize)
+	offset := in.Offset
+	for {
+		n, err := reader.Read(buffer)
+		if n > 0 {
+			if err := stream.Send(&bridge.FileChunk{Data: buffer[:n], Offset: offset}); err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read file: %v", err)
+		}
 	}
+}
 
-	sourcePath := downloadArgs.Source
-	// Security Check: Ensure the final path is within the intended uploads directory.
-	absUploadsDir, err := filepath.Abs(s.Config.UploadsDir)
+// openTaskedFile opens the file a download or upgrade task sends to the beacon, decrypted as it is
+// read. The file must be inside the uploads directory, or the builder output directory for upgrades.
+// It is only served to the beacon the task belongs to, through the listener that beacon uses.
+func (s *server) openTaskedFile(ctx context.Context, taskID, beaconID string) (*filecrypt.File, error) {
+	task, err := s.store(ctx).GetTask(taskID)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not resolve uploads directory")
+		return nil, status.Errorf(codes.NotFound, "task not found: %v", err)
+	}
+	if err := s.checkTaskedFileAccess(ctx, task, beaconID); err != nil {
+		return nil, err
 	}
+
+	var sourcePath string
+	// Directories the served file must live in
+	allowedDirs := []string{s.Config.UploadsDir}
+
+	switch task.Command {
+	case "download":
+		var downloadArgs struct {
+			Source      string `json:"source"`
+			Destination string `json:"destination"`
+		}
+		if err := json.Unmarshal([]byte(task.Arguments), &downloadArgs); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to parse download arguments for task %s: %v", task.TaskID, err)
+		}
+		sourcePath = downloadArgs.Source
+	case "upgrade":
+		sourcePath, err = commands.ResolveUpgradeSource(task.Arguments)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to resolve upgrade source for task %s: %v", task.TaskID, err)
+		}
+		allowedDirs = append(allowedDirs, s.Config.Builder.OutputDir)
+	default:
+		return nil, status.Errorf(codes.PermissionDenied, "task is not a download task")
+	}
+
+	// Security Check: Ensure the final path is within one of the allowed directories.
 	absFilePath, err := filepath.Abs(sourcePath)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not resolve file path")
 	}
-	if !strings.HasPrefix(absFilePath, absUploadsDir) {
+	allowed := false
+	for _, dir := range allowedDirs {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "could not resolve directory %s", dir)
+		}
+		if strings.HasPrefix(absFilePath, absDir+string(filepath.Separator)) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
 		return nil, status.Errorf(codes.PermissionDenied, "access denied: file is outside of the uploads directory")
 	}
 
-	file, err := os.Open(absFilePath)
+	// Uploaded files may be encrypted at rest, they are served decrypted
+	file, err := filecrypt.Open(absFilePath)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to open file: %v", err)
 	}
-	defer file.Close()
-
-	chunkBuffer := make([]byte, ChunkSize)
-	offset := int64(in.ChunkNumber) * ChunkSize
+	return file, nil
+}
 
-	bytesRead, err := file.ReadAt(chunkBuffer, offset)
-	if err != nil && err != io.EOF {
-		return nil, status.Errorf(codes.Internal, "failed to read chunk: %v", err)
+// checkTaskedFileAccess verifies that the file of a task is requested for the beacon the task
+// belongs to, by the listener that beacon checks in through. The listener is identified by its
+// mTLS client certificate; calls without a listener identity are refused.
+func (s *server) checkTaskedFileAccess(ctx context.Context, task *data.Task, beaconID string) error {
+	identity, ok := listenerIdentityFrom(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "unknown listener identity")
+	}
+	listenerName := identity.ListenerName
+	deny := func(reason string) error {
+		s.AuditService.Alert(&service.SecurityAlert{
+			Name:     "tasked_file_access_denied",
+			Severity: 7,
+			Message:  fmt.Sprintf("file of task %s refused: %s", task.TaskID, reason),
+			Fields: map[string]string{
+				"task_id":        task.TaskID,
+				"task_beacon_id": task.BeaconID,
+				"beacon_id":      beaconID,
+				"listener":       listenerName,
+				"certificate":    identity.SerialNumber,
+			},
+		})
+		logger.Ctx(ctx).Warnf("Refused the file of task %s: %s", task.TaskID, reason)
+		return status.Errorf(codes.PermissionDenied, "access denied: %s", reason)
 	}
 
-	return &bridge.GetTaskedFileChunkResponse{
-		ChunkData: chunkBuffer[:bytesRead],
-	}, nil
+	if beaconID == "" {
+		return deny("no beacon ID in the request")
+	}
+	if task.BeaconID != beaconID {
+		return deny(fmt.Sprintf("task belongs to another beacon than %s", beaconID))
+	}
+	if listenerName == "" {
+		return deny("certificate is not bound to a listener")
+	}
+	beacon, err := s.store(ctx).GetBeacon(task.BeaconID)
+	if err != nil {
+		return status.Errorf(codes.NotFound, "beacon not found: %v", err)
+	}
+	if beacon.Listener != listenerName {
+		return deny(fmt.Sprintf("beacon %s does not use listener %s", beacon.BeaconID, listenerName))
+	}
+	return nil
 }
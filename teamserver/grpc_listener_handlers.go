@@ -21,24 +21,40 @@ func (s *server) ListenerControl(stream bridge.TeamServerBridgeService_ListenerC
 	if listenerName == "" {
 		return fmt.Errorf("listener name is empty in initial status")
 	}
+	if err := s.verifyListenerName(stream.Context(), listenerName); err != nil {
+		return err
+	}
 
 	// Auto-Register: Ensure listener exists in DB
-	ctx := context.Background()
+	// Not the stream's context, which is canceled before the disconnect is handled; only its request ID is kept
+	ctx := logger.ContextWithRequestID(context.Background(), logger.RequestID(stream.Context()))
 	if _, err := s.ListenerService.GetListener(ctx, listenerName); err != nil {
 		// If not found (or DB error), try to create if we have type info
 		if statusMsg.Type != "" {
-			logger.Infof("Auto-registering listener '%s' (Type: %s)", listenerName, statusMsg.Type)
+			logger.Ctx(ctx).Infof("Auto-registering listener '%s' (Type: %s)", listenerName, statusMsg.Type)
 			_, err = s.ListenerService.CreateListener(ctx, listenerName, statusMsg.Type, statusMsg.ConfigJson)
 			if err != nil {
-				logger.Errorf("Failed to auto-register listener: %v", err)
+				logger.Ctx(ctx).Errorf("Failed to auto-register listener: %v", err)
 			}
 		}
+	} else if statusMsg.ConfigJson != "" {
+		// Keep the stored config (port, public key, ...) in sync with what the listener reports
+		if err := s.ListenerService.UpdateListenerConfig(ctx, listenerName, statusMsg.ConfigJson); err != nil {
+			logger.Ctx(ctx).Errorf("Failed to update config for listener '%s': %v", listenerName, err)
+		}
 	}
 
-	logger.Infof("Listener '%s' connected to control channel.", listenerName)
+	logger.Ctx(ctx).Infof("Listener '%s' connected to control channel.", listenerName)
+	logListenerEntries(ctx, listenerName, statusMsg)
 
 	// 2. 注册连接
 	s.ListenerService.RegisterConnection(listenerName, stream)
+	s.ListenerService.UpdateStatus(listenerName, statusMsg)
+	s.HostedFileService.RecordDownloads(listenerName, statusMsg.HostedFileDownloads)
+	s.CanaryService.RecordHits(listenerName, statusMsg.CanaryHits)
+	// Send the listener the files it hosts and its canaries, it may have restarted or missed changes
+	go s.HostedFileService.SyncListener(listenerName)
+	go s.CanaryService.SyncListener(listenerName)
 	
 	// Broadcast LISTENER_STARTED event
 	if listener, err := s.ListenerService.GetListener(ctx, listenerName); err == nil {
@@ -50,13 +66,13 @@ func (s *server) ListenerControl(stream bridge.TeamServerBridgeService_ListenerC
 			Payload: listener,
 		}
 		if eventBytes, err := json.Marshal(event); err == nil {
-			s.Hub.Broadcast(eventBytes)
+			s.Hub.BroadcastTo(listener.Engagement, eventBytes)
 		}
 	}
 
 	defer func() {
 		s.ListenerService.UnregisterConnection(listenerName)
-		logger.Infof("Listener '%s' disconnected/unregistered.", listenerName)
+		logger.Ctx(ctx).Infof("Listener '%s' disconnected/unregistered.", listenerName)
 		
 		// Broadcast LISTENER_STOPPED event
 		if listener, err := s.ListenerService.GetListener(context.Background(), listenerName); err == nil {
@@ -71,7 +87,7 @@ func (s *server) ListenerControl(stream bridge.TeamServerBridgeService_ListenerC
 				Payload: listener,
 			}
 			if eventBytes, err := json.Marshal(event); err == nil {
-				s.Hub.Broadcast(eventBytes)
+				s.Hub.BroadcastTo(listener.Engagement, eventBytes)
 			}
 		}
 	}()
@@ -80,18 +96,25 @@ func (s *server) ListenerControl(stream bridge.TeamServerBridgeService_ListenerC
 	for {
 		statusMsg, err := stream.Recv()
 		if err == io.EOF {
-			logger.Infof("Listener '%s' disconnected (EOF).", listenerName)
+			logger.Ctx(ctx).Infof("Listener '%s' disconnected (EOF).", listenerName)
 			return nil
 		}
 		if err != nil {
-			logger.Errorf("Error receiving status from listener '%s': %v", listenerName, err)
+			logger.Ctx(ctx).Errorf("Error receiving status from listener '%s': %v", listenerName, err)
 			return err
 		}
 
+		logListenerEntries(ctx, listenerName, statusMsg)
+
 		// 处理状态更新 (例如更新数据库状态)
-		logger.Debugf("Listener '%s' status update: Active=%v, Beacons=%d, Error=%s", 
-			listenerName, statusMsg.Active, statusMsg.ActiveBeacons, statusMsg.ErrorMessage)
-            
-        // TODO: Update database state based on received status
+		logger.Ctx(ctx).Debugf("Listener '%s' status update: Active=%v, Beacons=%d, Error=%s, Connectivity=%s, Reconnects=%d", 
+			listenerName, statusMsg.Active, statusMsg.ActiveBeacons, statusMsg.ErrorMessage, statusMsg.Connectivity, statusMsg.Reconnects)
+		if !statusMsg.Active {
+			logger.Ctx(ctx).Warnf("Listener '%s' is not serving beacons: %s", listenerName, statusMsg.ErrorMessage)
+		}
+		s.ListenerService.UpdateStatus(listenerName, statusMsg)
+		s.HostedFileService.RecordDownloads(listenerName, statusMsg.HostedFileDownloads)
+		s.CanaryService.RecordHits(listenerName, statusMsg.CanaryHits)
 	}
 }
+
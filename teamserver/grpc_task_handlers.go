@@ -4,52 +4,112 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"simplec2/pkg/bridge"
 	"simplec2/pkg/logger"
+	"simplec2/teamserver/commands"
+	"simplec2/teamserver/data"
 
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/transform"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// advancePlaybook queues the next step of the playbook run a finished task belongs to.
+func (s *server) advancePlaybook(task *data.Task) {
+	run, next, err := s.PlaybookService.TaskFinished(task)
+	if err != nil {
+		logger.Errorf("Error advancing playbook for task %s: %v", task.TaskID, err)
+	}
+	if run == nil {
+		return
+	}
+
+	type event struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}
+	var events []event
+	if next != nil {
+		events = append(events, event{Type: "TASK_QUEUED", Payload: next})
+	}
+	events = append(events, event{Type: "PLAYBOOK_UPDATED", Payload: run})
+	for _, e := range events {
+		eventBytes, err := json.Marshal(e)
+		if err != nil {
+			logger.Errorf("Error marshalling %s event: %v", e.Type, err)
+			continue
+		}
+		s.Hub.BroadcastTo(run.Engagement, eventBytes)
+	}
+}
+
+// PushBeaconOutputStream receives a task result too large for one message: the first message
+// carries all fields, the following ones only more output. The assembled result is handled like
+// PushBeaconOutput.
+func (s *server) PushBeaconOutputStream(stream bridge.TeamServerBridgeService_PushBeaconOutputStreamServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	for {
+		part, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(req.Output)+len(part.Output) > maxStreamedOutputSize {
+			return status.Errorf(codes.ResourceExhausted, "task output exceeds %d bytes", maxStreamedOutputSize)
+		}
+		req.Output = append(req.Output, part.Output...)
+	}
+
+	res, err := s.PushBeaconOutput(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(res)
+}
+
 func (s *server) PushBeaconOutput(ctx context.Context, in *bridge.PushBeaconOutputRequest) (*bridge.PushBeaconOutputResponse, error) {
-	logger.Infof("Received PushBeaconOutput for task %s from beacon: %s", in.TaskId, in.BeaconId)
+	if err := s.verifyListenerName(ctx, in.ListenerName); err != nil {
+		return nil, err
+	}
 
-	task, err := s.Store.GetTask(in.TaskId)
+	task, err := s.store(ctx).GetTask(in.TaskId)
 	if err != nil {
-		logger.Errorf("Error finding task %s: %v", in.TaskId, err)
+		logger.Ctx(ctx).Errorf("Error finding task %s: %v", in.TaskId, err)
 		return nil, err
 	}
 
+	// Interim output of a still-running task
+	if in.Final != nil && !*in.Final {
+		return s.handleTaskProgress(ctx, task, in)
+	}
+	// Whatever the outcome, the playbook the task belongs to moves on
+	defer s.advancePlaybook(task)
+
 	var outputMessage string
 	if task.Command == "upload" {
-		lootFileName := filepath.Base(task.Arguments)
-		// 将文件保存到以 task_id 命名的子目录中，避免文件名冲突
-		lootTaskDir := filepath.Join(s.Config.LootDir, task.TaskID)
-		if err := os.MkdirAll(lootTaskDir, 0755); err != nil {
-			logger.Errorf("Error creating loot directory for task %s: %v", task.TaskID, err)
-			outputMessage = fmt.Sprintf("Failed to create loot directory: %v", err)
-			task.Status = "failed"
-			task.Output = outputMessage
-			s.Store.UpdateTask(task)
-			return &bridge.PushBeaconOutputResponse{}, nil
-		}
-		lootFilePath := filepath.Join(lootTaskDir, lootFileName)
-
-		if err := os.WriteFile(lootFilePath, in.Output, 0644); err != nil {
-			logger.Errorf("Error saving uploaded file for task %s: %v", task.TaskID, err)
+		item, err := s.LootService.SaveLoot(task, "file", task.Arguments, in.Output)
+		if err != nil {
+			logger.Ctx(ctx).Errorf("Error saving uploaded file for task %s: %v", task.TaskID, err)
 			outputMessage = fmt.Sprintf("Failed to save uploaded file: %v", err)
 
 			// Update task status to failed
 			task.Status = "failed"
 			task.Output = outputMessage
-			if err := s.Store.UpdateTask(task); err != nil {
-				logger.Errorf("Error updating task status to failed: %v", err)
+			if err := s.store(ctx).UpdateTask(task); err != nil {
+				logger.Ctx(ctx).Errorf("Error updating task status to failed: %v", err)
 			}
 
 			// Broadcast TASK_FAILED event
@@ -67,17 +127,17 @@ func (s *server) PushBeaconOutput(ctx context.Context, in *bridge.PushBeaconOutp
 			}
 			failedEventBytes, err := json.Marshal(failedEvent)
 			if err != nil {
-				logger.Errorf("Error marshalling TASK_FAILED event: %v", err)
+				logger.Ctx(ctx).Errorf("Error marshalling TASK_FAILED event: %v", err)
 			} else {
-				s.Hub.Broadcast(failedEventBytes)
-				logger.Debugf("Broadcasted TASK_FAILED event for task %s", task.TaskID)
+				s.Hub.BroadcastTo(task.Engagement, failedEventBytes)
+				logger.Ctx(ctx).Debugf("Broadcasted TASK_FAILED event for task %s", task.TaskID)
 			}
 
 			return &bridge.PushBeaconOutputResponse{}, nil
 		} else {
-			logger.Infof("Saved uploaded file to %s", lootFilePath)
-			// 返回相对路径 task_id/filename 供下载使用
-			outputMessage = filepath.Join(task.TaskID, lootFileName)
+			logger.Ctx(ctx).Infof("Saved uploaded file %s as loot %s", item.FileName, item.LootID)
+			// 返回 loot ID 供下载使用
+			outputMessage = item.LootID
 
 			// Broadcast FILE_UPLOAD_COMPLETED event
 			fileEvent := struct {
@@ -88,25 +148,26 @@ func (s *server) PushBeaconOutput(ctx context.Context, in *bridge.PushBeaconOutp
 				Payload: map[string]interface{}{
 					"task_id":       task.TaskID,
 					"beacon_id":     task.BeaconID,
-					"filename":      outputMessage, // 使用相对路径
+					"loot_id":       item.LootID,
+					"filename":      item.FileName,
 					"original_path": task.Arguments,
 				},
 			}
 			fileEventBytes, err := json.Marshal(fileEvent)
 			if err != nil {
-				logger.Errorf("Error marshalling FILE_UPLOAD_COMPLETED event: %v", err)
+				logger.Ctx(ctx).Errorf("Error marshalling FILE_UPLOAD_COMPLETED event: %v", err)
 			} else {
-				s.Hub.Broadcast(fileEventBytes)
-				logger.Debugf("Broadcasted FILE_UPLOAD_COMPLETED event for %s", lootFileName)
+				s.Hub.BroadcastTo(task.Engagement, fileEventBytes)
+				logger.Ctx(ctx).Debugf("Broadcasted FILE_UPLOAD_COMPLETED event for %s", item.FileName)
 			}
 		}
 	} else if task.Command == "exit" {
 		outputMessage = "Beacon received exit command."
 
 		// Broadcast BEACON_EXITED event
-		beacon, err := s.Store.GetBeacon(task.BeaconID)
+		beacon, err := s.store(ctx).GetBeacon(task.BeaconID)
 		if err != nil {
-			logger.Errorf("Error getting beacon %s for exit event: %v", task.BeaconID, err)
+			logger.Ctx(ctx).Errorf("Error getting beacon %s for exit event: %v", task.BeaconID, err)
 		} else {
 			exitedEvent := struct {
 				Type    string      `json:"type"`
@@ -117,29 +178,22 @@ func (s *server) PushBeaconOutput(ctx context.Context, in *bridge.PushBeaconOutp
 			}
 			exitedEventBytes, err := json.Marshal(exitedEvent)
 			if err != nil {
-				logger.Errorf("Error marshalling BEACON_EXITED event: %v", err)
+				logger.Ctx(ctx).Errorf("Error marshalling BEACON_EXITED event: %v", err)
 			} else {
-				s.Hub.Broadcast(exitedEventBytes)
-				logger.Infof("Broadcasted BEACON_EXITED event for %s", beacon.BeaconID)
+				s.Hub.BroadcastTo(task.Engagement, exitedEventBytes)
+				logger.Ctx(ctx).Infof("Broadcasted BEACON_EXITED event for %s", beacon.BeaconID)
 			}
 		}
 	} else if task.Command == "screenshot" {
 		// 保存截图到 loot 目录
-		screenshotFileName := "screenshot.png"
-		lootTaskDir := filepath.Join(s.Config.LootDir, task.TaskID)
-		if err := os.MkdirAll(lootTaskDir, 0755); err != nil {
-			logger.Errorf("Error creating loot directory for screenshot task %s: %v", task.TaskID, err)
+		item, err := s.LootService.SaveLoot(task, "screenshot", "screenshot.png", in.Output)
+		if err != nil {
+			logger.Ctx(ctx).Errorf("Error saving screenshot for task %s: %v", task.TaskID, err)
 			outputMessage = fmt.Sprintf("Failed to save screenshot: %v", err)
 		} else {
-			lootFilePath := filepath.Join(lootTaskDir, screenshotFileName)
-			if err := os.WriteFile(lootFilePath, in.Output, 0644); err != nil {
-				logger.Errorf("Error saving screenshot for task %s: %v", task.TaskID, err)
-				outputMessage = fmt.Sprintf("Failed to save screenshot: %v", err)
-			} else {
-				logger.Infof("Saved screenshot to %s", lootFilePath)
-				// 返回相对路径供 WebUI 获取
-				outputMessage = filepath.Join(task.TaskID, screenshotFileName)
-			}
+			logger.Ctx(ctx).Infof("Saved screenshot as loot %s", item.LootID)
+			// 返回 loot ID 供 WebUI 获取
+			outputMessage = item.LootID
 		}
 	} else if task.Command == "download" {
 		// For download command, get the completion message
@@ -167,10 +221,10 @@ func (s *server) PushBeaconOutput(ctx context.Context, in *bridge.PushBeaconOutp
 			}
 			completedEventBytes, err := json.Marshal(completedEvent)
 			if err != nil {
-				logger.Errorf("Error marshalling FILE_DOWNLOAD_COMPLETED event: %v", err)
+				logger.Ctx(ctx).Errorf("Error marshalling FILE_DOWNLOAD_COMPLETED event: %v", err)
 			} else {
-				s.Hub.Broadcast(completedEventBytes)
-				logger.Debugf("Broadcasted FILE_DOWNLOAD_COMPLETED event for %s", task.TaskID)
+				s.Hub.BroadcastTo(task.Engagement, completedEventBytes)
+				logger.Ctx(ctx).Debugf("Broadcasted FILE_DOWNLOAD_COMPLETED event for %s", task.TaskID)
 			}
 
 			// Check if download was not successful
@@ -178,8 +232,8 @@ func (s *server) PushBeaconOutput(ctx context.Context, in *bridge.PushBeaconOutp
 				// Update task status to failed
 				task.Status = "failed"
 				task.Output = outputMessage
-				if err := s.Store.UpdateTask(task); err != nil {
-					logger.Errorf("Error updating task status to failed: %v", err)
+				if err := s.store(ctx).UpdateTask(task); err != nil {
+					logger.Ctx(ctx).Errorf("Error updating task status to failed: %v", err)
 				}
 
 				// Broadcast TASK_FAILED event
@@ -197,22 +251,30 @@ func (s *server) PushBeaconOutput(ctx context.Context, in *bridge.PushBeaconOutp
 				}
 				failedEventBytes, err := json.Marshal(failedEvent)
 				if err != nil {
-					logger.Errorf("Error marshalling TASK_FAILED event: %v", err)
+					logger.Ctx(ctx).Errorf("Error marshalling TASK_FAILED event: %v", err)
 				} else {
-					s.Hub.Broadcast(failedEventBytes)
-					logger.Debugf("Broadcasted TASK_FAILED event for task %s", task.TaskID)
+					s.Hub.BroadcastTo(task.Engagement, failedEventBytes)
+					logger.Ctx(ctx).Debugf("Broadcasted TASK_FAILED event for task %s", task.TaskID)
+				}
+			} else {
+				var downloadArgs struct {
+					Source string `json:"source"`
+				}
+				destination, _ := downloadResult["destination"].(string)
+				if err := json.Unmarshal([]byte(task.Arguments), &downloadArgs); err == nil {
+					s.recordDroppedFile(ctx, task, "dropped_file", downloadArgs.Source, destination)
 				}
 			}
 		} else {
 			// Failed to parse download result
-			logger.Errorf("Failed to parse download result for task %s: %v", task.TaskID, err)
+			logger.Ctx(ctx).Errorf("Failed to parse download result for task %s: %v", task.TaskID, err)
 			outputMessage = fmt.Sprintf("Failed to parse download result: %v", err)
 
 			// Update task status to failed
 			task.Status = "failed"
 			task.Output = outputMessage
-			if err := s.Store.UpdateTask(task); err != nil {
-				logger.Errorf("Error updating task status to failed: %v", err)
+			if err := s.store(ctx).UpdateTask(task); err != nil {
+				logger.Ctx(ctx).Errorf("Error updating task status to failed: %v", err)
 			}
 
 			// Broadcast TASK_FAILED event
@@ -230,63 +292,54 @@ func (s *server) PushBeaconOutput(ctx context.Context, in *bridge.PushBeaconOutp
 			}
 			failedEventBytes, err := json.Marshal(failedEvent)
 			if err != nil {
-				logger.Errorf("Error marshalling TASK_FAILED event: %v", err)
+				logger.Ctx(ctx).Errorf("Error marshalling TASK_FAILED event: %v", err)
 			} else {
-				s.Hub.Broadcast(failedEventBytes)
-				logger.Debugf("Broadcasted TASK_FAILED event for task %s", task.TaskID)
+				s.Hub.BroadcastTo(task.Engagement, failedEventBytes)
+				logger.Ctx(ctx).Debugf("Broadcasted TASK_FAILED event for task %s", task.TaskID)
 			}
 
 			return &bridge.PushBeaconOutputResponse{}, nil
 		}
 	} else {
-		if utf8.Valid(in.Output) {
-			outputMessage = string(in.Output)
-		} else {
-			decoder := simplifiedchinese.GBK.NewDecoder()
-			utf8Bytes, _, err := transform.Bytes(decoder, in.Output)
-			if err == nil {
-				outputMessage = string(utf8Bytes)
-			} else {
-				outputMessage = strings.ToValidUTF8(string(in.Output), "\uFFFD")
-			}
-		}
+		outputMessage = decodeTaskOutput(in.Output)
 	}
 
 	task.Status = "completed"
-	task.Output = outputMessage
-	if err := s.Store.UpdateTask(task); err != nil {
-		logger.Errorf("Error updating task output: %v", err)
+	task.OutputType = commands.OutputTypeOf(task.Command, outputMessage)
+	s.setTaskOutput(ctx, task, outputMessage)
+	if err := s.store(ctx).UpdateTask(task); err != nil {
+		logger.Ctx(ctx).Errorf("Error updating task output: %v", err)
 		return nil, err
 	}
 
 	// After updating the task, check for side effects
 	if task.Command == "sleep" {
-		logger.Infof("Processing side effects for sleep task %s. Arguments: '%s'", task.TaskID, task.Arguments)
+		logger.Ctx(ctx).Infof("Processing side effects for sleep task %s. Arguments: '%s'", task.TaskID, task.Arguments)
 		args := strings.Fields(strings.TrimSpace(task.Arguments))
 		if len(args) > 0 {
 			newSleep, err := strconv.Atoi(args[0])
 			if err != nil {
-				logger.Errorf("Failed to parse sleep argument '%s' as int: %v", args[0], err)
+				logger.Ctx(ctx).Errorf("Failed to parse sleep argument '%s' as int: %v", args[0], err)
 			} else {
 				newJitter := 0
 				if len(args) > 1 {
 					if j, err := strconv.Atoi(args[1]); err == nil {
 						newJitter = j
 					} else {
-						logger.Warnf("Failed to parse jitter argument '%s' as int: %v", args[1], err)
+						logger.Ctx(ctx).Warnf("Failed to parse jitter argument '%s' as int: %v", args[1], err)
 					}
 				}
 
-				beacon, err := s.Store.GetBeacon(task.BeaconID)
+				beacon, err := s.store(ctx).GetBeacon(task.BeaconID)
 				if err != nil {
-					logger.Errorf("Error getting beacon %s for sleep update: %v", task.BeaconID, err)
+					logger.Ctx(ctx).Errorf("Error getting beacon %s for sleep update: %v", task.BeaconID, err)
 				} else {
 					beacon.Sleep = newSleep
 					beacon.Jitter = newJitter
-					if err := s.Store.UpdateBeacon(beacon); err != nil {
-						logger.Errorf("Error updating beacon %s sleep interval: %v", task.BeaconID, err)
+					if err := s.store(ctx).UpdateBeacon(beacon); err != nil {
+						logger.Ctx(ctx).Errorf("Error updating beacon %s sleep interval: %v", task.BeaconID, err)
 					} else {
-						logger.Infof("Successfully updated beacon %s sleep to %d (jitter: %d%%)", beacon.BeaconID, beacon.Sleep, beacon.Jitter)
+						logger.Ctx(ctx).Infof("Successfully updated beacon %s sleep to %d (jitter: %d%%)", beacon.BeaconID, beacon.Sleep, beacon.Jitter)
 						// Broadcast the beacon metadata update event
 						beaconUpdateEvent := struct {
 							Type    string      `json:"type"`
@@ -297,15 +350,55 @@ func (s *server) PushBeaconOutput(ctx context.Context, in *bridge.PushBeaconOutp
 						}
 						beaconEventBytes, err := json.Marshal(beaconUpdateEvent)
 						if err != nil {
-							logger.Errorf("Error marshalling beacon update event: %v", err)
+							logger.Ctx(ctx).Errorf("Error marshalling beacon update event: %v", err)
 						} else {
-							s.Hub.Broadcast(beaconEventBytes)
-							logger.Infof("Broadcasted BEACON_METADATA_UPDATED event for %s", beacon.BeaconID)
+							s.Hub.BroadcastTo(task.Engagement, beaconEventBytes)
+							logger.Ctx(ctx).Infof("Broadcasted BEACON_METADATA_UPDATED event for %s", beacon.BeaconID)
 						}
 					}
 				}
 			}
 		}
+		// Settings requested through the API are confirmed now the beacon ran the task
+		s.resolveBeaconSettings(ctx, task)
+	} else if task.Command == "hibernate" {
+		until, err := commands.ParseHibernateUntil(task.Arguments)
+		if err != nil {
+			logger.Ctx(ctx).Errorf("Failed to parse hibernate argument '%s': %v", task.Arguments, err)
+		} else {
+			beacon, err := s.store(ctx).GetBeacon(task.BeaconID)
+			if err != nil {
+				logger.Ctx(ctx).Errorf("Error getting beacon %s for hibernate update: %v", task.BeaconID, err)
+			} else {
+				beacon.HibernateUntil = &until
+				beacon.Status = "hibernating"
+				if err := s.store(ctx).UpdateBeacon(beacon); err != nil {
+					logger.Ctx(ctx).Errorf("Error updating beacon %s hibernation: %v", task.BeaconID, err)
+				} else {
+					logger.Ctx(ctx).Infof("Beacon %s is hibernating until %s", beacon.BeaconID, until.Format(time.RFC3339))
+					beaconUpdateEvent := struct {
+						Type    string      `json:"type"`
+						Payload interface{} `json:"payload"`
+					}{
+						Type:    "BEACON_METADATA_UPDATED",
+						Payload: beacon,
+					}
+					beaconEventBytes, err := json.Marshal(beaconUpdateEvent)
+					if err != nil {
+						logger.Ctx(ctx).Errorf("Error marshalling beacon update event: %v", err)
+					} else {
+						s.Hub.BroadcastTo(task.Engagement, beaconEventBytes)
+						logger.Ctx(ctx).Infof("Broadcasted BEACON_METADATA_UPDATED event for %s", beacon.BeaconID)
+					}
+				}
+			}
+		}
+	} else if task.Command == "shell" {
+		// Neighbour tables from discovery commands such as "arp -a" feed the host inventory.
+		// Discovery parses the full output, not the preview of an offloaded one
+		full := *task
+		full.Output = outputMessage
+		s.discoverHosts(&full)
 	}
 
 	// Broadcast the task update event via WebSocket
@@ -318,11 +411,118 @@ func (s *server) PushBeaconOutput(ctx context.Context, in *bridge.PushBeaconOutp
 	}
 	eventBytes, err := json.Marshal(event)
 	if err != nil {
-		logger.Errorf("Error marshalling task output event: %v", err)
+		logger.Ctx(ctx).Errorf("Error marshalling task output event: %v", err)
+	} else {
+		s.Hub.BroadcastTo(task.Engagement, eventBytes)
+		logger.Ctx(ctx).Infof("Broadcasted TASK_OUTPUT event for %s", task.TaskID)
+	}
+
+	return &bridge.PushBeaconOutputResponse{}, nil
+}
+
+// recordDroppedFile adds a file placed on a target by a beacon to the artifact manifest.
+// localPath is the server-side copy the hashes are computed from.
+func (s *server) recordDroppedFile(ctx context.Context, task *data.Task, artifactType, localPath, remotePath string) {
+	artifact := &data.Artifact{
+		Type:       artifactType,
+		BeaconID:   task.BeaconID,
+		TaskID:     task.TaskID,
+		FileName:   filepath.Base(localPath),
+		Path:       remotePath,
+		Engagement: task.Engagement,
+	}
+	if beacon, err := s.store(ctx).GetBeacon(task.BeaconID); err == nil {
+		artifact.Hostname = beacon.Hostname
+	}
+	if err := s.ArtifactService.RecordArtifact(context.Background(), artifact, localPath); err != nil {
+		logger.Ctx(ctx).Errorf("Failed to record artifact for task %s: %v", task.TaskID, err)
+		return
+	}
+	logger.Ctx(ctx).Infof("Recorded %s artifact %s for beacon %s", artifactType, remotePath, task.BeaconID)
+}
+
+// handleTaskProgress appends interim output to a running task and streams it to the hub.
+// The final output later replaces the accumulated progress with the complete result.
+func (s *server) handleTaskProgress(ctx context.Context, task *data.Task, in *bridge.PushBeaconOutputRequest) (*bridge.PushBeaconOutputResponse, error) {
+	if task.Status != "dispatched" && task.Status != "running" {
+		logger.Ctx(ctx).Warnf("Ignoring progress for task %s in state '%s'", task.TaskID, task.Status)
+		return &bridge.PushBeaconOutputResponse{}, nil
+	}
+
+	chunk := decodeTaskOutput(in.Output)
+	task.Status = "running"
+	task.Output += chunk
+	if err := s.store(ctx).UpdateTask(task); err != nil {
+		logger.Ctx(ctx).Errorf("Error appending progress to task %s: %v", task.TaskID, err)
+		return nil, err
+	}
+
+	progressEvent := struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}{
+		Type: "TASK_PROGRESS",
+		Payload: map[string]interface{}{
+			"task_id":   task.TaskID,
+			"beacon_id": task.BeaconID,
+			"command":   task.Command,
+			"output":    chunk,
+		},
+	}
+	progressEventBytes, err := json.Marshal(progressEvent)
+	if err != nil {
+		logger.Ctx(ctx).Errorf("Error marshalling TASK_PROGRESS event: %v", err)
 	} else {
-		s.Hub.Broadcast(eventBytes)
-		logger.Infof("Broadcasted TASK_OUTPUT event for %s", task.TaskID)
+		s.Hub.BroadcastTo(task.Engagement, progressEventBytes)
+		logger.Ctx(ctx).Debugf("Broadcasted TASK_PROGRESS event for %s", task.TaskID)
 	}
 
 	return &bridge.PushBeaconOutputResponse{}, nil
 }
+
+// decodeTaskOutput converts raw beacon output to a UTF-8 string, falling back to GBK for Windows consoles.
+func decodeTaskOutput(output []byte) string {
+	if utf8.Valid(output) {
+		return string(output)
+	}
+	decoder := simplifiedchinese.GBK.NewDecoder()
+	utf8Bytes, _, err := transform.Bytes(decoder, output)
+	if err == nil {
+		return string(utf8Bytes)
+	}
+	return strings.ToValidUTF8(string(output), "\uFFFD")
+}
+
+// setTaskOutput sets the final output of a task. An output over the configured size is stored as a
+// "task_output" loot item and only a preview is kept in the task; if it can't be stored, e.g. when
+// the engagement is over its loot quota, the full output stays in the task.
+func (s *server) setTaskOutput(ctx context.Context, task *data.Task, output string) {
+	task.Output = output
+	task.OutputLootID = ""
+	task.OutputSize = 0
+	limit := s.Config.Tasks.GetMaxOutputSize()
+	if limit == 0 || len(output) <= limit {
+		return
+	}
+
+	item, err := s.LootService.SaveLoot(task, "task_output", task.TaskID+".txt", []byte(output))
+	if err != nil {
+		logger.Ctx(ctx).Warnf("Failed to store the %d-byte output of task %s as loot, keeping it in the database: %v", len(output), task.TaskID, err)
+		return
+	}
+	task.Output = outputPreview(output, min(s.Config.Tasks.GetOutputPreviewSize(), limit))
+	task.OutputLootID = item.LootID
+	task.OutputSize = int64(len(output))
+	logger.Ctx(ctx).Infof("Stored the %d-byte output of task %s as loot %s", len(output), task.TaskID, item.LootID)
+}
+
+// outputPreview returns the first size bytes of output, cut at the start of a character.
+func outputPreview(output string, size int) string {
+	if len(output) <= size {
+		return output
+	}
+	for size > 0 && !utf8.RuneStart(output[size]) {
+		size--
+	}
+	return output[:size]
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+)
+
+// recordBeaconHost adds the host a beacon runs on to the host inventory and broadcasts HOSTS_UPDATED.
+func (s *server) recordBeaconHost(beacon *data.Beacon) {
+	host, err := s.HostService.RecordBeaconHost(beacon)
+	if err != nil {
+		logger.Errorf("Error recording host of beacon %s: %v", beacon.BeaconID, err)
+		return
+	}
+	if host == nil {
+		return
+	}
+	s.broadcastEvent(beacon.Engagement, "HOSTS_UPDATED", map[string]interface{}{
+		"beacon_id": beacon.BeaconID,
+		"addresses": []string{host.Address},
+	})
+}
+
+// discoverHosts records the hosts found in the output of a discovery task and broadcasts HOSTS_UPDATED.
+func (s *server) discoverHosts(task *data.Task) {
+	hosts, err := s.HostService.DiscoverHosts(task)
+	if err != nil {
+		logger.Errorf("Error recording hosts discovered by task %s: %v", task.TaskID, err)
+	}
+	if len(hosts) == 0 {
+		return
+	}
+
+	addresses := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		addresses = append(addresses, host.Address)
+	}
+	logger.Infof("Task %s of beacon %s discovered %d hosts", task.TaskID, task.BeaconID, len(hosts))
+	s.broadcastEvent(task.Engagement, "HOSTS_UPDATED", map[string]interface{}{
+		"beacon_id": task.BeaconID,
+		"task_id":   task.TaskID,
+		"addresses": addresses,
+	})
+}
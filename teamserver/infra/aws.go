@@ -0,0 +1,155 @@
+package infra
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"simplec2/pkg/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// awsUbuntuImage resolves to the current Ubuntu 24.04 AMI of the instance's region.
+const awsUbuntuImage = "resolve:ssm:/aws/service/canonical/ubuntu/server/24.04/stable/current/amd64/hvm/ebs-gp3/ami-id"
+
+// awsProvider creates EC2 instances. Credentials come from the usual AWS configuration:
+// environment, shared config files, or the instance or task role. Instances are identified as
+// "<region>/<instance ID>", as the region may differ between requests.
+type awsProvider struct {
+	client   *ec2.Client
+	cfg      *config.CloudProviderConfig
+	defaults ServerSpec
+	sshUser  string
+}
+
+func newAWSProvider(ctx context.Context, cfg *config.CloudProviderConfig) (*awsProvider, error) {
+	var options []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		options = append(options, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	region := awsCfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &awsProvider{
+		client:   ec2.NewFromConfig(awsCfg),
+		cfg:      cfg,
+		defaults: configuredDefaults(cfg, region, "t3.micro", awsUbuntuImage),
+		sshUser:  cfg.GetSSHUser(config.ProviderAWS),
+	}, nil
+}
+
+func (p *awsProvider) Name() string {
+	return config.ProviderAWS
+}
+
+func (p *awsProvider) Defaults() ServerSpec {
+	return p.defaults
+}
+
+func (p *awsProvider) SSHUser() string {
+	return p.sshUser
+}
+
+// inRegion returns the client options selecting a region.
+func inRegion(region string) func(*ec2.Options) {
+	return func(o *ec2.Options) {
+		o.Region = region
+	}
+}
+
+func (p *awsProvider) Create(ctx context.Context, spec ServerSpec) (string, error) {
+	spec = spec.WithDefaults(p.defaults)
+	tags := []types.Tag{{Key: aws.String("Name"), Value: aws.String(spec.Name)}}
+	keys := make([]string, 0, len(spec.Labels))
+	for key := range spec.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(spec.Labels[key])})
+	}
+
+	input := &ec2.RunInstancesInput{
+		ImageId:          aws.String(spec.Image),
+		InstanceType:     types.InstanceType(spec.Size),
+		MinCount:         aws.Int32(1),
+		MaxCount:         aws.Int32(1),
+		UserData:         aws.String(base64.StdEncoding.EncodeToString([]byte(spec.UserData))),
+		SecurityGroupIds: p.cfg.SecurityGroupIDs,
+		TagSpecifications: []types.TagSpecification{
+			{ResourceType: types.ResourceTypeInstance, Tags: tags},
+		},
+		// The user data holds the server's SSH host key, only IMDSv2 may read it
+		MetadataOptions: &types.InstanceMetadataOptionsRequest{HttpTokens: types.HttpTokensStateRequired},
+	}
+	if p.cfg.SubnetID != "" {
+		input.SubnetId = aws.String(p.cfg.SubnetID)
+	}
+	out, err := p.client.RunInstances(ctx, input, inRegion(spec.Region))
+	if err != nil {
+		return "", fmt.Errorf("failed to run instance: %w", err)
+	}
+	if len(out.Instances) == 0 || out.Instances[0].InstanceId == nil {
+		return "", fmt.Errorf("failed to run instance: no instance returned")
+	}
+	return spec.Region + "/" + *out.Instances[0].InstanceId, nil
+}
+
+// parseID splits the ID of an instance into its region and instance ID.
+func (p *awsProvider) parseID(id string) (string, string, error) {
+	region, instanceID, ok := strings.Cut(id, "/")
+	if !ok || region == "" || instanceID == "" {
+		return "", "", fmt.Errorf("invalid instance ID '%s'", id)
+	}
+	return region, instanceID, nil
+}
+
+func (p *awsProvider) Get(ctx context.Context, id string) (*Server, error) {
+	region, instanceID, err := p.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	out, err := p.client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}}, inRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe instance %s: %w", instanceID, err)
+	}
+	for _, reservation := range out.Reservations {
+		for _, instance := range reservation.Instances {
+			server := &Server{ID: id, Running: instance.State != nil && instance.State.Name == types.InstanceStateNameRunning}
+			if instance.PublicIpAddress != nil {
+				server.PublicIP = *instance.PublicIpAddress
+			}
+			return server, nil
+		}
+	}
+	return nil, fmt.Errorf("instance %s does not exist", instanceID)
+}
+
+func (p *awsProvider) Delete(ctx context.Context, id string) error {
+	region, instanceID, err := p.parseID(id)
+	if err != nil {
+		return err
+	}
+	_, err = p.client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{InstanceIds: []string{instanceID}}, inRegion(region))
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidInstanceID.NotFound" {
+			return nil
+		}
+		return fmt.Errorf("failed to terminate instance %s: %w", instanceID, err)
+	}
+	return nil
+}
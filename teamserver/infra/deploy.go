@@ -0,0 +1,109 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// validUnitName matches listener names usable in a systemd unit and directory name.
+var validUnitName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// listenerUnit is the systemd unit running a deployed listener. It runs as root to bind
+// privileged ports, but may only write to its own directory.
+const listenerUnit = `[Unit]
+Description=Listener %[1]s
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+WorkingDirectory=%[2]s
+ExecStart=%[2]s/listener -config listener.yaml
+Restart=always
+RestartSec=5
+NoNewPrivileges=yes
+PrivateTmp=yes
+ProtectSystem=strict
+ProtectHome=yes
+ReadWritePaths=%[2]s
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// ListenerDeployment is what is installed on a server to run a listener.
+type ListenerDeployment struct {
+	Name   string            // Listener name, also names the systemd unit
+	Binary []byte            // Listener executable built for the server
+	Files  map[string][]byte // Configuration and certificates, relative to the install directory
+}
+
+// CheckListenerName checks that a listener name can name a systemd unit and its directory.
+func CheckListenerName(name string) error {
+	if !validUnitName.MatchString(name) {
+		return fmt.Errorf("listener name '%s' cannot name a systemd unit", name)
+	}
+	return nil
+}
+
+// ListenerUnitName returns the name of the systemd unit of a deployed listener.
+func ListenerUnitName(name string) string {
+	return "listener-" + name
+}
+
+// ListenerInstallDir returns the directory a listener is deployed to.
+func ListenerInstallDir(name string) string {
+	return "/opt/" + ListenerUnitName(name)
+}
+
+// DeployListener installs a listener on a server as a systemd service and restarts it. Deploying
+// again replaces the executable and the files of an earlier deployment.
+func DeployListener(ctx context.Context, client *SSHClient, deployment *ListenerDeployment) error {
+	if err := CheckListenerName(deployment.Name); err != nil {
+		return err
+	}
+	unit := ListenerUnitName(deployment.Name)
+	dir := ListenerInstallDir(deployment.Name)
+
+	if err := client.WriteFile(ctx, path.Join(dir, "listener"), deployment.Binary, 0700); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(deployment.Files))
+	for name := range deployment.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		filePath := path.Join(dir, name)
+		if !strings.HasPrefix(filePath, dir+"/") {
+			return fmt.Errorf("file '%s' is outside of the install directory", name)
+		}
+		if err := client.WriteFile(ctx, filePath, deployment.Files[name], 0600); err != nil {
+			return err
+		}
+	}
+
+	unitFile := fmt.Sprintf(listenerUnit, deployment.Name, dir)
+	if err := client.WriteFile(ctx, "/etc/systemd/system/"+unit+".service", []byte(unitFile), 0644); err != nil {
+		return err
+	}
+	command := fmt.Sprintf("systemctl daemon-reload && systemctl enable %[1]s && systemctl restart %[1]s", shellQuote(unit))
+	if output, err := client.Run(ctx, command); err != nil {
+		return fmt.Errorf("failed to start %s: %w: %s", unit, err, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// ListenerLogs returns the last lines the systemd unit of a deployed listener logged, to tell why
+// it doesn't run.
+func ListenerLogs(ctx context.Context, client *SSHClient, name string, lines int) (string, error) {
+	command := fmt.Sprintf("journalctl -u %s -n %d --no-pager", shellQuote(ListenerUnitName(name)), lines)
+	output, err := client.Run(ctx, command)
+	if err != nil {
+		return "", fmt.Errorf("failed to read logs of %s: %w: %s", ListenerUnitName(name), err, strings.TrimSpace(output))
+	}
+	return strings.TrimSpace(output), nil
+}
@@ -0,0 +1,96 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"simplec2/pkg/config"
+
+	"github.com/digitalocean/godo"
+)
+
+// digitalOceanProvider creates droplets.
+type digitalOceanProvider struct {
+	client   *godo.Client
+	defaults ServerSpec
+	sshUser  string
+}
+
+func newDigitalOceanProvider(cfg *config.CloudProviderConfig) (*digitalOceanProvider, error) {
+	token := cfg.GetToken(config.ProviderDigitalOcean)
+	if token == "" {
+		return nil, fmt.Errorf("no DigitalOcean API token configured")
+	}
+	return &digitalOceanProvider{
+		client:   godo.NewFromToken(token),
+		defaults: configuredDefaults(cfg, "fra1", "s-1vcpu-1gb", "ubuntu-24-04-x64"),
+		sshUser:  cfg.GetSSHUser(config.ProviderDigitalOcean),
+	}, nil
+}
+
+func (p *digitalOceanProvider) Name() string {
+	return config.ProviderDigitalOcean
+}
+
+func (p *digitalOceanProvider) Defaults() ServerSpec {
+	return p.defaults
+}
+
+func (p *digitalOceanProvider) SSHUser() string {
+	return p.sshUser
+}
+
+func (p *digitalOceanProvider) Create(ctx context.Context, spec ServerSpec) (string, error) {
+	spec = spec.WithDefaults(p.defaults)
+	// Droplet tags have no values, labels become "key:value" tags
+	var tags []string
+	for key, value := range spec.Labels {
+		tags = append(tags, key+":"+value)
+	}
+	sort.Strings(tags)
+	droplet, _, err := p.client.Droplets.Create(ctx, &godo.DropletCreateRequest{
+		Name:     spec.Name,
+		Region:   spec.Region,
+		Size:     spec.Size,
+		Image:    godo.DropletCreateImage{Slug: spec.Image},
+		UserData: spec.UserData,
+		Tags:     tags,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create droplet: %w", err)
+	}
+	return strconv.Itoa(droplet.ID), nil
+}
+
+func (p *digitalOceanProvider) Get(ctx context.Context, id string) (*Server, error) {
+	dropletID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid droplet ID '%s'", id)
+	}
+	droplet, _, err := p.client.Droplets.Get(ctx, dropletID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get droplet %s: %w", id, err)
+	}
+	server := &Server{ID: id, Running: droplet.Status == "active"}
+	server.PublicIP, _ = droplet.PublicIPv4()
+	return server, nil
+}
+
+func (p *digitalOceanProvider) Delete(ctx context.Context, id string) error {
+	dropletID, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("invalid droplet ID '%s'", id)
+	}
+	if _, err := p.client.Droplets.Delete(ctx, dropletID); err != nil {
+		var errorResponse *godo.ErrorResponse
+		if errors.As(err, &errorResponse) && errorResponse.Response != nil && errorResponse.Response.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to delete droplet %s: %w", id, err)
+	}
+	return nil
+}
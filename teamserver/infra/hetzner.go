@@ -0,0 +1,91 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"simplec2/pkg/config"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// hetznerProvider creates Hetzner Cloud servers.
+type hetznerProvider struct {
+	client   *hcloud.Client
+	defaults ServerSpec
+	sshUser  string
+}
+
+func newHetznerProvider(cfg *config.CloudProviderConfig) (*hetznerProvider, error) {
+	token := cfg.GetToken(config.ProviderHetzner)
+	if token == "" {
+		return nil, fmt.Errorf("no Hetzner Cloud API token configured")
+	}
+	return &hetznerProvider{
+		client:   hcloud.NewClient(hcloud.WithToken(token)),
+		defaults: configuredDefaults(cfg, "fsn1", "cx22", "ubuntu-24.04"),
+		sshUser:  cfg.GetSSHUser(config.ProviderHetzner),
+	}, nil
+}
+
+func (p *hetznerProvider) Name() string {
+	return config.ProviderHetzner
+}
+
+func (p *hetznerProvider) Defaults() ServerSpec {
+	return p.defaults
+}
+
+func (p *hetznerProvider) SSHUser() string {
+	return p.sshUser
+}
+
+func (p *hetznerProvider) Create(ctx context.Context, spec ServerSpec) (string, error) {
+	spec = spec.WithDefaults(p.defaults)
+	result, _, err := p.client.Server.Create(ctx, hcloud.ServerCreateOpts{
+		Name:       spec.Name,
+		ServerType: &hcloud.ServerType{Name: spec.Size},
+		Image:      &hcloud.Image{Name: spec.Image},
+		Location:   &hcloud.Location{Name: spec.Region},
+		UserData:   spec.UserData,
+		Labels:     spec.Labels,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create server: %w", err)
+	}
+	return strconv.FormatInt(result.Server.ID, 10), nil
+}
+
+func (p *hetznerProvider) Get(ctx context.Context, id string) (*Server, error) {
+	serverID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server ID '%s'", id)
+	}
+	hetznerServer, _, err := p.client.Server.GetByID(ctx, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server %s: %w", id, err)
+	}
+	if hetznerServer == nil {
+		return nil, fmt.Errorf("server %s does not exist", id)
+	}
+	server := &Server{ID: id, Running: hetznerServer.Status == hcloud.ServerStatusRunning}
+	if ip := hetznerServer.PublicNet.IPv4.IP; ip != nil && !ip.IsUnspecified() {
+		server.PublicIP = ip.String()
+	}
+	return server, nil
+}
+
+func (p *hetznerProvider) Delete(ctx context.Context, id string) error {
+	serverID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid server ID '%s'", id)
+	}
+	if _, _, err := p.client.Server.DeleteWithResult(ctx, &hcloud.Server{ID: serverID}); err != nil {
+		if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete server %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Package infra provisions the callback infrastructure of an engagement: cloud servers used as
+// redirectors on DigitalOcean, AWS or Hetzner, and the listeners deployed on them over SSH.
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"simplec2/pkg/config"
+)
+
+// ErrProviderNotConfigured is returned for a cloud provider without a configuration section.
+var ErrProviderNotConfigured = errors.New("cloud provider is not configured")
+
+// ServerSpec describes a server to create.
+type ServerSpec struct {
+	Name     string
+	Region   string // Provider default if empty
+	Size     string // Provider default if empty
+	Image    string // Provider default if empty
+	UserData string // cloud-init user data, see CloudInit
+	// Labels identifying the server in the provider's console, e.g. the asset ID
+	Labels map[string]string
+}
+
+// Server is the state of a server at its provider.
+type Server struct {
+	ID       string
+	Running  bool
+	PublicIP string // Empty until the provider assigned one
+}
+
+// Provider creates and destroys servers in a cloud account.
+type Provider interface {
+	// Name returns the name of the provider, e.g. config.ProviderDigitalOcean.
+	Name() string
+
+	// Defaults returns the region, size and image used when a spec leaves them empty.
+	Defaults() ServerSpec
+
+	// SSHUser returns the user the image accepts the SSH key for.
+	SSHUser() string
+
+	// Create starts creating a server and returns its ID at the provider. The server is usually
+	// not running yet. Empty fields of the spec use the provider's defaults.
+	Create(ctx context.Context, spec ServerSpec) (string, error)
+
+	// Get returns the state of a server.
+	Get(ctx context.Context, id string) (*Server, error)
+
+	// Delete destroys a server. Destroying a server that no longer exists is not an error.
+	Delete(ctx context.Context, id string) error
+}
+
+// NewProvider creates a client of a configured cloud provider.
+func NewProvider(ctx context.Context, name string, cfg *config.InfrastructureConfig) (Provider, error) {
+	providerCfg := cfg.GetProvider(name)
+	if providerCfg == nil {
+		return nil, fmt.Errorf("%w: %s", ErrProviderNotConfigured, name)
+	}
+	switch name {
+	case config.ProviderDigitalOcean:
+		return newDigitalOceanProvider(providerCfg)
+	case config.ProviderAWS:
+		return newAWSProvider(ctx, providerCfg)
+	case config.ProviderHetzner:
+		return newHetznerProvider(providerCfg)
+	}
+	return nil, fmt.Errorf("unknown cloud provider '%s'", name)
+}
+
+// ConfiguredProviders returns the names of the providers with a configuration section, sorted.
+func ConfiguredProviders(cfg *config.InfrastructureConfig) []string {
+	names := []string{}
+	for _, name := range []string{config.ProviderDigitalOcean, config.ProviderAWS, config.ProviderHetzner} {
+		if cfg.GetProvider(name) != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configuredDefaults returns the region, size and image of a provider: the configured ones, or the
+// provider's own defaults.
+func configuredDefaults(cfg *config.CloudProviderConfig, region, size, image string) ServerSpec {
+	defaults := ServerSpec{Region: cfg.Region, Size: cfg.Size, Image: cfg.Image}
+	if defaults.Region == "" {
+		defaults.Region = region
+	}
+	if defaults.Size == "" {
+		defaults.Size = size
+	}
+	if defaults.Image == "" {
+		defaults.Image = image
+	}
+	return defaults
+}
+
+// WithDefaults fills in the region, size and image the spec leaves empty.
+func (spec ServerSpec) WithDefaults(defaults ServerSpec) ServerSpec {
+	if spec.Region == "" {
+		spec.Region = defaults.Region
+	}
+	if spec.Size == "" {
+		spec.Size = defaults.Size
+	}
+	if spec.Image == "" {
+		spec.Image = defaults.Image
+	}
+	return spec
+}
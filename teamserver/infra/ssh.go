@@ -0,0 +1,221 @@
+package infra
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// sshRetryInterval is how often WaitForSSH tries to log in to a server that is still booting.
+const sshRetryInterval = 5 * time.Second
+
+// LoadOrCreateKey reads the SSH private key the TeamServer logs in with, generating an Ed25519 key
+// at path if there is none yet.
+func LoadOrCreateKey(keyPath string) (ssh.Signer, error) {
+	keyPEM, err := os.ReadFile(keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate SSH key: %w", err)
+		}
+		block, err := ssh.MarshalPrivateKey(key, "simplec2-teamserver")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode SSH key: %w", err)
+		}
+		if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+			return nil, fmt.Errorf("failed to save SSH key: %w", err)
+		}
+		return ssh.NewSignerFromKey(key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH key %s: %w", keyPath, err)
+	}
+	return signer, nil
+}
+
+// AuthorizedKey returns a public key in the authorized_keys format, without a trailing newline.
+func AuthorizedKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+// HostKey is an SSH host key generated for a new server. It is installed through cloud-init, so
+// the first login to the server already verifies the host key instead of trusting it blindly.
+type HostKey struct {
+	PrivateKey []byte // OpenSSH PEM
+	PublicKey  string // authorized_keys format
+}
+
+// NewHostKey generates an Ed25519 host key.
+func NewHostKey() (*HostKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate host key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(private, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode host key: %w", err)
+	}
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode host key: %w", err)
+	}
+	return &HostKey{PrivateKey: pem.EncodeToMemory(block), PublicKey: AuthorizedKey(sshPublic)}, nil
+}
+
+// cloudConfig is the part of the cloud-init configuration set on new servers.
+type cloudConfig struct {
+	SSHDeleteKeys     bool              `yaml:"ssh_deletekeys"`
+	SSHGenKeyTypes    []string          `yaml:"ssh_genkeytypes"`
+	SSHKeys           map[string]string `yaml:"ssh_keys"`
+	SSHAuthorizedKeys []string          `yaml:"ssh_authorized_keys"`
+}
+
+// CloudInit returns the cloud-init user data of a new server: its host key replaces the keys of
+// the image, and the TeamServer's key is authorized for the image's default user.
+func CloudInit(hostKey *HostKey, authorizedKey ssh.PublicKey) (string, error) {
+	userData, err := yaml.Marshal(&cloudConfig{
+		SSHDeleteKeys:  true,
+		SSHGenKeyTypes: []string{},
+		SSHKeys: map[string]string{
+			"ed25519_private": string(hostKey.PrivateKey),
+			"ed25519_public":  hostKey.PublicKey,
+		},
+		SSHAuthorizedKeys: []string{AuthorizedKey(authorizedKey)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cloud-init user data: %w", err)
+	}
+	return "#cloud-config\n" + string(userData), nil
+}
+
+// SSHClient runs commands and writes files on a server.
+type SSHClient struct {
+	client *ssh.Client
+	user   string
+}
+
+// DialSSH logs in to a server, accepting only the given host key (authorized_keys format). The
+// port defaults to 22.
+func DialSSH(ctx context.Context, address, user string, auth []ssh.AuthMethod, hostKey string) (*SSHClient, error) {
+	pinned, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key: %w", err)
+	}
+	cfg := &ssh.ClientConfig{
+		User: user,
+		Auth: auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if !bytes.Equal(key.Marshal(), pinned.Marshal()) {
+				return fmt.Errorf("host key of %s does not match, got %s", hostname, ssh.FingerprintSHA256(key))
+			}
+			return nil
+		},
+		HostKeyAlgorithms: []string{pinned.Type()},
+		Timeout:           30 * time.Second,
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+	conn, err := (&net.Dialer{Timeout: cfg.Timeout}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	// The handshake has no timeout of its own
+	conn.SetDeadline(time.Now().Add(cfg.Timeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to log in to %s: %w", address, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return &SSHClient{client: ssh.NewClient(sshConn, chans, reqs), user: user}, nil
+}
+
+// WaitForSSH tries to log in to a server until it succeeds or ctx is done, for servers that are
+// still booting. The host key must match on every attempt.
+func WaitForSSH(ctx context.Context, address, user string, auth []ssh.AuthMethod, hostKey string) (*SSHClient, error) {
+	for {
+		client, err := DialSSH(ctx, address, user, auth, hostKey)
+		if err == nil {
+			return client, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("server did not accept SSH in time: %w", err)
+		case <-time.After(sshRetryInterval):
+		}
+	}
+}
+
+// Run runs a shell command, as root, and returns its combined output.
+func (c *SSHClient) Run(ctx context.Context, command string) (string, error) {
+	return c.run(ctx, command, nil)
+}
+
+// WriteFile writes a file, as root, replacing it atomically. Missing directories are created.
+func (c *SSHClient) WriteFile(ctx context.Context, filePath string, data []byte, mode os.FileMode) error {
+	tmp := filePath + ".tmp"
+	command := fmt.Sprintf("umask 077 && mkdir -p %s && cat > %s && chmod %o %s && mv -f %s %s",
+		shellQuote(path.Dir(filePath)), shellQuote(tmp), mode.Perm(), shellQuote(tmp), shellQuote(tmp), shellQuote(filePath))
+	if output, err := c.run(ctx, command, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w: %s", filePath, err, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// run runs a shell command as root, through sudo unless the user is root.
+func (c *SSHClient) run(ctx context.Context, command string, stdin []byte) (string, error) {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to open SSH session: %w", err)
+	}
+	defer session.Close()
+	if stdin != nil {
+		session.Stdin = bytes.NewReader(stdin)
+	}
+	if c.user != "root" {
+		command = "sudo -n sh -c " + shellQuote(command)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+	output, err := session.CombinedOutput(command)
+	if ctx.Err() != nil {
+		return string(output), ctx.Err()
+	}
+	return string(output), err
+}
+
+// Close closes the connection.
+func (c *SSHClient) Close() error {
+	return c.client.Close()
+}
+
+// shellQuote quotes a string for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
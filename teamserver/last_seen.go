@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+)
+
+// lastSeenBuffer holds the check-in times of beacons until they are written in a batch, so a
+// check-in that changes nothing else doesn't rewrite the whole beacon row. Reads of LastSeen lag
+// behind by at most the flush interval.
+type lastSeenBuffer struct {
+	mu      sync.Mutex
+	pending map[string]time.Time
+}
+
+// newLastSeenBuffer creates an empty buffer.
+func newLastSeenBuffer() *lastSeenBuffer {
+	return &lastSeenBuffer{pending: make(map[string]time.Time)}
+}
+
+// record buffers a check-in time. Only the latest time per beacon is kept.
+func (b *lastSeenBuffer) record(beaconID string, seen time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if seen.After(b.pending[beaconID]) {
+		b.pending[beaconID] = seen
+	}
+}
+
+// take empties the buffer and returns what it held.
+func (b *lastSeenBuffer) take() map[string]time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pending := b.pending
+	b.pending = make(map[string]time.Time)
+	return pending
+}
+
+// recordLastSeen saves the check-in time of a beacon, buffered unless batching is disabled.
+func (s *server) recordLastSeen(beaconID string, seen time.Time) {
+	if s.Config.Beacons.GetLastSeenFlush() == 0 {
+		if err := s.Store.UpdateBeaconsLastSeen(map[string]time.Time{beaconID: seen}); err != nil {
+			logger.Errorf("Error updating last seen time of beacon %s: %v", beaconID, err)
+		}
+		return
+	}
+	s.lastSeen.record(beaconID, seen)
+}
+
+// FlushLastSeen writes the buffered check-in times to the database.
+func (s *server) FlushLastSeen() {
+	pending := s.lastSeen.take()
+	if len(pending) == 0 {
+		return
+	}
+	if err := s.Store.UpdateBeaconsLastSeen(pending); err != nil {
+		logger.Errorf("Error writing last seen times of %d beacons: %v", len(pending), err)
+		// Kept for the next flush, unless a newer check-in came in meanwhile
+		for beaconID, seen := range pending {
+			s.lastSeen.record(beaconID, seen)
+		}
+	}
+}
+
+// StartLastSeenFlusher writes the buffered check-in times periodically in the background.
+func (s *server) StartLastSeenFlusher() {
+	interval := s.Config.Beacons.GetLastSeenFlush()
+	if interval == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.FlushLastSeen()
+		}
+	}()
+}
+
+// lastSeenOf returns the latest check-in time of a beacon, including a buffered one.
+func (s *server) lastSeenOf(beacon *data.Beacon) time.Time {
+	s.lastSeen.mu.Lock()
+	defer s.lastSeen.mu.Unlock()
+	if seen := s.lastSeen.pending[beacon.BeaconID]; seen.After(beacon.LastSeen) {
+		return seen
+	}
+	return beacon.LastSeen
+}
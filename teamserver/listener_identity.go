@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// listenerIdentity is who a gRPC call comes from, according to its mTLS client certificate.
+type listenerIdentity struct {
+	CommonName   string
+	SerialNumber string
+	// ListenerName is the listener the certificate was issued to.
+	ListenerName string
+}
+
+// listenerIdentityKey is the context key of the caller's listenerIdentity.
+type listenerIdentityKey struct{}
+
+// listenerIdentityFrom returns the identity NewListenerIdentityInterceptor attached to the context.
+func listenerIdentityFrom(ctx context.Context) (*listenerIdentity, bool) {
+	identity, ok := ctx.Value(listenerIdentityKey{}).(*listenerIdentity)
+	return identity, ok
+}
+
+// peerIdentity reads the verified client certificate of a call and looks up the listener it was
+// issued to. The store caches certificate records by serial number and evicts them when
+// certificates are issued or revoked, so calls don't each read the database. Certificates without
+// a record, or whose record names no listener, are refused.
+func peerIdentity(ctx context.Context, store data.DataStore) (*listenerIdentity, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "no peer information")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "no verified client certificate")
+	}
+	cert := tlsInfo.State.VerifiedChains[0][0]
+	identity := &listenerIdentity{CommonName: cert.Subject.CommonName, SerialNumber: cert.SerialNumber.String()}
+	record, err := store.GetIssuedCertificate(identity.SerialNumber)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Error(codes.Unauthenticated, "certificate was not issued to a listener")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to look up certificate: %v", err)
+	}
+	if record.ListenerName == "" {
+		return nil, status.Error(codes.Unauthenticated, "certificate was not issued to a listener")
+	}
+	identity.ListenerName = record.ListenerName
+	return identity, nil
+}
+
+// NewListenerIdentityInterceptor returns a gRPC unary server interceptor that puts the identity
+// of the calling listener, taken from its client certificate, into the handler's context.
+func NewListenerIdentityInterceptor(store data.DataStore) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		identity, err := peerIdentity(ctx, store)
+		if err != nil {
+			return nil, err
+		}
+		recordCallListener(ctx, identity)
+		return handler(context.WithValue(ctx, listenerIdentityKey{}, identity), req)
+	}
+}
+
+// NewListenerIdentityStreamInterceptor is the stream counterpart of NewListenerIdentityInterceptor.
+func NewListenerIdentityStreamInterceptor(store data.DataStore) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		identity, err := peerIdentity(ss.Context(), store)
+		if err != nil {
+			return err
+		}
+		recordCallListener(ss.Context(), identity)
+		return handler(srv, &contextStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), listenerIdentityKey{}, identity)})
+	}
+}
+
+// verifyListenerName checks that the listener name a call claims is the one its certificate was
+// issued to, so a compromised listener cannot act for another one.
+func (s *server) verifyListenerName(ctx context.Context, claimed string) error {
+	identity, ok := listenerIdentityFrom(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "unknown listener identity")
+	}
+	if identity.ListenerName != "" && identity.ListenerName == claimed {
+		return nil
+	}
+
+	s.AuditService.Alert(&service.SecurityAlert{
+		Name:     "listener_impersonation",
+		Severity: 9,
+		Message:  fmt.Sprintf("listener %s claimed to be listener '%s'", identity.ListenerName, claimed),
+		Fields: map[string]string{
+			"listener":         identity.ListenerName,
+			"claimed_listener": claimed,
+			"common_name":      identity.CommonName,
+			"serial":           identity.SerialNumber,
+		},
+	})
+	logger.Ctx(ctx).Warnf("Listener %s (certificate %s) claimed to be listener '%s'", identity.ListenerName, identity.SerialNumber, claimed)
+	return status.Errorf(codes.PermissionDenied, "certificate was not issued to listener '%s'", claimed)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+
+	"simplec2/pkg/bridge"
+	"simplec2/pkg/logger"
+)
+
+// logListenerEntries writes the log entries a listener sent with a status report to the
+// TeamServer's log, under the "listeners" component. Each entry keeps the listener's time and
+// source line in its fields.
+func logListenerEntries(ctx context.Context, listenerName string, status *bridge.ListenerStatus) {
+	if status.DroppedLogs > 0 {
+		logger.Ctx(ctx).Warnf("Listener '%s' dropped %d log entries while its control channel was down", listenerName, status.DroppedLogs)
+	}
+	for _, entry := range status.Logs {
+		fields := []interface{}{"listener", listenerName, "listener_time", entry.Time.AsTime(), "listener_caller", entry.Caller}
+		for key, value := range entry.Fields {
+			fields = append(fields, "listener_"+key, value)
+		}
+		log := logger.Ctx(ctx).With(fields...)
+		switch entry.Level {
+		case "DEBUG":
+			log.Debug(entry.Message)
+		case "INFO":
+			log.Info(entry.Message)
+		case "WARN":
+			log.Warn(entry.Message)
+		default:
+			log.Error(entry.Message)
+		}
+	}
+}
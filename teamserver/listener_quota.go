@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+
+	"simplec2/pkg/bridge"
+	"simplec2/teamserver/service"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// quotaKey is the name the quota of the calling listener is kept under: the listener its
+// certificate was issued to, or the certificate serial for certificates without a listener.
+func quotaKey(ctx context.Context) string {
+	identity, ok := listenerIdentityFrom(ctx)
+	if !ok {
+		return ""
+	}
+	if identity.ListenerName != "" {
+		return identity.ListenerName
+	}
+	return "certificate " + identity.SerialNumber
+}
+
+// messageSize returns the encoded size of a gRPC message.
+func messageSize(m interface{}) int {
+	if msg, ok := m.(proto.Message); ok {
+		return proto.Size(msg)
+	}
+	return 0
+}
+
+// NewListenerQuotaInterceptor returns a gRPC unary server interceptor that refuses calls of a
+// listener over its request rate or bandwidth quota, and delays responses over its bandwidth.
+// It must run after NewListenerIdentityInterceptor.
+func NewListenerQuotaInterceptor(quotas service.ListenerQuotaService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		key := quotaKey(ctx)
+		if !quotas.Allow(key, 1, messageSize(req)) {
+			return nil, status.Errorf(codes.ResourceExhausted, "listener %s is over its quota", key)
+		}
+		res, err := handler(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if err := quotas.WaitSend(ctx, key, messageSize(res)); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		return res, nil
+	}
+}
+
+// NewListenerQuotaStreamInterceptor is the stream counterpart of NewListenerQuotaInterceptor.
+// Opening a stream counts as a request; the messages of a stream are delayed rather than refused,
+// so a long transfer slows down instead of failing. Each message of BeaconRelay is a relayed
+// request and counts against the request rate as well.
+func NewListenerQuotaStreamInterceptor(quotas service.ListenerQuotaService) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		key := quotaKey(ss.Context())
+		if !quotas.Allow(key, 1, 0) {
+			return status.Errorf(codes.ResourceExhausted, "listener %s is over its quota", key)
+		}
+		stream := &quotaStream{ServerStream: ss, quotas: quotas, key: key}
+		if info.FullMethod == bridge.TeamServerBridgeService_BeaconRelay_FullMethodName {
+			stream.requestsPerMessage = 1
+		}
+		return handler(srv, stream)
+	}
+}
+
+// quotaStream is a server stream whose messages are taken from the quota of a listener.
+type quotaStream struct {
+	grpc.ServerStream
+	quotas             service.ListenerQuotaService
+	key                string
+	requestsPerMessage int
+}
+
+func (s *quotaStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if err := s.quotas.Wait(s.Context(), s.key, s.requestsPerMessage, messageSize(m)); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
+
+func (s *quotaStream) SendMsg(m interface{}) error {
+	if err := s.quotas.WaitSend(s.Context(), s.key, messageSize(m)); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return s.ServerStream.SendMsg(m)
+}
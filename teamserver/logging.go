@@ -0,0 +1,68 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+)
+
+// componentFiles are the files of this package that belong to a log component; the listener
+// bridge files are matched by their grpc_ prefix as well.
+var componentFiles = map[string]string{
+	"server.go":            logger.ComponentGRPC,
+	"bridge_observe.go":    logger.ComponentGRPC,
+	"relay.go":             logger.ComponentGRPC,
+	"listener_identity.go": logger.ComponentGRPC,
+	"listener_quota.go":    logger.ComponentGRPC,
+	"request_id.go":        logger.ComponentGRPC,
+	"external_c2.go":       logger.ComponentGRPC,
+	"listener_logs.go":     logger.ComponentListeners,
+	"checkin_watcher.go":   logger.ComponentServices,
+	"last_seen.go":         logger.ComponentServices,
+	"task_timeouts.go":     logger.ComponentServices,
+	"host_inventory.go":    logger.ComponentServices,
+	"status_calculator.go": logger.ComponentServices,
+}
+
+// logComponent returns the log component of a source file of the TeamServer, or "" for files
+// that only follow the global level.
+func logComponent(file string) string {
+	dir, name := path.Split(file)
+	switch {
+	case strings.HasSuffix(dir, "teamserver/api/"):
+		return logger.ComponentAPI
+	case strings.HasSuffix(dir, "teamserver/websocket/"):
+		return logger.ComponentHub
+	case strings.HasSuffix(dir, "teamserver/service/"):
+		return logger.ComponentServices
+	case strings.HasSuffix(dir, "teamserver/"):
+		if strings.HasPrefix(name, "grpc_") {
+			return logger.ComponentGRPC
+		}
+		return componentFiles[name]
+	}
+	return ""
+}
+
+// configureLogging applies the configured log levels and log file.
+func configureLogging(cfg config.LoggingConfig) error {
+	opts := logger.Options{
+		Level:       cfg.Level,
+		Components:  cfg.Components,
+		ComponentOf: logComponent,
+	}
+	if cfg.File != nil {
+		opts.File = &logger.FileOptions{
+			Path:           cfg.File.Path,
+			MaxSizeMB:      cfg.File.GetMaxSizeMB(),
+			MaxBackups:     cfg.File.MaxBackups,
+			MaxAgeDays:     cfg.File.MaxAgeDays,
+			Compress:       cfg.File.Compress,
+			RotateInterval: cfg.File.GetRotateInterval(),
+		}
+		opts.FileOnly = cfg.File.FileOnly
+	}
+	return logger.Configure(opts)
+}
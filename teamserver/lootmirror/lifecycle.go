@@ -0,0 +1,81 @@
+package lootmirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// lifecycleRuleID identifies the mirror's rule among the other rules of the bucket.
+const lifecycleRuleID = "simplec2-loot-mirror"
+
+// lifecycleRule returns the configured lifecycle rule of the prefix, or nil if none is configured.
+func (m *Mirror) lifecycleRule() *types.LifecycleRule {
+	if m.cfg.TransitionDays <= 0 && m.cfg.ExpirationDays <= 0 {
+		return nil
+	}
+	rule := &types.LifecycleRule{
+		ID:     aws.String(lifecycleRuleID),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilter{Prefix: aws.String(m.cfg.Prefix)},
+	}
+	if m.cfg.TransitionDays > 0 {
+		rule.Transitions = []types.Transition{{
+			Days:         aws.Int32(m.cfg.TransitionDays),
+			StorageClass: types.TransitionStorageClass(m.cfg.GetTransitionStorageClass()),
+		}}
+	}
+	if m.cfg.ExpirationDays > 0 {
+		rule.Expiration = &types.LifecycleExpiration{Days: aws.Int32(m.cfg.ExpirationDays)}
+	}
+	return rule
+}
+
+// applyLifecycle adds, replaces or removes the mirror's lifecycle rule, keeping the other rules
+// of the bucket.
+func (m *Mirror) applyLifecycle(ctx context.Context) error {
+	var rules []types.LifecycleRule
+	existed := false
+	current, err := m.client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(m.cfg.Bucket)})
+	if err != nil {
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "NoSuchLifecycleConfiguration" {
+			return fmt.Errorf("failed to get lifecycle configuration: %w", err)
+		}
+	} else {
+		for _, rule := range current.Rules {
+			if aws.ToString(rule.ID) == lifecycleRuleID {
+				existed = true
+				continue
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	rule := m.lifecycleRule()
+	switch {
+	case rule != nil:
+		rules = append(rules, *rule)
+	case !existed:
+		return nil
+	case len(rules) == 0:
+		if _, err := m.client.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(m.cfg.Bucket)}); err != nil {
+			return fmt.Errorf("failed to delete lifecycle configuration: %w", err)
+		}
+		return nil
+	}
+
+	_, err = m.client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(m.cfg.Bucket),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: rules},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put lifecycle configuration: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+// Package lootmirror copies collected loot to an operator-controlled S3 or MinIO bucket, so large
+// collections don't live on the TeamServer disk alone.
+//
+// Objects are sealed with the mirror key in the format of encrypted loot files before they leave
+// the TeamServer (see filecrypt.Seal); `teamserver -decrypt-mirrored <file>` decrypts a downloaded
+// object. Content is stored once under its SHA256, as in the loot directory.
+package lootmirror
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/filecrypt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// scanInterval is how often loot that isn't mirrored yet is looked for, besides on Notify.
+	scanInterval = time.Minute
+	scanBatch    = 100
+	// maxAttempts is how often a file is tried before it is left alone until the next restart.
+	maxAttempts = 5
+)
+
+// Mirror uploads loot that isn't mirrored yet in the background: new loot when it is notified,
+// and everything left over, e.g. from before the mirror was enabled or while the bucket was
+// unreachable, on a timer.
+type Mirror struct {
+	client  *s3.Client
+	cfg     *config.LootMirrorConfig
+	key     []byte
+	lootDir string
+	store   data.DataStore
+	wake    chan struct{}
+	// Failed uploads by loot path, only used by run
+	failed map[string]int
+
+	// Canceled by Close, aborting the upload in progress
+	ctx      context.Context
+	cancel   context.CancelFunc
+	finished chan struct{}
+}
+
+// New creates a mirror to the configured bucket of the files under lootDir.
+func New(ctx context.Context, cfg *config.LootMirrorConfig, lootDir string, store data.DataStore) (*Mirror, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("loot mirror bucket is required")
+	}
+	encoded, err := cfg.GetKey()
+	if err != nil {
+		return nil, err
+	}
+	key, err := filecrypt.ParseKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid loot mirror key: %w", err)
+	}
+
+	var options []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		options = append(options, awsconfig.WithRegion(cfg.Region))
+	}
+	if cfg.AccessKeyID != "" {
+		options = append(options, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")))
+	}
+	if cfg.InsecureSkipVerify {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		options = append(options, awsconfig.WithHTTPClient(&http.Client{Transport: transport}))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	if awsCfg.Region == "" {
+		// MinIO ignores the region, but requests are signed with one
+		awsCfg.Region = "us-east-1"
+	}
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+		o.UsePathStyle = cfg.PathStyle
+	})
+
+	mirrorCtx, cancel := context.WithCancel(context.Background())
+	return &Mirror{
+		ctx:      mirrorCtx,
+		cancel:   cancel,
+		client:   client,
+		cfg:      cfg,
+		key:      key,
+		lootDir:  lootDir,
+		store:    store,
+		wake:     make(chan struct{}, 1),
+		failed:   make(map[string]int),
+		finished: make(chan struct{}),
+	}, nil
+}
+
+// Start applies the lifecycle rule to the bucket and starts uploading. A bucket whose lifecycle
+// can't be changed is still mirrored to.
+func (m *Mirror) Start(ctx context.Context) {
+	if err := m.applyLifecycle(ctx); err != nil {
+		logger.Warnf("Failed to apply the loot mirror lifecycle rule to bucket %s: %v", m.cfg.Bucket, err)
+	}
+	go m.run()
+}
+
+// Notify tells the mirror that there is new loot. It never blocks.
+func (m *Mirror) Notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ObjectKey returns the key of the object a loot item's content is mirrored to.
+func (m *Mirror) ObjectKey(item *data.LootItem) string {
+	if item.SHA256 == "" {
+		// Files recorded by ImportLootDir before hashes were kept
+		return m.cfg.Prefix + filepath.ToSlash(item.Path)
+	}
+	return m.cfg.Prefix + "objects/" + item.SHA256
+}
+
+// Remove deletes the mirrored copy of a loot item's content. Callers only remove content no other
+// loot item shares.
+func (m *Mirror) Remove(ctx context.Context, item *data.LootItem) error {
+	if item.MirroredAt == nil {
+		return nil
+	}
+	_, err := m.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(m.cfg.Bucket), Key: aws.String(m.ObjectKey(item))})
+	if err != nil {
+		return fmt.Errorf("failed to delete mirrored loot: %w", err)
+	}
+	return nil
+}
+
+func (m *Mirror) run() {
+	defer close(m.finished)
+	ticker := time.NewTicker(scanInterval)
+	defer ticker.Stop()
+
+	m.scan()
+	for {
+		select {
+		case <-m.wake:
+			m.scan()
+		case <-ticker.C:
+			m.scan()
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// scan uploads every loot file that isn't mirrored yet.
+func (m *Mirror) scan() {
+	var afterID uint
+	tried := make(map[string]bool) // Loot items sharing a file are uploaded once
+	for {
+		items, err := m.store.GetUnmirroredLootItems(afterID, scanBatch)
+		if err != nil {
+			logger.Errorf("Failed to get loot to mirror: %v", err)
+			return
+		}
+		for i := range items {
+			item := &items[i]
+			afterID = item.ID
+			if tried[item.Path] || m.failed[item.Path] >= maxAttempts {
+				continue
+			}
+			tried[item.Path] = true
+			if m.ctx.Err() != nil {
+				return
+			}
+
+			if err := m.upload(item); err != nil {
+				m.failed[item.Path]++
+				if m.failed[item.Path] >= maxAttempts {
+					logger.Errorf("Failed to mirror loot %s, giving up after %d attempts: %v", item.LootID, maxAttempts, err)
+				} else {
+					logger.Warnf("Failed to mirror loot %s: %v", item.LootID, err)
+				}
+				continue
+			}
+			delete(m.failed, item.Path)
+			if err := m.store.SetLootMirrored(item.Path, time.Now()); err != nil {
+				logger.Errorf("Failed to record mirrored loot %s: %v", item.LootID, err)
+			}
+		}
+		if len(items) < scanBatch {
+			return
+		}
+	}
+}
+
+// upload seals a loot file with the mirror key into a temporary file and uploads it. The upload
+// needs a seekable body to sign it.
+func (m *Mirror) upload(item *data.LootItem) error {
+	src, err := filecrypt.Open(filepath.Join(m.lootDir, item.Path))
+	if err != nil {
+		return fmt.Errorf("failed to open loot file: %w", err)
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", "simplec2-mirror-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w, err := filecrypt.Seal(tmp, m.key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt loot file: %w", err)
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return fmt.Errorf("failed to encrypt loot file: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt loot file: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, 30*time.Minute)
+	defer cancel()
+	_, err = m.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(m.cfg.Bucket),
+		Key:         aws.String(m.ObjectKey(item)),
+		Body:        tmp,
+		ContentType: aws.String("application/octet-stream"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload to bucket %s: %w", m.cfg.Bucket, err)
+	}
+	return nil
+}
+
+// Close stops the mirror, aborting the upload in progress. What isn't mirrored yet is uploaded
+// after the next start.
+func (m *Mirror) Close() {
+	m.cancel()
+	<-m.finished
+}
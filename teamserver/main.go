@@ -1,24 +1,46 @@
 package main
 
 import(
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"flag"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"simplec2/pkg/bridge"
 	"simplec2/pkg/config"
 	"simplec2/pkg/logger"
+	"simplec2/pkg/pki"
+	"simplec2/pkg/pki/keystore"
 	"simplec2/teamserver/api"
+	"simplec2/teamserver/builder"
+	"simplec2/teamserver/commands"
 	"simplec2/teamserver/data"
+	"simplec2/teamserver/dnscanary"
+	"simplec2/teamserver/eventbus"
+	"simplec2/teamserver/lootmirror"
+	"simplec2/teamserver/metrics"
+	"simplec2/teamserver/oplog"
+	"simplec2/teamserver/secrets"
 	"simplec2/teamserver/service"
+	"simplec2/teamserver/siem"
+	"simplec2/teamserver/sso"
+	"simplec2/teamserver/tracing"
 	"simplec2/teamserver/websocket"
 
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 	"gopkg.in/yaml.v3"
 )
 
@@ -34,8 +56,30 @@ func main() {
 
 	configPath := flag.String("config", "teamserver.yaml", "Path to the TeamServer configuration file.")
 	hashPassword := flag.Bool("hash-password", false, "Hash the operator password from the config file and exit.")
+	migrateStatus := flag.Bool("migrate-status", false, "Show which database schema migrations are applied or pending and exit.")
+	migrateOnly := flag.Bool("migrate", false, "Apply pending database schema migrations and exit.")
+	restoreArchive := flag.String("restore", "", "Replace the database content with a backup archive and exit.")
+	createCA := flag.Bool("create-ca", false, "Create a CA certificate for the configured CA key and a new server certificate, then exit.")
+	encryptConfig := flag.Bool("encrypt-config", false, "Encrypt the configuration file in place with the master key from SIMC2_CONFIG_KEY or a prompt, then exit.")
+	decryptConfig := flag.Bool("decrypt-config", false, "Decrypt the configuration file in place, then exit.")
+	decryptMirrored := flag.String("decrypt-mirrored", "", "Decrypt an object downloaded from the loot mirror with the mirror key to <file>.decrypted, then exit.")
 	flag.Parse()
 
+	if *encryptConfig {
+		if err := config.EncryptConfigFile(*configPath); err != nil {
+			logger.Fatalf("Failed to encrypt configuration: %v", err)
+		}
+		logger.Infof("Encrypted %s", *configPath)
+		return
+	}
+	if *decryptConfig {
+		if err := config.DecryptConfigFile(*configPath); err != nil {
+			logger.Fatalf("Failed to decrypt configuration: %v", err)
+		}
+		logger.Infof("Decrypted %s", *configPath)
+		return
+	}
+
 	if _, err := os.Stat(*configPath); os.IsNotExist(err) {
 		logger.Infof("Configuration file not found. Generating a default one at '%s'", *configPath)
 		if err := generateDefaultConfig(*configPath); err != nil {
@@ -48,13 +92,30 @@ func main() {
 	if err := config.LoadConfig(*configPath, &cfg); err != nil {
 		logger.Fatalf("Failed to load configuration: %v", err)
 	}
+	// 按配置设置日志级别和日志文件
+	if err := configureLogging(cfg.Logging); err != nil {
+		logger.Fatalf("Invalid logging configuration: %v", err)
+	}
 	logger.Info("Configuration loaded successfully.")
 
+	if *decryptMirrored != "" {
+		output := *decryptMirrored + ".decrypted"
+		if err := decryptMirroredObject(cfg.Loot.Mirror, *decryptMirrored, output); err != nil {
+			logger.Fatalf("Failed to decrypt %s: %v", *decryptMirrored, err)
+		}
+		logger.Infof("Decrypted %s to %s", *decryptMirrored, output)
+		return
+	}
+
 	if *hashPassword {
 		if cfg.Auth.OperatorPassword == "" {
 			logger.Fatal("Operator password is not set in the configuration file.")
 		}
-		hashedPassword, err := api.HashPassword(cfg.Auth.OperatorPassword)
+		hasher, err := service.NewPasswordHasher(cfg.Auth.PasswordHashing)
+		if err != nil {
+			logger.Fatalf("Invalid password hashing configuration: %v", err)
+		}
+		hashedPassword, err := hasher.Hash(cfg.Auth.OperatorPassword)
 		if err != nil {
 			logger.Fatalf("Failed to hash password: %v", err)
 		}
@@ -62,6 +123,53 @@ func main() {
 		return
 	}
 
+	if *createCA {
+		if err := createCACertificate(cfg.GRPC.Certs.CAKey, cfg.GRPC.Certs.CACert, cfg.GRPC.Certs.ServerCert, cfg.GRPC.Certs.ServerKey); err != nil {
+			logger.Fatalf("Failed to create CA: %v", err)
+		}
+		logger.Infof("CA certificate written to %s", cfg.GRPC.Certs.CACert)
+		return
+	}
+
+	if *migrateStatus {
+		printSchemaStatus(cfg.Database)
+		return
+	}
+	if *migrateOnly {
+		if err := data.MigrateDatabase(cfg.Database); err != nil {
+			logger.Fatalf("Migration aborted: %v", err)
+		}
+		logger.Info("Database schema is up to date.")
+		return
+	}
+
+	// 可选：从 Vault 或云密钥管理服务读取密钥，取代配置文件和环境变量中的值
+	var secretStore *secrets.Store
+	if cfg.Secrets != nil {
+		var err error
+		secretStore, err = secrets.New(cfg.Secrets)
+		if err != nil {
+			logger.Fatalf("Failed to load secrets: %v", err)
+		}
+		config.SetSecretSource(secretStore.Lookup)
+		secretStore.Start()
+		logger.Infof("Secrets loaded from %s", cfg.Secrets.Provider)
+	}
+
+	// 启用 loot 和上传文件的落盘加密
+	initFileEncryption(&cfg)
+
+	// 可选：通过 OTLP 导出 OpenTelemetry trace
+	var flushTraces func(context.Context) error
+	if cfg.Tracing != nil {
+		var err error
+		flushTraces, err = tracing.Setup(context.Background(), cfg.Tracing)
+		if err != nil {
+			logger.Fatalf("Invalid tracing configuration: %v", err)
+		}
+		logger.Infof("Exporting traces to %s", cfg.Tracing.Endpoint)
+	}
+
 	// Initialize the DataStore
 	store, err := data.NewDataStore(cfg.Database)
 	if err != nil {
@@ -69,8 +177,60 @@ func main() {
 	}
 	logger.Info("Database initialized successfully.")
 
+	backupService := service.NewBackupService(store, cfg.Backup, cfg.LootDir, cfg.UploadsDir)
+	if *restoreArchive != "" {
+		report, err := backupService.RestoreArchive(context.Background(), *restoreArchive)
+		if err != nil {
+			logger.Fatalf("Failed to restore backup: %v", err)
+		}
+		logger.Infof("Restored backup taken at %s", report.CreatedAt.Format(time.RFC3339))
+		for _, file := range report.MissingFiles {
+			logger.Warnf("Missing file: %s", file)
+		}
+		for _, file := range report.ChangedFiles {
+			logger.Warnf("Changed file: %s", file)
+		}
+		return
+	}
+
 	// Create and run the WebSocket hub
 	hub := websocket.NewHub()
+	// 持久化所有事件，断线重连的客户端可以补收错过的事件
+	hub.SetEventStore(store)
+	hub.SetConfig(cfg.WebSocket)
+	if cfg.WebSocket.SlowClient != "" && cfg.WebSocket.SlowClient != cfg.WebSocket.GetSlowClient() {
+		logger.Warnf("Unknown websocket slow_client policy '%s', using '%s'", cfg.WebSocket.SlowClient, cfg.WebSocket.GetSlowClient())
+	}
+	// 可选的事件总线，多个 TeamServer 副本的 WebSocket 客户端收到相同的事件
+	var bus *eventbus.Bus
+	if cfg.EventBus != nil {
+		bus, err = eventbus.New(cfg.EventBus)
+		if err != nil {
+			logger.Fatalf("Failed to initialize event bus: %v", err)
+		}
+		hub.SetBus(bus)
+		logger.Infof("Event bus enabled (%s, channel %s)", cfg.EventBus.Type, cfg.EventBus.GetChannel())
+	}
+	// 每个广播的事件都交给通知规则匹配
+	notificationService := service.NewNotificationService(store, cfg.Notifications, hub.BroadcastTo)
+	if err := notificationService.Start(); err != nil {
+		logger.Fatalf("Failed to start notification rules: %v", err)
+	}
+	hub.AddObserver(notificationService.Notify)
+	// 可选的 oplog 导出，每个结束的任务写入 Ghostwriter 或 JSONL 文件
+	var oplogExporter *oplog.Exporter
+	if cfg.Oplog != nil {
+		oplogExporter, err = oplog.New(cfg.Oplog, store)
+		if err != nil {
+			logger.Fatalf("Failed to initialize oplog export: %v", err)
+		}
+		hub.AddObserver(oplogExporter.Observe)
+		logger.Infof("Oplog export enabled (%s)", strings.Join(oplogExporter.Destinations(), ", "))
+	}
+	// 新任务排队时通过 BeaconRelay 通知对应的 Listener，Listener 可能连接在其他副本上
+	relays := newRelayHub(store)
+	hub.AddClusterObserver(relays.Observe)
+	relays.Start()
 	go hub.Run()
 
 	// Initialize services
@@ -78,57 +238,399 @@ func main() {
 	taskService := service.NewTaskService(store)
 	listenerService := service.NewListenerService(store)
 	sessionService := service.NewSessionService(store)
+	passwordHasher, err := service.NewPasswordHasher(cfg.Auth.PasswordHashing)
+	if err != nil {
+		logger.Fatalf("Invalid password hashing configuration: %v", err)
+	}
+	operatorService := service.NewOperatorService(store, service.NewPasswordPolicy(cfg.Auth.PasswordPolicy), passwordHasher)
+	apiKeyService := service.NewAPIKeyService(store)
+	artifactService := service.NewArtifactService(store)
+	// 可选的 SIEM 转发（syslog / CEF / Splunk HEC）
+	var forwarder *siem.Forwarder
+	if cfg.SIEM != nil {
+		forwarder, err = siem.New(cfg.SIEM)
+		if err != nil {
+			logger.Fatalf("Failed to initialize SIEM forwarding: %v", err)
+		}
+		logger.Infof("SIEM forwarding enabled (%s)", cfg.SIEM.Type)
+	}
+	auditService := service.NewAuditService(store, cfg.Audit, forwarder)
+	// 可选的 DNS Canary：payload 运行时解析自己的 Canary 子域名，TeamServer 作为该域名的权威 DNS 记录引爆事件
+	var canaryDomain string
+	if cfg.DNSCanary != nil {
+		canaryDomain = cfg.DNSCanary.Domain
+	}
+	payloadService := service.NewPayloadService(store, builder.New(cfg.Builder), artifactService, canaryDomain)
+	detonationService := service.NewDetonationService(store, payloadService, hub.BroadcastTo)
+	var dnsCanary *dnscanary.Server
+	if cfg.DNSCanary != nil {
+		dnsCanary, err = dnscanary.New(cfg.DNSCanary, detonationService.RecordQuery)
+		if err != nil {
+			logger.Fatalf("Failed to initialize DNS canary server: %v", err)
+		}
+		if err := dnsCanary.Start(); err != nil {
+			logger.Fatalf("Failed to start DNS canary server: %v", err)
+		}
+		logger.Infof("DNS canary server answering for %s on %s", dnsCanary.Domain(), cfg.DNSCanary.GetListen())
+	}
+	// Listener 托管的文件通过控制通道下发，下载记录通过 WebSocket 推送
+	hostedFileService := service.NewHostedFileService(store, listenerService, payloadService, cfg.UploadsDir, hub.BroadcastTo)
+	// Canary 路径被访问时立即推送 SECURITY_ALERT，可配合通知规则转发
+	canaryService := service.NewCanaryService(store, listenerService, hub.BroadcastTo)
+
+	// upgrade 任务可以直接下发 payload builder 构建的产物
+	commands.SetPayloadPathResolver(func(payloadID string) (string, error) {
+		payload, err := payloadService.GetPayload(context.Background(), payloadID)
+		if err != nil {
+			return "", err
+		}
+		if payload.Status != "completed" {
+			return "", fmt.Errorf("payload %s is not ready (status: %s)", payloadID, payload.Status)
+		}
+		return payload.FilePath, nil
+	})
+
+	// 首次启动时由配置文件中的凭据创建初始管理员
+	adminUsername := cfg.Auth.OperatorUsername
+	if adminUsername == "" {
+		adminUsername = "admin"
+	}
+	created, err := operatorService.EnsureAdmin(context.Background(), adminUsername, cfg.Auth.OperatorPassword)
+	if err != nil {
+		logger.Fatalf("Failed to create initial admin account: %v", err)
+	}
+	if created {
+		logger.Infof("Created initial admin account '%s'", adminUsername)
+	}
+
+	// 首次启动（或升级）时创建默认 engagement，已有数据和操作员归入其中
+	engagementService := service.NewEngagementService(store)
+	if created, err := engagementService.EnsureDefault(context.Background()); err != nil {
+		logger.Fatalf("Failed to create default engagement: %v", err)
+	} else if created {
+		logger.Infof("Created engagement '%s' for existing data", service.DefaultEngagement)
+	}
+
+	burnService := service.NewBurnService(store, listenerService, auditService)
+	playbookService := service.NewPlaybookService(store)
+	hostService := service.NewHostService(store)
+	credentialService := service.NewCredentialService(store, hostService)
+	// 可选：把 loot 加密后镜像到 S3 / MinIO 存储桶
+	var lootMirror *lootmirror.Mirror
+	if cfg.Loot.Mirror != nil {
+		lootMirror, err = lootmirror.New(context.Background(), cfg.Loot.Mirror, cfg.LootDir, store)
+		if err != nil {
+			logger.Fatalf("Failed to initialize loot mirror: %v", err)
+		}
+	}
+	lootService := service.NewLootService(store, cfg.LootDir, cfg.Loot, lootMirror)
+	chatService := service.NewChatService(store)
+	reportService := service.NewReportService(store, taskService, cfg.Reports)
+	healthService := service.NewHealthService(cfg.Health)
+	// 每个 Listener 在 gRPC 桥上的请求速率和带宽配额
+	quotaService := service.NewListenerQuotaService(cfg.ListenerQuotas, auditService)
+	statsService := service.NewStatsService(store, listenerService, quotaService)
+	retentionService := service.NewRetentionService(store, cfg.Retention)
+	// 为升级前已存在的 loot 文件补建记录
+	if imported, err := lootService.ImportLootDir(); err != nil {
+		logger.Errorf("Failed to import existing loot files: %v", err)
+	} else if imported > 0 {
+		logger.Infof("Recorded %d existing loot files", imported)
+	}
+	if lootMirror != nil {
+		lootMirror.Start(context.Background())
+		logger.Infof("Loot is mirrored to bucket %s", cfg.Loot.Mirror.Bucket)
+	}
+
+	commandPolicy, err := service.NewCommandPolicy(cfg.RBAC.CommandRoles)
+	if err != nil {
+		logger.Fatalf("Invalid RBAC configuration: %v", err)
+	}
+
+	// 可选的单点登录
+	var oidcProvider *sso.OIDCProvider
+	if cfg.Auth.OIDC != nil {
+		oidcProvider, err = sso.NewOIDCProvider(context.Background(), cfg.Auth.OIDC)
+		if err != nil {
+			logger.Fatalf("Failed to initialize OIDC login: %v", err)
+		}
+		logger.Infof("OIDC login enabled (issuer: %s)", cfg.Auth.OIDC.IssuerURL)
+	}
+	var ldapAuth *sso.LDAPAuthenticator
+	if cfg.Auth.LDAP != nil {
+		ldapAuth, err = sso.NewLDAPAuthenticator(cfg.Auth.LDAP)
+		if err != nil {
+			logger.Fatalf("Failed to initialize LDAP login: %v", err)
+		}
+		logger.Infof("LDAP login enabled (%s)", cfg.Auth.LDAP.URL)
+	}
 
 	// Start session cleanup routine (run every 5 minutes)
 	sessionService.StartCleanupRoutine(5 * time.Minute)
+	// Purge (or archive) audit logs past their retention period
+	auditService.StartRetentionRoutine(time.Hour)
+	// Prune old task outputs, events and deleted beacons
+	retentionService.StartRetentionRoutine()
+	// Scheduled database backups
+	backupService.StartSchedule()
 
-	creds, err := loadTeamServerCreds(cfg.GRPC.Certs.ServerCert, cfg.GRPC.Certs.ServerKey, cfg.GRPC.Certs.CACert, func(serialNumber string) bool {
-		return listenerService.IsCertificateRevoked(serialNumber)
-	})
+	// CA 私钥可以是文件，也可以保存在 KMS 或 HSM 中，签名时远程调用
+	caKey, err := keystore.Open(cfg.GRPC.Certs.CAKey, cfg.GRPC.Certs.CACert)
+	if err != nil {
+		logger.Fatalf("Failed to open CA key: %v", err)
+	}
+	// CA 与服务端证书由 PKIService 管理，轮换 CA 时无需重启即可生效
+	pkiService, err := service.NewPKIService(store, caKey, cfg.GRPC.Certs.CACert, cfg.GRPC.Certs.ServerCert, cfg.GRPC.Certs.ServerKey)
 	if err != nil {
 		logger.Fatalf("Failed to load TLS credentials: %v", err)
 	}
+	pkiService.StartRotationRoutine(time.Minute)
+	// 根据数据库中的吊销记录签发 CRL；TLS 握手同时检查磁盘上的 CRL，即使数据库检查被绕过吊销仍然有效
+	crlPath := cfg.GRPC.Certs.CRL
+	if crlPath == "" {
+		crlPath = filepath.Join(filepath.Dir(cfg.GRPC.Certs.CACert), "crl.pem")
+	}
+	crlService := service.NewCRLService(store, pkiService, crlPath)
+	crlService.StartRefreshRoutine(time.Minute)
+	crlChecker := pki.NewCRLChecker(crlPath, pkiService.CACertificate)
+
+	// 云端重定向器：在后台创建和销毁服务器，状态变化通过 WebSocket 推送
+	infraService := service.NewInfraService(&cfg, store, listenerService, pkiService, hub.BroadcastTo)
+	// 重启前未完成的创建或销毁任务不会继续，标记为失败以便重新销毁
+	if failed, err := infraService.FailInterrupted(); err != nil {
+		logger.Errorf("Failed to check interrupted infrastructure jobs: %v", err)
+	} else if failed > 0 {
+		logger.Warnf("Marked %d interrupted infrastructure assets as failed", failed)
+	}
 
-	// 获取 API Key（优先使用加密版本）
-	apiKey, err := cfg.Auth.GetAPIKey()
+	// 从外部探测 Listener 的公网地址，可达性变化通过 WebSocket 推送
+	listenerProbeService, err := service.NewListenerProbeService(store, cfg.ListenerProbes, hub.BroadcastTo)
 	if err != nil {
+		logger.Fatalf("Failed to initialize listener probes: %v", err)
+	}
+	listenerProbeService.Start()
+
+	// Operator API client certificates share the CA but must not be usable on the listener bridge
+	creds := loadTeamServerCreds(pkiService, func(cert *x509.Certificate) bool {
+		serialNumber := cert.SerialNumber.String()
+		if crlChecker.IsRevoked(cert.SerialNumber) || listenerService.IsCertificateRevoked(serialNumber) || operatorService.IsOperatorCertificate(serialNumber) {
+			auditService.Alert(&service.SecurityAlert{
+				Name:     "listener_certificate_rejected",
+				Severity: 8,
+				Message:  "gRPC connection with a revoked or non-listener certificate rejected",
+				Fields:   map[string]string{"serial": serialNumber},
+			})
+			return true
+		}
+		return false
+	})
+
+	// 获取 API Key（优先使用密钥源，其次加密版本）；每次调用都重新读取，密钥源中轮换的 API Key 无需重启即可生效
+	if _, err := cfg.Auth.GetAPIKey(); err != nil {
 		logger.Fatalf("Failed to get API key: %v", err)
 	}
+	apiKey := func() string {
+		key, _ := cfg.Auth.GetAPIKey()
+		return key
+	}
 
 	// Correctly create the auth interceptor
-	interceptor := NewAuthInterceptor(apiKey)
+	interceptor := NewAuthInterceptor(apiKey, listenerService)
 
-	grpcServer := grpc.NewServer(
+	// Closed when the TeamServer shuts down, which ends the long-lived streams
+	stopping := make(chan struct{})
+	grpcOptions := []grpc.ServerOption{
 		grpc.Creds(creds),
-		grpc.UnaryInterceptor(interceptor),
-		grpc.MaxRecvMsgSize(100*1024*1024), // 100 MB
-	)
+		grpc.ChainUnaryInterceptor(NewRequestIDInterceptor(), NewBridgeObserveInterceptor(), NewListenerIdentityInterceptor(store), interceptor, NewListenerQuotaInterceptor(quotaService)),
+		grpc.ChainStreamInterceptor(NewRequestIDStreamInterceptor(), NewBridgeObserveStreamInterceptor(), NewListenerIdentityStreamInterceptor(store), NewAuthStreamInterceptor(apiKey, listenerService), NewListenerQuotaStreamInterceptor(quotaService), NewDrainStreamInterceptor(stopping)),
+		// Listeners keep their connection alive with pings; dead ones are detected by ours
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: grpcMinPingInterval, PermitWithoutStream: true}),
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: grpcKeepaliveTime, Timeout: grpcKeepaliveTimeout}),
+	}
+	if cfg.Tracing != nil {
+		// A span per bridge call, continuing the trace of the listener if it sends one
+		grpcOptions = append(grpcOptions, grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	}
+	grpcServer := grpc.NewServer(grpcOptions...)
 
 	// Correctly create an instance of the server struct with config, store, and hub
-	s := NewServer(&cfg, store, hub, listenerService)
+	s := NewServer(&cfg, store, hub, listenerService, hostedFileService, canaryService, payloadService, artifactService, engagementService, auditService, playbookService, hostService, lootService, taskService, relays)
 	// Correctly call the registration function with the package prefix
 	bridge.RegisterTeamServerBridgeServiceServer(grpcServer, s)
+	// Mark tasks that stopped producing output as timed out
+	s.StartTaskTimeoutRoutine(30 * time.Second)
+	// Report beacons that stop checking in
+	s.StartCheckInWatcher(15 * time.Second)
+	// Keep the persisted beacon statuses up to date
+	s.StartStatusCalculator(cfg.Beacons.GetStatusInterval())
+	// Write check-in times in batches
+	s.StartLastSeenFlusher()
 
-	go func() {
-		lis, err := net.Listen("tcp", cfg.GRPC.Port)
-		if err != nil {
-			logger.Fatalf("Failed to listen on gRPC port: %v", err)
+	// Dependencies checked by /readyz
+	var grpcBound atomic.Bool
+	healthService.AddCheck("database", store.Ping)
+	healthService.AddCheck("websocket_hub", hub.Ping)
+	if bus != nil {
+		healthService.AddCheck("event_bus", bus.Ping)
+	}
+	healthService.AddCheck("crl", func(ctx context.Context) error {
+		return crlChecker.Err()
+	})
+	healthService.AddCheck("grpc", func(ctx context.Context) error {
+		if !grpcBound.Load() {
+			return fmt.Errorf("gRPC server is not listening on %s", cfg.GRPC.Port)
 		}
+		return nil
+	})
+	if cfg.LootDir != "" {
+		healthService.AddCheck("disk_loot", service.DiskSpaceCheck(cfg.LootDir, cfg.Health.GetMinFreeDisk()))
+	}
+	if cfg.UploadsDir != "" {
+		healthService.AddCheck("disk_uploads", service.DiskSpaceCheck(cfg.UploadsDir, cfg.Health.GetMinFreeDisk()))
+	}
+
+	grpcLis, err := listen("grpc", cfg.GRPC.Port)
+	if err != nil {
+		logger.Fatalf("Failed to listen on gRPC port: %v", err)
+	}
+	go func() {
 		logger.Infof("gRPC server listening on %s", cfg.GRPC.Port)
-		if err := grpcServer.Serve(lis); err != nil {
+		grpcBound.Store(true)
+		if err := grpcServer.Serve(grpcLis); err != nil {
+			grpcBound.Store(false)
 			logger.Fatalf("Failed to serve gRPC: %v", err)
 		}
+		grpcBound.Store(false)
 	}()
 
+	apiLis, err := listen("api", cfg.API.Port)
+	if err != nil {
+		logger.Fatalf("Failed to listen on API port: %v", err)
+	}
+	router := api.NewRouter(&cfg, beaconService, taskService, listenerService, listenerProbeService, hostedFileService, canaryService, sessionService, operatorService, payloadService, detonationService, artifactService, commandPolicy, apiKeyService, auditService, engagementService, burnService, playbookService, hostService, credentialService, lootService, chatService, notificationService, reportService, healthService, statsService, backupService, retentionService, crlService, pkiService, infraService, newExternalC2(s), oidcProvider, ldapAuth, hub)
+	apiServer := &http.Server{Handler: router.Handler()}
 	go func() {
-		router := api.NewRouter(&cfg, beaconService, taskService, listenerService, sessionService, hub)
-		logger.Infof("HTTP API server listening on %s", cfg.API.Port)
-		if err := router.Run(cfg.API.Port); err != nil {
-			logger.Fatalf("Failed to run HTTP server: %v", err)
+		if cfg.API.TLS == nil {
+			logger.Infof("HTTP API server listening on %s", cfg.API.Port)
+			if err := apiServer.Serve(apiLis); err != nil && err != http.ErrServerClosed {
+				logger.Fatalf("Failed to run HTTP server: %v", err)
+			}
+			return
+		}
+
+		tlsConfig, err := loadAPITLSConfig(cfg.API.TLS, cfg.GRPC.Certs.CACert, pkiService.ClientCAs, crlChecker)
+		if err != nil {
+			logger.Fatalf("Failed to load API TLS configuration: %v", err)
+		}
+		apiServer.TLSConfig = tlsConfig
+		logger.Infof("HTTPS API server listening on %s (client certificates: %s)", cfg.API.Port, cfg.API.TLS.ClientCertMode())
+		if err := apiServer.ServeTLS(apiLis, cfg.API.TLS.CertFile, cfg.API.TLS.KeyFile); err != nil && err != http.ErrServerClosed {
+			logger.Fatalf("Failed to run HTTPS server: %v", err)
 		}
 	}()
 
-	select {}
+	// 可选：在单独的地址上提供 Prometheus 指标
+	handedOver := []string{"grpc", "api"}
+	handedOverListeners := []net.Listener{grpcLis, apiLis}
+	var metricsServer *http.Server
+	if cfg.Metrics != nil && cfg.Metrics.Address != "" {
+		metricsLis, err := listen("metrics", cfg.Metrics.Address)
+		if err != nil {
+			logger.Fatalf("Failed to listen on metrics address: %v", err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Handler: mux}
+		go func() {
+			logger.Infof("Metrics server listening on %s", cfg.Metrics.Address)
+			if err := metricsServer.Serve(metricsLis); err != nil && err != http.ErrServerClosed {
+				logger.Fatalf("Failed to run metrics server: %v", err)
+			}
+		}()
+		handedOver = append(handedOver, "metrics")
+		handedOverListeners = append(handedOverListeners, metricsLis)
+	}
+
+	// Run until asked to stop; a restart first hands the listening sockets to a new TeamServer
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append(shutdownSignals, restartSignals...)...)
+	for sig := range signals {
+		if slices.Contains(restartSignals, sig) {
+			if err := reexec(handedOver, handedOverListeners); err != nil {
+				logger.Errorf("Failed to restart: %v", err)
+				continue
+			}
+		}
+		logger.Infof("Received %s, shutting down", sig)
+		break
+	}
+	signal.Stop(signals)
+
+	shutdown([]shutdownStep{
+		{"stop API and gRPC servers", func(ctx context.Context) error {
+			return stopServers(ctx, apiServer, grpcServer, stopping)
+		}},
+		{"stop metrics server", func(ctx context.Context) error {
+			if metricsServer != nil {
+				return metricsServer.Shutdown(ctx)
+			}
+			return nil
+		}},
+		{"write check-in times", func(ctx context.Context) error {
+			s.FlushLastSeen()
+			return nil
+		}},
+		{"disconnect WebSocket clients", hub.Shutdown},
+		{"publish remaining events", func(ctx context.Context) error {
+			if bus != nil {
+				return bus.Close()
+			}
+			return nil
+		}},
+		{"write audit log", func(ctx context.Context) error {
+			auditService.Close()
+			if forwarder != nil {
+				forwarder.Close()
+			}
+			return nil
+		}},
+		{"stop loot mirror", func(ctx context.Context) error {
+			if lootMirror != nil {
+				lootMirror.Close()
+			}
+			return nil
+		}},
+		{"export oplog", func(ctx context.Context) error {
+			if oplogExporter != nil {
+				oplogExporter.Close()
+			}
+			return nil
+		}},
+		{"stop DNS canary server", func(ctx context.Context) error {
+			if dnsCanary != nil {
+				return dnsCanary.Close()
+			}
+			return nil
+		}},
+		{"close database", func(ctx context.Context) error {
+			return store.Close()
+		}},
+		{"close CA key", func(ctx context.Context) error {
+			return caKey.Close()
+		}},
+		{"close secret manager", func(ctx context.Context) error {
+			if secretStore != nil {
+				return secretStore.Close()
+			}
+			return nil
+		}},
+		{"export remaining traces", func(ctx context.Context) error {
+			if flushTraces != nil {
+				return flushTraces(ctx)
+			}
+			return nil
+		}},
+	})
 }
 
 func generateDefaultConfig(path string) error {
@@ -139,6 +641,8 @@ func generateDefaultConfig(path string) error {
 				ServerCert string `yaml:"server_cert"`
 				ServerKey  string `yaml:"server_key"`
 				CACert     string `yaml:"ca_cert"`
+				CRL        string             `yaml:"crl,omitempty"`
+				CAKey      *config.CAKeyConfig `yaml:"ca_key,omitempty"`
 			} `yaml:"certs"`
 		}{
 			Port: ":50052",
@@ -146,6 +650,8 @@ func generateDefaultConfig(path string) error {
 				ServerCert string "yaml:\"server_cert\""
 				ServerKey  string "yaml:\"server_key\""
 				CACert     string "yaml:\"ca_cert\""
+				CRL        string             "yaml:\"crl,omitempty\""
+				CAKey      *config.CAKeyConfig "yaml:\"ca_key,omitempty\""
 			}{
 				ServerCert: "./certs/server.crt",
 				ServerKey:  "./certs/server.key",
@@ -153,27 +659,48 @@ func generateDefaultConfig(path string) error {
 			},
 		},
 		API: struct {
-			Port string `yaml:"port"`
+			Port string                `yaml:"port"`
+			TLS  *config.APITLSConfig `yaml:"tls,omitempty"`
 		}{
 			Port: ":8080",
 		},
-		Database: struct {
-			Type string `yaml:"type"`
-			DSN  string `yaml:"dsn,omitempty"`
-			Path string `yaml:"path,omitempty"`
-		}{
+		Database: config.DatabaseConfig{
 			Type: "sqlite",
 			Path: "data/simplec2.db",
 		},
 		Auth: config.AuthConfig{
 			APIKey:           "SimpleC2ListenerAPIKey_CHANGE_ME",
+			OperatorUsername: "admin",
 			OperatorPassword: "SUPER_SECRET_PASSWORD_CHANGE_ME",
 			// JWT 签名密钥 - 强烈建议从环境变量读取
 			// 用于签发操作员认证令牌，必须保持机密
-			JWTSecret: "CHANGE_ME_TO_RANDOM_256_BIT_KEY",
+			JWTSecret:       "CHANGE_ME_TO_RANDOM_256_BIT_KEY",
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 7 * 24 * time.Hour,
+			PasswordPolicy: config.PasswordPolicyConfig{
+				MinLength:    12,
+				RequireUpper: true,
+				RequireLower: true,
+				RequireDigit: true,
+				HistorySize:  5,
+			},
 		},
 		LootDir:    "loot",
 		UploadsDir: "uploads",
+		Builder: config.BuilderConfig{
+			SourceDir:    ".",
+			OutputDir:    "payloads",
+			GoBinary:     "go",
+			GarbleBinary: "garble",
+			DonutBinary:  "donut",
+			DockerImage:  "golang:1.25",
+		},
+		RBAC: config.RBACConfig{
+			CommandRoles: map[string]string{
+				"shellcode": "admin",
+				"upgrade":   "admin",
+			},
+		},
 	}
 
 	data, err := yaml.Marshal(&defaultConfig)
@@ -184,26 +711,58 @@ func generateDefaultConfig(path string) error {
 	return os.WriteFile(path, data, 0644)
 }
 
-func loadTeamServerCreds(serverCert, serverKey, caCert string, checkRevocation func(serialNumber string) bool) (credentials.TransportCredentials, error) {
-	serverC, err := tls.LoadX509KeyPair(serverCert, serverKey)
+// createCACertificate writes a self-signed CA certificate for the configured CA key, for keys
+// created in a KMS or HSM, and a server certificate signed by it. The server certificate keeps
+// the names of the current one. An existing CA certificate is never overwritten.
+func createCACertificate(keyCfg *config.CAKeyConfig, caCertPath, serverCertPath, serverKeyPath string) error {
+	if _, err := os.Stat(caCertPath); err == nil {
+		return fmt.Errorf("%s already exists", caCertPath)
+	}
+	caKey, err := keystore.Open(keyCfg, caCertPath)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to open CA key: %w", err)
 	}
+	defer caKey.Close()
 
-	ca, err := os.ReadFile(caCert)
+	caCertPEM, err := pki.CreateCA(pki.CertConfig{CommonName: "SimpleC2 CA"}, caKey)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to create CA certificate: %w", err)
 	}
 
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(ca) {
-		return nil, fmt.Errorf("failed to append CA cert")
+	serverCfg := pki.CertConfig{CommonName: "localhost", IsServer: true, DNSNames: []string{"localhost"}, IPs: []net.IP{net.ParseIP("127.0.0.1")}}
+	if certPEM, err := os.ReadFile(serverCertPath); err == nil {
+		if current, err := pki.ParseCertificate(certPEM); err == nil {
+			serverCfg.CommonName = current.Subject.CommonName
+			serverCfg.DNSNames = current.DNSNames
+			serverCfg.IPs = current.IPAddresses
+		}
+	}
+	serverKeyPEM, serverCertPEM, err := pki.IssueCert(serverCfg, caCertPEM, caKey)
+	if err != nil {
+		return fmt.Errorf("failed to generate server certificate: %w", err)
 	}
 
-	config := &tls.Config{
-		Certificates: []tls.Certificate{serverC},
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-		ClientCAs:    certPool,
+	if err := os.MkdirAll(filepath.Dir(caCertPath), 0755); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	if err := pki.SavePEMFile(caCertPath, caCertPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+	if err := pki.SavePEMFile(serverKeyPath, serverKeyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write server key: %w", err)
+	}
+	if err := pki.SavePEMFile(serverCertPath, serverCertPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write server certificate: %w", err)
+	}
+	return nil
+}
+
+// loadTeamServerCreds builds the mTLS credentials of the listener bridge. The server certificate
+// and the trusted CAs are looked up for every connection, as they change when the CA is rotated.
+func loadTeamServerCreds(pkiService service.PKIService, checkRevocation func(cert *x509.Certificate) bool) credentials.TransportCredentials {
+	base := &tls.Config{
+		NextProtos: []string{"h2"},
+		ClientAuth: tls.RequireAndVerifyClientCert,
 		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
 			if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
 				return fmt.Errorf("no verified certificate chain found")
@@ -213,13 +772,82 @@ func loadTeamServerCreds(serverCert, serverKey, caCert string, checkRevocation f
 			
 			logger.Infof("Verifying certificate for connection. Serial: %s, CN: %s", serialNumber, cert.Subject.CommonName)
 
-			if checkRevocation(serialNumber) {
+			if checkRevocation(cert) {
 				logger.Warnf("Rejected connection from revoked certificate: %s (CN: %s)", serialNumber, cert.Subject.CommonName)
 				return fmt.Errorf("certificate revoked")
 			}
 			return nil
 		},
 	}
+	config := &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			connConfig := base.Clone()
+			connConfig.Certificates = []tls.Certificate{*pkiService.ServerCertificate()}
+			connConfig.ClientCAs = pkiService.ClientCAs()
+			return connConfig, nil
+		},
+	}
+
+	return credentials.NewTLS(config)
+}
+
+// loadAPITLSConfig builds the TLS configuration of the operator API.
+// Client certificates are verified against the CA and its CRL here; mapping them to operators happens per request.
+// The TeamServer's CAs are those clientCAs returns when the connection is made, as they change when the CA is rotated.
+func loadAPITLSConfig(tlsCfg *config.APITLSConfig, defaultCA string, clientCAs func() *x509.CertPool, crl *pki.CRLChecker) (*tls.Config, error) {
+	apiTLS := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	switch tlsCfg.ClientCertMode() {
+	case config.ClientCertsOff:
+		return apiTLS, nil
+	case config.ClientCertsOptional:
+		apiTLS.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.ClientCertsRequired:
+		apiTLS.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("invalid client_certs mode '%s'", tlsCfg.ClientCerts)
+	}
 
-	return credentials.NewTLS(config), nil
+	if tlsCfg.ClientCA != "" && tlsCfg.ClientCA != defaultCA {
+		ca, err := os.ReadFile(tlsCfg.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("failed to append CA cert")
+		}
+		apiTLS.ClientCAs = certPool
+		return apiTLS, nil
+	}
+
+	// The CRL only covers certificates issued by the TeamServer's CA
+	apiTLS.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+			// No client certificate, which the client_certs mode allows
+			return nil
+		}
+		cert := verifiedChains[0][0]
+		if crl.IsRevoked(cert.SerialNumber) {
+			logger.Warnf("Rejected API connection from revoked certificate: %s (CN: %s)", cert.SerialNumber, cert.Subject.CommonName)
+			return fmt.Errorf("certificate revoked")
+		}
+		return nil
+	}
+	// The config returned per connection is used as is, so it needs the certificate ServeTLS would add
+	serverCert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	apiTLS.Certificates = []tls.Certificate{serverCert}
+	apiTLS.NextProtos = []string{"h2", "http/1.1"}
+	base := apiTLS
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			connConfig := base.Clone()
+			connConfig.ClientCAs = clientCAs()
+			return connConfig, nil
+		},
+	}, nil
 }
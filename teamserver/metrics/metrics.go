@@ -0,0 +1,62 @@
+// Package metrics holds the Prometheus metrics of the TeamServer and serves them for scraping.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Transports a bridge request can arrive over.
+const (
+	TransportUnary  = "unary"
+	TransportStream = "stream"
+	// A request relayed over a BeaconRelay stream, see BeaconRelay
+	TransportRelay = "relay"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	// BridgeRequests counts the finished calls and relayed requests of the listener bridge.
+	BridgeRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "simplec2",
+		Subsystem: "bridge",
+		Name:      "requests_total",
+		Help:      "Finished calls and relayed requests of the listener bridge, by method, transport, listener and gRPC status code.",
+	}, []string{"method", "transport", "listener", "code"})
+
+	// BridgeRequestDuration measures how long the calls and relayed requests of the bridge take.
+	BridgeRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "simplec2",
+		Subsystem: "bridge",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of the calls and relayed requests of the listener bridge, by method, transport and gRPC status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "transport", "code"})
+
+	// BridgeActiveStreams counts the open streams of the bridge, such as the control channels.
+	BridgeActiveStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "simplec2",
+		Subsystem: "bridge",
+		Name:      "active_streams",
+		Help:      "Open streams of the listener bridge, by method.",
+	}, []string{"method"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		BridgeRequests,
+		BridgeRequestDuration,
+		BridgeActiveStreams,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
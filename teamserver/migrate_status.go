@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+)
+
+// printSchemaStatus prints which schema migrations are applied to the database, for -migrate-status.
+func printSchemaStatus(cfg config.DatabaseConfig) {
+	status, err := data.GetSchemaStatus(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to read migration status: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tSTATUS")
+	for _, m := range status.Migrations {
+		state := "pending"
+		if m.Applied {
+			state = "applied"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", m.ID, state)
+	}
+	for _, id := range status.Unknown {
+		fmt.Fprintf(w, "%s\tapplied (unknown to this release)\n", id)
+	}
+	w.Flush()
+
+	switch pending := status.Pending(); {
+	case len(status.Unknown) > 0:
+		fmt.Println("\nThe database was migrated by a newer TeamServer release; upgrade this TeamServer before starting it.")
+	case status.Legacy:
+		fmt.Println("\nThe database predates versioned migrations. The baseline will bring it up to date with the current models and record it as migrated.")
+	case len(pending) > 0:
+		fmt.Printf("\n%d migration(s) pending. Apply them with -migrate, or start the TeamServer without database.manual_migrations.\n", len(pending))
+	default:
+		fmt.Println("\nThe database schema is up to date.")
+	}
+}
@@ -0,0 +1,143 @@
+package oplog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"simplec2/pkg/config"
+)
+
+// insertOplogEntries adds entries through Ghostwriter's GraphQL API.
+const insertOplogEntries = `mutation InsertOplogEntries($objects: [oplogEntry_insert_input!]!) {
+  insert_oplogEntry(objects: $objects) { affected_rows }
+}`
+
+// ghostwriterSink adds entries to the oplogs of a Ghostwriter instance.
+type ghostwriterSink struct {
+	cfg    *config.GhostwriterConfig
+	url    string
+	client *http.Client
+}
+
+// ghostwriterEntry is an entry in the fields of Ghostwriter's oplogEntry table.
+type ghostwriterEntry struct {
+	Oplog           int               `json:"oplog"`
+	StartDate       time.Time         `json:"startDate"`
+	EndDate         time.Time         `json:"endDate"`
+	SourceIP        string            `json:"sourceIp"` // Host the command ran on
+	DestIP          string            `json:"destIp"`
+	Tool            string            `json:"tool"`
+	UserContext     string            `json:"userContext"`
+	Command         string            `json:"command"`
+	Description     string            `json:"description"`
+	Output          string            `json:"output"`
+	Comments        string            `json:"comments"`
+	OperatorName    string            `json:"operatorName"`
+	EntryIdentifier string            `json:"entryIdentifier"`
+	ExtraFields     map[string]string `json:"extraFields"`
+}
+
+func newGhostwriterSink(cfg *config.GhostwriterConfig) (*ghostwriterSink, error) {
+	if cfg.URL == "" || cfg.Token == "" {
+		return nil, fmt.Errorf("ghostwriter url and token are required")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	return &ghostwriterSink{
+		cfg:    cfg,
+		url:    strings.TrimSuffix(cfg.URL, "/") + "/v1/graphql",
+		client: &http.Client{Transport: transport, Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (s *ghostwriterSink) name() string {
+	return "ghostwriter"
+}
+
+// send inserts the entries of engagements with an oplog in one request.
+func (s *ghostwriterSink) send(entries []*Entry) error {
+	objects := make([]*ghostwriterEntry, 0, len(entries))
+	for _, entry := range entries {
+		oplogID := s.cfg.GetOplogID(entry.Engagement)
+		if oplogID == 0 {
+			continue
+		}
+		command := entry.Command
+		if entry.Arguments != "" {
+			command += " " + entry.Arguments
+		}
+		source := entry.Hostname
+		if entry.InternalIP != "" {
+			source = fmt.Sprintf("%s (%s)", entry.Hostname, entry.InternalIP)
+		}
+		output := entry.Output
+		if entry.OutputTruncated {
+			output += "\n[output truncated, full output in SimpleC2]"
+		}
+		objects = append(objects, &ghostwriterEntry{
+			Oplog:           oplogID,
+			StartDate:       entry.StartTime,
+			EndDate:         entry.EndTime,
+			SourceIP:        source,
+			Tool:            "SimpleC2",
+			UserContext:     entry.Username,
+			Command:         command,
+			Description:     fmt.Sprintf("Task %s on beacon %s, process %s: %s", entry.TaskID, entry.BeaconID, entry.Process, entry.Status),
+			Output:          output,
+			Comments:        strings.Join(entry.Techniques, ", "),
+			OperatorName:    entry.Operator,
+			EntryIdentifier: entry.TaskID,
+			ExtraFields:     map[string]string{},
+		})
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     insertOplogEntries,
+		"variables": map[string]interface{}{"objects": objects},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ghostwriter returned %s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+	// GraphQL errors come with a 200 status
+	var result struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("invalid ghostwriter response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("ghostwriter rejected the entries: %s", result.Errors[0].Message)
+	}
+	return nil
+}
+
+func (s *ghostwriterSink) close() error {
+	return nil
+}
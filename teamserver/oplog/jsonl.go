@@ -0,0 +1,49 @@
+package oplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// jsonlSink appends entries to a file, one JSON object per line.
+type jsonlSink struct {
+	path string
+	file *os.File
+}
+
+func newJSONLSink(path string) (*jsonlSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create oplog directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open oplog file: %w", err)
+	}
+	return &jsonlSink{path: path, file: file}, nil
+}
+
+func (s *jsonlSink) name() string {
+	return "jsonl"
+}
+
+// send appends the batch to the file in one write.
+func (s *jsonlSink) send(entries []*Entry) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	if _, err := s.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *jsonlSink) close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,282 @@
+// Package oplog exports an operation log of the engagement while it runs: every finished task is
+// sent as an oplog entry to Ghostwriter and/or appended to a JSONL file.
+package oplog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+)
+
+const (
+	maxBatch      = 100
+	flushInterval = time.Second
+	// Task IDs remembered to export each task once, when it is reported finished more than once
+	recentTasks = 1024
+)
+
+// Entry is the oplog entry of a task.
+type Entry struct {
+	StartTime  time.Time `json:"start_time"` // When the task was queued
+	EndTime    time.Time `json:"end_time"`   // When it finished
+	Engagement string    `json:"engagement"`
+	TaskID     string    `json:"task_id"`
+	BeaconID   string    `json:"beacon_id"`
+	Operator   string    `json:"operator"` // Empty for system tasks
+	Command    string    `json:"command"`
+	Arguments  string    `json:"arguments,omitempty"`
+	Status     string    `json:"status"` // "completed", "failed" or "timed_out"
+	// Target the task ran on
+	Hostname   string   `json:"hostname"`
+	InternalIP string   `json:"internal_ip"`
+	Username   string   `json:"username"`
+	Process    string   `json:"process"` // e.g. "rundll32.exe (4242)"
+	Techniques []string `json:"techniques,omitempty"`
+	// Beginning of the output, up to the configured limit
+	Output          string `json:"output"`
+	OutputTruncated bool   `json:"output_truncated,omitempty"`
+}
+
+// sink delivers a batch of entries to an oplog destination.
+type sink interface {
+	name() string
+	send(entries []*Entry) error
+	close() error
+}
+
+// finishedTask is a task reported finished by a broadcast event.
+type finishedTask struct {
+	engagement string
+	taskID     string
+}
+
+// Exporter turns the finished-task events broadcast by the hub into oplog entries and sends them
+// in the background. Events are queued without blocking; when a destination is slow the oldest
+// are dropped.
+type Exporter struct {
+	store       data.DataStore
+	sinks       []sink
+	outputLimit int
+	queue       chan finishedTask
+	dropped     atomic.Int64
+
+	// Recently exported task IDs, only used by run
+	exported map[string]struct{}
+	order    []string
+
+	closeOnce sync.Once
+	done      chan struct{}
+	finished  chan struct{}
+}
+
+// New creates an exporter for the configured destinations and starts it.
+func New(cfg *config.OplogConfig, store data.DataStore) (*Exporter, error) {
+	var sinks []sink
+	if cfg.JSONLPath != "" {
+		s, err := newJSONLSink(cfg.JSONLPath)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if cfg.Ghostwriter != nil {
+		s, err := newGhostwriterSink(cfg.Ghostwriter)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("oplog requires jsonl_path or ghostwriter")
+	}
+
+	e := &Exporter{
+		store:       store,
+		sinks:       sinks,
+		outputLimit: cfg.GetOutputLimit(),
+		queue:       make(chan finishedTask, cfg.GetQueueSize()),
+		exported:    make(map[string]struct{}, recentTasks),
+		done:        make(chan struct{}),
+		finished:    make(chan struct{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+// Destinations returns the names of the destinations entries are sent to.
+func (e *Exporter) Destinations() []string {
+	names := make([]string, 0, len(e.sinks))
+	for _, s := range e.sinks {
+		names = append(names, s.name())
+	}
+	return names
+}
+
+// Observe is a hub observer queuing the tasks reported finished by TASK_OUTPUT and TASK_FAILED
+// events. It never blocks the hub.
+func (e *Exporter) Observe(engagement string, event []byte) {
+	var decoded struct {
+		Type    string `json:"type"`
+		Payload struct {
+			TaskID      string `json:"TaskID"`  // data.Task
+			EventTaskID string `json:"task_id"` // TASK_FAILED
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(event, &decoded); err != nil {
+		return
+	}
+	if decoded.Type != "TASK_OUTPUT" && decoded.Type != "TASK_FAILED" {
+		return
+	}
+	task := finishedTask{engagement: engagement, taskID: decoded.Payload.TaskID}
+	if task.taskID == "" {
+		task.taskID = decoded.Payload.EventTaskID
+	}
+	if task.taskID == "" {
+		return
+	}
+
+	for {
+		select {
+		case e.queue <- task:
+			return
+		default:
+		}
+		select {
+		case <-e.queue:
+			e.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// entry builds the oplog entry of a task, or returns nil if the task isn't finished or was
+// already exported.
+func (e *Exporter) entry(finished finishedTask) *Entry {
+	if _, ok := e.exported[finished.taskID]; ok {
+		return nil
+	}
+	task, err := e.store.GetTask(finished.taskID)
+	if err != nil {
+		logger.Warnf("Failed to get task %s for the oplog: %v", finished.taskID, err)
+		return nil
+	}
+	// Intermediate output, or a timed-out task that was queued once more
+	switch task.Status {
+	case "completed", "failed", "timed_out":
+	default:
+		return nil
+	}
+
+	e.exported[task.TaskID] = struct{}{}
+	e.order = append(e.order, task.TaskID)
+	if len(e.order) > recentTasks {
+		delete(e.exported, e.order[0])
+		e.order = e.order[1:]
+	}
+
+	entry := &Entry{
+		StartTime:  task.CreatedAt,
+		EndTime:    task.UpdatedAt,
+		Engagement: task.Engagement,
+		TaskID:     task.TaskID,
+		BeaconID:   task.BeaconID,
+		Operator:   task.Operator,
+		Command:    task.Command,
+		Arguments:  task.Arguments,
+		Status:     task.Status,
+		Techniques: task.Techniques,
+		Output:     task.Output,
+		// Offloaded outputs only keep a preview
+		OutputTruncated: task.OutputLootID != "",
+	}
+	if len(entry.Output) > e.outputLimit {
+		entry.Output = strings.ToValidUTF8(entry.Output[:e.outputLimit], "")
+		entry.OutputTruncated = true
+	}
+	if beacon, err := e.store.GetBeacon(task.BeaconID); err == nil {
+		entry.Hostname = beacon.Hostname
+		entry.InternalIP = beacon.InternalIP
+		entry.Username = beacon.Username
+		entry.Process = fmt.Sprintf("%s (%d)", beacon.ProcessName, beacon.PID)
+	}
+	return entry
+}
+
+func (e *Exporter) run() {
+	defer close(e.finished)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	failed := make([]int, len(e.sinks))
+	batch := make([]*Entry, 0, maxBatch)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		for i, s := range e.sinks {
+			if err := s.send(batch); err != nil {
+				if failed[i] == 0 {
+					logger.Errorf("Failed to export oplog entries to %s: %v", s.name(), err)
+				}
+				failed[i] += len(batch)
+			}
+		}
+		batch = make([]*Entry, 0, maxBatch)
+	}
+	add := func(task finishedTask) {
+		if entry := e.entry(task); entry != nil {
+			batch = append(batch, entry)
+			if len(batch) >= maxBatch {
+				flush()
+			}
+		}
+	}
+
+	for {
+		select {
+		case task := <-e.queue:
+			add(task)
+		case <-ticker.C:
+			flush()
+			if n := e.dropped.Swap(0); n > 0 {
+				logger.Warnf("Oplog exporter queue full, dropped %d oldest tasks", n)
+			}
+			for i, n := range failed {
+				if n > 0 {
+					logger.Warnf("Oplog exporter could not deliver %d entries to %s", n, e.sinks[i].name())
+					failed[i] = 0
+				}
+			}
+		case <-e.done:
+			// Export whatever is still queued before stopping
+			for {
+				select {
+				case task := <-e.queue:
+					add(task)
+				default:
+					flush()
+					for _, s := range e.sinks {
+						if err := s.close(); err != nil {
+							logger.Errorf("Failed to close oplog destination %s: %v", s.name(), err)
+						}
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// Close exports all queued tasks and stops the exporter.
+func (e *Exporter) Close() {
+	e.closeOnce.Do(func() { close(e.done) })
+	<-e.finished
+}
@@ -0,0 +1,59 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+)
+
+// shutdownSignals make the TeamServer shut down gracefully; restartSignals make it restart in place.
+var (
+	shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	restartSignals  = []os.Signal{syscall.SIGUSR2}
+)
+
+// reexec starts a new TeamServer from the same binary and arguments and hands it the listening
+// sockets, so connections keep being accepted while this one shuts down.
+func reexec(names []string, listeners []net.Listener) error {
+	files := make([]*os.File, 0, len(listeners))
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for i, lis := range listeners {
+		tcp, ok := lis.(*net.TCPListener)
+		if !ok {
+			return fmt.Errorf("%s socket can't be handed over", names[i])
+		}
+		file, err := tcp.File()
+		if err != nil {
+			return fmt.Errorf("failed to get %s socket: %w", names[i], err)
+		}
+		files = append(files, file)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), listenFDsEnv+"="+strings.Join(names, ","))
+	// The new process can't prompt for the master key of an encrypted configuration
+	cmd.Env = append(cmd.Env, config.ConfigKeyEnviron()...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start new TeamServer: %w", err)
+	}
+	logger.Infof("Started new TeamServer (pid %d) with the listening sockets", cmd.Process.Pid)
+	return cmd.Process.Release()
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// shutdownSignals make the TeamServer shut down gracefully; restarting in place is not supported.
+var (
+	shutdownSignals = []os.Signal{os.Interrupt}
+	restartSignals  []os.Signal
+)
+
+// reexec is not supported on Windows, which can't hand sockets to a new process this way.
+func reexec(names []string, listeners []net.Listener) error {
+	return errors.New("restarting in place is not supported on Windows")
+}
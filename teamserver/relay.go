@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"simplec2/pkg/bridge"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/metrics"
+	"simplec2/teamserver/tracing"
+)
+
+// maxRelayInFlight bounds the requests of one BeaconRelay stream handled at the same time; the
+// stream stops reading, and gRPC flow control holds back the listener, while it is reached.
+const maxRelayInFlight = 64
+
+// relayStream is a BeaconRelay stream; responses and notices are sent from several goroutines.
+type relayStream struct {
+	mu     sync.Mutex
+	stream bridge.TeamServerBridgeService_BeaconRelayServer
+}
+
+func (r *relayStream) send(res *bridge.RelayResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stream.Send(res)
+}
+
+// relayHub tracks the BeaconRelay streams of the connected listeners and tells them when tasks
+// are queued for one of their beacons.
+type relayHub struct {
+	store   data.DataStore
+	mu      sync.Mutex
+	streams map[string]map[*relayStream]struct{} // By listener name
+	notices chan string                          // IDs of beacons with new tasks
+}
+
+// newRelayHub creates a relay hub. Its Observe method is a websocket hub observer.
+func newRelayHub(store data.DataStore) *relayHub {
+	return &relayHub{
+		store:   store,
+		streams: make(map[string]map[*relayStream]struct{}),
+		notices: make(chan string, 1024),
+	}
+}
+
+// Observe queues a task notice for the beacon of every TASK_QUEUED event.
+func (h *relayHub) Observe(engagement string, event []byte) {
+	// Called for every event, most of which are not worth decoding
+	if !bytes.Contains(event, []byte(`"TASK_QUEUED"`)) {
+		return
+	}
+	var queued struct {
+		Type    string `json:"type"`
+		Payload struct {
+			BeaconID string
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(event, &queued); err != nil || queued.Type != "TASK_QUEUED" || queued.Payload.BeaconID == "" {
+		return
+	}
+	select {
+	case h.notices <- queued.Payload.BeaconID:
+	default:
+		// The beacon still gets the task on its next regular check-in
+		logger.Warnf("Relay notice queue is full, task notice for beacon %s dropped", queued.Payload.BeaconID)
+	}
+}
+
+// Start sends the queued task notices to the listeners of the beacons in the background.
+func (h *relayHub) Start() {
+	go func() {
+		for beaconID := range h.notices {
+			beacon, err := h.store.GetBeacon(beaconID)
+			if err != nil {
+				continue
+			}
+			notice := &bridge.RelayResponse{Payload: &bridge.RelayResponse_TaskNotice{TaskNotice: &bridge.TaskNotice{BeaconId: beaconID}}}
+			for _, stream := range h.streamsOf(beacon.Listener) {
+				if err := stream.send(notice); err != nil {
+					logger.Debugf("Error sending task notice to listener %s: %v", beacon.Listener, err)
+				}
+			}
+		}
+	}()
+}
+
+func (h *relayHub) register(listenerName string, stream *relayStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.streams[listenerName] == nil {
+		h.streams[listenerName] = make(map[*relayStream]struct{})
+	}
+	h.streams[listenerName][stream] = struct{}{}
+}
+
+func (h *relayHub) unregister(listenerName string, stream *relayStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.streams[listenerName], stream)
+	if len(h.streams[listenerName]) == 0 {
+		delete(h.streams, listenerName)
+	}
+}
+
+func (h *relayHub) streamsOf(listenerName string) []*relayStream {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	streams := make([]*relayStream, 0, len(h.streams[listenerName]))
+	for stream := range h.streams[listenerName] {
+		streams = append(streams, stream)
+	}
+	return streams
+}
+
+// BeaconRelay handles the long-lived stream a listener sends its beacons' stage, check-in and
+// output requests over, instead of one unary call each. Requests are handled concurrently and
+// answered with the ID they came with; task notices for the listener's beacons are pushed on the
+// same stream.
+func (s *server) BeaconRelay(stream bridge.TeamServerBridgeService_BeaconRelayServer) error {
+	ctx := stream.Context()
+	rs := &relayStream{stream: stream}
+	listenerName := ""
+	defer func() {
+		if listenerName != "" {
+			s.relays.unregister(listenerName, rs)
+			logger.Ctx(ctx).Infof("Beacon relay of listener %s closed", listenerName)
+		}
+	}()
+
+	inFlight := make(chan struct{}, maxRelayInFlight)
+	var wg sync.WaitGroup
+	// Responses can't be sent once the handler returns
+	defer wg.Wait()
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if listenerName == "" {
+			if req.ListenerName == "" {
+				return status.Error(codes.InvalidArgument, "the first relay message must set listener_name")
+			}
+			if err := s.verifyListenerName(ctx, req.ListenerName); err != nil {
+				return err
+			}
+			listenerName = req.ListenerName
+			s.relays.register(listenerName, rs)
+			logger.Ctx(ctx).Infof("Beacon relay of listener %s opened", listenerName)
+		}
+		if req.Payload == nil {
+			// Only names the listener
+			continue
+		}
+
+		select {
+		case inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			res := s.handleRelayRequest(ctx, req)
+			res.Id = req.Id
+			if err := rs.send(res); err != nil {
+				logger.Ctx(ctx).Debugf("Error sending relay response %d: %v", req.Id, err)
+			}
+		}()
+	}
+}
+
+// handleRelayRequest runs a relayed request through the handler of its unary counterpart.
+func (s *server) handleRelayRequest(ctx context.Context, req *bridge.RelayRequest) *bridge.RelayResponse {
+	if req.RequestId != "" {
+		ctx = logger.ContextWithRequestID(ctx, req.RequestId)
+	}
+
+	// Each relayed request is a trace of its own, linked to the long-lived stream
+	ctx, span := tracing.StartRoot(ctx, "BeaconRelay request", attribute.String("simplec2.request_id", req.RequestId))
+	start := time.Now()
+	method := ""
+	var res *bridge.RelayResponse
+	var err error
+	switch payload := req.Payload.(type) {
+	case *bridge.RelayRequest_Stage:
+		method = bridge.TeamServerBridgeService_StageBeacon_FullMethodName
+		var stage *bridge.StageBeaconResponse
+		if stage, err = s.StageBeacon(ctx, payload.Stage); err == nil {
+			res = &bridge.RelayResponse{Payload: &bridge.RelayResponse_Stage{Stage: stage}}
+		}
+	case *bridge.RelayRequest_CheckIn:
+		method = bridge.TeamServerBridgeService_CheckInBeacon_FullMethodName
+		var checkIn *bridge.CheckInBeaconResponse
+		if checkIn, err = s.CheckInBeacon(ctx, payload.CheckIn); err == nil {
+			res = &bridge.RelayResponse{Payload: &bridge.RelayResponse_CheckIn{CheckIn: checkIn}}
+		}
+	case *bridge.RelayRequest_Output:
+		method = bridge.TeamServerBridgeService_PushBeaconOutput_FullMethodName
+		var output *bridge.PushBeaconOutputResponse
+		if output, err = s.PushBeaconOutput(ctx, payload.Output); err == nil {
+			res = &bridge.RelayResponse{Payload: &bridge.RelayResponse_Output{Output: output}}
+		}
+	default:
+		method = "unknown"
+		err = status.Error(codes.InvalidArgument, "empty or unknown relay request")
+	}
+
+	listener := ""
+	if identity, ok := listenerIdentityFrom(ctx); ok {
+		listener = identity.label()
+	}
+	observeBridgeCall(ctx, method, metrics.TransportRelay, listener, start, err)
+	span.SetName("BeaconRelay " + path.Base(method))
+	span.SetAttributes(attribute.String("simplec2.listener", listener))
+	tracing.End(span, err)
+	if err != nil {
+		st := status.Convert(err)
+		return &bridge.RelayResponse{Payload: &bridge.RelayResponse_Error{Error: &bridge.RelayError{Code: int32(st.Code()), Message: st.Message()}}}
+	}
+	return res
+}
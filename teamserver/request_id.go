@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/api"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDMetadataKey carries the ID of a gRPC call, in both directions.
+const requestIDMetadataKey = "x-request-id"
+
+// incomingRequestID returns the ID the listener sent with a call, or a new one.
+func incomingRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDMetadataKey); len(ids) > 0 && api.ValidRequestID(ids[0]) {
+			return ids[0]
+		}
+	}
+	return uuid.NewString()
+}
+
+// NewRequestIDInterceptor returns a gRPC unary server interceptor that puts the call's request ID
+// into the handler's context, for logger.Ctx, and returns it in the response header.
+func NewRequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id := incomingRequestID(ctx)
+		grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadataKey, id))
+		return handler(logger.ContextWithRequestID(ctx, id), req)
+	}
+}
+
+// NewRequestIDStreamInterceptor is the stream counterpart of NewRequestIDInterceptor.
+func NewRequestIDStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		id := incomingRequestID(ss.Context())
+		ss.SetHeader(metadata.Pairs(requestIDMetadataKey, id))
+		return handler(srv, &contextStream{ServerStream: ss, ctx: logger.ContextWithRequestID(ss.Context(), id)})
+	}
+}
+
+// contextStream is a server stream with a context derived from the original one, e.g. carrying
+// the request ID.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,55 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+
+	"simplec2/pkg/config"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// awsProvider reads secrets from AWS Secrets Manager. Credentials come from the usual AWS
+// configuration: environment, shared config files, or the instance or task role, and are
+// refreshed by the SDK.
+type awsProvider struct {
+	client *secretsmanager.Client
+}
+
+func newAWSProvider(ctx context.Context, cfg *config.SecretsConfig) (*awsProvider, error) {
+	var options []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		options = append(options, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	client := secretsmanager.NewFromConfig(awsCfg, func(o *secretsmanager.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = &cfg.Endpoint
+		}
+	})
+	return &awsProvider{client: client}, nil
+}
+
+// fetch returns the current version of a secret, by name or ARN.
+func (p *awsProvider) fetch(ctx context.Context, name string) ([]byte, error) {
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret '%s': %w", name, err)
+	}
+	if out.SecretString != nil {
+		return []byte(*out.SecretString), nil
+	}
+	return out.SecretBinary, nil
+}
+
+func (p *awsProvider) renew(ctx context.Context) error {
+	return nil
+}
+
+func (p *awsProvider) close() error {
+	return nil
+}
@@ -0,0 +1,47 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+
+	"simplec2/pkg/config"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"google.golang.org/api/option"
+)
+
+// gcpProvider reads secrets from GCP Secret Manager. Credentials come from Application Default
+// Credentials.
+type gcpProvider struct {
+	client *secretmanager.Client
+}
+
+func newGCPProvider(ctx context.Context, cfg *config.SecretsConfig) (*gcpProvider, error) {
+	var options []option.ClientOption
+	if cfg.Endpoint != "" {
+		options = append(options, option.WithEndpoint(cfg.Endpoint))
+	}
+	client, err := secretmanager.NewClient(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCP Secret Manager client: %w", err)
+	}
+	return &gcpProvider{client: client}, nil
+}
+
+// fetch returns a secret version, e.g. "projects/p/secrets/s/versions/latest".
+func (p *gcpProvider) fetch(ctx context.Context, name string) ([]byte, error) {
+	out, err := p.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to access secret '%s': %w", name, err)
+	}
+	return out.GetPayload().GetData(), nil
+}
+
+func (p *gcpProvider) renew(ctx context.Context) error {
+	return nil
+}
+
+func (p *gcpProvider) close() error {
+	return p.client.Close()
+}
@@ -0,0 +1,178 @@
+// Package secrets fetches the secrets of the TeamServer (the API key encryption key, the JWT
+// secret and the listener API key) from HashiCorp Vault or a cloud secret manager. Values are
+// cached in memory and fetched again periodically, so a secret rotated in the manager is picked
+// up without a restart.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+)
+
+// fetchTimeout bounds logging in and fetching all secrets once.
+const fetchTimeout = 30 * time.Second
+
+// provider fetches secrets from a secret manager.
+type provider interface {
+	// fetch returns the secret a reference names (without its "#field" selector).
+	fetch(ctx context.Context, name string) ([]byte, error)
+	// renew extends the credentials of the provider before they expire, e.g. a Vault token.
+	renew(ctx context.Context) error
+	close() error
+}
+
+// Store caches the secrets of the secret manager.
+type Store struct {
+	provider provider
+	refs     map[string]string // Secret name (config.SecretJWTSecret, ...) -> reference
+	interval time.Duration
+
+	mu     sync.RWMutex
+	values map[string]string
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// New connects to the configured secret manager and fetches every referenced secret. It fails
+// if one of them cannot be fetched, so the TeamServer never starts with a fallback secret.
+func New(cfg *config.SecretsConfig) (*Store, error) {
+	refs := map[string]string{}
+	for name, ref := range map[string]string{
+		config.SecretEncryptionKey: cfg.EncryptionKey,
+		config.SecretJWTSecret:     cfg.JWTSecret,
+		config.SecretAPIKey:        cfg.APIKey,
+		config.SecretSMTPPassword:  cfg.SMTPPassword,
+	} {
+		if ref != "" {
+			refs[name] = ref
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	var p provider
+	var err error
+	switch cfg.Provider {
+	case config.SecretsVault:
+		p, err = newVaultProvider(ctx, cfg.Vault)
+	case config.SecretsAWS:
+		p, err = newAWSProvider(ctx, cfg)
+	case config.SecretsGCP:
+		p, err = newGCPProvider(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("invalid secrets provider '%s' (must be 'vault', 'awssm' or 'gcpsm')", cfg.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		provider: p,
+		refs:     refs,
+		interval: cfg.GetRefreshInterval(),
+		values:   map[string]string{},
+		done:     make(chan struct{}),
+	}
+	for name, ref := range refs {
+		value, err := s.fetch(ctx, ref)
+		if err != nil {
+			p.close()
+			return nil, fmt.Errorf("failed to fetch %s: %w", name, err)
+		}
+		s.values[name] = value
+	}
+	return s, nil
+}
+
+// Lookup returns the cached value of a secret, and whether the secret manager holds it.
+// It is a config.SecretSource.
+func (s *Store) Lookup(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.values[name]
+	return value, ok
+}
+
+// Start renews the credentials of the provider and fetches the secrets again in the background.
+// A secret that cannot be fetched keeps its cached value.
+func (s *Store) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.refresh()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// refresh renews the provider's credentials and fetches every secret.
+func (s *Store) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	if err := s.provider.renew(ctx); err != nil {
+		logger.Warnf("Failed to renew secret manager credentials: %v", err)
+	}
+	for name, ref := range s.refs {
+		value, err := s.fetch(ctx, ref)
+		if err != nil {
+			logger.Warnf("Failed to fetch %s, keeping the cached value: %v", name, err)
+			continue
+		}
+		s.mu.Lock()
+		changed := s.values[name] != value
+		s.values[name] = value
+		s.mu.Unlock()
+		if changed {
+			logger.Infof("Secret %s changed in the secret manager", name)
+		}
+	}
+}
+
+// fetch fetches the secret a reference names and selects its field, if any.
+func (s *Store) fetch(ctx context.Context, ref string) (string, error) {
+	name, field, _ := strings.Cut(ref, "#")
+	data, err := s.provider.fetch(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if field == "" {
+		value := strings.TrimSpace(string(data))
+		if value == "" {
+			return "", fmt.Errorf("secret '%s' is empty", name)
+		}
+		return value, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", fmt.Errorf("secret '%s' is not a JSON object, cannot select field '%s'", name, field)
+	}
+	value, ok := fields[field].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("secret '%s' has no field '%s'", name, field)
+	}
+	return value, nil
+}
+
+// Close stops the background refresh and closes the connection to the secret manager.
+func (s *Store) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		err = s.provider.close()
+	})
+	return err
+}
@@ -0,0 +1,154 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// kubernetesTokenPath is where Kubernetes mounts the service account token of a pod.
+const kubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// vaultProvider reads secrets from the KV secrets engine of a Vault server.
+type vaultProvider struct {
+	client *vault.Client
+	cfg    *config.VaultConfig
+
+	renewable bool
+	expiresAt time.Time // Zero if the token does not expire
+}
+
+func newVaultProvider(ctx context.Context, cfg *config.VaultConfig) (*vaultProvider, error) {
+	if cfg == nil || cfg.Address == "" {
+		return nil, fmt.Errorf("vault secrets provider needs vault.address")
+	}
+	vaultCfg := vault.DefaultConfig()
+	vaultCfg.Address = cfg.Address
+	if cfg.CACert != "" {
+		if err := vaultCfg.ConfigureTLS(&vault.TLSConfig{CACert: cfg.CACert}); err != nil {
+			return nil, fmt.Errorf("failed to configure vault TLS: %w", err)
+		}
+	}
+	client, err := vault.NewClient(vaultCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault client: %w", err)
+	}
+	if cfg.Namespace != "" {
+		client.SetNamespace(cfg.Namespace)
+	}
+
+	p := &vaultProvider{client: client, cfg: cfg}
+	if err := p.login(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// login obtains a token with the configured auth method.
+func (p *vaultProvider) login(ctx context.Context) error {
+	var data map[string]any
+	switch p.cfg.GetAuthMethod() {
+	case "token":
+		token := p.cfg.GetToken()
+		if token == "" {
+			return fmt.Errorf("vault token auth needs vault.token or VAULT_TOKEN")
+		}
+		p.client.SetToken(token)
+		secret, err := p.client.Auth().Token().LookupSelfWithContext(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to look up vault token: %w", err)
+		}
+		p.renewable, _ = secret.TokenIsRenewable()
+		ttl, _ := secret.TokenTTL()
+		p.setExpiry(ttl)
+		return nil
+	case "approle":
+		data = map[string]any{"role_id": p.cfg.RoleID, "secret_id": p.cfg.GetSecretID()}
+	case "kubernetes":
+		jwt, err := os.ReadFile(kubernetesTokenPath)
+		if err != nil {
+			return fmt.Errorf("failed to read service account token: %w", err)
+		}
+		data = map[string]any{"role": p.cfg.Role, "jwt": string(jwt)}
+	default:
+		return fmt.Errorf("invalid vault auth method '%s' (must be 'token', 'approle' or 'kubernetes')", p.cfg.AuthMethod)
+	}
+
+	// The login request itself must not carry a token
+	p.client.ClearToken()
+	secret, err := p.client.Logical().WriteWithContext(ctx, "auth/"+p.cfg.GetAuthMount()+"/login", data)
+	if err != nil {
+		return fmt.Errorf("failed to log in to vault: %w", err)
+	}
+	if secret == nil || secret.Auth == nil {
+		return fmt.Errorf("failed to log in to vault: no token in the response")
+	}
+	p.client.SetToken(secret.Auth.ClientToken)
+	p.renewable = secret.Auth.Renewable
+	p.setExpiry(time.Duration(secret.Auth.LeaseDuration) * time.Second)
+	return nil
+}
+
+func (p *vaultProvider) setExpiry(ttl time.Duration) {
+	p.expiresAt = time.Time{}
+	if ttl > 0 {
+		p.expiresAt = time.Now().Add(ttl)
+	}
+}
+
+// fetch reads a KV secret, version 1 (e.g. "secret/simplec2") or version 2
+// (e.g. "secret/data/simplec2"), and returns its key/value pairs as a JSON object.
+func (p *vaultProvider) fetch(ctx context.Context, path string) ([]byte, error) {
+	secret, err := p.client.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret '%s': %w", path, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("vault secret '%s' not found", path)
+	}
+	data := secret.Data
+	// KV version 2 nests the key/value pairs next to the version metadata
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	return json.Marshal(data)
+}
+
+// renew renews the token, or logs in again once it can no longer be renewed. A token that does
+// not expire is left alone.
+func (p *vaultProvider) renew(ctx context.Context) error {
+	if p.expiresAt.IsZero() {
+		return nil
+	}
+	if p.renewable {
+		secret, err := p.client.Auth().Token().RenewSelfWithContext(ctx, 0)
+		if err == nil && secret != nil && secret.Auth != nil {
+			p.renewable = secret.Auth.Renewable
+			p.setExpiry(time.Duration(secret.Auth.LeaseDuration) * time.Second)
+			return nil
+		}
+		if err != nil {
+			logger.Warnf("Failed to renew vault token: %v", err)
+		}
+	}
+	if p.cfg.GetAuthMethod() == "token" {
+		if time.Now().After(p.expiresAt) {
+			return fmt.Errorf("vault token expired and cannot be renewed")
+		}
+		return nil
+	}
+	return p.login(ctx)
+}
+
+func (p *vaultProvider) close() error {
+	return nil
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+
 	"simplec2/pkg/bridge"
 	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
 	"simplec2/teamserver/data"
 	"simplec2/teamserver/service"
 	"simplec2/teamserver/websocket"
@@ -11,13 +15,62 @@ import (
 // server is used to implement bridge.TeamServerBridgeService.
 type server struct {
 	bridge.UnimplementedTeamServerBridgeServiceServer
-	Config          *config.TeamServerConfig
-	Store           data.DataStore
-	Hub             *websocket.Hub
-	ListenerService service.ListenerService
+	Config            *config.TeamServerConfig
+	Store             data.DataStore
+	Hub               *websocket.Hub
+	ListenerService   service.ListenerService
+	HostedFileService service.HostedFileService
+	CanaryService     service.CanaryService
+	PayloadService    service.PayloadService
+	ArtifactService   service.ArtifactService
+	EngagementService service.EngagementService
+	AuditService      service.AuditService
+	PlaybookService   service.PlaybookService
+	HostService       service.HostService
+	LootService       service.LootService
+	TaskService       service.TaskService
+
+	lastSeen *lastSeenBuffer // Check-in times waiting to be written
+	relays   *relayHub       // BeaconRelay streams of the connected listeners
+}
+
+// NewServer creates a new server instance with the given configuration, datastore, hub, services and relay hub.
+func NewServer(cfg *config.TeamServerConfig, store data.DataStore, hub *websocket.Hub, listenerService service.ListenerService, hostedFileService service.HostedFileService, canaryService service.CanaryService, payloadService service.PayloadService, artifactService service.ArtifactService, engagementService service.EngagementService, auditService service.AuditService, playbookService service.PlaybookService, hostService service.HostService, lootService service.LootService, taskService service.TaskService, relays *relayHub) *server {
+	return &server{Config: cfg, Store: store, Hub: hub, ListenerService: listenerService, HostedFileService: hostedFileService, CanaryService: canaryService, PayloadService: payloadService, ArtifactService: artifactService, EngagementService: engagementService, AuditService: auditService, PlaybookService: playbookService, HostService: hostService, LootService: lootService, TaskService: taskService, lastSeen: newLastSeenBuffer(), relays: relays}
+}
+
+// store returns the data store with the trace of a call's context. Its queries aren't canceled
+// with the call, so a handler still finishes its writes if the listener goes away.
+func (s *server) store(ctx context.Context) data.DataStore {
+	return s.Store.WithContext(context.WithoutCancel(ctx))
+}
+
+// resolveBeaconSettings records the outcome of a finished task on the beacon settings it applies and
+// broadcasts BEACON_SETTINGS_UPDATED if it resolved them.
+func (s *server) resolveBeaconSettings(ctx context.Context, task *data.Task) {
+	state, err := s.TaskService.ResolveBeaconSettings(context.WithoutCancel(ctx), task)
+	if err != nil {
+		logger.Ctx(ctx).Errorf("Error resolving beacon settings of task %s: %v", task.TaskID, err)
+		return
+	}
+	if state != nil {
+		s.broadcastEvent(task.Engagement, "BEACON_SETTINGS_UPDATED", state)
+	}
 }
 
-// NewServer creates a new server instance with the given configuration, datastore, hub, and services.
-func NewServer(cfg *config.TeamServerConfig, store data.DataStore, hub *websocket.Hub, listenerService service.ListenerService) *server {
-	return &server{Config: cfg, Store: store, Hub: hub, ListenerService: listenerService}
+// broadcastEvent sends an event to the engagement's WebSocket clients.
+func (s *server) broadcastEvent(engagement, eventType string, payload interface{}) {
+	event := struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}{
+		Type:    eventType,
+		Payload: payload,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		logger.Errorf("Error marshalling %s event: %v", eventType, err)
+		return
+	}
+	s.Hub.BroadcastTo(engagement, eventBytes)
 }
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"simplec2/teamserver/data"
+
+	"github.com/google/uuid"
+)
+
+// Service API key scopes.
+const (
+	ScopeReadBeacons     = "read-beacons"
+	ScopeCreateTasks     = "create-tasks"
+	ScopeManageListeners = "manage-listeners"
+	ScopeExternalC2      = "external-c2" // Bridges third-party implants through the external C2 API
+)
+
+// apiKeyPrefix marks SimpleC2 service keys so they are easy to spot in secret scanners.
+const apiKeyPrefix = "sc2_"
+
+// lastUsedInterval limits how often the last-used time of a key is written.
+const lastUsedInterval = time.Minute
+
+// ErrAPIKeyInvalid is returned for unknown, revoked or expired API keys.
+var ErrAPIKeyInvalid = errors.New("api key is invalid, revoked or expired")
+
+var validScopes = map[string]bool{
+	ScopeReadBeacons:     true,
+	ScopeCreateTasks:     true,
+	ScopeManageListeners: true,
+	ScopeExternalC2:      true,
+}
+
+// APIKeyService defines the interface for service API key business logic.
+type APIKeyService interface {
+	// CreateAPIKey creates a key and returns it together with the plaintext key, which is not stored.
+	// The key is bound to the engagement of ctx.
+	CreateAPIKey(ctx context.Context, name string, scopes []string, createdBy string, expiresAt *time.Time) (*data.ServiceAPIKey, string, error)
+
+	// ListAPIKeys retrieves all keys.
+	ListAPIKeys(ctx context.Context, page int, limit int) ([]data.ServiceAPIKey, int64, error)
+
+	// RevokeAPIKey revokes a key.
+	RevokeAPIKey(ctx context.Context, keyID string) error
+
+	// ValidateAPIKey checks a plaintext key and returns the key record and its scopes.
+	ValidateAPIKey(ctx context.Context, key string) (*data.ServiceAPIKey, []string, error)
+}
+
+// apiKeyService implements the APIKeyService interface.
+type apiKeyService struct {
+	store data.DataStore
+}
+
+// NewAPIKeyService creates a new instance of apiKeyService.
+func NewAPIKeyService(store data.DataStore) APIKeyService {
+	return &apiKeyService{store: store}
+}
+
+// IsServiceAPIKey reports whether a credential looks like a service API key rather than a JWT.
+func IsServiceAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, apiKeyPrefix)
+}
+
+// CreateAPIKey creates a key and returns it together with the plaintext key, which is not stored.
+func (s *apiKeyService) CreateAPIKey(ctx context.Context, name string, scopes []string, createdBy string, expiresAt *time.Time) (*data.ServiceAPIKey, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return nil, "", fmt.Errorf("invalid scope '%s'", scope)
+		}
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return nil, "", fmt.Errorf("expires_at is in the past")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	plaintext := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	key := &data.ServiceAPIKey{
+		KeyID:     uuid.New().String(),
+		Name:      name,
+		Prefix:    plaintext[:len(apiKeyPrefix)+6],
+		KeyHash:   hashToken(plaintext),
+		Scopes:    strings.Join(scopes, ","),
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt,
+		// The key only ever sees the engagement it was created in
+		Engagement: engagementForNew(ctx),
+	}
+	if err := s.store.CreateServiceAPIKey(key); err != nil {
+		return nil, "", fmt.Errorf("failed to create api key: %w", err)
+	}
+	return key, plaintext, nil
+}
+
+// ListAPIKeys retrieves all keys.
+func (s *apiKeyService) ListAPIKeys(ctx context.Context, page int, limit int) ([]data.ServiceAPIKey, int64, error) {
+	keys, total, err := s.store.GetServiceAPIKeys(page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return keys, total, nil
+}
+
+// RevokeAPIKey revokes a key.
+func (s *apiKeyService) RevokeAPIKey(ctx context.Context, keyID string) error {
+	key, err := s.store.GetServiceAPIKey(keyID)
+	if err != nil {
+		return fmt.Errorf("api key not found: %w", err)
+	}
+	key.Revoked = true
+	if err := s.store.UpdateServiceAPIKey(key); err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	return nil
+}
+
+// ValidateAPIKey checks a plaintext key and returns the key record and its scopes.
+func (s *apiKeyService) ValidateAPIKey(ctx context.Context, plaintext string) (*data.ServiceAPIKey, []string, error) {
+	key, err := s.store.GetServiceAPIKeyByHash(hashToken(plaintext))
+	if err != nil {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+	now := time.Now()
+	if key.Revoked || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedInterval {
+		key.LastUsedAt = &now
+		if err := s.store.UpdateServiceAPIKey(key); err != nil {
+			return nil, nil, fmt.Errorf("failed to update api key: %w", err)
+		}
+	}
+	return key, splitList(key.Scopes), nil
+}
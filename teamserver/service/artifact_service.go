@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/filecrypt"
+	"simplec2/teamserver/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ArtifactService defines the interface for artifact tracking business logic.
+type ArtifactService interface {
+	// RecordArtifact stores an artifact. If localPath is set, size and hashes are computed from that file.
+	RecordArtifact(ctx context.Context, artifact *data.Artifact, localPath string) error
+
+	// ListArtifacts retrieves all artifacts.
+	ListArtifacts(ctx context.Context, page int, limit int) ([]data.Artifact, int64, error)
+
+	// ExportArtifacts retrieves every artifact for the IOC manifest.
+	ExportArtifacts(ctx context.Context) ([]data.Artifact, error)
+}
+
+// artifactService implements the ArtifactService interface.
+type artifactService struct {
+	store data.DataStore
+}
+
+// NewArtifactService creates a new instance of artifactService.
+func NewArtifactService(store data.DataStore) ArtifactService {
+	return &artifactService{store: store}
+}
+
+// RecordArtifact stores an artifact. If localPath is set, size and hashes are computed from that file.
+func (s *artifactService) RecordArtifact(ctx context.Context, artifact *data.Artifact, localPath string) (err error) {
+	ctx, span := tracing.Start(ctx, "ArtifactService.RecordArtifact", attribute.String("simplec2.artifact_type", artifact.Type))
+	defer func() { tracing.End(span, err) }()
+
+	if localPath != "" {
+		size, md5Sum, sha256Sum, err := hashArtifact(localPath)
+		if err != nil {
+			return fmt.Errorf("failed to hash artifact: %w", err)
+		}
+		artifact.Size = size
+		artifact.MD5 = md5Sum
+		artifact.SHA256 = sha256Sum
+	}
+
+	if artifact.Engagement == "" {
+		artifact.Engagement = engagementForNew(ctx)
+	}
+	if err := s.store.WithContext(ctx).CreateArtifact(artifact); err != nil {
+		return fmt.Errorf("failed to create artifact: %w", err)
+	}
+	return nil
+}
+
+// ListArtifacts retrieves all artifacts.
+func (s *artifactService) ListArtifacts(ctx context.Context, page int, limit int) ([]data.Artifact, int64, error) {
+	artifacts, total, err := s.store.GetArtifacts(EngagementFromContext(ctx), page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+	return artifacts, total, nil
+}
+
+// ExportArtifacts retrieves every artifact for the IOC manifest.
+func (s *artifactService) ExportArtifacts(ctx context.Context) ([]data.Artifact, error) {
+	artifacts, err := s.store.GetAllArtifacts(EngagementFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to export artifacts: %w", err)
+	}
+	return artifacts, nil
+}
+
+// hashArtifact returns the size, MD5 and SHA256 of a file.
+func hashArtifact(path string) (int64, string, string, error) {
+	f, err := filecrypt.Open(path)
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer f.Close()
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), f)
+	if err != nil {
+		return 0, "", "", err
+	}
+	return size, hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)), nil
+}
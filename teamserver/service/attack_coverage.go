@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"simplec2/teamserver/commands"
+)
+
+// tacticOrder is the order of the ATT&CK Enterprise tactics in the coverage matrix.
+var tacticOrder = []string{
+	"reconnaissance", "resource-development", "initial-access", "execution", "persistence",
+	"privilege-escalation", "defense-evasion", "credential-access", "discovery", "lateral-movement",
+	"collection", "command-and-control", "exfiltration", "impact",
+}
+
+// TechniqueCoverage is how an ATT&CK technique was used in an engagement.
+type TechniqueCoverage struct {
+	commands.Technique
+	Tasks     int       `json:"tasks"`
+	Beacons   []string  `json:"beacons"`
+	Commands  []string  `json:"commands"`
+	Operators []string  `json:"operators"`
+	FirstUsed time.Time `json:"first_used"`
+	LastUsed  time.Time `json:"last_used"`
+}
+
+// TacticCoverage groups the techniques used for one tactic.
+type TacticCoverage struct {
+	Tactic     string              `json:"tactic"`
+	Techniques []TechniqueCoverage `json:"techniques"`
+}
+
+// NavigatorLayer is an ATT&CK Navigator layer file, see https://github.com/mitre-attack/attack-navigator.
+type NavigatorLayer struct {
+	Name        string               `json:"name"`
+	Versions    map[string]string    `json:"versions"`
+	Domain      string               `json:"domain"`
+	Description string               `json:"description"`
+	Techniques  []NavigatorTechnique `json:"techniques"`
+	Gradient    struct {
+		Colors   []string `json:"colors"`
+		MinValue int      `json:"minValue"`
+		MaxValue int      `json:"maxValue"`
+	} `json:"gradient"`
+}
+
+// NavigatorTechnique is a scored technique of a Navigator layer.
+type NavigatorTechnique struct {
+	TechniqueID string `json:"techniqueID"`
+	Tactic      string `json:"tactic,omitempty"`
+	Score       int    `json:"score"`
+	Comment     string `json:"comment"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// TechniqueCoverage returns the ATT&CK techniques of the tasks dispatched in the engagement, grouped by tactic.
+func (s *taskService) TechniqueCoverage(ctx context.Context) ([]TacticCoverage, error) {
+	tasks, err := s.store.GetTasksWithTechniques(EngagementFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tasks: %w", err)
+	}
+
+	byID := make(map[string]*TechniqueCoverage)
+	for _, task := range tasks {
+		for _, id := range task.Techniques {
+			coverage := byID[id]
+			if coverage == nil {
+				technique, _ := commands.LookupTechnique(id)
+				coverage = &TechniqueCoverage{Technique: technique, FirstUsed: *task.DispatchedAt}
+				byID[id] = coverage
+			}
+			coverage.Tasks++
+			coverage.Beacons = appendUnique(coverage.Beacons, task.BeaconID)
+			coverage.Commands = appendUnique(coverage.Commands, task.Command)
+			if task.Operator != "" {
+				coverage.Operators = appendUnique(coverage.Operators, task.Operator)
+			}
+			coverage.LastUsed = *task.DispatchedAt
+		}
+	}
+
+	byTactic := make(map[string][]TechniqueCoverage)
+	for _, coverage := range byID {
+		byTactic[coverage.Tactic] = append(byTactic[coverage.Tactic], *coverage)
+	}
+	var matrix []TacticCoverage
+	appendTactic := func(tactic string) {
+		techniques := byTactic[tactic]
+		sort.Slice(techniques, func(i, j int) bool { return techniques[i].ID < techniques[j].ID })
+		matrix = append(matrix, TacticCoverage{Tactic: tactic, Techniques: techniques})
+		delete(byTactic, tactic)
+	}
+	for _, tactic := range tacticOrder {
+		if len(byTactic[tactic]) > 0 {
+			appendTactic(tactic)
+		}
+	}
+	// Techniques missing from the catalog have no tactic and come last
+	if len(byTactic[""]) > 0 {
+		appendTactic("")
+	}
+	return matrix, nil
+}
+
+// NewNavigatorLayer converts a coverage matrix to an ATT&CK Navigator layer, scoring each technique
+// with the number of tasks that used it.
+func NewNavigatorLayer(engagement string, matrix []TacticCoverage) *NavigatorLayer {
+	layer := &NavigatorLayer{
+		Name:        "SimpleC2 - " + engagement,
+		Versions:    map[string]string{"attack": "15", "navigator": "5.0.0", "layer": "4.5"},
+		Domain:      "enterprise-attack",
+		Description: fmt.Sprintf("Techniques used in engagement '%s', scored by the number of tasks", engagement),
+		Techniques:  []NavigatorTechnique{},
+	}
+	layer.Gradient.Colors = []string{"#ffe766", "#ff6666"}
+	for _, tactic := range matrix {
+		for _, technique := range tactic.Techniques {
+			layer.Techniques = append(layer.Techniques, NavigatorTechnique{
+				TechniqueID: technique.ID,
+				Tactic:      technique.Tactic,
+				Score:       technique.Tasks,
+				Comment:     fmt.Sprintf("%d tasks on %d beacons (%v), %s to %s", technique.Tasks, len(technique.Beacons), technique.Commands, technique.FirstUsed.UTC().Format(time.RFC3339), technique.LastUsed.UTC().Format(time.RFC3339)),
+				Enabled:     true,
+			})
+			layer.Gradient.MaxValue = max(layer.Gradient.MaxValue, technique.Tasks)
+		}
+	}
+	return layer
+}
+
+// appendUnique appends a value to a slice unless it is already in it.
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
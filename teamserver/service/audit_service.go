@@ -0,0 +1,243 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/siem"
+)
+
+// auditExportBatch is the number of entries read at a time when exporting or archiving.
+const auditExportBatch = 1000
+
+// SecurityAlert is a security-relevant event that is not a plain API request,
+// such as a replayed refresh token or a rejected certificate.
+type SecurityAlert struct {
+	Name     string // e.g. "refresh_token_reuse"
+	Severity int    // 0 (lowest) to 10 (highest)
+	Username string
+	SourceIP string
+	Message  string
+	Fields   map[string]string
+}
+
+// AuditService defines the interface for the operator audit log.
+type AuditService interface {
+	// Record queues an entry for writing. It never blocks the caller.
+	Record(entry *data.AuditLog)
+
+	// Alert reports a security alert. It is logged and forwarded to the SIEM, if one is configured.
+	Alert(alert *SecurityAlert)
+
+	// ListAuditLogs retrieves audit log entries with optional filtering and pagination.
+	ListAuditLogs(ctx context.Context, query *data.AuditLogQuery) ([]data.AuditLog, int64, error)
+
+	// ExportAuditLogs calls fn with every entry matching the query in batches, oldest first.
+	ExportAuditLogs(ctx context.Context, query *data.AuditLogQuery, fn func(batch []data.AuditLog) error) error
+
+	// ApplyRetention purges entries older than the retention period, archiving them first if configured.
+	ApplyRetention(ctx context.Context) (int64, error)
+
+	// StartRetentionRoutine applies the retention policy periodically in the background.
+	StartRetentionRoutine(interval time.Duration)
+
+	// Close writes all queued entries and stops the background writer.
+	Close()
+}
+
+// auditService implements the AuditService interface.
+type auditService struct {
+	store         data.DataStore
+	writer        *auditWriter
+	retentionDays int
+	archiveDir    string
+	forwarder     *siem.Forwarder
+}
+
+// NewAuditService creates a new instance of auditService and starts its background writer.
+// forwarder may be nil if no SIEM is configured.
+func NewAuditService(store data.DataStore, cfg config.AuditConfig, forwarder *siem.Forwarder) AuditService {
+	return &auditService{
+		store:         store,
+		writer:        newAuditWriter(store, cfg.QueueSize, cfg.BatchSize),
+		retentionDays: cfg.RetentionDays,
+		archiveDir:    cfg.ArchiveDir,
+		forwarder:     forwarder,
+	}
+}
+
+// Record queues an entry for writing. It never blocks the caller.
+func (s *auditService) Record(entry *data.AuditLog) {
+	s.writer.enqueue(entry)
+	if s.forwarder != nil {
+		s.forwarder.Forward(auditEvent(entry))
+	}
+}
+
+// Alert reports a security alert. It is logged and forwarded to the SIEM, if one is configured.
+func (s *auditService) Alert(alert *SecurityAlert) {
+	logger.Warnf("Security alert %s: %s (user: %s, source: %s)", alert.Name, alert.Message, alert.Username, alert.SourceIP)
+	if s.forwarder != nil {
+		s.forwarder.Forward(&siem.Event{
+			Time:     time.Now(),
+			Type:     siem.TypeAlert,
+			Name:     alert.Name,
+			Severity: alert.Severity,
+			Username: alert.Username,
+			SourceIP: alert.SourceIP,
+			Message:  alert.Message,
+			Fields:   alert.Fields,
+		})
+	}
+}
+
+// auditEvent converts an audit entry for the SIEM.
+// Denied requests rank highest, then server errors, other client errors and successful changes.
+func auditEvent(entry *data.AuditLog) *siem.Event {
+	severity := 2
+	switch {
+	case entry.Status == 401 || entry.Status == 403:
+		severity = 6
+	case entry.Status >= 500:
+		severity = 4
+	case entry.Status >= 400:
+		severity = 3
+	}
+	route := entry.Route
+	if route == "" {
+		route = entry.Path
+	}
+	return &siem.Event{
+		Time:     entry.CreatedAt,
+		Type:     siem.TypeAudit,
+		Name:     entry.Method + " " + route,
+		Severity: severity,
+		Username: entry.Username,
+		SourceIP: entry.ClientIP,
+		Message:  fmt.Sprintf("%s %s -> %d", entry.Method, entry.Path, entry.Status),
+		Fields: map[string]string{
+			"method":      entry.Method,
+			"path":        entry.Path,
+			"status":      fmt.Sprint(entry.Status),
+			"auth_method": entry.AuthMethod,
+			"role":        entry.Role,
+			"request_id":  entry.RequestID,
+		},
+	}
+}
+
+// ListAuditLogs retrieves audit log entries with optional filtering and pagination.
+func (s *auditService) ListAuditLogs(ctx context.Context, query *data.AuditLogQuery) ([]data.AuditLog, int64, error) {
+	logs, total, err := s.store.GetAuditLogs(query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit logs: %w", err)
+	}
+	return logs, total, nil
+}
+
+// ExportAuditLogs calls fn with every entry matching the query in batches, oldest first.
+func (s *auditService) ExportAuditLogs(ctx context.Context, query *data.AuditLogQuery, fn func(batch []data.AuditLog) error) error {
+	if err := s.store.IterateAuditLogs(query, auditExportBatch, fn); err != nil {
+		return fmt.Errorf("failed to export audit logs: %w", err)
+	}
+	return nil
+}
+
+// ApplyRetention purges entries older than the retention period, archiving them first if configured.
+func (s *auditService) ApplyRetention(ctx context.Context) (int64, error) {
+	if s.retentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -s.retentionDays)
+
+	if s.archiveDir != "" {
+		if err := s.archive(cutoff); err != nil {
+			return 0, fmt.Errorf("failed to archive audit logs: %w", err)
+		}
+	}
+	count, err := s.store.DeleteAuditLogsBefore(cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge audit logs: %w", err)
+	}
+	return count, nil
+}
+
+// archive writes all entries older than cutoff to a gzipped JSONL file.
+// No file is created if there is nothing to archive.
+func (s *auditService) archive(cutoff time.Time) error {
+	var file *os.File
+	var gz *gzip.Writer
+	var enc *json.Encoder
+	path := filepath.Join(s.archiveDir, fmt.Sprintf("audit-%s.jsonl.gz", time.Now().Format("20060102-150405")))
+
+	err := s.store.IterateAuditLogs(&data.AuditLogQuery{Until: &cutoff}, auditExportBatch, func(batch []data.AuditLog) error {
+		if file == nil {
+			if err := os.MkdirAll(s.archiveDir, 0700); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+			file = f
+			gz = gzip.NewWriter(file)
+			enc = json.NewEncoder(gz)
+		}
+		for i := range batch {
+			if err := enc.Encode(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if file == nil {
+		return err
+	}
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Never purge entries whose archive is incomplete
+		os.Remove(path)
+		return err
+	}
+	logger.Infof("Archived audit logs older than %s to %s", cutoff.Format(time.RFC3339), path)
+	return nil
+}
+
+// StartRetentionRoutine applies the retention policy periodically in the background.
+func (s *auditService) StartRetentionRoutine(interval time.Duration) {
+	if s.retentionDays <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			count, err := s.ApplyRetention(context.Background())
+			if err != nil {
+				logger.Errorf("Audit log retention failed: %v", err)
+			} else if count > 0 {
+				logger.Infof("Purged %d audit log entries older than %d days", count, s.retentionDays)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Close writes all queued entries and stops the background writer.
+func (s *auditService) Close() {
+	s.writer.close()
+}
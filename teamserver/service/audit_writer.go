@@ -0,0 +1,116 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+)
+
+const (
+	defaultAuditQueueSize = 10000
+	defaultAuditBatchSize = 100
+	auditFlushInterval    = time.Second
+)
+
+// auditWriter writes audit entries to the store in batches on a background goroutine,
+// so that recording an entry never blocks a request.
+// The queue is bounded; under pressure the oldest queued entries are dropped.
+type auditWriter struct {
+	store     data.DataStore
+	queue     chan *data.AuditLog
+	batchSize int
+	dropped   atomic.Int64
+
+	closeOnce sync.Once
+	done      chan struct{}
+	finished  chan struct{}
+}
+
+func newAuditWriter(store data.DataStore, queueSize, batchSize int) *auditWriter {
+	if queueSize <= 0 {
+		queueSize = defaultAuditQueueSize
+	}
+	if batchSize <= 0 {
+		batchSize = defaultAuditBatchSize
+	}
+	w := &auditWriter{
+		store:     store,
+		queue:     make(chan *data.AuditLog, queueSize),
+		batchSize: batchSize,
+		done:      make(chan struct{}),
+		finished:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// enqueue adds an entry, dropping the oldest queued entry if the queue is full.
+func (w *auditWriter) enqueue(entry *data.AuditLog) {
+	for {
+		select {
+		case w.queue <- entry:
+			return
+		default:
+		}
+		select {
+		case <-w.queue:
+			w.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+func (w *auditWriter) run() {
+	defer close(w.finished)
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]data.AuditLog, 0, w.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.store.CreateAuditLogs(batch); err != nil {
+			logger.Errorf("Failed to write %d audit log entries: %v", len(batch), err)
+		}
+		batch = make([]data.AuditLog, 0, w.batchSize)
+	}
+
+	for {
+		select {
+		case entry := <-w.queue:
+			batch = append(batch, *entry)
+			if len(batch) >= w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			if n := w.dropped.Swap(0); n > 0 {
+				logger.Warnf("Audit log queue full, dropped %d oldest entries", n)
+			}
+		case <-w.done:
+			// Drain whatever is still queued before stopping
+			for {
+				select {
+				case entry := <-w.queue:
+					batch = append(batch, *entry)
+					if len(batch) >= w.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// close flushes all queued entries and stops the writer.
+func (w *auditWriter) close() {
+	w.closeOnce.Do(func() { close(w.done) })
+	<-w.finished
+}
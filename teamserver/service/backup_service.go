@@ -0,0 +1,609 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/filecrypt"
+)
+
+// backupFormatVersion is the version of the backup archive layout.
+const backupFormatVersion = 1
+
+// Kinds of backups, part of the archive name.
+const (
+	backupManual    = "manual"
+	backupScheduled = "scheduled"
+	backupImported  = "imported"
+)
+
+// backupNamePattern matches the names of backup archives.
+var backupNamePattern = regexp.MustCompile(`^simplec2-(manual|scheduled|imported)-\d{8}-\d{6}\.tar\.gz$`)
+
+// ErrBackupNotFound is returned for names that aren't a backup in the backup directory.
+var ErrBackupNotFound = errors.New("backup not found")
+
+// ErrBackupBusy is returned when a backup or restore is already running.
+var ErrBackupBusy = errors.New("a backup or restore is already running")
+
+// ErrInvalidBackup is returned for archives that aren't a TeamServer backup.
+var ErrInvalidBackup = errors.New("not a valid TeamServer backup")
+
+// BackupManifest describes the content of a backup archive.
+type BackupManifest struct {
+	Version   int                `json:"version"`
+	CreatedAt time.Time          `json:"created_at"`
+	CreatedBy string             `json:"created_by"`
+	Database  *data.DatabaseDump `json:"database"`
+	// Files in the loot and uploads directories when the backup was taken. Only their
+	// manifests are part of the backup, the files must be backed up separately.
+	Loot    []BackupFile `json:"loot"`
+	Uploads []BackupFile `json:"uploads"`
+}
+
+// BackupFile is a file in the loot or uploads directory, as stored on disk.
+type BackupFile struct {
+	Path   string `json:"path"` // Relative to the directory, with forward slashes
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// BackupInfo is a backup archive in the backup directory.
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"` // "manual", "scheduled" or "imported"
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RestoreReport is the result of restoring a backup.
+type RestoreReport struct {
+	Backup    string           `json:"backup"`
+	CreatedAt time.Time        `json:"created_at"`
+	Tables    map[string]int64 `json:"tables"`
+	// Loot and uploaded files of the manifests that are missing or differ on disk, e.g. "loot/acme/..."
+	MissingFiles []string `json:"missing_files"`
+	ChangedFiles []string `json:"changed_files"`
+	// The TeamServer keeps state in memory (event sequence, listeners, sessions) and must be
+	// restarted after a restore through the API.
+	RestartRequired bool `json:"restart_required"`
+}
+
+// BackupService defines the interface for backing up and restoring the TeamServer database.
+type BackupService interface {
+	// CreateBackup writes a new backup archive to the backup directory.
+	CreateBackup(ctx context.Context, createdBy string) (*BackupInfo, error)
+
+	// ListBackups lists the backups in the backup directory, newest first.
+	ListBackups() ([]BackupInfo, error)
+
+	// OpenBackup opens a backup archive for download. The archive is decrypted as it is read.
+	OpenBackup(name string) (*BackupInfo, *filecrypt.File, error)
+
+	// DeleteBackup deletes a backup archive.
+	DeleteBackup(name string) error
+
+	// ImportBackup stores an uploaded backup archive in the backup directory, so it can be restored.
+	ImportBackup(r io.Reader) (*BackupInfo, error)
+
+	// RestoreBackup replaces the database content with a backup from the backup directory.
+	RestoreBackup(ctx context.Context, name string) (*RestoreReport, error)
+
+	// RestoreArchive replaces the database content with the backup archive at path.
+	RestoreArchive(ctx context.Context, path string) (*RestoreReport, error)
+
+	// StartSchedule takes backups periodically in the background, if backup.interval_hours is set.
+	StartSchedule()
+
+	// ExportBeacons writes a signed archive of beacons and their history to w, for importing on another TeamServer.
+	ExportBeacons(ctx context.Context, beaconIDs []string, exportedBy string, w io.Writer) error
+
+	// ImportBeacons creates the beacons of an archive written by ExportBeacons in the engagement of ctx.
+	ImportBeacons(ctx context.Context, r io.Reader, options BeaconImportOptions) (*BeaconImportReport, error)
+}
+
+// backupService implements the BackupService interface.
+type backupService struct {
+	store      data.DataStore
+	config     config.BackupConfig
+	lootDir    string
+	uploadsDir string
+	running    sync.Mutex // Held while a backup or restore runs
+}
+
+// NewBackupService creates a new instance of backupService.
+func NewBackupService(store data.DataStore, cfg config.BackupConfig, lootDir, uploadsDir string) BackupService {
+	return &backupService{
+		store:      store,
+		config:     cfg,
+		lootDir:    lootDir,
+		uploadsDir: uploadsDir,
+	}
+}
+
+// CreateBackup writes a new backup archive to the backup directory.
+func (s *backupService) CreateBackup(ctx context.Context, createdBy string) (*BackupInfo, error) {
+	return s.createBackup(ctx, backupManual, createdBy)
+}
+
+func (s *backupService) createBackup(ctx context.Context, kind, createdBy string) (*BackupInfo, error) {
+	if !s.running.TryLock() {
+		return nil, ErrBackupBusy
+	}
+	defer s.running.Unlock()
+
+	dir := s.config.GetDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(dir, ".dump-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest := &BackupManifest{Version: backupFormatVersion, CreatedAt: time.Now().UTC(), CreatedBy: createdBy}
+	if manifest.Database, err = s.store.DumpDatabase(ctx, tmpDir); err != nil {
+		return nil, fmt.Errorf("failed to dump database: %w", err)
+	}
+	if manifest.Loot, err = fileManifest(s.lootDir); err != nil {
+		return nil, fmt.Errorf("failed to list loot files: %w", err)
+	}
+	if manifest.Uploads, err = fileManifest(s.uploadsDir); err != nil {
+		return nil, fmt.Errorf("failed to list uploaded files: %w", err)
+	}
+
+	name := backupName(kind, manifest.CreatedAt)
+	target := filepath.Join(dir, name)
+	if err := writeBackupArchive(target, manifest, tmpDir); err != nil {
+		return nil, err
+	}
+	logger.Ctx(ctx).Infof("Database backup %s written by %s", name, createdBy)
+	return backupInfo(target)
+}
+
+// backupName returns the archive name of a backup taken at t.
+func backupName(kind string, t time.Time) string {
+	return fmt.Sprintf("simplec2-%s-%s.tar.gz", kind, t.UTC().Format("20060102-150405"))
+}
+
+// writeBackupArchive packs the manifest and the table dumps in dumpDir into a tar.gz archive.
+// The archive is encrypted if file encryption is enabled, and only appears once complete.
+func writeBackupArchive(target string, manifest *BackupManifest, dumpDir string) (err error) {
+	partPath := target + ".part"
+	file, err := filecrypt.Create(partPath, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create backup archive: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(partPath)
+		}
+	}()
+
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to encode backup manifest: %w", err)
+	}
+	if err = writeTarEntry(tw, "manifest.json", manifestJSON, manifest.CreatedAt); err != nil {
+		file.Close()
+		return err
+	}
+	tables := make([]string, 0, len(manifest.Database.Tables))
+	for table := range manifest.Database.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		if err = addTarFile(tw, "database/"+table+".gob", filepath.Join(dumpDir, table+".gob")); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err = tw.Close(); err == nil {
+		err = gz.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write backup archive: %w", err)
+	}
+	if err = os.Rename(partPath, target); err != nil {
+		return fmt.Errorf("failed to move backup archive into place: %w", err)
+	}
+	return nil
+}
+
+// writeTarEntry adds a file with the given content to a tar archive.
+func writeTarEntry(tw *tar.Writer, name string, content []byte, modTime time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), ModTime: modTime}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write backup archive: %w", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		return fmt.Errorf("failed to write backup archive: %w", err)
+	}
+	return nil
+}
+
+// addTarFile copies a file into a tar archive.
+func addTarFile(tw *tar.Writer, name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read table dump: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read table dump: %w", err)
+	}
+	header := &tar.Header{Name: name, Mode: 0600, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write backup archive: %w", err)
+	}
+	if _, err := io.Copy(tw, file); err != nil {
+		return fmt.Errorf("failed to write backup archive: %w", err)
+	}
+	return nil
+}
+
+// fileManifest lists the files under dir with their size and SHA256, as stored on disk
+// (encrypted, if file encryption is enabled). A missing directory has no files.
+func fileManifest(dir string) ([]BackupFile, error) {
+	files := []BackupFile{}
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		size, hash, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, BackupFile{Path: filepath.ToSlash(rel), Size: size, SHA256: hash})
+		return nil
+	})
+	return files, err
+}
+
+// hashFile returns the size and hex SHA256 of a file.
+func hashFile(p string) (int64, string, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ListBackups lists the backups in the backup directory, newest first.
+func (s *backupService) ListBackups() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(s.config.GetDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []BackupInfo{}, nil
+		}
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+	backups := []BackupInfo{}
+	for _, entry := range entries {
+		if !backupNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := backupInfo(filepath.Join(s.config.GetDir(), entry.Name()))
+		if err != nil {
+			continue // Deleted meanwhile
+		}
+		backups = append(backups, *info)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// backupInfo describes the backup archive at path.
+func backupInfo(p string) (*BackupInfo, error) {
+	stat, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(p)
+	info := &BackupInfo{Name: name, Size: stat.Size(), CreatedAt: stat.ModTime()}
+	if match := backupNamePattern.FindStringSubmatch(name); match != nil {
+		info.Kind = match[1]
+		// Imported archives are named after the import, not when they were taken
+		if info.Kind != backupImported {
+			stamp := strings.TrimSuffix(strings.TrimPrefix(name, "simplec2-"+info.Kind+"-"), ".tar.gz")
+			if t, err := time.Parse("20060102-150405", stamp); err == nil {
+				info.CreatedAt = t
+			}
+		}
+	}
+	return info, nil
+}
+
+// backupPath returns the path of a backup in the backup directory.
+func (s *backupService) backupPath(name string) (string, error) {
+	if !backupNamePattern.MatchString(name) {
+		return "", ErrBackupNotFound
+	}
+	p := filepath.Join(s.config.GetDir(), name)
+	if _, err := os.Stat(p); err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrBackupNotFound
+		}
+		return "", err
+	}
+	return p, nil
+}
+
+// OpenBackup opens a backup archive for download.
+func (s *backupService) OpenBackup(name string) (*BackupInfo, *filecrypt.File, error) {
+	p, err := s.backupPath(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := backupInfo(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := filecrypt.Open(p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	return info, file, nil
+}
+
+// DeleteBackup deletes a backup archive.
+func (s *backupService) DeleteBackup(name string) error {
+	p, err := s.backupPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		return fmt.Errorf("failed to delete backup: %w", err)
+	}
+	return nil
+}
+
+// ImportBackup stores an uploaded backup archive in the backup directory.
+func (s *backupService) ImportBackup(r io.Reader) (*BackupInfo, error) {
+	dir := s.config.GetDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	target := filepath.Join(dir, backupName(backupImported, time.Now()))
+	partPath := target + ".part"
+	file, err := filecrypt.Create(partPath, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store backup: %w", err)
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return nil, fmt.Errorf("failed to store backup: %w", err)
+	}
+	if _, err := readBackupArchive(partPath, ""); err != nil {
+		os.Remove(partPath)
+		return nil, err
+	}
+	if err := os.Rename(partPath, target); err != nil {
+		os.Remove(partPath)
+		return nil, fmt.Errorf("failed to store backup: %w", err)
+	}
+	return backupInfo(target)
+}
+
+// RestoreBackup replaces the database content with a backup from the backup directory.
+func (s *backupService) RestoreBackup(ctx context.Context, name string) (*RestoreReport, error) {
+	p, err := s.backupPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.RestoreArchive(ctx, p)
+}
+
+// RestoreArchive replaces the database content with the backup archive at path, then checks
+// the loot and uploads directories against the backup's manifests.
+func (s *backupService) RestoreArchive(ctx context.Context, archive string) (*RestoreReport, error) {
+	if !s.running.TryLock() {
+		return nil, ErrBackupBusy
+	}
+	defer s.running.Unlock()
+
+	if err := os.MkdirAll(s.config.GetDir(), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(s.config.GetDir(), ".restore-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest, err := readBackupArchive(archive, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.RestoreDatabase(ctx, tmpDir, manifest.Database); err != nil {
+		return nil, fmt.Errorf("failed to restore database: %w", err)
+	}
+	logger.Ctx(ctx).Warnf("Database restored from backup %s taken at %s", filepath.Base(archive), manifest.CreatedAt.Format(time.RFC3339))
+
+	report := &RestoreReport{
+		Backup:       filepath.Base(archive),
+		CreatedAt:    manifest.CreatedAt,
+		Tables:       manifest.Database.Tables,
+		MissingFiles: []string{},
+		ChangedFiles: []string{},
+	}
+	verifyFiles(report, "loot", s.lootDir, manifest.Loot)
+	verifyFiles(report, "uploads", s.uploadsDir, manifest.Uploads)
+	if len(report.MissingFiles) > 0 || len(report.ChangedFiles) > 0 {
+		logger.Ctx(ctx).Warnf("Restored backup references %d missing and %d changed files", len(report.MissingFiles), len(report.ChangedFiles))
+	}
+	return report, nil
+}
+
+// readBackupArchive reads the manifest of a backup archive and, if dumpDir is set, extracts its
+// table dumps there.
+func readBackupArchive(archive, dumpDir string) (*BackupManifest, error) {
+	file, err := filecrypt.Open(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	defer gz.Close()
+
+	var manifest *BackupManifest
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		switch dir, name := path.Split(header.Name); {
+		case header.Name == "manifest.json":
+			manifest = &BackupManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("%w: invalid manifest: %v", ErrInvalidBackup, err)
+			}
+			if manifest.Version != backupFormatVersion || manifest.Database == nil {
+				return nil, fmt.Errorf("%w: unsupported backup format version %d", ErrInvalidBackup, manifest.Version)
+			}
+			if dumpDir == "" {
+				return manifest, nil
+			}
+		case dir == "database/" && strings.HasSuffix(name, ".gob") && name == filepath.Base(name):
+			if dumpDir == "" {
+				continue
+			}
+			if err := extractTarFile(tr, filepath.Join(dumpDir, name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: manifest.json is missing", ErrInvalidBackup)
+	}
+	return manifest, nil
+}
+
+// extractTarFile writes the current entry of a tar archive to a file.
+func extractTarFile(tr *tar.Reader, p string) error {
+	file, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to extract backup: %w", err)
+	}
+	_, err = io.Copy(file, tr)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract backup: %w", err)
+	}
+	return nil
+}
+
+// verifyFiles compares the files under dir with a manifest and reports missing and changed ones.
+func verifyFiles(report *RestoreReport, prefix, dir string, files []BackupFile) {
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f.Path))
+		size, hash, err := hashFile(p)
+		switch {
+		case err != nil:
+			report.MissingFiles = append(report.MissingFiles, prefix+"/"+f.Path)
+		case size != f.Size || hash != f.SHA256:
+			report.ChangedFiles = append(report.ChangedFiles, prefix+"/"+f.Path)
+		}
+	}
+}
+
+// StartSchedule takes backups periodically in the background and deletes old scheduled backups.
+func (s *backupService) StartSchedule() {
+	if s.config.IntervalHours <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.config.IntervalHours) * time.Hour)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := s.createBackup(context.Background(), backupScheduled, "scheduler"); err != nil {
+				logger.Errorf("Scheduled database backup failed: %v", err)
+				continue
+			}
+			if err := s.pruneScheduled(); err != nil {
+				logger.Errorf("Failed to delete old backups: %v", err)
+			}
+		}
+	}()
+}
+
+// pruneScheduled deletes all but the newest backup.keep scheduled backups.
+func (s *backupService) pruneScheduled() error {
+	backups, err := s.ListBackups()
+	if err != nil {
+		return err
+	}
+	kept := 0
+	for _, backup := range backups {
+		if backup.Kind != backupScheduled {
+			continue
+		}
+		if kept++; kept <= s.config.GetKeep() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.config.GetDir(), backup.Name)); err != nil {
+			return err
+		}
+		logger.Infof("Deleted old backup %s", backup.Name)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"simplec2/teamserver/data"
+
+	"gorm.io/gorm"
+)
+
+// ErrBeaconClaimed is returned when an operator tasks or claims a beacon another operator has claimed.
+var ErrBeaconClaimed = errors.New("beacon is claimed by another operator")
+
+// ClaimBeacon reserves a beacon for an operator, so other operators can't task it until it is released.
+// Claiming a beacon again updates the note. With force, a claim held by another operator is taken over.
+func (s *beaconService) ClaimBeacon(ctx context.Context, beaconID string, operator string, note string, force bool) (*data.BeaconClaim, error) {
+	beacon, err := getBeacon(ctx, s.store, beaconID)
+	if err != nil {
+		return nil, fmt.Errorf("beacon not found: %w", err)
+	}
+
+	claim := &data.BeaconClaim{BeaconID: beacon.BeaconID, Operator: operator, Note: note, Engagement: beacon.Engagement}
+	existing, err := s.store.GetBeaconClaim(beacon.BeaconID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if err := s.store.CreateBeaconClaim(claim); err != nil {
+			// Another operator claimed the beacon in the meantime
+			if existing, getErr := s.store.GetBeaconClaim(beacon.BeaconID); getErr == nil && existing.Operator != operator {
+				return nil, fmt.Errorf("%w: %s", ErrBeaconClaimed, existing.Operator)
+			}
+			return nil, fmt.Errorf("failed to claim beacon: %w", err)
+		}
+		return claim, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to get beacon claim: %w", err)
+	case existing.Operator != operator && !force:
+		return nil, fmt.Errorf("%w: %s", ErrBeaconClaimed, existing.Operator)
+	}
+
+	if err := s.store.ReplaceBeaconClaim(claim); err != nil {
+		return nil, fmt.Errorf("failed to claim beacon: %w", err)
+	}
+	return claim, nil
+}
+
+// ReleaseBeacon removes the claim on a beacon. Only the operator holding the claim can release it, unless force is set.
+func (s *beaconService) ReleaseBeacon(ctx context.Context, beaconID string, operator string, force bool) (*data.BeaconClaim, error) {
+	if _, err := getBeacon(ctx, s.store, beaconID); err != nil {
+		return nil, fmt.Errorf("beacon not found: %w", err)
+	}
+	claim, err := s.store.GetBeaconClaim(beaconID)
+	if err != nil {
+		return nil, fmt.Errorf("beacon is not claimed: %w", err)
+	}
+	if claim.Operator != operator && !force {
+		return nil, fmt.Errorf("%w: %s", ErrBeaconClaimed, claim.Operator)
+	}
+	if err := s.store.DeleteBeaconClaim(beaconID); err != nil {
+		return nil, fmt.Errorf("failed to release beacon: %w", err)
+	}
+	return claim, nil
+}
+
+// ListClaims returns the beacon claims in the engagement.
+func (s *beaconService) ListClaims(ctx context.Context) ([]data.BeaconClaim, error) {
+	claims, err := s.store.GetBeaconClaims(EngagementFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list beacon claims: %w", err)
+	}
+	return claims, nil
+}
+
+// checkClaim returns ErrBeaconClaimed if another operator has claimed the beacon.
+// Tasks queued by the TeamServer itself (no operator) are never blocked.
+func checkClaim(store data.DataStore, beaconID string, operator string) error {
+	if operator == "" {
+		return nil
+	}
+	claim, err := store.GetBeaconClaim(beaconID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get beacon claim: %w", err)
+	}
+	if claim.Operator != operator {
+		return fmt.Errorf("%w: %s", ErrBeaconClaimed, claim.Operator)
+	}
+	return nil
+}
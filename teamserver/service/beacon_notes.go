@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"simplec2/teamserver/data"
+
+	"gorm.io/gorm"
+)
+
+// maxNoteLength is the longest note accepted, in characters.
+const maxNoteLength = 10000
+
+var (
+	// ErrNoteInvalid is returned for an empty or too long note.
+	ErrNoteInvalid = errors.New("invalid note")
+	// ErrNoteNotAuthor is returned when an operator edits or deletes another operator's note without force.
+	ErrNoteNotAuthor = errors.New("note was written by another operator")
+)
+
+// ListNotes returns the notes on a beacon, or on one of its tasks when taskID is set, oldest first.
+// beaconID can be empty when taskID is set; the task's beacon is used.
+func (s *beaconService) ListNotes(ctx context.Context, beaconID string, taskID string) ([]data.Note, error) {
+	beacon, err := s.noteTarget(ctx, beaconID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := s.store.GetNotes(beacon.BeaconID, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	return notes, nil
+}
+
+// AddNote records a note by an operator on a beacon, or on one of its tasks when taskID is set.
+// beaconID can be empty when taskID is set; the task's beacon is used.
+func (s *beaconService) AddNote(ctx context.Context, beaconID string, taskID string, author string, body string) (*data.Note, error) {
+	body, err := checkNoteBody(body)
+	if err != nil {
+		return nil, err
+	}
+	beacon, err := s.noteTarget(ctx, beaconID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	note := &data.Note{BeaconID: beacon.BeaconID, TaskID: taskID, Author: author, Body: body, Engagement: beacon.Engagement}
+	if err := s.store.CreateNote(note); err != nil {
+		return nil, fmt.Errorf("failed to add note: %w", err)
+	}
+	return note, nil
+}
+
+// UpdateNote replaces the body of a note. Only its author can edit it, unless force is set.
+func (s *beaconService) UpdateNote(ctx context.Context, id uint, operator string, body string, force bool) (*data.Note, error) {
+	body, err := checkNoteBody(body)
+	if err != nil {
+		return nil, err
+	}
+	note, err := s.getNote(ctx, id, operator, force)
+	if err != nil {
+		return nil, err
+	}
+
+	note.Body = body
+	note.UpdatedAt = time.Now()
+	if err := s.store.UpdateNote(note); err != nil {
+		return nil, fmt.Errorf("failed to update note: %w", err)
+	}
+	return note, nil
+}
+
+// DeleteNote removes a note. Only its author can delete it, unless force is set.
+func (s *beaconService) DeleteNote(ctx context.Context, id uint, operator string, force bool) (*data.Note, error) {
+	note, err := s.getNote(ctx, id, operator, force)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.DeleteNote(note.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete note: %w", err)
+	}
+	return note, nil
+}
+
+// getNote retrieves a note for an operator to change, treating notes of other engagements as not found.
+func (s *beaconService) getNote(ctx context.Context, id uint, operator string, force bool) (*data.Note, error) {
+	note, err := s.store.GetNote(id)
+	if err != nil {
+		return nil, fmt.Errorf("note not found: %w", err)
+	}
+	if !inEngagement(ctx, note.Engagement) {
+		return nil, fmt.Errorf("note not found: %w", gorm.ErrRecordNotFound)
+	}
+	if note.Author != operator && !force {
+		return nil, fmt.Errorf("%w: %s", ErrNoteNotAuthor, note.Author)
+	}
+	return note, nil
+}
+
+// noteTarget returns the beacon notes are attached to: the beacon itself, or the beacon of the
+// task when taskID is set. Beacons and tasks of other engagements are treated as not found.
+func (s *beaconService) noteTarget(ctx context.Context, beaconID string, taskID string) (*data.Beacon, error) {
+	if taskID != "" {
+		task, err := s.store.GetTask(taskID)
+		if err != nil {
+			return nil, fmt.Errorf("task not found: %w", err)
+		}
+		if !inEngagement(ctx, task.Engagement) || (beaconID != "" && task.BeaconID != beaconID) {
+			return nil, fmt.Errorf("task not found: %w", gorm.ErrRecordNotFound)
+		}
+		beaconID = task.BeaconID
+	}
+
+	beacon, err := getBeacon(ctx, s.store, beaconID)
+	if err != nil {
+		return nil, fmt.Errorf("beacon not found: %w", err)
+	}
+	return beacon, nil
+}
+
+// checkNoteBody trims a note and checks its length.
+func checkNoteBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", fmt.Errorf("%w: note is empty", ErrNoteInvalid)
+	}
+	if utf8.RuneCountInString(body) > maxNoteLength {
+		return "", fmt.Errorf("%w: note is longer than %d characters", ErrNoteInvalid, maxNoteLength)
+	}
+	return body, nil
+}
@@ -32,8 +32,35 @@ type BeaconService interface {
 	// SetBeaconSleep updates the sleep interval and jitter for a beacon.
 	SetBeaconSleep(ctx context.Context, beaconID string, sleep int, jitter int) error
 
-	// UpdateBeaconMetadata updates metadata fields (like Note) for a beacon.
+	// UpdateBeaconMetadata updates metadata fields (like HighValue) for a beacon.
 	UpdateBeaconMetadata(ctx context.Context, beaconID string, updates map[string]interface{}) error
+
+	// ArchiveBeacon hides a beacon from the default list; its tasks and loot are kept.
+	ArchiveBeacon(ctx context.Context, beaconID string) (*data.Beacon, error)
+
+	// RestoreBeacon brings an archived beacon back into the default list.
+	RestoreBeacon(ctx context.Context, beaconID string) (*data.Beacon, error)
+
+	// ClaimBeacon reserves a beacon for an operator; with force, another operator's claim is taken over.
+	ClaimBeacon(ctx context.Context, beaconID string, operator string, note string, force bool) (*data.BeaconClaim, error)
+
+	// ReleaseBeacon removes the claim on a beacon; with force, another operator's claim is removed.
+	ReleaseBeacon(ctx context.Context, beaconID string, operator string, force bool) (*data.BeaconClaim, error)
+
+	// ListClaims returns the beacon claims in the engagement.
+	ListClaims(ctx context.Context) ([]data.BeaconClaim, error)
+
+	// ListNotes returns the notes on a beacon, or on one of its tasks when taskID is set, oldest first.
+	ListNotes(ctx context.Context, beaconID string, taskID string) ([]data.Note, error)
+
+	// AddNote records a note by an operator on a beacon, or on one of its tasks when taskID is set.
+	AddNote(ctx context.Context, beaconID string, taskID string, author string, body string) (*data.Note, error)
+
+	// UpdateNote replaces the body of a note; with force, another operator's note is edited.
+	UpdateNote(ctx context.Context, id uint, operator string, body string, force bool) (*data.Note, error)
+
+	// DeleteNote removes a note; with force, another operator's note is removed.
+	DeleteNote(ctx context.Context, id uint, operator string, force bool) (*data.Note, error)
 }
 
 // ListQuery defines parameters for paginated and filtered queries.
@@ -42,6 +69,10 @@ type ListQuery struct {
 	Limit  int    `form:"limit,default=20"` // Items per page
 	Search string `form:"search"`           // Optional search/filter term
 	Status string `form:"status"`           // Optional status filter
+	// Archived beacons are hidden unless this is "true" (only archived) or "all"
+	Archived string `form:"archived"`
+	// Cursor pages by keyset instead of Page; see data.PageCursor
+	Cursor *data.PageCursor `form:"-"`
 }
 
 // beaconService implements the BeaconService interface.
@@ -70,6 +101,10 @@ func (s *beaconService) RegisterBeacon(ctx context.Context, metadata *bridge.Bea
 		ProcessName:     metadata.ProcessName,
 		PID:             metadata.Pid,
 		IsHighIntegrity: metadata.IsHighIntegrity,
+		Engagement:      DefaultEngagement,
+	}
+	if l, err := s.store.GetListener(listener); err == nil && l.Engagement != "" {
+		beacon.Engagement = l.Engagement
 	}
 
 	if err := s.store.CreateBeacon(beacon); err != nil {
@@ -94,15 +129,19 @@ func (s *beaconService) DeleteBeacon(ctx context.Context, beaconID string) error
 		if err := tx.Where("beacon_id = ?", beaconID).First(&beacon).Error; err != nil {
 			return err // Beacon not found, will cause rollback
 		}
+		if !inEngagement(ctx, beacon.Engagement) {
+			return gorm.ErrRecordNotFound
+		}
 
 		// 2. Create an exit task for the beacon
 		exitTask := data.Task{
-			TaskID:    "task-exit-" + uuid.New().String(),
-			BeaconID:  beaconID,
-			Command:   "exit",
-			Arguments: "",
-			Status:    "queued",
-			Source:    "system",
+			TaskID:     "task-exit-" + uuid.New().String(),
+			BeaconID:   beaconID,
+			Command:    "exit",
+			Arguments:  "",
+			Status:     "queued",
+			Source:     "system",
+			Engagement: beacon.Engagement,
 		}
 		if err := tx.Create(&exitTask).Error; err != nil {
 			return err // Task creation failed, will cause rollback
@@ -167,6 +206,8 @@ func (s *beaconService) DeleteBeacon(ctx context.Context, beaconID string) error
 
 		return nil
 	})
+	// The transaction bypasses the store's cache
+	s.store.InvalidateBeacon(beaconID)
 
 	if err != nil {
 		return fmt.Errorf("failed to delete beacon: %w", err)
@@ -192,38 +233,38 @@ func (s *beaconService) UpdateBeaconLastSeen(ctx context.Context, beaconID strin
 
 // GetBeacon retrieves a beacon by its ID.
 func (s *beaconService) GetBeacon(ctx context.Context, beaconID string) (*data.Beacon, error) {
-	beacon, err := s.store.GetBeacon(beaconID)
+	beacon, err := getBeacon(ctx, s.store, beaconID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get beacon: %w", err)
 	}
-	s.calculateStatus(beacon)
 	return beacon, nil
 }
 
 // ListBeacons retrieves all beacons with optional filtering and pagination.
 func (s *beaconService) ListBeacons(ctx context.Context, query *ListQuery) ([]data.Beacon, int64, error) {
 	storeQuery := &data.BeaconQuery{
-		Page:   query.Page,
-		Limit:  query.Limit,
-		Search: query.Search,
-		Status: query.Status,
+		Page:       query.Page,
+		Limit:      query.Limit,
+		Search:     query.Search,
+		Status:     query.Status,
+		Engagement: EngagementFromContext(ctx),
+		Archived:   query.Archived,
+		Cursor:     query.Cursor,
 	}
 	beacons, total, err := s.store.GetBeacons(storeQuery)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to list beacons: %w", err)
 	}
-
-	for i := range beacons {
-		s.calculateStatus(&beacons[i])
-	}
-
 	return beacons, total, nil
 }
 
-// calculateStatus determines if a beacon is active based on LastSeen and Sleep time.
-func (s *beaconService) calculateStatus(beacon *data.Beacon) {
-	if beacon == nil {
-		return
+// BeaconStatus derives the status of a beacon from its LastSeen and Sleep time: "hibernating"
+// while it is expected to be silent, "inactive" once it missed its sleep interval by 2.5 times (at
+// least 60 seconds), "active" otherwise. A beacon tasked to exit stays "exiting". The status is
+// persisted by a background job, so reading beacons doesn't compute it.
+func BeaconStatus(beacon *data.Beacon, now time.Time) string {
+	if beacon.Status == "exiting" {
+		return beacon.Status
 	}
 
 	// Calculate threshold: Sleep * 2.5 (jitter buffer) or default to 60s if Sleep is small
@@ -231,21 +272,22 @@ func (s *beaconService) calculateStatus(beacon *data.Beacon) {
 	if thresholdSeconds < 60 {
 		thresholdSeconds = 60
 	}
-	
 	threshold := time.Duration(thresholdSeconds) * time.Second
-	timeSinceLastSeen := time.Since(beacon.LastSeen)
 
-	if timeSinceLastSeen > threshold {
-		beacon.Status = "inactive"
-	} else {
-		beacon.Status = "active"
+	// A hibernating beacon is expected to be silent until it wakes up (plus the usual grace period).
+	if beacon.HibernateUntil != nil && now.Before(beacon.HibernateUntil.Add(threshold)) {
+		return "hibernating"
 	}
+	if now.Sub(beacon.LastSeen) > threshold {
+		return "inactive"
+	}
+	return "active"
 }
 
 // SetBeaconSleep updates the sleep interval for a beacon.
 func (s *beaconService) SetBeaconSleep(ctx context.Context, beaconID string, sleep int, jitter int) error {
 	// Get the beacon first to ensure it exists
-	beacon, err := s.store.GetBeacon(beaconID)
+	beacon, err := getBeacon(ctx, s.store, beaconID)
 	if err != nil {
 		return fmt.Errorf("beacon not found: %w", err)
 	}
@@ -260,15 +302,15 @@ func (s *beaconService) SetBeaconSleep(ctx context.Context, beaconID string, sle
 	return nil
 }
 
-// UpdateBeaconMetadata updates metadata fields (like Note) for a beacon.
+// UpdateBeaconMetadata updates metadata fields (like HighValue) for a beacon.
 func (s *beaconService) UpdateBeaconMetadata(ctx context.Context, beaconID string, updates map[string]interface{}) error {
-	beacon, err := s.store.GetBeacon(beaconID)
+	beacon, err := getBeacon(ctx, s.store, beaconID)
 	if err != nil {
 		return fmt.Errorf("beacon not found: %w", err)
 	}
 
-	if note, ok := updates["note"].(string); ok {
-		beacon.Note = note
+	if highValue, ok := updates["high_value"].(bool); ok {
+		beacon.HighValue = highValue
 	}
 
 	if err := s.store.UpdateBeacon(beacon); err != nil {
@@ -277,3 +319,38 @@ func (s *beaconService) UpdateBeaconMetadata(ctx context.Context, beaconID strin
 
 	return nil
 }
+
+// ArchiveBeacon hides a beacon from the default list; its tasks and loot are kept.
+func (s *beaconService) ArchiveBeacon(ctx context.Context, beaconID string) (*data.Beacon, error) {
+	beacon, err := getBeacon(ctx, s.store, beaconID)
+	if err != nil {
+		return nil, fmt.Errorf("beacon not found: %w", err)
+	}
+	if beacon.ArchivedAt != nil {
+		return nil, fmt.Errorf("beacon is already archived")
+	}
+
+	now := time.Now()
+	if err := s.store.SetBeaconArchived(beaconID, &now); err != nil {
+		return nil, fmt.Errorf("failed to archive beacon: %w", err)
+	}
+	beacon.ArchivedAt = &now
+	return beacon, nil
+}
+
+// RestoreBeacon brings an archived beacon back into the default list.
+func (s *beaconService) RestoreBeacon(ctx context.Context, beaconID string) (*data.Beacon, error) {
+	beacon, err := getBeacon(ctx, s.store, beaconID)
+	if err != nil {
+		return nil, fmt.Errorf("beacon not found: %w", err)
+	}
+	if beacon.ArchivedAt == nil {
+		return nil, fmt.Errorf("beacon is not archived")
+	}
+
+	if err := s.store.SetBeaconArchived(beaconID, nil); err != nil {
+		return nil, fmt.Errorf("failed to restore beacon: %w", err)
+	}
+	beacon.ArchivedAt = nil
+	return beacon, nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"simplec2/teamserver/commands"
+	"simplec2/teamserver/data"
+
+	"gorm.io/gorm"
+)
+
+// settingsTaskSource is the source of the sleep tasks queued to apply beacon settings.
+const settingsTaskSource = "settings"
+
+// ErrInvalidSettings is returned for beacon settings the agent doesn't accept.
+var ErrInvalidSettings = errors.New("invalid beacon settings")
+
+// BeaconSettingsUpdate holds the settings to change; nil fields keep their intended value.
+type BeaconSettingsUpdate struct {
+	Sleep  *int
+	Jitter *int // Percentage, 0-99
+}
+
+// BeaconSettingsState is what a beacon confirmed running with, and what an operator last asked for.
+type BeaconSettingsState struct {
+	BeaconID string `json:"beacon_id"`
+	Sleep    int    `json:"sleep"`  // Confirmed by the beacon
+	Jitter   int    `json:"jitter"` // Confirmed by the beacon
+	// Intended is nil until settings are changed through the API; its Status tells whether the beacon
+	// applied them yet.
+	Intended *data.BeaconSettings `json:"intended"`
+}
+
+// GetBeaconSettings returns the confirmed and intended settings of a beacon.
+func (s *taskService) GetBeaconSettings(ctx context.Context, beaconID string) (*BeaconSettingsState, error) {
+	beacon, err := getBeacon(ctx, s.store, beaconID)
+	if err != nil {
+		return nil, fmt.Errorf("beacon not found: %w", err)
+	}
+	return s.settingsState(beacon)
+}
+
+// UpdateBeaconSettings records the settings an operator asks a beacon to use and queues the sleep task
+// applying them. They stay pending until the beacon runs the task.
+func (s *taskService) UpdateBeaconSettings(ctx context.Context, beaconID string, update BeaconSettingsUpdate, operator string) (*BeaconSettingsState, *data.Task, error) {
+	beacon, err := getBeacon(ctx, s.store, beaconID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("beacon not found: %w", err)
+	}
+	if update.Sleep == nil && update.Jitter == nil {
+		return nil, nil, fmt.Errorf("%w: sleep or jitter is required", ErrInvalidSettings)
+	}
+	state, err := s.settingsState(beacon)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Unchanged values are kept from the settings still pending, else from the confirmed ones
+	sleep, jitter := state.Sleep, state.Jitter
+	if state.Intended != nil && state.Intended.Status == data.SettingsPending {
+		sleep, jitter = state.Intended.Sleep, state.Intended.Jitter
+	}
+	if update.Sleep != nil {
+		sleep = *update.Sleep
+	}
+	if update.Jitter != nil {
+		jitter = *update.Jitter
+	}
+	if err := commands.ValidateSleep(sleep, jitter); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+
+	task, err := s.CreateTask(ctx, beacon.BeaconID, "sleep", fmt.Sprintf("%d %d", sleep, jitter), settingsTaskSource, operator, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	settings := &data.BeaconSettings{
+		BeaconID:    beacon.BeaconID,
+		Sleep:       sleep,
+		Jitter:      jitter,
+		TaskID:      task.TaskID,
+		Status:      data.SettingsPending,
+		RequestedBy: operator,
+		Engagement:  beacon.Engagement,
+	}
+	if err := s.store.ReplaceBeaconSettings(settings); err != nil {
+		return nil, nil, fmt.Errorf("failed to save beacon settings: %w", err)
+	}
+	state.Intended = settings
+	return state, task, nil
+}
+
+// ResolveBeaconSettings records the outcome of a finished settings task on the pending settings it
+// applies: confirmed once it completed, failed if it failed, timed out or was canceled. Returns the
+// settings of the beacon, or nil if the task didn't resolve pending settings.
+func (s *taskService) ResolveBeaconSettings(ctx context.Context, task *data.Task) (*BeaconSettingsState, error) {
+	if task.Command != "sleep" || task.Source != settingsTaskSource {
+		return nil, nil
+	}
+	var status string
+	switch task.Status {
+	case "completed":
+		status = data.SettingsConfirmed
+	case "failed", "timed_out", "canceled":
+		status = data.SettingsFailed
+	default:
+		return nil, nil
+	}
+	resolved, err := s.store.WithContext(ctx).ResolveBeaconSettings(task.BeaconID, task.TaskID, status, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to update beacon settings: %w", err)
+	}
+	// Settings requested again since the task was queued stay pending
+	if !resolved {
+		return nil, nil
+	}
+	beacon, err := getBeacon(ctx, s.store, task.BeaconID)
+	if err != nil {
+		return nil, fmt.Errorf("beacon not found: %w", err)
+	}
+	return s.settingsState(beacon)
+}
+
+// settingsState returns the confirmed settings of a beacon and the ones last requested for it.
+func (s *taskService) settingsState(beacon *data.Beacon) (*BeaconSettingsState, error) {
+	state := &BeaconSettingsState{BeaconID: beacon.BeaconID, Sleep: beacon.Sleep, Jitter: beacon.Jitter}
+	settings, err := s.store.GetBeaconSettings(beacon.BeaconID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return state, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get beacon settings: %w", err)
+	}
+	state.Intended = settings
+	return state, nil
+}
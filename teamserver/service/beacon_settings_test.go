@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"simplec2/teamserver/data"
+)
+
+// newSettingsTestService creates a task service with a beacon running with a 10s sleep and 5% jitter.
+func newSettingsTestService(t *testing.T) (data.DataStore, TaskService) {
+	t.Helper()
+	store := newTestStore(t)
+	beacon := &data.Beacon{BeaconID: "beacon-1", Sleep: 10, Jitter: 5, Status: "active", FirstSeen: time.Now(), LastSeen: time.Now()}
+	if err := store.CreateBeacon(beacon); err != nil {
+		t.Fatalf("CreateBeacon: %v", err)
+	}
+	return store, NewTaskService(store)
+}
+
+// intPtr returns a pointer to v.
+func intPtr(v int) *int {
+	return &v
+}
+
+// updateSettings changes the settings of beacon-1 or fails the test.
+func updateSettings(t *testing.T, tasks TaskService, update BeaconSettingsUpdate) (*BeaconSettingsState, *data.Task) {
+	t.Helper()
+	state, task, err := tasks.UpdateBeaconSettings(context.Background(), "beacon-1", update, "alice")
+	if err != nil {
+		t.Fatalf("UpdateBeaconSettings: %v", err)
+	}
+	return state, task
+}
+
+// finishTask stores a new status of a task and resolves the settings it applies.
+func finishTask(t *testing.T, store data.DataStore, tasks TaskService, task *data.Task, status string) *BeaconSettingsState {
+	t.Helper()
+	task.Status = status
+	if err := store.UpdateTask(task); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+	state, err := tasks.ResolveBeaconSettings(context.Background(), task)
+	if err != nil {
+		t.Fatalf("ResolveBeaconSettings: %v", err)
+	}
+	return state
+}
+
+// TestBeaconSettingsPartialUpdate tests that fields left out of an update keep the value still
+// pending, or the confirmed one when nothing is pending, and that out of range values are refused.
+func TestBeaconSettingsPartialUpdate(t *testing.T) {
+	_, tasks := newSettingsTestService(t)
+
+	state, task := updateSettings(t, tasks, BeaconSettingsUpdate{Sleep: intPtr(30)})
+	if state.Intended.Sleep != 30 || state.Intended.Jitter != 5 || state.Intended.Status != data.SettingsPending {
+		t.Fatalf("expected pending 30s/5%%, got %+v", state.Intended)
+	}
+	if task.Command != "sleep" || task.Arguments != "30 5" || task.Source != settingsTaskSource {
+		t.Fatalf("unexpected settings task: %+v", task)
+	}
+
+	state, task = updateSettings(t, tasks, BeaconSettingsUpdate{Jitter: intPtr(20)})
+	if state.Intended.Sleep != 30 || state.Intended.Jitter != 20 {
+		t.Fatalf("expected the pending sleep to be kept, got %+v", state.Intended)
+	}
+	if task.Arguments != "30 20" {
+		t.Fatalf("expected arguments '30 20', got %q", task.Arguments)
+	}
+	if state.Sleep != 10 || state.Jitter != 5 {
+		t.Fatalf("confirmed settings changed before the beacon ran the task: %+v", state)
+	}
+
+	invalid := []BeaconSettingsUpdate{
+		{},
+		{Sleep: intPtr(0)},
+		{Sleep: intPtr(3601)},
+		{Jitter: intPtr(-1)},
+		{Jitter: intPtr(100)},
+	}
+	for _, update := range invalid {
+		if _, _, err := tasks.UpdateBeaconSettings(context.Background(), "beacon-1", update, "alice"); !errors.Is(err, ErrInvalidSettings) {
+			t.Fatalf("expected ErrInvalidSettings for %+v, got %v", update, err)
+		}
+	}
+	if _, _, err := tasks.UpdateBeaconSettings(context.Background(), "unknown", BeaconSettingsUpdate{Sleep: intPtr(30)}, "alice"); err == nil {
+		t.Fatalf("settings of an unknown beacon updated")
+	}
+}
+
+// TestBeaconSettingsConfirmed tests that pending settings are confirmed when their task completes,
+// and that reading them doesn't resolve anything.
+func TestBeaconSettingsConfirmed(t *testing.T) {
+	store, tasks := newSettingsTestService(t)
+	_, first := updateSettings(t, tasks, BeaconSettingsUpdate{Sleep: intPtr(30)})
+	_, second := updateSettings(t, tasks, BeaconSettingsUpdate{Sleep: intPtr(60)})
+
+	// The replaced request finishing leaves the newer one pending
+	if state := finishTask(t, store, tasks, first, "completed"); state != nil {
+		t.Fatalf("replaced settings task resolved the current settings: %+v", state.Intended)
+	}
+
+	// GET is read-only, even with the task already completed
+	second.Status = "completed"
+	if err := store.UpdateTask(second); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+	state, err := tasks.GetBeaconSettings(context.Background(), "beacon-1")
+	if err != nil {
+		t.Fatalf("GetBeaconSettings: %v", err)
+	}
+	if state.Intended.Status != data.SettingsPending {
+		t.Fatalf("reading the settings resolved them: %+v", state.Intended)
+	}
+
+	state, err = tasks.ResolveBeaconSettings(context.Background(), second)
+	if err != nil {
+		t.Fatalf("ResolveBeaconSettings: %v", err)
+	}
+	if state == nil || state.Intended.Status != data.SettingsConfirmed || state.Intended.ConfirmedAt == nil || state.Intended.Sleep != 60 {
+		t.Fatalf("expected confirmed 60s settings, got %+v", state)
+	}
+	if again, err := tasks.ResolveBeaconSettings(context.Background(), second); err != nil || again != nil {
+		t.Fatalf("settings resolved twice: %+v, %v", again, err)
+	}
+
+	// Nothing pending: a partial update starts from the confirmed settings of the beacon
+	state, _ = updateSettings(t, tasks, BeaconSettingsUpdate{Jitter: intPtr(50)})
+	if state.Intended.Sleep != 10 || state.Intended.Jitter != 50 {
+		t.Fatalf("expected 10s/50%% from the beacon's settings, got %+v", state.Intended)
+	}
+}
+
+// TestBeaconSettingsFailed tests that pending settings fail with their task, and that other tasks
+// don't touch them.
+func TestBeaconSettingsFailed(t *testing.T) {
+	for _, status := range []string{"failed", "timed_out", "canceled"} {
+		store, tasks := newSettingsTestService(t)
+		_, task := updateSettings(t, tasks, BeaconSettingsUpdate{Sleep: intPtr(30)})
+
+		if state := finishTask(t, store, tasks, task, "dispatched"); state != nil {
+			t.Fatalf("%s: settings resolved by a dispatched task", status)
+		}
+		manual, err := tasks.CreateTask(context.Background(), "beacon-1", "sleep", "45 0", "console", "alice", nil)
+		if err != nil {
+			t.Fatalf("CreateTask: %v", err)
+		}
+		if state := finishTask(t, store, tasks, manual, status); state != nil {
+			t.Fatalf("%s: settings resolved by a sleep task from the console", status)
+		}
+
+		state := finishTask(t, store, tasks, task, status)
+		if state == nil || state.Intended.Status != data.SettingsFailed || state.Intended.ConfirmedAt != nil {
+			t.Fatalf("%s: expected failed settings, got %+v", status, state)
+		}
+		if state.Sleep != 10 || state.Jitter != 5 {
+			t.Fatalf("%s: confirmed settings changed: %+v", status, state)
+		}
+		if stored, err := tasks.GetBeaconSettings(context.Background(), "beacon-1"); err != nil || stored.Intended.Status != data.SettingsFailed {
+			t.Fatalf("%s: failed status not stored: %+v, %v", status, stored, err)
+		}
+	}
+}
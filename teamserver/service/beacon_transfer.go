@@ -0,0 +1,198 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+)
+
+// beaconArchiveVersion is the version of the beacon export archive layout.
+const beaconArchiveVersion = 1
+
+// maxBeaconArchiveEntry bounds the size of an entry read from a beacon export archive.
+const maxBeaconArchiveEntry = 1 << 30
+
+// ErrTransferDisabled is returned for beacon exports and imports without backup.transfer_key.
+var ErrTransferDisabled = errors.New("beacon transfer is disabled, backup.transfer_key is not set")
+
+// ErrInvalidBeaconArchive is returned for archives that aren't a beacon export or whose signature doesn't match.
+var ErrInvalidBeaconArchive = errors.New("not a valid beacon export archive")
+
+// BeaconArchive is the content of a beacon export archive: beacons.json, signed with an HMAC-SHA256
+// of the transfer key stored in beacons.json.sig.
+type BeaconArchive struct {
+	Version    int                  `json:"version"`
+	ExportedAt time.Time            `json:"exported_at"`
+	ExportedBy string               `json:"exported_by"`
+	Beacons    []data.BeaconRecords `json:"beacons"`
+}
+
+// BeaconImportOptions controls how the beacons of an archive are imported.
+type BeaconImportOptions struct {
+	// Listener replaces the listener of the imported beacons, e.g. when it has another name here
+	Listener string
+}
+
+// BeaconImportReport is the result of importing a beacon export archive.
+type BeaconImportReport struct {
+	ExportedAt time.Time     `json:"exported_at"`
+	ExportedBy string        `json:"exported_by"`
+	Imported   []data.Beacon `json:"imported"`
+	// Beacon ID -> why it wasn't imported, e.g. because it already exists
+	Skipped map[string]string `json:"skipped"`
+	// Loot files of the imported beacons not in the loot directory yet, relative to it
+	MissingLoot []string `json:"missing_loot"`
+}
+
+// ExportBeacons writes a signed archive of beacons with their session keys, tasks, notes and loot records to w.
+func (s *backupService) ExportBeacons(ctx context.Context, beaconIDs []string, exportedBy string, w io.Writer) error {
+	if s.config.TransferKey == "" {
+		return ErrTransferDisabled
+	}
+
+	archive := &BeaconArchive{Version: beaconArchiveVersion, ExportedAt: time.Now().UTC(), ExportedBy: exportedBy}
+	for _, beaconID := range beaconIDs {
+		if _, err := getBeacon(ctx, s.store, beaconID); err != nil {
+			return fmt.Errorf("beacon %s not found: %w", beaconID, err)
+		}
+		records, err := s.store.GetBeaconRecords(beaconID)
+		if err != nil {
+			return fmt.Errorf("failed to read beacon %s: %w", beaconID, err)
+		}
+		archive.Beacons = append(archive.Beacons, *records)
+	}
+
+	content, err := json.Marshal(archive)
+	if err != nil {
+		return fmt.Errorf("failed to encode beacons: %w", err)
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeTarEntry(tw, "beacons.json", content, archive.ExportedAt); err != nil {
+		return err
+	}
+	signature := []byte(hex.EncodeToString(s.signBeaconArchive(content)))
+	if err := writeTarEntry(tw, "beacons.json.sig", signature, archive.ExportedAt); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write beacon archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write beacon archive: %w", err)
+	}
+	logger.Ctx(ctx).Infof("%d beacons exported by %s", len(beaconIDs), exportedBy)
+	return nil
+}
+
+// ImportBeacons creates the beacons of a signed archive in the engagement of ctx. Beacons that already
+// exist are skipped; the others are imported with their tasks, notes and loot records one at a time.
+func (s *backupService) ImportBeacons(ctx context.Context, r io.Reader, options BeaconImportOptions) (*BeaconImportReport, error) {
+	if s.config.TransferKey == "" {
+		return nil, ErrTransferDisabled
+	}
+	archive, err := s.readBeaconArchive(r)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BeaconImportReport{
+		ExportedAt:  archive.ExportedAt,
+		ExportedBy:  archive.ExportedBy,
+		Imported:    []data.Beacon{},
+		Skipped:     make(map[string]string),
+		MissingLoot: []string{},
+	}
+	engagement := engagementForNew(ctx)
+	for i := range archive.Beacons {
+		records := &archive.Beacons[i]
+		beaconID := records.Beacon.BeaconID
+		records.Beacon.Engagement = engagement
+		if options.Listener != "" {
+			records.Beacon.Listener = options.Listener
+		}
+
+		if err := s.store.ImportBeaconRecords(records); err != nil {
+			report.Skipped[beaconID] = err.Error()
+			continue
+		}
+		report.Imported = append(report.Imported, records.Beacon)
+		for _, item := range records.Loot {
+			p := records.LootPaths[item.LootID]
+			if _, err := os.Stat(filepath.Join(s.lootDir, filepath.FromSlash(p))); err != nil {
+				report.MissingLoot = append(report.MissingLoot, p)
+			}
+		}
+	}
+	logger.Ctx(ctx).Infof("Imported %d beacons exported by %s at %s (%d skipped)", len(report.Imported),
+		archive.ExportedBy, archive.ExportedAt.Format(time.RFC3339), len(report.Skipped))
+	return report, nil
+}
+
+// readBeaconArchive reads a beacon export archive and checks its signature.
+func (s *backupService) readBeaconArchive(r io.Reader) (*BeaconArchive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBeaconArchive, err)
+	}
+	defer gz.Close()
+
+	var content, signature []byte
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBeaconArchive, err)
+		}
+		switch header.Name {
+		case "beacons.json":
+			content, err = io.ReadAll(io.LimitReader(tr, maxBeaconArchiveEntry))
+		case "beacons.json.sig":
+			signature, err = io.ReadAll(io.LimitReader(tr, 1024))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBeaconArchive, err)
+		}
+	}
+	if content == nil || signature == nil {
+		return nil, fmt.Errorf("%w: beacons.json or its signature is missing", ErrInvalidBeaconArchive)
+	}
+
+	// Checked before decoding, so nothing of an archive signed with another key is used
+	mac, err := hex.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || !hmac.Equal(mac, s.signBeaconArchive(content)) {
+		return nil, fmt.Errorf("%w: the signature doesn't match, it was exported with another transfer key", ErrInvalidBeaconArchive)
+	}
+	archive := &BeaconArchive{}
+	if err := json.Unmarshal(content, archive); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBeaconArchive, err)
+	}
+	if archive.Version != beaconArchiveVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidBeaconArchive, archive.Version)
+	}
+	return archive, nil
+}
+
+// signBeaconArchive returns the HMAC-SHA256 of an archive's beacons.json with the transfer key.
+func (s *backupService) signBeaconArchive(content []byte) []byte {
+	h := hmac.New(sha256.New, []byte(s.config.TransferKey))
+	h.Write(content)
+	return h.Sum(nil)
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+
+	"github.com/google/uuid"
+)
+
+// burnTokenTTL is how long a prepared burn waits for confirmation.
+const burnTokenTTL = 2 * time.Minute
+
+// DefaultBurnGracePeriod is how many seconds beacons get to collect their exit task before the listeners go down.
+const DefaultBurnGracePeriod = 60
+
+// BurnOptions selects what a burn operation destroys.
+type BurnOptions struct {
+	Engagement      string `json:"engagement"` // Empty burns every engagement
+	WipeSessionKeys bool   `json:"wipe_session_keys"`
+	GracePeriod     int    `json:"grace_period"` // Seconds
+}
+
+// BurnPlan is a prepared burn awaiting confirmation with its token.
+type BurnPlan struct {
+	Token     string      `json:"token"`
+	ExpiresAt time.Time   `json:"expires_at"`
+	Options   BurnOptions `json:"options"`
+	Beacons   int64       `json:"beacons"`
+	Listeners int64       `json:"listeners"`
+
+	username string
+}
+
+// BurnReport describes what a burn operation did. Listeners are shut down after the
+// grace period; the outcome of that phase is written to the audit log.
+type BurnReport struct {
+	StartedAt          time.Time   `json:"started_at"`
+	Options            BurnOptions `json:"options"`
+	ExitTasks          []string    `json:"exit_tasks"` // Beacon IDs an exit task was queued for
+	Listeners          []string    `json:"listeners"`
+	ListenerShutdownAt time.Time   `json:"listener_shutdown_at"`
+	Errors             []string    `json:"errors"`
+}
+
+// BurnService defines the interface for the kill-switch that tears down an operation.
+type BurnService interface {
+	// PrepareBurn checks the options and returns a plan with the confirmation token needed to execute it.
+	PrepareBurn(ctx context.Context, username string, options BurnOptions) (*BurnPlan, error)
+
+	// ExecuteBurn runs a prepared burn: it queues an exit task for every beacon and, after the grace period,
+	// optionally wipes the listeners' session keys, stops the listeners and revokes their certificates.
+	// The token is single use and only valid for the operator who prepared the burn.
+	ExecuteBurn(ctx context.Context, username, token string) (*BurnReport, error)
+}
+
+// burnService implements the BurnService interface.
+type burnService struct {
+	store           data.DataStore
+	listenerService ListenerService
+	auditService    AuditService
+
+	mu    sync.Mutex
+	plans map[string]*BurnPlan
+}
+
+// NewBurnService creates a new instance of burnService.
+func NewBurnService(store data.DataStore, listenerService ListenerService, auditService AuditService) BurnService {
+	return &burnService{
+		store:           store,
+		listenerService: listenerService,
+		auditService:    auditService,
+		plans:           make(map[string]*BurnPlan),
+	}
+}
+
+// PrepareBurn checks the options and returns a plan with the confirmation token needed to execute it.
+func (s *burnService) PrepareBurn(ctx context.Context, username string, options BurnOptions) (*BurnPlan, error) {
+	if options.Engagement != "" {
+		if _, err := s.store.GetEngagement(options.Engagement); err != nil {
+			return nil, fmt.Errorf("engagement not found: %w", err)
+		}
+	}
+	if options.GracePeriod < 0 {
+		return nil, fmt.Errorf("grace period must not be negative")
+	}
+
+	_, beacons, err := s.store.GetBeacons(&data.BeaconQuery{Page: 1, Limit: 1, Engagement: options.Engagement, Archived: "all"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count beacons: %w", err)
+	}
+	_, listeners, err := s.store.GetListeners(options.Engagement, 1, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count listeners: %w", err)
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate confirmation token: %w", err)
+	}
+	plan := &BurnPlan{
+		Token:     hex.EncodeToString(raw),
+		ExpiresAt: time.Now().Add(burnTokenTTL),
+		Options:   options,
+		Beacons:   beacons,
+		Listeners: listeners,
+		username:  username,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, pending := range s.plans {
+		if time.Now().After(pending.ExpiresAt) {
+			delete(s.plans, token)
+		}
+	}
+	s.plans[plan.Token] = plan
+	return plan, nil
+}
+
+// ExecuteBurn runs a prepared burn: it queues an exit task for every beacon and, after the grace period,
+// optionally wipes the listeners' session keys, stops the listeners and revokes their certificates.
+// The token is single use and only valid for the operator who prepared the burn.
+func (s *burnService) ExecuteBurn(ctx context.Context, username, token string) (*BurnReport, error) {
+	s.mu.Lock()
+	plan, ok := s.plans[token]
+	delete(s.plans, token)
+	s.mu.Unlock()
+	if !ok || plan.username != username || time.Now().After(plan.ExpiresAt) {
+		return nil, fmt.Errorf("invalid or expired confirmation token")
+	}
+
+	report := &BurnReport{
+		StartedAt:          time.Now(),
+		Options:            plan.Options,
+		ExitTasks:          []string{},
+		Listeners:          []string{},
+		ListenerShutdownAt: time.Now().Add(time.Duration(plan.Options.GracePeriod) * time.Second),
+		Errors:             []string{},
+	}
+	logger.Ctx(ctx).Warnf("BURN started by %s (engagement: %q, wipe session keys: %t, grace period: %ds)", username, plan.Options.Engagement, plan.Options.WipeSessionKeys, plan.Options.GracePeriod)
+
+	// 1. Every beacon gets an exit task while the listeners are still up to deliver it
+	for page := 1; ; page++ {
+		beacons, _, err := s.store.GetBeacons(&data.BeaconQuery{Page: page, Limit: 100, Engagement: plan.Options.Engagement, Archived: "all"})
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to list beacons: %v", err))
+			break
+		}
+		for _, beacon := range beacons {
+			task := &data.Task{
+				TaskID:     "task-exit-" + uuid.New().String(),
+				BeaconID:   beacon.BeaconID,
+				Command:    "exit",
+				Status:     "queued",
+				Source:     "burn",
+				Operator:   username,
+				Engagement: beacon.Engagement,
+			}
+			err := s.store.CreateTask(task)
+			s.record(username, "exit_task", beacon.BeaconID, err)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("beacon %s: failed to queue exit task: %v", beacon.BeaconID, err))
+				continue
+			}
+			report.ExitTasks = append(report.ExitTasks, beacon.BeaconID)
+		}
+		if len(beacons) < 100 {
+			break
+		}
+	}
+
+	// 2. The listeners to take down once the beacons had their chance to exit
+	var listeners []data.Listener
+	for page := 1; ; page++ {
+		batch, _, err := s.store.GetListeners(plan.Options.Engagement, page, 100)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to list listeners: %v", err))
+			break
+		}
+		listeners = append(listeners, batch...)
+		if len(batch) < 100 {
+			break
+		}
+	}
+	for _, listener := range listeners {
+		report.Listeners = append(report.Listeners, listener.Name)
+	}
+
+	if plan.Options.GracePeriod == 0 {
+		report.Errors = append(report.Errors, s.shutdownListeners(username, listeners, plan.Options.WipeSessionKeys)...)
+	} else {
+		time.AfterFunc(time.Duration(plan.Options.GracePeriod)*time.Second, func() {
+			s.shutdownListeners(username, listeners, plan.Options.WipeSessionKeys)
+		})
+	}
+	return report, nil
+}
+
+// shutdownListeners wipes session keys (if requested), stops the listeners and revokes their certificates.
+// A listener that is not connected can't be stopped, but its certificate is revoked regardless.
+func (s *burnService) shutdownListeners(username string, listeners []data.Listener, wipeSessionKeys bool) []string {
+	// Internal call: the burn already decided which engagements it covers
+	ctx := context.Background()
+	var errs []string
+	for _, listener := range listeners {
+		if wipeSessionKeys {
+			err := s.listenerService.WipeSessions(ctx, listener.Name)
+			s.record(username, "wipe_session_keys", listener.Name, err)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("listener %s: failed to wipe session keys: %v", listener.Name, err))
+			}
+		}
+		err := s.listenerService.StopListener(ctx, listener.Name)
+		s.record(username, "stop_listener", listener.Name, err)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("listener %s: failed to stop: %v", listener.Name, err))
+		}
+		err = s.listenerService.RevokeCertificateForListener(ctx, listener.Name)
+		s.record(username, "revoke_certificate", listener.Name, err)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("listener %s: failed to revoke certificate: %v", listener.Name, err))
+		}
+	}
+	logger.Warnf("BURN by %s: %d listeners shut down, %d errors", username, len(listeners), len(errs))
+	return errs
+}
+
+// record writes a burn step to the audit log. Failed steps are logged with status 500.
+func (s *burnService) record(username, action, target string, err error) {
+	status := 200
+	if err != nil {
+		status = 500
+		logger.Errorf("BURN %s %s failed: %v", action, target, err)
+	}
+	s.auditService.Record(&data.AuditLog{
+		CreatedAt: time.Now(),
+		Username:  username,
+		Role:      RoleAdmin,
+		Method:    "BURN",
+		Path:      target,
+		Route:     "burn:" + action,
+		Status:    status,
+	})
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"simplec2/pkg/bridge"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxCanaryHits bounds the hits returned for a canary.
+const maxCanaryHits = 1000
+
+var (
+	// ErrInvalidCanary is returned for canary settings that can't be used.
+	ErrInvalidCanary = errors.New("invalid canary")
+	// ErrCanaryExists is returned when the listener already serves something at the URI.
+	ErrCanaryExists = errors.New("the URI is already in use on this listener")
+)
+
+// CanaryOptions describes a canary to register on a listener.
+type CanaryOptions struct {
+	URI   string // Generated if empty
+	Label string
+}
+
+// CanaryService defines the interface for canaries, tripwire URIs on listeners that no payload ever
+// requests. Operators plant them in phishing artifacts; a request for one raises a SECURITY_ALERT,
+// since it means the artifact is being analysed.
+type CanaryService interface {
+	// CreateCanary registers a canary on a listener and sends the listener its canaries.
+	CreateCanary(ctx context.Context, listener string, opts CanaryOptions, by string) (*data.Canary, error)
+
+	// ListCanaries returns the canaries of a listener.
+	ListCanaries(ctx context.Context, listener string) ([]data.Canary, error)
+
+	// GetHits returns the hits of a canary since a point in time, newest first.
+	GetHits(ctx context.Context, listener string, canaryID string, since time.Time, limit int) ([]data.CanaryHit, error)
+
+	// DeleteCanary removes a canary and its hits.
+	DeleteCanary(ctx context.Context, listener string, canaryID string) error
+
+	// SyncListener sends a listener that opened its control channel its canaries.
+	SyncListener(name string)
+
+	// RecordHits stores the canary hits a listener reported and raises a SECURITY_ALERT for them.
+	RecordHits(name string, hits []*bridge.CanaryHit)
+}
+
+// canaryService implements the CanaryService interface.
+type canaryService struct {
+	store     data.DataStore
+	listeners ListenerService
+	broadcast func(engagement string, data []byte)
+}
+
+// NewCanaryService creates a new instance of canaryService. broadcast sends SECURITY_ALERT when a
+// listener reports a canary hit.
+func NewCanaryService(store data.DataStore, listeners ListenerService, broadcast func(engagement string, data []byte)) CanaryService {
+	return &canaryService{store: store, listeners: listeners, broadcast: broadcast}
+}
+
+// CreateCanary validates and records a canary, then updates the listener's canaries.
+func (s *canaryService) CreateCanary(ctx context.Context, listenerName string, opts CanaryOptions, by string) (*data.Canary, error) {
+	listener, err := getListener(ctx, s.store, listenerName)
+	if err != nil {
+		return nil, fmt.Errorf("listener not found: %w", err)
+	}
+	if listener.Type == ExternalListenerType {
+		return nil, fmt.Errorf("%w: external listeners can't serve canaries", ErrInvalidCanary)
+	}
+	uri := opts.URI
+	if uri == "" {
+		if uri, err = newCanaryURI(); err != nil {
+			return nil, fmt.Errorf("failed to generate canary URI: %w", err)
+		}
+	}
+	if err := validateListenerURI(uri); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCanary, err)
+	}
+
+	canaries, err := s.store.GetCanaries(listenerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get canaries: %w", err)
+	}
+	for _, canary := range canaries {
+		if canary.URI == uri {
+			return nil, fmt.Errorf("%w: %s is a canary", ErrCanaryExists, uri)
+		}
+	}
+	files, err := s.store.GetHostedFiles(listenerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hosted files: %w", err)
+	}
+	for _, file := range files {
+		if file.URI == uri {
+			return nil, fmt.Errorf("%w: %s is a hosted file", ErrCanaryExists, uri)
+		}
+	}
+
+	canary := &data.Canary{
+		CanaryID:   uuid.New().String(),
+		Listener:   listenerName,
+		URI:        uri,
+		Label:      strings.TrimSpace(opts.Label),
+		CreatedBy:  by,
+		Engagement: listener.Engagement,
+	}
+	if err := s.store.CreateCanary(canary); err != nil {
+		return nil, fmt.Errorf("failed to create canary: %w", err)
+	}
+
+	// A listener that isn't connected gets its canaries when it connects
+	if err := s.sync(listenerName); err != nil {
+		logger.Warnf("Canary %s not sent to listener %s yet: %v", canary.URI, listenerName, err)
+	}
+	return canary, nil
+}
+
+// newCanaryURI returns a random path no payload requests.
+func newCanaryURI() (string, error) {
+	token := make([]byte, 12)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return "/" + hex.EncodeToString(token), nil
+}
+
+// ListCanaries returns the canaries of a listener.
+func (s *canaryService) ListCanaries(ctx context.Context, listenerName string) ([]data.Canary, error) {
+	if _, err := getListener(ctx, s.store, listenerName); err != nil {
+		return nil, fmt.Errorf("listener not found: %w", err)
+	}
+	return s.store.GetCanaries(listenerName)
+}
+
+// GetHits returns the hits of a canary since a point in time, newest first.
+func (s *canaryService) GetHits(ctx context.Context, listenerName string, canaryID string, since time.Time, limit int) ([]data.CanaryHit, error) {
+	if _, err := s.getCanary(ctx, listenerName, canaryID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxCanaryHits {
+		limit = maxCanaryHits
+	}
+	hits, err := s.store.GetCanaryHits(canaryID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get canary hits: %w", err)
+	}
+	return hits, nil
+}
+
+// DeleteCanary deletes a canary and its hits, then updates the listener's canaries.
+func (s *canaryService) DeleteCanary(ctx context.Context, listenerName string, canaryID string) error {
+	canary, err := s.getCanary(ctx, listenerName, canaryID)
+	if err != nil {
+		return err
+	}
+	if err := s.store.DeleteCanary(canaryID); err != nil {
+		return fmt.Errorf("failed to delete canary: %w", err)
+	}
+
+	// A listener that isn't connected drops the canary when it connects
+	if err := s.sync(listenerName); err != nil {
+		logger.Warnf("Listener %s not told to drop canary %s yet: %v", listenerName, canary.URI, err)
+	}
+	return nil
+}
+
+// getCanary returns a canary of a listener in the caller's engagement.
+func (s *canaryService) getCanary(ctx context.Context, listenerName string, canaryID string) (*data.Canary, error) {
+	if _, err := getListener(ctx, s.store, listenerName); err != nil {
+		return nil, fmt.Errorf("listener not found: %w", err)
+	}
+	canary, err := s.store.GetCanary(canaryID)
+	if err != nil {
+		return nil, fmt.Errorf("canary not found: %w", err)
+	}
+	if canary.Listener != listenerName {
+		return nil, fmt.Errorf("canary not found: %w", gorm.ErrRecordNotFound)
+	}
+	return canary, nil
+}
+
+// SyncListener sends a listener its canaries.
+func (s *canaryService) SyncListener(name string) {
+	if err := s.sync(name); err != nil {
+		logger.Errorf("Failed to sync canaries of listener %s: %v", name, err)
+	}
+}
+
+// sync replaces the canaries of a listener with the ones stored for it.
+func (s *canaryService) sync(name string) error {
+	canaries, err := s.store.GetCanaries(name)
+	if err != nil {
+		return fmt.Errorf("failed to get canaries: %w", err)
+	}
+	cmd := &bridge.ListenerCommand{Action: bridge.ListenerCommand_SYNC_CANARIES}
+	for _, canary := range canaries {
+		cmd.Canaries = append(cmd.Canaries, &bridge.Canary{Id: canary.CanaryID, Uri: canary.URI})
+	}
+	return s.listeners.SendCommand(name, cmd)
+}
+
+// RecordHits stores the hits a listener reported for its canaries and broadcasts a SECURITY_ALERT
+// for each canary hit.
+func (s *canaryService) RecordHits(name string, reported []*bridge.CanaryHit) {
+	byCanary := make(map[string][]data.CanaryHit)
+	var order []string
+	for _, hit := range reported {
+		at := time.Now()
+		if hit.Time != nil {
+			at = hit.Time.AsTime()
+		}
+		if _, ok := byCanary[hit.CanaryId]; !ok {
+			order = append(order, hit.CanaryId)
+		}
+		byCanary[hit.CanaryId] = append(byCanary[hit.CanaryId], data.CanaryHit{
+			CanaryID:   hit.CanaryId,
+			Listener:   name,
+			Time:       at,
+			RemoteAddr: hit.RemoteAddr,
+			Method:     hit.Method,
+			RequestURI: hit.RequestUri,
+			UserAgent:  hit.UserAgent,
+			Headers:    hit.Headers,
+		})
+	}
+
+	for _, canaryID := range order {
+		hits := byCanary[canaryID]
+		canary, err := s.store.GetCanary(canaryID)
+		if err != nil || canary.Listener != name {
+			// Deleted since, or not this listener's
+			continue
+		}
+		for i := range hits {
+			hits[i].Engagement = canary.Engagement
+		}
+		if err := s.store.RecordCanaryHits(canaryID, hits); err != nil {
+			logger.Errorf("Failed to record hits of canary %s: %v", canary.URI, err)
+			continue
+		}
+		last := hits[len(hits)-1]
+		logger.Warnf("SECURITY ALERT: canary %s on listener %s requested %d times, last by %s (%s)", canary.URI, name, len(hits), last.RemoteAddr, last.UserAgent)
+
+		if s.broadcast == nil {
+			continue
+		}
+		if updated, err := s.store.GetCanary(canaryID); err == nil {
+			canary = updated
+		}
+		event, err := json.Marshal(map[string]interface{}{
+			"type": "SECURITY_ALERT",
+			"payload": map[string]interface{}{
+				"kind":   "canary_hit",
+				"canary": canary,
+				"hits":   hits,
+			},
+		})
+		if err != nil {
+			logger.Errorf("Error marshalling SECURITY_ALERT event: %v", err)
+			continue
+		}
+		s.broadcast(canary.Engagement, event)
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"simplec2/teamserver/data"
+
+	"gorm.io/gorm"
+)
+
+// maxChatMessageLength is the longest chat message accepted, in characters.
+const maxChatMessageLength = 4000
+
+// beaconReference matches "@<beacon id>" in a chat message.
+var beaconReference = regexp.MustCompile(`(?:^|\s)@([A-Za-z0-9][A-Za-z0-9_.-]*)`)
+
+// ChatService defines the interface for the per-engagement team chat.
+type ChatService interface {
+	// SendMessage records a message from an operator in the engagement's chat.
+	SendMessage(ctx context.Context, username string, body string) (*data.ChatMessage, error)
+
+	// ListMessages returns up to limit of the latest messages, oldest first. With beforeID set,
+	// only messages older than that message are returned, to page back through the history.
+	ListMessages(ctx context.Context, beforeID uint, limit int) ([]data.ChatMessage, error)
+}
+
+// chatService implements the ChatService interface.
+type chatService struct {
+	store data.DataStore
+}
+
+// NewChatService creates a new instance of chatService.
+func NewChatService(store data.DataStore) ChatService {
+	return &chatService{store: store}
+}
+
+// SendMessage records a message from an operator in the engagement's chat.
+func (s *chatService) SendMessage(ctx context.Context, username string, body string) (*data.ChatMessage, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, fmt.Errorf("message is empty")
+	}
+	if utf8.RuneCountInString(body) > maxChatMessageLength {
+		return nil, fmt.Errorf("message is longer than %d characters", maxChatMessageLength)
+	}
+
+	beaconIDs, err := s.beaconReferences(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	message := &data.ChatMessage{
+		Engagement: engagementForNew(ctx),
+		Username:   username,
+		Body:       body,
+		BeaconIDs:  beaconIDs,
+	}
+	if err := s.store.CreateChatMessage(message); err != nil {
+		return nil, fmt.Errorf("failed to create chat message: %w", err)
+	}
+	return message, nil
+}
+
+// ListMessages returns up to limit of the latest messages, oldest first.
+func (s *chatService) ListMessages(ctx context.Context, beforeID uint, limit int) ([]data.ChatMessage, error) {
+	messages, err := s.store.GetChatMessages(engagementForNew(ctx), beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chat messages: %w", err)
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// beaconReferences returns the beacons of the engagement referenced as @<beacon id> in a message.
+// References to unknown beacons are left as plain text.
+func (s *chatService) beaconReferences(ctx context.Context, body string) ([]string, error) {
+	var beaconIDs []string
+	seen := make(map[string]bool)
+	for _, match := range beaconReference.FindAllStringSubmatch(body, -1) {
+		beaconID := strings.TrimRight(match[1], ".")
+		if seen[beaconID] {
+			continue
+		}
+		seen[beaconID] = true
+
+		if _, err := getBeacon(ctx, s.store, beaconID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get beacon: %w", err)
+		}
+		beaconIDs = append(beaconIDs, beaconID)
+	}
+	return beaconIDs, nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"simplec2/teamserver/data"
+
+	"gorm.io/gorm"
+)
+
+// CredentialService defines the interface for harvested credentials.
+type CredentialService interface {
+	// ListCredentials retrieves credentials, optionally only those valid on a host.
+	ListCredentials(ctx context.Context, hostID *uint, page int, limit int) ([]data.Credential, int64, error)
+
+	// CreateCredential records a credential. If hostAddress is set, the credential is tied to that host,
+	// which is added to the inventory if it isn't known yet.
+	CreateCredential(ctx context.Context, credential *data.Credential, hostAddress string) (*data.Credential, error)
+
+	// DeleteCredential removes a credential.
+	DeleteCredential(ctx context.Context, id uint) error
+}
+
+// credentialService implements the CredentialService interface.
+type credentialService struct {
+	store data.DataStore
+	hosts HostService
+}
+
+// NewCredentialService creates a new instance of credentialService.
+func NewCredentialService(store data.DataStore, hostService HostService) CredentialService {
+	return &credentialService{store: store, hosts: hostService}
+}
+
+// ListCredentials retrieves credentials, optionally only those valid on a host.
+func (s *credentialService) ListCredentials(ctx context.Context, hostID *uint, page int, limit int) ([]data.Credential, int64, error) {
+	credentials, total, err := s.store.GetCredentials(EngagementFromContext(ctx), hostID, page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list credentials: %w", err)
+	}
+	return credentials, total, nil
+}
+
+// CreateCredential records a credential. If hostAddress is set, the credential is tied to that host,
+// which is added to the inventory if it isn't known yet.
+func (s *credentialService) CreateCredential(ctx context.Context, credential *data.Credential, hostAddress string) (*data.Credential, error) {
+	if strings.TrimSpace(credential.Username) == "" {
+		return nil, fmt.Errorf("username is required")
+	}
+	if credential.Type == "" {
+		credential.Type = "password"
+	}
+	credential.Engagement = engagementForNew(ctx)
+
+	if credential.BeaconID != "" {
+		if _, err := getBeacon(ctx, s.store, credential.BeaconID); err != nil {
+			return nil, fmt.Errorf("failed to get beacon: %w", err)
+		}
+	}
+	if credential.HostID != nil {
+		if _, err := s.hosts.GetHost(ctx, *credential.HostID); err != nil {
+			return nil, err
+		}
+	} else if hostAddress != "" {
+		host, err := s.hosts.SaveHost(ctx, &data.Host{Address: hostAddress, Source: "credential"})
+		if err != nil {
+			return nil, err
+		}
+		credential.HostID = &host.ID
+	}
+
+	if err := s.store.CreateCredential(credential); err != nil {
+		return nil, fmt.Errorf("failed to create credential: %w", err)
+	}
+	return credential, nil
+}
+
+// DeleteCredential removes a credential.
+func (s *credentialService) DeleteCredential(ctx context.Context, id uint) error {
+	credential, err := s.store.GetCredential(id)
+	if err != nil {
+		return fmt.Errorf("failed to get credential: %w", err)
+	}
+	if !inEngagement(ctx, credential.Engagement) {
+		return fmt.Errorf("failed to get credential: %w", gorm.ErrRecordNotFound)
+	}
+	if err := s.store.DeleteCredential(id); err != nil {
+		return fmt.Errorf("failed to delete credential: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/pkg/pki"
+	"simplec2/teamserver/data"
+)
+
+const (
+	// crlValidity is how long a CRL is valid (its NextUpdate)
+	crlValidity = 7 * 24 * time.Hour
+	// crlRefresh is how old a CRL may get before it is reissued even though nothing was revoked
+	crlRefresh = 24 * time.Hour
+)
+
+// CRLService defines the interface for issuing the certificate revocation list of the CA.
+type CRLService interface {
+	// Generate signs a CRL of all revoked certificates, writes it to disk and returns it PEM encoded.
+	Generate(ctx context.Context) ([]byte, error)
+
+	// Current returns the last generated CRL, PEM encoded, generating one if there is none yet.
+	Current(ctx context.Context) ([]byte, error)
+
+	// StartRefreshRoutine regenerates the CRL in the background when certificates are revoked,
+	// when the CA changes and before it expires.
+	StartRefreshRoutine(interval time.Duration)
+}
+
+// crlService implements the CRLService interface.
+type crlService struct {
+	store   data.DataStore
+	pki     PKIService
+	crlPath string
+
+	mu       sync.Mutex
+	current  []byte
+	revision string // Revoked certificates the current CRL lists, see revisionOf
+	ca       []byte // CA that signed the current CRL
+	issuedAt time.Time
+}
+
+// NewCRLService creates a new instance of crlService. The CRL is signed by the current CA of the PKI service.
+func NewCRLService(store data.DataStore, pkiService PKIService, crlPath string) CRLService {
+	return &crlService{
+		store:   store,
+		pki:     pkiService,
+		crlPath: crlPath,
+	}
+}
+
+// Generate signs a CRL of all revoked certificates and writes it to disk.
+func (s *crlService) Generate(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	certs, err := s.store.GetRevokedCertificates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revoked certificates: %w", err)
+	}
+	return s.generate(certs)
+}
+
+// generate issues the CRL of the given revoked certificates. Called with mu held.
+func (s *crlService) generate(certs []data.IssuedCertificate) ([]byte, error) {
+	caCertPEM, caKey := s.pki.CurrentCA()
+
+	entries := make([]x509.RevocationListEntry, 0, len(certs))
+	for _, cert := range certs {
+		serial, ok := new(big.Int).SetString(cert.SerialNumber, 10)
+		if !ok {
+			logger.Warnf("Skipping revoked certificate with invalid serial number '%s'", cert.SerialNumber)
+			continue
+		}
+		revokedAt := cert.UpdatedAt
+		if cert.RevokedAt != nil {
+			revokedAt = *cert.RevokedAt
+		}
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: serial, RevocationTime: revokedAt})
+	}
+
+	now := time.Now()
+	// Nanoseconds keep the number growing across restarts and replicas
+	crlPEM, err := pki.CreateCRL(caCertPEM, caKey, entries, big.NewInt(now.UnixNano()), now.Add(crlValidity))
+	if err != nil {
+		return nil, err
+	}
+
+	// TLS verification never reads a partial CRL
+	if err := writeFileAtomic(s.crlPath, crlPEM, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write CRL: %w", err)
+	}
+
+	s.current = crlPEM
+	s.revision = revisionOf(certs)
+	s.ca = caCertPEM
+	s.issuedAt = now
+	logger.Infof("Issued CRL with %d revoked certificates to %s", len(entries), s.crlPath)
+	return crlPEM, nil
+}
+
+// Current returns the last generated CRL.
+func (s *crlService) Current(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	current := s.current
+	s.mu.Unlock()
+	if current != nil {
+		return current, nil
+	}
+	return s.Generate(ctx)
+}
+
+// refresh reissues the CRL if certificates were revoked since it was issued, the CA was rotated or
+// it is getting old.
+func (s *crlService) refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	certs, err := s.store.GetRevokedCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to list revoked certificates: %w", err)
+	}
+	caCertPEM, _ := s.pki.CurrentCA()
+	if s.current != nil && revisionOf(certs) == s.revision && bytes.Equal(caCertPEM, s.ca) && time.Since(s.issuedAt) < crlRefresh {
+		return nil
+	}
+	_, err = s.generate(certs)
+	return err
+}
+
+// StartRefreshRoutine checks for new revocations periodically in the background.
+func (s *crlService) StartRefreshRoutine(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		failing := false
+		for {
+			if err := s.refresh(); err != nil {
+				// Logged once until it works again, e.g. while the CA key is kept offline
+				if !failing {
+					logger.Errorf("Failed to issue CRL: %v", err)
+				}
+				failing = true
+			} else {
+				failing = false
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// revisionOf identifies a set of revoked certificates: any revocation adds a certificate or
+// moves the latest revocation time.
+func revisionOf(certs []data.IssuedCertificate) string {
+	var latest time.Time
+	for _, cert := range certs {
+		if cert.UpdatedAt.After(latest) {
+			latest = cert.UpdatedAt
+		}
+	}
+	return fmt.Sprintf("%d@%d", len(certs), latest.UnixNano())
+}
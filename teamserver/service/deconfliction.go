@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"simplec2/teamserver/commands"
+	"simplec2/teamserver/data"
+)
+
+// Deconfliction log actions.
+const (
+	deconflictBeaconEstablished    = "beacon_established"
+	deconflictTaskDispatched       = "task_dispatched"
+	deconflictTaskFinished         = "task_finished"
+	deconflictPersistenceInstalled = "persistence_installed"
+	deconflictFileWritten          = "file_written"
+	deconflictFileCollected        = "file_collected"
+)
+
+// DeconflictionEntry is one action taken on a target host, for deconfliction with the client's blue team.
+type DeconflictionEntry struct {
+	Time       time.Time `json:"time"`
+	Hostname   string    `json:"hostname"`
+	InternalIP string    `json:"internal_ip"`
+	BeaconID   string    `json:"beacon_id"`
+	Action     string    `json:"action"`
+	Details    string    `json:"details"`
+	TaskID     string    `json:"task_id,omitempty"`
+	Operator   string    `json:"operator,omitempty"`
+	SourceIP   string    `json:"source_ip"`   // Address the beacon connected from, as seen by the listener
+	Listener   string    `json:"listener"`    // Listener the beacon talks to
+	C2Endpoint string    `json:"c2_endpoint"` // Callback URL (or port) of the listener
+}
+
+// DeconflictionLog lists every action taken in the engagement, per host in time order.
+func (s *reportService) DeconflictionLog(ctx context.Context) ([]DeconflictionEntry, error) {
+	engagement := EngagementFromContext(ctx)
+	beaconList, err := s.store.GetAllBeacons(engagement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get beacons: %w", err)
+	}
+	tasks, err := s.store.GetAllTasks(engagement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tasks: %w", err)
+	}
+	artifacts, err := s.store.GetAllArtifacts(engagement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get artifacts: %w", err)
+	}
+	loot, err := s.store.GetAllLootItems(engagement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get loot: %w", err)
+	}
+
+	beacons := make(map[string]*data.Beacon)
+	endpoints := make(map[string]string)
+	for i := range beaconList {
+		beacon := &beaconList[i]
+		beacons[beacon.BeaconID] = beacon
+		if _, ok := endpoints[beacon.Listener]; !ok {
+			endpoints[beacon.Listener] = s.listenerEndpoint(beacon.Listener)
+		}
+	}
+	// entry fills in the host and C2 columns of an action on a beacon
+	entry := func(beaconID string, t time.Time, action, details string) DeconflictionEntry {
+		e := DeconflictionEntry{Time: t, BeaconID: beaconID, Action: action, Details: details}
+		if beacon, ok := beacons[beaconID]; ok {
+			e.Hostname = beacon.Hostname
+			e.InternalIP = beacon.InternalIP
+			e.SourceIP = remoteHost(beacon.RemoteAddr)
+			e.Listener = beacon.Listener
+			e.C2Endpoint = endpoints[beacon.Listener]
+		}
+		return e
+	}
+
+	var log []DeconflictionEntry
+	for _, beacon := range beaconList {
+		log = append(log, entry(beacon.BeaconID, beacon.FirstSeen, deconflictBeaconEstablished,
+			fmt.Sprintf("%s (PID %d) running as %s", beacon.ProcessName, beacon.PID, beacon.Username)))
+	}
+	for _, task := range tasks {
+		if task.DispatchedAt == nil {
+			continue // Never reached the host
+		}
+		command := strings.TrimSpace(task.Command + " " + task.Arguments)
+		dispatched := entry(task.BeaconID, *task.DispatchedAt, deconflictTaskDispatched, command)
+		dispatched.TaskID, dispatched.Operator = task.TaskID, task.Operator
+		log = append(log, dispatched)
+
+		var persistence []string
+		for _, id := range task.Techniques {
+			if technique, _ := commands.LookupTechnique(id); technique.Tactic == "persistence" {
+				persistence = append(persistence, id+" "+technique.Name)
+			}
+		}
+		if len(persistence) > 0 {
+			installed := entry(task.BeaconID, *task.DispatchedAt, deconflictPersistenceInstalled, fmt.Sprintf("%s (%s)", command, strings.Join(persistence, ", ")))
+			installed.TaskID, installed.Operator = task.TaskID, task.Operator
+			log = append(log, installed)
+		}
+
+		switch task.Status {
+		case "completed", "failed", "timed_out", "canceled":
+			finished := entry(task.BeaconID, task.UpdatedAt, deconflictTaskFinished, fmt.Sprintf("%s: %s", task.Status, command))
+			finished.TaskID, finished.Operator = task.TaskID, task.Operator
+			log = append(log, finished)
+		}
+	}
+	for _, artifact := range artifacts {
+		if artifact.BeaconID == "" {
+			continue // Payload builds didn't touch a target
+		}
+		written := entry(artifact.BeaconID, artifact.CreatedAt, deconflictFileWritten, fmt.Sprintf("%s (%d bytes, SHA256 %s)", artifact.Path, artifact.Size, artifact.SHA256))
+		written.TaskID = artifact.TaskID
+		if written.Hostname == "" {
+			written.Hostname = artifact.Hostname
+		}
+		log = append(log, written)
+	}
+	for _, item := range loot {
+		collected := entry(item.BeaconID, item.CreatedAt, deconflictFileCollected, fmt.Sprintf("%s %s (%d bytes)", item.Type, item.OriginalPath, item.Size))
+		collected.TaskID = item.TaskID
+		if collected.Hostname == "" {
+			collected.Hostname = item.Hostname
+		}
+		log = append(log, collected)
+	}
+
+	sort.SliceStable(log, func(i, j int) bool {
+		if log[i].Hostname != log[j].Hostname {
+			return log[i].Hostname < log[j].Hostname
+		}
+		return log[i].Time.Before(log[j].Time)
+	})
+	return log, nil
+}
+
+// listenerEndpoint returns where beacons of a listener call back to, or "" if unknown.
+func (s *reportService) listenerEndpoint(name string) string {
+	listener, err := s.store.GetListener(name)
+	if err != nil || listener.Config == "" {
+		return ""
+	}
+	var cfg listenerBuildConfig
+	if err := json.Unmarshal([]byte(listener.Config), &cfg); err != nil {
+		return ""
+	}
+	if cfg.CallbackURL != "" {
+		return cfg.CallbackURL
+	}
+	if cfg.Port != "" {
+		return ":" + cfg.Port
+	}
+	return ""
+}
+
+// remoteHost strips the port from a beacon's remote address.
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
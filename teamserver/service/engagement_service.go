@@ -0,0 +1,372 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"simplec2/teamserver/data"
+
+	"gorm.io/gorm"
+)
+
+// DefaultEngagement holds everything created before engagements were introduced,
+// and anything created without an engagement, such as a listener that registers itself.
+const DefaultEngagement = "default"
+
+// ErrNoEngagementAccess is returned when an operator selects an engagement they are not a member of.
+var ErrNoEngagementAccess = errors.New("no access to engagement")
+
+var engagementNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+type engagementKey struct{}
+
+// WithEngagement scopes service calls made with the returned context to an engagement.
+// Records of other engagements are reported as not found.
+func WithEngagement(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, engagementKey{}, name)
+}
+
+// EngagementFromContext returns the engagement a context is scoped to,
+// or "" for internal calls (gRPC handlers, background jobs) which see every engagement.
+func EngagementFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(engagementKey{}).(string)
+	return name
+}
+
+// inEngagement reports whether a record belonging to engagement is visible in ctx.
+func inEngagement(ctx context.Context, engagement string) bool {
+	scope := EngagementFromContext(ctx)
+	return scope == "" || scope == engagement
+}
+
+// engagementForNew returns the engagement records created in ctx belong to.
+func engagementForNew(ctx context.Context) string {
+	if name := EngagementFromContext(ctx); name != "" {
+		return name
+	}
+	return DefaultEngagement
+}
+
+// getBeacon retrieves a beacon, treating beacons of other engagements as not found.
+func getBeacon(ctx context.Context, store data.DataStore, beaconID string) (*data.Beacon, error) {
+	beacon, err := store.GetBeacon(beaconID)
+	if err != nil {
+		return nil, err
+	}
+	if !inEngagement(ctx, beacon.Engagement) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return beacon, nil
+}
+
+// getListener retrieves a listener, treating listeners of other engagements as not found.
+func getListener(ctx context.Context, store data.DataStore, name string) (*data.Listener, error) {
+	listener, err := store.GetListener(name)
+	if err != nil {
+		return nil, err
+	}
+	if !inEngagement(ctx, listener.Engagement) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return listener, nil
+}
+
+// EngagementService defines the interface for engagement business logic.
+type EngagementService interface {
+	// ListEngagements retrieves the engagements an operator can access. Admins see every engagement.
+	ListEngagements(ctx context.Context, username, role string, page int, limit int) ([]data.Engagement, int64, error)
+
+	// GetEngagement retrieves an engagement by name.
+	GetEngagement(ctx context.Context, name string) (*data.Engagement, error)
+
+	// CreateEngagement creates a new engagement with an optional target scope.
+	CreateEngagement(ctx context.Context, name, description, createdBy string, scopeNetworks, scopeHosts []string) (*data.Engagement, error)
+
+	// UpdateEngagement changes the description or target scope of an engagement.
+	// Changing the scope re-evaluates the engagement's beacons.
+	UpdateEngagement(ctx context.Context, name string, update *EngagementUpdate) (*data.Engagement, error)
+
+	// BeaconInScope reports whether a beacon falls within its engagement's target scope.
+	BeaconInScope(ctx context.Context, beacon *data.Beacon) (bool, error)
+
+	// ListMembers retrieves the operators who are members of an engagement.
+	ListMembers(ctx context.Context, name string) ([]data.EngagementMember, error)
+
+	// AddMember grants an operator access to an engagement.
+	AddMember(ctx context.Context, name, username string) error
+
+	// RemoveMember revokes an operator's access to an engagement.
+	RemoveMember(ctx context.Context, name, username string) error
+
+	// CanAccess checks that the engagement exists and that the operator may work in it.
+	CanAccess(ctx context.Context, name, username, role string) error
+
+	// SetActiveEngagement selects the engagement an operator works in by default.
+	SetActiveEngagement(ctx context.Context, username, role, name string) error
+
+	// EnsureDefault creates the default engagement on first start and moves existing records and operators into it.
+	EnsureDefault(ctx context.Context) (bool, error)
+}
+
+// EngagementUpdate holds the engagement fields to change. Nil fields are left unchanged.
+type EngagementUpdate struct {
+	Description   *string
+	ScopeNetworks *[]string
+	ScopeHosts    *[]string
+}
+
+// engagementService implements the EngagementService interface.
+type engagementService struct {
+	store data.DataStore
+}
+
+// NewEngagementService creates a new instance of engagementService.
+func NewEngagementService(store data.DataStore) EngagementService {
+	return &engagementService{store: store}
+}
+
+// ListEngagements retrieves the engagements an operator can access. Admins see every engagement.
+func (s *engagementService) ListEngagements(ctx context.Context, username, role string, page int, limit int) ([]data.Engagement, int64, error) {
+	if role == RoleAdmin {
+		username = ""
+	}
+	engagements, total, err := s.store.GetEngagements(username, page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list engagements: %w", err)
+	}
+	return engagements, total, nil
+}
+
+// GetEngagement retrieves an engagement by name.
+func (s *engagementService) GetEngagement(ctx context.Context, name string) (*data.Engagement, error) {
+	engagement, err := s.store.GetEngagement(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get engagement: %w", err)
+	}
+	return engagement, nil
+}
+
+// CreateEngagement creates a new engagement with an optional target scope.
+func (s *engagementService) CreateEngagement(ctx context.Context, name, description, createdBy string, scopeNetworks, scopeHosts []string) (*data.Engagement, error) {
+	if !engagementNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid engagement name '%s' (letters, digits, '.', '_' and '-', at most 64 characters)", name)
+	}
+	if _, err := s.store.GetEngagement(name); err == nil {
+		return nil, fmt.Errorf("engagement '%s' already exists", name)
+	}
+	scope, err := ParseTargetScope(scopeNetworks, scopeHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	engagement := &data.Engagement{
+		Name:          name,
+		Description:   description,
+		CreatedBy:     createdBy,
+		ScopeNetworks: strings.Join(scope.Networks(), ","),
+		ScopeHosts:    strings.Join(scope.Hosts(), ","),
+	}
+	if err := s.store.CreateEngagement(engagement); err != nil {
+		return nil, fmt.Errorf("failed to create engagement: %w", err)
+	}
+	return engagement, nil
+}
+
+// UpdateEngagement changes the description or target scope of an engagement.
+// Changing the scope re-evaluates the engagement's beacons.
+func (s *engagementService) UpdateEngagement(ctx context.Context, name string, update *EngagementUpdate) (*data.Engagement, error) {
+	engagement, err := s.store.GetEngagement(name)
+	if err != nil {
+		return nil, fmt.Errorf("engagement not found: %w", err)
+	}
+
+	if update.Description != nil {
+		engagement.Description = *update.Description
+	}
+	scopeChanged := update.ScopeNetworks != nil || update.ScopeHosts != nil
+	if scopeChanged {
+		networks, hosts := splitScopeList(engagement.ScopeNetworks), splitScopeList(engagement.ScopeHosts)
+		if update.ScopeNetworks != nil {
+			networks = *update.ScopeNetworks
+		}
+		if update.ScopeHosts != nil {
+			hosts = *update.ScopeHosts
+		}
+		scope, err := ParseTargetScope(networks, hosts)
+		if err != nil {
+			return nil, err
+		}
+		engagement.ScopeNetworks = strings.Join(scope.Networks(), ",")
+		engagement.ScopeHosts = strings.Join(scope.Hosts(), ",")
+	}
+
+	if err := s.store.UpdateEngagement(engagement); err != nil {
+		return nil, fmt.Errorf("failed to update engagement: %w", err)
+	}
+	if scopeChanged {
+		if err := s.rescopeBeacons(engagement); err != nil {
+			return nil, err
+		}
+	}
+	return engagement, nil
+}
+
+// rescopeBeacons recomputes the out-of-scope flag of every beacon in an engagement.
+func (s *engagementService) rescopeBeacons(engagement *data.Engagement) error {
+	scope, err := EngagementScope(engagement)
+	if err != nil {
+		return err
+	}
+	for page := 1; ; page++ {
+		beacons, _, err := s.store.GetBeacons(&data.BeaconQuery{Page: page, Limit: 100, Engagement: engagement.Name, Archived: "all"})
+		if err != nil {
+			return fmt.Errorf("failed to list beacons: %w", err)
+		}
+		for i := range beacons {
+			outOfScope := !scope.Contains(&beacons[i])
+			if outOfScope == beacons[i].OutOfScope {
+				continue
+			}
+			if err := s.store.SetBeaconOutOfScope(beacons[i].BeaconID, outOfScope); err != nil {
+				return fmt.Errorf("failed to update beacon scope: %w", err)
+			}
+		}
+		if len(beacons) < 100 {
+			return nil
+		}
+	}
+}
+
+// BeaconInScope reports whether a beacon falls within its engagement's target scope.
+func (s *engagementService) BeaconInScope(ctx context.Context, beacon *data.Beacon) (bool, error) {
+	name := beacon.Engagement
+	if name == "" {
+		name = DefaultEngagement
+	}
+	engagement, err := s.store.GetEngagement(name)
+	if err != nil {
+		return false, fmt.Errorf("engagement not found: %w", err)
+	}
+	scope, err := EngagementScope(engagement)
+	if err != nil {
+		return false, fmt.Errorf("invalid scope on engagement '%s': %w", name, err)
+	}
+	return scope.Contains(beacon), nil
+}
+
+// ListMembers retrieves the operators who are members of an engagement.
+func (s *engagementService) ListMembers(ctx context.Context, name string) ([]data.EngagementMember, error) {
+	members, err := s.store.GetEngagementMembers(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list engagement members: %w", err)
+	}
+	return members, nil
+}
+
+// AddMember grants an operator access to an engagement.
+func (s *engagementService) AddMember(ctx context.Context, name, username string) error {
+	if _, err := s.store.GetEngagement(name); err != nil {
+		return fmt.Errorf("engagement not found: %w", err)
+	}
+	if _, err := s.store.GetOperator(username); err != nil {
+		return fmt.Errorf("operator not found: %w", err)
+	}
+	if member, err := s.store.IsEngagementMember(name, username); err != nil {
+		return fmt.Errorf("failed to check engagement membership: %w", err)
+	} else if member {
+		return nil
+	}
+
+	if err := s.store.AddEngagementMember(&data.EngagementMember{Engagement: name, Username: username}); err != nil {
+		return fmt.Errorf("failed to add engagement member: %w", err)
+	}
+	return nil
+}
+
+// RemoveMember revokes an operator's access to an engagement.
+func (s *engagementService) RemoveMember(ctx context.Context, name, username string) error {
+	if err := s.store.RemoveEngagementMember(name, username); err != nil {
+		return fmt.Errorf("failed to remove engagement member: %w", err)
+	}
+
+	// Don't leave the operator pointing at an engagement they can no longer open
+	if operator, err := s.store.GetOperator(username); err == nil && operator.ActiveEngagement == name {
+		operator.ActiveEngagement = ""
+		if err := s.store.UpdateOperator(operator); err != nil {
+			return fmt.Errorf("failed to update operator: %w", err)
+		}
+	}
+	return nil
+}
+
+// CanAccess checks that the engagement exists and that the operator may work in it.
+func (s *engagementService) CanAccess(ctx context.Context, name, username, role string) error {
+	if _, err := s.store.GetEngagement(name); err != nil {
+		return fmt.Errorf("engagement not found: %w", err)
+	}
+	if role == RoleAdmin {
+		return nil
+	}
+	member, err := s.store.IsEngagementMember(name, username)
+	if err != nil {
+		return fmt.Errorf("failed to check engagement membership: %w", err)
+	}
+	if !member {
+		return ErrNoEngagementAccess
+	}
+	return nil
+}
+
+// SetActiveEngagement selects the engagement an operator works in by default.
+func (s *engagementService) SetActiveEngagement(ctx context.Context, username, role, name string) error {
+	if err := s.CanAccess(ctx, name, username, role); err != nil {
+		return err
+	}
+	operator, err := s.store.GetOperator(username)
+	if err != nil {
+		return fmt.Errorf("operator not found: %w", err)
+	}
+	operator.ActiveEngagement = name
+	if err := s.store.UpdateOperator(operator); err != nil {
+		return fmt.Errorf("failed to update operator: %w", err)
+	}
+	return nil
+}
+
+// EnsureDefault creates the default engagement on first start and moves existing records and operators into it.
+func (s *engagementService) EnsureDefault(ctx context.Context) (bool, error) {
+	count, err := s.store.CountEngagements()
+	if err != nil {
+		return false, fmt.Errorf("failed to count engagements: %w", err)
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	if err := s.store.CreateEngagement(&data.Engagement{Name: DefaultEngagement, Description: "Records created before engagements were introduced", CreatedBy: "system"}); err != nil {
+		return false, fmt.Errorf("failed to create default engagement: %w", err)
+	}
+	if err := s.store.AssignUnscopedRecords(DefaultEngagement); err != nil {
+		return false, fmt.Errorf("failed to assign existing records to the default engagement: %w", err)
+	}
+
+	// Existing operators keep access to what they could see before
+	for page := 1; ; page++ {
+		operators, _, err := s.store.GetOperators(page, 100)
+		if err != nil {
+			return false, fmt.Errorf("failed to list operators: %w", err)
+		}
+		for _, operator := range operators {
+			if err := s.store.AddEngagementMember(&data.EngagementMember{Engagement: DefaultEngagement, Username: operator.Username}); err != nil {
+				return false, fmt.Errorf("failed to add engagement member: %w", err)
+			}
+		}
+		if len(operators) < 100 {
+			break
+		}
+	}
+	return true, nil
+}
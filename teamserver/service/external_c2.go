@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+// ExternalListenerType is the type of the listeners third-party implants are bridged through with
+// the external C2 API. Beacons registered through the API belong to such a listener.
+const ExternalListenerType = "external"
+
+// Errors of the external C2 API.
+var (
+	// ErrExternalListener is returned for listeners that don't exist in the engagement or are not
+	// of the ExternalListenerType.
+	ErrExternalListener = errors.New("not an external listener of the engagement")
+	// ErrExternalNotFound is returned for beacons and tasks that don't exist or are not reachable
+	// through the listener.
+	ErrExternalNotFound = errors.New("beacon or task not found")
+	// ErrExternalInvalid is returned for invalid requests, e.g. a negative chunk number.
+	ErrExternalInvalid = errors.New("invalid request")
+)
+
+// ExternalBeaconMetadata describes the host and process of a third-party implant.
+type ExternalBeaconMetadata struct {
+	OS            string `json:"os"`   // e.g. "windows", "linux", "darwin"
+	Arch          string `json:"arch"` // e.g. "amd64", "arm64", "x86"
+	Username      string `json:"username"`
+	Hostname      string `json:"hostname"`
+	InternalIP    string `json:"internal_ip"`
+	ProcessName   string `json:"process_name"`
+	PID           int32  `json:"pid"`
+	HighIntegrity bool   `json:"high_integrity"`
+	AgentVersion  string `json:"agent_version"`
+}
+
+// ExternalTask is a task handed to a third-party implant.
+type ExternalTask struct {
+	TaskID    string `json:"task_id"`
+	Command   string `json:"command"`    // e.g. "shell", see GET /api/v1/commands
+	CommandID uint32 `json:"command_id"` // Opcode of the command in SimpleC2's own agents
+	Arguments []byte `json:"arguments"`  // Arguments in the command's format, base64 in JSON
+}
+
+// ExternalOutput is the result of a task, or part of it, sent by a third-party implant.
+type ExternalOutput struct {
+	TaskID string `json:"task_id"`
+	Status int32  `json:"status"` // 0 for success
+	Output []byte `json:"output"` // Output in the command's format, base64 in JSON
+	Error  string `json:"error"`  // Why the task failed if Status is not 0
+	// False for intermediate output of a task that is still running; final if not set
+	Final *bool `json:"final,omitempty"`
+}
+
+// ExternalC2 bridges third-party implants into SimpleC2 the way a listener does, through a
+// stable API that doesn't change with the internal listener bridge. Every call names the external
+// listener the implant talks through; remoteAddr is where the implant connects from.
+type ExternalC2 interface {
+	// RegisterBeacon registers a new beacon and returns its ID.
+	RegisterBeacon(ctx context.Context, listener, remoteAddr string, metadata *ExternalBeaconMetadata) (string, error)
+
+	// CheckIn records that a beacon is alive, confirms the tasks it received on its last check-in,
+	// and returns its queued tasks.
+	CheckIn(ctx context.Context, listener, beaconID, remoteAddr string, ackedTaskIDs []string) ([]ExternalTask, error)
+
+	// PushOutput records the output of a task of a beacon.
+	PushOutput(ctx context.Context, listener, beaconID, remoteAddr string, output *ExternalOutput) error
+
+	// GetTaskFileChunk returns a chunk of the file a download or upgrade task sends to a beacon.
+	// The chunk is empty past the end of the file.
+	GetTaskFileChunk(ctx context.Context, listener, beaconID, taskID string, chunk int32) ([]byte, error)
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"simplec2/pkg/config"
+)
+
+// Health check results.
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+)
+
+// HealthCheckResult is the outcome of one readiness check.
+type HealthCheckResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// HealthReport is the outcome of all readiness checks; its status is "ok" only if every check passed.
+type HealthReport struct {
+	Status    string              `json:"status"`
+	CheckedAt time.Time           `json:"checked_at"`
+	Checks    []HealthCheckResult `json:"checks"`
+}
+
+// HealthService defines the interface for the TeamServer's readiness checks.
+type HealthService interface {
+	// AddCheck registers a dependency the TeamServer needs to serve requests.
+	// Call it before the API is started.
+	AddCheck(name string, check func(ctx context.Context) error)
+
+	// Ready runs every check concurrently, each bounded by health.check_timeout.
+	Ready(ctx context.Context) *HealthReport
+}
+
+// healthCheck is a registered readiness check.
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// healthService implements the HealthService interface.
+type healthService struct {
+	config config.HealthConfig
+	checks []healthCheck
+}
+
+// NewHealthService creates a new instance of healthService.
+func NewHealthService(cfg config.HealthConfig) HealthService {
+	return &healthService{config: cfg}
+}
+
+// AddCheck registers a readiness check.
+func (s *healthService) AddCheck(name string, check func(ctx context.Context) error) {
+	s.checks = append(s.checks, healthCheck{name: name, check: check})
+}
+
+// Ready runs every readiness check.
+func (s *healthService) Ready(ctx context.Context) *HealthReport {
+	report := &HealthReport{Status: HealthOK, CheckedAt: time.Now(), Checks: make([]HealthCheckResult, len(s.checks))}
+	var wg sync.WaitGroup
+	for i, check := range s.checks {
+		wg.Add(1)
+		go func(i int, check healthCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, s.config.GetCheckTimeout())
+			defer cancel()
+			start := time.Now()
+			err := runHealthCheck(checkCtx, check.check)
+			result := HealthCheckResult{Name: check.name, Status: HealthOK, DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = HealthFail
+				result.Error = err.Error()
+			}
+			report.Checks[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != HealthOK {
+			report.Status = HealthFail
+		}
+	}
+	return report
+}
+
+// runHealthCheck runs a check, giving up when ctx is done even if the check ignores ctx.
+func runHealthCheck(ctx context.Context, check func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("check timed out: %w", ctx.Err())
+	}
+}
+
+// DiskSpaceCheck returns a readiness check that fails when the file system holding dir has less
+// than minFree bytes available. A directory that doesn't exist yet is checked on its parent.
+func DiskSpaceCheck(dir string, minFree uint64) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		free, err := freeDiskSpace(existingParent(dir))
+		if err != nil {
+			return fmt.Errorf("failed to get free space of %s: %w", dir, err)
+		}
+		if free < minFree {
+			return fmt.Errorf("%d MB free on %s, %d MB required", free>>20, dir, minFree>>20)
+		}
+		return nil
+	}
+}
+
+// existingParent returns dir, or its closest ancestor that exists.
+func existingParent(dir string) string {
+	dir = filepath.Clean(dir)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"simplec2/teamserver/data"
+
+	"gorm.io/gorm"
+)
+
+// NetworkMapNode is a host, beacon, network or credential in the network map.
+type NetworkMapNode struct {
+	ID    string      `json:"id"`
+	Type  string      `json:"type"` // "network", "host", "beacon" or "credential"
+	Label string      `json:"label"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// NetworkMapEdge connects two nodes of the network map.
+type NetworkMapEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"` // "member_of", "runs_on", "discovered" or "valid_on"
+}
+
+// NetworkMap is the graph of an engagement's hosts, the beacons on them and the credentials valid on them.
+type NetworkMap struct {
+	Nodes []NetworkMapNode `json:"nodes"`
+	Edges []NetworkMapEdge `json:"edges"`
+}
+
+// HostService defines the interface for the host inventory.
+type HostService interface {
+	// ListHosts retrieves hosts, optionally filtered by address, hostname or OS.
+	ListHosts(ctx context.Context, search string, page int, limit int) ([]data.Host, int64, error)
+
+	// GetHost retrieves a host by its ID.
+	GetHost(ctx context.Context, id uint) (*data.Host, error)
+
+	// SaveHost records a host. If the address is already known, the new details are merged into it.
+	SaveHost(ctx context.Context, host *data.Host) (*data.Host, error)
+
+	// DeleteHost removes a host from the inventory.
+	DeleteHost(ctx context.Context, id uint) error
+
+	// RecordBeaconHost records the host a beacon runs on. Returns nil if the beacon has no usable internal IP.
+	RecordBeaconHost(beacon *data.Beacon) (*data.Host, error)
+
+	// DiscoverHosts records the hosts found in the output of a completed discovery task, such as "arp -a".
+	DiscoverHosts(task *data.Task) ([]data.Host, error)
+
+	// NetworkMap returns the graph of hosts, beacons and credentials.
+	NetworkMap(ctx context.Context) (*NetworkMap, error)
+}
+
+// hostService implements the HostService interface.
+type hostService struct {
+	store data.DataStore
+}
+
+// NewHostService creates a new instance of hostService.
+func NewHostService(store data.DataStore) HostService {
+	return &hostService{store: store}
+}
+
+// ListHosts retrieves hosts, optionally filtered by address, hostname or OS.
+func (s *hostService) ListHosts(ctx context.Context, search string, page int, limit int) ([]data.Host, int64, error) {
+	hosts, total, err := s.store.GetHosts(EngagementFromContext(ctx), search, page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list hosts: %w", err)
+	}
+	return hosts, total, nil
+}
+
+// GetHost retrieves a host by its ID.
+func (s *hostService) GetHost(ctx context.Context, id uint) (*data.Host, error) {
+	host, err := s.store.GetHost(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host: %w", err)
+	}
+	if !inEngagement(ctx, host.Engagement) {
+		return nil, fmt.Errorf("failed to get host: %w", gorm.ErrRecordNotFound)
+	}
+	return host, nil
+}
+
+// SaveHost records a host. If the address is already known, the new details are merged into it.
+func (s *hostService) SaveHost(ctx context.Context, host *data.Host) (*data.Host, error) {
+	ip := net.ParseIP(strings.TrimSpace(host.Address))
+	if ip == nil {
+		return nil, fmt.Errorf("invalid host address: %q", host.Address)
+	}
+	host.Address = ip.String()
+	for _, port := range host.Ports {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port: %d", port)
+		}
+	}
+	if host.Engagement == "" {
+		host.Engagement = engagementForNew(ctx)
+	}
+	if host.LastSeen.IsZero() {
+		host.LastSeen = time.Now()
+	}
+
+	existing, err := s.store.GetHostByAddress(host.Engagement, host.Address)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		host.Ports = mergePorts(nil, host.Ports)
+		if err := s.store.CreateHost(host); err != nil {
+			return nil, fmt.Errorf("failed to create host: %w", err)
+		}
+		return host, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host: %w", err)
+	}
+
+	// Known details are only replaced by newer, non-empty ones
+	if host.Hostname != "" {
+		existing.Hostname = host.Hostname
+	}
+	if host.OS != "" {
+		existing.OS = host.OS
+	}
+	if host.MAC != "" {
+		existing.MAC = host.MAC
+	}
+	if host.Note != "" {
+		existing.Note = host.Note
+	}
+	if existing.DiscoveredBy == "" {
+		existing.DiscoveredBy = host.DiscoveredBy
+	}
+	existing.Ports = mergePorts(existing.Ports, host.Ports)
+	if host.LastSeen.After(existing.LastSeen) {
+		existing.LastSeen = host.LastSeen
+	}
+	if err := s.store.UpdateHost(existing); err != nil {
+		return nil, fmt.Errorf("failed to update host: %w", err)
+	}
+	return existing, nil
+}
+
+// DeleteHost removes a host from the inventory.
+func (s *hostService) DeleteHost(ctx context.Context, id uint) error {
+	if _, err := s.GetHost(ctx, id); err != nil {
+		return err
+	}
+	if err := s.store.DeleteHost(id); err != nil {
+		return fmt.Errorf("failed to delete host: %w", err)
+	}
+	return nil
+}
+
+// RecordBeaconHost records the host a beacon runs on. Returns nil if the beacon has no usable internal IP.
+func (s *hostService) RecordBeaconHost(beacon *data.Beacon) (*data.Host, error) {
+	if ip := net.ParseIP(beacon.InternalIP); ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+		return nil, nil
+	}
+	return s.SaveHost(context.Background(), &data.Host{
+		Engagement: beacon.Engagement,
+		Address:    beacon.InternalIP,
+		Hostname:   beacon.Hostname,
+		OS:         beacon.OS,
+		Source:     "beacon",
+		LastSeen:   beacon.LastSeen,
+	})
+}
+
+var (
+	// ipv4Pattern finds IPv4 addresses in command output.
+	ipv4Pattern = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`)
+	// macPattern finds MAC addresses, with ':' or '-' separators.
+	macPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{2}(?:[:-][0-9a-f]{2}){5}\b`)
+)
+
+// discoveryCommand returns the discovery command a shell task ran, or "" if it isn't one.
+func discoveryCommand(arguments string) string {
+	fields := strings.Fields(strings.ToLower(arguments))
+	switch {
+	case len(fields) == 0:
+		return ""
+	case fields[0] == "arp" || fields[0] == "arp.exe":
+		return "arp"
+	case fields[0] == "ip" && len(fields) > 1 && strings.HasPrefix("neighbour", fields[1]):
+		return "ip neigh"
+	}
+	return ""
+}
+
+// DiscoverHosts records the hosts found in the output of a completed discovery task, such as "arp -a".
+// Only neighbour table entries with a MAC address are taken, which skips interface headers and broadcast entries.
+func (s *hostService) DiscoverHosts(task *data.Task) ([]data.Host, error) {
+	if task.Command != "shell" || task.Status != "completed" {
+		return nil, nil
+	}
+	source := discoveryCommand(task.Arguments)
+	if source == "" {
+		return nil, nil
+	}
+
+	// The beacon's own host shows up in some neighbour tables, it was not discovered
+	self := ""
+	if beacon, err := s.store.GetBeacon(task.BeaconID); err == nil {
+		self = beacon.InternalIP
+	}
+
+	var hosts []data.Host
+	for _, line := range strings.Split(task.Output, "\n") {
+		mac := macPattern.FindString(line)
+		address := ipv4Pattern.FindString(line)
+		if mac == "" || address == "" {
+			continue
+		}
+		mac = strings.ToLower(strings.ReplaceAll(mac, "-", ":"))
+		ip := net.ParseIP(address)
+		if ip == nil || mac == "ff:ff:ff:ff:ff:ff" || ip.IsMulticast() || ip.IsLoopback() || ip.Equal(net.IPv4bcast) || address == self {
+			continue
+		}
+
+		host, err := s.SaveHost(context.Background(), &data.Host{
+			Engagement:   task.Engagement,
+			Address:      address,
+			MAC:          mac,
+			Source:       source,
+			DiscoveredBy: task.BeaconID,
+		})
+		if err != nil {
+			return hosts, err
+		}
+		hosts = append(hosts, *host)
+	}
+	return hosts, nil
+}
+
+// NetworkMap returns the graph of hosts, beacons and credentials.
+// Hosts are grouped into /24 (IPv4) or /64 (IPv6) networks.
+func (s *hostService) NetworkMap(ctx context.Context) (*NetworkMap, error) {
+	engagement := EngagementFromContext(ctx)
+	hosts, err := s.store.GetAllHosts(engagement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hosts: %w", err)
+	}
+	credentials, err := s.store.GetAllCredentials(engagement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list credentials: %w", err)
+	}
+	var beacons []data.Beacon
+	for page := 1; ; page++ {
+		batch, _, err := s.store.GetBeacons(&data.BeaconQuery{Page: page, Limit: 100, Engagement: engagement, Archived: "all"})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list beacons: %w", err)
+		}
+		beacons = append(beacons, batch...)
+		if len(batch) < 100 {
+			break
+		}
+	}
+
+	graph := &NetworkMap{Nodes: []NetworkMapNode{}, Edges: []NetworkMapEdge{}}
+	networks := make(map[string]bool)
+	hostNodes := make(map[string]string) // engagement/address -> node ID
+	for i := range hosts {
+		host := &hosts[i]
+		id := fmt.Sprintf("host:%d", host.ID)
+		hostNodes[host.Engagement+"/"+host.Address] = id
+		label := host.Address
+		if host.Hostname != "" {
+			label = host.Hostname + " (" + host.Address + ")"
+		}
+		graph.Nodes = append(graph.Nodes, NetworkMapNode{ID: id, Type: "host", Label: label, Data: host})
+
+		if network := hostNetwork(host.Address); network != "" {
+			networkID := "network:" + host.Engagement + "/" + network
+			if !networks[networkID] {
+				networks[networkID] = true
+				graph.Nodes = append(graph.Nodes, NetworkMapNode{ID: networkID, Type: "network", Label: network})
+			}
+			graph.Edges = append(graph.Edges, NetworkMapEdge{Source: id, Target: networkID, Type: "member_of"})
+		}
+		if host.DiscoveredBy != "" {
+			graph.Edges = append(graph.Edges, NetworkMapEdge{Source: "beacon:" + host.DiscoveredBy, Target: id, Type: "discovered"})
+		}
+	}
+
+	beaconNodes := make(map[string]bool)
+	for i := range beacons {
+		beacon := &beacons[i]
+		id := "beacon:" + beacon.BeaconID
+		beaconNodes[id] = true
+		graph.Nodes = append(graph.Nodes, NetworkMapNode{ID: id, Type: "beacon", Label: beacon.Username + "@" + beacon.Hostname, Data: beacon})
+		if hostID, ok := hostNodes[beacon.Engagement+"/"+beacon.InternalIP]; ok {
+			graph.Edges = append(graph.Edges, NetworkMapEdge{Source: id, Target: hostID, Type: "runs_on"})
+		}
+	}
+	// Drop "discovered" edges of beacons that were deleted
+	edges := graph.Edges[:0]
+	for _, edge := range graph.Edges {
+		if edge.Type != "discovered" || beaconNodes[edge.Source] {
+			edges = append(edges, edge)
+		}
+	}
+	graph.Edges = edges
+
+	for i := range credentials {
+		credential := &credentials[i]
+		id := fmt.Sprintf("credential:%d", credential.ID)
+		label := credential.Username
+		if credential.Domain != "" {
+			label = credential.Domain + `\` + credential.Username
+		}
+		graph.Nodes = append(graph.Nodes, NetworkMapNode{ID: id, Type: "credential", Label: label, Data: credential})
+		if credential.HostID != nil {
+			graph.Edges = append(graph.Edges, NetworkMapEdge{Source: id, Target: fmt.Sprintf("host:%d", *credential.HostID), Type: "valid_on"})
+		}
+	}
+	return graph, nil
+}
+
+// hostNetwork returns the /24 (IPv4) or /64 (IPv6) network of an address.
+func hostNetwork(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+// mergePorts returns the sorted union of two port lists.
+func mergePorts(a, b []int) []int {
+	seen := make(map[int]bool, len(a)+len(b))
+	ports := []int{}
+	for _, port := range append(append([]int{}, a...), b...) {
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	sort.Ints(ports)
+	return ports
+}
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"simplec2/pkg/bridge"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/filecrypt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// hostedFileChunkSize is the size of the parts a hosted file is sent to its listener in.
+	hostedFileChunkSize = 1 << 20
+	// maxHostedFileSize bounds hosted files, which listeners keep in memory.
+	maxHostedFileSize = 100 << 20
+)
+
+var (
+	// ErrInvalidHostedFile is returned for hosted file settings that can't be used.
+	ErrInvalidHostedFile = errors.New("invalid hosted file")
+	// ErrHostedFileExists is returned when the listener already hosts a file at the URI.
+	ErrHostedFileExists = errors.New("a file is already hosted at this URI")
+)
+
+// HostFileOptions describes a file to host on a listener. The file is either uploaded through
+// /upload (FilePath) or a completed payload (PayloadID).
+type HostFileOptions struct {
+	URI          string
+	FilePath     string
+	PayloadID    string
+	ContentType  string
+	MaxDownloads int64 // 0 for no limit
+}
+
+// HostedFileService defines the interface for the files listeners serve to anyone requesting
+// their URI, e.g. for download cradles and payload hosting.
+type HostedFileService interface {
+	// HostFile hosts a file on a listener and sends it to the listener if it is connected.
+	HostFile(ctx context.Context, listener string, opts HostFileOptions, by string) (*data.HostedFile, error)
+
+	// ListHostedFiles returns the files hosted on a listener.
+	ListHostedFiles(ctx context.Context, listener string) ([]data.HostedFile, error)
+
+	// UnhostFile stops hosting a file on a listener.
+	UnhostFile(ctx context.Context, listener string, fileID string) error
+
+	// SyncListener sends a listener that opened its control channel the files it hosts.
+	SyncListener(name string)
+
+	// RecordDownloads adds the downloads a listener reported to the counters of its hosted files.
+	RecordDownloads(name string, downloads []*bridge.HostedFileDownload)
+}
+
+// hostedFileService implements the HostedFileService interface.
+type hostedFileService struct {
+	store      data.DataStore
+	listeners  ListenerService
+	payloads   PayloadService
+	uploadsDir string
+	broadcast  func(engagement string, data []byte)
+}
+
+// NewHostedFileService creates a new instance of hostedFileService. Hosted files are taken from
+// uploadsDir or the payloads; broadcast sends HOSTED_FILE_DOWNLOADED when a listener reports a download.
+func NewHostedFileService(store data.DataStore, listeners ListenerService, payloads PayloadService, uploadsDir string, broadcast func(engagement string, data []byte)) HostedFileService {
+	return &hostedFileService{store: store, listeners: listeners, payloads: payloads, uploadsDir: uploadsDir, broadcast: broadcast}
+}
+
+// HostFile validates and records a hosted file, then delivers it to the listener.
+func (s *hostedFileService) HostFile(ctx context.Context, listenerName string, opts HostFileOptions, by string) (*data.HostedFile, error) {
+	listener, err := getListener(ctx, s.store, listenerName)
+	if err != nil {
+		return nil, fmt.Errorf("listener not found: %w", err)
+	}
+	if listener.Type == ExternalListenerType {
+		return nil, fmt.Errorf("%w: external listeners can't host files", ErrInvalidHostedFile)
+	}
+	if err := validateListenerURI(opts.URI); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHostedFile, err)
+	}
+	if opts.MaxDownloads < 0 {
+		return nil, fmt.Errorf("%w: max_downloads can't be negative", ErrInvalidHostedFile)
+	}
+
+	sourcePath, fileName, err := s.resolveSource(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	size, sum, err := hashPlaintext(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if size > maxHostedFileSize {
+		return nil, fmt.Errorf("%w: files larger than %d MB can't be hosted", ErrInvalidHostedFile, maxHostedFileSize>>20)
+	}
+
+	existing, err := s.store.GetHostedFiles(listenerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hosted files: %w", err)
+	}
+	for _, file := range existing {
+		if file.URI == opts.URI {
+			return nil, fmt.Errorf("%w: %s", ErrHostedFileExists, opts.URI)
+		}
+	}
+	canaries, err := s.store.GetCanaries(listenerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get canaries: %w", err)
+	}
+	for _, canary := range canaries {
+		if canary.URI == opts.URI {
+			return nil, fmt.Errorf("%w: %s is a canary", ErrHostedFileExists, opts.URI)
+		}
+	}
+
+	file := &data.HostedFile{
+		FileID:       uuid.New().String(),
+		Listener:     listenerName,
+		URI:          opts.URI,
+		FileName:     fileName,
+		FilePath:     sourcePath,
+		ContentType:  opts.ContentType,
+		Size:         size,
+		SHA256:       sum,
+		MaxDownloads: opts.MaxDownloads,
+		CreatedBy:    by,
+		Engagement:   listener.Engagement,
+	}
+	if err := s.store.CreateHostedFile(file); err != nil {
+		return nil, fmt.Errorf("failed to create hosted file: %w", err)
+	}
+
+	// A listener that isn't connected gets the file when it connects
+	if err := s.deliver(file); err != nil {
+		logger.Warnf("Hosted file %s not delivered to listener %s yet: %v", file.URI, listenerName, err)
+	}
+	return file, nil
+}
+
+// listenerEndpoints are the paths listeners serve beacons at, which can't be used for hosted files
+// or canaries.
+var listenerEndpoints = map[string]bool{"/handshake": true, "/stage": true, "/checkin": true, "/output": true, "/chunk": true}
+
+// validateListenerURI checks that a URI a listener serves is a clean absolute path, e.g.
+// "/static/update.ps1", and not one of the beacon endpoints.
+func validateListenerURI(uri string) error {
+	if !strings.HasPrefix(uri, "/") || uri == "/" {
+		return fmt.Errorf("the URI must be a path starting with /")
+	}
+	if path.Clean(uri) != uri || strings.ContainsAny(uri, "?#") {
+		return fmt.Errorf("the URI must be a clean path without query or fragment")
+	}
+	if len(uri) > 191 {
+		return fmt.Errorf("the URI is too long")
+	}
+	if listenerEndpoints[uri] {
+		return fmt.Errorf("%s is a beacon endpoint", uri)
+	}
+	return nil
+}
+
+// resolveSource returns the path and name of the file to host. Uploaded files must be inside the
+// uploads directory.
+func (s *hostedFileService) resolveSource(ctx context.Context, opts HostFileOptions) (string, string, error) {
+	switch {
+	case opts.PayloadID != "" && opts.FilePath != "":
+		return "", "", fmt.Errorf("%w: set either filepath or payload_id", ErrInvalidHostedFile)
+	case opts.PayloadID != "":
+		payload, err := s.payloads.GetPayload(ctx, opts.PayloadID)
+		if err != nil {
+			return "", "", fmt.Errorf("payload not found: %w", err)
+		}
+		if payload.Status != "completed" {
+			return "", "", fmt.Errorf("%w: payload %s is not ready (status: %s)", ErrInvalidHostedFile, opts.PayloadID, payload.Status)
+		}
+		return payload.FilePath, payload.FileName, nil
+	case opts.FilePath != "":
+		absPath, err := filepath.Abs(opts.FilePath)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %v", ErrInvalidHostedFile, err)
+		}
+		absDir, err := filepath.Abs(s.uploadsDir)
+		if err != nil {
+			return "", "", fmt.Errorf("could not resolve uploads directory: %w", err)
+		}
+		if !strings.HasPrefix(absPath, absDir+string(filepath.Separator)) {
+			return "", "", fmt.Errorf("%w: the file must be uploaded through /upload first", ErrInvalidHostedFile)
+		}
+		return absPath, filepath.Base(absPath), nil
+	default:
+		return "", "", fmt.Errorf("%w: filepath or payload_id is required", ErrInvalidHostedFile)
+	}
+}
+
+// hashPlaintext returns the size and SHA256 of a file's content, decrypted if the file is encrypted at rest.
+func hashPlaintext(path string) (int64, string, error) {
+	f, err := filecrypt.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ListHostedFiles returns the files hosted on a listener.
+func (s *hostedFileService) ListHostedFiles(ctx context.Context, listenerName string) ([]data.HostedFile, error) {
+	if _, err := getListener(ctx, s.store, listenerName); err != nil {
+		return nil, fmt.Errorf("listener not found: %w", err)
+	}
+	return s.store.GetHostedFiles(listenerName)
+}
+
+// UnhostFile deletes a hosted file and tells its listener to stop serving it.
+func (s *hostedFileService) UnhostFile(ctx context.Context, listenerName string, fileID string) error {
+	if _, err := getListener(ctx, s.store, listenerName); err != nil {
+		return fmt.Errorf("listener not found: %w", err)
+	}
+	file, err := s.store.GetHostedFile(fileID)
+	if err != nil {
+		return fmt.Errorf("hosted file not found: %w", err)
+	}
+	if file.Listener != listenerName {
+		return fmt.Errorf("hosted file not found: %w", gorm.ErrRecordNotFound)
+	}
+	if err := s.store.DeleteHostedFile(fileID); err != nil {
+		return fmt.Errorf("failed to delete hosted file: %w", err)
+	}
+
+	// A listener that isn't connected drops the file when it connects
+	cmd := &bridge.ListenerCommand{Action: bridge.ListenerCommand_UNHOST_FILE, HostedFile: &bridge.HostedFile{Id: fileID}}
+	if err := s.listeners.SendCommand(listenerName, cmd); err != nil {
+		logger.Warnf("Listener %s not told to stop hosting %s yet: %v", listenerName, file.URI, err)
+	}
+	return nil
+}
+
+// SyncListener tells a listener which files it hosts, dropping the ones deleted while it wasn't
+// connected, and sends it their content.
+func (s *hostedFileService) SyncListener(name string) {
+	files, err := s.store.GetHostedFiles(name)
+	if err != nil {
+		logger.Errorf("Failed to get files hosted on listener %s: %v", name, err)
+		return
+	}
+	ids := make([]string, 0, len(files))
+	for _, file := range files {
+		ids = append(ids, file.FileID)
+	}
+	cmd := &bridge.ListenerCommand{Action: bridge.ListenerCommand_SYNC_HOSTED_FILES, HostedFileIds: ids}
+	if err := s.listeners.SendCommand(name, cmd); err != nil {
+		logger.Errorf("Failed to sync hosted files of listener %s: %v", name, err)
+		return
+	}
+	for i := range files {
+		if err := s.deliver(&files[i]); err != nil {
+			logger.Errorf("Failed to send hosted file %s to listener %s: %v", files[i].URI, name, err)
+		}
+	}
+}
+
+// deliver sends a hosted file to its listener in parts of hostedFileChunkSize. Files out of
+// downloads aren't sent.
+func (s *hostedFileService) deliver(file *data.HostedFile) error {
+	var downloadsLeft int64
+	if file.MaxDownloads > 0 {
+		downloadsLeft = file.MaxDownloads - file.Downloads
+		if downloadsLeft <= 0 {
+			return nil
+		}
+	}
+
+	f, err := filecrypt.Open(file.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, hostedFileChunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		// An empty file is still sent once
+		if n > 0 || offset == 0 {
+			part := &bridge.HostedFile{
+				Id:            file.FileID,
+				Uri:           file.URI,
+				ContentType:   file.ContentType,
+				Size:          file.Size,
+				Sha256:        file.SHA256,
+				Offset:        offset,
+				Data:          buf[:n],
+				DownloadsLeft: downloadsLeft,
+			}
+			if err := s.listeners.SendCommand(file.Listener, &bridge.ListenerCommand{Action: bridge.ListenerCommand_HOST_FILE, HostedFile: part}); err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if n < len(buf) {
+			return nil
+		}
+	}
+}
+
+// RecordDownloads adds the downloads a listener reported to its hosted files and broadcasts them.
+func (s *hostedFileService) RecordDownloads(name string, downloads []*bridge.HostedFileDownload) {
+	byFile := make(map[string][]*bridge.HostedFileDownload)
+	for _, download := range downloads {
+		byFile[download.FileId] = append(byFile[download.FileId], download)
+	}
+
+	for fileID, fileDownloads := range byFile {
+		file, err := s.store.GetHostedFile(fileID)
+		if err != nil || file.Listener != name {
+			// Deleted since, or not this listener's
+			continue
+		}
+		last := fileDownloads[len(fileDownloads)-1]
+		lastAt := time.Now()
+		if last.Time != nil {
+			lastAt = last.Time.AsTime()
+		}
+		if err := s.store.AddHostedFileDownloads(fileID, int64(len(fileDownloads)), lastAt, last.RemoteAddr); err != nil {
+			logger.Errorf("Failed to record downloads of hosted file %s: %v", file.URI, err)
+			continue
+		}
+		logger.Infof("Hosted file %s on listener %s downloaded %d times, last by %s", file.URI, name, len(fileDownloads), last.RemoteAddr)
+
+		if s.broadcast == nil {
+			continue
+		}
+		if updated, err := s.store.GetHostedFile(fileID); err == nil {
+			file = updated
+		}
+		event, err := json.Marshal(map[string]interface{}{
+			"type": "HOSTED_FILE_DOWNLOADED",
+			"payload": map[string]interface{}{
+				"file":        file,
+				"remote_addr": last.RemoteAddr,
+				"user_agent":  last.UserAgent,
+			},
+		})
+		if err != nil {
+			logger.Errorf("Error marshalling HOSTED_FILE_DOWNLOADED event: %v", err)
+			continue
+		}
+		s.broadcast(file.Engagement, event)
+	}
+}
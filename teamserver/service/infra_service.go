@@ -0,0 +1,529 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/pkg/pki"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/infra"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+// Statuses of an infrastructure asset.
+const (
+	AssetProvisioning = "provisioning"
+	AssetDeploying    = "deploying"
+	AssetReady        = "ready"
+	AssetDestroying   = "destroying"
+	AssetDestroyed    = "destroyed"
+	AssetFailed       = "failed"
+)
+
+const (
+	// listenerConnectTimeout bounds waiting for a deployed listener to open its control channel.
+	listenerConnectTimeout = time.Minute
+	// listenerLogLines is how many lines of its log are returned when a deployed listener fails.
+	listenerLogLines = 20
+	// assetPollInterval is how often a new server is checked until it runs.
+	assetPollInterval = 5 * time.Second
+	// deployTimeout bounds deploying a listener on a server that accepts SSH.
+	deployTimeout = 5 * time.Minute
+	// destroyTimeout bounds destroying a server.
+	destroyTimeout = 2 * time.Minute
+)
+
+// ErrAssetBusy is returned when an asset is changed while it is being provisioned or destroyed.
+var ErrAssetBusy = errors.New("the asset is being provisioned or destroyed")
+
+// ProvisionRequest describes a redirector to provision. Empty region, size and image use the
+// provider's defaults.
+type ProvisionRequest struct {
+	Provider string
+	Name     string // Server name, also its hostname
+	Region   string
+	Size     string
+	Image    string
+	// Optional: listener deployed on the server once it accepts SSH. It is created in the
+	// engagement if it doesn't exist yet
+	Listener *ProvisionListener
+}
+
+// ProvisionListener is the listener deployed on a provisioned server.
+type ProvisionListener struct {
+	Name   string
+	Type   string // Defaults to "http"
+	Config string // JSON configuration, e.g. {"port": 443}
+}
+
+// DeployTarget is an existing host a listener is deployed to over SSH.
+type DeployTarget struct {
+	Address  string // Host name or IP, with an optional port (22 by default)
+	User     string // Defaults to "root"; other users need passwordless sudo
+	HostKey  string // Host key of the server in the authorized_keys format, the only one accepted
+	Password string // Optional: logs in with the password instead of the TeamServer's SSH key
+	// Address the listener reaches the gRPC bridge at; infrastructure.teamserver_host if empty
+	TeamServerHost string
+}
+
+// ListenerDeployment is the result of deploying a listener on a host.
+type ListenerDeployment struct {
+	Listener          *data.Listener `json:"listener"` // Active once its control channel is up
+	Host              string         `json:"host"`
+	Unit              string         `json:"unit"` // systemd unit running the listener
+	CertificateSerial string         `json:"certificate_serial"`
+}
+
+// ErrListenerNotConnected is returned when a deployed listener does not open its control channel
+// in time.
+var ErrListenerNotConnected = errors.New("the deployed listener did not connect to the TeamServer")
+
+// ErrDeployFailed is returned when logging in to a host or installing a listener on it fails.
+var ErrDeployFailed = errors.New("failed to deploy listener")
+
+// InfraService defines the interface for provisioning and tearing down callback infrastructure.
+type InfraService interface {
+	// Providers returns the cloud providers servers can be provisioned with.
+	Providers() []string
+
+	// PublicKey returns the SSH key the TeamServer logs in to its servers with, in the
+	// authorized_keys format. The key is generated on first use.
+	PublicKey() (string, error)
+
+	// ListAssets retrieves the assets of the engagement, newest first.
+	ListAssets(ctx context.Context, page int, limit int) ([]data.InfraAsset, int64, error)
+
+	// GetAsset retrieves an asset by its ID.
+	GetAsset(ctx context.Context, assetID string) (*data.InfraAsset, error)
+
+	// Provision starts creating a server, and deploying a listener on it if requested, in the
+	// background. The asset is returned while it is still provisioning; its status changes are
+	// broadcast as INFRA_ASSET_UPDATED events.
+	Provision(ctx context.Context, req *ProvisionRequest, operator string) (*data.InfraAsset, error)
+
+	// Destroy starts destroying the server of an asset in the background. The listener deployed
+	// on it stays registered.
+	Destroy(ctx context.Context, assetID string) (*data.InfraAsset, error)
+
+	// DeployListener installs a listener on an existing host over SSH as a systemd service, with a
+	// newly issued certificate bundle, and waits until the listener's control channel comes up.
+	DeployListener(ctx context.Context, name string, target *DeployTarget, certConfig pki.CertConfig) (*ListenerDeployment, error)
+
+	// FailInterrupted marks the assets whose provisioning or destruction was interrupted by a
+	// restart as failed, so they can be destroyed. Call it once at startup, before any job runs.
+	// It returns how many were marked.
+	FailInterrupted() (int, error)
+}
+
+// infraService implements the InfraService interface.
+type infraService struct {
+	cfg             *config.TeamServerConfig
+	store           data.DataStore
+	listenerService ListenerService
+	pkiService      PKIService
+	broadcast       func(engagement string, data []byte)
+
+	keyOnce sync.Once
+	signer  ssh.Signer
+	keyErr  error
+
+	mu sync.Mutex // Serializes status changes started by requests
+}
+
+// NewInfraService creates a new instance of infraService. broadcast sends the INFRA_ASSET_UPDATED
+// events of status changes.
+func NewInfraService(cfg *config.TeamServerConfig, store data.DataStore, listenerService ListenerService, pkiService PKIService, broadcast func(engagement string, data []byte)) InfraService {
+	return &infraService{
+		cfg:             cfg,
+		store:           store,
+		listenerService: listenerService,
+		pkiService:      pkiService,
+		broadcast:       broadcast,
+	}
+}
+
+// Providers returns the configured cloud providers.
+func (s *infraService) Providers() []string {
+	return infra.ConfiguredProviders(&s.cfg.Infrastructure)
+}
+
+// sshSigner returns the SSH key of the TeamServer, loading or generating it on first use.
+func (s *infraService) sshSigner() (ssh.Signer, error) {
+	s.keyOnce.Do(func() {
+		s.signer, s.keyErr = infra.LoadOrCreateKey(s.cfg.Infrastructure.GetSSHKey())
+	})
+	return s.signer, s.keyErr
+}
+
+// PublicKey returns the public SSH key of the TeamServer.
+func (s *infraService) PublicKey() (string, error) {
+	signer, err := s.sshSigner()
+	if err != nil {
+		return "", err
+	}
+	return infra.AuthorizedKey(signer.PublicKey()), nil
+}
+
+// ListAssets retrieves the assets of the engagement.
+func (s *infraService) ListAssets(ctx context.Context, page int, limit int) ([]data.InfraAsset, int64, error) {
+	assets, total, err := s.store.GetInfraAssets(EngagementFromContext(ctx), page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list assets: %w", err)
+	}
+	return assets, total, nil
+}
+
+// GetAsset retrieves an asset, treating assets of other engagements as not found.
+func (s *infraService) GetAsset(ctx context.Context, assetID string) (*data.InfraAsset, error) {
+	asset, err := s.store.GetInfraAsset(assetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get asset: %w", err)
+	}
+	if !inEngagement(ctx, asset.Engagement) {
+		return nil, fmt.Errorf("failed to get asset: %w", gorm.ErrRecordNotFound)
+	}
+	return asset, nil
+}
+
+// Provision checks the request, records the asset and creates the server in the background.
+func (s *infraService) Provision(ctx context.Context, req *ProvisionRequest, operator string) (*data.InfraAsset, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("a server name is required")
+	}
+	provider, err := infra.NewProvider(ctx, req.Provider, &s.cfg.Infrastructure)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := s.sshSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	listenerName := ""
+	if req.Listener != nil {
+		if err := s.checkDeployable(""); err != nil {
+			return nil, err
+		}
+		if err := infra.CheckListenerName(req.Listener.Name); err != nil {
+			return nil, err
+		}
+		if _, err := s.listenerService.GetListener(ctx, req.Listener.Name); err != nil {
+			listenerType := req.Listener.Type
+			if listenerType == "" {
+				listenerType = "http"
+			}
+			if _, err := s.listenerService.CreateListener(ctx, req.Listener.Name, listenerType, req.Listener.Config); err != nil {
+				return nil, err
+			}
+		}
+		listenerName = req.Listener.Name
+	}
+
+	hostKey, err := infra.NewHostKey()
+	if err != nil {
+		return nil, err
+	}
+	userData, err := infra.CloudInit(hostKey, signer.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	spec := infra.ServerSpec{Name: req.Name, Region: req.Region, Size: req.Size, Image: req.Image, UserData: userData}.WithDefaults(provider.Defaults())
+
+	asset := &data.InfraAsset{
+		AssetID:    uuid.New().String(),
+		Name:       req.Name,
+		Provider:   provider.Name(),
+		Region:     spec.Region,
+		Size:       spec.Size,
+		Image:      spec.Image,
+		SSHUser:    provider.SSHUser(),
+		SSHHostKey: hostKey.PublicKey,
+		Listener:   listenerName,
+		Status:     AssetProvisioning,
+		CreatedBy:  operator,
+		Engagement: engagementForNew(ctx),
+	}
+	spec.Labels = map[string]string{"asset-id": asset.AssetID}
+	if err := s.store.CreateInfraAsset(asset); err != nil {
+		return nil, fmt.Errorf("failed to create asset: %w", err)
+	}
+
+	go s.provision(*asset, provider, spec, signer)
+	return asset, nil
+}
+
+// checkDeployable checks that the configuration has what deploying a listener needs.
+// teamServerHost overrides infrastructure.teamserver_host if set.
+func (s *infraService) checkDeployable(teamServerHost string) error {
+	cfg := &s.cfg.Infrastructure
+	if cfg.ListenerBinary == "" {
+		return fmt.Errorf("infrastructure.listener_binary is not configured")
+	}
+	if _, err := os.Stat(cfg.ListenerBinary); err != nil {
+		return fmt.Errorf("listener binary not found: %w", err)
+	}
+	if teamServerHost == "" && cfg.TeamServerHost == "" {
+		return fmt.Errorf("infrastructure.teamserver_host is not configured")
+	}
+	return nil
+}
+
+// provision creates a server, waits until it accepts SSH, and deploys the listener on it.
+func (s *infraService) provision(asset data.InfraAsset, provider infra.Provider, spec infra.ServerSpec, signer ssh.Signer) {
+	ctx, cancel := context.WithTimeout(WithEngagement(context.Background(), asset.Engagement), s.cfg.Infrastructure.GetProvisionTimeout())
+	defer cancel()
+
+	providerID, err := provider.Create(ctx, spec)
+	if err != nil {
+		s.fail(&asset, err)
+		return
+	}
+	asset.ProviderID = providerID
+	s.update(&asset)
+
+	server, err := waitRunning(ctx, provider, providerID)
+	if err != nil {
+		s.fail(&asset, err)
+		return
+	}
+	asset.PublicIP = server.PublicIP
+	s.update(&asset)
+
+	client, err := infra.WaitForSSH(ctx, asset.PublicIP, asset.SSHUser, []ssh.AuthMethod{ssh.PublicKeys(signer)}, asset.SSHHostKey)
+	if err != nil {
+		s.fail(&asset, err)
+		return
+	}
+	defer client.Close()
+
+	if asset.Listener != "" {
+		asset.Status = AssetDeploying
+		s.update(&asset)
+		deployCtx, cancel := context.WithTimeout(WithEngagement(context.Background(), asset.Engagement), deployTimeout)
+		defer cancel()
+		if _, err := s.deployListener(deployCtx, client, asset.Listener, ListenerCertConfig(asset.Listener), ""); err != nil {
+			s.fail(&asset, err)
+			return
+		}
+	}
+
+	asset.Status = AssetReady
+	asset.Error = ""
+	s.update(&asset)
+	logger.Infof("Provisioned %s server %s (%s) for engagement %s", asset.Provider, asset.Name, asset.PublicIP, asset.Engagement)
+}
+
+// waitRunning polls a new server until it runs and has a public IP.
+func waitRunning(ctx context.Context, provider infra.Provider, id string) (*infra.Server, error) {
+	for {
+		server, err := provider.Get(ctx, id)
+		if err == nil && server.Running && server.PublicIP != "" {
+			return server, nil
+		}
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				err = fmt.Errorf("server %s is not running", id)
+			}
+			return nil, fmt.Errorf("server did not start in time: %w", err)
+		case <-time.After(assetPollInterval):
+		}
+	}
+}
+
+// deployListener issues a bundle for a listener and installs it with the listener binary.
+// teamServerHost overrides infrastructure.teamserver_host if set.
+func (s *infraService) deployListener(ctx context.Context, client *infra.SSHClient, name string, certConfig pki.CertConfig, teamServerHost string) (*ListenerBundle, error) {
+	listener, err := s.listenerService.GetListener(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	binary, err := os.ReadFile(s.cfg.Infrastructure.ListenerBinary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read listener binary: %w", err)
+	}
+	if teamServerHost == "" {
+		teamServerHost = s.cfg.Infrastructure.TeamServerHost
+	}
+	bundle, err := NewListenerBundle(ctx, s.cfg, s.pkiService, s.listenerService, name, listener.Config, certConfig, teamServerHost)
+	if err != nil {
+		return nil, err
+	}
+	if err := infra.DeployListener(ctx, client, &infra.ListenerDeployment{Name: name, Binary: binary, Files: bundle.Files}); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// DeployListener logs in to the host, installs the listener and waits for its control channel.
+func (s *infraService) DeployListener(ctx context.Context, name string, target *DeployTarget, certConfig pki.CertConfig) (*ListenerDeployment, error) {
+	listener, err := s.listenerService.GetListener(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if listener.Type == ExternalListenerType {
+		return nil, fmt.Errorf("external listeners are not deployed, their implants use the external C2 API")
+	}
+	if err := infra.CheckListenerName(name); err != nil {
+		return nil, err
+	}
+	if err := s.checkDeployable(target.TeamServerHost); err != nil {
+		return nil, err
+	}
+	if target.Address == "" || target.HostKey == "" {
+		return nil, fmt.Errorf("the host address and host key are required")
+	}
+	user := target.User
+	if user == "" {
+		user = "root"
+	}
+	var auth []ssh.AuthMethod
+	if target.Password != "" {
+		auth = []ssh.AuthMethod{ssh.Password(target.Password)}
+	} else {
+		signer, err := s.sshSigner()
+		if err != nil {
+			return nil, err
+		}
+		auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	}
+
+	deployCtx, cancel := context.WithTimeout(ctx, deployTimeout)
+	defer cancel()
+	client, err := infra.DialSSH(deployCtx, target.Address, user, auth, target.HostKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeployFailed, err)
+	}
+	defer client.Close()
+
+	deployedAt := time.Now()
+	bundle, err := s.deployListener(deployCtx, client, name, certConfig, target.TeamServerHost)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeployFailed, err)
+	}
+	logger.Ctx(ctx).Infof("Deployed listener %s to %s, waiting for its control channel", name, target.Address)
+
+	waitCtx, cancel := context.WithTimeout(ctx, listenerConnectTimeout)
+	defer cancel()
+	if err := s.listenerService.WaitForConnection(waitCtx, name, deployedAt); err != nil {
+		logs, logErr := infra.ListenerLogs(ctx, client, name, listenerLogLines)
+		if logErr != nil {
+			logs = logErr.Error()
+		}
+		return nil, fmt.Errorf("%w: %w\n%s", ErrListenerNotConnected, err, logs)
+	}
+
+	listener, err = s.listenerService.GetListener(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &ListenerDeployment{
+		Listener:          listener,
+		Host:              target.Address,
+		Unit:              infra.ListenerUnitName(name),
+		CertificateSerial: bundle.CertificateSerial,
+	}, nil
+}
+
+// Destroy checks that the asset is idle and destroys its server in the background.
+func (s *infraService) Destroy(ctx context.Context, assetID string) (*data.InfraAsset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	asset, err := s.GetAsset(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if asset.Status == AssetDestroyed {
+		return asset, nil
+	}
+	if busy(asset) {
+		return nil, ErrAssetBusy
+	}
+
+	var provider infra.Provider
+	if asset.ProviderID != "" {
+		if provider, err = infra.NewProvider(ctx, asset.Provider, &s.cfg.Infrastructure); err != nil {
+			return nil, err
+		}
+	}
+	asset.Status = AssetDestroying
+	asset.Error = ""
+	s.update(asset)
+
+	go s.destroy(*asset, provider)
+	return asset, nil
+}
+
+// destroy deletes the server of an asset. Assets that failed before their server was created
+// have nothing to delete.
+func (s *infraService) destroy(asset data.InfraAsset, provider infra.Provider) {
+	if provider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), destroyTimeout)
+		defer cancel()
+		if err := provider.Delete(ctx, asset.ProviderID); err != nil {
+			s.fail(&asset, err)
+			return
+		}
+	}
+	now := time.Now()
+	asset.Status = AssetDestroyed
+	asset.DestroyedAt = &now
+	s.update(&asset)
+	logger.Infof("Destroyed %s server %s (%s) of engagement %s", asset.Provider, asset.Name, asset.PublicIP, asset.Engagement)
+}
+
+// busy reports whether the asset is being provisioned or destroyed.
+func busy(asset *data.InfraAsset) bool {
+	switch asset.Status {
+	case AssetProvisioning, AssetDeploying, AssetDestroying:
+		return true
+	}
+	return false
+}
+
+// FailInterrupted marks the assets of interrupted jobs as failed.
+func (s *infraService) FailInterrupted() (int, error) {
+	assets, err := s.store.GetInfraAssetsByStatus(AssetProvisioning, AssetDeploying, AssetDestroying)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get assets: %w", err)
+	}
+	for i := range assets {
+		s.fail(&assets[i], fmt.Errorf("%s was interrupted", assets[i].Status))
+	}
+	return len(assets), nil
+}
+
+// fail records why a job on an asset failed.
+func (s *infraService) fail(asset *data.InfraAsset, jobErr error) {
+	logger.Errorf("Infrastructure asset %s (%s) failed while %s: %v", asset.AssetID, asset.Name, asset.Status, jobErr)
+	asset.Status = AssetFailed
+	asset.Error = jobErr.Error()
+	s.update(asset)
+}
+
+// update saves an asset and broadcasts the change.
+func (s *infraService) update(asset *data.InfraAsset) {
+	if err := s.store.UpdateInfraAsset(asset); err != nil {
+		logger.Errorf("Failed to update infrastructure asset %s: %v", asset.AssetID, err)
+		return
+	}
+	event, err := json.Marshal(map[string]interface{}{"type": "INFRA_ASSET_UPDATED", "payload": asset})
+	if err != nil {
+		logger.Errorf("Error marshalling INFRA_ASSET_UPDATED event: %v", err)
+		return
+	}
+	if s.broadcast != nil {
+		s.broadcast(asset.Engagement, event)
+	}
+}
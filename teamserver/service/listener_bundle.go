@@ -0,0 +1,165 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/pki"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultListenerPort is the port a listener serves beacons on unless its configuration sets one.
+const defaultListenerPort = ":8888"
+
+// ListenerBundle is everything a listener needs to run: its configuration and mTLS certificates.
+type ListenerBundle struct {
+	Files             map[string][]byte // Path relative to the listener's working directory
+	CertificateSerial string
+}
+
+// ListenerCertConfig returns the default certificate configuration of a listener.
+func ListenerCertConfig(name string) pki.CertConfig {
+	return pki.CertConfig{CommonName: "SimpleC2 Listener - " + name}
+}
+
+// NewListenerBundle issues a client certificate for a listener, records it, gives the listener a
+// new API key of its own, and generates the listener's configuration. listenerConfig is the JSON configuration the listener was created
+// with; teamServerHost is the address the listener reaches the gRPC bridge at.
+func NewListenerBundle(ctx context.Context, cfg *config.TeamServerConfig, pkiService PKIService, listenerService ListenerService, name, listenerConfig string, certConfig pki.CertConfig, teamServerHost string) (*ListenerBundle, error) {
+	// 1. mTLS Client Cert, issued by the new CA while the CA is being rotated
+	issued, err := pkiService.IssueClientCertificate(certConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client certificate: %w", err)
+	}
+	parsedCert := issued.Certificate
+
+	// Record issued certificate
+	if err := listenerService.RecordIssuedCertificate(ctx, parsedCert.SerialNumber.String(), parsedCert.Subject.CommonName, name); err != nil {
+		return nil, fmt.Errorf("failed to record issued certificate: %w", err)
+	}
+
+	// 2. API key of this listener; bundles generated earlier stop working
+	apiKey, err := listenerService.RotateAPIKey(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Generate listener.yaml
+	if teamServerHost == "" {
+		teamServerHost = "localhost" // Users should probably update this manually or we detect TS public IP
+	}
+
+	listenerCfg := config.ListenerConfig{
+		TeamServer: struct {
+			Host string `yaml:"host"`
+			Port string `yaml:"port"`
+		}{
+			Host: teamServerHost,
+			Port: cfg.GRPC.Port,
+		},
+		Listener: struct {
+			Name string `yaml:"name"`
+			Port string `yaml:"port"`
+		}{
+			Name: name,
+			Port: ListenerPort(listenerConfig),
+		},
+		Auth: struct {
+			APIKey          string                  `yaml:"api_key,omitempty"`
+			EncryptedAPIKey *config.EncryptedAPIKey `yaml:"encrypted_api_key,omitempty"`
+		}{
+			APIKey: apiKey, // In production, encrypt this!
+		},
+		Certs: struct {
+			ClientCert string `yaml:"client_cert"`
+			ClientKey  string `yaml:"client_key"`
+			CACert     string `yaml:"ca_cert"`
+			PrivateKey string `yaml:"private_key"`
+		}{
+			ClientCert: "./certs/client.crt",
+			ClientKey:  "./certs/client.key",
+			CACert:     "./certs/ca.crt",
+			PrivateKey: "./certs/listener_rsa.key",
+		},
+	}
+
+	yamlData, err := yaml.Marshal(&listenerCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal listener config: %w", err)
+	}
+
+	return &ListenerBundle{
+		Files: map[string][]byte{
+			"listener.yaml":    yamlData,
+			"certs/client.crt": issued.CertPEM,
+			"certs/client.key": issued.KeyPEM,
+			"certs/ca.crt":     issued.TrustedCAs, // Both CAs during a rotation
+		},
+		CertificateSerial: parsedCert.SerialNumber.String(),
+	}, nil
+}
+
+// Zip packs the bundle into a ZIP archive.
+func (b *ListenerBundle) Zip() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buf)
+
+	names := make([]string, 0, len(b.Files))
+	for name := range b.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f, err := zipWriter.Create(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zip entry: %w", err)
+		}
+		if _, err := f.Write(b.Files[name]); err != nil {
+			return nil, fmt.Errorf("failed to write zip entry: %w", err)
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close zip: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ListenerPort returns the address a listener serves beacons on, from the "port" of its JSON
+// configuration, e.g. ":8080".
+func ListenerPort(listenerConfig string) string {
+	var configMap map[string]interface{}
+	if err := json.Unmarshal([]byte(listenerConfig), &configMap); err != nil {
+		return defaultListenerPort
+	}
+	portStr := defaultListenerPort
+	if p, ok := configMap["port"]; ok {
+		switch v := p.(type) {
+		case float64: // JSON numbers are float64 by default
+			if v != 0 {
+				portStr = fmt.Sprintf(":%d", int(v))
+			}
+		case string: // Could be ":8080" or "8080"
+			trimmed := strings.TrimSpace(v)
+			if trimmed == "0" || trimmed == ":0" || trimmed == "" {
+				portStr = defaultListenerPort
+			} else if !strings.HasPrefix(trimmed, ":") {
+				portStr = ":" + trimmed
+			} else {
+				portStr = trimmed
+			}
+		}
+	}
+	// Ensure portStr is never empty or just ":" after processing
+	if portStr == "" || portStr == ":" {
+		portStr = defaultListenerPort
+	}
+	return portStr
+}
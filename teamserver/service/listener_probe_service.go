@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+)
+
+// maxProbeHistory bounds the probe results returned at once.
+const maxProbeHistory = 1000
+
+// ErrInvalidProbe is returned for probe settings that can't be used.
+var ErrInvalidProbe = errors.New("invalid listener probe")
+
+// ListenerProbeHistory is the recent reachability of a listener from its external probes.
+type ListenerProbeHistory struct {
+	Listener string `json:"listener"`
+	URL      string `json:"url"`
+	// Result of the latest probe, nil if the listener wasn't probed in the period
+	Reachable *bool `json:"reachable"`
+	// Share of the probes in the period that reached the listener, from 0 to 1
+	Availability float64                    `json:"availability"`
+	Results      []data.ListenerProbeResult `json:"results"` // Newest first
+}
+
+// ListenerProbeService defines the interface for the external health probes of listeners. Besides
+// the control channel, they check that a listener can be reached the way beacons reach it.
+type ListenerProbeService interface {
+	// SetProbe sets the URL a listener is probed at and the HTTP status expected; an empty URL disables probing.
+	SetProbe(ctx context.Context, name string, probeURL string, expectStatus int) (*data.Listener, error)
+
+	// Probe probes a listener now and records the result.
+	Probe(ctx context.Context, name string) (*data.ListenerProbeResult, error)
+
+	// History returns the probe results of a listener since a point in time, newest first.
+	History(ctx context.Context, name string, since time.Time, limit int) (*ListenerProbeHistory, error)
+
+	// Start probes the listeners with a probe URL periodically in the background.
+	Start()
+}
+
+// listenerProbeService implements the ListenerProbeService interface.
+type listenerProbeService struct {
+	store     data.DataStore
+	config    config.ListenerProbeConfig
+	broadcast func(engagement string, data []byte)
+	client    *http.Client
+
+	mu        sync.Mutex
+	reachable map[string]bool // Latest result per listener, to broadcast changes
+}
+
+// NewListenerProbeService creates a new instance of listenerProbeService. broadcast sends
+// LISTENER_UNREACHABLE and LISTENER_REACHABLE when the result of a listener's probes changes.
+func NewListenerProbeService(store data.DataStore, cfg config.ListenerProbeConfig, broadcast func(engagement string, data []byte)) (ListenerProbeService, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listener_probes.proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return &listenerProbeService{
+		store:     store,
+		config:    cfg,
+		broadcast: broadcast,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.GetTimeout(),
+			// A redirect is an answer from the listener (or its redirector); it isn't followed
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		reachable: make(map[string]bool),
+	}, nil
+}
+
+// SetProbe validates and stores the probe settings of a listener.
+func (s *listenerProbeService) SetProbe(ctx context.Context, name string, probeURL string, expectStatus int) (*data.Listener, error) {
+	listener, err := getListener(ctx, s.store, name)
+	if err != nil {
+		return nil, fmt.Errorf("listener not found: %w", err)
+	}
+	if probeURL != "" {
+		if err := validateProbe(probeURL, expectStatus); err != nil {
+			return nil, err
+		}
+	} else {
+		expectStatus = 0
+	}
+
+	if err := s.store.SetListenerProbe(name, probeURL, expectStatus); err != nil {
+		return nil, fmt.Errorf("failed to update listener: %w", err)
+	}
+	s.mu.Lock()
+	delete(s.reachable, name)
+	s.mu.Unlock()
+	listener.ProbeURL, listener.ProbeExpectStatus = probeURL, expectStatus
+	return listener, nil
+}
+
+// validateProbe checks that a probe URL is "http(s)://host/..." or "tcp://host:port".
+func validateProbe(probeURL string, expectStatus int) error {
+	u, err := url.Parse(probeURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProbe, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return fmt.Errorf("%w: the URL has no host", ErrInvalidProbe)
+		}
+	case "tcp":
+		if _, port, err := net.SplitHostPort(u.Host); err != nil || port == "" {
+			return fmt.Errorf("%w: tcp probes need a host and port, e.g. tcp://203.0.113.10:53", ErrInvalidProbe)
+		}
+	default:
+		return fmt.Errorf("%w: the URL must start with http://, https:// or tcp://", ErrInvalidProbe)
+	}
+	if expectStatus != 0 && (expectStatus < 100 || expectStatus > 599) {
+		return fmt.Errorf("%w: expect_status must be an HTTP status code", ErrInvalidProbe)
+	}
+	return nil
+}
+
+// Probe probes a listener now and records the result.
+func (s *listenerProbeService) Probe(ctx context.Context, name string) (*data.ListenerProbeResult, error) {
+	listener, err := getListener(ctx, s.store, name)
+	if err != nil {
+		return nil, fmt.Errorf("listener not found: %w", err)
+	}
+	if listener.ProbeURL == "" {
+		return nil, fmt.Errorf("%w: listener %s has no probe URL", ErrInvalidProbe, name)
+	}
+	return s.probe(ctx, listener)
+}
+
+// History returns the probe results of a listener since a point in time, newest first.
+func (s *listenerProbeService) History(ctx context.Context, name string, since time.Time, limit int) (*ListenerProbeHistory, error) {
+	listener, err := getListener(ctx, s.store, name)
+	if err != nil {
+		return nil, fmt.Errorf("listener not found: %w", err)
+	}
+	if limit <= 0 || limit > maxProbeHistory {
+		limit = maxProbeHistory
+	}
+	results, err := s.store.GetListenerProbeResults(name, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get probe results: %w", err)
+	}
+
+	history := &ListenerProbeHistory{Listener: name, URL: listener.ProbeURL, Results: results}
+	if len(results) > 0 {
+		reachable := 0
+		for _, result := range results {
+			if result.Reachable {
+				reachable++
+			}
+		}
+		history.Reachable = &results[0].Reachable
+		history.Availability = float64(reachable) / float64(len(results))
+	}
+	return history, nil
+}
+
+// Start probes the listeners periodically and deletes results older than listener_probes.history_days.
+func (s *listenerProbeService) Start() {
+	go func() {
+		ticker := time.NewTicker(s.config.GetInterval())
+		defer ticker.Stop()
+
+		var pruned time.Time
+		for range ticker.C {
+			s.probeAll()
+			if time.Since(pruned) >= time.Hour {
+				cutoff := time.Now().AddDate(0, 0, -s.config.GetHistoryDays())
+				if _, err := s.store.DeleteListenerProbeResultsBefore(cutoff); err != nil {
+					logger.Errorf("Failed to delete old listener probe results: %v", err)
+				}
+				pruned = time.Now()
+			}
+		}
+	}()
+}
+
+// probeAll probes every listener with a probe URL concurrently.
+func (s *listenerProbeService) probeAll() {
+	listeners, err := s.store.GetProbedListeners()
+	if err != nil {
+		logger.Errorf("Failed to list probed listeners: %v", err)
+		return
+	}
+	var wg sync.WaitGroup
+	for i := range listeners {
+		wg.Add(1)
+		go func(listener *data.Listener) {
+			defer wg.Done()
+			if _, err := s.probe(context.Background(), listener); err != nil {
+				logger.Errorf("Failed to probe listener %s: %v", listener.Name, err)
+			}
+		}(&listeners[i])
+	}
+	wg.Wait()
+}
+
+// probe requests a listener's probe URL, records the result and broadcasts a change of its reachability.
+func (s *listenerProbeService) probe(ctx context.Context, listener *data.Listener) (*data.ListenerProbeResult, error) {
+	result := &data.ListenerProbeResult{Listener: listener.Name, URL: listener.ProbeURL, Engagement: listener.Engagement}
+	ctx, cancel := context.WithTimeout(ctx, s.config.GetTimeout())
+	defer cancel()
+
+	start := time.Now()
+	statusCode, err := s.request(ctx, listener.ProbeURL)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.StatusCode = statusCode
+	switch {
+	case err != nil:
+		result.Error = err.Error()
+	case listener.ProbeExpectStatus != 0 && statusCode != listener.ProbeExpectStatus:
+		result.Error = fmt.Sprintf("got HTTP status %d, expected %d", statusCode, listener.ProbeExpectStatus)
+	case listener.ProbeExpectStatus == 0 && statusCode >= 500:
+		result.Error = fmt.Sprintf("got HTTP status %d", statusCode)
+	default:
+		result.Reachable = true
+	}
+
+	if err := s.store.CreateListenerProbeResult(result); err != nil {
+		return nil, fmt.Errorf("failed to record probe result: %w", err)
+	}
+	s.notifyChange(result)
+	return result, nil
+}
+
+// request requests a probe URL and returns the HTTP status, or 0 for TCP probes.
+func (s *listenerProbeService) request(ctx context.Context, probeURL string) (int, error) {
+	u, err := url.Parse(probeURL)
+	if err != nil {
+		return 0, err
+	}
+	if u.Scheme == "tcp" {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return 0, err
+		}
+		return 0, conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// notifyChange broadcasts LISTENER_UNREACHABLE or LISTENER_REACHABLE when a probe result differs from
+// the previous one. The first result after a start is compared with the latest recorded one.
+func (s *listenerProbeService) notifyChange(result *data.ListenerProbeResult) {
+	s.mu.Lock()
+	previous, known := s.reachable[result.Listener]
+	s.reachable[result.Listener] = result.Reachable
+	s.mu.Unlock()
+	if !known {
+		// The result itself was recorded already, the one before it is the previous state
+		results, err := s.store.GetListenerProbeResults(result.Listener, time.Time{}, 2)
+		if err != nil || len(results) < 2 {
+			return
+		}
+		previous = results[1].Reachable
+	}
+	if previous == result.Reachable || s.broadcast == nil {
+		return
+	}
+
+	eventType := "LISTENER_REACHABLE"
+	if !result.Reachable {
+		eventType = "LISTENER_UNREACHABLE"
+		logger.Warnf("Listener %s is unreachable at %s: %s", result.Listener, result.URL, result.Error)
+	} else {
+		logger.Infof("Listener %s is reachable again at %s", result.Listener, result.URL)
+	}
+	event, err := json.Marshal(map[string]interface{}{"type": eventType, "payload": result})
+	if err != nil {
+		logger.Errorf("Error marshalling %s event: %v", eventType, err)
+		return
+	}
+	s.broadcast(result.Engagement, event)
+}
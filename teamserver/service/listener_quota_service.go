@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"simplec2/pkg/config"
+
+	"golang.org/x/time/rate"
+)
+
+// quotaAlertInterval is how often a listener going over its quota is alerted at most.
+const quotaAlertInterval = time.Minute
+
+// Quotas a listener can go over.
+const (
+	QuotaRequests  = "requests"
+	QuotaBandwidth = "bandwidth"
+)
+
+// ListenerBridgeUsage is the traffic of a listener on the gRPC bridge since the TeamServer started.
+type ListenerBridgeUsage struct {
+	Requests         int64 `json:"requests"`          // Calls and relayed requests
+	RejectedRequests int64 `json:"rejected_requests"` // Refused for going over the quota
+	Throttled        int64 `json:"throttled"`         // Stream messages delayed by the quota
+	BytesReceived    int64 `json:"bytes_received"`
+	BytesSent        int64 `json:"bytes_sent"`
+}
+
+// ListenerQuotaService enforces the request rate and bandwidth quotas of the listeners on the
+// gRPC bridge.
+type ListenerQuotaService interface {
+	// Allow takes requests and bytes received from the quota of a listener. It reports false,
+	// and takes nothing, if that would go over the quota.
+	Allow(listener string, requests, bytes int) bool
+
+	// Wait takes requests and bytes received from the quota of a listener, waiting until the
+	// quota allows it or ctx is done.
+	Wait(ctx context.Context, listener string, requests, bytes int) error
+
+	// WaitSend takes bytes sent to a listener from its bandwidth quota, waiting until the quota
+	// allows it or ctx is done.
+	WaitSend(ctx context.Context, listener string, bytes int) error
+
+	// Usage returns the traffic of a listener, or nil if it has not made any call.
+	Usage(listener string) *ListenerBridgeUsage
+}
+
+// listenerQuota holds the limiters and counters of one listener. A nil limiter is unlimited.
+type listenerQuota struct {
+	requests  *rate.Limiter
+	bandwidth *rate.Limiter
+
+	calls            atomic.Int64
+	rejectedRequests atomic.Int64
+	throttled        atomic.Int64
+	bytesReceived    atomic.Int64
+	bytesSent        atomic.Int64
+
+	mu        sync.Mutex
+	lastAlert map[string]time.Time // By quota
+}
+
+// listenerQuotaService implements the ListenerQuotaService interface.
+type listenerQuotaService struct {
+	cfg          config.ListenerQuotaConfig
+	auditService AuditService
+
+	mu     sync.Mutex
+	quotas map[string]*listenerQuota
+}
+
+// NewListenerQuotaService creates a new instance of listenerQuotaService.
+func NewListenerQuotaService(cfg config.ListenerQuotaConfig, auditService AuditService) ListenerQuotaService {
+	return &listenerQuotaService{
+		cfg:          cfg,
+		auditService: auditService,
+		quotas:       make(map[string]*listenerQuota),
+	}
+}
+
+// quota returns the quota of a listener, creating it on its first call.
+func (s *listenerQuotaService) quota(listener string) *listenerQuota {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.quotas[listener]; ok {
+		return q
+	}
+	cfg := s.cfg.GetQuota(listener)
+	q := &listenerQuota{lastAlert: make(map[string]time.Time)}
+	if cfg.RequestsPerSecond > 0 {
+		q.requests = rate.NewLimiter(rate.Limit(cfg.RequestsPerSecond), cfg.RequestBurst)
+	}
+	if cfg.BandwidthKBps > 0 {
+		q.bandwidth = rate.NewLimiter(rate.Limit(cfg.BandwidthKBps*1024), int(cfg.BandwidthBurstKB*1024))
+	}
+	s.quotas[listener] = q
+	return q
+}
+
+// Allow takes requests and bytes from the quota of a listener if both are available.
+func (s *listenerQuotaService) Allow(listener string, requests, bytes int) bool {
+	q := s.quota(listener)
+	q.calls.Add(int64(requests))
+	q.bytesReceived.Add(int64(bytes))
+
+	now := time.Now()
+	var reservation *rate.Reservation
+	if q.requests != nil && requests > 0 {
+		if reservation = q.requests.ReserveN(now, requests); !reservation.OK() || reservation.DelayFrom(now) > 0 {
+			reservation.CancelAt(now)
+			q.rejectedRequests.Add(int64(requests))
+			s.alert(listener, q, QuotaRequests, "refused")
+			return false
+		}
+	}
+	if q.bandwidth != nil && bytes > 0 && !q.bandwidth.AllowN(now, min(bytes, q.bandwidth.Burst())) {
+		// The request does not count against the request rate either
+		if reservation != nil {
+			reservation.CancelAt(now)
+		}
+		q.rejectedRequests.Add(int64(requests))
+		s.alert(listener, q, QuotaBandwidth, "refused")
+		return false
+	}
+	return true
+}
+
+// Wait takes requests and bytes from the quota of a listener, waiting for them.
+func (s *listenerQuotaService) Wait(ctx context.Context, listener string, requests, bytes int) error {
+	q := s.quota(listener)
+	q.calls.Add(int64(requests))
+	q.bytesReceived.Add(int64(bytes))
+
+	if requests > 0 {
+		if err := s.wait(ctx, listener, q, q.requests, QuotaRequests, requests); err != nil {
+			return err
+		}
+	}
+	if bytes > 0 {
+		return s.wait(ctx, listener, q, q.bandwidth, QuotaBandwidth, bytes)
+	}
+	return nil
+}
+
+// WaitSend takes bytes sent to a listener from its bandwidth quota, waiting for them.
+func (s *listenerQuotaService) WaitSend(ctx context.Context, listener string, bytes int) error {
+	q := s.quota(listener)
+	q.bytesSent.Add(int64(bytes))
+	if bytes <= 0 {
+		return nil
+	}
+	return s.wait(ctx, listener, q, q.bandwidth, QuotaBandwidth, bytes)
+}
+
+// wait takes n tokens of a limiter, waiting until they are available. More than the burst is
+// taken as the whole burst, so a large message is never refused outright.
+func (s *listenerQuotaService) wait(ctx context.Context, listener string, q *listenerQuota, limiter *rate.Limiter, quota string, n int) error {
+	if limiter == nil {
+		return nil
+	}
+	now := time.Now()
+	reservation := limiter.ReserveN(now, min(n, limiter.Burst()))
+	delay := reservation.DelayFrom(now)
+	if delay == 0 {
+		return nil
+	}
+	q.throttled.Add(1)
+	s.alert(listener, q, quota, "throttled")
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+		return ctx.Err()
+	}
+}
+
+// alert reports a listener going over a quota, at most once per quotaAlertInterval.
+func (s *listenerQuotaService) alert(listener string, q *listenerQuota, quota, action string) {
+	q.mu.Lock()
+	if time.Since(q.lastAlert[quota]) < quotaAlertInterval {
+		q.mu.Unlock()
+		return
+	}
+	q.lastAlert[quota] = time.Now()
+	q.mu.Unlock()
+
+	s.auditService.Alert(&SecurityAlert{
+		Name:     "listener_quota_exceeded",
+		Severity: 6,
+		Message:  fmt.Sprintf("listener %s went over its %s quota on the gRPC bridge, traffic is %s", listener, quota, action),
+		Fields: map[string]string{
+			"listener":          listener,
+			"quota":             quota,
+			"action":            action,
+			"requests":          strconv.FormatInt(q.calls.Load(), 10),
+			"rejected_requests": strconv.FormatInt(q.rejectedRequests.Load(), 10),
+		},
+	})
+}
+
+// Usage returns the traffic counters of a listener.
+func (s *listenerQuotaService) Usage(listener string) *ListenerBridgeUsage {
+	s.mu.Lock()
+	q, ok := s.quotas[listener]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return &ListenerBridgeUsage{
+		Requests:         q.calls.Load(),
+		RejectedRequests: q.rejectedRequests.Load(),
+		Throttled:        q.throttled.Load(),
+		BytesReceived:    q.bytesReceived.Load(),
+		BytesSent:        q.bytesSent.Load(),
+	}
+}
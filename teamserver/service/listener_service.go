@@ -2,8 +2,13 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 
 	"simplec2/pkg/bridge"
 	"simplec2/teamserver/data"
@@ -19,6 +24,10 @@ type ListenerService interface {
 	// CreateListener creates a new listener configuration.
 	CreateListener(ctx context.Context, name string, listenerType string, config string) (*data.Listener, error)
 
+	// UpdateListenerConfig merges the configuration a listener reports into the stored one, keeping
+	// the keys it doesn't report.
+	UpdateListenerConfig(ctx context.Context, name string, config string) error
+
 	// DeleteListener deletes a listener configuration.
 	DeleteListener(ctx context.Context, name string) error
 
@@ -31,6 +40,12 @@ type ListenerService interface {
 	// UnregisterConnection removes a gRPC control stream.
 	UnregisterConnection(name string)
 
+	// UpdateStatus records the status a connected listener reported.
+	UpdateStatus(name string, status *bridge.ListenerStatus)
+
+	// WaitForConnection waits until a listener opens its control channel after since, or ctx is done.
+	WaitForConnection(ctx context.Context, name string, since time.Time) error
+
 	// StartListener sends a start command to the listener.
 	StartListener(ctx context.Context, name string) error
 
@@ -40,6 +55,12 @@ type ListenerService interface {
 	// RestartListener sends a restart command to the listener.
 	RestartListener(ctx context.Context, name string) error
 
+	// WipeSessions tells the listener to drop the session keys of all its beacons.
+	WipeSessions(ctx context.Context, name string) error
+
+	// SendCommand sends a command to a connected listener on its control channel.
+	SendCommand(name string, cmd *bridge.ListenerCommand) error
+
 	// RecordIssuedCertificate saves a new certificate record.
 	RecordIssuedCertificate(ctx context.Context, serialNumber, commonName, listenerName string) error
 
@@ -48,13 +69,23 @@ type ListenerService interface {
 
 	// IsCertificateRevoked checks if a serial number is revoked.
 	IsCertificateRevoked(serialNumber string) bool
+
+	// RotateAPIKey gives a listener a new API key of its own, replacing the previous one, and returns it.
+	RotateAPIKey(ctx context.Context, name string) (string, error)
+
+	// CheckAPIKey reports whether apiKey is the listener's own API key. hasOwnKey is false for
+	// listeners without one, which authenticate with the shared auth.api_key.
+	CheckAPIKey(name string, apiKey string) (valid bool, hasOwnKey bool)
 }
 
 // listenerService implements the ListenerService interface.
 type listenerService struct {
 	store       data.DataStore
 	connections map[string]bridge.TeamServerBridgeService_ListenerControlServer
+	statuses    map[string]*data.ListenerStatus // Last reported status of the connected listeners
+	connectedAt map[string]time.Time            // When the connected listeners opened their control channel
 	mu          sync.RWMutex
+	sendMu      sync.Mutex // Serializes sends, a stream's Send isn't safe for concurrent use
 }
 
 // NewListenerService creates a new instance of listenerService.
@@ -62,6 +93,8 @@ func NewListenerService(store data.DataStore) ListenerService {
 	return &listenerService{
 		store:       store,
 		connections: make(map[string]bridge.TeamServerBridgeService_ListenerControlServer),
+		statuses:    make(map[string]*data.ListenerStatus),
+		connectedAt: make(map[string]time.Time),
 	}
 }
 
@@ -86,6 +119,32 @@ func (s *listenerService) RevokeCertificateForListener(ctx context.Context, list
 	return s.store.RevokeCertificatesByListener(listenerName)
 }
 
+// RotateAPIKey gives a listener a new random API key of its own and stores its hash. The previous
+// key, or the shared auth.api_key, no longer authenticates the listener's calls.
+func (s *listenerService) RotateAPIKey(ctx context.Context, name string) (string, error) {
+	if _, err := getListener(ctx, s.store, name); err != nil {
+		return "", fmt.Errorf("listener not found: %w", err)
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	apiKey := hex.EncodeToString(b)
+	if err := s.store.SetListenerAPIKeyHash(name, hashToken(apiKey)); err != nil {
+		return "", fmt.Errorf("failed to store api key: %w", err)
+	}
+	return apiKey, nil
+}
+
+// CheckAPIKey reports whether apiKey is the listener's own API key, if it has one.
+func (s *listenerService) CheckAPIKey(name string, apiKey string) (bool, bool) {
+	listener, err := s.store.GetListener(name)
+	if err != nil || listener.APIKeyHash == "" {
+		return false, false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashToken(apiKey)), []byte(listener.APIKeyHash)) == 1, true
+}
+
 // IsCertificateRevoked checks if a serial number is revoked.
 func (s *listenerService) IsCertificateRevoked(serialNumber string) bool {
 	revoked, err := s.store.IsCertificateRevoked(serialNumber)
@@ -103,6 +162,7 @@ func (s *listenerService) RegisterConnection(name string, stream bridge.TeamServ
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.connections[name] = stream
+	s.connectedAt[name] = time.Now()
 }
 
 // UnregisterConnection removes a gRPC control stream.
@@ -110,24 +170,88 @@ func (s *listenerService) UnregisterConnection(name string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.connections, name)
+	delete(s.statuses, name)
+	delete(s.connectedAt, name)
+}
+
+// UpdateStatus records the status a connected listener reported.
+func (s *listenerService) UpdateStatus(name string, status *bridge.ListenerStatus) {
+	recorded := &data.ListenerStatus{
+		Serving:      status.Active,
+		Error:        status.ErrorMessage,
+		Connectivity: status.Connectivity,
+		Reconnects:   status.Reconnects,
+		ReportedAt:   time.Now(),
+	}
+	if status.LastDisconnect != nil {
+		lastDisconnect := status.LastDisconnect.AsTime()
+		recorded.LastDisconnect = &lastDisconnect
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.connections[name]; ok {
+		s.statuses[name] = recorded
+	}
+}
+
+// WaitForConnection polls until the listener's control channel was opened after since.
+func (s *listenerService) WaitForConnection(ctx context.Context, name string, since time.Time) error {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.mu.RLock()
+		connectedAt, ok := s.connectedAt[name]
+		s.mu.RUnlock()
+		if ok && !connectedAt.Before(since) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("listener '%s' did not connect: %w", name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
 }
 
 // StartListener sends a start command to the listener.
 func (s *listenerService) StartListener(ctx context.Context, name string) error {
+	if _, err := getListener(ctx, s.store, name); err != nil {
+		return fmt.Errorf("listener not found: %w", err)
+	}
 	return s.sendCommand(name, bridge.ListenerCommand_START, "")
 }
 
 // StopListener sends a stop command to the listener.
 func (s *listenerService) StopListener(ctx context.Context, name string) error {
+	if _, err := getListener(ctx, s.store, name); err != nil {
+		return fmt.Errorf("listener not found: %w", err)
+	}
 	return s.sendCommand(name, bridge.ListenerCommand_STOP, "")
 }
 
 // RestartListener sends a restart command to the listener.
 func (s *listenerService) RestartListener(ctx context.Context, name string) error {
+	if _, err := getListener(ctx, s.store, name); err != nil {
+		return fmt.Errorf("listener not found: %w", err)
+	}
 	return s.sendCommand(name, bridge.ListenerCommand_RESTART, "")
 }
 
+// WipeSessions tells the listener to drop the session keys of all its beacons.
+func (s *listenerService) WipeSessions(ctx context.Context, name string) error {
+	if _, err := getListener(ctx, s.store, name); err != nil {
+		return fmt.Errorf("listener not found: %w", err)
+	}
+	return s.sendCommand(name, bridge.ListenerCommand_WIPE_SESSIONS, "")
+}
+
 func (s *listenerService) sendCommand(name string, action bridge.ListenerCommand_Action, configJSON string) error {
+	return s.SendCommand(name, &bridge.ListenerCommand{Action: action, ConfigJson: configJSON})
+}
+
+// SendCommand sends a command to a connected listener, giving it a request ID if it has none.
+func (s *listenerService) SendCommand(name string, cmd *bridge.ListenerCommand) error {
 	s.mu.RLock()
 	stream, ok := s.connections[name]
 	s.mu.RUnlock()
@@ -136,13 +260,14 @@ func (s *listenerService) sendCommand(name string, action bridge.ListenerCommand
 		return fmt.Errorf("listener '%s' is not connected", name)
 	}
 
-	cmd := &bridge.ListenerCommand{
-		RequestId:  uuid.New().String(),
-		Action:     action,
-		ConfigJson: configJSON,
+	if cmd.RequestId == "" {
+		cmd.RequestId = uuid.New().String()
 	}
 
-	if err := stream.Send(cmd); err != nil {
+	s.sendMu.Lock()
+	err := stream.Send(cmd)
+	s.sendMu.Unlock()
+	if err != nil {
 		// If sending fails, assume connection is dead and unregister
 		s.UnregisterConnection(name)
 		return fmt.Errorf("failed to send command to listener '%s': %w", name, err)
@@ -153,7 +278,7 @@ func (s *listenerService) sendCommand(name string, action bridge.ListenerCommand
 
 // GetListener retrieves a listener by its name.
 func (s *listenerService) GetListener(ctx context.Context, name string) (*data.Listener, error) {
-	listener, err := s.store.GetListener(name)
+	listener, err := getListener(ctx, s.store, name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get listener: %w", err)
 	}
@@ -164,6 +289,7 @@ func (s *listenerService) GetListener(ctx context.Context, name string) (*data.L
 	} else {
 		listener.Active = false
 	}
+	listener.Status = s.statuses[listener.Name]
 	s.mu.RUnlock()
 
 	return listener, nil
@@ -177,9 +303,10 @@ func (s *listenerService) CreateListener(ctx context.Context, name string, liste
 	}
 
 	listener := &data.Listener{
-		Name:   name,
-		Type:   listenerType,
-		Config: config,
+		Name:       name,
+		Type:       listenerType,
+		Config:     config,
+		Engagement: engagementForNew(ctx),
 	}
 
 	if err := s.store.CreateListener(listener); err != nil {
@@ -189,10 +316,48 @@ func (s *listenerService) CreateListener(ctx context.Context, name string, liste
 	return listener, nil
 }
 
+// UpdateListenerConfig merges the configuration a listener reports into the stored one. Only the keys
+// it reports (port, public key, ...) are overwritten; settings made on the TeamServer side, such as
+// callback_url, are kept.
+func (s *listenerService) UpdateListenerConfig(ctx context.Context, name string, config string) error {
+	listener, err := getListener(ctx, s.store, name)
+	if err != nil {
+		return fmt.Errorf("listener not found: %w", err)
+	}
+
+	var reported map[string]interface{}
+	if err := json.Unmarshal([]byte(config), &reported); err != nil {
+		return fmt.Errorf("invalid listener config: %w", err)
+	}
+	// A stored config that isn't a JSON object has nothing worth keeping
+	merged := map[string]interface{}{}
+	if listener.Config != "" {
+		if err := json.Unmarshal([]byte(listener.Config), &merged); err != nil || merged == nil {
+			merged = map[string]interface{}{}
+		}
+	}
+	for key, value := range reported {
+		merged[key] = value
+	}
+	mergedJSON, err := json.Marshal(merged)
+	if err != nil {
+		return fmt.Errorf("failed to encode listener config: %w", err)
+	}
+	if listener.Config == string(mergedJSON) {
+		return nil
+	}
+
+	listener.Config = string(mergedJSON)
+	if err := s.store.UpdateListener(listener); err != nil {
+		return fmt.Errorf("failed to update listener: %w", err)
+	}
+	return nil
+}
+
 // DeleteListener deletes a listener configuration.
 func (s *listenerService) DeleteListener(ctx context.Context, name string) error {
 	// First, ensure listener exists
-	if _, err := s.store.GetListener(name); err != nil {
+	if _, err := getListener(ctx, s.store, name); err != nil {
 		return fmt.Errorf("listener not found: %w", err)
 	}
 
@@ -220,7 +385,7 @@ func (s *listenerService) DeleteListener(ctx context.Context, name string) error
 
 // ListListeners retrieves all listeners.
 func (s *listenerService) ListListeners(ctx context.Context, page int, limit int) ([]data.Listener, int64, error) {
-	listeners, total, err := s.store.GetListeners(page, limit)
+	listeners, total, err := s.store.GetListeners(EngagementFromContext(ctx), page, limit)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to list listeners: %w", err)
 	}
@@ -234,6 +399,7 @@ func (s *listenerService) ListListeners(ctx context.Context, page int, limit int
 		} else {
 			listeners[i].Active = false
 		}
+		listeners[i].Status = s.statuses[listeners[i].Name]
 	}
 
 	return listeners, total, nil
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"simplec2/teamserver/data"
+
+	"gorm.io/gorm"
+)
+
+// TestIssuedCertificateCache tests that certificate lookups are served from the cache, and that
+// issuing and revoking certificates through the store takes effect right away.
+func TestIssuedCertificateCache(t *testing.T) {
+	store := newTestStore(t)
+	listeners := NewListenerService(store)
+	ctx := context.Background()
+
+	// A serial number without a record is cached as such, until a record is created for it
+	if _, err := store.GetIssuedCertificate("1001"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected ErrRecordNotFound, got %v", err)
+	}
+	if err := listeners.RecordIssuedCertificate(ctx, "1001", "listener-a", "listener-a"); err != nil {
+		t.Fatalf("RecordIssuedCertificate: %v", err)
+	}
+	cert, err := store.GetIssuedCertificate("1001")
+	if err != nil || cert.ListenerName != "listener-a" {
+		t.Fatalf("new certificate record not visible: %+v, %v", cert, err)
+	}
+
+	// Writes that bypass the store are only seen once the entry expires
+	db := store.(*data.GormStore).DB
+	if err := db.Model(&data.IssuedCertificate{}).Where("serial_number = ?", "1001").Update("listener_name", "listener-b").Error; err != nil {
+		t.Fatalf("failed to update the record: %v", err)
+	}
+	if cert, err := store.GetIssuedCertificate("1001"); err != nil || cert.ListenerName != "listener-a" {
+		t.Fatalf("lookup not served from the cache: %+v, %v", cert, err)
+	}
+
+	// Revocations through the store evict the cached records
+	if err := listeners.RevokeCertificateForListener(ctx, "listener-b"); err != nil {
+		t.Fatalf("RevokeCertificateForListener: %v", err)
+	}
+	cert, err = store.GetIssuedCertificate("1001")
+	if err != nil || !cert.Revoked || cert.ListenerName != "listener-b" {
+		t.Fatalf("revocation not visible: %+v, %v", cert, err)
+	}
+}
+
+// TestOperatorCertificateRevocation tests that a revoked operator certificate stops authenticating
+// although its record was cached.
+func TestOperatorCertificateRevocation(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.CreateOperator(&data.Operator{Username: "alice", PasswordHash: "x", Role: "operator", Provider: "local"}); err != nil {
+		t.Fatalf("CreateOperator: %v", err)
+	}
+	operators := NewOperatorService(store, nil, nil)
+	ctx := context.Background()
+
+	if err := operators.RecordCertificate(ctx, "alice", "2001", "alice"); err != nil {
+		t.Fatalf("RecordCertificate: %v", err)
+	}
+	if _, err := operators.AuthenticateCertificate(ctx, "2001", "alice"); err != nil {
+		t.Fatalf("AuthenticateCertificate: %v", err)
+	}
+	if !operators.IsOperatorCertificate("2001") {
+		t.Fatalf("operator certificate not recognized")
+	}
+
+	if err := operators.RevokeCertificates(ctx, "alice"); err != nil {
+		t.Fatalf("RevokeCertificates: %v", err)
+	}
+	if _, err := operators.AuthenticateCertificate(ctx, "2001", "alice"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected the revoked certificate to be refused, got %v", err)
+	}
+}
+
+// TestUpdateListenerConfigKeepsSettings tests that the config a listener reports on connect overwrites
+// only its own keys and keeps the ones set on the TeamServer.
+func TestUpdateListenerConfigKeepsSettings(t *testing.T) {
+	store := newTestStore(t)
+	listeners := NewListenerService(store)
+	ctx := context.Background()
+
+	if _, err := listeners.CreateListener(ctx, "http-1", "HTTP", `{"port":8080,"callback_url":"https://c2.example.com"}`); err != nil {
+		t.Fatalf("CreateListener: %v", err)
+	}
+	if err := listeners.UpdateListenerConfig(ctx, "http-1", `{"port":8443,"public_key":"KEY"}`); err != nil {
+		t.Fatalf("UpdateListenerConfig: %v", err)
+	}
+	listener, err := store.GetListener("http-1")
+	if err != nil {
+		t.Fatalf("GetListener: %v", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(listener.Config), &config); err != nil {
+		t.Fatalf("stored config is not JSON: %v", err)
+	}
+	if config["callback_url"] != "https://c2.example.com" || config["port"] != float64(8443) || config["public_key"] != "KEY" {
+		t.Fatalf("unexpected merged config: %s", listener.Config)
+	}
+
+	if err := listeners.UpdateListenerConfig(ctx, "http-1", "not json"); err == nil {
+		t.Fatalf("invalid reported config accepted")
+	}
+}
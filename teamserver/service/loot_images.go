@@ -0,0 +1,146 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	// Register the decoders image.Decode needs for screenshots
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Thumbnails fit within this box, keeping the aspect ratio
+const (
+	thumbnailWidth   = 320
+	thumbnailHeight  = 240
+	thumbnailQuality = 75
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks are the ancillary PNG chunks carrying metadata rather than pixels.
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripImageMetadata removes EXIF, text and timestamp metadata from a PNG or JPEG image
+// without re-encoding it. Anything else, including images it cannot parse, is returned unchanged.
+func stripImageMetadata(content []byte) []byte {
+	switch {
+	case bytes.HasPrefix(content, pngSignature):
+		if stripped, err := stripPNGMetadata(content); err == nil {
+			return stripped
+		}
+	case bytes.HasPrefix(content, []byte{0xFF, 0xD8}):
+		if stripped, err := stripJPEGMetadata(content); err == nil {
+			return stripped
+		}
+	}
+	return content
+}
+
+// stripPNGMetadata copies every chunk of a PNG image except the metadata chunks.
+func stripPNGMetadata(content []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(content)))
+	out.Write(pngSignature)
+
+	for offset := len(pngSignature); offset < len(content); {
+		if len(content)-offset < 12 {
+			return nil, fmt.Errorf("truncated PNG chunk at offset %d", offset)
+		}
+		length := int(binary.BigEndian.Uint32(content[offset:]))
+		end := offset + 12 + length
+		if end > len(content) {
+			return nil, fmt.Errorf("truncated PNG chunk at offset %d", offset)
+		}
+		chunkType := string(content[offset+4 : offset+8])
+		if !pngMetadataChunks[chunkType] {
+			out.Write(content[offset:end])
+		}
+		offset = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// stripJPEGMetadata copies a JPEG image without its APP1 (EXIF, XMP), APP13 (IPTC) and comment segments.
+// JFIF (APP0), ICC profiles (APP2) and Adobe (APP14) segments are kept, as they affect how the image renders.
+func stripJPEGMetadata(content []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(content)))
+	out.Write(content[:2])
+
+	for offset := 2; offset < len(content); {
+		if len(content)-offset < 4 || content[offset] != 0xFF {
+			return nil, fmt.Errorf("invalid JPEG segment at offset %d", offset)
+		}
+		marker := content[offset+1]
+		// Start of scan: the entropy-coded image data and everything after it is copied as is
+		if marker == 0xDA {
+			out.Write(content[offset:])
+			break
+		}
+		length := int(binary.BigEndian.Uint16(content[offset+2:]))
+		end := offset + 2 + length
+		if length < 2 || end > len(content) {
+			return nil, fmt.Errorf("truncated JPEG segment at offset %d", offset)
+		}
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out.Write(content[offset:end])
+		}
+		offset = end
+	}
+	return out.Bytes(), nil
+}
+
+// makeThumbnail decodes an image and returns a JPEG thumbnail of it, scaled down to fit the thumbnail box.
+func makeThumbnail(content []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("failed to decode image: empty image")
+	}
+	scale := min(float64(thumbnailWidth)/float64(width), float64(thumbnailHeight)/float64(height), 1)
+	dstWidth, dstHeight := max(int(float64(width)*scale), 1), max(int(float64(height)*scale), 1)
+
+	// Box filter: every thumbnail pixel is the average of the source pixels it covers
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*height/dstHeight
+		y1 := max(bounds.Min.Y+(y+1)*height/dstHeight, y0+1)
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*width/dstWidth
+			x1 := max(bounds.Min.X+(x+1)*width/dstWidth, x0+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: uint8(a / n >> 8)})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,518 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/filecrypt"
+	"simplec2/teamserver/lootmirror"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LootService defines the interface for files collected from beacons.
+type LootService interface {
+	// SaveLoot writes a file collected by a task to the loot directory and records it.
+	// Content that is already stored is not written again. Returns ErrLootQuotaExceeded
+	// if the file would take the engagement over its storage quota.
+	SaveLoot(task *data.Task, lootType, fileName string, content []byte) (*data.LootItem, error)
+
+	// ListLoot retrieves loot items matching the query.
+	ListLoot(ctx context.Context, query *data.LootQuery) ([]data.LootItem, int64, error)
+
+	// GetLoot retrieves a loot item by its ID.
+	GetLoot(ctx context.Context, lootID string) (*data.LootItem, error)
+
+	// OpenLoot returns a loot item and its file, decrypted as it is read. The caller closes the file.
+	OpenLoot(ctx context.Context, lootID string) (*data.LootItem, *filecrypt.File, error)
+
+	// UpdateLoot replaces the tags and/or notes of a loot item. Nil values are left unchanged.
+	UpdateLoot(ctx context.Context, lootID string, tags []string, notes *string) (*data.LootItem, error)
+
+	// DeleteLoot removes a loot item and its file.
+	DeleteLoot(ctx context.Context, lootID string) error
+
+	// ListScreenshots returns a page of a beacon's screenshots, newest first, with thumbnails.
+	ListScreenshots(ctx context.Context, beaconID string, page, limit int) ([]Screenshot, int64, error)
+
+	// Usage returns the loot storage used per engagement, with its quota.
+	Usage(ctx context.Context) ([]data.LootUsage, error)
+
+	// Cleanup deletes the loot items matching the query, returning how many were deleted and
+	// the bytes of stored content freed. With dryRun set, nothing is deleted.
+	Cleanup(ctx context.Context, query *data.LootQuery, dryRun bool) (int, int64, error)
+
+	// ImportLootDir records files in the loot directory that predate the loot table,
+	// pointing their task's output at the new loot ID. Returns the number of files recorded.
+	ImportLootDir() (int, error)
+}
+
+// Directories under the loot directory holding content and screenshot thumbnails by hash
+const (
+	lootObjectsDir    = "objects"
+	lootThumbnailsDir = "thumbnails"
+)
+
+// Screenshot is a screenshot loot item as shown in a beacon's gallery.
+type Screenshot struct {
+	LootID     string    `json:"loot_id"`
+	BeaconID   string    `json:"beacon_id"`
+	TaskID     string    `json:"task_id"`
+	Hostname   string    `json:"hostname"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	Tags       []string  `json:"tags"`
+	Notes      string    `json:"notes"`
+	CapturedAt time.Time `json:"captured_at"`
+	// JPEG data URL; empty if the screenshot could not be decoded
+	Thumbnail string `json:"thumbnail"`
+}
+
+// ErrLootQuotaExceeded is returned when new loot would take an engagement over its storage quota.
+var ErrLootQuotaExceeded = errors.New("loot storage quota exceeded")
+
+// lootService implements the LootService interface.
+type lootService struct {
+	store   data.DataStore
+	lootDir string
+	config  config.LootConfig
+	mirror  *lootmirror.Mirror
+	mu      sync.Mutex // Serializes writes, so quota checks and reference counts see each other
+}
+
+// NewLootService creates a new instance of lootService storing files under lootDir.
+// mirror may be nil if no loot mirror is configured.
+func NewLootService(store data.DataStore, lootDir string, cfg config.LootConfig, mirror *lootmirror.Mirror) LootService {
+	return &lootService{store: store, lootDir: lootDir, config: cfg, mirror: mirror}
+}
+
+// SaveLoot writes a file collected by a task to the loot directory and records it.
+// Content is stored once under its hash (<loot dir>/objects/<sha256[:2]>/<sha256>) and shared
+// by every loot item with the same content; the file goes once the last of them is deleted.
+func (s *lootService) SaveLoot(task *data.Task, lootType, fileName string, content []byte) (*data.LootItem, error) {
+	fileName = filepath.Base(filepath.Clean("/" + strings.ReplaceAll(fileName, `\`, "/")))
+	if fileName == "/" || fileName == "." {
+		fileName = "loot.bin"
+	}
+	item := &data.LootItem{
+		LootID:       uuid.New().String(),
+		Type:         lootType,
+		BeaconID:     task.BeaconID,
+		TaskID:       task.TaskID,
+		OriginalPath: task.Arguments,
+		FileName:     fileName,
+		Engagement:   task.Engagement,
+	}
+	if lootType == "screenshot" {
+		content = stripImageMetadata(content)
+	}
+	describeLoot(item, content)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkQuota(item); err != nil {
+		return nil, err
+	}
+	if existing, err := s.store.GetLootItemBySHA256(item.SHA256); err == nil {
+		if _, err := os.Stat(filepath.Join(s.lootDir, existing.Path)); err == nil {
+			item.Path = existing.Path
+			item.MirroredAt = existing.MirroredAt
+		}
+	}
+	if item.Path == "" {
+		item.Path = filepath.Join(lootObjectsDir, item.SHA256[:2], item.SHA256)
+		path := filepath.Join(s.lootDir, item.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create loot directory: %w", err)
+		}
+		if err := filecrypt.WriteFile(path, content, 0644); err != nil {
+			return nil, fmt.Errorf("failed to save loot file: %w", err)
+		}
+	}
+
+	if beacon, err := s.store.GetBeacon(task.BeaconID); err == nil {
+		item.Hostname = beacon.Hostname
+	}
+	if err := s.store.CreateLootItem(item); err != nil {
+		return nil, fmt.Errorf("failed to create loot item: %w", err)
+	}
+	if s.mirror != nil && item.MirroredAt == nil {
+		s.mirror.Notify()
+	}
+	return item, nil
+}
+
+// checkQuota returns ErrLootQuotaExceeded if storing the item would take its engagement over quota.
+// Content the engagement already has is free.
+func (s *lootService) checkQuota(item *data.LootItem) error {
+	quota := s.config.GetQuota(item.Engagement)
+	if quota == 0 {
+		return nil
+	}
+	if duplicates, _, err := s.store.GetLootItems(&data.LootQuery{Page: 1, Limit: 1, Engagement: item.Engagement, SHA256: item.SHA256}); err == nil && len(duplicates) > 0 {
+		return nil
+	}
+	usage, err := s.store.GetLootUsage(item.Engagement)
+	if err != nil {
+		return fmt.Errorf("failed to get loot usage: %w", err)
+	}
+	used := int64(0)
+	if len(usage) > 0 {
+		used = usage[0].UniqueBytes
+	}
+	if used+item.Size > quota {
+		return fmt.Errorf("%w: engagement '%s' uses %d of %d bytes, %s needs %d more", ErrLootQuotaExceeded, item.Engagement, used, quota, item.FileName, item.Size)
+	}
+	return nil
+}
+
+// describeLoot fills in the size, hash and MIME type of a loot item from its content.
+func describeLoot(item *data.LootItem, content []byte) {
+	sum := sha256.Sum256(content)
+	item.Size = int64(len(content))
+	item.SHA256 = hex.EncodeToString(sum[:])
+	item.MimeType = http.DetectContentType(content)
+}
+
+// ListLoot retrieves loot items matching the query.
+func (s *lootService) ListLoot(ctx context.Context, query *data.LootQuery) ([]data.LootItem, int64, error) {
+	query.Engagement = EngagementFromContext(ctx)
+	items, total, err := s.store.GetLootItems(query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list loot: %w", err)
+	}
+	return items, total, nil
+}
+
+// GetLoot retrieves a loot item by its ID.
+func (s *lootService) GetLoot(ctx context.Context, lootID string) (*data.LootItem, error) {
+	item, err := s.store.GetLootItem(lootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get loot item: %w", err)
+	}
+	if !inEngagement(ctx, item.Engagement) {
+		return nil, fmt.Errorf("failed to get loot item: %w", gorm.ErrRecordNotFound)
+	}
+	return item, nil
+}
+
+// lootFile returns a loot item and the absolute path of its file.
+func (s *lootService) lootFile(ctx context.Context, lootID string) (*data.LootItem, string, error) {
+	item, err := s.GetLoot(ctx, lootID)
+	if err != nil {
+		return nil, "", err
+	}
+	lootDir, err := filepath.Abs(s.lootDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve loot directory: %w", err)
+	}
+	path := filepath.Join(lootDir, item.Path)
+	// Paths are generated by SaveLoot, this only guards against a tampered database
+	if !strings.HasPrefix(path, lootDir+string(filepath.Separator)) {
+		return nil, "", fmt.Errorf("loot item %s is outside of the loot directory", lootID)
+	}
+	return item, path, nil
+}
+
+// OpenLoot returns a loot item and its file, decrypted as it is read. The caller closes the file.
+func (s *lootService) OpenLoot(ctx context.Context, lootID string) (*data.LootItem, *filecrypt.File, error) {
+	item, path, err := s.lootFile(ctx, lootID)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := filecrypt.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open loot file: %w", err)
+	}
+	return item, file, nil
+}
+
+// UpdateLoot replaces the tags and/or notes of a loot item. Nil values are left unchanged.
+func (s *lootService) UpdateLoot(ctx context.Context, lootID string, tags []string, notes *string) (*data.LootItem, error) {
+	item, err := s.GetLoot(ctx, lootID)
+	if err != nil {
+		return nil, err
+	}
+	if tags != nil {
+		item.Tags = normalizeTags(tags)
+	}
+	if notes != nil {
+		item.Notes = *notes
+	}
+	if err := s.store.UpdateLootItem(item); err != nil {
+		return nil, fmt.Errorf("failed to update loot item: %w", err)
+	}
+	return item, nil
+}
+
+// normalizeTags trims, lowercases and de-duplicates tags.
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// DeleteLoot removes a loot item, and its file unless other loot items share it.
+func (s *lootService) DeleteLoot(ctx context.Context, lootID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.deleteLoot(ctx, lootID)
+	return err
+}
+
+// deleteLoot removes a loot item and releases its file, returning the bytes freed on disk.
+func (s *lootService) deleteLoot(ctx context.Context, lootID string) (int64, error) {
+	item, path, err := s.lootFile(ctx, lootID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.store.DeleteLootItem(item.LootID); err != nil {
+		return 0, fmt.Errorf("failed to delete loot item: %w", err)
+	}
+
+	references, err := s.store.CountLootItemsByPath(item.Path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count loot references: %w", err)
+	}
+	if references > 0 {
+		return 0, nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("failed to delete loot file: %w", err)
+	}
+	if s.mirror != nil {
+		if err := s.mirror.Remove(ctx, item); err != nil {
+			logger.Ctx(ctx).Warnf("Loot %s was deleted but its mirrored copy was not: %v", item.LootID, err)
+		}
+	}
+	// The per-task or per-prefix directory goes once it is empty
+	os.Remove(filepath.Dir(path))
+	if item.SHA256 != "" {
+		os.Remove(s.thumbnailPath(item.SHA256))
+	}
+	return item.Size, nil
+}
+
+// ListScreenshots returns a page of a beacon's screenshots, newest first, with thumbnails.
+func (s *lootService) ListScreenshots(ctx context.Context, beaconID string, page, limit int) ([]Screenshot, int64, error) {
+	items, total, err := s.ListLoot(ctx, &data.LootQuery{Page: page, Limit: limit, Type: "screenshot", BeaconID: beaconID})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	screenshots := make([]Screenshot, 0, len(items))
+	for i := range items {
+		item := &items[i]
+		screenshot := Screenshot{
+			LootID:     item.LootID,
+			BeaconID:   item.BeaconID,
+			TaskID:     item.TaskID,
+			Hostname:   item.Hostname,
+			Size:       item.Size,
+			SHA256:     item.SHA256,
+			Tags:       item.Tags,
+			Notes:      item.Notes,
+			CapturedAt: item.CreatedAt,
+		}
+		// A missing thumbnail doesn't hide the screenshot, it can still be downloaded
+		if thumbnail, err := s.thumbnail(ctx, item); err == nil {
+			screenshot.Thumbnail = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(thumbnail)
+		}
+		screenshots = append(screenshots, screenshot)
+	}
+	return screenshots, total, nil
+}
+
+// thumbnailPath returns the path of the cached thumbnail of content with the given hash.
+func (s *lootService) thumbnailPath(sha string) string {
+	return filepath.Join(s.lootDir, lootThumbnailsDir, sha+".jpg")
+}
+
+// thumbnail returns the JPEG thumbnail of a screenshot, generating and caching it on first use.
+// Thumbnails are cached by content hash, so identical screenshots share one.
+func (s *lootService) thumbnail(ctx context.Context, item *data.LootItem) ([]byte, error) {
+	path := s.thumbnailPath(item.SHA256)
+	if thumbnail, err := filecrypt.ReadFile(path); err == nil {
+		return thumbnail, nil
+	}
+
+	_, file, err := s.OpenLoot(ctx, item.LootID)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read loot file: %w", err)
+	}
+	thumbnail, err := makeThumbnail(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create thumbnail directory: %w", err)
+	}
+	if err := filecrypt.WriteFile(path, thumbnail, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save thumbnail: %w", err)
+	}
+	return thumbnail, nil
+}
+
+// Usage returns the loot storage used per engagement, with its quota.
+func (s *lootService) Usage(ctx context.Context) ([]data.LootUsage, error) {
+	usage, err := s.store.GetLootUsage(EngagementFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get loot usage: %w", err)
+	}
+	for i := range usage {
+		usage[i].Quota = s.config.GetQuota(usage[i].Engagement)
+	}
+	return usage, nil
+}
+
+// Cleanup deletes the loot items matching the query, returning how many were deleted and
+// the bytes of stored content freed. With dryRun set, nothing is deleted.
+func (s *lootService) Cleanup(ctx context.Context, query *data.LootQuery, dryRun bool) (int, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if scope := EngagementFromContext(ctx); scope != "" {
+		query.Engagement = scope
+	}
+	query.Page, query.Limit = 1, -1
+	items, _, err := s.store.GetLootItems(query)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list loot: %w", err)
+	}
+
+	if dryRun {
+		// Files whose every reference is among the matched items would be freed
+		matched := make(map[string]int64)
+		sizes := make(map[string]int64)
+		for _, item := range items {
+			matched[item.Path]++
+			sizes[item.Path] = item.Size
+		}
+		freed := int64(0)
+		for path, count := range matched {
+			references, err := s.store.CountLootItemsByPath(path)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to count loot references: %w", err)
+			}
+			if references == count {
+				freed += sizes[path]
+			}
+		}
+		return len(items), freed, nil
+	}
+
+	deleted, freed := 0, int64(0)
+	for _, item := range items {
+		itemFreed, err := s.deleteLoot(ctx, item.LootID)
+		if err != nil {
+			return deleted, freed, err
+		}
+		deleted++
+		freed += itemFreed
+	}
+	return deleted, freed, nil
+}
+
+// ImportLootDir records files in the loot directory that predate the loot table,
+// pointing their task's output at the new loot ID. Returns the number of files recorded.
+func (s *lootService) ImportLootDir() (int, error) {
+	taskDirs, err := os.ReadDir(s.lootDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read loot directory: %w", err)
+	}
+
+	imported := 0
+	for _, taskDir := range taskDirs {
+		if !taskDir.IsDir() || taskDir.Name() == lootObjectsDir || taskDir.Name() == lootThumbnailsDir {
+			continue
+		}
+		task, err := s.store.GetTask(taskDir.Name())
+		if err != nil {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(s.lootDir, taskDir.Name()))
+		if err != nil {
+			return imported, fmt.Errorf("failed to read loot directory: %w", err)
+		}
+		for _, file := range files {
+			relPath := filepath.Join(task.TaskID, file.Name())
+			if file.IsDir() {
+				continue
+			}
+			if _, err := s.store.GetLootItemByPath(relPath); err == nil {
+				continue
+			}
+			content, err := filecrypt.ReadFile(filepath.Join(s.lootDir, relPath))
+			if err != nil {
+				return imported, fmt.Errorf("failed to read loot file: %w", err)
+			}
+
+			item := &data.LootItem{
+				LootID:       uuid.New().String(),
+				Type:         "file",
+				BeaconID:     task.BeaconID,
+				TaskID:       task.TaskID,
+				OriginalPath: task.Arguments,
+				FileName:     file.Name(),
+				Path:         relPath,
+				Engagement:   task.Engagement,
+			}
+			if task.Command == "screenshot" {
+				item.Type = "screenshot"
+				item.OriginalPath = ""
+			}
+			describeLoot(item, content)
+			if beacon, err := s.store.GetBeacon(task.BeaconID); err == nil {
+				item.Hostname = beacon.Hostname
+			}
+			if err := s.store.CreateLootItem(item); err != nil {
+				return imported, fmt.Errorf("failed to create loot item: %w", err)
+			}
+			imported++
+
+			// The task output used to hold the relative path, clients now fetch loot by ID
+			if task.Output == relPath {
+				task.Output = item.LootID
+				if err := s.store.UpdateTask(task); err != nil {
+					return imported, fmt.Errorf("failed to update task output: %w", err)
+				}
+			}
+		}
+	}
+	return imported, nil
+}
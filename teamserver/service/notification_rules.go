@@ -0,0 +1,209 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/mail"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"simplec2/teamserver/data"
+)
+
+// decodeRuleEvent splits a broadcast event into its type and payload.
+func decodeRuleEvent(event []byte) (string, interface{}, bool) {
+	var decoded struct {
+		Type    string      `json:"type"`
+		Payload interface{} `json:"payload"`
+	}
+	if err := json.Unmarshal(event, &decoded); err != nil || decoded.Type == "" {
+		return "", nil, false
+	}
+	return decoded.Type, decoded.Payload, true
+}
+
+// normalizeField makes field names comparable across payloads, which mix "BeaconID" and "beacon_id".
+func normalizeField(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// lookupField returns a field of an event payload; nested fields are separated by dots.
+func lookupField(payload interface{}, field string) (interface{}, bool) {
+	value := payload
+	for _, name := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		found := false
+		for key, v := range object {
+			if normalizeField(key) == normalizeField(name) {
+				value, found = v, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// fieldString formats a payload value for comparison.
+func fieldString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// matchConditions reports whether a payload matches all conditions. String comparisons ignore case.
+func matchConditions(conditions []data.RuleCondition, payload interface{}) bool {
+	for _, condition := range conditions {
+		value, ok := lookupField(payload, condition.Field)
+		if condition.Op == "exists" {
+			if !ok || fieldString(value) == "" {
+				return false
+			}
+			continue
+		}
+		actual := fieldString(value)
+
+		var matched bool
+		switch condition.Op {
+		case "", "eq":
+			matched = ok && strings.EqualFold(actual, condition.Value)
+		case "ne":
+			matched = !ok || !strings.EqualFold(actual, condition.Value)
+		case "match":
+			matched, _ = path.Match(strings.ToLower(condition.Value), strings.ToLower(actual))
+			matched = ok && matched
+		case "contains":
+			matched = ok && strings.Contains(strings.ToLower(actual), strings.ToLower(condition.Value))
+		case "regex":
+			re, err := regexp.Compile(condition.Value)
+			matched = ok && err == nil && re.MatchString(actual)
+		case "gt", "lt":
+			a, errA := strconv.ParseFloat(actual, 64)
+			b, errB := strconv.ParseFloat(condition.Value, 64)
+			if ok && errA == nil && errB == nil {
+				matched = (condition.Op == "gt" && a > b) || (condition.Op == "lt" && a < b)
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// runAction does one action of a rule that matched an event.
+func (s *notificationService) runAction(rule *data.NotificationRule, action data.RuleAction, eventType string, payload interface{}, event []byte) error {
+	switch action.Type {
+	case ActionWebhook:
+		return s.postWebhook(rule, action.URL, event)
+	case ActionEmail:
+		return s.sendEmail(rule, action, eventType, payload)
+	case ActionMarkHighValue:
+		return s.markHighValue(rule, payload)
+	}
+	return fmt.Errorf("unknown action type '%s'", action.Type)
+}
+
+// postWebhook posts the rule and the event that matched it as JSON.
+func (s *notificationService) postWebhook(rule *data.NotificationRule, url string, event []byte) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"rule":       rule.Name,
+		"rule_id":    rule.ID,
+		"engagement": rule.Engagement,
+		"event":      json.RawMessage(event),
+		"fired_at":   time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sendEmail mails the event that matched a rule to the action's recipients.
+func (s *notificationService) sendEmail(rule *data.NotificationRule, action data.RuleAction, eventType string, payload interface{}) error {
+	cfg := s.config.SMTP
+	if cfg == nil {
+		return fmt.Errorf("notifications.smtp is not configured")
+	}
+	details, _ := json.MarshalIndent(payload, "", "  ")
+
+	// Recipients were validated with the rule
+	recipients := make([]string, 0, len(action.To))
+	for _, to := range action.To {
+		if address, err := mail.ParseAddress(to); err == nil {
+			recipients = append(recipients, address.Address)
+		}
+	}
+	subject := action.Subject
+	if subject == "" {
+		subject = fmt.Sprintf("[SimpleC2] %s: %s", rule.Name, eventType)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(action.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "Notification rule '%s' matched a %s event in engagement '%s'.\r\n\r\n", rule.Name, eventType, rule.Engagement)
+	msg.Write(bytes.ReplaceAll(details, []byte("\n"), []byte("\r\n")))
+	msg.WriteString("\r\n")
+
+	return deliverMail(cfg, recipients, msg.Bytes())
+}
+
+// markHighValue marks the beacon an event is about as high-value and tells the clients.
+func (s *notificationService) markHighValue(rule *data.NotificationRule, payload interface{}) error {
+	value, ok := lookupField(payload, "beacon_id")
+	beaconID := fieldString(value)
+	if !ok || beaconID == "" {
+		return fmt.Errorf("event is not about a beacon")
+	}
+	beacon, err := s.store.GetBeacon(beaconID)
+	if err != nil {
+		return fmt.Errorf("failed to get beacon: %w", err)
+	}
+	if beacon.Engagement != rule.Engagement || beacon.HighValue {
+		return nil
+	}
+	if err := s.store.SetBeaconHighValue(beaconID, true); err != nil {
+		return fmt.Errorf("failed to mark beacon high-value: %w", err)
+	}
+	beacon.HighValue = true
+
+	event, err := json.Marshal(map[string]interface{}{"type": "BEACON_METADATA_UPDATED", "payload": beacon})
+	if err != nil {
+		return err
+	}
+	s.broadcast(beacon.Engagement, event)
+	return nil
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+
+	"gorm.io/gorm"
+)
+
+// Notification rule action types.
+const (
+	ActionWebhook       = "webhook"
+	ActionEmail         = "email"
+	ActionMarkHighValue = "mark_high_value"
+)
+
+// ruleOps are the comparison operators of rule conditions.
+var ruleOps = map[string]bool{"eq": true, "ne": true, "match": true, "contains": true, "regex": true, "gt": true, "lt": true, "exists": true}
+
+// NotificationService defines the interface for notification rules, which are evaluated against
+// every event the TeamServer broadcasts.
+type NotificationService interface {
+	// ListRules retrieves the notification rules.
+	ListRules(ctx context.Context) ([]data.NotificationRule, error)
+
+	// GetRule retrieves a notification rule.
+	GetRule(ctx context.Context, id uint) (*data.NotificationRule, error)
+
+	// CreateRule validates and creates a notification rule.
+	CreateRule(ctx context.Context, rule *data.NotificationRule) (*data.NotificationRule, error)
+
+	// UpdateRule validates and replaces the definition of a notification rule.
+	UpdateRule(ctx context.Context, id uint, rule *data.NotificationRule) (*data.NotificationRule, error)
+
+	// DeleteRule removes a notification rule.
+	DeleteRule(ctx context.Context, id uint) error
+
+	// Notify queues a broadcast event to be evaluated against the rules. It never blocks;
+	// events are dropped if the worker falls behind.
+	Notify(engagement string, event []byte)
+
+	// Start loads the rules and starts the worker evaluating queued events.
+	Start() error
+}
+
+// notifiedEvent is a broadcast event waiting to be evaluated.
+type notifiedEvent struct {
+	engagement string
+	data       []byte
+}
+
+// notificationService implements the NotificationService interface.
+type notificationService struct {
+	store     data.DataStore
+	config    config.NotificationConfig
+	broadcast func(engagement string, data []byte)
+	client    *http.Client
+	queue     chan notifiedEvent
+
+	mu    sync.RWMutex
+	rules []data.NotificationRule // Enabled rules of all engagements
+}
+
+// NewNotificationService creates a new instance of notificationService. broadcast sends the events
+// actions cause, such as BEACON_METADATA_UPDATED for beacons marked high-value.
+func NewNotificationService(store data.DataStore, cfg config.NotificationConfig, broadcast func(engagement string, data []byte)) NotificationService {
+	return &notificationService{
+		store:     store,
+		config:    cfg,
+		broadcast: broadcast,
+		client:    &http.Client{Timeout: cfg.GetWebhookTimeout()},
+		queue:     make(chan notifiedEvent, cfg.GetQueueSize()),
+	}
+}
+
+// ListRules retrieves the notification rules.
+func (s *notificationService) ListRules(ctx context.Context) ([]data.NotificationRule, error) {
+	rules, err := s.store.GetNotificationRules(EngagementFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notification rules: %w", err)
+	}
+	return rules, nil
+}
+
+// GetRule retrieves a notification rule.
+func (s *notificationService) GetRule(ctx context.Context, id uint) (*data.NotificationRule, error) {
+	rule, err := s.store.GetNotificationRule(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification rule: %w", err)
+	}
+	if !inEngagement(ctx, rule.Engagement) {
+		return nil, fmt.Errorf("failed to get notification rule: %w", gorm.ErrRecordNotFound)
+	}
+	return rule, nil
+}
+
+// CreateRule validates and creates a notification rule.
+func (s *notificationService) CreateRule(ctx context.Context, rule *data.NotificationRule) (*data.NotificationRule, error) {
+	if err := s.validate(rule); err != nil {
+		return nil, err
+	}
+	rule.Engagement = engagementForNew(ctx)
+	if err := s.store.CreateNotificationRule(rule); err != nil {
+		return nil, fmt.Errorf("failed to create notification rule: %w", err)
+	}
+	s.reload()
+	return rule, nil
+}
+
+// UpdateRule validates and replaces the definition of a notification rule.
+func (s *notificationService) UpdateRule(ctx context.Context, id uint, update *data.NotificationRule) (*data.NotificationRule, error) {
+	rule, err := s.GetRule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(update); err != nil {
+		return nil, err
+	}
+	rule.Name = update.Name
+	rule.Disabled = update.Disabled
+	rule.EventType = update.EventType
+	rule.Conditions = update.Conditions
+	rule.Actions = update.Actions
+	if err := s.store.UpdateNotificationRule(rule); err != nil {
+		return nil, fmt.Errorf("failed to update notification rule: %w", err)
+	}
+	s.reload()
+	return rule, nil
+}
+
+// DeleteRule removes a notification rule.
+func (s *notificationService) DeleteRule(ctx context.Context, id uint) error {
+	if _, err := s.GetRule(ctx, id); err != nil {
+		return err
+	}
+	if err := s.store.DeleteNotificationRule(id); err != nil {
+		return fmt.Errorf("failed to delete notification rule: %w", err)
+	}
+	s.reload()
+	return nil
+}
+
+// validate checks a rule's event type, conditions and actions, and normalizes them.
+func (s *notificationService) validate(rule *data.NotificationRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	rule.EventType = strings.ToUpper(strings.TrimSpace(rule.EventType))
+	if rule.EventType == "" {
+		return fmt.Errorf("event_type is required (use \"*\" for every event)")
+	}
+
+	for i := range rule.Conditions {
+		condition := &rule.Conditions[i]
+		if condition.Field == "" {
+			return fmt.Errorf("condition %d: field is required", i+1)
+		}
+		if condition.Op == "" {
+			condition.Op = "eq"
+		}
+		if !ruleOps[condition.Op] {
+			return fmt.Errorf("condition %d: invalid op '%s'", i+1, condition.Op)
+		}
+		switch condition.Op {
+		case "regex":
+			if _, err := regexp.Compile(condition.Value); err != nil {
+				return fmt.Errorf("condition %d: invalid regex: %w", i+1, err)
+			}
+		case "match":
+			if _, err := path.Match(condition.Value, ""); err != nil {
+				return fmt.Errorf("condition %d: invalid pattern: %w", i+1, err)
+			}
+		}
+	}
+
+	if len(rule.Actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+	for i, action := range rule.Actions {
+		switch action.Type {
+		case ActionWebhook:
+			u, err := url.Parse(action.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("action %d: webhook url must be an http or https URL", i+1)
+			}
+		case ActionEmail:
+			if len(action.To) == 0 {
+				return fmt.Errorf("action %d: email recipients are required", i+1)
+			}
+			for _, to := range action.To {
+				if _, err := mail.ParseAddress(to); err != nil || strings.ContainsAny(to, "\r\n") {
+					return fmt.Errorf("action %d: invalid email recipient '%s'", i+1, to)
+				}
+			}
+			if strings.ContainsAny(action.Subject, "\r\n") {
+				return fmt.Errorf("action %d: email subject must be a single line", i+1)
+			}
+			if s.config.SMTP == nil {
+				return fmt.Errorf("action %d: email actions require notifications.smtp in the TeamServer config", i+1)
+			}
+		case ActionMarkHighValue:
+		default:
+			return fmt.Errorf("action %d: invalid type '%s' (must be '%s', '%s' or '%s')", i+1, action.Type, ActionWebhook, ActionEmail, ActionMarkHighValue)
+		}
+	}
+	return nil
+}
+
+// reload refreshes the enabled rules the worker evaluates after a rule changed.
+func (s *notificationService) reload() {
+	if err := s.load(); err != nil {
+		logger.Errorf("Failed to reload notification rules: %v", err)
+	}
+}
+
+// load reads the enabled rules of all engagements.
+func (s *notificationService) load() error {
+	rules, err := s.store.GetNotificationRules("")
+	if err != nil {
+		return err
+	}
+	enabled := rules[:0]
+	for _, rule := range rules {
+		if !rule.Disabled {
+			enabled = append(enabled, rule)
+		}
+	}
+	s.mu.Lock()
+	s.rules = enabled
+	s.mu.Unlock()
+	return nil
+}
+
+// Notify queues a broadcast event to be evaluated against the rules.
+func (s *notificationService) Notify(engagement string, event []byte) {
+	select {
+	case s.queue <- notifiedEvent{engagement: engagement, data: event}:
+	default:
+		logger.Warnf("Notification queue is full, event not evaluated against notification rules")
+	}
+}
+
+// Start loads the rules and starts the worker evaluating queued events.
+func (s *notificationService) Start() error {
+	if s.config.SMTP != nil {
+		if err := validateSMTP(s.config.SMTP); err != nil {
+			return err
+		}
+	}
+	if err := s.load(); err != nil {
+		return fmt.Errorf("failed to load notification rules: %w", err)
+	}
+	go func() {
+		for event := range s.queue {
+			s.evaluate(event)
+		}
+	}()
+	return nil
+}
+
+// evaluate runs the actions of every rule matching an event.
+func (s *notificationService) evaluate(event notifiedEvent) {
+	eventType, payload, ok := decodeRuleEvent(event.data)
+	if !ok {
+		return
+	}
+
+	s.mu.RLock()
+	rules := s.rules
+	s.mu.RUnlock()
+	for i := range rules {
+		rule := &rules[i]
+		// Events sent to all engagements are evaluated against the rules of every engagement
+		if event.engagement != "" && rule.Engagement != event.engagement {
+			continue
+		}
+		if rule.EventType != "*" && rule.EventType != eventType {
+			continue
+		}
+		if !matchConditions(rule.Conditions, payload) {
+			continue
+		}
+
+		logger.Infof("Notification rule '%s' (%d) matched %s event", rule.Name, rule.ID, eventType)
+		for _, action := range rule.Actions {
+			if err := s.runAction(rule, action, eventType, payload, event.data); err != nil {
+				logger.Errorf("Notification rule '%s' %s action failed: %v", rule.Name, action.Type, err)
+			}
+		}
+		if err := s.store.RecordNotificationRuleFired(rule.ID, time.Now()); err != nil {
+			logger.Errorf("Failed to record notification rule '%s' firing: %v", rule.Name, err)
+		}
+	}
+}
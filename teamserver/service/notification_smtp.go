@@ -0,0 +1,150 @@
+package service
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"simplec2/pkg/config"
+)
+
+// validateSMTP checks the TLS mode, authentication and sender of the mail server configuration.
+func validateSMTP(cfg *config.SMTPConfig) error {
+	if cfg.Host == "" {
+		return fmt.Errorf("notifications.smtp.host is required")
+	}
+	switch cfg.GetTLS() {
+	case config.SMTPTLSAuto, config.SMTPTLSStartTLS, config.SMTPTLSImplicit, config.SMTPTLSNone:
+	default:
+		return fmt.Errorf("invalid notifications.smtp.tls '%s' (must be 'auto', 'starttls', 'tls' or 'none')", cfg.TLS)
+	}
+	switch cfg.GetAuth() {
+	case config.SMTPAuthNone:
+	case config.SMTPAuthPlain, config.SMTPAuthLogin, config.SMTPAuthCRAMMD5:
+		if cfg.Username == "" {
+			return fmt.Errorf("notifications.smtp.username is required for %s authentication", cfg.GetAuth())
+		}
+	default:
+		return fmt.Errorf("invalid notifications.smtp.auth '%s' (must be 'plain', 'login', 'cram-md5' or 'none')", cfg.Auth)
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return fmt.Errorf("invalid notifications.smtp.from: %w", err)
+	}
+	return nil
+}
+
+// smtpAuth returns the configured authentication, or nil if the server is used without.
+func smtpAuth(cfg *config.SMTPConfig) smtp.Auth {
+	switch cfg.GetAuth() {
+	case config.SMTPAuthPlain:
+		return smtp.PlainAuth("", cfg.Username, cfg.GetPassword(), cfg.Host)
+	case config.SMTPAuthLogin:
+		return &loginAuth{username: cfg.Username, password: cfg.GetPassword(), host: cfg.Host}
+	case config.SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(cfg.Username, cfg.GetPassword())
+	}
+	return nil
+}
+
+// loginAuth implements the LOGIN mechanism, which some servers (e.g. Exchange) offer instead of PLAIN.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Like smtp.PlainAuth, never send the password in the clear
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" && server.Name != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSuffix(string(fromServer), ":")) {
+	case "username":
+		return []byte(a.username), nil
+	case "password":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN challenge '%s'", fromServer)
+}
+
+// deliverMail sends a message through the configured mail server. The whole conversation is
+// bounded by the configured timeout, so a stuck server doesn't hold up the notification worker.
+func deliverMail(cfg *config.SMTPConfig, to []string, msg []byte) error {
+	timeout := cfg.GetTimeout()
+	dialer := &net.Dialer{Timeout: timeout}
+	tlsConfig := &tls.Config{ServerName: cfg.Host, InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	var conn net.Conn
+	var err error
+	if cfg.GetTLS() == config.SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", cfg.GetAddress(), tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", cfg.GetAddress())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to mail server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to mail server: %w", err)
+	}
+	defer client.Close()
+
+	if mode := cfg.GetTLS(); mode == config.SMTPTLSAuto || mode == config.SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("failed to start TLS: %w", err)
+			}
+		} else if mode == config.SMTPTLSStartTLS {
+			return fmt.Errorf("mail server does not support STARTTLS")
+		}
+	}
+	if auth := smtpAuth(cfg); auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("mail server does not support authentication")
+		}
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate to mail server: %w", err)
+		}
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender: %w", err)
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("mail server rejected the sender: %w", err)
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("mail server rejected recipient %s: %w", recipient, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mail server rejected the message: %w", err)
+	}
+	return client.Quit()
+}
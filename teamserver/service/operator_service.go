@@ -0,0 +1,428 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+)
+
+// ErrInvalidCredentials is returned when a login attempt fails.
+// It deliberately does not say whether the user exists.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// OperatorUpdate holds the optional fields of an operator update.
+type OperatorUpdate struct {
+	Password *string
+	Role     *string
+	Disabled *bool
+}
+
+// OperatorService defines the interface for operator account business logic.
+type OperatorService interface {
+	// Authenticate verifies a username and password and records the login.
+	Authenticate(ctx context.Context, username, password, ipAddress string) (*data.Operator, error)
+
+	// GetOperator retrieves an operator by username.
+	GetOperator(ctx context.Context, username string) (*data.Operator, error)
+
+	// ListOperators retrieves all operators.
+	ListOperators(ctx context.Context, page int, limit int) ([]data.Operator, int64, error)
+
+	// CreateOperator creates a new operator account.
+	CreateOperator(ctx context.Context, username, password, role string) (*data.Operator, error)
+
+	// ChangePassword lets an operator replace their own password, subject to the password policy.
+	ChangePassword(ctx context.Context, username, currentPassword, newPassword string) (*data.Operator, error)
+
+	// UpdateOperator changes the password, role or disabled flag of an operator.
+	UpdateOperator(ctx context.Context, username string, update *OperatorUpdate) (*data.Operator, error)
+
+	// DeleteOperator deletes an operator account and invalidates its sessions.
+	DeleteOperator(ctx context.Context, username string) error
+
+	// RecordCertificate records a client certificate issued to an operator.
+	RecordCertificate(ctx context.Context, username, serialNumber, commonName string) error
+
+	// RevokeCertificates revokes all client certificates of an operator.
+	RevokeCertificates(ctx context.Context, username string) error
+
+	// AuthenticateCertificate maps a verified client certificate to its operator account.
+	AuthenticateCertificate(ctx context.Context, serialNumber, commonName string) (*data.Operator, error)
+
+	// IsOperatorCertificate reports whether a serial number belongs to an operator client certificate.
+	IsOperatorCertificate(serialNumber string) bool
+
+	// ProvisionExternal creates or updates the account of a user authenticated by an identity provider.
+	ProvisionExternal(ctx context.Context, username, provider, role, ipAddress string) (*data.Operator, error)
+
+	// EnsureAdmin creates the initial admin account if no operators exist yet.
+	EnsureAdmin(ctx context.Context, username, password string) (bool, error)
+}
+
+// operatorService implements the OperatorService interface.
+type operatorService struct {
+	store  data.DataStore
+	policy *PasswordPolicy
+	hasher *PasswordHasher
+}
+
+// NewOperatorService creates a new instance of operatorService.
+func NewOperatorService(store data.DataStore, policy *PasswordPolicy, hasher *PasswordHasher) OperatorService {
+	return &operatorService{store: store, policy: policy, hasher: hasher}
+}
+
+// Authenticate verifies a username and password and records the login.
+func (s *operatorService) Authenticate(ctx context.Context, username, password, ipAddress string) (*data.Operator, error) {
+	operator, err := s.store.GetOperator(username)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if operator.Disabled || operator.Provider != "local" {
+		return nil, ErrInvalidCredentials
+	}
+	if err := VerifyPassword(password, operator.PasswordHash); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	// Upgrade hashes made with another algorithm or weaker parameters while the password is known
+	if s.hasher.NeedsRehash(operator.PasswordHash) {
+		if hash, err := s.hasher.Hash(password); err != nil {
+			logger.Ctx(ctx).Warnf("Failed to rehash the password of %s: %v", operator.Username, err)
+		} else {
+			operator.PasswordHash = hash
+			logger.Ctx(ctx).Infof("Upgraded the password hash of %s to %s", operator.Username, s.hasher.Algorithm)
+		}
+	}
+
+	now := time.Now()
+	operator.LastLogin = &now
+	operator.LastLoginIP = ipAddress
+	if err := s.store.UpdateOperator(operator); err != nil {
+		return nil, fmt.Errorf("failed to record login: %w", err)
+	}
+	return operator, nil
+}
+
+// GetOperator retrieves an operator by username.
+func (s *operatorService) GetOperator(ctx context.Context, username string) (*data.Operator, error) {
+	operator, err := s.store.GetOperator(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operator: %w", err)
+	}
+	return operator, nil
+}
+
+// ListOperators retrieves all operators.
+func (s *operatorService) ListOperators(ctx context.Context, page int, limit int) ([]data.Operator, int64, error) {
+	operators, total, err := s.store.GetOperators(page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list operators: %w", err)
+	}
+	return operators, total, nil
+}
+
+// CreateOperator creates a new operator account.
+func (s *operatorService) CreateOperator(ctx context.Context, username, password, role string) (*data.Operator, error) {
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("username and password are required")
+	}
+	if err := s.policy.Validate(password); err != nil {
+		return nil, err
+	}
+	if role == "" {
+		role = RoleOperator
+	}
+	if !validRole(role) {
+		return nil, fmt.Errorf("invalid role '%s'", role)
+	}
+	if _, err := s.store.GetOperator(username); err == nil {
+		return nil, fmt.Errorf("operator '%s' already exists", username)
+	}
+
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	// The password was chosen by an admin, so the operator has to replace it on first login
+	now := time.Now()
+	operator := &data.Operator{
+		Username:           username,
+		PasswordHash:       hash,
+		Role:               role,
+		Provider:           "local",
+		MustChangePassword: true,
+		PasswordChangedAt:  &now,
+	}
+	if err := s.store.CreateOperator(operator); err != nil {
+		return nil, fmt.Errorf("failed to create operator: %w", err)
+	}
+	return operator, nil
+}
+
+// ProvisionExternal creates or updates the account of a user authenticated by an identity provider.
+// The role follows the identity provider on every login; local accounts are never taken over.
+func (s *operatorService) ProvisionExternal(ctx context.Context, username, provider, role, ipAddress string) (*data.Operator, error) {
+	if !validRole(role) {
+		return nil, fmt.Errorf("invalid role '%s'", role)
+	}
+
+	now := time.Now()
+	operator, err := s.store.GetOperator(username)
+	if err != nil {
+		// External accounts have no local password
+		operator = &data.Operator{
+			Username:    username,
+			Role:        role,
+			Provider:    provider,
+			LastLogin:   &now,
+			LastLoginIP: ipAddress,
+		}
+		if err := s.store.CreateOperator(operator); err != nil {
+			return nil, fmt.Errorf("failed to create operator: %w", err)
+		}
+		return operator, nil
+	}
+
+	if operator.Provider != provider {
+		return nil, fmt.Errorf("operator '%s' already exists with provider '%s'", username, operator.Provider)
+	}
+	if operator.Disabled {
+		return nil, ErrInvalidCredentials
+	}
+	operator.Role = role
+	operator.LastLogin = &now
+	operator.LastLoginIP = ipAddress
+	if err := s.store.UpdateOperator(operator); err != nil {
+		return nil, fmt.Errorf("failed to update operator: %w", err)
+	}
+	return operator, nil
+}
+
+// UpdateOperator changes the password, role or disabled flag of an operator.
+func (s *operatorService) UpdateOperator(ctx context.Context, username string, update *OperatorUpdate) (*data.Operator, error) {
+	operator, err := s.store.GetOperator(username)
+	if err != nil {
+		return nil, fmt.Errorf("operator not found: %w", err)
+	}
+
+	revokeSessions := false
+	if update.Role != nil && *update.Role != operator.Role {
+		if !validRole(*update.Role) {
+			return nil, fmt.Errorf("invalid role '%s'", *update.Role)
+		}
+		if err := s.ensureAnotherAdmin(operator); err != nil {
+			return nil, err
+		}
+		operator.Role = *update.Role
+	}
+	if update.Disabled != nil && *update.Disabled != operator.Disabled {
+		if *update.Disabled {
+			if err := s.ensureAnotherAdmin(operator); err != nil {
+				return nil, err
+			}
+			revokeSessions = true
+		}
+		operator.Disabled = *update.Disabled
+	}
+	if update.Password != nil {
+		if operator.Provider != "local" {
+			return nil, fmt.Errorf("password can only be set for local accounts")
+		}
+		// An admin reset is treated like a new account: the operator must change it again
+		if err := s.setPassword(operator, *update.Password, true); err != nil {
+			return nil, err
+		}
+		revokeSessions = true
+	}
+
+	if err := s.store.UpdateOperator(operator); err != nil {
+		return nil, fmt.Errorf("failed to update operator: %w", err)
+	}
+	if revokeSessions {
+		if err := s.store.DeleteSessionsByUser(operator.Username); err != nil {
+			return nil, fmt.Errorf("failed to invalidate sessions: %w", err)
+		}
+	}
+	return operator, nil
+}
+
+// ChangePassword lets an operator replace their own password, subject to the password policy.
+// All sessions of the operator are invalidated; the caller issues new tokens.
+func (s *operatorService) ChangePassword(ctx context.Context, username, currentPassword, newPassword string) (*data.Operator, error) {
+	operator, err := s.store.GetOperator(username)
+	if err != nil {
+		return nil, fmt.Errorf("operator not found: %w", err)
+	}
+	if operator.Provider != "local" {
+		return nil, fmt.Errorf("password can only be changed for local accounts")
+	}
+	if err := VerifyPassword(currentPassword, operator.PasswordHash); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if err := s.setPassword(operator, newPassword, false); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.UpdateOperator(operator); err != nil {
+		return nil, fmt.Errorf("failed to update operator: %w", err)
+	}
+	if err := s.store.DeleteSessionsByUser(operator.Username); err != nil {
+		return nil, fmt.Errorf("failed to invalidate sessions: %w", err)
+	}
+	return operator, nil
+}
+
+// setPassword checks a new password against the policy and recent passwords and sets it on the operator.
+// The caller saves the operator.
+func (s *operatorService) setPassword(operator *data.Operator, password string, mustChange bool) error {
+	if err := s.policy.Validate(password); err != nil {
+		return err
+	}
+	if s.policy.HistorySize > 0 {
+		if operator.PasswordHash != "" && VerifyPassword(password, operator.PasswordHash) == nil {
+			return fmt.Errorf("password must differ from the current password")
+		}
+		history, err := s.store.GetPasswordHistory(operator.Username, s.policy.HistorySize)
+		if err != nil {
+			return fmt.Errorf("failed to get password history: %w", err)
+		}
+		for _, entry := range history {
+			if VerifyPassword(password, entry.PasswordHash) == nil {
+				return fmt.Errorf("password must not match any of the last %d passwords", s.policy.HistorySize)
+			}
+		}
+	}
+
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if operator.PasswordHash != "" && s.policy.HistorySize > 0 {
+		entry := &data.PasswordHistory{Username: operator.Username, PasswordHash: operator.PasswordHash}
+		if err := s.store.AddPasswordHistory(entry, s.policy.HistorySize); err != nil {
+			return fmt.Errorf("failed to record password history: %w", err)
+		}
+	}
+
+	now := time.Now()
+	operator.PasswordHash = hash
+	operator.MustChangePassword = mustChange
+	operator.PasswordChangedAt = &now
+	return nil
+}
+
+// DeleteOperator deletes an operator account and invalidates its sessions.
+func (s *operatorService) DeleteOperator(ctx context.Context, username string) error {
+	operator, err := s.store.GetOperator(username)
+	if err != nil {
+		return fmt.Errorf("operator not found: %w", err)
+	}
+	if err := s.ensureAnotherAdmin(operator); err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteOperator(username); err != nil {
+		return fmt.Errorf("failed to delete operator: %w", err)
+	}
+	if err := s.store.DeleteSessionsByUser(username); err != nil {
+		return fmt.Errorf("failed to invalidate sessions: %w", err)
+	}
+	if err := s.store.RevokeCertificatesByOperator(username); err != nil {
+		return fmt.Errorf("failed to revoke certificates: %w", err)
+	}
+	return nil
+}
+
+// RecordCertificate records a client certificate issued to an operator.
+func (s *operatorService) RecordCertificate(ctx context.Context, username, serialNumber, commonName string) error {
+	cert := &data.IssuedCertificate{
+		SerialNumber: serialNumber,
+		CommonName:   commonName,
+		Operator:     username,
+	}
+	if err := s.store.CreateIssuedCertificate(cert); err != nil {
+		return fmt.Errorf("failed to record certificate: %w", err)
+	}
+	return nil
+}
+
+// RevokeCertificates revokes all client certificates of an operator.
+func (s *operatorService) RevokeCertificates(ctx context.Context, username string) error {
+	if err := s.store.RevokeCertificatesByOperator(username); err != nil {
+		return fmt.Errorf("failed to revoke certificates: %w", err)
+	}
+	return nil
+}
+
+// AuthenticateCertificate maps a verified client certificate to its operator account.
+// Only certificates recorded for that operator and not revoked are accepted, so listener
+// certificates signed by the same CA cannot be used to log in.
+func (s *operatorService) AuthenticateCertificate(ctx context.Context, serialNumber, commonName string) (*data.Operator, error) {
+	cert, err := s.store.GetIssuedCertificate(serialNumber)
+	if err != nil || cert.Revoked || cert.Operator == "" || cert.Operator != commonName {
+		return nil, ErrInvalidCredentials
+	}
+	operator, err := s.store.GetOperator(cert.Operator)
+	if err != nil || operator.Disabled {
+		return nil, ErrInvalidCredentials
+	}
+	return operator, nil
+}
+
+// IsOperatorCertificate reports whether a serial number belongs to an operator client certificate.
+func (s *operatorService) IsOperatorCertificate(serialNumber string) bool {
+	cert, err := s.store.GetIssuedCertificate(serialNumber)
+	return err == nil && cert.Operator != ""
+}
+
+// ensureAnotherAdmin refuses changes that would leave no enabled admin.
+func (s *operatorService) ensureAnotherAdmin(operator *data.Operator) error {
+	if operator.Role != RoleAdmin || operator.Disabled {
+		return nil
+	}
+	count, err := s.store.CountOperators(RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("failed to count admins: %w", err)
+	}
+	if count <= 1 {
+		return fmt.Errorf("cannot remove the last admin")
+	}
+	return nil
+}
+
+// EnsureAdmin creates the initial admin account if no operators exist yet.
+// The password may be plaintext or an existing bcrypt or Argon2id hash.
+func (s *operatorService) EnsureAdmin(ctx context.Context, username, password string) (bool, error) {
+	_, total, err := s.store.GetOperators(1, 1)
+	if err != nil {
+		return false, fmt.Errorf("failed to list operators: %w", err)
+	}
+	if total > 0 {
+		return false, nil
+	}
+	if username == "" || password == "" {
+		return false, fmt.Errorf("no operators exist and no initial admin credentials are configured")
+	}
+
+	hash := password
+	if !isPasswordHash(password) {
+		if hash, err = s.hasher.Hash(password); err != nil {
+			return false, fmt.Errorf("failed to hash password: %w", err)
+		}
+	}
+	// The initial password comes from the config file and must be replaced on first login
+	operator := &data.Operator{
+		Username:           username,
+		PasswordHash:       hash,
+		Role:               RoleAdmin,
+		Provider:           "local",
+		MustChangePassword: true,
+	}
+	if err := s.store.CreateOperator(operator); err != nil {
+		return false, fmt.Errorf("failed to create admin: %w", err)
+	}
+	return true, nil
+}
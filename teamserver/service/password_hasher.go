@@ -0,0 +1,160 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"simplec2/pkg/config"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// argon2idPrefix starts an Argon2id hash in the PHC string format:
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<threads>$<salt>$<hash>
+const argon2idPrefix = "$argon2id$"
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// errMismatchedPassword is returned when a password does not match an Argon2id hash.
+var errMismatchedPassword = errors.New("password does not match the hash")
+
+// PasswordHasher hashes passwords of local accounts with the configured algorithm.
+type PasswordHasher struct {
+	Algorithm  string
+	BcryptCost int
+	Time       uint32
+	MemoryKB   uint32
+	Threads    uint8
+}
+
+// NewPasswordHasher creates a hasher from the configuration, filling in defaults.
+func NewPasswordHasher(cfg config.PasswordHashingConfig) (*PasswordHasher, error) {
+	hasher := &PasswordHasher{
+		Algorithm:  cfg.Algorithm,
+		BcryptCost: cfg.BcryptCost,
+		Time:       cfg.Argon2Time,
+		MemoryKB:   cfg.Argon2MemoryKB,
+		Threads:    cfg.Argon2Threads,
+	}
+	if hasher.Algorithm == "" {
+		hasher.Algorithm = config.PasswordHashBcrypt
+	}
+	if hasher.Algorithm != config.PasswordHashBcrypt && hasher.Algorithm != config.PasswordHashArgon2id {
+		return nil, fmt.Errorf("invalid password hashing algorithm '%s' (must be 'bcrypt' or 'argon2id')", cfg.Algorithm)
+	}
+	if hasher.BcryptCost == 0 {
+		hasher.BcryptCost = bcrypt.DefaultCost
+	}
+	if hasher.BcryptCost < bcrypt.MinCost || hasher.BcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if hasher.Time == 0 {
+		hasher.Time = 3
+	}
+	if hasher.MemoryKB == 0 {
+		hasher.MemoryKB = 64 * 1024
+	}
+	if hasher.Threads == 0 {
+		hasher.Threads = 4
+	}
+	if hasher.MemoryKB < 8*uint32(hasher.Threads) {
+		return nil, fmt.Errorf("argon2 memory must be at least 8 KiB per thread")
+	}
+	return hasher, nil
+}
+
+// Hash hashes a password with the configured algorithm.
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.Algorithm == config.PasswordHashArgon2id {
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.Time, h.MemoryKB, h.Threads, argon2KeyLength)
+		return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, h.MemoryKB, h.Time, h.Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+	return string(hashed), err
+}
+
+// NeedsRehash reports whether a hash was made with another algorithm or weaker parameters than
+// the configured ones, and should be replaced once the password is known.
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		if h.Algorithm != config.PasswordHashArgon2id {
+			return true
+		}
+		params, _, _, err := parseArgon2id(hash)
+		return err != nil || params.time < h.Time || params.memory < h.MemoryKB || params.threads < h.Threads
+	}
+	if h.Algorithm != config.PasswordHashBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < h.BcryptCost
+}
+
+// VerifyPassword 验证密码和哈希，支持 bcrypt 和 Argon2id
+func VerifyPassword(password, hash string) error {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	}
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return errMismatchedPassword
+	}
+	return nil
+}
+
+// isPasswordHash reports whether s is already a bcrypt or Argon2id hash.
+func isPasswordHash(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$") || strings.HasPrefix(s, argon2idPrefix)
+}
+
+// argon2Params are the parameters of an Argon2id hash.
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// parseArgon2id splits an Argon2id hash into its parameters, salt and key.
+func parseArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	if params.time == 0 || params.threads == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"simplec2/pkg/config"
+	"simplec2/teamserver/data"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2id is a cheap Argon2id configuration so the tests stay fast.
+var testArgon2id = config.PasswordHashingConfig{
+	Algorithm:      config.PasswordHashArgon2id,
+	Argon2Time:     1,
+	Argon2MemoryKB: 64,
+	Argon2Threads:  1,
+}
+
+// newTestHasher creates a hasher from the configuration or fails the test.
+func newTestHasher(t *testing.T, cfg config.PasswordHashingConfig) *PasswordHasher {
+	t.Helper()
+	hasher, err := NewPasswordHasher(cfg)
+	if err != nil {
+		t.Fatalf("NewPasswordHasher: %v", err)
+	}
+	return hasher
+}
+
+// TestPasswordHashRoundTrip tests that hashes of both algorithms verify the password they were made from.
+func TestPasswordHashRoundTrip(t *testing.T) {
+	configs := map[string]config.PasswordHashingConfig{
+		"bcrypt":   {Algorithm: config.PasswordHashBcrypt, BcryptCost: bcrypt.MinCost},
+		"argon2id": testArgon2id,
+	}
+	for name, cfg := range configs {
+		hasher := newTestHasher(t, cfg)
+		hash, err := hasher.Hash("correct horse battery staple")
+		if err != nil {
+			t.Fatalf("%s: Hash: %v", name, err)
+		}
+		if name == "argon2id" && !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+			t.Fatalf("%s: unexpected hash format %q", name, hash)
+		}
+		if !isPasswordHash(hash) {
+			t.Fatalf("%s: hash %q not recognized as a password hash", name, hash)
+		}
+		if err := VerifyPassword("correct horse battery staple", hash); err != nil {
+			t.Fatalf("%s: VerifyPassword: %v", name, err)
+		}
+		if hasher.NeedsRehash(hash) {
+			t.Fatalf("%s: fresh hash reported as needing a rehash", name)
+		}
+	}
+
+	// Each hash gets its own salt
+	hasher := newTestHasher(t, testArgon2id)
+	first, _ := hasher.Hash("password")
+	second, _ := hasher.Hash("password")
+	if first == second {
+		t.Fatalf("two hashes of the same password are identical")
+	}
+}
+
+// TestVerifyWrongPassword tests that a different password is rejected by both algorithms.
+func TestVerifyWrongPassword(t *testing.T) {
+	for _, cfg := range []config.PasswordHashingConfig{{BcryptCost: bcrypt.MinCost}, testArgon2id} {
+		hash, err := newTestHasher(t, cfg).Hash("password")
+		if err != nil {
+			t.Fatalf("Hash: %v", err)
+		}
+		if err := VerifyPassword("Password", hash); err == nil {
+			t.Fatalf("wrong password accepted by %q", hash)
+		}
+	}
+}
+
+// TestVerifyMalformedHash tests that malformed Argon2id PHC strings are rejected instead of verified.
+func TestVerifyMalformedHash(t *testing.T) {
+	hash, err := newTestHasher(t, testArgon2id).Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	parts := strings.Split(hash, "$")
+	salt, key := parts[4], parts[5]
+
+	malformed := map[string]string{
+		"missing key":          "$argon2id$v=19$m=64,t=1,p=1$" + salt,
+		"extra segment":        hash + "$extra",
+		"wrong version":        "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key,
+		"garbled parameters":   "$argon2id$v=19$m=64;t=1;p=1$" + salt + "$" + key,
+		"zero iterations":      "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key,
+		"zero threads":         "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key,
+		"threads out of range": "$argon2id$v=19$m=64,t=1,p=256$" + salt + "$" + key,
+		"invalid salt":         "$argon2id$v=19$m=64,t=1,p=1$!!!$" + key,
+		"invalid key":          "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$!!!",
+		"empty key":            "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$",
+	}
+	hasher := newTestHasher(t, testArgon2id)
+	for name, hash := range malformed {
+		if err := VerifyPassword("password", hash); err == nil {
+			t.Fatalf("%s: malformed hash %q accepted", name, hash)
+		}
+		if !hasher.NeedsRehash(hash) {
+			t.Fatalf("%s: malformed hash %q not reported as needing a rehash", name, hash)
+		}
+	}
+}
+
+// TestNeedsRehash tests that legacy hashes and hashes made with weaker parameters are flagged for a rehash.
+func TestNeedsRehash(t *testing.T) {
+	bcryptHasher := newTestHasher(t, config.PasswordHashingConfig{BcryptCost: bcrypt.MinCost + 1})
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+	current, err := bcryptHasher.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	argonHash, err := newTestHasher(t, testArgon2id).Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	stronger := testArgon2id
+	stronger.Argon2Time, stronger.Argon2MemoryKB, stronger.Argon2Threads = 2, 128, 2
+	tests := []struct {
+		name   string
+		hasher *PasswordHasher
+		hash   string
+		want   bool
+	}{
+		{"bcrypt with a lower cost", bcryptHasher, string(legacy), true},
+		{"bcrypt with the configured cost", bcryptHasher, current, false},
+		{"argon2id under bcrypt", bcryptHasher, argonHash, true},
+		{"bcrypt under argon2id", newTestHasher(t, testArgon2id), current, true},
+		{"argon2id with the configured parameters", newTestHasher(t, testArgon2id), argonHash, false},
+		{"argon2id with fewer iterations", newTestHasher(t, config.PasswordHashingConfig{Algorithm: config.PasswordHashArgon2id, Argon2Time: 2, Argon2MemoryKB: 64, Argon2Threads: 1}), argonHash, true},
+		{"argon2id with less memory", newTestHasher(t, config.PasswordHashingConfig{Algorithm: config.PasswordHashArgon2id, Argon2Time: 1, Argon2MemoryKB: 128, Argon2Threads: 1}), argonHash, true},
+		{"argon2id with fewer threads", newTestHasher(t, config.PasswordHashingConfig{Algorithm: config.PasswordHashArgon2id, Argon2Time: 1, Argon2MemoryKB: 64, Argon2Threads: 2}), argonHash, true},
+		{"argon2id with stronger parameters than configured", newTestHasher(t, testArgon2id), mustHash(t, stronger, "password"), false},
+		{"not a hash", bcryptHasher, "plaintext", true},
+	}
+	for _, tt := range tests {
+		if got := tt.hasher.NeedsRehash(tt.hash); got != tt.want {
+			t.Fatalf("%s: NeedsRehash = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// mustHash hashes a password with the configuration or fails the test.
+func mustHash(t *testing.T, cfg config.PasswordHashingConfig, password string) string {
+	t.Helper()
+	hash, err := newTestHasher(t, cfg).Hash(password)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	return hash
+}
+
+// TestAuthenticateRehashesLegacyHash tests that logging in with a legacy bcrypt hash stores an Argon2id hash
+// of the same password, and that a failed login leaves the stored hash alone.
+func TestAuthenticateRehashesLegacyHash(t *testing.T) {
+	store := newTestStore(t)
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+	if err := store.CreateOperator(&data.Operator{Username: "alice", PasswordHash: string(legacy), Role: "operator", Provider: "local"}); err != nil {
+		t.Fatalf("CreateOperator: %v", err)
+	}
+	operators := NewOperatorService(store, NewPasswordPolicy(config.PasswordPolicyConfig{}), newTestHasher(t, testArgon2id))
+
+	if _, err := operators.Authenticate(context.Background(), "alice", "wrong", "127.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	operator, err := store.GetOperator("alice")
+	if err != nil {
+		t.Fatalf("GetOperator: %v", err)
+	}
+	if operator.PasswordHash != string(legacy) {
+		t.Fatalf("failed login rewrote the stored hash")
+	}
+
+	if _, err := operators.Authenticate(context.Background(), "alice", "password", "127.0.0.1"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	operator, err = store.GetOperator("alice")
+	if err != nil {
+		t.Fatalf("GetOperator: %v", err)
+	}
+	if !strings.HasPrefix(operator.PasswordHash, "$argon2id$") {
+		t.Fatalf("stored hash not upgraded to argon2id: %q", operator.PasswordHash)
+	}
+	if err := VerifyPassword("password", operator.PasswordHash); err != nil {
+		t.Fatalf("upgraded hash does not verify the password: %v", err)
+	}
+
+	// The upgraded hash keeps working and isn't rewritten again
+	upgraded := operator.PasswordHash
+	if _, err := operators.Authenticate(context.Background(), "alice", "password", "127.0.0.1"); err != nil {
+		t.Fatalf("Authenticate with the upgraded hash: %v", err)
+	}
+	operator, err = store.GetOperator("alice")
+	if err != nil {
+		t.Fatalf("GetOperator: %v", err)
+	}
+	if operator.PasswordHash != upgraded {
+		t.Fatalf("hash rewritten although it already matched the configuration")
+	}
+}
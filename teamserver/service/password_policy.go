@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+	"unicode"
+
+	"simplec2/pkg/config"
+)
+
+// maxPasswordBytes is the longest password bcrypt can hash.
+const maxPasswordBytes = 72
+
+// PasswordPolicy decides whether a new password for a local account is acceptable.
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	HistorySize   int // Number of previous passwords that may not be reused
+}
+
+// NewPasswordPolicy creates a policy from the configuration, filling in defaults.
+func NewPasswordPolicy(cfg config.PasswordPolicyConfig) *PasswordPolicy {
+	policy := &PasswordPolicy{
+		MinLength:     cfg.MinLength,
+		RequireUpper:  cfg.RequireUpper,
+		RequireLower:  cfg.RequireLower,
+		RequireDigit:  cfg.RequireDigit,
+		RequireSymbol: cfg.RequireSymbol,
+		HistorySize:   cfg.HistorySize,
+	}
+	if policy.MinLength <= 0 {
+		policy.MinLength = 12
+	}
+	if policy.HistorySize == 0 {
+		policy.HistorySize = 5
+	} else if policy.HistorySize < 0 {
+		policy.HistorySize = 0
+	}
+	return policy
+}
+
+// Validate checks the length and complexity rules.
+func (p *PasswordPolicy) Validate(password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	switch {
+	case p.RequireUpper && !upper:
+		return fmt.Errorf("password must contain an uppercase letter")
+	case p.RequireLower && !lower:
+		return fmt.Errorf("password must contain a lowercase letter")
+	case p.RequireDigit && !digit:
+		return fmt.Errorf("password must contain a digit")
+	case p.RequireSymbol && !symbol:
+		return fmt.Errorf("password must contain a symbol")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/dnscanary"
+)
+
+const (
+	// detonationDedupWindow is how long repeated queries for a name count as one detonation:
+	// resolvers ask for A and AAAA, retry, and forward the query to each other.
+	detonationDedupWindow = 10 * time.Minute
+	// maxDetonations bounds the detonations returned for a payload.
+	maxDetonations = 1000
+)
+
+// canaryEncoding encodes canary subdomain labels, in lower case as DNS names are compared.
+var canaryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// newCanarySubdomain returns a random subdomain of the canary domain for a payload.
+func newCanarySubdomain(domain string) (string, error) {
+	token := make([]byte, 10)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return canaryEncoding.EncodeToString(token) + "." + strings.ToLower(strings.Trim(domain, ".")), nil
+}
+
+// DetonationService defines the interface for the detonations of payloads built with a DNS canary,
+// reported by the DNS queries for their canary subdomain.
+type DetonationService interface {
+	// RecordQuery records a DNS query for a canary subdomain as a detonation of its payload and
+	// broadcasts PAYLOAD_DETONATED.
+	RecordQuery(query dnscanary.Query)
+
+	// ListDetonations returns the detonations of a payload since a point in time, newest first.
+	ListDetonations(ctx context.Context, payloadID string, since time.Time, limit int) ([]data.PayloadDetonation, error)
+}
+
+// detonationService implements the DetonationService interface.
+type detonationService struct {
+	store     data.DataStore
+	payloads  PayloadService
+	broadcast func(engagement string, data []byte)
+
+	mu   sync.Mutex
+	seen map[string]time.Time // Names recorded within detonationDedupWindow
+}
+
+// NewDetonationService creates a new instance of detonationService.
+func NewDetonationService(store data.DataStore, payloads PayloadService, broadcast func(engagement string, data []byte)) DetonationService {
+	return &detonationService{store: store, payloads: payloads, broadcast: broadcast, seen: make(map[string]time.Time)}
+}
+
+// RecordQuery records the first query for a name within detonationDedupWindow as a detonation.
+func (s *detonationService) RecordQuery(query dnscanary.Query) {
+	if !s.firstSeen(query.Name) {
+		return
+	}
+	payload, err := s.store.GetPayloadByCanaryDomain(query.Subdomain)
+	if err != nil {
+		logger.Debugf("DNS canary query for unknown subdomain %s from %s", query.Name, query.Resolver)
+		return
+	}
+
+	detonation := &data.PayloadDetonation{
+		CreatedAt:  time.Now(),
+		PayloadID:  payload.PayloadID,
+		QueryName:  query.Name,
+		QueryType:  query.Type,
+		Resolver:   query.Resolver,
+		Engagement: payload.Engagement,
+	}
+	if err := s.store.RecordPayloadDetonation(detonation); err != nil {
+		logger.Errorf("Failed to record detonation of payload %s: %v", payload.PayloadID, err)
+		return
+	}
+	logger.Infof("Payload %s (%s) detonated, DNS canary resolved through %s", payload.PayloadID, payload.FileName, query.Resolver)
+
+	if s.broadcast == nil {
+		return
+	}
+	if updated, err := s.store.GetPayload(payload.PayloadID); err == nil {
+		payload = updated
+	}
+	event, err := json.Marshal(map[string]interface{}{
+		"type": "PAYLOAD_DETONATED",
+		"payload": map[string]interface{}{
+			"payload":    payload,
+			"detonation": detonation,
+		},
+	})
+	if err != nil {
+		logger.Errorf("Error marshalling PAYLOAD_DETONATED event: %v", err)
+		return
+	}
+	s.broadcast(payload.Engagement, event)
+}
+
+// firstSeen reports whether name wasn't recorded within detonationDedupWindow, and remembers it.
+func (s *detonationService) firstSeen(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if at, ok := s.seen[name]; ok && now.Sub(at) < detonationDedupWindow {
+		return false
+	}
+	for seenName, at := range s.seen {
+		if now.Sub(at) >= detonationDedupWindow {
+			delete(s.seen, seenName)
+		}
+	}
+	s.seen[name] = now
+	return true
+}
+
+// ListDetonations returns the detonations of a payload in the caller's engagement.
+func (s *detonationService) ListDetonations(ctx context.Context, payloadID string, since time.Time, limit int) ([]data.PayloadDetonation, error) {
+	if _, err := s.payloads.GetPayload(ctx, payloadID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxDetonations {
+		limit = maxDetonations
+	}
+	detonations, err := s.store.GetPayloadDetonations(payloadID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payload detonations: %w", err)
+	}
+	return detonations, nil
+}
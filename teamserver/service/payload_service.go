@@ -0,0 +1,489 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/builder"
+	"simplec2/teamserver/data"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// buildTimeout bounds how long a single payload build may run.
+const buildTimeout = 10 * time.Minute
+
+// ErrPayloadBurned is returned when a burned payload, or a stage-once payload staged before, tries to stage.
+var ErrPayloadBurned = errors.New("payload is burned")
+
+// PayloadRequest describes a payload to be built.
+// When Profile is set, empty fields are filled in from the named build profile.
+type PayloadRequest struct {
+	Profile     string
+	Listener    string
+	Transport   string
+	OS          string
+	Arch        string
+	Format      string
+	CallbackURL string
+	Sleep       int
+	Jitter      int
+	KillDate    *time.Time
+	UseDocker   bool
+	Obfuscate   bool
+	Verbose     bool
+	ExportName  string
+	ServiceName string
+
+	GuardHostnames []string
+	GuardNetworks  []string
+
+	DNSCanary bool // Embed a DNS canary subdomain reporting the payload's detonations
+	StageOnce bool // Only a single beacon may stage from the payload
+}
+
+// PayloadService defines the interface for payload build business logic.
+type PayloadService interface {
+	// CreatePayload validates the request and records a new payload in "building" state.
+	CreatePayload(ctx context.Context, req *PayloadRequest) (*data.Payload, error)
+
+	// BuildPayload compiles a previously created payload and records the result.
+	BuildPayload(ctx context.Context, payloadID string, useDocker bool) (*data.Payload, error)
+
+	// GetPayload retrieves a payload by its ID.
+	GetPayload(ctx context.Context, payloadID string) (*data.Payload, error)
+
+	// ListPayloads retrieves all payloads.
+	ListPayloads(ctx context.Context, page int, limit int) ([]data.Payload, int64, error)
+
+	// ListProfiles retrieves all build profiles.
+	ListProfiles(ctx context.Context, page int, limit int) ([]data.BuildProfile, int64, error)
+
+	// GetProfile retrieves a build profile by its name.
+	GetProfile(ctx context.Context, name string) (*data.BuildProfile, error)
+
+	// CreateProfile creates a new build profile.
+	CreateProfile(ctx context.Context, profile *data.BuildProfile) error
+
+	// UpdateProfile replaces the options of an existing build profile.
+	UpdateProfile(ctx context.Context, name string, profile *data.BuildProfile) (*data.BuildProfile, error)
+
+	// DeleteProfile deletes a build profile.
+	DeleteProfile(ctx context.Context, name string) error
+
+	// StagePayload counts the staging of a beacon presenting a build token and returns the payload,
+	// or nil for beacons without one. A payload that can't stage is returned with ErrPayloadBurned.
+	StagePayload(ctx context.Context, buildToken string) (*data.Payload, error)
+
+	// BurnPayload marks a payload as burned, e.g. after it leaked, so it can't stage anymore.
+	BurnPayload(ctx context.Context, payloadID string, reason string) (*data.Payload, error)
+
+	// ListBurnedPayloads retrieves the burned payloads.
+	ListBurnedPayloads(ctx context.Context) ([]data.Payload, error)
+}
+
+// payloadService implements the PayloadService interface.
+type payloadService struct {
+	store        data.DataStore
+	builder      *builder.Builder
+	artifacts    ArtifactService
+	canaryDomain string
+}
+
+// NewPayloadService creates a new instance of payloadService. Payloads get DNS canary subdomains of
+// canaryDomain; they can't have one if it is empty.
+func NewPayloadService(store data.DataStore, b *builder.Builder, artifacts ArtifactService, canaryDomain string) PayloadService {
+	return &payloadService{
+		store:        store,
+		builder:      b,
+		artifacts:    artifacts,
+		canaryDomain: canaryDomain,
+	}
+}
+
+// listenerBuildConfig is the part of a listener's config the builder needs.
+type listenerBuildConfig struct {
+	Port        string `json:"port"`
+	PublicKey   string `json:"public_key"`
+	CallbackURL string `json:"callback_url"`
+}
+
+func (s *payloadService) getListenerBuildConfig(ctx context.Context, name string) (*listenerBuildConfig, error) {
+	listener, err := getListener(ctx, s.store, name)
+	if err != nil {
+		return nil, fmt.Errorf("listener not found: %w", err)
+	}
+
+	var cfg listenerBuildConfig
+	if listener.Config != "" {
+		if err := json.Unmarshal([]byte(listener.Config), &cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse listener config: %w", err)
+		}
+	}
+	if cfg.PublicKey == "" {
+		return nil, fmt.Errorf("listener '%s' has not reported its public key yet", name)
+	}
+	return &cfg, nil
+}
+
+// applyProfile fills the empty fields of a request from a build profile.
+func applyProfile(req *PayloadRequest, profile *data.BuildProfile) {
+	setDefault := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	setDefault(&req.Listener, profile.Listener)
+	setDefault(&req.Transport, profile.Transport)
+	setDefault(&req.OS, profile.OS)
+	setDefault(&req.Arch, profile.Arch)
+	setDefault(&req.Format, profile.Format)
+	setDefault(&req.CallbackURL, profile.CallbackURL)
+	setDefault(&req.ExportName, profile.ExportName)
+	setDefault(&req.ServiceName, profile.ServiceName)
+	if req.Sleep == 0 {
+		req.Sleep = profile.Sleep
+	}
+	if req.Jitter == 0 {
+		req.Jitter = profile.Jitter
+	}
+	if req.KillDate == nil {
+		req.KillDate = profile.KillDate
+	}
+	req.Obfuscate = req.Obfuscate || profile.Obfuscate
+	req.UseDocker = req.UseDocker || profile.UseDocker
+	if len(req.GuardHostnames) == 0 {
+		req.GuardHostnames = splitList(profile.GuardHosts)
+	}
+	if len(req.GuardNetworks) == 0 {
+		req.GuardNetworks = splitList(profile.GuardNets)
+	}
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// CreatePayload validates the request and records a new payload in "building" state.
+func (s *payloadService) CreatePayload(ctx context.Context, req *PayloadRequest) (*data.Payload, error) {
+	if req.Profile != "" {
+		profile, err := s.store.GetBuildProfile(req.Profile)
+		if err != nil {
+			return nil, fmt.Errorf("build profile not found: %w", err)
+		}
+		applyProfile(req, profile)
+	}
+	if req.Listener == "" {
+		return nil, fmt.Errorf("listener is required")
+	}
+	if req.Transport == "" {
+		req.Transport = "http"
+	}
+	if req.Format == "" {
+		req.Format = "exe"
+	}
+
+	listenerCfg, err := s.getListenerBuildConfig(ctx, req.Listener)
+	if err != nil {
+		return nil, err
+	}
+	if req.CallbackURL == "" {
+		req.CallbackURL = listenerCfg.CallbackURL
+	}
+
+	opts := builder.Options{
+		OS:           req.OS,
+		Arch:         req.Arch,
+		Transport:    req.Transport,
+		Format:       req.Format,
+		CallbackURL:  req.CallbackURL,
+		PublicKeyPEM: listenerCfg.PublicKey,
+		Sleep:        req.Sleep,
+		Jitter:       req.Jitter,
+		KillDate:     req.KillDate,
+		UseDocker:    req.UseDocker,
+		Obfuscate:    req.Obfuscate,
+		Verbose:      req.Verbose,
+		ExportName:   req.ExportName,
+		ServiceName:  req.ServiceName,
+
+		GuardHostnames: req.GuardHostnames,
+		GuardNetworks:  req.GuardNetworks,
+	}
+	if req.DNSCanary {
+		if s.canaryDomain == "" {
+			return nil, fmt.Errorf("DNS canaries are not configured (dns_canary.domain)")
+		}
+		subdomain, err := newCanarySubdomain(s.canaryDomain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate canary subdomain: %w", err)
+		}
+		opts.CanaryDomain = subdomain
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("failed to generate build token: %w", err)
+	}
+	opts.BuildToken = hex.EncodeToString(token)
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid payload options: %w", err)
+	}
+
+	payload := &data.Payload{
+		PayloadID:   uuid.New().String(),
+		Profile:     req.Profile,
+		Listener:    req.Listener,
+		Transport:   req.Transport,
+		OS:          req.OS,
+		Arch:        req.Arch,
+		Format:      req.Format,
+		Obfuscated:  req.Obfuscate,
+		Verbose:     req.Verbose,
+		ExportName:  req.ExportName,
+		ServiceName: req.ServiceName,
+		GuardHosts:  strings.Join(req.GuardHostnames, ","),
+		GuardNets:   strings.Join(req.GuardNetworks, ","),
+		Sleep:       req.Sleep,
+		Jitter:      req.Jitter,
+		KillDate:    req.KillDate,
+		CallbackURL: req.CallbackURL,
+		Status:      "building",
+		Engagement:  engagementForNew(ctx),
+
+		CanaryDomain: opts.CanaryDomain,
+		BuildToken:   opts.BuildToken,
+		StageOnce:    req.StageOnce,
+	}
+	if err := s.store.CreatePayload(payload); err != nil {
+		return nil, fmt.Errorf("failed to create payload: %w", err)
+	}
+	return payload, nil
+}
+
+// BuildPayload compiles a previously created payload and records the result.
+func (s *payloadService) BuildPayload(ctx context.Context, payloadID string, useDocker bool) (*data.Payload, error) {
+	payload, err := s.store.GetPayload(payloadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payload: %w", err)
+	}
+
+	listenerCfg, err := s.getListenerBuildConfig(ctx, payload.Listener)
+	if err != nil {
+		return s.failPayload(payload, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, buildTimeout)
+	defer cancel()
+
+	result, err := s.builder.Build(ctx, payload.PayloadID, builder.Options{
+		OS:           payload.OS,
+		Arch:         payload.Arch,
+		Transport:    payload.Transport,
+		Format:       payload.Format,
+		CallbackURL:  payload.CallbackURL,
+		PublicKeyPEM: listenerCfg.PublicKey,
+		Sleep:        payload.Sleep,
+		Jitter:       payload.Jitter,
+		KillDate:     payload.KillDate,
+		UseDocker:    useDocker,
+		Obfuscate:    payload.Obfuscated,
+		Verbose:      payload.Verbose,
+		ExportName:   payload.ExportName,
+		ServiceName:  payload.ServiceName,
+
+		GuardHostnames: splitList(payload.GuardHosts),
+		GuardNetworks:  splitList(payload.GuardNets),
+
+		CanaryDomain: payload.CanaryDomain,
+		BuildToken:   payload.BuildToken,
+	})
+	if err != nil {
+		return s.failPayload(payload, err)
+	}
+
+	payload.Status = "completed"
+	payload.FileName = result.FileName
+	payload.FilePath = result.Path
+	payload.Size = result.Size
+	payload.SHA256 = result.SHA256
+	if err := s.store.UpdatePayload(payload); err != nil {
+		return nil, fmt.Errorf("failed to update payload: %w", err)
+	}
+
+	artifact := &data.Artifact{
+		Type:       "payload",
+		PayloadID:  payload.PayloadID,
+		FileName:   payload.FileName,
+		Engagement: payload.Engagement,
+	}
+	if err := s.artifacts.RecordArtifact(ctx, artifact, payload.FilePath); err != nil {
+		// The build itself succeeded; a missing manifest entry should not fail it
+		logger.Ctx(ctx).Errorf("Failed to record artifact for payload %s: %v", payload.PayloadID, err)
+	}
+	return payload, nil
+}
+
+// failPayload marks a payload as failed and returns the build error.
+func (s *payloadService) failPayload(payload *data.Payload, buildErr error) (*data.Payload, error) {
+	payload.Status = "failed"
+	payload.Error = buildErr.Error()
+	if err := s.store.UpdatePayload(payload); err != nil {
+		return nil, fmt.Errorf("failed to update payload: %w", err)
+	}
+	return payload, fmt.Errorf("failed to build payload: %w", buildErr)
+}
+
+// GetPayload retrieves a payload by its ID.
+func (s *payloadService) GetPayload(ctx context.Context, payloadID string) (*data.Payload, error) {
+	payload, err := s.store.GetPayload(payloadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payload: %w", err)
+	}
+	if !inEngagement(ctx, payload.Engagement) {
+		return nil, fmt.Errorf("failed to get payload: %w", gorm.ErrRecordNotFound)
+	}
+	return payload, nil
+}
+
+// ListPayloads retrieves all payloads.
+func (s *payloadService) ListPayloads(ctx context.Context, page int, limit int) ([]data.Payload, int64, error) {
+	payloads, total, err := s.store.GetPayloads(EngagementFromContext(ctx), page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list payloads: %w", err)
+	}
+	return payloads, total, nil
+}
+
+// StagePayload counts the staging of a beacon built as a payload. A stage-once payload staged again
+// is burned; the staging of burned payloads is refused.
+func (s *payloadService) StagePayload(ctx context.Context, buildToken string) (*data.Payload, error) {
+	if buildToken == "" {
+		return nil, nil
+	}
+	payload, err := s.store.GetPayloadByBuildToken(buildToken)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Built by another TeamServer, or the token was tampered with
+			logger.Ctx(ctx).Warnf("Beacon staging with unknown build token")
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get payload: %w", err)
+	}
+
+	now := time.Now()
+	allowed, err := s.store.ClaimPayloadStage(payload.PayloadID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record payload staging: %w", err)
+	}
+	if !allowed {
+		if err := s.store.RejectPayloadStage(payload.PayloadID, "one-time staging token reused", now); err != nil {
+			return nil, fmt.Errorf("failed to record refused payload staging: %w", err)
+		}
+	}
+	if updated, err := s.store.GetPayload(payload.PayloadID); err == nil {
+		payload = updated
+	}
+	if !allowed {
+		return payload, ErrPayloadBurned
+	}
+	return payload, nil
+}
+
+// BurnPayload marks a payload as burned, so it can't stage anymore.
+func (s *payloadService) BurnPayload(ctx context.Context, payloadID string, reason string) (*data.Payload, error) {
+	if _, err := s.GetPayload(ctx, payloadID); err != nil {
+		return nil, err
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		reason = "burned by an operator"
+	}
+	if err := s.store.BurnPayload(payloadID, reason, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to burn payload: %w", err)
+	}
+	return s.GetPayload(ctx, payloadID)
+}
+
+// ListBurnedPayloads retrieves the burned payloads.
+func (s *payloadService) ListBurnedPayloads(ctx context.Context) ([]data.Payload, error) {
+	payloads, err := s.store.GetBurnedPayloads(EngagementFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list burned payloads: %w", err)
+	}
+	return payloads, nil
+}
+
+// ListProfiles retrieves all build profiles.
+func (s *payloadService) ListProfiles(ctx context.Context, page int, limit int) ([]data.BuildProfile, int64, error) {
+	profiles, total, err := s.store.GetBuildProfiles(page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list build profiles: %w", err)
+	}
+	return profiles, total, nil
+}
+
+// GetProfile retrieves a build profile by its name.
+func (s *payloadService) GetProfile(ctx context.Context, name string) (*data.BuildProfile, error) {
+	profile, err := s.store.GetBuildProfile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get build profile: %w", err)
+	}
+	return profile, nil
+}
+
+// CreateProfile creates a new build profile.
+func (s *payloadService) CreateProfile(ctx context.Context, profile *data.BuildProfile) error {
+	if profile.Name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	if _, err := s.store.GetBuildProfile(profile.Name); err == nil {
+		return fmt.Errorf("build profile with name '%s' already exists", profile.Name)
+	}
+
+	if err := s.store.CreateBuildProfile(profile); err != nil {
+		return fmt.Errorf("failed to create build profile: %w", err)
+	}
+	return nil
+}
+
+// UpdateProfile replaces the options of an existing build profile.
+func (s *payloadService) UpdateProfile(ctx context.Context, name string, profile *data.BuildProfile) (*data.BuildProfile, error) {
+	existing, err := s.store.GetBuildProfile(name)
+	if err != nil {
+		return nil, fmt.Errorf("build profile not found: %w", err)
+	}
+
+	// Keep identity, replace everything else
+	profile.Model = existing.Model
+	profile.Name = existing.Name
+	if err := s.store.UpdateBuildProfile(profile); err != nil {
+		return nil, fmt.Errorf("failed to update build profile: %w", err)
+	}
+	return profile, nil
+}
+
+// DeleteProfile deletes a build profile.
+func (s *payloadService) DeleteProfile(ctx context.Context, name string) error {
+	if _, err := s.store.GetBuildProfile(name); err != nil {
+		return fmt.Errorf("build profile not found: %w", err)
+	}
+	if err := s.store.DeleteBuildProfile(name); err != nil {
+		return fmt.Errorf("failed to delete build profile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,596 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/pkg/pki"
+	"simplec2/teamserver/data"
+)
+
+// DefaultRotationGrace is how long both CAs are trusted during a rotation when no grace period is given.
+const DefaultRotationGrace = 7 * 24 * time.Hour
+
+// ErrRotationInProgress is returned when a CA rotation is started while another one is not finished.
+var ErrRotationInProgress = errors.New("a CA rotation is already in progress")
+
+// ErrNoRotation is returned when retiring the CA without a rotation in progress.
+var ErrNoRotation = errors.New("no CA rotation is in progress")
+
+// ErrCAKeyNotFile is returned when rotating a CA whose key is held in a KMS or HSM.
+var ErrCAKeyNotFile = errors.New("CA rotation needs a CA key file; a key in a KMS or HSM is rotated there, then the CA is created with -create-ca")
+
+// ErrCertificatesPending is returned when retiring the old CA while certificates it issued are still in use.
+var ErrCertificatesPending = errors.New("certificates issued by the old CA were not reissued yet")
+
+// CertificateInfo describes a CA or server certificate.
+type CertificateInfo struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	Fingerprint  string    `json:"fingerprint"` // SHA-256
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+}
+
+// CARotation is a CA rotation in progress. Until the old CA is retired, certificates of both CAs
+// are accepted and new certificates are issued by the new CA.
+type CARotation struct {
+	StartedAt  time.Time `json:"started_at"`
+	GraceUntil time.Time `json:"grace_until"` // The old CA is retired automatically after this
+}
+
+// PendingCertificate is a certificate of the old CA whose holder has not been issued a new one yet.
+type PendingCertificate struct {
+	SerialNumber string    `json:"serial_number"`
+	CommonName   string    `json:"common_name"`
+	ListenerName string    `json:"listener_name,omitempty"`
+	Operator     string    `json:"operator,omitempty"`
+	IssuedAt     time.Time `json:"issued_at"`
+}
+
+// CAStatus is the state of the TeamServer PKI.
+type CAStatus struct {
+	CA                CertificateInfo      `json:"ca"`
+	NextCA            *CertificateInfo     `json:"next_ca,omitempty"`
+	Rotation          *CARotation          `json:"rotation,omitempty"`
+	ServerCertificate CertificateInfo      `json:"server_certificate"`
+	Pending           []PendingCertificate `json:"pending"`
+}
+
+// IssuedClientCertificate is a client certificate for a listener or an operator.
+type IssuedClientCertificate struct {
+	Certificate *x509.Certificate
+	CertPEM     []byte
+	KeyPEM      []byte
+	TrustedCAs  []byte // CA bundle the holder verifies the TeamServer with
+}
+
+// PKIService defines the interface for the TeamServer CA: issuing certificates and rotating the CA.
+type PKIService interface {
+	// Status returns the CAs, the rotation in progress and the certificates still to be reissued.
+	Status(ctx context.Context) (*CAStatus, error)
+
+	// StartRotation generates a new CA, cross-signed by the current one, and trusts both for the grace period.
+	StartRotation(ctx context.Context, grace time.Duration) (*CAStatus, error)
+
+	// ReissueServerCertificate issues a new TeamServer certificate from the issuing CA and uses it
+	// for new connections.
+	ReissueServerCertificate(ctx context.Context) (*CertificateInfo, error)
+
+	// RetireCA makes the new CA the only trusted one and revokes the certificates of the old CA.
+	// Unless force is set, it fails with ErrCertificatesPending while some were not reissued.
+	RetireCA(ctx context.Context, force bool) (*CAStatus, error)
+
+	// StartRotationRoutine retires the old CA in the background once the grace period is over.
+	StartRotationRoutine(interval time.Duration)
+
+	// IssueClientCertificate issues a client certificate from the issuing CA. IsClient is implied.
+	IssueClientCertificate(cfg pki.CertConfig) (*IssuedClientCertificate, error)
+
+	// CACertificate returns the current CA certificate, PEM encoded. It signs the CRL.
+	CACertificate() []byte
+
+	// CurrentCA returns the current CA certificate, PEM encoded, and its key.
+	CurrentCA() ([]byte, crypto.Signer)
+
+	// TrustedCAs returns the certificates of the trusted CAs, PEM encoded.
+	TrustedCAs() []byte
+
+	// ClientCAs returns the pool client certificates are verified against.
+	ClientCAs() *x509.CertPool
+
+	// ServerCertificate returns the TeamServer certificate with the chain to present.
+	ServerCertificate() *tls.Certificate
+}
+
+// pkiService implements the PKIService interface. The rotation state is kept in files next to the
+// CA, so it survives restarts:
+//
+//	ca.next.crt, ca.next.key  the new CA
+//	ca.cross.crt              the new CA signed by the current one
+//	ca.rotation.json          the CARotation
+type pkiService struct {
+	store          data.DataStore
+	caCertPath     string
+	serverCertPath string
+	serverKeyPath  string
+
+	mu         sync.RWMutex
+	ca         []byte
+	caKey      pki.Signer
+	next       []byte          // Set during a rotation
+	nextKey    *pki.FileSigner // Set during a rotation
+	cross      []byte          // Set during a rotation
+	rotation   *CARotation
+	clientCAs  *x509.CertPool
+	serverCert *tls.Certificate
+}
+
+// NewPKIService creates a new instance of pkiService and loads the CA, a rotation in progress and
+// the TeamServer certificate. caKey is the key of the CA, see keystore.Open.
+func NewPKIService(store data.DataStore, caKey pki.Signer, caCertPath, serverCertPath, serverKeyPath string) (PKIService, error) {
+	s := &pkiService{
+		store:          store,
+		caKey:          caKey,
+		caCertPath:     caCertPath,
+		serverCertPath: serverCertPath,
+		serverKeyPath:  serverKeyPath,
+	}
+
+	ca, err := os.ReadFile(caCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	s.ca = ca
+
+	stateData, err := os.ReadFile(s.path("ca.rotation.json"))
+	if err == nil {
+		var rotation CARotation
+		if err := json.Unmarshal(stateData, &rotation); err != nil {
+			return nil, fmt.Errorf("failed to parse CA rotation state: %w", err)
+		}
+		if s.next, err = os.ReadFile(s.path("ca.next.crt")); err != nil {
+			return nil, fmt.Errorf("failed to read new CA certificate: %w", err)
+		}
+		if s.nextKey, err = pki.LoadFileSigner(s.path("ca.next.key")); err != nil {
+			return nil, fmt.Errorf("failed to load new CA key: %w", err)
+		}
+		if s.cross, err = os.ReadFile(s.path("ca.cross.crt")); err != nil {
+			return nil, fmt.Errorf("failed to read cross-signed CA certificate: %w", err)
+		}
+		s.rotation = &rotation
+		logger.Infof("CA rotation in progress since %s, the old CA is retired after %s", rotation.StartedAt.Format(time.RFC3339), rotation.GraceUntil.Format(time.RFC3339))
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read CA rotation state: %w", err)
+	}
+
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// path returns the path of a file next to the CA.
+func (s *pkiService) path(name string) string {
+	return filepath.Join(filepath.Dir(s.caCertPath), name)
+}
+
+// load builds the trusted CAs and the server certificate chain from the CA state. Called with mu
+// held, or before the service is shared (as is reload).
+func (s *pkiService) load(serverCertPEM, serverKeyPEM []byte) error {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(s.ca) {
+		return fmt.Errorf("failed to append CA cert")
+	}
+	if s.next != nil && !pool.AppendCertsFromPEM(s.next) {
+		return fmt.Errorf("failed to append new CA cert")
+	}
+
+	serverCert, err := tls.X509KeyPair(serverCertPEM, serverKeyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	// Listeners that only trust the old CA verify a certificate of the new one through the cross-signed CA
+	if s.cross != nil {
+		leaf, err := x509.ParseCertificate(serverCert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("failed to parse server certificate: %w", err)
+		}
+		if next, err := pki.ParseCertificate(s.next); err == nil && leaf.CheckSignatureFrom(next) == nil {
+			block, _ := pem.Decode(s.cross)
+			serverCert.Certificate = append(serverCert.Certificate, block.Bytes)
+		}
+	}
+
+	s.clientCAs = pool
+	s.serverCert = &serverCert
+	return nil
+}
+
+// issuingCA returns the CA new certificates are issued by: the new one during a rotation. Called
+// with mu held.
+func (s *pkiService) issuingCA() ([]byte, crypto.Signer) {
+	if s.rotation != nil {
+		return s.next, s.nextKey
+	}
+	return s.ca, s.caKey
+}
+
+// Status returns the state of the TeamServer PKI.
+func (s *pkiService) Status(ctx context.Context) (*CAStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status()
+}
+
+// status builds the CAStatus. Called with mu held.
+func (s *pkiService) status() (*CAStatus, error) {
+	ca, err := pki.ParseCertificate(s.ca)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(s.serverCert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server certificate: %w", err)
+	}
+	status := &CAStatus{
+		CA:                certificateInfo(ca),
+		ServerCertificate: certificateInfo(leaf),
+		Pending:           []PendingCertificate{},
+	}
+	if s.rotation == nil {
+		return status, nil
+	}
+
+	next, err := pki.ParseCertificate(s.next)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse new CA certificate: %w", err)
+	}
+	nextInfo := certificateInfo(next)
+	rotation := *s.rotation
+	status.NextCA, status.Rotation = &nextInfo, &rotation
+	if status.Pending, err = s.pending(); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// pending lists the certificates issued before the rotation started whose listener or operator
+// has no newer certificate. Called with mu held.
+func (s *pkiService) pending() ([]PendingCertificate, error) {
+	certs, err := s.store.GetActiveCertificates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certificates: %w", err)
+	}
+	holder := func(cert data.IssuedCertificate) string {
+		switch {
+		case cert.ListenerName != "":
+			return "listener:" + cert.ListenerName
+		case cert.Operator != "":
+			return "operator:" + cert.Operator
+		}
+		return "serial:" + cert.SerialNumber
+	}
+	reissued := make(map[string]bool)
+	for _, cert := range certs {
+		if !cert.CreatedAt.Before(s.rotation.StartedAt) {
+			reissued[holder(cert)] = true
+		}
+	}
+
+	pending := []PendingCertificate{}
+	for _, cert := range certs {
+		if cert.CreatedAt.Before(s.rotation.StartedAt) && !reissued[holder(cert)] {
+			pending = append(pending, PendingCertificate{
+				SerialNumber: cert.SerialNumber,
+				CommonName:   cert.CommonName,
+				ListenerName: cert.ListenerName,
+				Operator:     cert.Operator,
+				IssuedAt:     cert.CreatedAt,
+			})
+		}
+	}
+	return pending, nil
+}
+
+// StartRotation generates the new CA and cross-signs it with the current one.
+func (s *pkiService) StartRotation(ctx context.Context, grace time.Duration) (*CAStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rotation != nil {
+		return nil, ErrRotationInProgress
+	}
+	// The new CA's key is written next to the current one
+	if _, ok := s.caKey.(*pki.FileSigner); !ok {
+		return nil, ErrCAKeyNotFile
+	}
+
+	now := time.Now()
+	// A distinct name, so certificates of both CAs are told apart while both are trusted
+	nextKey, next, err := pki.GenerateCert(pki.CertConfig{
+		CommonName: "SimpleC2 CA " + now.UTC().Format("2006-01-02 15:04:05"),
+		IsCA:       true,
+	}, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA: %w", err)
+	}
+	cross, err := pki.CrossSign(s.ca, s.caKey, next)
+	if err != nil {
+		return nil, err
+	}
+	nextSigner, err := pki.ParsePrivateKey(nextKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse new CA key: %w", err)
+	}
+	rotation := &CARotation{StartedAt: now, GraceUntil: now.Add(grace)}
+	stateData, err := json.MarshalIndent(rotation, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal CA rotation state: %w", err)
+	}
+
+	// The state file is written last: without it, the other files are ignored and overwritten
+	for _, file := range []struct {
+		name string
+		data []byte
+		perm os.FileMode
+	}{
+		{"ca.next.key", nextKey, 0600},
+		{"ca.next.crt", next, 0644},
+		{"ca.cross.crt", cross, 0644},
+		{"ca.rotation.json", stateData, 0644},
+	} {
+		if err := writeFileAtomic(s.path(file.name), file.data, file.perm); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+
+	s.next, s.nextKey, s.cross, s.rotation = next, &pki.FileSigner{Signer: nextSigner, Path: s.path("ca.next.key")}, cross, rotation
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	logger.Ctx(ctx).Infof("Started CA rotation, the old CA is retired after %s", rotation.GraceUntil.Format(time.RFC3339))
+	return s.status()
+}
+
+// reload rebuilds the trusted CAs and the server certificate chain from disk. Called with mu held.
+func (s *pkiService) reload() error {
+	serverCertPEM, err := os.ReadFile(s.serverCertPath)
+	if err != nil {
+		return fmt.Errorf("failed to read server certificate: %w", err)
+	}
+	serverKeyPEM, err := os.ReadFile(s.serverKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read server key: %w", err)
+	}
+	return s.load(serverCertPEM, serverKeyPEM)
+}
+
+// ReissueServerCertificate issues a new TeamServer certificate with the names of the current one.
+func (s *pkiService) ReissueServerCertificate(ctx context.Context) (*CertificateInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := s.reissueServerCertificate()
+	if err != nil {
+		return nil, err
+	}
+	logger.Ctx(ctx).Infof("Reissued the TeamServer certificate, serial %s issued by '%s'", info.SerialNumber, info.Issuer)
+	return info, nil
+}
+
+// reissueServerCertificate issues and installs a new server certificate. Called with mu held.
+func (s *pkiService) reissueServerCertificate() (*CertificateInfo, error) {
+	current, err := x509.ParseCertificate(s.serverCert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server certificate: %w", err)
+	}
+	caCertPEM, caKey := s.issuingCA()
+	keyPEM, certPEM, err := pki.IssueCert(pki.CertConfig{
+		CommonName: current.Subject.CommonName,
+		IsServer:   true,
+		DNSNames:   current.DNSNames,
+		IPs:        current.IPAddresses,
+	}, caCertPEM, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate server certificate: %w", err)
+	}
+
+	if err := writeFileAtomic(s.serverKeyPath, keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write server key: %w", err)
+	}
+	if err := writeFileAtomic(s.serverCertPath, certPEM, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write server certificate: %w", err)
+	}
+	if err := s.load(certPEM, keyPEM); err != nil {
+		return nil, err
+	}
+	cert, err := pki.ParseCertificate(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server certificate: %w", err)
+	}
+	info := certificateInfo(cert)
+	return &info, nil
+}
+
+// RetireCA replaces the current CA with the new one.
+func (s *pkiService) RetireCA(ctx context.Context, force bool) (*CAStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rotation == nil {
+		return nil, ErrNoRotation
+	}
+	pending, err := s.pending()
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) > 0 && !force {
+		return nil, fmt.Errorf("%w: %d certificates", ErrCertificatesPending, len(pending))
+	}
+
+	// The TeamServer certificate must be issued by the CA that stays
+	next, err := pki.ParseCertificate(s.next)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse new CA certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(s.serverCert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server certificate: %w", err)
+	}
+	if leaf.CheckSignatureFrom(next) != nil {
+		if _, err := s.reissueServerCertificate(); err != nil {
+			return nil, err
+		}
+	}
+
+	// The old CA is kept, renamed, rather than deleted
+	caKeyFile, ok := s.caKey.(*pki.FileSigner)
+	if !ok {
+		return nil, ErrCAKeyNotFile
+	}
+	caKeyPath := caKeyFile.Path
+	suffix := fmt.Sprintf("retired-%d", time.Now().Unix())
+	for _, move := range [][2]string{
+		{s.caCertPath, s.path("ca." + suffix + ".crt")},
+		{caKeyPath, s.path("ca." + suffix + ".key")},
+		{s.path("ca.next.crt"), s.caCertPath},
+		{s.path("ca.next.key"), caKeyPath},
+	} {
+		if err := os.Rename(move[0], move[1]); err != nil {
+			return nil, fmt.Errorf("failed to replace CA: %w", err)
+		}
+	}
+	for _, name := range []string{"ca.cross.crt", "ca.rotation.json"} {
+		if err := os.Remove(s.path(name)); err != nil && !os.IsNotExist(err) {
+			logger.Ctx(ctx).Warnf("Failed to remove %s: %v", name, err)
+		}
+	}
+
+	startedAt := s.rotation.StartedAt
+	s.ca, s.caKey = s.next, &pki.FileSigner{Signer: s.nextKey.Signer, Path: caKeyPath}
+	s.next, s.nextKey, s.cross, s.rotation = nil, nil, nil, nil
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	// The CRL service notices the new CA and reissues the CRL
+	revoked, err := s.store.RevokeCertificatesIssuedBefore(startedAt)
+	if err != nil {
+		logger.Ctx(ctx).Errorf("Failed to revoke certificates of the retired CA: %v", err)
+	}
+	logger.Ctx(ctx).Infof("Retired the old CA (kept as ca.%s.crt), %d of its certificates revoked", suffix, revoked)
+	return s.status()
+}
+
+// StartRotationRoutine checks periodically whether the grace period of a rotation is over.
+func (s *pkiService) StartRotationRoutine(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.mu.RLock()
+			due := s.rotation != nil && time.Now().After(s.rotation.GraceUntil)
+			s.mu.RUnlock()
+			if !due {
+				continue
+			}
+			logger.Warnf("Grace period of the CA rotation is over, retiring the old CA")
+			if _, err := s.RetireCA(context.Background(), true); err != nil && !errors.Is(err, ErrNoRotation) {
+				logger.Errorf("Failed to retire the old CA: %v", err)
+			}
+		}
+	}()
+}
+
+// IssueClientCertificate issues a client certificate from the issuing CA.
+func (s *pkiService) IssueClientCertificate(cfg pki.CertConfig) (*IssuedClientCertificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	caCertPEM, caKey := s.issuingCA()
+	cfg.IsCA, cfg.IsServer, cfg.IsClient = false, false, true
+	keyPEM, certPEM, err := pki.IssueCert(cfg, caCertPEM, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client certificate: %w", err)
+	}
+	cert, err := pki.ParseCertificate(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generated certificate: %w", err)
+	}
+	return &IssuedClientCertificate{Certificate: cert, CertPEM: certPEM, KeyPEM: keyPEM, TrustedCAs: s.trustedCAs()}, nil
+}
+
+// CACertificate returns the current CA certificate.
+func (s *pkiService) CACertificate() []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ca
+}
+
+// CurrentCA returns the current CA and its key.
+func (s *pkiService) CurrentCA() ([]byte, crypto.Signer) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ca, s.caKey
+}
+
+// TrustedCAs returns the current CA and, during a rotation, the new one.
+func (s *pkiService) TrustedCAs() []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trustedCAs()
+}
+
+// trustedCAs concatenates the trusted CA certificates. Called with mu held.
+func (s *pkiService) trustedCAs() []byte {
+	bundle := append([]byte{}, s.ca...)
+	return append(bundle, s.next...)
+}
+
+// ClientCAs returns the pool of trusted CAs.
+func (s *pkiService) ClientCAs() *x509.CertPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clientCAs
+}
+
+// ServerCertificate returns the TeamServer certificate.
+func (s *pkiService) ServerCertificate() *tls.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.serverCert
+}
+
+// certificateInfo summarizes a certificate.
+func certificateInfo(cert *x509.Certificate) CertificateInfo {
+	return CertificateInfo{
+		Subject:      cert.Subject.CommonName,
+		Issuer:       cert.Issuer.CommonName,
+		SerialNumber: cert.SerialNumber.String(),
+		Fingerprint:  pki.Fingerprint(cert),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+	}
+}
+
+// writeFileAtomic writes a file next to path and renames it, so readers never see a partial file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,447 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"simplec2/teamserver/commands"
+	"simplec2/teamserver/data"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxPlaybookSteps bounds the length of a playbook.
+const maxPlaybookSteps = 50
+
+// playbookTaskSource marks the tasks queued by playbook runs.
+const playbookTaskSource = "playbook:"
+
+// PlaybookContext is the data available to the argument template of a playbook step.
+type PlaybookContext struct {
+	Beacon  *data.Beacon
+	Vars    map[string]string // Given when the run starts
+	Prev    string            // Output of the previous step
+	Outputs []string          // Output of every previous step, by index
+}
+
+// playbookFuncs are the helpers step templates can use to pick values out of earlier output,
+// e.g. {{ first (grep "\\.kdbx$" (lines .Prev)) }} or {{ (first (where "name" "\\.docx$" (fromJSON .Prev))).name }}.
+var playbookFuncs = template.FuncMap{
+	"lines": func(s string) []string {
+		var lines []string
+		for _, line := range strings.Split(s, "\n") {
+			if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	},
+	"grep": func(pattern string, lines []string) ([]string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		var matched []string
+		for _, line := range lines {
+			if re.MatchString(line) {
+				matched = append(matched, line)
+			}
+		}
+		return matched, nil
+	},
+	"match": func(pattern, s string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		m := re.FindStringSubmatch(s)
+		switch {
+		case m == nil:
+			return "", fmt.Errorf("no match for %q", pattern)
+		case len(m) > 1:
+			return m[1], nil
+		default:
+			return m[0], nil
+		}
+	},
+	"fromJSON": func(s string) (interface{}, error) {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return nil, fmt.Errorf("output is not JSON: %w", err)
+		}
+		return v, nil
+	},
+	"where": func(key, pattern string, list []interface{}) ([]interface{}, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		var matched []interface{}
+		for _, item := range list {
+			if obj, ok := item.(map[string]interface{}); ok && re.MatchString(fmt.Sprint(obj[key])) {
+				matched = append(matched, item)
+			}
+		}
+		return matched, nil
+	},
+	"first": func(list interface{}) (interface{}, error) {
+		return sliceItem(list, 0)
+	},
+	"last": func(list interface{}) (interface{}, error) {
+		return sliceItem(list, -1)
+	},
+	"trim":      strings.TrimSpace,
+	"contains":  strings.Contains,
+	"hasPrefix": strings.HasPrefix,
+	"hasSuffix": strings.HasSuffix,
+	"join": func(sep string, list []string) string {
+		return strings.Join(list, sep)
+	},
+}
+
+// sliceItem returns the item at index i of a slice, counting from the end if i is negative.
+// An empty slice is an error, so that a step can't silently run with an empty argument.
+func sliceItem(list interface{}, i int) (interface{}, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("expected a list, got %T", list)
+	}
+	if v.Len() == 0 {
+		return nil, fmt.Errorf("list is empty")
+	}
+	if i < 0 {
+		i += v.Len()
+	}
+	return v.Index(i).Interface(), nil
+}
+
+// PlaybookService defines the interface for playbook business logic.
+type PlaybookService interface {
+	// ListPlaybooks retrieves all playbooks.
+	ListPlaybooks(ctx context.Context, page int, limit int) ([]data.Playbook, int64, error)
+
+	// GetPlaybook retrieves a playbook by its name.
+	GetPlaybook(ctx context.Context, name string) (*data.Playbook, error)
+
+	// CreatePlaybook validates and saves a new playbook.
+	CreatePlaybook(ctx context.Context, playbook *data.Playbook) error
+
+	// UpdatePlaybook replaces the description and steps of a playbook. Running runs keep their steps.
+	UpdatePlaybook(ctx context.Context, name string, description string, steps []data.PlaybookStep) (*data.Playbook, error)
+
+	// DeletePlaybook deletes a playbook.
+	DeletePlaybook(ctx context.Context, name string) error
+
+	// StartRun runs a playbook against a beacon and queues its first step.
+	StartRun(ctx context.Context, name string, beaconID string, vars map[string]string, operator string) (*data.PlaybookRun, *data.Task, error)
+
+	// GetRun retrieves a playbook run by its ID.
+	GetRun(ctx context.Context, runID string) (*data.PlaybookRun, error)
+
+	// ListRuns retrieves playbook runs, optionally only those of one beacon.
+	ListRuns(ctx context.Context, beaconID string, page int, limit int) ([]data.PlaybookRun, int64, error)
+
+	// CancelRun stops a running playbook and cancels its current step if it hasn't been dispatched yet.
+	CancelRun(ctx context.Context, runID string) (*data.PlaybookRun, error)
+
+	// TaskFinished advances the run a finished task belongs to: it queues the next step if the task
+	// completed, or ends the run otherwise. It returns the updated run and the next task, if one was queued;
+	// the run is nil if the task is not the current step of a running playbook.
+	TaskFinished(task *data.Task) (*data.PlaybookRun, *data.Task, error)
+}
+
+// playbookService implements the PlaybookService interface.
+type playbookService struct {
+	store data.DataStore
+}
+
+// NewPlaybookService creates a new instance of playbookService.
+func NewPlaybookService(store data.DataStore) PlaybookService {
+	return &playbookService{store: store}
+}
+
+// validatePlaybookSteps checks that every step uses a known command and a valid argument template.
+func validatePlaybookSteps(steps []data.PlaybookStep) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("a playbook needs at least one step")
+	}
+	if len(steps) > maxPlaybookSteps {
+		return fmt.Errorf("a playbook can have at most %d steps", maxPlaybookSteps)
+	}
+	for i, step := range steps {
+		if _, ok := commands.Get(step.Command); !ok {
+			return fmt.Errorf("step %d: %w", i+1, commands.ErrUnknownCommand(step.Command))
+		}
+		if _, err := template.New("").Funcs(playbookFuncs).Parse(step.Arguments); err != nil {
+			return fmt.Errorf("step %d: invalid arguments template: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// ListPlaybooks retrieves all playbooks.
+func (s *playbookService) ListPlaybooks(ctx context.Context, page int, limit int) ([]data.Playbook, int64, error) {
+	playbooks, total, err := s.store.GetPlaybooks(page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list playbooks: %w", err)
+	}
+	return playbooks, total, nil
+}
+
+// GetPlaybook retrieves a playbook by its name.
+func (s *playbookService) GetPlaybook(ctx context.Context, name string) (*data.Playbook, error) {
+	playbook, err := s.store.GetPlaybook(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get playbook: %w", err)
+	}
+	return playbook, nil
+}
+
+// CreatePlaybook validates and saves a new playbook.
+func (s *playbookService) CreatePlaybook(ctx context.Context, playbook *data.Playbook) error {
+	if playbook.Name == "" {
+		return fmt.Errorf("playbook name is required")
+	}
+	if err := validatePlaybookSteps(playbook.Steps); err != nil {
+		return err
+	}
+	if _, err := s.store.GetPlaybook(playbook.Name); err == nil {
+		return fmt.Errorf("playbook with name '%s' already exists", playbook.Name)
+	}
+
+	if err := s.store.CreatePlaybook(playbook); err != nil {
+		return fmt.Errorf("failed to create playbook: %w", err)
+	}
+	return nil
+}
+
+// UpdatePlaybook replaces the description and steps of a playbook. Running runs keep their steps.
+func (s *playbookService) UpdatePlaybook(ctx context.Context, name string, description string, steps []data.PlaybookStep) (*data.Playbook, error) {
+	playbook, err := s.store.GetPlaybook(name)
+	if err != nil {
+		return nil, fmt.Errorf("playbook not found: %w", err)
+	}
+	if err := validatePlaybookSteps(steps); err != nil {
+		return nil, err
+	}
+
+	playbook.Description = description
+	playbook.Steps = steps
+	if err := s.store.UpdatePlaybook(playbook); err != nil {
+		return nil, fmt.Errorf("failed to update playbook: %w", err)
+	}
+	return playbook, nil
+}
+
+// DeletePlaybook deletes a playbook.
+func (s *playbookService) DeletePlaybook(ctx context.Context, name string) error {
+	if _, err := s.store.GetPlaybook(name); err != nil {
+		return fmt.Errorf("playbook not found: %w", err)
+	}
+	if err := s.store.DeletePlaybook(name); err != nil {
+		return fmt.Errorf("failed to delete playbook: %w", err)
+	}
+	return nil
+}
+
+// StartRun runs a playbook against a beacon and queues its first step.
+func (s *playbookService) StartRun(ctx context.Context, name string, beaconID string, vars map[string]string, operator string) (*data.PlaybookRun, *data.Task, error) {
+	playbook, err := s.store.GetPlaybook(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("playbook not found: %w", err)
+	}
+	beacon, err := getBeacon(ctx, s.store, beaconID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("beacon not found: %w", err)
+	}
+	if err := checkClaim(s.store, beacon.BeaconID, operator); err != nil {
+		return nil, nil, err
+	}
+	if vars == nil {
+		vars = map[string]string{}
+	}
+
+	run := &data.PlaybookRun{
+		RunID:      uuid.New().String(),
+		Playbook:   playbook.Name,
+		BeaconID:   beacon.BeaconID,
+		Steps:      playbook.Steps,
+		Vars:       vars,
+		TaskIDs:    []string{},
+		Status:     "running",
+		Operator:   operator,
+		Engagement: beacon.Engagement,
+	}
+	// Render the first step before saving, so a broken template doesn't leave a dead run behind
+	arguments, err := s.render(run, beacon)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.store.CreatePlaybookRun(run); err != nil {
+		return nil, nil, fmt.Errorf("failed to create playbook run: %w", err)
+	}
+
+	task, err := s.queueStep(run, arguments)
+	if err != nil {
+		return nil, nil, err
+	}
+	return run, task, nil
+}
+
+// GetRun retrieves a playbook run by its ID.
+func (s *playbookService) GetRun(ctx context.Context, runID string) (*data.PlaybookRun, error) {
+	run, err := s.store.GetPlaybookRun(runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get playbook run: %w", err)
+	}
+	if !inEngagement(ctx, run.Engagement) {
+		return nil, fmt.Errorf("failed to get playbook run: %w", gorm.ErrRecordNotFound)
+	}
+	return run, nil
+}
+
+// ListRuns retrieves playbook runs, optionally only those of one beacon.
+func (s *playbookService) ListRuns(ctx context.Context, beaconID string, page int, limit int) ([]data.PlaybookRun, int64, error) {
+	runs, total, err := s.store.GetPlaybookRuns(EngagementFromContext(ctx), beaconID, page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list playbook runs: %w", err)
+	}
+	return runs, total, nil
+}
+
+// CancelRun stops a running playbook and cancels its current step if it hasn't been dispatched yet.
+func (s *playbookService) CancelRun(ctx context.Context, runID string) (*data.PlaybookRun, error) {
+	run, err := s.GetRun(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.Status != "running" {
+		return nil, fmt.Errorf("playbook run is already %s", run.Status)
+	}
+
+	if task, err := s.store.GetTask(run.CurrentTaskID); err == nil && task.Status == "queued" {
+		task.Status = "canceled"
+		if err := s.store.UpdateTask(task); err != nil {
+			return nil, fmt.Errorf("failed to cancel task: %w", err)
+		}
+	}
+	run.Status = "canceled"
+	if err := s.store.UpdatePlaybookRun(run); err != nil {
+		return nil, fmt.Errorf("failed to update playbook run: %w", err)
+	}
+	return run, nil
+}
+
+// TaskFinished advances the run a finished task belongs to: it queues the next step if the task
+// completed, or ends the run otherwise. It returns the updated run and the next task, if one was queued;
+// the run is nil if the task is not the current step of a running playbook.
+func (s *playbookService) TaskFinished(task *data.Task) (*data.PlaybookRun, *data.Task, error) {
+	if !strings.HasPrefix(task.Source, playbookTaskSource) {
+		return nil, nil, nil
+	}
+	run, err := s.store.GetPlaybookRunByTask(task.TaskID)
+	if err != nil || run.Status != "running" {
+		return nil, nil, nil
+	}
+	step := len(run.TaskIDs)
+
+	switch {
+	case task.Status == "canceled":
+		return run, nil, s.finish(run, "canceled", fmt.Sprintf("step %d (%s) canceled", step, task.Command))
+	case task.Status != "completed":
+		return run, nil, s.finish(run, "failed", fmt.Sprintf("step %d (%s) %s: %s", step, task.Command, task.Status, truncate(task.Output, 500)))
+	case step >= len(run.Steps):
+		return run, nil, s.finish(run, "completed", "")
+	}
+
+	beacon, err := s.store.GetBeacon(run.BeaconID)
+	if err != nil {
+		return run, nil, s.finish(run, "failed", fmt.Sprintf("beacon not found: %v", err))
+	}
+	arguments, err := s.render(run, beacon)
+	if err != nil {
+		return run, nil, s.finish(run, "failed", err.Error())
+	}
+	next, err := s.queueStep(run, arguments)
+	if err != nil {
+		return run, nil, s.finish(run, "failed", err.Error())
+	}
+	return run, next, nil
+}
+
+// render evaluates the arguments template of the run's next step.
+func (s *playbookService) render(run *data.PlaybookRun, beacon *data.Beacon) (string, error) {
+	step := len(run.TaskIDs)
+	tmpl, err := template.New("").Funcs(playbookFuncs).Option("missingkey=error").Parse(run.Steps[step].Arguments)
+	if err != nil {
+		return "", fmt.Errorf("step %d: invalid arguments template: %w", step+1, err)
+	}
+
+	pc := &PlaybookContext{Beacon: beacon, Vars: run.Vars, Outputs: []string{}}
+	for _, taskID := range run.TaskIDs {
+		task, err := s.store.GetTask(taskID)
+		if err != nil {
+			return "", fmt.Errorf("failed to get output of task %s: %w", taskID, err)
+		}
+		pc.Outputs = append(pc.Outputs, task.Output)
+	}
+	if len(pc.Outputs) > 0 {
+		pc.Prev = pc.Outputs[len(pc.Outputs)-1]
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, pc); err != nil {
+		return "", fmt.Errorf("step %d: failed to render arguments: %w", step+1, err)
+	}
+	return buf.String(), nil
+}
+
+// queueStep creates the task of the run's next step and makes it the current step.
+func (s *playbookService) queueStep(run *data.PlaybookRun, arguments string) (*data.Task, error) {
+	step := run.Steps[len(run.TaskIDs)]
+	task := &data.Task{
+		TaskID:     uuid.New().String(),
+		BeaconID:   run.BeaconID,
+		Command:    step.Command,
+		Arguments:  arguments,
+		Status:     "queued",
+		Source:     playbookTaskSource + run.Playbook,
+		Operator:   run.Operator,
+		Engagement: run.Engagement,
+	}
+	if err := s.store.CreateTask(task); err != nil {
+		return nil, fmt.Errorf("failed to create task: %w", err)
+	}
+
+	run.TaskIDs = append(run.TaskIDs, task.TaskID)
+	run.CurrentTaskID = task.TaskID
+	if err := s.store.UpdatePlaybookRun(run); err != nil {
+		return nil, fmt.Errorf("failed to update playbook run: %w", err)
+	}
+	return task, nil
+}
+
+// finish ends a run with the given status.
+func (s *playbookService) finish(run *data.PlaybookRun, status, reason string) error {
+	run.Status = status
+	run.Error = reason
+	if err := s.store.UpdatePlaybookRun(run); err != nil {
+		return fmt.Errorf("failed to update playbook run: %w", err)
+	}
+	return nil
+}
+
+// truncate shortens s to at most n bytes for error messages.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
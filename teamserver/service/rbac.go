@@ -0,0 +1,79 @@
+package service
+
+import "fmt"
+
+// Operator roles, from least to most privileged.
+const (
+	RoleReadOnly = "read-only"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// roleRanks orders the roles so that higher roles include lower ones.
+var roleRanks = map[string]int{
+	RoleReadOnly: 1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// defaultCommandRoles lists the high-risk commands that need more than the operator role.
+var defaultCommandRoles = map[string]string{
+	"shellcode": RoleAdmin,
+	"upgrade":   RoleAdmin,
+}
+
+func validRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants at least the privileges of required.
+func RoleAtLeast(role, required string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[required]
+}
+
+// HighestRole returns the most privileged valid role in roles, or "" if there is none.
+func HighestRole(roles []string) string {
+	highest := ""
+	for _, role := range roles {
+		if validRole(role) && roleRanks[role] > roleRanks[highest] {
+			highest = role
+		}
+	}
+	return highest
+}
+
+// CommandPolicy decides which role is required to task a beacon with a given command.
+type CommandPolicy struct {
+	roles map[string]string
+}
+
+// NewCommandPolicy creates a policy from the configured per-command roles.
+// Configured entries override the built-in defaults.
+func NewCommandPolicy(commandRoles map[string]string) (*CommandPolicy, error) {
+	roles := make(map[string]string, len(defaultCommandRoles)+len(commandRoles))
+	for command, role := range defaultCommandRoles {
+		roles[command] = role
+	}
+	for command, role := range commandRoles {
+		if !validRole(role) {
+			return nil, fmt.Errorf("invalid role '%s' for command '%s'", role, command)
+		}
+		roles[command] = role
+	}
+	return &CommandPolicy{roles: roles}, nil
+}
+
+// RequiredRole returns the minimum role needed to run a command.
+func (p *CommandPolicy) RequiredRole(command string) string {
+	if role, ok := p.roles[command]; ok {
+		return role
+	}
+	return RoleOperator
+}
+
+// Allowed reports whether an operator with the given role may run a command.
+func (p *CommandPolicy) Allowed(command, role string) bool {
+	return RoleAtLeast(role, p.RequiredRole(command))
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/teamserver/data"
+)
+
+// Report formats.
+const (
+	ReportMarkdown = "markdown"
+	ReportHTML     = "html"
+	ReportPDF      = "pdf"
+)
+
+// ErrPDFUnavailable is returned for PDF reports when no PDF converter is configured.
+var ErrPDFUnavailable = errors.New("PDF reports require reports.pdf_command in the TeamServer config")
+
+//go:embed templates/engagement.md.tmpl templates/engagement.html.tmpl
+var reportTemplates embed.FS
+
+// EngagementReport is the data report templates are rendered with.
+type EngagementReport struct {
+	Engagement  data.Engagement
+	GeneratedAt time.Time
+	GeneratedBy string
+	Beacons     []data.Beacon
+	Timeline    []TimelineEntry
+	Tasks       []data.Task
+	Loot        []data.LootItem
+	Credentials []data.Credential
+	Artifacts   []data.Artifact
+	Coverage    []TacticCoverage
+}
+
+// TimelineEntry is one event of an engagement's timeline.
+type TimelineEntry struct {
+	Time        time.Time
+	Type        string // "beacon", "task", "loot", "credential" or "artifact"
+	BeaconID    string
+	Hostname    string
+	Operator    string
+	Description string
+}
+
+// ReportService defines the interface for generating engagement reports.
+type ReportService interface {
+	// BuildEngagementReport collects the data of the engagement's report. Credential secrets are
+	// masked unless includeSecrets is set.
+	BuildEngagementReport(ctx context.Context, generatedBy string, includeSecrets bool) (*EngagementReport, error)
+
+	// RenderEngagementReport renders a report as Markdown, HTML or PDF and returns it with its content type.
+	RenderEngagementReport(report *EngagementReport, format string) ([]byte, string, error)
+
+	// DeconflictionLog lists every action taken in the engagement, per host in time order.
+	DeconflictionLog(ctx context.Context) ([]DeconflictionEntry, error)
+}
+
+// reportService implements the ReportService interface.
+type reportService struct {
+	store       data.DataStore
+	taskService TaskService
+	config      config.ReportConfig
+}
+
+// NewReportService creates a new instance of reportService.
+func NewReportService(store data.DataStore, taskService TaskService, cfg config.ReportConfig) ReportService {
+	return &reportService{
+		store:       store,
+		taskService: taskService,
+		config:      cfg,
+	}
+}
+
+// BuildEngagementReport collects the data of the engagement's report.
+func (s *reportService) BuildEngagementReport(ctx context.Context, generatedBy string, includeSecrets bool) (*EngagementReport, error) {
+	name := EngagementFromContext(ctx)
+	engagement, err := s.store.GetEngagement(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get engagement: %w", err)
+	}
+	report := &EngagementReport{Engagement: *engagement, GeneratedAt: time.Now(), GeneratedBy: generatedBy}
+
+	if report.Beacons, err = s.store.GetAllBeacons(name); err != nil {
+		return nil, fmt.Errorf("failed to get beacons: %w", err)
+	}
+	if report.Tasks, err = s.store.GetAllTasks(name); err != nil {
+		return nil, fmt.Errorf("failed to get tasks: %w", err)
+	}
+	if report.Loot, err = s.store.GetAllLootItems(name); err != nil {
+		return nil, fmt.Errorf("failed to get loot: %w", err)
+	}
+	if report.Credentials, err = s.store.GetAllCredentials(name); err != nil {
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
+	}
+	if report.Artifacts, err = s.store.GetAllArtifacts(name); err != nil {
+		return nil, fmt.Errorf("failed to get artifacts: %w", err)
+	}
+	if report.Coverage, err = s.taskService.TechniqueCoverage(ctx); err != nil {
+		return nil, err
+	}
+
+	if !includeSecrets {
+		for i := range report.Credentials {
+			report.Credentials[i].Secret = "********"
+		}
+	}
+	if limit := s.config.GetMaxOutputLength(); limit >= 0 {
+		for i := range report.Tasks {
+			if output := []rune(report.Tasks[i].Output); len(output) > limit {
+				report.Tasks[i].Output = string(output[:limit]) + fmt.Sprintf("\n... [truncated, %d characters omitted]", len(output)-limit)
+			}
+		}
+	}
+	report.Timeline = buildTimeline(report)
+	return report, nil
+}
+
+// buildTimeline orders what happened in an engagement by time.
+func buildTimeline(report *EngagementReport) []TimelineEntry {
+	hostnames := make(map[string]string)
+	var timeline []TimelineEntry
+	for _, beacon := range report.Beacons {
+		hostnames[beacon.BeaconID] = beacon.Hostname
+		timeline = append(timeline, TimelineEntry{
+			Time:        beacon.FirstSeen,
+			Type:        "beacon",
+			BeaconID:    beacon.BeaconID,
+			Hostname:    beacon.Hostname,
+			Description: fmt.Sprintf("Beacon staged as %s via listener %s from %s", beacon.Username, beacon.Listener, beacon.RemoteAddr),
+		})
+	}
+	for _, task := range report.Tasks {
+		if task.DispatchedAt == nil {
+			continue
+		}
+		timeline = append(timeline, TimelineEntry{
+			Time:        *task.DispatchedAt,
+			Type:        "task",
+			BeaconID:    task.BeaconID,
+			Hostname:    hostnames[task.BeaconID],
+			Operator:    task.Operator,
+			Description: strings.TrimSpace(fmt.Sprintf("%s %s (%s)", task.Command, task.Arguments, task.Status)),
+		})
+	}
+	for _, item := range report.Loot {
+		timeline = append(timeline, TimelineEntry{
+			Time:        item.CreatedAt,
+			Type:        "loot",
+			BeaconID:    item.BeaconID,
+			Hostname:    item.Hostname,
+			Description: fmt.Sprintf("Collected %s %s", item.Type, item.OriginalPath),
+		})
+	}
+	for _, credential := range report.Credentials {
+		account := credential.Username
+		if credential.Domain != "" {
+			account = credential.Domain + `\` + credential.Username
+		}
+		timeline = append(timeline, TimelineEntry{
+			Time:        credential.CreatedAt,
+			Type:        "credential",
+			BeaconID:    credential.BeaconID,
+			Hostname:    hostnames[credential.BeaconID],
+			Operator:    credential.CreatedBy,
+			Description: fmt.Sprintf("Recorded %s credential for %s", credential.Type, account),
+		})
+	}
+	for _, artifact := range report.Artifacts {
+		if artifact.BeaconID == "" {
+			continue // Payload builds didn't touch a target
+		}
+		timeline = append(timeline, TimelineEntry{
+			Time:        artifact.CreatedAt,
+			Type:        "artifact",
+			BeaconID:    artifact.BeaconID,
+			Hostname:    artifact.Hostname,
+			Description: fmt.Sprintf("Wrote %s (SHA256 %s)", artifact.Path, artifact.SHA256),
+		})
+	}
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].Time.Before(timeline[j].Time) })
+	return timeline
+}
+
+// RenderEngagementReport renders a report as Markdown, HTML or PDF.
+func (s *reportService) RenderEngagementReport(report *EngagementReport, format string) ([]byte, string, error) {
+	switch format {
+	case ReportMarkdown:
+		source, err := s.template("engagement.md.tmpl")
+		if err != nil {
+			return nil, "", err
+		}
+		tmpl, err := texttemplate.New("report").Funcs(reportFuncs).Parse(source)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse report template: %w", err)
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, report); err != nil {
+			return nil, "", fmt.Errorf("failed to render report: %w", err)
+		}
+		return out.Bytes(), "text/markdown; charset=utf-8", nil
+	case ReportHTML, ReportPDF:
+		if format == ReportPDF && len(s.config.PDFCommand) == 0 {
+			return nil, "", ErrPDFUnavailable
+		}
+		source, err := s.template("engagement.html.tmpl")
+		if err != nil {
+			return nil, "", err
+		}
+		tmpl, err := htmltemplate.New("report").Funcs(reportFuncs).Parse(source)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse report template: %w", err)
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, report); err != nil {
+			return nil, "", fmt.Errorf("failed to render report: %w", err)
+		}
+		if format == ReportHTML {
+			return out.Bytes(), "text/html; charset=utf-8", nil
+		}
+		pdf, err := s.convertToPDF(out.Bytes())
+		if err != nil {
+			return nil, "", err
+		}
+		return pdf, "application/pdf", nil
+	}
+	return nil, "", fmt.Errorf("invalid report format '%s'", format)
+}
+
+// template returns a report template from the configured template directory, or the built-in one.
+func (s *reportService) template(name string) (string, error) {
+	if s.config.TemplateDir != "" {
+		content, err := os.ReadFile(filepath.Join(s.config.TemplateDir, name))
+		if err == nil {
+			return string(content), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read report template: %w", err)
+		}
+	}
+	content, err := reportTemplates.ReadFile("templates/" + name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read report template: %w", err)
+	}
+	return string(content), nil
+}
+
+// convertToPDF pipes an HTML report through the configured PDF converter.
+func (s *reportService) convertToPDF(html []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.config.PDFCommand[0], s.config.PDFCommand[1:]...)
+	cmd.Stdin = bytes.NewReader(html)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to convert report to PDF: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// reportFuncs are the functions available to report templates.
+var reportFuncs = map[string]interface{}{
+	"datetime": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"datetimePtr": func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+		return t.UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"join": strings.Join,
+	"size": func(n int64) string {
+		switch {
+		case n >= 1<<30:
+			return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+		case n >= 1<<20:
+			return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+		case n >= 1<<10:
+			return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+		}
+		return fmt.Sprintf("%d B", n)
+	},
+	// cell escapes a value for a Markdown table cell
+	"cell": func(s string) string {
+		s = strings.ReplaceAll(s, "|", `\|`)
+		return strings.Join(strings.Fields(s), " ")
+	},
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+)
+
+// Retention policies.
+const (
+	RetentionTaskOutputs    = "task_outputs"
+	RetentionCheckIns       = "check_ins"
+	RetentionEvents         = "events"
+	RetentionDeletedBeacons = "deleted_beacons"
+)
+
+// RetentionResult is what one retention policy deleted, or would delete in a dry run.
+type RetentionResult struct {
+	Policy string    `json:"policy"`
+	Days   int       `json:"days"`
+	Cutoff time.Time `json:"cutoff"`
+	Rows   int64     `json:"rows"`            // Task outputs cleared, events or beacons deleted
+	Tasks  int64     `json:"tasks,omitempty"` // Tasks deleted with the beacons
+}
+
+// RetentionReport is the result of applying the retention policies.
+type RetentionReport struct {
+	DryRun     bool              `json:"dry_run"`
+	StartedAt  time.Time         `json:"started_at"`
+	DurationMs int64             `json:"duration_ms"`
+	Results    []RetentionResult `json:"results"` // Enabled policies only
+}
+
+// RetentionService defines the interface for applying the data retention policies.
+type RetentionService interface {
+	// Apply runs every enabled policy. With dryRun set, it only reports what would be deleted.
+	Apply(ctx context.Context, dryRun bool) (*RetentionReport, error)
+
+	// StartRetentionRoutine applies the policies periodically in the background.
+	StartRetentionRoutine()
+}
+
+// retentionService implements the RetentionService interface.
+type retentionService struct {
+	store  data.DataStore
+	config config.RetentionConfig
+}
+
+// NewRetentionService creates a new instance of retentionService.
+func NewRetentionService(store data.DataStore, cfg config.RetentionConfig) RetentionService {
+	return &retentionService{
+		store:  store,
+		config: cfg,
+	}
+}
+
+// Apply runs every enabled policy.
+func (s *retentionService) Apply(ctx context.Context, dryRun bool) (*RetentionReport, error) {
+	report := &RetentionReport{DryRun: dryRun, StartedAt: time.Now(), Results: []RetentionResult{}}
+	policies := []struct {
+		name  string
+		days  int
+		prune func(cutoff time.Time) (int64, int64, error)
+	}{
+		{RetentionTaskOutputs, s.config.TaskOutputDays, func(cutoff time.Time) (int64, int64, error) {
+			rows, err := s.store.PruneTaskOutputs(cutoff, dryRun)
+			return rows, 0, err
+		}},
+		{RetentionCheckIns, s.config.CheckInDays, func(cutoff time.Time) (int64, int64, error) {
+			rows, err := s.store.PruneEvents(cutoff, true, dryRun)
+			return rows, 0, err
+		}},
+		{RetentionEvents, s.config.EventDays, func(cutoff time.Time) (int64, int64, error) {
+			rows, err := s.store.PruneEvents(cutoff, false, dryRun)
+			return rows, 0, err
+		}},
+		{RetentionDeletedBeacons, s.config.DeletedBeaconDays, func(cutoff time.Time) (int64, int64, error) {
+			return s.store.PurgeDeletedBeacons(cutoff, dryRun)
+		}},
+	}
+
+	for _, policy := range policies {
+		if policy.days <= 0 {
+			continue
+		}
+		cutoff := report.StartedAt.AddDate(0, 0, -policy.days)
+		rows, tasks, err := policy.prune(cutoff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply %s retention: %w", policy.name, err)
+		}
+		report.Results = append(report.Results, RetentionResult{Policy: policy.name, Days: policy.days, Cutoff: cutoff, Rows: rows, Tasks: tasks})
+	}
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	return report, nil
+}
+
+// StartRetentionRoutine applies the policies periodically in the background.
+func (s *retentionService) StartRetentionRoutine() {
+	if s.config.TaskOutputDays <= 0 && s.config.CheckInDays <= 0 && s.config.EventDays <= 0 && s.config.DeletedBeaconDays <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.config.GetInterval())
+		defer ticker.Stop()
+
+		for {
+			report, err := s.Apply(context.Background(), s.config.DryRun)
+			if err != nil {
+				logger.Errorf("Data retention failed: %v", err)
+			} else {
+				logRetentionReport(report)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// logRetentionReport logs what each policy deleted, or would delete in a dry run.
+func logRetentionReport(report *RetentionReport) {
+	for _, result := range report.Results {
+		switch {
+		case report.DryRun:
+			logger.Infof("Retention dry run: %s older than %d days would prune %d rows (%d tasks)", result.Policy, result.Days, result.Rows, result.Tasks)
+		case result.Rows > 0:
+			logger.Infof("Retention: %s older than %d days pruned %d rows (%d tasks)", result.Policy, result.Days, result.Rows, result.Tasks)
+		}
+	}
+}
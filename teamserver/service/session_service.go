@@ -1,12 +1,25 @@
 package service
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"simplec2/teamserver/data"
 	"time"
+
+	"github.com/google/uuid"
 )
 
+// ErrRefreshTokenInvalid is returned for unknown or expired refresh tokens.
+var ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+
+// ErrRefreshTokenReused is returned when a refresh token that was already rotated is presented again.
+// This means the token was stolen (or replayed), so the whole session family is revoked.
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+
 // SessionService handles session management operations.
 type SessionService struct {
 	store data.DataStore
@@ -37,6 +50,92 @@ func (s *SessionService) CreateSession(userID, token, ipAddress, userAgent strin
 	return session, nil
 }
 
+// StartSession creates a new session family for a fresh login and returns its refresh token.
+func (s *SessionService) StartSession(userID, accessToken, ipAddress, userAgent string, refreshTTL time.Duration) (*data.Session, string, error) {
+	return s.newSession(userID, uuid.New().String(), accessToken, ipAddress, userAgent, refreshTTL)
+}
+
+// ConsumeRefreshToken validates a refresh token and retires its session so it cannot be used again.
+// Returns the retired session, whose user and family the replacement session must inherit.
+func (s *SessionService) ConsumeRefreshToken(refreshToken string) (*data.Session, error) {
+	session, err := s.store.GetSessionByRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if !session.IsActive {
+		return nil, s.revokeFamily(session.FamilyID)
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	// Retired in a single conditional update: a concurrent refresh with the same token that got here
+	// first leaves nothing to retire, and this one is the replay
+	retired, err := s.store.RetireSessionByRefreshToken(session.RefreshTokenHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retire session: %w", err)
+	}
+	if !retired {
+		return nil, s.revokeFamily(session.FamilyID)
+	}
+	session.IsActive = false
+	return session, nil
+}
+
+// revokeFamily revokes every session of a family whose refresh token was presented again, as it was
+// stolen or replayed, and returns ErrRefreshTokenReused.
+func (s *SessionService) revokeFamily(familyID string) error {
+	if err := s.store.DeleteSessionsByFamily(familyID); err != nil {
+		return fmt.Errorf("failed to revoke session family: %w", err)
+	}
+	return ErrRefreshTokenReused
+}
+
+// ContinueSession creates the replacement for a session retired by ConsumeRefreshToken. If a replay
+// revoked the family in the meantime, the replacement is revoked too and ErrRefreshTokenReused returned.
+func (s *SessionService) ContinueSession(previous *data.Session, accessToken, ipAddress, userAgent string, refreshTTL time.Duration) (*data.Session, string, error) {
+	session, refreshToken, err := s.newSession(previous.UserID, previous.FamilyID, accessToken, ipAddress, userAgent, refreshTTL)
+	if err != nil {
+		return nil, "", err
+	}
+	if current, err := s.store.GetSessionByID(previous.ID); err != nil || current.RevokedAt != nil {
+		return nil, "", s.revokeFamily(previous.FamilyID)
+	}
+	return session, refreshToken, nil
+}
+
+// RevokeRefreshToken revokes the session family a refresh token belongs to.
+func (s *SessionService) RevokeRefreshToken(refreshToken string) error {
+	session, err := s.store.GetSessionByRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		return ErrRefreshTokenInvalid
+	}
+	return s.store.DeleteSessionsByFamily(session.FamilyID)
+}
+
+func (s *SessionService) newSession(userID, familyID, accessToken, ipAddress, userAgent string, refreshTTL time.Duration) (*data.Session, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(b)
+
+	session := &data.Session{
+		UserID:           userID,
+		TokenHash:        hashToken(accessToken),
+		IPAddress:        ipAddress,
+		UserAgent:        userAgent,
+		ExpiresAt:        time.Now().Add(refreshTTL),
+		IsActive:         true,
+		RefreshTokenHash: hashToken(refreshToken),
+		FamilyID:         familyID,
+	}
+	if err := s.store.CreateSession(session); err != nil {
+		return nil, "", err
+	}
+	return session, refreshToken, nil
+}
+
 // ValidateSession checks if a session is valid and not expired.
 func (s *SessionService) ValidateSession(token string) (*data.Session, bool) {
 	tokenHash := hashToken(token)
@@ -63,6 +162,11 @@ func (s *SessionService) InvalidateSession(token string) error {
 	return s.store.DeleteSession(tokenHash)
 }
 
+// InvalidateUserSessions invalidates all sessions of a user.
+func (s *SessionService) InvalidateUserSessions(userID string) error {
+	return s.store.DeleteSessionsByUser(userID)
+}
+
 // GetActiveSessions returns all active sessions.
 func (s *SessionService) GetActiveSessions() ([]*data.Session, error) {
 	sessions, err := s.store.GetActiveSessions()
@@ -78,6 +182,25 @@ func (s *SessionService) GetActiveSessions() ([]*data.Session, error) {
 	return result, nil
 }
 
+// RevokeSession forcibly ends a session together with the rest of its refresh token family,
+// so neither its access token nor its refresh token can be used any more.
+func (s *SessionService) RevokeSession(id uint) (*data.Session, error) {
+	session, err := s.store.GetSessionByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	if session.FamilyID != "" {
+		err = s.store.DeleteSessionsByFamily(session.FamilyID)
+	} else {
+		err = s.store.DeleteSession(session.TokenHash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke session: %w", err)
+	}
+	session.IsActive = false
+	return session, nil
+}
+
 // CleanupExpiredSessions removes all expired sessions.
 func (s *SessionService) CleanupExpiredSessions() (int64, error) {
 	return s.store.DeleteExpiredSessions()
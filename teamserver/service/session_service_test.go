@@ -0,0 +1,160 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/teamserver/data"
+)
+
+// newTestStore opens a SQLite store in a temporary directory.
+func newTestStore(t *testing.T) data.DataStore {
+	t.Helper()
+	// Concurrent writers wait for the lock instead of failing with SQLITE_BUSY
+	path := filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000"
+	store, err := data.NewDataStore(config.DatabaseConfig{Type: "sqlite", Path: path})
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	return store
+}
+
+// activeInFamily returns the number of active sessions of a family.
+func activeInFamily(t *testing.T, store data.DataStore, familyID string) int {
+	t.Helper()
+	sessions, err := store.GetActiveSessions()
+	if err != nil {
+		t.Fatalf("failed to get active sessions: %v", err)
+	}
+	active := 0
+	for _, session := range sessions {
+		if session.FamilyID == familyID {
+			active++
+		}
+	}
+	return active
+}
+
+// TestRefreshTokenRotation tests that a refresh token can be used once and its replacement works.
+func TestRefreshTokenRotation(t *testing.T) {
+	store := newTestStore(t)
+	sessions := NewSessionService(store)
+
+	first, refreshToken, err := sessions.StartSession("alice", "access-1", "127.0.0.1", "test", time.Hour)
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	previous, err := sessions.ConsumeRefreshToken(refreshToken)
+	if err != nil {
+		t.Fatalf("ConsumeRefreshToken: %v", err)
+	}
+	second, nextToken, err := sessions.ContinueSession(previous, "access-2", "127.0.0.1", "test", time.Hour)
+	if err != nil {
+		t.Fatalf("ContinueSession: %v", err)
+	}
+	if second.FamilyID != first.FamilyID || second.UserID != "alice" {
+		t.Fatalf("replacement session not in the same family: %+v", second)
+	}
+	if _, err := sessions.ConsumeRefreshToken(nextToken); err != nil {
+		t.Fatalf("replacement refresh token rejected: %v", err)
+	}
+	if _, err := sessions.ConsumeRefreshToken("unknown"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Fatalf("expected ErrRefreshTokenInvalid for an unknown token, got %v", err)
+	}
+}
+
+// TestRefreshTokenReuse tests that presenting a rotated refresh token revokes the whole family.
+func TestRefreshTokenReuse(t *testing.T) {
+	store := newTestStore(t)
+	sessions := NewSessionService(store)
+
+	first, refreshToken, err := sessions.StartSession("alice", "access-1", "127.0.0.1", "test", time.Hour)
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	previous, err := sessions.ConsumeRefreshToken(refreshToken)
+	if err != nil {
+		t.Fatalf("ConsumeRefreshToken: %v", err)
+	}
+	if _, _, err := sessions.ContinueSession(previous, "access-2", "127.0.0.1", "test", time.Hour); err != nil {
+		t.Fatalf("ContinueSession: %v", err)
+	}
+
+	if _, err := sessions.ConsumeRefreshToken(refreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+	if active := activeInFamily(t, store, first.FamilyID); active != 0 {
+		t.Fatalf("expected the family to be revoked, %d sessions still active", active)
+	}
+}
+
+// lookupBarrierStore holds every refresh token lookup until all the expected lookups were made, so
+// concurrent refreshes all read the session before any of them retires it.
+type lookupBarrierStore struct {
+	data.DataStore
+	lookups *sync.WaitGroup
+}
+
+func (s *lookupBarrierStore) GetSessionByRefreshToken(refreshTokenHash string) (*data.Session, error) {
+	session, err := s.DataStore.GetSessionByRefreshToken(refreshTokenHash)
+	s.lookups.Done()
+	s.lookups.Wait()
+	return session, err
+}
+
+// TestConcurrentRefresh tests that of two refreshes racing with the same token only one succeeds, and
+// the other one revokes the family, including the session the winner creates afterwards.
+func TestConcurrentRefresh(t *testing.T) {
+	store := newTestStore(t)
+
+	for i := 0; i < 5; i++ {
+		first, refreshToken, err := NewSessionService(store).StartSession("alice", "access-"+time.Now().String(), "127.0.0.1", "test", time.Hour)
+		if err != nil {
+			t.Fatalf("StartSession: %v", err)
+		}
+		lookups := &sync.WaitGroup{}
+		lookups.Add(2)
+		sessions := NewSessionService(&lookupBarrierStore{DataStore: store, lookups: lookups})
+
+		var wg sync.WaitGroup
+		results := make([]*data.Session, 2)
+		errs := make([]error, 2)
+		for j := range results {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				results[j], errs[j] = sessions.ConsumeRefreshToken(refreshToken)
+			}(j)
+		}
+		wg.Wait()
+
+		succeeded, reused := 0, 0
+		var winner *data.Session
+		for j := range results {
+			switch {
+			case errs[j] == nil:
+				succeeded++
+				winner = results[j]
+			case errors.Is(errs[j], ErrRefreshTokenReused):
+				reused++
+			default:
+				t.Fatalf("unexpected error: %v", errs[j])
+			}
+		}
+		if succeeded != 1 || reused != 1 {
+			t.Fatalf("expected one refresh to succeed and one to be a reuse, got %d and %d", succeeded, reused)
+		}
+
+		// The family was revoked after the winner retired its session: the replacement is refused
+		if _, _, err := sessions.ContinueSession(winner, "access-next-"+time.Now().String(), "127.0.0.1", "test", time.Hour); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Fatalf("expected the replacement of a revoked family to be refused, got %v", err)
+		}
+		if active := activeInFamily(t, store, first.FamilyID); active != 0 {
+			t.Fatalf("expected the family to be revoked, %d sessions still active", active)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"simplec2/teamserver/data"
+)
+
+// Stats is the overview of the admin dashboard.
+type Stats struct {
+	GeneratedAt   time.Time       `json:"generated_at"`
+	Engagement    string          `json:"engagement,omitempty"` // Empty for all engagements
+	WindowMinutes int             `json:"window_minutes"`       // Period of the check-in and operator figures
+	Beacons       BeaconStats     `json:"beacons"`
+	Tasks         TaskStats       `json:"tasks"`
+	CheckIns      []CheckInRate   `json:"check_ins"` // One entry per minute of the window, oldest first
+	Loot          LootStats       `json:"loot"`
+	Listeners     []ListenerStats `json:"listeners"`
+	Operators     []OperatorStats `json:"operators"`
+}
+
+// BeaconStats counts the beacons by state. Archived beacons are not counted as active or inactive.
+type BeaconStats struct {
+	Total       int64 `json:"total"`
+	Active      int64 `json:"active"`
+	Inactive    int64 `json:"inactive"`
+	Hibernating int64 `json:"hibernating"`
+	Exiting     int64 `json:"exiting"` // Tasked to exit, waiting for their last check-in
+	Archived    int64 `json:"archived"`
+}
+
+// TaskStats counts the tasks by status.
+type TaskStats struct {
+	Total    int64            `json:"total"`
+	ByStatus map[string]int64 `json:"by_status"`
+}
+
+// CheckInRate is the number of beacon check-ins in one minute.
+type CheckInRate struct {
+	Minute   time.Time `json:"minute"`
+	CheckIns int64     `json:"check_ins"`
+}
+
+// LootStats sums up the loot collected.
+type LootStats struct {
+	Items  int64                `json:"items"`
+	Bytes  int64                `json:"bytes"`
+	ByType []data.LootTypeUsage `json:"by_type"`
+}
+
+// ListenerStats is the state of a listener and the beacons staged through it.
+type ListenerStats struct {
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	Active      bool       `json:"active"` // Connected to the TeamServer's control channel
+	Beacons     int64      `json:"beacons"`
+	LastCheckIn *time.Time `json:"last_check_in,omitempty"`
+	// Traffic on the gRPC bridge since the TeamServer started; nil before the listener's first call
+	Bridge *ListenerBridgeUsage `json:"bridge,omitempty"`
+}
+
+// OperatorStats is the activity of an operator during the window.
+type OperatorStats struct {
+	Username   string     `json:"username"`
+	Tasks      int64      `json:"tasks"`    // Tasks created
+	Requests   int64      `json:"requests"` // Audited API requests, in any engagement
+	LastActive *time.Time `json:"last_active,omitempty"`
+}
+
+// StatsService defines the interface for the admin dashboard statistics.
+type StatsService interface {
+	// Stats aggregates the statistics of the engagement in ctx, or of all engagements if there is none.
+	// Check-ins and operator activity cover the last window.
+	Stats(ctx context.Context, window time.Duration) (*Stats, error)
+}
+
+// statsService implements the StatsService interface.
+type statsService struct {
+	store           data.DataStore
+	listenerService ListenerService
+	quotaService    ListenerQuotaService
+}
+
+// NewStatsService creates a new instance of statsService.
+func NewStatsService(store data.DataStore, listenerService ListenerService, quotaService ListenerQuotaService) StatsService {
+	return &statsService{
+		store:           store,
+		listenerService: listenerService,
+		quotaService:    quotaService,
+	}
+}
+
+// Stats aggregates the dashboard statistics.
+func (s *statsService) Stats(ctx context.Context, window time.Duration) (*Stats, error) {
+	engagement := EngagementFromContext(ctx)
+	now := time.Now()
+	since := now.Add(-window).Truncate(time.Minute)
+	stats := &Stats{GeneratedAt: now, Engagement: engagement, WindowMinutes: int(window / time.Minute)}
+
+	states, err := s.store.CountBeaconStates(engagement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count beacons: %w", err)
+	}
+	for _, state := range states {
+		stats.Beacons.Total += state.Count
+		switch state.Name {
+		case "active":
+			stats.Beacons.Active = state.Count
+		case "inactive":
+			stats.Beacons.Inactive = state.Count
+		case "hibernating":
+			stats.Beacons.Hibernating = state.Count
+		case "exiting":
+			stats.Beacons.Exiting = state.Count
+		case "archived":
+			stats.Beacons.Archived = state.Count
+		}
+	}
+
+	statuses, err := s.store.CountTasksByStatus(engagement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tasks: %w", err)
+	}
+	stats.Tasks.ByStatus = make(map[string]int64)
+	for _, status := range statuses {
+		stats.Tasks.Total += status.Count
+		stats.Tasks.ByStatus[status.Name] = status.Count
+	}
+
+	checkIns, err := s.store.CountCheckIns(engagement, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count check-ins: %w", err)
+	}
+	// Minutes without check-ins are filled in, so the series can be charted as is
+	perMinute := make(map[int64]int64, len(checkIns))
+	for _, count := range checkIns {
+		perMinute[count.Minute] = count.Count
+	}
+	for minute := since; !minute.After(now); minute = minute.Add(time.Minute) {
+		stats.CheckIns = append(stats.CheckIns, CheckInRate{Minute: minute.UTC(), CheckIns: perMinute[minute.Unix()]})
+	}
+
+	if stats.Loot.ByType, err = s.store.GetLootTypeUsage(engagement); err != nil {
+		return nil, fmt.Errorf("failed to get loot usage: %w", err)
+	}
+	for _, usage := range stats.Loot.ByType {
+		stats.Loot.Items += usage.Items
+		stats.Loot.Bytes += usage.Bytes
+	}
+
+	if stats.Listeners, err = s.listenerStats(ctx, engagement); err != nil {
+		return nil, err
+	}
+	if stats.Operators, err = s.operatorStats(engagement, since); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// listenerStats lists the listeners with their connection state, beacons and bridge traffic.
+func (s *statsService) listenerStats(ctx context.Context, engagement string) ([]ListenerStats, error) {
+	listeners, _, err := s.listenerService.ListListeners(ctx, 1, -1)
+	if err != nil {
+		return nil, err
+	}
+	beacons, err := s.store.GetListenerBeacons(engagement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count beacons per listener: %w", err)
+	}
+	perListener := make(map[string]data.ListenerBeacons, len(beacons))
+	for _, b := range beacons {
+		perListener[b.Listener] = b
+	}
+
+	stats := make([]ListenerStats, 0, len(listeners))
+	for _, listener := range listeners {
+		entry := ListenerStats{Name: listener.Name, Type: listener.Type, Active: listener.Active, Bridge: s.quotaService.Usage(listener.Name)}
+		if b, ok := perListener[listener.Name]; ok {
+			entry.Beacons = b.Beacons
+			entry.LastCheckIn = unixTimePtr(b.LastSeen)
+		}
+		stats = append(stats, entry)
+	}
+	return stats, nil
+}
+
+// operatorStats merges the tasks and API requests of each operator.
+func (s *statsService) operatorStats(engagement string, since time.Time) ([]OperatorStats, error) {
+	tasks, err := s.store.GetOperatorTaskActivity(engagement, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operator tasks: %w", err)
+	}
+	requests, err := s.store.GetOperatorRequestActivity(since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operator requests: %w", err)
+	}
+
+	var stats []OperatorStats
+	index := make(map[string]int)
+	// operator returns the entry of a username, adding it if needed
+	operator := func(username string) *OperatorStats {
+		if i, ok := index[username]; ok {
+			return &stats[i]
+		}
+		index[username] = len(stats)
+		stats = append(stats, OperatorStats{Username: username})
+		return &stats[len(stats)-1]
+	}
+	// lastActive keeps the later of two activity times
+	lastActive := func(entry *OperatorStats, unix int64) {
+		if t := unixTimePtr(unix); t != nil && (entry.LastActive == nil || t.After(*entry.LastActive)) {
+			entry.LastActive = t
+		}
+	}
+	for _, activity := range tasks {
+		entry := operator(activity.Username)
+		entry.Tasks = activity.Count
+		lastActive(entry, activity.LastActive)
+	}
+	for _, activity := range requests {
+		entry := operator(activity.Username)
+		entry.Requests = activity.Count
+		lastActive(entry, activity.LastActive)
+	}
+	return stats, nil
+}
+
+// unixTimePtr converts Unix seconds from an aggregate query, or nil if zero.
+func unixTimePtr(unix int64) *time.Time {
+	if unix == 0 {
+		return nil
+	}
+	t := time.Unix(unix, 0).UTC()
+	return &t
+}
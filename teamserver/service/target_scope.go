@@ -0,0 +1,136 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"simplec2/teamserver/data"
+)
+
+// TargetScope is the set of networks and hosts an engagement is authorized to operate against.
+// An empty scope places no restriction on targets.
+type TargetScope struct {
+	networks []*net.IPNet
+	hosts    []string
+}
+
+// ParseTargetScope validates and parses scope entries. Networks are CIDRs or single IPs,
+// hosts are hostnames or "*.domain" wildcards, matched case-insensitively.
+func ParseTargetScope(networks, hosts []string) (*TargetScope, error) {
+	scope := &TargetScope{}
+	for _, entry := range networks {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid scope network: %q", entry)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			entry = fmt.Sprintf("%s/%d", entry, bits)
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scope network: %q", entry)
+		}
+		scope.networks = append(scope.networks, network)
+	}
+	for _, entry := range hosts {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if strings.ContainsAny(entry, " \t,\"'/") || strings.Contains(strings.TrimPrefix(entry, "*."), "*") {
+			return nil, fmt.Errorf("invalid scope host: %q", entry)
+		}
+		scope.hosts = append(scope.hosts, entry)
+	}
+	return scope, nil
+}
+
+// EngagementScope returns the target scope stored on an engagement.
+func EngagementScope(engagement *data.Engagement) (*TargetScope, error) {
+	return ParseTargetScope(splitScopeList(engagement.ScopeNetworks), splitScopeList(engagement.ScopeHosts))
+}
+
+// Empty reports whether the scope is unrestricted.
+func (s *TargetScope) Empty() bool {
+	return len(s.networks) == 0 && len(s.hosts) == 0
+}
+
+// Networks returns the scope networks in CIDR notation.
+func (s *TargetScope) Networks() []string {
+	networks := make([]string, 0, len(s.networks))
+	for _, network := range s.networks {
+		networks = append(networks, network.String())
+	}
+	return networks
+}
+
+// Hosts returns the scope host patterns.
+func (s *TargetScope) Hosts() []string {
+	return append([]string(nil), s.hosts...)
+}
+
+// Contains reports whether a beacon is in scope: its internal IP, its remote IP
+// or its hostname must match the scope.
+func (s *TargetScope) Contains(beacon *data.Beacon) bool {
+	if s.Empty() {
+		return true
+	}
+	if s.containsIP(beacon.InternalIP) {
+		return true
+	}
+	remote := beacon.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if s.containsIP(remote) {
+		return true
+	}
+	return s.containsHost(beacon.Hostname)
+}
+
+func (s *TargetScope) containsIP(addr string) bool {
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return false
+	}
+	for _, network := range s.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TargetScope) containsHost(hostname string) bool {
+	hostname = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(hostname), "."))
+	if hostname == "" {
+		return false
+	}
+	for _, pattern := range s.hosts {
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(hostname, "."+suffix) {
+				return true
+			}
+		} else if hostname == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// splitScopeList splits a comma separated scope column.
+func splitScopeList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
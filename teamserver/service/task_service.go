@@ -5,10 +5,19 @@ import (
 	"fmt"
 
 	"simplec2/teamserver/data"
+	"simplec2/teamserver/tracing"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
 )
 
+// TaskOptions holds optional execution settings of a new task.
+type TaskOptions struct {
+	Timeout          int  // Seconds without output before the task times out; 0 uses the configured default, negative disables
+	RequeueOnTimeout bool // Queue the task once more after it timed out
+}
+
 // TaskService defines the interface for task-related business logic.
 type TaskService interface {
 	// GetTask retrieves a task by its ID.
@@ -17,11 +26,29 @@ type TaskService interface {
 	// GetTasksByBeaconID retrieves all tasks for a specific beacon.
 	GetTasksByBeaconID(ctx context.Context, beaconID string, status string) ([]data.Task, error)
 
-	// CreateTask creates a new task for a beacon.
-	CreateTask(ctx context.Context, beaconID string, command string, arguments string, source string) (*data.Task, error)
+	// ListTasks retrieves a page of the tasks of a beacon, oldest first.
+	ListTasks(ctx context.Context, query *data.TaskQuery) ([]data.Task, error)
+
+	// CreateTask creates a new task for a beacon on behalf of an operator. options may be nil.
+	// Returns ErrBeaconClaimed if another operator has claimed the beacon.
+	CreateTask(ctx context.Context, beaconID string, command string, arguments string, source string, operator string, options *TaskOptions) (*data.Task, error)
 
 	// UpdateTask updates a task.
 	UpdateTask(ctx context.Context, task *data.Task) error
+
+	// TechniqueCoverage returns the ATT&CK techniques of the tasks dispatched in the engagement, grouped by tactic.
+	TechniqueCoverage(ctx context.Context) ([]TacticCoverage, error)
+
+	// GetBeaconSettings returns the sleep and jitter a beacon confirmed, and the ones last requested.
+	GetBeaconSettings(ctx context.Context, beaconID string) (*BeaconSettingsState, error)
+
+	// UpdateBeaconSettings queues the sleep task applying new settings to a beacon and records them as
+	// pending. Returns ErrInvalidSettings for values the agent rejects, and ErrBeaconClaimed like CreateTask.
+	UpdateBeaconSettings(ctx context.Context, beaconID string, update BeaconSettingsUpdate, operator string) (*BeaconSettingsState, *data.Task, error)
+
+	// ResolveBeaconSettings moves the pending settings a finished task applies to confirmed or failed.
+	// Returns the beacon's settings, or nil if the task resolved none.
+	ResolveBeaconSettings(ctx context.Context, task *data.Task) (*BeaconSettingsState, error)
 }
 
 // taskService implements the TaskService interface.
@@ -42,13 +69,16 @@ func (s *taskService) GetTask(ctx context.Context, taskID string) (*data.Task, e
 	if err != nil {
 		return nil, fmt.Errorf("failed to get task: %w", err)
 	}
+	if !inEngagement(ctx, task.Engagement) {
+		return nil, fmt.Errorf("failed to get task: %w", gorm.ErrRecordNotFound)
+	}
 	return task, nil
 }
 
 // GetTasksByBeaconID retrieves all tasks for a specific beacon.
 func (s *taskService) GetTasksByBeaconID(ctx context.Context, beaconID string, status string) ([]data.Task, error) {
 	// First, ensure beacon exists
-	if _, err := s.store.GetBeacon(beaconID); err != nil {
+	if _, err := getBeacon(ctx, s.store, beaconID); err != nil {
 		return nil, fmt.Errorf("beacon not found: %w", err)
 	}
 
@@ -59,32 +89,63 @@ func (s *taskService) GetTasksByBeaconID(ctx context.Context, beaconID string, s
 	return tasks, nil
 }
 
-// CreateTask creates a new task for a beacon.
-func (s *taskService) CreateTask(ctx context.Context, beaconID string, command string, arguments string, source string) (*data.Task, error) {
+// ListTasks retrieves a page of the tasks of a beacon, oldest first.
+func (s *taskService) ListTasks(ctx context.Context, query *data.TaskQuery) ([]data.Task, error) {
+	if _, err := getBeacon(ctx, s.store, query.BeaconID); err != nil {
+		return nil, fmt.Errorf("beacon not found: %w", err)
+	}
+
+	tasks, err := s.store.GetTaskPage(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tasks for beacon: %w", err)
+	}
+	return tasks, nil
+}
+
+// CreateTask creates a new task for a beacon on behalf of an operator. options may be nil.
+func (s *taskService) CreateTask(ctx context.Context, beaconID string, command string, arguments string, source string, operator string, options *TaskOptions) (task *data.Task, err error) {
+	ctx, span := tracing.Start(ctx, "TaskService.CreateTask", attribute.String("simplec2.beacon_id", beaconID), attribute.String("simplec2.command", command))
+	defer func() { tracing.End(span, err) }()
+	store := s.store.WithContext(ctx)
+
 	// First, ensure beacon exists
-	if _, err := s.store.GetBeacon(beaconID); err != nil {
+	beacon, err := getBeacon(ctx, store, beaconID)
+	if err != nil {
 		return nil, fmt.Errorf("beacon not found: %w", err)
 	}
+	if err := checkClaim(store, beacon.BeaconID, operator); err != nil {
+		return nil, err
+	}
 
-	task := &data.Task{
-		TaskID:    uuid.New().String(),
-		BeaconID:  beaconID,
-		Command:   command,
-		Arguments: arguments,
-		Status:    "queued",
-		Source:    source,
+	task = &data.Task{
+		TaskID:     uuid.New().String(),
+		BeaconID:   beaconID,
+		Command:    command,
+		Arguments:  arguments,
+		Status:     "queued",
+		Source:     source,
+		Operator:   operator,
+		Engagement: beacon.Engagement,
+	}
+	if options != nil {
+		task.Timeout = options.Timeout
+		task.RequeueOnTimeout = options.RequeueOnTimeout
 	}
 
-	if err := s.store.CreateTask(task); err != nil {
+	if err := store.CreateTask(task); err != nil {
 		return nil, fmt.Errorf("failed to create task: %w", err)
 	}
+	span.SetAttributes(attribute.String("simplec2.task_id", task.TaskID))
 
 	return task, nil
 }
 
 // UpdateTask updates a task.
-func (s *taskService) UpdateTask(ctx context.Context, task *data.Task) error {
-	if err := s.store.UpdateTask(task); err != nil {
+func (s *taskService) UpdateTask(ctx context.Context, task *data.Task) (err error) {
+	ctx, span := tracing.Start(ctx, "TaskService.UpdateTask", attribute.String("simplec2.task_id", task.TaskID), attribute.String("simplec2.task_status", task.Status))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.store.WithContext(ctx).UpdateTask(task); err != nil {
 		return fmt.Errorf("failed to update task: %w", err)
 	}
 	return nil
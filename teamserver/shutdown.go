@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"simplec2/pkg/logger"
+)
+
+const (
+	// shutdownTimeout bounds a graceful shutdown; what is still running afterwards is cut off
+	shutdownTimeout = 30 * time.Second
+	// grpcDrainTimeout is how long in-flight gRPC calls may take to finish during a shutdown
+	grpcDrainTimeout = 10 * time.Second
+
+	// listenFDsEnv names the listening sockets a restarted TeamServer inherits, in the order of
+	// their file descriptors from 3 on, e.g. "grpc,api"
+	listenFDsEnv = "SIMPLEC2_LISTEN_FDS"
+)
+
+// inheritedListeners are the listening sockets handed over by the TeamServer that restarted this
+// one, by name.
+var inheritedListeners = func() map[string]*os.File {
+	files := make(map[string]*os.File)
+	names := os.Getenv(listenFDsEnv)
+	if names == "" {
+		return files
+	}
+	os.Unsetenv(listenFDsEnv)
+	for i, name := range strings.Split(names, ",") {
+		files[name] = os.NewFile(uintptr(3+i), name)
+	}
+	return files
+}()
+
+// listen returns the listening socket for addr, inherited from the previous TeamServer if it
+// restarted this one.
+func listen(name, addr string) (net.Listener, error) {
+	if file, ok := inheritedListeners[name]; ok {
+		delete(inheritedListeners, name)
+		defer file.Close()
+		lis, err := net.FileListener(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to use inherited %s socket: %w", name, err)
+		}
+		logger.Infof("Using the %s socket inherited from the previous TeamServer", name)
+		return lis, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// NewDrainStreamInterceptor ends the long-lived bidirectional streams (the listener control and
+// beacon relay streams) once stopping is closed, so a graceful stop doesn't wait for them. The
+// listeners reconnect, to the restarted TeamServer if there is one.
+func NewDrainStreamInterceptor(stopping <-chan struct{}) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !info.IsClientStream || !info.IsServerStream {
+			return handler(srv, ss)
+		}
+		done := make(chan error, 1)
+		go func() { done <- handler(srv, ss) }()
+		select {
+		case err := <-done:
+			return err
+		case <-stopping:
+			// Returning ends the stream, which makes the handler return too
+			return status.Error(codes.Unavailable, "TeamServer is shutting down")
+		}
+	}
+}
+
+// shutdownStep is a part of a graceful shutdown, run in order.
+type shutdownStep struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// stopServers stops accepting API and gRPC requests and waits for the ones in progress.
+func stopServers(ctx context.Context, apiServer *http.Server, grpcServer *grpc.Server, stopping chan struct{}) error {
+	close(stopping)
+
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	err := apiServer.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("API requests still running: %w", err)
+		apiServer.Close()
+	}
+
+	select {
+	case <-grpcStopped:
+	case <-time.After(grpcDrainTimeout):
+		logger.Warnf("gRPC calls still running after %s, closing them", grpcDrainTimeout)
+		grpcServer.Stop()
+		<-grpcStopped
+	}
+	return err
+}
+
+// shutdown runs the steps of a graceful shutdown within shutdownTimeout. A failed step is logged
+// and the next one runs anyway.
+func shutdown(steps []shutdownStep) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, step := range steps {
+		if err := step.run(ctx); err != nil {
+			logger.Errorf("Shutdown: failed to %s: %v", step.name, err)
+			continue
+		}
+		logger.Infof("Shutdown: %s done", step.name)
+	}
+}
@@ -0,0 +1,103 @@
+package siem
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// cefVendor, cefProduct and cefVersion identify SimpleC2 in CEF headers.
+const (
+	cefVendor  = "SimpleC2"
+	cefProduct = "TeamServer"
+	cefVersion = "1.0"
+)
+
+// cefFields maps event fields to CEF extension keys. Fields without a mapping are added to msg.
+var cefFields = []struct {
+	field string
+	key   string
+	label string
+}{
+	{"method", "requestMethod", ""},
+	{"path", "request", ""},
+	{"status", "cn1", "httpStatus"},
+	{"auth_method", "cs1", "authMethod"},
+	{"role", "cs2", "role"},
+	{"beacon_id", "cs3", "beaconId"},
+	{"command", "cs4", "command"},
+	{"listener", "cs5", "listener"},
+}
+
+// formatCEF renders an event as an ArcSight Common Event Format message.
+func formatCEF(event *Event) string {
+	signature := event.Type + ":" + event.Name
+	var ext []string
+	ext = append(ext, "rt="+strconv.FormatInt(event.Time.UnixMilli(), 10))
+	if event.Username != "" {
+		ext = append(ext, "suser="+cefExtension(event.Username))
+	}
+	if event.SourceIP != "" {
+		ext = append(ext, "src="+cefExtension(event.SourceIP))
+	}
+
+	used := make(map[string]bool)
+	for _, m := range cefFields {
+		value, ok := event.Fields[m.field]
+		if !ok {
+			continue
+		}
+		used[m.field] = true
+		if value == "" {
+			continue
+		}
+		ext = append(ext, m.key+"="+cefExtension(value))
+		if m.label != "" {
+			ext = append(ext, m.key+"Label="+m.label)
+		}
+	}
+
+	msg := event.Message
+	for _, key := range sortedKeys(event.Fields) {
+		if !used[key] {
+			msg += fmt.Sprintf(" %s=%s", key, event.Fields[key])
+		}
+	}
+	ext = append(ext, "msg="+cefExtension(msg))
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefVendor, cefProduct, cefVersion,
+		cefHeader(signature), cefHeader(event.Name), event.Severity, strings.Join(ext, " "))
+}
+
+// formatJSON renders an event as a single-line JSON document.
+func formatJSON(event *Event) string {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Sprintf(`{"type":%q,"name":%q}`, event.Type, event.Name)
+	}
+	return string(b)
+}
+
+func cefHeader(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+func cefExtension(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "=", `\=`)
+	return strings.NewReplacer("\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
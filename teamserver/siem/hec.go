@@ -0,0 +1,82 @@
+package siem
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"simplec2/pkg/config"
+)
+
+// hecSender posts events to a Splunk HTTP Event Collector.
+type hecSender struct {
+	url        string
+	token      string
+	sourcetype string
+	client     *http.Client
+}
+
+// hecEvent is the envelope of a single event in a HEC request.
+type hecEvent struct {
+	Time       float64 `json:"time"`
+	Source     string  `json:"source"`
+	Sourcetype string  `json:"sourcetype"`
+	Event      *Event  `json:"event"`
+}
+
+func newHECSender(cfg *config.SIEMConfig) (*hecSender, error) {
+	if cfg.URL == "" || cfg.Token == "" {
+		return nil, fmt.Errorf("siem url and token are required for splunk_hec")
+	}
+	sourcetype := cfg.Sourcetype
+	if sourcetype == "" {
+		sourcetype = "simplec2"
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	return &hecSender{
+		url:        cfg.URL,
+		token:      cfg.Token,
+		sourcetype: sourcetype,
+		client:     &http.Client{Transport: transport, Timeout: 10 * time.Second},
+	}, nil
+}
+
+// send posts the batch as concatenated JSON events in one request.
+func (s *hecSender) send(events []*Event) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, event := range events {
+		if err := enc.Encode(&hecEvent{
+			Time:       float64(event.Time.UnixMilli()) / 1000,
+			Source:     "simplec2:" + event.Type,
+			Sourcetype: s.sourcetype,
+			Event:      event,
+		}); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("splunk hec returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
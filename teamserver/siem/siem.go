@@ -0,0 +1,164 @@
+// Package siem forwards audit entries and security alerts to an external SIEM
+// over syslog (JSON or CEF payloads) or the Splunk HTTP Event Collector.
+package siem
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+)
+
+// Event types.
+const (
+	TypeAudit = "audit"
+	TypeAlert = "alert"
+)
+
+const (
+	defaultQueueSize = 10000
+	maxBatch         = 100
+	flushInterval    = time.Second
+)
+
+// Event is an audit entry or security alert to forward.
+type Event struct {
+	Time     time.Time         `json:"time"`
+	Type     string            `json:"type"`     // "audit" or "alert"
+	Name     string            `json:"name"`     // e.g. "POST /api/beacons/:beacon_id/tasks" or "refresh_token_reuse"
+	Severity int               `json:"severity"` // 0 (lowest) to 10 (highest), as in CEF
+	Username string            `json:"username,omitempty"`
+	SourceIP string            `json:"source_ip,omitempty"`
+	Message  string            `json:"message"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+// sender delivers a batch of events to the SIEM.
+type sender interface {
+	send(events []*Event) error
+}
+
+// Forwarder ships events to the SIEM in the background.
+// Events are queued without blocking; when the SIEM is slow or unreachable the oldest are dropped.
+type Forwarder struct {
+	sender      sender
+	minSeverity int
+	queue       chan *Event
+	dropped     atomic.Int64
+	failed      atomic.Int64
+
+	closeOnce sync.Once
+	done      chan struct{}
+	finished  chan struct{}
+}
+
+// New creates a forwarder for the configured SIEM and starts it.
+func New(cfg *config.SIEMConfig) (*Forwarder, error) {
+	var s sender
+	var err error
+	switch cfg.Type {
+	case "syslog", "cef":
+		s, err = newSyslogSender(cfg)
+	case "splunk_hec":
+		s, err = newHECSender(cfg)
+	default:
+		return nil, fmt.Errorf("invalid siem type '%s' (must be 'syslog', 'cef' or 'splunk_hec')", cfg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	f := &Forwarder{
+		sender:      s,
+		minSeverity: cfg.MinSeverity,
+		queue:       make(chan *Event, queueSize),
+		done:        make(chan struct{}),
+		finished:    make(chan struct{}),
+	}
+	go f.run()
+	return f, nil
+}
+
+// Forward queues an event. It never blocks the caller.
+// Audit events below the configured minimum severity are skipped; alerts are always forwarded.
+func (f *Forwarder) Forward(event *Event) {
+	if event.Type == TypeAudit && event.Severity < f.minSeverity {
+		return
+	}
+	for {
+		select {
+		case f.queue <- event:
+			return
+		default:
+		}
+		select {
+		case <-f.queue:
+			f.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+func (f *Forwarder) run() {
+	defer close(f.finished)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Event, 0, maxBatch)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := f.sender.send(batch); err != nil {
+			if f.failed.Add(int64(len(batch))) == int64(len(batch)) {
+				logger.Errorf("Failed to forward events to SIEM: %v", err)
+			}
+		}
+		batch = make([]*Event, 0, maxBatch)
+	}
+
+	for {
+		select {
+		case event := <-f.queue:
+			batch = append(batch, event)
+			if len(batch) >= maxBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			if n := f.dropped.Swap(0); n > 0 {
+				logger.Warnf("SIEM forwarder queue full, dropped %d oldest events", n)
+			}
+			if n := f.failed.Swap(0); n > 0 {
+				logger.Warnf("SIEM forwarder could not deliver %d events", n)
+			}
+		case <-f.done:
+			// Send whatever is still queued before stopping
+			for {
+				select {
+				case event := <-f.queue:
+					batch = append(batch, event)
+					if len(batch) >= maxBatch {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Close sends all queued events and stops the forwarder.
+func (f *Forwarder) Close() {
+	f.closeOnce.Do(func() { close(f.done) })
+	<-f.finished
+}
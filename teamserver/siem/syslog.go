@@ -0,0 +1,121 @@
+package siem
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"simplec2/pkg/config"
+)
+
+// syslogFacility is local0.
+const syslogFacility = 16
+
+const dialTimeout = 5 * time.Second
+
+// syslogSender writes RFC 5424 messages over UDP, TCP or TLS.
+// The payload is JSON for type "syslog" and CEF for type "cef".
+type syslogSender struct {
+	network            string
+	address            string
+	insecureSkipVerify bool
+	cef                bool
+	hostname           string
+	conn               net.Conn
+}
+
+func newSyslogSender(cfg *config.SIEMConfig) (*syslogSender, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("siem address is required for %s", cfg.Type)
+	}
+	network := cfg.Network
+	if network == "" {
+		network = "udp"
+	}
+	if network != "udp" && network != "tcp" && network != "tls" {
+		return nil, fmt.Errorf("invalid siem network '%s' (must be 'udp', 'tcp' or 'tls')", network)
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &syslogSender{
+		network:            network,
+		address:            cfg.Address,
+		insecureSkipVerify: cfg.InsecureSkipVerify,
+		cef:                cfg.Type == "cef",
+		hostname:           hostname,
+	}, nil
+}
+
+func (s *syslogSender) dial() (net.Conn, error) {
+	if s.network == "tls" {
+		dialer := &net.Dialer{Timeout: dialTimeout}
+		return tls.DialWithDialer(dialer, "tcp", s.address, &tls.Config{InsecureSkipVerify: s.insecureSkipVerify})
+	}
+	return net.DialTimeout(s.network, s.address, dialTimeout)
+}
+
+func (s *syslogSender) send(events []*Event) error {
+	for _, event := range events {
+		if err := s.write(s.format(event)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write sends one message, reconnecting once if the connection was lost.
+func (s *syslogSender) write(msg []byte) error {
+	for attempt := 0; ; attempt++ {
+		if s.conn == nil {
+			conn, err := s.dial()
+			if err != nil {
+				return err
+			}
+			s.conn = conn
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+		_, err := s.conn.Write(msg)
+		if err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+// format renders an RFC 5424 message. Stream transports use newline framing.
+func (s *syslogSender) format(event *Event) []byte {
+	payload := formatJSON(event)
+	if s.cef {
+		payload = formatCEF(event)
+	}
+	pri := syslogFacility*8 + syslogSeverity(event.Severity)
+	msg := fmt.Sprintf("<%d>1 %s %s simplec2 - %s - %s", pri, event.Time.UTC().Format(time.RFC3339Nano), s.hostname, event.Type, payload)
+	if s.network != "udp" {
+		msg += "\n"
+	}
+	return []byte(msg)
+}
+
+// syslogSeverity maps a CEF severity (0-10) to a syslog severity.
+func syslogSeverity(severity int) int {
+	switch {
+	case severity >= 9:
+		return 2 // critical
+	case severity >= 7:
+		return 3 // error
+	case severity >= 5:
+		return 4 // warning
+	case severity >= 3:
+		return 5 // notice
+	default:
+		return 6 // informational
+	}
+}
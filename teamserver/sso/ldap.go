@@ -0,0 +1,97 @@
+package sso
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"simplec2/pkg/config"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapTimeout bounds each LDAP request.
+const ldapTimeout = 10 * time.Second
+
+// LDAPAuthenticator verifies operator credentials with an LDAP bind.
+type LDAPAuthenticator struct {
+	cfg *config.LDAPConfig
+}
+
+// NewLDAPAuthenticator creates an authenticator for the given directory.
+func NewLDAPAuthenticator(cfg *config.LDAPConfig) (*LDAPAuthenticator, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, fmt.Errorf("ldap requires url and base_dn")
+	}
+	return &LDAPAuthenticator{cfg: cfg}, nil
+}
+
+// Authenticate looks up the user, binds as them to check the password and returns their groups.
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*Identity, error) {
+	// An empty password would be an unauthenticated bind, which many servers accept
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("username and password are required")
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.cfg.InsecureSkipVerify}
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap: %w", err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(ldapTimeout)
+
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			return nil, fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+
+	if a.cfg.BindDN != "" {
+		err = conn.Bind(a.cfg.BindDN, a.cfg.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind service account: %w", err)
+	}
+
+	userFilter := a.cfg.UserFilter
+	if userFilter == "" {
+		userFilter = "(uid=%s)"
+	}
+	groupAttribute := a.cfg.GroupAttribute
+	if groupAttribute == "" {
+		groupAttribute = "memberOf"
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		fmt.Sprintf(userFilter, ldap.EscapeFilter(username)),
+		[]string{"dn", groupAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search user: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, fmt.Errorf("user not found or not unique")
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return nil, fmt.Errorf("invalid credentials: %w", err)
+	}
+
+	return &Identity{
+		Provider: "ldap",
+		Username: username,
+		Groups:   entry.GetEqualFoldAttributeValues(groupAttribute),
+	}, nil
+}
+
+// RoleMapping returns the configured group to role mapping.
+func (a *LDAPAuthenticator) RoleMapping() (map[string]string, string) {
+	return a.cfg.RoleMapping, a.cfg.DefaultRole
+}
@@ -0,0 +1,159 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"simplec2/pkg/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// loginTimeout bounds how long a browser may take to complete an OIDC login.
+const loginTimeout = 10 * time.Minute
+
+// pendingLogin is an authorization request waiting for its callback.
+type pendingLogin struct {
+	nonce     string
+	expiresAt time.Time
+}
+
+// OIDCProvider performs the OpenID Connect authorization code flow.
+type OIDCProvider struct {
+	cfg      *config.OIDCConfig
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+
+	mu      sync.Mutex
+	pending map[string]pendingLogin // keyed by state
+}
+
+// NewOIDCProvider discovers the issuer and prepares the OAuth2 client.
+func NewOIDCProvider(ctx context.Context, cfg *config.OIDCConfig) (*OIDCProvider, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("oidc requires issuer_url, client_id and redirect_url")
+	}
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc issuer: %w", err)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email", "groups"}
+	}
+	return &OIDCProvider{
+		cfg: cfg,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		pending:  make(map[string]pendingLogin),
+	}, nil
+}
+
+// AuthCodeURL starts a login and returns the IdP URL to redirect the browser to.
+func (p *OIDCProvider) AuthCodeURL() (string, error) {
+	state, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	for s, login := range p.pending {
+		if now.After(login.expiresAt) {
+			delete(p.pending, s)
+		}
+	}
+	p.pending[state] = pendingLogin{nonce: nonce, expiresAt: now.Add(loginTimeout)}
+	p.mu.Unlock()
+
+	return p.oauth.AuthCodeURL(state, oidc.Nonce(nonce)), nil
+}
+
+// Exchange completes a login: it redeems the code and verifies the ID token.
+func (p *OIDCProvider) Exchange(ctx context.Context, state, code string) (*Identity, error) {
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || time.Now().After(login.expiresAt) {
+		return nil, fmt.Errorf("unknown or expired login state")
+	}
+
+	token, err := p.oauth.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if idToken.Nonce != login.nonce {
+		return nil, fmt.Errorf("id_token nonce mismatch")
+	}
+
+	var claims map[string]json.RawMessage
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse id_token claims: %w", err)
+	}
+
+	usernameClaim := p.cfg.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	var username string
+	if err := json.Unmarshal(claims[usernameClaim], &username); err != nil || username == "" {
+		return nil, fmt.Errorf("id_token has no '%s' claim", usernameClaim)
+	}
+
+	groupsClaim := p.cfg.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	var groups []string
+	if raw, ok := claims[groupsClaim]; ok {
+		if err := json.Unmarshal(raw, &groups); err != nil {
+			return nil, fmt.Errorf("invalid '%s' claim: %w", groupsClaim, err)
+		}
+	}
+
+	return &Identity{Provider: "oidc", Username: username, Groups: groups}, nil
+}
+
+// RoleMapping returns the configured group to role mapping.
+func (p *OIDCProvider) RoleMapping() (map[string]string, string) {
+	return p.cfg.RoleMapping, p.cfg.DefaultRole
+}
+
+// UIRedirectURL returns where the browser is sent after a successful login.
+func (p *OIDCProvider) UIRedirectURL() string {
+	return p.cfg.UIRedirectURL
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
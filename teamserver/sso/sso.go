@@ -0,0 +1,37 @@
+// Package sso implements external identity providers (OIDC, LDAP) for operator login.
+package sso
+
+import "strings"
+
+// Identity is a user authenticated by an external identity provider.
+type Identity struct {
+	Provider string   // "oidc" or "ldap"
+	Username string   // Login name, becomes the operator username
+	Groups   []string // Group names or DNs reported by the provider
+}
+
+// groupNames returns a group as given plus its CN when it is a DN,
+// so role mappings can use either "cn=red-team,ou=groups,dc=example,dc=com" or "red-team".
+func groupNames(group string) []string {
+	names := []string{group}
+	first, _, _ := strings.Cut(group, ",")
+	if key, value, ok := strings.Cut(first, "="); ok && strings.EqualFold(strings.TrimSpace(key), "cn") {
+		names = append(names, strings.TrimSpace(value))
+	}
+	return names
+}
+
+// MatchGroups returns the values of mapping whose keys match one of the groups (case-insensitive).
+func MatchGroups(mapping map[string]string, groups []string) []string {
+	var matched []string
+	for _, group := range groups {
+		for _, name := range groupNames(group) {
+			for key, value := range mapping {
+				if strings.EqualFold(key, name) {
+					matched = append(matched, value)
+				}
+			}
+		}
+	}
+	return matched
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+	"simplec2/teamserver/service"
+)
+
+// StartStatusCalculator periodically derives the status of every beacon that is not archived,
+// persists the ones that changed and emits BEACON_WENT_INACTIVE / BEACON_WENT_ACTIVE, so listing
+// and filtering beacons by status only reads the stored column.
+func (s *server) StartStatusCalculator(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// The first pass only catches up on what changed while the TeamServer was down,
+		// so a restart doesn't report every beacon that died long ago.
+		s.calculateStatuses(false)
+		for range ticker.C {
+			s.calculateStatuses(true)
+		}
+	}()
+}
+
+// calculateStatuses updates the persisted statuses of all beacons that are not archived.
+func (s *server) calculateStatuses(notify bool) {
+	now := time.Now()
+	for page := 1; ; page++ {
+		beacons, _, err := s.Store.GetBeacons(&data.BeaconQuery{Page: page, Limit: 100})
+		if err != nil {
+			logger.Errorf("Error listing beacons for status calculator: %v", err)
+			return
+		}
+		for i := range beacons {
+			beacon := &beacons[i]
+			beacon.LastSeen = s.lastSeenOf(beacon)
+			status := service.BeaconStatus(beacon, now)
+			if status == beacon.Status {
+				continue
+			}
+			// A check-in may have changed the status meanwhile; it wins
+			changed, err := s.Store.SetBeaconStatus(beacon.BeaconID, beacon.Status, status)
+			if err != nil {
+				logger.Errorf("Error updating status of beacon %s: %v", beacon.BeaconID, err)
+				continue
+			}
+			if changed && notify {
+				s.reportStatusChange(beacon, beacon.Status, status)
+			}
+		}
+		if len(beacons) < 100 {
+			break
+		}
+	}
+}
+
+// reportStatusChange broadcasts BEACON_WENT_INACTIVE when a beacon stops checking in and
+// BEACON_WENT_ACTIVE when an inactive beacon is back.
+func (s *server) reportStatusChange(beacon *data.Beacon, previous, status string) {
+	eventType := ""
+	switch {
+	case status == "inactive":
+		eventType = "BEACON_WENT_INACTIVE"
+	case previous == "inactive" && status == "active":
+		eventType = "BEACON_WENT_ACTIVE"
+	default:
+		return
+	}
+	logger.Infof("Beacon %s (%s@%s) went %s, last seen %s", beacon.BeaconID, beacon.Username, beacon.Hostname, status, beacon.LastSeen.Format(time.RFC3339))
+	s.broadcastEvent(beacon.Engagement, eventType, map[string]interface{}{
+		"beacon_id":       beacon.BeaconID,
+		"hostname":        beacon.Hostname,
+		"username":        beacon.Username,
+		"previous_status": previous,
+		"status":          status,
+		"last_seen":       beacon.LastSeen,
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"simplec2/pkg/logger"
+	"simplec2/teamserver/data"
+)
+
+// StartTaskTimeoutRoutine periodically marks dispatched tasks that stopped producing output as timed out.
+func (s *server) StartTaskTimeoutRoutine(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.expireTasks()
+		}
+	}()
+}
+
+// taskTimeout returns how long a task may go without output, or 0 if it never times out.
+func (s *server) taskTimeout(task *data.Task) time.Duration {
+	// These end the agent process, so no output ever comes back
+	if task.Command == "exit" || task.Command == "upgrade" {
+		return 0
+	}
+	switch {
+	case task.Timeout < 0:
+		return 0
+	case task.Timeout > 0:
+		return time.Duration(task.Timeout) * time.Second
+	}
+	return s.Config.Tasks.GetTimeout(task.Command)
+}
+
+// expireTasks marks dispatched and running tasks whose last output (or dispatch) is older than
+// their timeout as "timed_out" and broadcasts TASK_FAILED. Tasks that asked for it are queued once more.
+func (s *server) expireTasks() {
+	tasks, err := s.Store.GetTasksByStatus("dispatched", "running")
+	if err != nil {
+		logger.Errorf("Error getting active tasks for timeout check: %v", err)
+		return
+	}
+
+	for i := range tasks {
+		task := &tasks[i]
+		timeout := s.taskTimeout(task)
+		// UpdatedAt moves with every dispatch, acknowledgement and progress update
+		if timeout == 0 || time.Since(task.UpdatedAt) < timeout {
+			continue
+		}
+
+		reason := fmt.Sprintf("No output from the beacon within %s", timeout)
+		task.Status = "timed_out"
+		if err := s.Store.UpdateTask(task); err != nil {
+			logger.Errorf("Error marking task %s as timed out: %v", task.TaskID, err)
+			continue
+		}
+		logger.Warnf("Task %s (%s) for beacon %s timed out after %s", task.TaskID, task.Command, task.BeaconID, timeout)
+		s.broadcastEvent(task.Engagement, "TASK_FAILED", map[string]interface{}{
+			"task_id":   task.TaskID,
+			"beacon_id": task.BeaconID,
+			"command":   task.Command,
+			"status":    task.Status,
+			"reason":    reason,
+		})
+
+		if !task.RequeueOnTimeout {
+			s.resolveBeaconSettings(context.Background(), task)
+			s.advancePlaybook(task)
+			continue
+		}
+
+		// Only requeued once; the agent may still be working on the first attempt
+		task.Status = "queued"
+		task.Output = ""
+		task.RequeueOnTimeout = false
+		task.DispatchedAt = nil
+		task.AckedAt = nil
+		task.DispatchAttempts = 0
+		if err := s.Store.UpdateTask(task); err != nil {
+			logger.Errorf("Error requeueing timed out task %s: %v", task.TaskID, err)
+			task.Status = "timed_out"
+			s.resolveBeaconSettings(context.Background(), task)
+			s.advancePlaybook(task)
+			continue
+		}
+		logger.Infof("Requeued timed out task %s for beacon %s", task.TaskID, task.BeaconID)
+		s.broadcastEvent(task.Engagement, "TASK_REQUEUED", task)
+	}
+}
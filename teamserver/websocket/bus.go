@@ -0,0 +1,28 @@
+package websocket
+
+// Bus shares broadcast events between the hubs of several TeamServer replicas, so the WebSocket
+// clients of every replica receive all events whichever replica broadcast them.
+type Bus interface {
+	// Publish sends an event broadcast by this replica to the others. It is called by the hub's
+	// loop, so it must not block.
+	Publish(engagement string, event []byte)
+	// Subscribe makes the bus call deliver with every event published by another replica.
+	Subscribe(deliver func(engagement string, event []byte))
+}
+
+// SetBus makes the hub publish the events it broadcasts on a bus and broadcast the events of the
+// other replicas to its clients. Events of other replicas are already persisted and numbered, and
+// are only passed to the cluster observers. Call it before Run.
+func (h *Hub) SetBus(bus Bus) {
+	h.bus = bus
+	bus.Subscribe(func(engagement string, event []byte) {
+		h.broadcast <- message{engagement: engagement, data: event, remote: true}
+	})
+}
+
+// AddClusterObserver makes the hub pass every event it broadcasts to an observer, including the
+// events broadcast by other replicas, e.g. for work that falls to whichever replica the affected
+// listener is connected to. Call it before Run.
+func (h *Hub) AddClusterObserver(observer Observer) {
+	h.clusterObservers = append(h.clusterObservers, observer)
+}
@@ -3,18 +3,15 @@ package websocket
 import (
 	"bytes"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"simplec2/pkg/logger"
 )
 
-const (
-	writeWait = 10 * time.Second
-	pongWait = 60 * time.Second
-	pingPeriod = (pongWait * 9) / 10
-	maxMessageSize = 512
-)
+// Keepalive timings and the send buffer size come from the hub's config.WebSocketConfig
+const maxMessageSize = 8192 // Subscriptions can list many beacons
 
 var (
 	newline = []byte{'\n'}
@@ -36,6 +33,21 @@ type Client struct {
 	hub *Hub
 	conn *websocket.Conn
 	send chan []byte
+	// Engagement the client works in; it only receives events of that engagement
+	engagement string
+	// Sequence number of the last event the client saw before reconnecting; 0 for a new client
+	lastSeenSeq uint64
+	// Events the client asked for; nil for all. Only accessed by the hub's Run loop.
+	subscription *Subscription
+	// Events discarded because the client fell behind (drop_oldest policy). Only accessed by the hub's Run loop.
+	dropped int
+
+	// Presence of the operator; empty username for connections without one. Only accessed by the hub's Run loop.
+	username      string
+	connectedAt   time.Time
+	lastActive    time.Time
+	focusedBeacon string
+	focusedAt     time.Time
 }
 
 // ReadPump pumps messages from the websocket connection to the hub.
@@ -45,32 +57,46 @@ func (c *Client) ReadPump() {
 		c.conn.Close()
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	// The connection is dropped if neither a pong nor a message arrives within the pong timeout
+	pongTimeout := c.hub.config.GetPongTimeout()
+	c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongTimeout)); return nil })
 	for {
-		_, message, err := c.conn.ReadMessage()
+		_, msg, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				logger.Errorf("WebSocket error: %v", err)
 			}
 			break
 		}
-		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
-		c.hub.broadcast <- message
+		c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+		msg = bytes.TrimSpace(bytes.Replace(msg, newline, space, -1))
+		if subscription, ok := parseSubscription(msg); ok {
+			c.hub.subscribe <- subscribeRequest{client: c, subscription: subscription}
+			continue
+		}
+		if beaconID, ok := parseFocus(msg); ok {
+			c.hub.focus <- focusRequest{client: c, beaconID: beaconID}
+			continue
+		}
+		c.hub.broadcast <- message{engagement: c.engagement, data: msg}
 	}
 }
 
 // WritePump pumps messages from the hub to the websocket connection.
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.hub.config.GetPingInterval())
+	// A write that stalls past the timeout closes the connection, so a stuck client can't hold this goroutine
+	writeTimeout := c.hub.config.GetWriteTimeout()
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		c.hub.writers.Done()
 	}()
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
 			if !ok {
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
@@ -82,17 +108,27 @@ func (c *Client) WritePump() {
 			}
 			w.Write(message)
 
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write(newline)
-				w.Write(<-c.send)
+			// Batch what is already queued; with the drop_oldest policy the hub may take queued
+			// events back concurrently, so never wait for more
+		batch:
+			for n := len(c.send); n > 0; n-- {
+				select {
+				case queued, ok := <-c.send:
+					if !ok {
+						break batch
+					}
+					w.Write(newline)
+					w.Write(queued)
+				default:
+					break batch
+				}
 			}
 
 			if err := w.Close(); err != nil {
 				return
 			}
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -101,13 +137,20 @@ func (c *Client) WritePump() {
 }
 
 // ServeWs handles websocket requests from the peer.
-func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
+// The client receives global events and the events of the given engagement.
+// A reconnecting client passes the "seq" of the last event it saw as the last_seen_seq
+// query parameter to first receive the events it missed.
+// The operator's username is shown in the hub's presence list.
+func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, engagement, username string) {
+	lastSeenSeq, _ := strconv.ParseUint(r.URL.Query().Get("last_seen_seq"), 10, 64)
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logger.Errorf("WebSocket upgrade error: %v", err)
 		return
 	}
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256)}
+	client := &Client{hub: hub, conn: conn, send: make(chan []byte, hub.config.GetSendBuffer()), engagement: engagement, lastSeenSeq: lastSeenSeq, username: username}
+	hub.writers.Add(1)
 	client.hub.register <- client
 
 	go client.WritePump()
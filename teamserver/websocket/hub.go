@@ -1,74 +1,366 @@
 package websocket
 
-import "simplec2/pkg/safe"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"simplec2/pkg/config"
+	"simplec2/pkg/logger"
+	"simplec2/pkg/safe"
+	"simplec2/teamserver/data"
+)
+
+// maxReplay is the most missed events replayed to a reconnecting client, fewer if the client's send
+// buffer is smaller. A client that missed more, or events retention already deleted, receives
+// REPLAY_TRUNCATED and reloads instead.
+const maxReplay = 200
+
+// EventStore persists broadcast events so reconnecting clients can replay the ones they missed.
+type EventStore interface {
+	CreateEvent(event *data.Event) error
+	GetEventsAfter(seq uint64, engagement string, limit int) ([]data.Event, error)
+	// OldestEventSeq returns the sequence number of the oldest event kept, 0 if there are none.
+	OldestEventSeq() (uint64, error)
+}
+
+// Observer is told about every event the hub broadcasts, with its sequence number if events are persisted.
+// It is called by the hub's loop, so it must not block.
+type Observer func(engagement string, event []byte)
 
 // Hub maintains the set of active clients and broadcasts messages to them.
 type Hub struct {
 	// Registered clients.
-	clients *safe.Map
+	clients *safe.Map[*Client, bool]
 
 	// Inbound messages from the clients.
-	broadcast chan []byte
+	broadcast chan message
 
 	// Register requests from the clients.
 	register chan *Client
 
 	// Unregister requests from clients.
 	unregister chan *Client
+
+	// Subscription changes from clients.
+	subscribe chan subscribeRequest
+
+	// Beacon focus changes from clients, and presence snapshot requests.
+	focus    chan focusRequest
+	presence chan presenceRequest
+
+	// Health checks, answered by closing the channel.
+	ping chan chan struct{}
+
+	// Shutdown requests, answered by closing the channel. Once shut down, new clients are turned
+	// away; only read and written by Run.
+	shutdown chan chan struct{}
+	closed   bool
+
+	// Running client write pumps, waited for by Shutdown.
+	writers sync.WaitGroup
+
+	// Persists broadcast events; nil if events are not persisted.
+	events EventStore
+
+	// Server-side consumers of broadcast events; cluster observers also see the events of other replicas.
+	observers        []Observer
+	clusterObservers []Observer
+
+	// Shares events with the other TeamServer replicas; nil if there are none.
+	bus Bus
+
+	// Keepalive and slow-client settings; the zero value uses the defaults.
+	config config.WebSocketConfig
+}
+
+// message is a broadcast, optionally limited to the clients of one engagement.
+type message struct {
+	engagement string
+	data       []byte
+	persist    bool // Record the event and number it, see SetEventStore
+	remote     bool // Broadcast by another replica, see SetBus
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		broadcast:  make(chan []byte),
+		broadcast:  make(chan message),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
-		clients:    safe.NewMap(),
+		subscribe:  make(chan subscribeRequest),
+		focus:      make(chan focusRequest),
+		presence:   make(chan presenceRequest),
+		ping:       make(chan chan struct{}),
+		shutdown:   make(chan chan struct{}),
+		clients:    safe.NewMap[*Client, bool](),
 	}
 }
 
+// SetEventStore makes the hub persist every event it broadcasts, numbered with a sequence number
+// ("seq" in the event), and replay missed events to clients reconnecting with the last one they saw.
+// Call it before Run.
+func (h *Hub) SetEventStore(events EventStore) {
+	h.events = events
+}
+
+// AddObserver makes the hub pass every event it broadcasts to an observer. Call it before Run.
+func (h *Hub) AddObserver(observer Observer) {
+	h.observers = append(h.observers, observer)
+}
+
+// SetConfig sets the keepalive and slow-client settings. Call it before Run.
+func (h *Hub) SetConfig(cfg config.WebSocketConfig) {
+	h.config = cfg
+}
+
 func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.register:
+			if h.closed {
+				// Ends its WritePump, which closes the connection
+				close(client.send)
+				continue
+			}
+			// Missed events are queued before any new one, so the client sees them in order
+			h.replay(client)
 			h.clients.Store(client, true)
+			h.connected(client)
 		case client := <-h.unregister:
 			if _, ok := h.clients.Load(client); ok {
-				h.clients.Delete(client)
-				close(client.send)
+				h.remove(client)
 			}
-		case message := <-h.broadcast:
-			// First, collect all clients to send to
-			var clientsToSend []*Client
-			h.clients.Range(func(key, value interface{}) bool {
-				client := key.(*Client)
-				clientsToSend = append(clientsToSend, client)
+		case req := <-h.subscribe:
+			// Subscriptions are only read and written here, like the client set
+			if _, ok := h.clients.Load(req.client); ok {
+				req.client.subscription = req.subscription
+				h.acknowledge(req.client)
+			}
+		case req := <-h.focus:
+			if _, ok := h.clients.Load(req.client); ok {
+				h.focused(req.client, req.beaconID)
+			}
+		case req := <-h.presence:
+			req.reply <- h.snapshot(req.engagement)
+		case reply := <-h.ping:
+			close(reply)
+		case reply := <-h.shutdown:
+			h.closed = true
+			// Range iterates over a snapshot, so clients can be removed from within it
+			h.clients.Range(func(client *Client, _ bool) bool {
+				h.remove(client)
 				return true
 			})
+			close(reply)
+		case msg := <-h.broadcast:
+			h.dispatch(msg)
+		}
+	}
+}
 
-			// Send to clients, track those that failed
-			var failedClients []*Client
-			for _, client := range clientsToSend {
-				select {
-				case client.send <- message:
-					// Success
-				default:
-					// Failed, mark for cleanup
-					failedClients = append(failedClients, client)
-					close(client.send)
-				}
-			}
+// Ping checks that the hub's Run loop is serving requests, waiting until ctx is done at most.
+func (h *Hub) Ping(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case h.ping <- reply:
+		<-reply
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("hub is not responding: %w", ctx.Err())
+	}
+}
 
-			// Cleanup failed clients (outside of Range to avoid deadlock)
-			for _, client := range failedClients {
-				h.clients.Delete(client)
-			}
+// Shutdown disconnects all clients once the events already queued for them are written, and turns
+// new ones away. Events broadcast afterwards are still persisted and passed to the observers.
+// It waits until ctx is done at most.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case h.shutdown <- reply:
+		<-reply
+	case <-ctx.Done():
+		return fmt.Errorf("hub is not responding: %w", ctx.Err())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("WebSocket clients did not disconnect: %w", ctx.Err())
+	}
+}
+
+// dispatch sends a message to every client that should receive it. Only called by Run.
+func (h *Hub) dispatch(msg message) {
+	eventType, beaconID, isEvent := parseEvent(msg.data)
+	if msg.persist && isEvent {
+		msg.data = h.persist(msg, eventType)
+	}
+	if isEvent && !msg.remote {
+		for _, observer := range h.observers {
+			observer(msg.engagement, msg.data)
 		}
+		if h.bus != nil {
+			h.bus.Publish(msg.engagement, msg.data)
+		}
+	}
+	if isEvent {
+		for _, observer := range h.clusterObservers {
+			observer(msg.engagement, msg.data)
+		}
+	}
+	// First, collect all clients to send to
+	var clientsToSend []*Client
+	h.clients.Range(func(client *Client, _ bool) bool {
+		if client.subscription != nil && !client.subscription.matches(eventType, beaconID, msg.engagement) {
+			return true
+		}
+		if msg.engagement == "" || client.engagement == "" || client.engagement == msg.engagement {
+			clientsToSend = append(clientsToSend, client)
+		}
+		return true
+	})
+
+	// Send to clients, track those that failed
+	var failedClients []*Client
+	for _, client := range clientsToSend {
+		if !h.send(client, msg.data) {
+			// Failed, mark for cleanup
+			failedClients = append(failedClients, client)
+		}
+	}
+
+	// Cleanup failed clients once the event is queued for all others
+	for _, client := range failedClients {
+		h.remove(client)
 	}
 }
 
+// remove unregisters a client and closes its queue, which ends its WritePump. Only called by Run.
+func (h *Hub) remove(client *Client) {
+	h.clients.Delete(client)
+	close(client.send)
+	h.disconnected(client)
+}
+
 // Broadcast sends a message to all connected clients.
 func (h *Hub) Broadcast(message []byte) {
+	h.BroadcastTo("", message)
+}
+
+// BroadcastTo sends a message to the clients working in an engagement.
+// An empty engagement sends the message to all clients.
+func (h *Hub) BroadcastTo(engagement string, data []byte) {
 	// Add a newline character to the end of the message to act as a delimiter.
-	message = append(message, '\n')
-	h.broadcast <- message
+	data = append(data, '\n')
+	h.broadcast <- message{engagement: engagement, data: data, persist: true}
+}
+
+// send queues a message for a client without blocking the hub. It returns false if the client's
+// queue is full and the client has to be disconnected, which depends on the slow-client policy.
+func (h *Hub) send(client *Client, data []byte) bool {
+	select {
+	case client.send <- data:
+		return true
+	default:
+	}
+	if h.config.GetSlowClient() != config.SlowClientDropOldest {
+		logger.Warnf("Disconnecting slow WebSocket client: %d events queued", len(client.send))
+		return false
+	}
+
+	// Make room by discarding the oldest queued event; the gap in "seq" tells the client
+	select {
+	case <-client.send:
+	default:
+	}
+	select {
+	case client.send <- data:
+	default:
+	}
+	client.dropped++
+	if client.dropped == 1 || client.dropped%1000 == 0 {
+		logger.Warnf("Slow WebSocket client: %d events dropped", client.dropped)
+	}
+	return true
+}
+
+// persist records a JSON event and returns it with its sequence number.
+// Events that fail to be recorded are sent as they are.
+func (h *Hub) persist(msg message, eventType string) []byte {
+	if h.events == nil {
+		return msg.data
+	}
+	event := &data.Event{Type: eventType, Engagement: msg.engagement, Data: string(msg.data[:len(msg.data)-1])}
+	if err := h.events.CreateEvent(event); err != nil {
+		logger.Errorf("Failed to persist %s event: %v", eventType, err)
+		return msg.data
+	}
+	return withSeq(event.Data, event.Seq)
+}
+
+// acknowledge tells a client which subscription is now in effect.
+func (h *Hub) acknowledge(client *Client) {
+	ack, _ := json.Marshal(map[string]interface{}{
+		"type":    "SUBSCRIBED",
+		"payload": client.subscription, // null when subscribed to everything
+	})
+	select {
+	case client.send <- append(ack, '\n'):
+	default:
+		// The client is not keeping up; the broadcast loop drops it
+	}
+}
+
+// replay queues the events a reconnecting client missed.
+func (h *Hub) replay(client *Client) {
+	if h.events == nil || client.lastSeenSeq == 0 {
+		return
+	}
+	// Replay never blocks the hub: it leaves room in the client's queue for the truncation notice
+	limit := min(maxReplay, cap(client.send)-1)
+	oldest, err := h.events.OldestEventSeq()
+	if err != nil {
+		logger.Errorf("Failed to load missed events: %v", err)
+		return
+	}
+	events, err := h.events.GetEventsAfter(client.lastSeenSeq, client.engagement, limit+1)
+	if err != nil {
+		logger.Errorf("Failed to load missed events: %v", err)
+		return
+	}
+	// Events right after the last one the client saw were deleted by retention: it missed them for good
+	evicted := oldest > client.lastSeenSeq+1
+	if len(events) > limit || evicted {
+		truncated, _ := json.Marshal(map[string]interface{}{
+			"type":    "REPLAY_TRUNCATED",
+			"payload": map[string]interface{}{"last_seen_seq": client.lastSeenSeq},
+		})
+		client.send <- append(truncated, '\n')
+		return
+	}
+	for _, event := range events {
+		client.send <- withSeq(event.Data, event.Seq)
+	}
+}
+
+// withSeq adds the sequence number to a JSON object event and terminates it with a newline.
+func withSeq(event string, seq uint64) []byte {
+	out := make([]byte, 0, len(event)+24)
+	out = append(out, `{"seq":`...)
+	out = strconv.AppendUint(out, seq, 10)
+	if rest := event[1:]; rest != "}" {
+		out = append(out, ',')
+		out = append(out, rest...)
+	} else {
+		out = append(out, '}')
+	}
+	return append(out, '\n')
 }
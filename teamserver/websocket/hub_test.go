@@ -1,9 +1,15 @@
 package websocket
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
+
+	"simplec2/pkg/config"
+	"simplec2/teamserver/data"
 )
 
 // TestHubConcurrent tests the hub's concurrent safety
@@ -119,3 +125,358 @@ func TestHubStressTest(t *testing.T) {
 	t.Logf("Final client count: %d", hub.clients.Len())
 	t.Log("Stress test completed successfully without panic")
 }
+
+// memoryEvents is an in-memory EventStore.
+type memoryEvents struct {
+	mu     sync.Mutex
+	events []data.Event
+	next   uint64
+}
+
+func (m *memoryEvents) CreateEvent(event *data.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next++
+	event.Seq = m.next
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func (m *memoryEvents) GetEventsAfter(seq uint64, engagement string, limit int) ([]data.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []data.Event
+	for _, event := range m.events {
+		if event.Seq > seq && (engagement == "" || event.Engagement == "" || event.Engagement == engagement) && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (m *memoryEvents) OldestEventSeq() (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.events) == 0 {
+		return 0, nil
+	}
+	return m.events[0].Seq, nil
+}
+
+// evict deletes the n oldest events, as retention does.
+func (m *memoryEvents) evict(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = m.events[n:]
+}
+
+// received is an event as a client receives it.
+type received struct {
+	Seq     uint64          `json:"seq"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// settle waits until the hub has handled every request made before.
+func settle(t *testing.T, hub *Hub) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := hub.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// broadcastN broadcasts n events of a type to an engagement and waits for the hub to dispatch them.
+func broadcastN(t *testing.T, hub *Hub, engagement, eventType string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		hub.BroadcastTo(engagement, []byte(fmt.Sprintf(`{"type":%q,"payload":{"n":%d}}`, eventType, i)))
+	}
+	settle(t, hub)
+}
+
+// receive returns the next event queued for a client.
+func receive(t *testing.T, client *Client) received {
+	t.Helper()
+	select {
+	case msg, ok := <-client.send:
+		if !ok {
+			t.Fatal("client was disconnected")
+		}
+		var event received
+		if err := json.Unmarshal(msg, &event); err != nil {
+			t.Fatalf("invalid event %q: %v", msg, err)
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return received{}
+}
+
+// expectNone fails if an event is queued for a client.
+func expectNone(t *testing.T, client *Client) {
+	t.Helper()
+	select {
+	case msg := <-client.send:
+		t.Fatalf("unexpected event %q", msg)
+	default:
+	}
+}
+
+// TestHubReplay tests that a client reconnecting with the last sequence number it saw gets the events
+// it missed, in order and before new ones.
+func TestHubReplay(t *testing.T) {
+	hub := NewHub()
+	events := &memoryEvents{}
+	hub.SetEventStore(events)
+	go hub.Run()
+
+	broadcastN(t, hub, "", "TASK_OUTPUT", 3)
+	broadcastN(t, hub, "other", "TASK_OUTPUT", 1)
+	broadcastN(t, hub, "red", "BEACON_NEW", 2)
+
+	client := &Client{hub: hub, send: make(chan []byte, 16), engagement: "red", lastSeenSeq: 2}
+	hub.register <- client
+	broadcastN(t, hub, "red", "BEACON_NEW", 1)
+
+	// Seq 4 belongs to another engagement
+	for _, want := range []uint64{3, 5, 6, 7} {
+		if event := receive(t, client); event.Seq != want {
+			t.Fatalf("expected event %d, got %d (%s)", want, event.Seq, event.Type)
+		}
+	}
+	expectNone(t, client)
+
+	// A new client gets no replay
+	fresh := &Client{hub: hub, send: make(chan []byte, 16), engagement: "red"}
+	hub.register <- fresh
+	settle(t, hub)
+	expectNone(t, fresh)
+}
+
+// TestHubReplayTruncated tests that a client that missed more events than are replayed, or events
+// retention already deleted, is told to reload instead of getting an incomplete replay.
+func TestHubReplayTruncated(t *testing.T) {
+	hub := NewHub()
+	events := &memoryEvents{}
+	hub.SetEventStore(events)
+	go hub.Run()
+	broadcastN(t, hub, "", "TASK_OUTPUT", 5)
+
+	// A send buffer of 3 replays 2 events at most
+	small := &Client{hub: hub, send: make(chan []byte, 3), lastSeenSeq: 1}
+	hub.register <- small
+	settle(t, hub)
+	if event := receive(t, small); event.Type != "REPLAY_TRUNCATED" {
+		t.Fatalf("expected REPLAY_TRUNCATED, got %s", event.Type)
+	}
+	expectNone(t, small)
+
+	// Events 1 to 3 are gone: a client that saw 2 missed 3 for good
+	events.evict(3)
+	evicted := &Client{hub: hub, send: make(chan []byte, 16), lastSeenSeq: 2}
+	hub.register <- evicted
+	settle(t, hub)
+	if event := receive(t, evicted); event.Type != "REPLAY_TRUNCATED" {
+		t.Fatalf("expected REPLAY_TRUNCATED, got %s", event.Type)
+	}
+	expectNone(t, evicted)
+
+	// A client that saw 3 only missed events that are kept
+	current := &Client{hub: hub, send: make(chan []byte, 16), lastSeenSeq: 3}
+	hub.register <- current
+	settle(t, hub)
+	for _, want := range []uint64{4, 5} {
+		if event := receive(t, current); event.Seq != want {
+			t.Fatalf("expected event %d, got %d (%s)", want, event.Seq, event.Type)
+		}
+	}
+	expectNone(t, current)
+}
+
+// subscribe changes the subscription of a client and consumes the SUBSCRIBED acknowledgement.
+func subscribe(t *testing.T, hub *Hub, client *Client, subscription *Subscription) {
+	t.Helper()
+	hub.subscribe <- subscribeRequest{client: client, subscription: subscription}
+	settle(t, hub)
+	if event := receive(t, client); event.Type != "SUBSCRIBED" {
+		t.Fatalf("expected SUBSCRIBED, got %s", event.Type)
+	}
+}
+
+// TestHubSubscriptionFilters tests that a subscribed client only receives the events it asked for.
+func TestHubSubscriptionFilters(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	// Not bound to an engagement, limited to one by its subscription
+	byEngagement := &Client{hub: hub, send: make(chan []byte, 16)}
+	byType := &Client{hub: hub, send: make(chan []byte, 16)}
+	byBeacon := &Client{hub: hub, send: make(chan []byte, 16)}
+	// Working in an engagement, without a subscription
+	bound := &Client{hub: hub, send: make(chan []byte, 16), engagement: "red"}
+	for _, client := range []*Client{byEngagement, byType, byBeacon, bound} {
+		hub.register <- client
+	}
+	subscribe(t, hub, byEngagement, &Subscription{Engagements: []string{"red"}})
+	subscribe(t, hub, byType, &Subscription{EventTypes: []string{"TASK_OUTPUT"}})
+	subscribe(t, hub, byBeacon, &Subscription{BeaconIDs: []string{"b1"}})
+
+	hub.BroadcastTo("blue", []byte(`{"type":"BEACON_NEW","payload":{"BeaconID":"b2"}}`))
+	hub.BroadcastTo("red", []byte(`{"type":"BEACON_NEW","payload":{"BeaconID":"b1"}}`))
+	hub.BroadcastTo("blue", []byte(`{"type":"TASK_OUTPUT","payload":{"beacon_id":"b2"}}`))
+	hub.Broadcast([]byte(`{"type":"SECURITY_ALERT","payload":{"kind":"canary_hit"}}`))
+	settle(t, hub)
+
+	expect := func(client *Client, want ...string) {
+		t.Helper()
+		for _, eventType := range want {
+			if event := receive(t, client); event.Type != eventType {
+				t.Fatalf("expected %s, got %s", eventType, event.Type)
+			}
+		}
+		expectNone(t, client)
+	}
+	// Events sent to all engagements match any engagement filter
+	expect(byEngagement, "BEACON_NEW", "SECURITY_ALERT")
+	expect(byType, "TASK_OUTPUT")
+	// Events without a beacon don't match a beacon filter
+	expect(byBeacon, "BEACON_NEW")
+	expect(bound, "BEACON_NEW", "SECURITY_ALERT")
+}
+
+// TestHubSubscriptionChange tests that a new subscription applies to the next events, and that
+// clearing it sends everything again.
+func TestHubSubscriptionChange(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	client := &Client{hub: hub, send: make(chan []byte, 16)}
+	hub.register <- client
+
+	subscribe(t, hub, client, &Subscription{EventTypes: []string{"TASK_OUTPUT"}})
+	broadcastN(t, hub, "", "BEACON_NEW", 1)
+	expectNone(t, client)
+
+	subscribe(t, hub, client, &Subscription{EventTypes: []string{"BEACON_NEW"}})
+	broadcastN(t, hub, "", "TASK_OUTPUT", 1)
+	broadcastN(t, hub, "", "BEACON_NEW", 1)
+	if event := receive(t, client); event.Type != "BEACON_NEW" {
+		t.Fatalf("expected BEACON_NEW, got %s", event.Type)
+	}
+	expectNone(t, client)
+
+	subscribe(t, hub, client, nil)
+	broadcastN(t, hub, "", "TASK_OUTPUT", 1)
+	if event := receive(t, client); event.Type != "TASK_OUTPUT" {
+		t.Fatalf("expected TASK_OUTPUT after unsubscribing, got %s", event.Type)
+	}
+}
+
+// TestParseSubscription tests the subscription messages clients send.
+func TestParseSubscription(t *testing.T) {
+	sub, ok := parseSubscription([]byte(`{"type":"SUBSCRIBE","event_types":["TASK_OUTPUT"],"beacon_ids":["b1"]}`))
+	if !ok || sub == nil || len(sub.EventTypes) != 1 || sub.BeaconIDs[0] != "b1" {
+		t.Fatalf("SUBSCRIBE not parsed: %+v, %v", sub, ok)
+	}
+	if sub, ok := parseSubscription([]byte(`{"type":"UNSUBSCRIBE"}`)); !ok || sub != nil {
+		t.Fatalf("UNSUBSCRIBE not parsed: %+v, %v", sub, ok)
+	}
+	for _, msg := range []string{``, `ping`, `{"type":"FOCUS","beacon_id":"b1"}`} {
+		if _, ok := parseSubscription([]byte(msg)); ok {
+			t.Fatalf("%q parsed as a subscription change", msg)
+		}
+	}
+}
+
+// broadcastWithin broadcasts n events and fails if the hub takes longer than timeout to dispatch them.
+func broadcastWithin(t *testing.T, hub *Hub, n int, timeout time.Duration) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < n; i++ {
+			hub.Broadcast([]byte(fmt.Sprintf(`{"type":"TASK_OUTPUT","payload":{"n":%d}}`, i)))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatal("broadcasts blocked by a slow client")
+	}
+	settle(t, hub)
+}
+
+// TestHubSlowClientDisconnect tests that a client that never reads is disconnected once its queue is
+// full, without holding up the other clients.
+func TestHubSlowClientDisconnect(t *testing.T) {
+	hub := NewHub()
+	hub.SetConfig(config.WebSocketConfig{SlowClient: config.SlowClientDisconnect})
+	go hub.Run()
+
+	slow := &Client{hub: hub, send: make(chan []byte, 4)}
+	fast := &Client{hub: hub, send: make(chan []byte, 64)}
+	hub.register <- slow
+	hub.register <- fast
+	broadcastWithin(t, hub, 20, time.Second)
+
+	for i := 0; i < 20; i++ {
+		receive(t, fast)
+	}
+	if _, ok := hub.clients.Load(slow); ok {
+		t.Fatal("slow client is still registered")
+	}
+	if _, ok := hub.clients.Load(fast); !ok {
+		t.Fatal("fast client was disconnected")
+	}
+	// The events queued before it fell behind are still delivered, then its queue is closed
+	queued := 0
+	for range slow.send {
+		queued++
+	}
+	if queued != 4 {
+		t.Fatalf("expected the 4 events queued before the overflow, got %d", queued)
+	}
+
+	// Unregistering it again, as its ReadPump does when the connection closes, is harmless
+	hub.unregister <- slow
+	settle(t, hub)
+}
+
+// TestHubSlowClientDropOldest tests that with drop_oldest a client that never reads stays connected
+// and keeps the newest events, without holding up the other clients.
+func TestHubSlowClientDropOldest(t *testing.T) {
+	hub := NewHub()
+	hub.SetConfig(config.WebSocketConfig{SlowClient: config.SlowClientDropOldest})
+	go hub.Run()
+
+	slow := &Client{hub: hub, send: make(chan []byte, 4)}
+	fast := &Client{hub: hub, send: make(chan []byte, 64)}
+	hub.register <- slow
+	hub.register <- fast
+	broadcastWithin(t, hub, 20, time.Second)
+
+	for i := 0; i < 20; i++ {
+		receive(t, fast)
+	}
+	if _, ok := hub.clients.Load(slow); !ok {
+		t.Fatal("slow client was disconnected")
+	}
+	if slow.dropped != 16 || len(slow.send) != 4 {
+		t.Fatalf("expected 16 dropped and 4 queued events, got %d and %d", slow.dropped, len(slow.send))
+	}
+	var payload struct {
+		N int `json:"n"`
+	}
+	if err := json.Unmarshal(receive(t, slow).Payload, &payload); err != nil || payload.N != 16 {
+		t.Fatalf("expected the oldest queued event to be event 16, got %d (%v)", payload.N, err)
+	}
+
+	// Removed like any client once its connection closes
+	hub.unregister <- slow
+	settle(t, hub)
+	if _, ok := hub.clients.Load(slow); ok {
+		t.Fatal("slow client is still registered after unregistering")
+	}
+}
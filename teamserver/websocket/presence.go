@@ -0,0 +1,178 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Presence is an operator connected to an engagement, aggregated over all their connections (browser tabs).
+type Presence struct {
+	Username    string    `json:"username"`
+	Engagement  string    `json:"engagement"`
+	Connections int       `json:"connections"`
+	BeaconID    string    `json:"beacon_id"` // Beacon the operator last focused; empty for none
+	ConnectedAt time.Time `json:"connected_at"`
+	LastActive  time.Time `json:"last_active"` // Last connect or focus change
+
+	focusedAt time.Time // When BeaconID was focused
+}
+
+// focusMessage is a message a client sends when the operator switches beacons:
+// {"type": "FOCUS", "beacon_id": "..."}; an empty beacon ID clears the focus.
+type focusMessage struct {
+	Type     string `json:"type"`
+	BeaconID string `json:"beacon_id"`
+}
+
+// focusRequest asks the hub to change the beacon a client has focused.
+type focusRequest struct {
+	client   *Client
+	beaconID string
+}
+
+// presenceRequest asks the hub for the operators connected to an engagement.
+type presenceRequest struct {
+	engagement string
+	reply      chan []Presence
+}
+
+// parseFocus returns the beacon a client message focuses, if it is a focus message.
+func parseFocus(msg []byte) (string, bool) {
+	var focus focusMessage
+	if len(msg) == 0 || msg[0] != '{' || json.Unmarshal(msg, &focus) != nil || focus.Type != "FOCUS" {
+		return "", false
+	}
+	return focus.BeaconID, true
+}
+
+// Presence returns the operators connected to an engagement, or to any engagement if empty.
+func (h *Hub) Presence(engagement string) []Presence {
+	reply := make(chan []Presence, 1)
+	h.presence <- presenceRequest{engagement: engagement, reply: reply}
+	return <-reply
+}
+
+// connected records a new connection and announces the operator if it is their first. Only called by Run.
+func (h *Hub) connected(client *Client) {
+	if client.username == "" {
+		return
+	}
+	client.connectedAt = time.Now()
+	client.lastActive = client.connectedAt
+	// The new client is already registered, so the operator was online before if they have another
+	before := h.operatorPresence(client.username, client.engagement, client)
+	h.presenceChanged(client, before)
+}
+
+// disconnected announces an operator going offline, or their focus changing, once a connection is gone.
+// Only called by Run, after the client is unregistered.
+func (h *Hub) disconnected(client *Client) {
+	if client.username == "" {
+		return
+	}
+	before := h.operatorPresence(client.username, client.engagement, nil)
+	if before == nil {
+		before = &Presence{}
+	}
+	// Presence as it was with the client still connected
+	merge(before, client)
+	h.presenceChanged(client, before)
+}
+
+// focused changes the beacon a client has focused. Only called by Run.
+func (h *Hub) focused(client *Client, beaconID string) {
+	if client.username == "" {
+		return
+	}
+	before := h.operatorPresence(client.username, client.engagement, nil)
+	client.focusedBeacon = beaconID
+	client.focusedAt = time.Now()
+	client.lastActive = client.focusedAt
+	h.presenceChanged(client, before)
+}
+
+// presenceChanged broadcasts OPERATOR_ONLINE, OPERATOR_OFFLINE or OPERATOR_FOCUS to the client's
+// engagement if the operator's presence changed from before.
+func (h *Hub) presenceChanged(client *Client, before *Presence) {
+	after := h.operatorPresence(client.username, client.engagement, nil)
+
+	var eventType string
+	payload := after
+	switch {
+	case before == nil && after != nil:
+		eventType = "OPERATOR_ONLINE"
+	case before != nil && after == nil:
+		eventType = "OPERATOR_OFFLINE"
+		payload = &Presence{Username: client.username, Engagement: client.engagement, LastActive: before.LastActive}
+	case before != nil && after != nil && before.BeaconID != after.BeaconID:
+		eventType = "OPERATOR_FOCUS"
+	default:
+		return
+	}
+
+	event, _ := json.Marshal(map[string]interface{}{"type": eventType, "payload": payload})
+	h.dispatch(message{engagement: client.engagement, data: append(event, '\n'), persist: true})
+}
+
+// operatorPresence returns the presence of an operator in an engagement, ignoring the excluded client,
+// or nil if they are not connected. Only called by Run.
+func (h *Hub) operatorPresence(username, engagement string, exclude *Client) *Presence {
+	var presence *Presence
+	h.clients.Range(func(client *Client, _ bool) bool {
+		if client != exclude && client.username == username && client.engagement == engagement {
+			if presence == nil {
+				presence = &Presence{}
+			}
+			merge(presence, client)
+		}
+		return true
+	})
+	return presence
+}
+
+// snapshot returns the operators connected to an engagement, or to any engagement if empty. Only called by Run.
+func (h *Hub) snapshot(engagement string) []Presence {
+	operators := make(map[[2]string]*Presence)
+	h.clients.Range(func(client *Client, _ bool) bool {
+		if client.username == "" || (engagement != "" && client.engagement != engagement) {
+			return true
+		}
+		id := [2]string{client.username, client.engagement}
+		if operators[id] == nil {
+			operators[id] = &Presence{}
+		}
+		merge(operators[id], client)
+		return true
+	})
+
+	presence := make([]Presence, 0, len(operators))
+	for _, p := range operators {
+		presence = append(presence, *p)
+	}
+	sort.Slice(presence, func(i, j int) bool {
+		if presence[i].Username != presence[j].Username {
+			return presence[i].Username < presence[j].Username
+		}
+		return presence[i].Engagement < presence[j].Engagement
+	})
+	return presence
+}
+
+// merge adds a connection to an operator's presence. The focus is the one changed last,
+// so opening another tab doesn't clear it.
+func merge(presence *Presence, client *Client) {
+	presence.Username = client.username
+	presence.Engagement = client.engagement
+	presence.Connections++
+	if presence.ConnectedAt.IsZero() || client.connectedAt.Before(presence.ConnectedAt) {
+		presence.ConnectedAt = client.connectedAt
+	}
+	if client.lastActive.After(presence.LastActive) {
+		presence.LastActive = client.lastActive
+	}
+	if !client.focusedAt.IsZero() && !client.focusedAt.Before(presence.focusedAt) {
+		presence.focusedAt = client.focusedAt
+		presence.BeaconID = client.focusedBeacon
+	}
+}
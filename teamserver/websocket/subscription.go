@@ -0,0 +1,87 @@
+package websocket
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// Subscription limits the events a client receives. Empty fields don't restrict anything;
+// an event has to match every field that is set.
+type Subscription struct {
+	EventTypes []string `json:"event_types"` // e.g. "TASK_OUTPUT", "BEACON_NEW"
+	BeaconIDs  []string `json:"beacon_ids"`  // Events about other beacons, or no beacon at all, are dropped
+	// Events sent to all engagements always match
+	Engagements []string `json:"engagements"`
+}
+
+// subscriptionMessage is a message a client sends to change its subscription:
+// {"type": "SUBSCRIBE", "event_types": [...], ...} replaces it, {"type": "UNSUBSCRIBE"} clears it.
+type subscriptionMessage struct {
+	Type string `json:"type"`
+	Subscription
+}
+
+// subscribeRequest asks the hub to change the subscription of a client; nil clears it.
+type subscribeRequest struct {
+	client       *Client
+	subscription *Subscription
+}
+
+// matches reports whether the subscription lets an event through.
+func (s *Subscription) matches(eventType, beaconID, engagement string) bool {
+	if len(s.EventTypes) > 0 && !slices.Contains(s.EventTypes, eventType) {
+		return false
+	}
+	if len(s.BeaconIDs) > 0 && (beaconID == "" || !slices.Contains(s.BeaconIDs, beaconID)) {
+		return false
+	}
+	if len(s.Engagements) > 0 && engagement != "" && !slices.Contains(s.Engagements, engagement) {
+		return false
+	}
+	return true
+}
+
+// parseEvent returns the type of a JSON event and the beacon its payload is about, if any.
+// Payloads name the beacon "beacon_id" (event maps) or "BeaconID" (beacons and tasks).
+func parseEvent(data []byte) (eventType, beaconID string, ok bool) {
+	if len(data) < 2 || data[0] != '{' {
+		return "", "", false
+	}
+	var event struct {
+		Type    string `json:"type"`
+		Payload struct {
+			BeaconIDSnake string `json:"beacon_id"`
+			BeaconID      string `json:"BeaconID"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		// Payloads that are not objects carry no beacon ID
+		var header struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &header); err != nil {
+			return "", "", false
+		}
+		return header.Type, "", true
+	}
+	beaconID = event.Payload.BeaconID
+	if beaconID == "" {
+		beaconID = event.Payload.BeaconIDSnake
+	}
+	return event.Type, beaconID, true
+}
+
+// parseSubscription returns the subscription change a client message asks for, if it is one.
+func parseSubscription(msg []byte) (*Subscription, bool) {
+	var sub subscriptionMessage
+	if len(msg) == 0 || msg[0] != '{' || json.Unmarshal(msg, &sub) != nil {
+		return nil, false
+	}
+	switch sub.Type {
+	case "SUBSCRIBE":
+		return &sub.Subscription, true
+	case "UNSUBSCRIBE":
+		return nil, true
+	}
+	return nil, false
+}
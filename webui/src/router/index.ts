@@ -34,6 +34,12 @@ const router = createRouter({
       name: 'tasking',
       component: () => import('../views/Tasking.vue'),
       meta: { requiresAuth: true }
+    },
+    {
+      path: '/chat',
+      name: 'chat',
+      component: () => import('../views/Chat.vue'),
+      meta: { requiresAuth: true }
     }
   ]
 })
@@ -1,8 +1,9 @@
 import axios from 'axios'
 import { useToastStore } from '../stores/toast'
+import { useAuthStore } from '../stores/auth'
 
 const api = axios.create({
-    baseURL: '/api', // Proxy will handle this in dev, or relative path in prod
+    baseURL: '/api/v1', // Proxy will handle this in dev, or relative path in prod
     timeout: 10000,
     headers: {
         'Content-Type': 'application/json'
@@ -24,12 +25,41 @@ api.interceptors.request.use(
     }
 )
 
+// Concurrent 401s share one refresh request, since each refresh token can only be used once
+let refreshPromise: Promise<string | null> | null = null
+
+const refreshAccessToken = async (): Promise<string | null> => {
+    const refreshToken = localStorage.getItem('refresh_token')
+    if (!refreshToken) {
+        return null
+    }
+    try {
+        const response = await axios.post('/api/v1/auth/refresh', { refresh_token: refreshToken })
+        const { token, refresh_token } = response.data.data
+        useAuthStore().setTokens(token, refresh_token)
+        return token
+    } catch (e) {
+        return null
+    }
+}
+
 // Response interceptor
 api.interceptors.response.use(
     (response) => {
         return response
     },
-    (error) => {
+    async (error) => {
+        const original = error.config
+        if (error.response?.status === 401 && original && !original._retried && !original.url?.startsWith('/auth/')) {
+            original._retried = true
+            refreshPromise = refreshPromise || refreshAccessToken().finally(() => { refreshPromise = null })
+            const token = await refreshPromise
+            if (token) {
+                original.headers.Authorization = `Bearer ${token}`
+                return api(original)
+            }
+        }
+
         const toast = useToastStore()
 
         if (error.response) {
@@ -40,6 +70,7 @@ api.interceptors.response.use(
             if (error.response.status === 401) {
                 // Handle unauthorized (redirect to login)
                 localStorage.removeItem('token')
+                localStorage.removeItem('refresh_token')
                 localStorage.removeItem('user')
                 window.location.href = '/login'
             }
@@ -55,9 +86,9 @@ api.interceptors.response.use(
     }
 )
 
-export const downloadLootFile = async (filename: string) => {
+export const downloadLootFile = async (lootId: string) => {
     try {
-        const response = await api.get(`/loot/${filename}`, { responseType: 'blob' })
+        const response = await api.get(`/loot/${lootId}/download`, { responseType: 'blob' })
         return response.data
     } catch (error) {
         throw error
@@ -73,4 +104,175 @@ export const updateBeacon = async (beaconId: string, data: any) => {
     }
 }
 
+export const archiveBeacon = async (beaconId: string) => {
+    const response = await api.post(`/beacons/${beaconId}/archive`)
+    return response.data
+}
+
+export const restoreBeacon = async (beaconId: string) => {
+    const response = await api.post(`/beacons/${beaconId}/restore`)
+    return response.data
+}
+
+export const getHosts = async (params: { page?: number; limit?: number; search?: string } = {}) => {
+    const response = await api.get('/hosts', { params })
+    return response.data
+}
+
+export const getCredentials = async (params: { page?: number; limit?: number; host_id?: number } = {}) => {
+    const response = await api.get('/credentials', { params })
+    return response.data
+}
+
+export const getNetworkMap = async () => {
+    const response = await api.get('/network-map')
+    return response.data
+}
+
+export const getLoot = async (params: { page?: number; limit?: number; search?: string; tag?: string; type?: string; beacon_id?: string; task_id?: string } = {}) => {
+    const response = await api.get('/loot', { params })
+    return response.data
+}
+
+export const claimBeacon = async (beaconId: string, note = '', force = false) => {
+    const response = await api.post(`/beacons/${beaconId}/claim`, { note, force })
+    return response.data
+}
+
+export const releaseBeacon = async (beaconId: string, force = false) => {
+    await api.delete(`/beacons/${beaconId}/claim`, { params: force ? { force: true } : {} })
+}
+
+export const getClaims = async () => {
+    const response = await api.get('/claims')
+    return response.data
+}
+
+export const getNotificationRules = async () => {
+    const response = await api.get('/notification-rules')
+    return response.data
+}
+
+export const createNotificationRule = async (rule: any) => {
+    const response = await api.post('/notification-rules', rule)
+    return response.data
+}
+
+export const updateNotificationRule = async (ruleId: number, rule: any) => {
+    const response = await api.put(`/notification-rules/${ruleId}`, rule)
+    return response.data
+}
+
+export const deleteNotificationRule = async (ruleId: number) => {
+    await api.delete(`/notification-rules/${ruleId}`)
+}
+
+export const getBeaconNotes = async (beaconId: string) => {
+    const response = await api.get(`/beacons/${beaconId}/notes`)
+    return response.data
+}
+
+export const addBeaconNote = async (beaconId: string, body: string) => {
+    const response = await api.post(`/beacons/${beaconId}/notes`, { body })
+    return response.data
+}
+
+export const updateNote = async (noteId: number, body: string) => {
+    const response = await api.put(`/notes/${noteId}`, { body })
+    return response.data
+}
+
+export const deleteNote = async (noteId: number) => {
+    await api.delete(`/notes/${noteId}`)
+}
+
+export const getChatMessages = async (params: { before?: number; limit?: number } = {}) => {
+    const response = await api.get('/chat', { params })
+    return response.data
+}
+
+export const sendChatMessage = async (body: string) => {
+    const response = await api.post('/chat', { body })
+    return response.data
+}
+
+export const getBeaconScreenshots = async (beaconId: string, params: { page?: number; limit?: number } = {}) => {
+    const response = await api.get(`/beacons/${beaconId}/screenshots`, { params })
+    return response.data
+}
+
+export const updateLoot = async (lootId: string, data: { tags?: string[]; notes?: string }) => {
+    const response = await api.put(`/loot/${lootId}`, data)
+    return response.data
+}
+
+export const deleteLoot = async (lootId: string) => {
+    await api.delete(`/loot/${lootId}`)
+}
+
 export default api
+
+export const getAttackCoverage = async () => {
+    const response = await api.get('/attack-coverage')
+    return response.data
+}
+
+export const downloadAttackLayer = async () => {
+    const response = await api.get('/attack-coverage', { params: { format: 'navigator' }, responseType: 'blob' })
+    return response.data
+}
+
+export const downloadEngagementReport = async (format: 'markdown' | 'html' | 'pdf' = 'markdown', includeSecrets = false) => {
+    const response = await api.get('/reports/engagement', { params: { format, include_secrets: includeSecrets }, responseType: 'blob' })
+    return response.data
+}
+
+export const downloadDeconflictionLog = async (format: 'csv' | 'json' = 'csv') => {
+    const response = await api.get('/reports/deconfliction', { params: { format }, responseType: 'blob' })
+    return response.data
+}
+
+export const getStats = async (params: { minutes?: number; engagement?: string } = {}) => {
+    const response = await api.get('/stats', { params })
+    return response.data
+}
+
+export const getBackups = async () => {
+    const response = await api.get('/backups')
+    return response.data
+}
+
+export const createBackup = async () => {
+    const response = await api.post('/backups')
+    return response.data
+}
+
+export const downloadBackup = async (name: string) => {
+    const response = await api.get(`/backups/${name}`, { responseType: 'blob' })
+    return response.data
+}
+
+export const restoreBackup = async (name: string) => {
+    const response = await api.post(`/backups/${name}/restore`, { confirm: name })
+    return response.data
+}
+
+export const getRetentionReport = async () => {
+    const response = await api.get('/retention')
+    return response.data
+}
+
+export const applyRetention = async () => {
+    const response = await api.post('/retention/run')
+    return response.data
+}
+
+export const getTaskOutput = async (taskId: string) => {
+    const response = await api.get(`/tasks/${taskId}/output`, { responseType: 'text' })
+    return response.data
+}
+
+export const getTaskPage = async (beaconId: string, limit = 50, cursor?: string, status?: string) => {
+    const response = await api.get(`/beacons/${beaconId}/tasks`, { params: { limit, cursor, status } })
+    return response.data
+}
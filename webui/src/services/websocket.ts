@@ -1,11 +1,23 @@
 import { useToastStore } from '../stores/toast'
 import { useAuthStore } from '../stores/auth'
 
+export interface WebSocketSubscription {
+    event_types?: string[]
+    beacon_ids?: string[]
+    engagements?: string[]
+}
+
 class WebSocketService {
     private ws: WebSocket | null = null
     private reconnectInterval: number = 3000
     private shouldReconnect: boolean = true
     private messageHandlers: ((message: any) => void)[] = []
+    // Sequence number of the last event received, sent on reconnect to replay missed events
+    private lastSeenSeq: number = 0
+    // Server-side event filter, sent again after every reconnect
+    private subscription: WebSocketSubscription | null = null
+    // Beacon the operator is working on, shown to the team through presence events
+    private focusedBeacon: string = ''
 
     addMessageHandler(handler: (message: any) => void) {
         this.messageHandlers.push(handler)
@@ -19,22 +31,32 @@ class WebSocketService {
         const authStore = useAuthStore()
         const token = authStore.token
 
-        if (!token) {
+        if (!token && !authStore.certificateAuth) {
             console.warn('Cannot connect to WebSocket: No token available')
             return
         }
 
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:'
         // Use the current host (which includes port) to support both:
-        // 1. Dev mode via Vite proxy (ws://localhost:5173/api/ws -> ws://localhost:8080/api/ws)
-        // 2. Production mode (ws://server:port/api/ws)
+        // 1. Dev mode via Vite proxy (ws://localhost:5173/api/v1/ws -> ws://localhost:8080/api/v1/ws)
+        // 2. Production mode (ws://server:port/api/v1/ws)
         const host = window.location.host
-        const wsUrl = `${protocol}//${host}/api/ws?token=${token}`
+        const params = new URLSearchParams()
+        if (token) params.set('token', token)
+        if (this.lastSeenSeq) params.set('last_seen_seq', String(this.lastSeenSeq))
+        const query = params.toString()
+        const wsUrl = query ? `${protocol}//${host}/api/v1/ws?${query}` : `${protocol}//${host}/api/v1/ws`
 
         this.ws = new WebSocket(wsUrl)
 
         this.ws.onopen = () => {
             console.log('WebSocket connected')
+            if (this.subscription) {
+                this.ws?.send(JSON.stringify({ type: 'SUBSCRIBE', ...this.subscription }))
+            }
+            if (this.focusedBeacon) {
+                this.ws?.send(JSON.stringify({ type: 'FOCUS', beacon_id: this.focusedBeacon }))
+            }
         }
 
         this.ws.onmessage = (event) => {
@@ -76,6 +98,22 @@ class WebSocketService {
         }
     }
 
+    // Only receive the given event types / events about the given beacons; null receives everything
+    subscribe(subscription: WebSocketSubscription | null) {
+        this.subscription = subscription
+        if (this.ws?.readyState === WebSocket.OPEN) {
+            this.ws.send(JSON.stringify(subscription ? { type: 'SUBSCRIBE', ...subscription } : { type: 'UNSUBSCRIBE' }))
+        }
+    }
+
+    // Tell the team which beacon this operator has open; '' when none
+    focus(beaconId: string) {
+        this.focusedBeacon = beaconId
+        if (this.ws?.readyState === WebSocket.OPEN) {
+            this.ws.send(JSON.stringify({ type: 'FOCUS', beacon_id: beaconId }))
+        }
+    }
+
     disconnect() {
         this.shouldReconnect = false
         if (this.ws) {
@@ -86,6 +124,10 @@ class WebSocketService {
     private handleMessage(message: any) {
         const toast = useToastStore()
 
+        if (typeof message.seq === 'number' && message.seq > this.lastSeenSeq) {
+            this.lastSeenSeq = message.seq
+        }
+
         // Notify all registered handlers
         this.messageHandlers.forEach(handler => handler(message))
 
@@ -100,12 +142,47 @@ class WebSocketService {
             case 'LISTENER_STOPPED':
                 toast.warning(`Listener stopped: ${message.payload.Name}`)
                 break
+            case 'LISTENER_CREATED':
+                toast.info(`Listener created: ${message.payload.Name}`)
+                break
+            case 'LISTENER_DELETED':
+                toast.warning(`Listener deleted: ${message.payload.Name}`)
+                break
             case 'TASK_QUEUED':
                 toast.info(`Task queued for beacon ${message.payload.BeaconID}`)
                 break
+            case 'TASK_REQUEUED':
+                toast.warning(`Task ${message.payload.TaskID} was not acknowledged by beacon ${message.payload.BeaconID}, redelivering`)
+                break
+            case 'TASK_FAILED':
+                toast.error(`Task ${message.payload.task_id} failed: ${message.payload.reason}`)
+                break
             case 'TASK_CANCELED':
                 toast.warning(`Task ${message.payload.TaskID} canceled`)
                 break
+            case 'BEACON_LATE':
+                toast.warning(`Beacon ${message.payload.username}@${message.payload.hostname} missed ${message.payload.missed_windows} check-ins`)
+                break
+            case 'BEACON_LOST':
+                toast.error(`Beacon ${message.payload.username}@${message.payload.hostname} lost: no check-in for ${message.payload.missed_windows} windows`)
+                break
+            case 'BEACON_OUT_OF_SCOPE':
+                toast.error(`Out-of-scope beacon registered: ${message.payload.Username}@${message.payload.Hostname} (${message.payload.InternalIP})`, 0)
+                break
+            case 'REPLAY_TRUNCATED':
+                toast.warning('Missed too many events while disconnected, reload to see the latest state')
+                break
+            case 'SUBSCRIBED':
+            case 'OPERATOR_ONLINE':
+            case 'OPERATOR_OFFLINE':
+            case 'OPERATOR_FOCUS':
+                break
+            case 'CHAT_MESSAGE':
+                // Shown in the chat view; elsewhere, notify about messages from teammates
+                if (message.payload.Username !== useAuthStore().user && window.location.pathname !== '/chat') {
+                    toast.info(`${message.payload.Username}: ${message.payload.Body}`)
+                }
+                break
             case 'CLIENT_AUTHENTICATED':
                 // toast.info(`User ${message.payload.username} authenticated`)
                 break
@@ -113,6 +190,13 @@ class WebSocketService {
             case 'TASK_DISPATCHED':
             case 'BEACON_CHECKIN':
             case 'BEACON_METADATA_UPDATED':
+            case 'BEACON_ARCHIVED':
+            case 'BEACON_RESTORED':
+            case 'BEACON_CLAIMED':
+            case 'BEACON_RELEASED':
+            case 'NOTE_CREATED':
+            case 'NOTE_UPDATED':
+            case 'NOTE_DELETED':
             case 'BEACON_NEW':
             case 'FILE_DOWNLOAD_STARTED':
             case 'FILE_UPLOAD_COMPLETED':
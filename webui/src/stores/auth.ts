@@ -5,20 +5,38 @@ import router from '../router'
 
 export const useAuthStore = defineStore('auth', () => {
     const token = ref<string | null>(localStorage.getItem('token'))
+    const refreshToken = ref<string | null>(localStorage.getItem('refresh_token'))
     const user = ref<string | null>(localStorage.getItem('user'))
+    // Set for new accounts and admin resets; the API is locked until the password is changed
+    const mustChangePassword = ref(false)
 
-    const isAuthenticated = computed(() => !!token.value)
+    // With client certificate login the browser authenticates every request, so there is no token
+    const certificateAuth = ref(localStorage.getItem('auth_method') === 'certificate')
+
+    const isAuthenticated = computed(() => !!token.value || certificateAuth.value)
+
+    // Access tokens are short-lived; the refresh token is rotated on every refresh
+    const setTokens = (newToken: string, newRefreshToken: string | null) => {
+        token.value = newToken
+        refreshToken.value = newRefreshToken
+
+        localStorage.setItem('token', newToken)
+        if (newRefreshToken) {
+            localStorage.setItem('refresh_token', newRefreshToken)
+        } else {
+            localStorage.removeItem('refresh_token')
+        }
+    }
 
     const login = async (username: string, password: string) => {
         try {
             const response = await api.post('/auth/login', { username, password })
-            const { token: newToken } = response.data.data
+            const { token: newToken, refresh_token: newRefreshToken, operator } = response.data.data
 
-            token.value = newToken
+            setTokens(newToken, newRefreshToken)
             user.value = username
-
-            localStorage.setItem('token', newToken)
             localStorage.setItem('user', username)
+            mustChangePassword.value = !!operator?.MustChangePassword
 
             return true
         } catch (error) {
@@ -26,17 +44,40 @@ export const useAuthStore = defineStore('auth', () => {
         }
     }
 
+    const loginWithCertificate = (username: string) => {
+        certificateAuth.value = true
+        user.value = username
+        localStorage.setItem('auth_method', 'certificate')
+        localStorage.setItem('user', username)
+    }
+
+    // Changing the password revokes all sessions, so the response carries a new token pair
+    const changePassword = async (currentPassword: string, newPassword: string) => {
+        const response = await api.post('/auth/change-password', {
+            current_password: currentPassword,
+            new_password: newPassword
+        })
+        const { token: newToken, refresh_token: newRefreshToken } = response.data.data
+
+        setTokens(newToken, newRefreshToken)
+        mustChangePassword.value = false
+    }
+
     const logout = async () => {
         try {
-            if (token.value) {
-                await api.post('/auth/logout')
+            if (refreshToken.value) {
+                await api.post('/auth/revoke', { refresh_token: refreshToken.value })
             }
         } catch (e) {
             // Ignore errors on logout
         } finally {
             token.value = null
+            refreshToken.value = null
             user.value = null
+            certificateAuth.value = false
+            localStorage.removeItem('auth_method')
             localStorage.removeItem('token')
+            localStorage.removeItem('refresh_token')
             localStorage.removeItem('user')
             router.push('/login')
         }
@@ -44,9 +85,15 @@ export const useAuthStore = defineStore('auth', () => {
 
     return {
         token,
+        refreshToken,
         user,
+        mustChangePassword,
+        certificateAuth,
         isAuthenticated,
+        setTokens,
         login,
+        loginWithCertificate,
+        changePassword,
         logout
     }
 })
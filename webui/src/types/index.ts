@@ -15,7 +15,18 @@ export interface Beacon {
     ProcessName: string
     PID: number
     IsHighIntegrity: boolean
-    Note: string
+    OutOfScope: boolean
+    ArchivedAt: string | null
+}
+
+export interface Note {
+    ID: number
+    CreatedAt: string
+    UpdatedAt: string
+    BeaconID: string
+    TaskID: string
+    Author: string
+    Body: string
 }
 
 export interface Tunnel {